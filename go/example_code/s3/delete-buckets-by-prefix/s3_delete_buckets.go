@@ -14,28 +14,48 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 )
 
-func deleteBucketsByPrefix(sess *session.Session, prefix string) error {
-	// Create Amazon S3 service client
-	svc := s3.New(sess)
-
-	// Empty list to hold names of S3 buckets with prefix
-	bucketList := make([]string, 0)
+// bucketResult describes what happened to one bucket
+type bucketResult struct {
+	// The name of the bucket
+	Bucket string
+	// The number of object versions removed, or that would be removed in a dry run
+	Versions int
+	// The number of delete markers removed, or that would be removed in a dry run
+	DeleteMarkers int
+	// Why the bucket could not be emptied or deleted, or nil
+	Err error
+}
 
-	result, err := svc.ListBuckets(nil)
+// listBucketsByPrefix returns the names of the buckets that start with prefix
+// Inputs:
+//     svc is an Amazon S3 service client
+//     prefix is the first characters of the bucket names
+// Output:
+//     If success, the names of the matching buckets and nil
+//     Otherwise, nil and an error from the call to ListBuckets
+func listBucketsByPrefix(ctx context.Context, svc s3iface.S3API, prefix string) ([]string, error) {
+	result, err := svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	// Empty list to hold names of S3 buckets with prefix
+	bucketList := make([]string, 0)
+
 	for _, b := range result.Buckets {
 		// Does bucket name start with prefix
 		if strings.HasPrefix(*b.Name, prefix) {
@@ -43,42 +63,212 @@ func deleteBucketsByPrefix(sess *session.Session, prefix string) error {
 		}
 	}
 
-	for _, b := range bucketList {
-		// First delete any objects in the bucket
-		iter := s3manager.NewDeleteListIterator(svc, &s3.ListObjectsInput{
-			Bucket: aws.String(b),
-		})
+	return bucketList, nil
+}
 
-		err := s3manager.NewBatchDeleteWithClient(svc).Delete(aws.BackgroundContext(), iter)
-		if err != nil {
-			return err
+// emptyBucket removes every object version and delete marker in a bucket,
+// so that it can be deleted even if versioning is, or was, enabled
+// Inputs:
+//     svc is an Amazon S3 service client
+//     result is the bucket to empty, which gets the number of versions and delete markers
+//     dryRun is whether to only count them, and print what would be removed to w
+// Output:
+//     If success, nil
+//     Otherwise, an error from the call to ListObjectVersions or DeleteObjects
+func emptyBucket(ctx context.Context, svc s3iface.S3API, result *bucketResult, dryRun bool, w io.Writer) error {
+	var deleteErr error
+
+	// Each page holds at most 1000 versions and delete markers,
+	// which is also the most that DeleteObjects accepts
+	err := svc.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(result.Bucket),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		objects := make([]*s3.ObjectIdentifier, 0, len(page.Versions)+len(page.DeleteMarkers))
+
+		for _, v := range page.Versions {
+			objects = append(objects, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
 		}
 
-		_, err = svc.DeleteBucket(&s3.DeleteBucketInput{
-			Bucket: aws.String(b),
-		})
-		if err != nil {
-			return err
+		for _, m := range page.DeleteMarkers {
+			objects = append(objects, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+
+		if len(objects) == 0 {
+			return true
 		}
 
-		err = svc.WaitUntilBucketNotExists(&s3.HeadBucketInput{
-			Bucket: aws.String(b),
+		if dryRun {
+			for _, o := range objects {
+				fmt.Fprintf(w, "Would delete s3://%s/%s (version %s)\n", result.Bucket, *o.Key, aws.StringValue(o.VersionId))
+			}
+
+			result.Versions += len(page.Versions)
+			result.DeleteMarkers += len(page.DeleteMarkers)
+			return true
+		}
+
+		output, err := svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(result.Bucket),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
 		})
 		if err != nil {
-			return err
+			deleteErr = err
+			return false
+		}
+
+		if len(output.Errors) > 0 {
+			e := output.Errors[0]
+			deleteErr = fmt.Errorf("could not delete %d objects, first %s: %s: %s",
+				len(output.Errors), aws.StringValue(e.Key), aws.StringValue(e.Code), aws.StringValue(e.Message))
+			return false
 		}
+
+		result.Versions += len(page.Versions)
+		result.DeleteMarkers += len(page.DeleteMarkers)
+		return true
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return deleteErr
+}
+
+// deleteBucket empties a bucket and then deletes it
+// Inputs:
+//     svc is an Amazon S3 service client
+//     bucket is the name of the bucket
+//     dryRun is whether to only print what would be removed to w
+// Output:
+//     The result for the bucket, with Err set if it could not be emptied or deleted
+func deleteBucket(ctx context.Context, svc s3iface.S3API, bucket string, dryRun bool, w io.Writer) bucketResult {
+	result := bucketResult{Bucket: bucket}
+
+	result.Err = emptyBucket(ctx, svc, &result, dryRun, w)
+	if result.Err != nil {
+		return result
+	}
+
+	if dryRun {
+		fmt.Fprintf(w, "Would delete bucket %s\n", bucket)
+		return result
+	}
+
+	_, result.Err = svc.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if result.Err != nil {
+		return result
+	}
+
+	result.Err = svc.WaitUntilBucketNotExistsWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+
+	return result
+}
+
+// deleteBucketsByPrefix empties and deletes the buckets whose names start with prefix,
+// working on up to workers buckets at a time
+// Inputs:
+//     svc is an Amazon S3 service client
+//     prefix is the first characters of the bucket names
+//     dryRun is whether to only print what would be removed to w, without removing anything
+//     workers is how many buckets to empty at once; values less than 1 mean 1
+// Output:
+//     If the buckets could be listed, a result for each matching bucket, in the order listed, and nil.
+//     A failure to empty or delete one bucket doesn't stop the others; check each result's Err.
+//     Otherwise, nil and an error from the call to ListBuckets
+func deleteBucketsByPrefix(ctx context.Context, svc s3iface.S3API, prefix string, dryRun bool, workers int, w io.Writer) ([]bucketResult, error) {
+	bucketList, err := listBucketsByPrefix(ctx, svc, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]bucketResult, len(bucketList))
+	indexes := make(chan int)
+
+	// Dry-run output from different buckets shouldn't interleave mid-line
+	out := &lockedWriter{w: w}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				results[i] = deleteBucket(ctx, svc, bucketList[i], dryRun, out)
+			}
+		}()
+	}
+
+	for i := range bucketList {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	return results, nil
+}
+
+// lockedWriter serializes writes from several goroutines
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.w.Write(p)
+}
+
+// printSummary prints one line per bucket and the number that failed
+// Output:
+//     The number of buckets that could not be emptied or deleted
+func printSummary(w io.Writer, results []bucketResult, dryRun bool) int {
+	failed := 0
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(w, "FAILED  %s: %v\n", r.Bucket, r.Err)
+			continue
+		}
+
+		fmt.Fprintf(w, "OK      %s: %s %d object versions and %d delete markers\n", r.Bucket, verb, r.Versions, r.DeleteMarkers)
+	}
+
+	fmt.Fprintf(w, "%d buckets, %d succeeded, %d failed\n", len(results), len(results)-failed, failed)
+
+	return failed
 }
 
 // Deletes any S3 buckets in the default AWS Region
-// that start with the given text
+// that start with the given text,
+// including every object version and delete marker in them
 //
 // Usage:
-//    go run s3_delete_buckets -p PREFIX
+//    go run s3_delete_buckets -p PREFIX [-n] [-w WORKERS]
 func main() {
 	prefixPtr := flag.String("p", "", "The prefix of the buckets to delete")
+	dryRun := flag.Bool("n", false, "Print what would be deleted, without deleting anything")
+	workers := flag.Int("w", 4, "How many buckets to empty at the same time")
 	flag.Parse()
 	prefix := *prefixPtr
 
@@ -93,10 +283,14 @@ func main() {
 		SharedConfigState: session.SharedConfigEnable,
 	}))
 
-	err := deleteBucketsByPrefix(sess, prefix)
+	results, err := deleteBucketsByPrefix(context.Background(), s3.New(sess), prefix, *dryRun, *workers, os.Stdout)
 	if err != nil {
-		fmt.Println("Could not delete buckets with prefix " + prefix)
-	} else {
-		fmt.Println("Deleted buckets with prefix " + prefix)
+		fmt.Println("Could not list buckets with prefix " + prefix)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if printSummary(os.Stdout, results, *dryRun) > 0 {
+		os.Exit(1)
 	}
 }
@@ -14,19 +14,199 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+// mockS3Client holds versioned buckets in memory
+type mockS3Client struct {
+	s3iface.S3API
+
+	mu sync.Mutex
+	// Each bucket's object versions and delete markers, as key/version pairs
+	versions map[string][]*s3.ObjectVersion
+	markers  map[string][]*s3.DeleteMarkerEntry
+	// Buckets whose DeleteBucket call fails
+	broken map[string]bool
+}
+
+func (m *mockS3Client) ListBucketsWithContext(aws.Context, *s3.ListBucketsInput, ...request.Option) (*s3.ListBucketsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.versions))
+	for name := range m.versions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	output := &s3.ListBucketsOutput{}
+	for _, name := range names {
+		output.Buckets = append(output.Buckets, &s3.Bucket{Name: aws.String(name)})
+	}
+
+	return output, nil
+}
+
+// ListObjectVersionsPagesWithContext returns one version or delete marker per page,
+// so that emptying a bucket takes several DeleteObjects calls
+func (m *mockS3Client) ListObjectVersionsPagesWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool, opts ...request.Option) error {
+	m.mu.Lock()
+	var pages []*s3.ListObjectVersionsOutput
+	for _, v := range m.versions[*input.Bucket] {
+		pages = append(pages, &s3.ListObjectVersionsOutput{Versions: []*s3.ObjectVersion{v}})
+	}
+
+	for _, d := range m.markers[*input.Bucket] {
+		pages = append(pages, &s3.ListObjectVersionsOutput{DeleteMarkers: []*s3.DeleteMarkerEntry{d}})
+	}
+	m.mu.Unlock()
+
+	for i, page := range pages {
+		if !fn(page, i == len(pages)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (m *mockS3Client) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bucket := *input.Bucket
+	for _, o := range input.Delete.Objects {
+		for i, v := range m.versions[bucket] {
+			if *v.Key == *o.Key && *v.VersionId == *o.VersionId {
+				m.versions[bucket] = append(m.versions[bucket][:i], m.versions[bucket][i+1:]...)
+				break
+			}
+		}
+
+		for i, d := range m.markers[bucket] {
+			if *d.Key == *o.Key && *d.VersionId == *o.VersionId {
+				m.markers[bucket] = append(m.markers[bucket][:i], m.markers[bucket][i+1:]...)
+				break
+			}
+		}
+	}
+
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (m *mockS3Client) DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (*s3.DeleteBucketOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bucket := *input.Bucket
+	if m.broken[bucket] {
+		return nil, errors.New("AccessDenied")
+	}
+
+	if len(m.versions[bucket]) > 0 || len(m.markers[bucket]) > 0 {
+		return nil, errors.New("BucketNotEmpty")
+	}
+
+	delete(m.versions, bucket)
+	delete(m.markers, bucket)
+
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+func (m *mockS3Client) WaitUntilBucketNotExistsWithContext(aws.Context, *s3.HeadBucketInput, ...request.WaiterOption) error {
+	return nil
+}
+
+func newMockS3Client() *mockS3Client {
+	m := &mockS3Client{
+		versions: map[string][]*s3.ObjectVersion{},
+		markers:  map[string][]*s3.DeleteMarkerEntry{},
+		broken:   map[string]bool{"dummy-broken": true},
+	}
+
+	for _, bucket := range []string{"dummy-a", "dummy-b", "dummy-broken", "keep-me"} {
+		m.versions[bucket] = []*s3.ObjectVersion{
+			{Key: aws.String("dummy"), VersionId: aws.String("v1")},
+			{Key: aws.String("dummy"), VersionId: aws.String("v2")},
+		}
+		m.markers[bucket] = []*s3.DeleteMarkerEntry{
+			{Key: aws.String("dummy"), VersionId: aws.String("v3")},
+		}
+	}
+
+	return m
+}
+
+func TestDeleteBucketsByPrefixMock(t *testing.T) {
+	// When the test started
+	thisTime := time.Now()
+	nowString := thisTime.Format("20060102150405")
+	t.Log("Starting unit test at " + nowString)
+
+	svc := newMockS3Client()
+
+	// A dry run removes nothing
+	var out bytes.Buffer
+	results, err := deleteBucketsByPrefix(context.Background(), svc, "dummy-", true, 2, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 || len(svc.versions) != 4 {
+		t.Fatalf("Expected 3 results and 4 buckets after a dry run, but got %d results and %d buckets", len(results), len(svc.versions))
+	}
+
+	if !strings.Contains(out.String(), "Would delete s3://dummy-a/dummy (version v3)") {
+		t.Errorf("The dry run did not list the delete marker:\n%s", out.String())
+	}
+
+	results, err = deleteBucketsByPrefix(context.Background(), svc, "dummy-", false, 2, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range results {
+		switch r.Bucket {
+		case "dummy-broken":
+			if r.Err == nil {
+				t.Errorf("Expected an error deleting bucket %s", r.Bucket)
+			}
+		default:
+			if r.Err != nil || r.Versions != 2 || r.DeleteMarkers != 1 {
+				t.Errorf("Expected 2 versions and 1 delete marker deleted from bucket %s, but got %+v", r.Bucket, r)
+			}
+		}
+	}
+
+	if printSummary(&out, results, false) != 1 {
+		t.Errorf("Expected one failure in the summary:\n%s", out.String())
+	}
+
+	// Only the failed bucket and the one without the prefix are left
+	if _, ok := svc.versions["keep-me"]; !ok || len(svc.versions) != 2 {
+		t.Errorf("Expected only buckets dummy-broken and keep-me to be left, but got %v", svc.versions)
+	}
+}
+
 func createBucket(sess *session.Session, bucketName string) error {
 	// Create Amazon S3 service client
 	svc := s3.New(sess)
@@ -128,7 +308,11 @@ func TestDeleteBuckets(t *testing.T) {
 	}
 
 	// Now delete them
-	err = deleteBucketsByPrefix(sess, prefix)
+	results, err := deleteBucketsByPrefix(context.Background(), s3.New(sess), prefix, false, 3, os.Stdout)
+	if err == nil && printSummary(os.Stdout, results, false) > 0 {
+		err = errors.New("could not delete every bucket")
+	}
+
 	if err != nil {
 		t.Log("You might have to delete these buckets with:")
 		t.Log("go run s3_delete_buckets.go -p dummy-")
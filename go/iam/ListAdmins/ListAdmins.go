@@ -5,215 +5,580 @@ package main
 
 // snippet-start:[iam.go.list_admins.imports]
 import (
+    "encoding/csv"
+    "encoding/json"
+    "flag"
     "fmt"
-
+    "io"
+    "net/url"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+
+    "github.com/aws/aws-sdk-go/aws"
     "github.com/aws/aws-sdk-go/aws/session"
     "github.com/aws/aws-sdk-go/service/iam"
+    "github.com/aws/aws-sdk-go/service/iam/iamiface"
 )
 // snippet-end:[iam.go.list_admins.imports]
 
-// snippet-start:[iam.go.list_admins.user_policy_has_admin]
-func userPolicyHasAdmin(user *iam.UserDetail, admin string) bool {
-    for _, policy := range user.UserPolicyList {
-        if *policy.PolicyName == admin {
-            return true
+// The ways a user can get a policy
+const (
+    GrantInlineUserPolicy    = "inline user policy"
+    GrantAttachedUserPolicy  = "attached user policy"
+    GrantInlineGroupPolicy   = "inline group policy"
+    GrantAttachedGroupPolicy = "attached group policy"
+)
+
+// The name of the AWS managed policy that grants administrator access
+const adminPolicyName = "AdministratorAccess"
+
+// AdminGrant is one way a user gets administrator privileges
+type AdminGrant struct {
+    // Kind is how the user gets the policy, such as GrantAttachedGroupPolicy
+    Kind string `json:"kind"`
+    // Group is the group the policy comes through, for group policies
+    Group string `json:"group,omitempty"`
+    // Policy is the name of the policy
+    Policy string `json:"policy"`
+    // PolicyArn is the ARN of an attached managed policy
+    PolicyArn string `json:"policyArn,omitempty"`
+    // Reason says what in the policy grants administrator privileges
+    Reason string `json:"reason"`
+}
+
+// UserPrivileges describes the administrator privileges of one user.
+// A user with grants isn't an administrator if any of their policies also denies everything.
+type UserPrivileges struct {
+    UserName string       `json:"userName"`
+    Arn      string       `json:"arn"`
+    Admin    bool         `json:"admin"`
+    Grants   []AdminGrant `json:"grants,omitempty"`
+    // Denials are the policies that override the grants
+    Denials  []AdminGrant `json:"denials,omitempty"`
+}
+
+// PrivilegeReport lists every user in an account, and how each administrator gets their privileges
+type PrivilegeReport struct {
+    Users []UserPrivileges `json:"users"`
+}
+
+// Admins returns the users with administrator privileges
+func (r *PrivilegeReport) Admins() []UserPrivileges {
+    var admins []UserPrivileges
+    for _, u := range r.Users {
+        if u.Admin {
+            admins = append(admins, u)
         }
     }
 
-    return false
+    return admins
 }
-// snippet-end:[iam.go.list_admins.user_policy_has_admin]
 
-// snippet-start:[iam.go.list_admins_attached_user_policy_has_admin]
-func attachedUserPolicyHasAdmin(user *iam.UserDetail, admin string) bool {
-    for _, policy := range user.AttachedManagedPolicies {
-        if *policy.PolicyName == admin {
-            return true
+// WriteJSON writes the report as an indented JSON document
+func (r *PrivilegeReport) WriteJSON(w io.Writer) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+
+    return enc.Encode(r)
+}
+
+// rows returns the grants of a user followed by the denials
+func (u UserPrivileges) rows() []AdminGrant {
+    return append(append([]AdminGrant{}, u.Grants...), u.Denials...)
+}
+
+// WriteCSV writes the report as CSV, with a header row and one row for each grant or denial.
+// A user with neither gets a single row with empty grant columns.
+func (r *PrivilegeReport) WriteCSV(w io.Writer) error {
+    cw := csv.NewWriter(w)
+
+    err := cw.Write([]string{"user", "arn", "admin", "kind", "group", "policy", "policy_arn", "reason"})
+    if err != nil {
+        return err
+    }
+
+    for _, u := range r.Users {
+        rows := u.rows()
+        if len(rows) == 0 {
+            err = cw.Write([]string{u.UserName, u.Arn, strconv.FormatBool(u.Admin), "", "", "", "", ""})
+            if err != nil {
+                return err
+            }
+        }
+
+        for _, g := range rows {
+            err = cw.Write([]string{u.UserName, u.Arn, strconv.FormatBool(u.Admin), g.Kind, g.Group, g.Policy, g.PolicyArn, g.Reason})
+            if err != nil {
+                return err
+            }
         }
     }
 
-    return false
+    cw.Flush()
+
+    return cw.Error()
+}
+
+// WriteTable writes the report as an aligned text table, with one line for each grant or denial
+func (r *PrivilegeReport) WriteTable(w io.Writer) error {
+    tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+    fmt.Fprintln(tw, "USER\tADMIN\tGRANTED BY\tGROUP\tPOLICY\tREASON")
+
+    for _, u := range r.Users {
+        rows := u.rows()
+        if len(rows) == 0 {
+            fmt.Fprintf(tw, "%s\t%t\t-\t-\t-\t-\n", u.UserName, u.Admin)
+        }
+
+        for _, g := range rows {
+            group := g.Group
+            if group == "" {
+                group = "-"
+            }
+
+            fmt.Fprintf(tw, "%s\t%t\t%s\t%s\t%s\t%s\n", u.UserName, u.Admin, g.Kind, group, g.Policy, g.Reason)
+        }
+    }
+
+    return tw.Flush()
 }
-// snippet-end:[iam.go.list_admins_attached_user_policy_has_admin]
 
-// snippet-start:[iam.go.list_admins_group_policy_has_admin]
-func groupPolicyHasAdmin(svc *iam.IAM, group *iam.Group, admin string) (bool, error) {
-    input := &iam.ListGroupPoliciesInput{
-        GroupName: group.GroupName,
+// stringOrSlice is a policy element that can be a single string or a list of strings
+type stringOrSlice []string
+
+func (s *stringOrSlice) UnmarshalJSON(data []byte) error {
+    var one string
+    if err := json.Unmarshal(data, &one); err == nil {
+        *s = []string{one}
+        return nil
     }
 
-    result, err := svc.ListGroupPolicies(input)
+    var many []string
+    err := json.Unmarshal(data, &many)
     if err != nil {
-        return false, err
+        return err
     }
 
-    // Wade through policies
-    for _, policyName := range result.PolicyNames {
-        if *policyName == admin {
-            return true, nil
+    *s = many
+
+    return nil
+}
+
+// matches returns whether value matches any of the patterns,
+// where * matches any sequence of characters and ? matches any one character
+func (s stringOrSlice) matches(value string, foldCase bool) bool {
+    for _, pattern := range s {
+        expr := regexp.QuoteMeta(pattern)
+        expr = strings.ReplaceAll(expr, `\*`, ".*")
+        expr = strings.ReplaceAll(expr, `\?`, ".")
+        if foldCase {
+            expr = "(?i)" + expr
+        }
+
+        if regexp.MustCompile("^" + expr + "$").MatchString(value) {
+            return true
         }
     }
 
-    return false, nil
+    return false
+}
+
+// policyStatement holds the parts of a policy statement that decide whether it grants everything
+type policyStatement struct {
+    Sid         string          `json:"Sid"`
+    Effect      string          `json:"Effect"`
+    Action      stringOrSlice   `json:"Action"`
+    NotAction   stringOrSlice   `json:"NotAction"`
+    Resource    stringOrSlice   `json:"Resource"`
+    NotResource stringOrSlice   `json:"NotResource"`
+    Condition   json.RawMessage `json:"Condition"`
 }
-// snippet-end:[iam.go.list_admins_group_policy_has_admin]
 
-// snippet-start:[iam.go.list_admins_attached_group_policy_has_admin]
-func attachedGroupPolicyHasAdmin(svc *iam.IAM, group *iam.Group, admin string) (bool, error) {
-    input := &iam.ListAttachedGroupPoliciesInput{GroupName: group.GroupName}
-    result, err := svc.ListAttachedGroupPolicies(input)
+// statementList is a policy's Statement element, which can be a single statement or a list
+type statementList []policyStatement
+
+func (s *statementList) UnmarshalJSON(data []byte) error {
+    var one policyStatement
+    if err := json.Unmarshal(data, &one); err == nil {
+        *s = []policyStatement{one}
+        return nil
+    }
+
+    var many []policyStatement
+    err := json.Unmarshal(data, &many)
     if err != nil {
-        return false, err
+        return err
     }
 
-    for _, policy := range result.AttachedPolicies {
-        if *policy.PolicyName == admin {
-            return true, nil
-        }
+    *s = many
+
+    return nil
+}
+
+// everythingAction and everythingResource stand for a request for every action on every resource:
+// only the * and *:* wildcards match the action, and only * matches the resource
+const (
+    everythingAction   = "any-service:AnyAction"
+    everythingResource = "arn:aws:any-service:::any-resource"
+)
+
+// appliesToEverything returns whether a statement without conditions applies to every action on every resource,
+// by checking it against a request for everythingAction on everythingResource
+func (s policyStatement) appliesToEverything() bool {
+    if len(s.Condition) > 0 || (s.Action == nil && s.NotAction == nil) {
+        return false
     }
 
-    return false, nil
+    if s.Action != nil && !s.Action.matches(everythingAction, true) {
+        return false
+    }
+
+    if s.NotAction != nil && s.NotAction.matches(everythingAction, true) {
+        return false
+    }
+
+    if s.Resource != nil && !s.Resource.matches(everythingResource, false) {
+        return false
+    }
+
+    return s.NotResource == nil || !s.NotResource.matches(everythingResource, false)
+}
+
+// allowsEverything returns whether a statement allows every action on every resource
+// with Action and Resource, and without conditions
+func (s policyStatement) allowsEverything() bool {
+    return strings.EqualFold(s.Effect, "Allow") && s.Action != nil && s.Resource != nil && s.appliesToEverything()
 }
-// snippet-end:[iam.go.list_admins_attached_group_policy_has_admin]
 
-// snippet-start:[iam.go.list_admins_users_groups_have_admin]
-func usersGroupsHaveAdmin(svc *iam.IAM, user *iam.UserDetail, admin string) (bool, error) {
-    input := &iam.ListGroupsForUserInput{UserName: user.UserName}
-    result, err := svc.ListGroupsForUser(input)
+// deniesEverything returns whether a statement denies every action on every resource without conditions,
+// with Action or NotAction and Resource or NotResource
+func (s policyStatement) deniesEverything() bool {
+    return strings.EqualFold(s.Effect, "Deny") && s.appliesToEverything()
+}
+
+// parsePolicy returns the statements of a policy document.
+// The document can be URL-encoded, as GetAccountAuthorizationDetails returns it.
+func parsePolicy(name string, document string) (statementList, error) {
+    text, err := url.PathUnescape(document)
     if err != nil {
-        return false, err
+        text = document
     }
 
-    for _, group := range result.Groups {
-        groupPolicyHasAdmin, err := groupPolicyHasAdmin(svc, group, admin)
-        if err != nil {
-            return false, err
-        }
+    var policy struct {
+        Statement statementList `json:"Statement"`
+    }
+
+    err = json.Unmarshal([]byte(text), &policy)
+    if err != nil {
+        return nil, fmt.Errorf("can't parse policy %s: %v", name, err)
+    }
+
+    return policy.Statement, nil
+}
+
+// userPolicy is one policy that applies to a user, and how the user gets it
+type userPolicy struct {
+    // source says where the policy comes from. Its Reason is empty.
+    source AdminGrant
+    // statements is nil if the document of an attached policy isn't known
+    statements statementList
+}
+
+// statementID returns the Sid of a statement, or its index if it has none
+func statementID(s policyStatement, i int) string {
+    if s.Sid != "" {
+        return s.Sid
+    }
 
-        if groupPolicyHasAdmin {
-            return true, nil
+    return strconv.Itoa(i)
+}
+
+// evaluate decides whether the policies of a user, taken together, grant administrator privileges.
+// A policy grants them if a statement without conditions allows Action "*" on Resource "*".
+// If its document isn't known, it's judged by its name.
+// A statement without conditions that denies every action on every resource,
+// such as Action "*" or a NotAction, in any of the user's policies, overrides every grant.
+// Output:
+//     The grants and the denials, each with the reason from its policy
+func evaluate(policies []userPolicy) ([]AdminGrant, []AdminGrant) {
+    var grants, denials []AdminGrant
+    for _, p := range policies {
+        if p.statements == nil {
+            if p.source.Policy == adminPolicyName {
+                g := p.source
+                g.Reason = "named " + adminPolicyName
+                grants = append(grants, g)
+            }
+
+            continue
         }
 
-        attachedGroupPolicyHasAdmin, err := attachedGroupPolicyHasAdmin(svc, group, admin)
-        if err != nil {
-            return false, err
+        allowed := false
+        for i, s := range p.statements {
+            if s.deniesEverything() {
+                d := p.source
+                d.Reason = fmt.Sprintf("statement %s denies every action on every resource", statementID(s, i))
+                denials = append(denials, d)
+            }
+
+            if !allowed && s.allowsEverything() {
+                allowed = true
+
+                g := p.source
+                g.Reason = fmt.Sprintf("statement %s allows Action * on Resource *", statementID(s, i))
+                grants = append(grants, g)
+            }
         }
+    }
 
-        if attachedGroupPolicyHasAdmin {
-            return true, nil
+    return grants, denials
+}
+
+// defaultDocument returns the document of the default version of a managed policy
+func defaultDocument(policy *iam.ManagedPolicyDetail) *string {
+    for _, v := range policy.PolicyVersionList {
+        if aws.BoolValue(v.IsDefaultVersion) {
+            return v.Document
         }
     }
 
-    return false, nil
+    return nil
 }
-// snippet-end:[iam.go.list_admins_users_groups_have_admin]
 
-// GetNumUsersAndAdmins determines how many users have administrator privileges.
-// Inputs:
-//     sess is the current session, which provides configuration for the SDK's service clients
-//     name is the name of the RESOURCE
-// Output:
-//     If success, the number of users and admins, and nil
-//     Otherwise, 0, 0 and an error
-func GetNumUsersAndAdmins(sess *session.Session) (int, int, error) {
-    // snippet-start:[iam.go.list_admins.call]
-    svc := iam.New(sess)
+// authorizationDetails holds everything GetAccountAuthorizationDetails returns, from every page
+type authorizationDetails struct {
+    users    []*iam.UserDetail
+    groups   map[string]*iam.GroupDetail
+    policies map[string]*iam.ManagedPolicyDetail
+}
 
-    numUsers := 0
-    numAdmins := 0
+func getAuthorizationDetails(svc iamiface.IAMAPI) (*authorizationDetails, error) {
+    // snippet-start:[iam.go.list_admins.call]
+    details := &authorizationDetails{
+        groups:   map[string]*iam.GroupDetail{},
+        policies: map[string]*iam.ManagedPolicyDetail{},
+    }
 
-    // Get list of users
-    user := "User"
-    input := &iam.GetAccountAuthorizationDetailsInput{Filter: []*string{&user}}
-    resp, err := svc.GetAccountAuthorizationDetails(input)
-    if err != nil {
-        return 0, 0, err
+    input := &iam.GetAccountAuthorizationDetailsInput{
+        Filter: aws.StringSlice([]string{
+            iam.EntityTypeUser,
+            iam.EntityTypeGroup,
+            iam.EntityTypeLocalManagedPolicy,
+            iam.EntityTypeAwsmanagedPolicy,
+        }),
     }
+    // snippet-end:[iam.go.list_admins.call]
+
+    // snippet-start:[iam.go.list_admins.truncated]
+    for {
+        resp, err := svc.GetAccountAuthorizationDetails(input)
+        if err != nil {
+            return nil, err
+        }
 
-    // The policy name that indicates administrator access
-    adminName := "AdministratorAccess"
+        details.users = append(details.users, resp.UserDetailList...)
 
-    // Wade through resulting users
-    for _, user := range resp.UserDetailList {
-        numUsers++
+        for _, g := range resp.GroupDetailList {
+            details.groups[*g.GroupName] = g
+        }
 
-        isAdmin, err := isUserAdmin(svc, user, adminName)
-        if err != nil {
-            return 0, 0, err
+        for _, p := range resp.Policies {
+            details.policies[*p.Arn] = p
         }
 
-        if isAdmin {
-            fmt.Println(*user.UserName)
-            numAdmins++
+        if !aws.BoolValue(resp.IsTruncated) {
+            return details, nil
         }
+
+        input.Marker = resp.Marker
     }
-    // snippet-end:[iam.go.list_admins.call]
+    // snippet-end:[iam.go.list_admins.truncated]
+}
 
-    // snippet-start:[iam.go.list_admins.truncated]
-    for *resp.IsTruncated {
-        input := &iam.GetAccountAuthorizationDetailsInput{Filter: []*string{&user}, Marker: resp.Marker}
-        resp, err = svc.GetAccountAuthorizationDetails(input)
+// inlinePolicies returns the inline policies of a user or group
+func inlinePolicies(kind, group string, inline []*iam.PolicyDetail) ([]userPolicy, error) {
+    var policies []userPolicy
+    for _, p := range inline {
+        statements, err := parsePolicy(*p.PolicyName, aws.StringValue(p.PolicyDocument))
         if err != nil {
-            return 0, 0, err
+            return nil, err
         }
 
-        // Wade through resulting users
-        for _, user := range resp.UserDetailList {
-            numUsers++
+        policies = append(policies, userPolicy{
+            source:     AdminGrant{Kind: kind, Group: group, Policy: *p.PolicyName},
+            statements: statements,
+        })
+    }
 
-            isAdmin, err := isUserAdmin(svc, user, adminName)
-            if err != nil {
-                return 0, 0, err
-            }
+    return policies, nil
+}
+
+// attachedPolicies returns the managed policies attached to a user or group
+func (d *authorizationDetails) attachedPolicies(kind, group string, attached []*iam.AttachedPolicy) ([]userPolicy, error) {
+    var policies []userPolicy
+    for _, a := range attached {
+        p := userPolicy{source: AdminGrant{Kind: kind, Group: group, Policy: *a.PolicyName, PolicyArn: *a.PolicyArn}}
+
+        if detail, ok := d.policies[*a.PolicyArn]; ok {
+            if document := defaultDocument(detail); document != nil {
+                statements, err := parsePolicy(*a.PolicyName, *document)
+                if err != nil {
+                    return nil, err
+                }
 
-            if isAdmin {
-                fmt.Println(*user.UserName)
-                numAdmins++
+                p.statements = statements
             }
         }
+
+        policies = append(policies, p)
     }
-    // snippet-end:[iam.go.list_admins.truncated]
 
-    return numUsers, numAdmins, nil
+    return policies, nil
+}
+
+// userPrivileges evaluates every policy of a user, whether it's the user's or comes through a group
+func (d *authorizationDetails) userPrivileges(user *iam.UserDetail) (UserPrivileges, error) {
+    u := UserPrivileges{UserName: *user.UserName, Arn: aws.StringValue(user.Arn)}
+
+    // snippet-start:[iam.go.list_admins.user_policy_has_admin]
+    policies, err := inlinePolicies(GrantInlineUserPolicy, "", user.UserPolicyList)
+    if err != nil {
+        return u, err
+    }
+    // snippet-end:[iam.go.list_admins.user_policy_has_admin]
+
+    // snippet-start:[iam.go.list_admins_attached_user_policy_has_admin]
+    attached, err := d.attachedPolicies(GrantAttachedUserPolicy, "", user.AttachedManagedPolicies)
+    if err != nil {
+        return u, err
+    }
+
+    policies = append(policies, attached...)
+    // snippet-end:[iam.go.list_admins_attached_user_policy_has_admin]
+
+    // snippet-start:[iam.go.list_admins_users_groups_have_admin]
+    for _, name := range aws.StringValueSlice(user.GroupList) {
+        group, ok := d.groups[name]
+        if !ok {
+            continue
+        }
+
+        // snippet-start:[iam.go.list_admins_group_policy_has_admin]
+        inline, err := inlinePolicies(GrantInlineGroupPolicy, name, group.GroupPolicyList)
+        if err != nil {
+            return u, err
+        }
+        // snippet-end:[iam.go.list_admins_group_policy_has_admin]
+
+        // snippet-start:[iam.go.list_admins_attached_group_policy_has_admin]
+        attached, err := d.attachedPolicies(GrantAttachedGroupPolicy, name, group.AttachedManagedPolicies)
+        if err != nil {
+            return u, err
+        }
+        // snippet-end:[iam.go.list_admins_attached_group_policy_has_admin]
+
+        policies = append(policies, inline...)
+        policies = append(policies, attached...)
+    }
+    // snippet-end:[iam.go.list_admins_users_groups_have_admin]
+
+    u.Grants, u.Denials = evaluate(policies)
+    u.Admin = len(u.Grants) > 0 && len(u.Denials) == 0
+
+    return u, nil
 }
 
-func isUserAdmin(svc *iam.IAM, user *iam.UserDetail, admin string) (bool, error) {
-    // Check policy, attached policy, and groups (policy and attached policy)
-    policyHasAdmin := userPolicyHasAdmin(user, admin)
-    if policyHasAdmin {
-        return true, nil
+// GetPrivilegeReport finds which users have administrator privileges, and through which policies.
+// Inputs:
+//     svc is an IAM service client
+// Output:
+//     If success, a PrivilegeReport listing every user, and nil
+//     Otherwise, nil and an error from the call to GetAccountAuthorizationDetails, or from parsing a policy
+func GetPrivilegeReport(svc iamiface.IAMAPI) (*PrivilegeReport, error) {
+    details, err := getAuthorizationDetails(svc)
+    if err != nil {
+        return nil, err
     }
 
-    attachedPolicyHasAdmin := attachedUserPolicyHasAdmin(user, admin)
-    if attachedPolicyHasAdmin {
-        return true, nil
+    report := &PrivilegeReport{}
+    for _, user := range details.users {
+        u, err := details.userPrivileges(user)
+        if err != nil {
+            return nil, err
+        }
+
+        report.Users = append(report.Users, u)
     }
 
-    userGroupsHaveAdmin, err := usersGroupsHaveAdmin(svc, user, admin)
+    return report, nil
+}
+
+// GetNumUsersAndAdmins determines how many users have administrator privileges.
+// Inputs:
+//     sess is the current session, which provides configuration for the SDK's service clients
+// Output:
+//     If success, the number of users and admins, and nil
+//     Otherwise, 0, 0 and an error
+func GetNumUsersAndAdmins(sess *session.Session) (int, int, error) {
+    report, err := GetPrivilegeReport(iam.New(sess))
     if err != nil {
-        return false, err
+        return 0, 0, err
     }
-    if userGroupsHaveAdmin {
-        return true, nil
+
+    for _, a := range report.Admins() {
+        fmt.Println(a.UserName)
     }
 
-    return false, nil
+    return len(report.Users), len(report.Admins()), nil
 }
 
 func main() {
+    format := flag.String("f", "", "Print the privilege report as a table, json, or csv")
+    flag.Parse()
 
     sess := session.Must(session.NewSessionWithOptions(session.Options{
         SharedConfigState: session.SharedConfigEnable,
     }))
 
-    numUsers, numAdmins, err := GetNumUsersAndAdmins(sess)
+    if *format == "" {
+        numUsers, numAdmins, err := GetNumUsersAndAdmins(sess)
+        if err != nil {
+            fmt.Println("Got an error finding users who are admins:")
+            fmt.Println(err)
+            return
+        }
+
+        fmt.Println("")
+        fmt.Println("Found", numAdmins, "admin(s) out of", numUsers, "user(s)")
+        return
+    }
+
+    report, err := GetPrivilegeReport(iam.New(sess))
     if err != nil {
         fmt.Println("Got an error finding users who are admins:")
         fmt.Println(err)
         return
     }
 
-    fmt.Println("")
-    fmt.Println("Found", numAdmins, "admin(s) out of", numUsers, "user(s)")
+    switch *format {
+    case "table":
+        err = report.WriteTable(os.Stdout)
+    case "json":
+        err = report.WriteJSON(os.Stdout)
+    case "csv":
+        err = report.WriteCSV(os.Stdout)
+    default:
+        fmt.Println("The format must be table, json, or csv")
+        return
+    }
+
+    if err != nil {
+        fmt.Println("Got an error writing the report:")
+        fmt.Println(err)
+    }
 }
 // snippet-end:[iam.go.list_admins]
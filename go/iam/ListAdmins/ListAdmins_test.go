@@ -3,11 +3,18 @@
 package main
 
 import (
+    "bytes"
+    "encoding/csv"
+    "net/url"
     "strconv"
+    "strings"
     "testing"
     "time"
 
+    "github.com/aws/aws-sdk-go/aws"
     "github.com/aws/aws-sdk-go/aws/session"
+    "github.com/aws/aws-sdk-go/service/iam"
+    "github.com/aws/aws-sdk-go/service/iam/iamiface"
 )
 
 func TestListUsers(t *testing.T) {
@@ -26,3 +33,180 @@ func TestListUsers(t *testing.T) {
 
     t.Log("Got " + strconv.Itoa(admins) + " admin(s) out of " + strconv.Itoa(users) + " user(s)")
 }
+
+// Define a mock struct to use in unit tests.
+// It returns its pages one at a time, using the page number as the marker.
+type mockIAMClient struct {
+    iamiface.IAMAPI
+    pages []*iam.GetAccountAuthorizationDetailsOutput
+}
+
+func (m *mockIAMClient) GetAccountAuthorizationDetails(input *iam.GetAccountAuthorizationDetailsInput) (*iam.GetAccountAuthorizationDetailsOutput, error) {
+    page := 0
+    if input.Marker != nil {
+        page, _ = strconv.Atoi(*input.Marker)
+    }
+
+    output := *m.pages[page]
+    output.IsTruncated = aws.Bool(page+1 < len(m.pages))
+    if *output.IsTruncated {
+        output.Marker = aws.String(strconv.Itoa(page + 1))
+    }
+
+    return &output, nil
+}
+
+const allowAll = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`
+
+func policyArn(name string) *string {
+    return aws.String("arn:aws:iam::123456789012:policy/" + name)
+}
+
+func inlinePolicy(name, document string) *iam.PolicyDetail {
+    return &iam.PolicyDetail{PolicyName: aws.String(name), PolicyDocument: aws.String(url.PathEscape(document))}
+}
+
+func attachedPolicy(name string) *iam.AttachedPolicy {
+    return &iam.AttachedPolicy{PolicyName: aws.String(name), PolicyArn: policyArn(name)}
+}
+
+func userDetail(name string, groups ...string) *iam.UserDetail {
+    return &iam.UserDetail{UserName: aws.String(name), GroupList: aws.StringSlice(groups)}
+}
+
+func newMockClient() *mockIAMClient {
+    inline := userDetail("inline-admin")
+    inline.UserPolicyList = []*iam.PolicyDetail{inlinePolicy("Everything", allowAll)}
+
+    attached := userDetail("attached-admin")
+    attached.AttachedManagedPolicies = []*iam.AttachedPolicy{attachedPolicy("AllResources")}
+
+    denied := userDetail("denied-user")
+    denied.UserPolicyList = []*iam.PolicyDetail{inlinePolicy("AllowThenDeny",
+        `{"Statement":[{"Effect":"Allow","Action":["*"],"Resource":["*"]},{"Effect":"Deny","Action":"*:*","Resource":"*"}]}`)}
+
+    // A Deny in one policy overrides an Allow in another, whether it comes through a group or not
+    const denyAll = `{"Statement":{"Sid":"NoAccess","Effect":"Deny","Action":"*","Resource":"*"}}`
+
+    groupDenied := userDetail("group-denied", "Admins", "Suspended")
+
+    userDenied := userDetail("user-denied")
+    userDenied.AttachedManagedPolicies = []*iam.AttachedPolicy{attachedPolicy("AdministratorAccess")}
+    userDenied.UserPolicyList = []*iam.PolicyDetail{inlinePolicy("Suspend", denyAll)}
+
+    return &mockIAMClient{pages: []*iam.GetAccountAuthorizationDetailsOutput{
+        {
+            UserDetailList: []*iam.UserDetail{inline, attached, userDetail("group-admin", "Admins")},
+            Policies: []*iam.ManagedPolicyDetail{{
+                Arn: policyArn("AllResources"),
+                PolicyVersionList: []*iam.PolicyVersion{
+                    {Document: aws.String(`{"Statement":{"Effect":"Allow","Action":"s3:*","Resource":"*"}}`), IsDefaultVersion: aws.Bool(false)},
+                    {Document: aws.String(url.PathEscape(allowAll)), IsDefaultVersion: aws.Bool(true)},
+                },
+            }},
+        },
+        {
+            UserDetailList: []*iam.UserDetail{denied, userDetail("plain-user", "Readers"), groupDenied, userDenied},
+            GroupDetailList: []*iam.GroupDetail{
+                {GroupName: aws.String("Suspended"), GroupPolicyList: []*iam.PolicyDetail{inlinePolicy("Suspend", denyAll)}},
+                {GroupName: aws.String("Admins"), AttachedManagedPolicies: []*iam.AttachedPolicy{attachedPolicy("AdministratorAccess")}},
+                {GroupName: aws.String("Readers"), GroupPolicyList: []*iam.PolicyDetail{inlinePolicy("Read", `{"Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`)}},
+            },
+        },
+    }}
+}
+
+func TestPrivilegeReportMock(t *testing.T) {
+    report, err := GetPrivilegeReport(newMockClient())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    want := map[string]string{
+        "inline-admin":   GrantInlineUserPolicy,
+        "attached-admin": GrantAttachedUserPolicy,
+        "group-admin":    GrantAttachedGroupPolicy,
+        "denied-user":    "",
+        "plain-user":     "",
+        "group-denied":   "",
+        "user-denied":    "",
+    }
+
+    if len(report.Users) != len(want) || len(report.Admins()) != 3 {
+        t.Fatalf("got %d users and %d admins, want 7 and 3", len(report.Users), len(report.Admins()))
+    }
+
+    for _, u := range report.Users {
+        kind := want[u.UserName]
+        if u.Admin != (kind != "") || (kind != "" && (len(u.Grants) != 1 || u.Grants[0].Kind != kind)) {
+            t.Errorf("%s: got admin %t with grants %+v, want %q", u.UserName, u.Admin, u.Grants, kind)
+        }
+
+        if strings.HasSuffix(u.UserName, "-denied") && (len(u.Grants) != 1 || len(u.Denials) != 1 || u.Denials[0].Policy != "Suspend") {
+            t.Errorf("%s: got grants %+v and denials %+v, want one of each", u.UserName, u.Grants, u.Denials)
+        }
+    }
+
+    var b bytes.Buffer
+
+    err = report.WriteCSV(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    rows, err := csv.NewReader(&b).ReadAll()
+    if err != nil || len(rows) != 11 {
+        t.Errorf("got %d CSV rows, want 11: %v", len(rows), err)
+    }
+
+    b.Reset()
+
+    err = report.WriteTable(&b)
+    if err != nil || !strings.Contains(b.String(), GrantInlineUserPolicy) {
+        t.Errorf("got table:\n%s", b.String())
+    }
+
+    _, err = parsePolicy("Broken", "{")
+    if err == nil {
+        t.Error("got no error for a broken policy")
+    }
+}
+
+func TestEvaluate(t *testing.T) {
+    tests := []struct {
+        documents []string
+        admin     bool
+    }{
+        {[]string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*"}}`}, true},
+        {[]string{`{"Statement":[{"Effect":"Allow","Action":["s3:*","*:*"],"Resource":["arn:aws:s3:::a","*"]}]}`}, true},
+        {[]string{`{"Statement":[{"Effect":"Allow","Action":"iam:*","Resource":"*"}]}`}, false},
+        {[]string{`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"arn:aws:s3:::a"}]}`}, false},
+        {[]string{`{"Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`}, false},
+        {[]string{`{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*"}]}`}, false},
+        // A Deny in another policy overrides the Allow
+        {[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"*:*","Resource":"*"}]}`}, false},
+        {[]string{allowAll, `{"Statement":[{"Effect":"Deny","NotAction":"iam:GetUser","Resource":"*"}]}`}, false},
+        {[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"*","NotResource":"arn:aws:s3:::a"}]}`}, false},
+        // A Deny of some actions doesn't, and neither does one with conditions
+        {[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"iam:*","Resource":"*"}]}`}, true},
+        {[]string{allowAll, `{"Statement":[{"Effect":"Deny","NotAction":"*","Resource":"*"}]}`}, true},
+        {[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}]}`}, true},
+    }
+
+    for _, test := range tests {
+        var policies []userPolicy
+        for i, document := range test.documents {
+            statements, err := parsePolicy("Test", document)
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            policies = append(policies, userPolicy{source: AdminGrant{Policy: strconv.Itoa(i)}, statements: statements})
+        }
+
+        grants, denials := evaluate(policies)
+        if admin := len(grants) > 0 && len(denials) == 0; admin != test.admin {
+            t.Errorf("%v: got admin %t with grants %+v and denials %+v, want %t", test.documents, admin, grants, denials, test.admin)
+        }
+    }
+}
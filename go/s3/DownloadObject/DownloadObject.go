@@ -17,25 +17,124 @@ package main
 
 // snippet-start:[s3.go.download_object.imports]
 import (
+    "context"
+    "crypto/md5"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
     "flag"
     "fmt"
+    "io"
+    "io/ioutil"
     "os"
+    "strconv"
+    "strings"
+    "sync"
 
+    "github.com/aws/aws-sdk-go/aws"
     "github.com/aws/aws-sdk-go/aws/session"
     "github.com/aws/aws-sdk-go/service/s3"
+    "github.com/aws/aws-sdk-go/service/s3/s3iface"
     "github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 // snippet-end:[s3.go.download_object.imports]
 
+// DownloadOptions configures a parallel, resumable download
+type DownloadOptions struct {
+    // PartSize is the number of bytes to get in each ranged request.
+    // It must stay the same for an interrupted download to resume.
+    PartSize int64
+    // Concurrency is the number of parts to download at the same time
+    Concurrency int
+    // MD5 is the expected hex-encoded MD5 digest of the object.
+    // If it's empty, the download is checked against the ETag,
+    // or the digest stored in the object's md5 metadata, if it has one.
+    // Objects encrypted with SSE-KMS or SSE-C are only checked against MD5 or the metadata.
+    MD5 string
+    // Client is the Amazon S3 service client to use.
+    // If it's nil, a client is created from the session.
+    Client s3iface.S3API
+}
+
+// Defaults for DownloadOptions
+const (
+    defaultPartSize    = 8 * 1024 * 1024
+    defaultConcurrency = 5
+)
+
+// checkpoint records which parts of a download are in the temporary file.
+// It's stored next to the temporary file, so that an interrupted download can resume.
+type checkpoint struct {
+    ETag     string `json:"etag"`
+    Size     int64  `json:"size"`
+    PartSize int64  `json:"partSize"`
+    Done     []bool `json:"done"`
+}
+
+// save writes the checkpoint to a temporary file and renames it, so a crash never leaves half a checkpoint
+func (c *checkpoint) save(name string) error {
+    data, err := json.Marshal(c)
+    if err != nil {
+        return err
+    }
+
+    err = ioutil.WriteFile(name+".tmp", data, 0644)
+    if err != nil {
+        return err
+    }
+
+    return os.Rename(name+".tmp", name)
+}
+
+// loadCheckpoint reads a checkpoint, returning nil if there's none that matches the object and part size
+func loadCheckpoint(name, partFile, etag string, size, partSize int64) *checkpoint {
+    data, err := ioutil.ReadFile(name)
+    if err != nil {
+        return nil
+    }
+
+    var c checkpoint
+    err = json.Unmarshal(data, &c)
+    if err != nil || c.ETag != etag || c.Size != size || c.PartSize != partSize {
+        return nil
+    }
+
+    // The parts it lists are only there if the temporary file is too
+    info, err := os.Stat(partFile)
+    if err != nil || info.Size() != size {
+        return nil
+    }
+
+    return &c
+}
+
 // DownloadObject downloads a file from a bucket
 // Inputs:
 //     sess is the current session, which provides configuration for the SDK's service clients
 //     filename is the name of the file
 //     bucket is the name of the bucket
+//     opts, if any, set DownloadOptions and download the file in parallel parts, with resume, using DownloadParts
 // Output:
 //     If success, nil
 //     Otherwise, an error from the call to Create or Download
-func DownloadObject(sess *session.Session, filename *string, bucket *string) error {
+func DownloadObject(sess *session.Session, filename *string, bucket *string, opts ...func(*DownloadOptions)) error {
+    if len(opts) > 0 {
+        o := DownloadOptions{
+            PartSize:    defaultPartSize,
+            Concurrency: defaultConcurrency,
+        }
+
+        for _, opt := range opts {
+            opt(&o)
+        }
+
+        if o.Client == nil {
+            o.Client = s3.New(sess)
+        }
+
+        return DownloadParts(aws.BackgroundContext(), filename, bucket, o)
+    }
+
     // snippet-start:[s3.go.download_object.create]
     file, err := os.Create(*filename)
     // snippet-end:[s3.go.download_object.create]
@@ -61,10 +160,339 @@ func DownloadObject(sess *session.Session, filename *string, bucket *string) err
     return nil
 }
 
+// DownloadParts downloads an object to a file in parallel ranged requests.
+// The parts are written to FILENAME.part, and the finished parts are recorded in FILENAME.part.json.
+// If the download is interrupted, calling DownloadParts again gets only the missing parts,
+// as long as the object and part size haven't changed.
+// When every part is there, the file is checked against its expected MD5 digest and renamed to FILENAME.
+// If it doesn't match, FILENAME.part and FILENAME.part.json are removed, so that calling DownloadParts again starts over.
+// Inputs:
+//     filename is the name of the file, and the key of the object
+//     bucket is the name of the bucket
+//     opts sets the part size, the concurrency, the expected digest, and the client
+// Output:
+//     If success, nil
+//     Otherwise, an error from the call to HeadObject or GetObject, from writing the file,
+//     or because the file doesn't match the expected digest
+func DownloadParts(ctx context.Context, filename *string, bucket *string, opts DownloadOptions) error {
+    if opts.PartSize <= 0 {
+        opts.PartSize = defaultPartSize
+    }
+
+    if opts.Concurrency <= 0 {
+        opts.Concurrency = defaultConcurrency
+    }
+
+    head, err := opts.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+        Bucket: bucket,
+        Key:    filename,
+    })
+    if err != nil {
+        return err
+    }
+
+    etag := aws.StringValue(head.ETag)
+    size := aws.Int64Value(head.ContentLength)
+    partFile := *filename + ".part"
+    checkpointFile := partFile + ".json"
+
+    cp := loadCheckpoint(checkpointFile, partFile, etag, size, opts.PartSize)
+    if cp == nil {
+        cp = &checkpoint{
+            ETag:     etag,
+            Size:     size,
+            PartSize: opts.PartSize,
+            Done:     make([]bool, (size+opts.PartSize-1)/opts.PartSize),
+        }
+    }
+
+    file, err := os.OpenFile(partFile, os.O_RDWR|os.O_CREATE, 0644)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    err = file.Truncate(size)
+    if err != nil {
+        return err
+    }
+
+    err = cp.save(checkpointFile)
+    if err != nil {
+        return err
+    }
+
+    err = downloadParts(ctx, file, bucket, filename, cp, checkpointFile, opts)
+    if err != nil {
+        return err
+    }
+
+    err = verifyDownload(ctx, file, bucket, filename, head, opts)
+    if errors.Is(err, errCorrupt) {
+        // The checkpoint lists every part as done, so start over on the next call
+        // instead of checking the same file again
+        file.Close()
+        os.Remove(checkpointFile)
+        os.Remove(partFile)
+
+        return err
+    }
+
+    if err != nil {
+        return err
+    }
+
+    err = file.Close()
+    if err != nil {
+        return err
+    }
+
+    err = os.Rename(partFile, *filename)
+    if err != nil {
+        return err
+    }
+
+    return os.Remove(checkpointFile)
+}
+
+// downloadParts gets the parts that the checkpoint doesn't list as done,
+// saving the checkpoint after each one is safely in the file
+func downloadParts(ctx context.Context, file *os.File, bucket, key *string, cp *checkpoint, checkpointFile string, opts DownloadOptions) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    parts := make(chan int)
+    var (
+        mu       sync.Mutex
+        firstErr error
+        wg       sync.WaitGroup
+    )
+
+    fail := func(err error) {
+        mu.Lock()
+        defer mu.Unlock()
+
+        if firstErr == nil {
+            firstErr = err
+            cancel()
+        }
+    }
+
+    for i := 0; i < opts.Concurrency; i++ {
+        wg.Add(1)
+
+        go func() {
+            defer wg.Done()
+
+            for part := range parts {
+                // After a failure, drain the remaining parts without getting them
+                if ctx.Err() != nil {
+                    continue
+                }
+
+                err := downloadPart(ctx, file, bucket, key, cp, part, opts.Client)
+                if err != nil {
+                    fail(err)
+                    continue
+                }
+
+                // The checkpoint must never list a part that a crash could lose
+                err = file.Sync()
+                if err != nil {
+                    fail(err)
+                    continue
+                }
+
+                mu.Lock()
+                cp.Done[part] = true
+                err = cp.save(checkpointFile)
+                mu.Unlock()
+
+                if err != nil {
+                    fail(err)
+                }
+            }
+        }()
+    }
+
+    for part, done := range cp.Done {
+        if done {
+            continue
+        }
+
+        select {
+        case parts <- part:
+        case <-ctx.Done():
+        }
+    }
+
+    close(parts)
+    wg.Wait()
+
+    if firstErr != nil {
+        return firstErr
+    }
+
+    return ctx.Err()
+}
+
+// downloadPart gets one part and writes it at its offset in the file.
+// The request is conditional on the ETag, so a part of a newer object is never mixed in.
+func downloadPart(ctx context.Context, file *os.File, bucket, key *string, cp *checkpoint, part int, svc s3iface.S3API) error {
+    start := int64(part) * cp.PartSize
+    end := start + cp.PartSize - 1
+    if end >= cp.Size {
+        end = cp.Size - 1
+    }
+
+    output, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+        Bucket:  bucket,
+        Key:     key,
+        Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+        IfMatch: aws.String(cp.ETag),
+    })
+    if err != nil {
+        return err
+    }
+    defer output.Body.Close()
+
+    n, err := io.Copy(&offsetWriter{file: file, offset: start}, output.Body)
+    if err != nil {
+        return err
+    }
+
+    if n != end-start+1 {
+        return fmt.Errorf("part %d: got %d bytes, want %d", part+1, n, end-start+1)
+    }
+
+    return nil
+}
+
+// offsetWriter writes to a file sequentially from an offset.
+// Unlike Seek and Write, WriteAt lets several parts be written at once.
+type offsetWriter struct {
+    file   *os.File
+    offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+    n, err := w.file.WriteAt(p, w.offset)
+    w.offset += int64(n)
+
+    return n, err
+}
+
+// verifyDownload checks the file against opts.MD5, the object's md5 metadata, or its ETag.
+// The ETag of an object uploaded in N parts is the MD5 digest of the parts' digests, followed by -N;
+// the size of the uploaded parts comes from a HeadObject call for the first part.
+// The ETag of an object encrypted with SSE-KMS or SSE-C isn't an MD5 digest, so it isn't checked.
+func verifyDownload(ctx context.Context, file *os.File, bucket, key *string, head *s3.HeadObjectOutput, opts DownloadOptions) error {
+    want := opts.MD5
+    if want == "" {
+        for k, v := range head.Metadata {
+            if strings.EqualFold(k, "md5") {
+                want = aws.StringValue(v)
+            }
+        }
+    }
+
+    if want != "" {
+        got, err := md5Range(file, 0, aws.Int64Value(head.ContentLength))
+        if err != nil {
+            return err
+        }
+
+        if hex.EncodeToString(got) != want {
+            return fmt.Errorf("%w: the MD5 digest of the download is %x, want %s", errCorrupt, got, want)
+        }
+
+        return nil
+    }
+
+    if aws.StringValue(head.ServerSideEncryption) == s3.ServerSideEncryptionAwsKms || head.SSECustomerAlgorithm != nil {
+        return nil
+    }
+
+    etag := strings.Trim(aws.StringValue(head.ETag), "\"")
+    dash := strings.Index(etag, "-")
+    if dash < 0 {
+        got, err := md5Range(file, 0, aws.Int64Value(head.ContentLength))
+        if err != nil {
+            return err
+        }
+
+        if hex.EncodeToString(got) != etag {
+            return fmt.Errorf("%w: the MD5 digest of the download is %x, but the ETag is %s", errCorrupt, got, etag)
+        }
+
+        return nil
+    }
+
+    parts, err := strconv.Atoi(etag[dash+1:])
+    if err != nil {
+        return fmt.Errorf("can't verify the download against the ETag %s", etag)
+    }
+
+    first, err := opts.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+        Bucket:     bucket,
+        Key:        key,
+        PartNumber: aws.Int64(1),
+        IfMatch:    head.ETag,
+    })
+    if err != nil {
+        return err
+    }
+
+    partSize := aws.Int64Value(first.ContentLength)
+    if partSize <= 0 {
+        return errors.New("can't get the size of the uploaded parts to verify the download")
+    }
+
+    digests := md5.New()
+    size := aws.Int64Value(head.ContentLength)
+    for offset := int64(0); offset < size; offset += partSize {
+        n := partSize
+        if offset+n > size {
+            n = size - offset
+        }
+
+        sum, err := md5Range(file, offset, n)
+        if err != nil {
+            return err
+        }
+
+        digests.Write(sum)
+    }
+
+    got := fmt.Sprintf("%x-%d", digests.Sum(nil), parts)
+    if got != etag {
+        return fmt.Errorf("%w: the download has the multipart ETag %s, want %s", errCorrupt, got, etag)
+    }
+
+    return nil
+}
+
+// errCorrupt is the error that verifyDownload wraps when the download doesn't match the object
+var errCorrupt = errors.New("corrupt download")
+
+// md5Range returns the MD5 digest of n bytes of a file, starting at offset
+func md5Range(file *os.File, offset, n int64) ([]byte, error) {
+    h := md5.New()
+    _, err := io.Copy(h, io.NewSectionReader(file, offset, n))
+    if err != nil {
+        return nil, err
+    }
+
+    return h.Sum(nil), nil
+}
+
 func main() {
     // snippet-start:[s3.go.download_object.args]
     bucket := flag.String("b", "", "The bucket to download from")
     filename := flag.String("f", "", "The name of the file to download")
+    parallel := flag.Bool("p", false, "Download in parallel parts, resuming an interrupted download")
+    partSize := flag.Int64("s", defaultPartSize, "With -p, the size of each part in bytes")
+    concurrency := flag.Int("c", defaultConcurrency, "With -p, how many parts to download at the same time")
     flag.Parse()
 
     if *bucket == "" || *filename == "" {
@@ -79,7 +507,15 @@ func main() {
     }))
     // snippet-end:[s3.go.download_object.session]
 
-    err := DownloadObject(sess, filename, bucket)
+    var opts []func(*DownloadOptions)
+    if *parallel {
+        opts = append(opts, func(o *DownloadOptions) {
+            o.PartSize = *partSize
+            o.Concurrency = *concurrency
+        })
+    }
+
+    err := DownloadObject(sess, filename, bucket, opts...)
     if err != nil {
         fmt.Println("Got error downloading " + *filename + ":")
         fmt.Println(err)
@@ -14,16 +14,24 @@
 package main
 
 import (
+    "bytes"
+    "context"
+    "crypto/md5"
     "encoding/json"
+    "errors"
     "fmt"
     "io/ioutil"
     "os"
+    "path/filepath"
+    "sync"
     "testing"
     "time"
 
     "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/aws/request"
     "github.com/aws/aws-sdk-go/aws/session"
     "github.com/aws/aws-sdk-go/service/s3"
+    "github.com/aws/aws-sdk-go/service/s3/s3iface"
     "github.com/aws/aws-sdk-go/service/s3/s3manager"
 
     "github.com/google/uuid"
@@ -188,3 +196,249 @@ func TestDownloadObject(t *testing.T) {
         t.Log("Deleted bucket " + globalConfig.Bucket)
     }
 }
+
+// mockS3Client serves one object that was uploaded in parts of uploadPartSize bytes
+type mockS3Client struct {
+    s3iface.S3API
+
+    body           []byte
+    uploadPartSize int64
+    // sse is the server-side encryption of the object, if any
+    sse string
+
+    mu sync.Mutex
+    // The number of GetObject calls, the call that fails, if not 0,
+    // and the call that returns a corrupted part, if not 0
+    gets      int
+    failAt    int
+    corruptAt int
+}
+
+// etag returns the multipart ETag of the object,
+// or, for an object encrypted with SSE-KMS, an ETag that isn't an MD5 digest
+func (m *mockS3Client) etag() string {
+    if m.sse == s3.ServerSideEncryptionAwsKms {
+        return `"0123456789abcdef0123456789abcdef"`
+    }
+
+    digests := md5.New()
+    parts := 0
+    for offset := int64(0); offset < int64(len(m.body)); offset += m.uploadPartSize {
+        end := offset + m.uploadPartSize
+        if end > int64(len(m.body)) {
+            end = int64(len(m.body))
+        }
+
+        sum := md5.Sum(m.body[offset:end])
+        digests.Write(sum[:])
+        parts++
+    }
+
+    return fmt.Sprintf(`"%x-%d"`, digests.Sum(nil), parts)
+}
+
+func (m *mockS3Client) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+    size := int64(len(m.body))
+    if aws.Int64Value(input.PartNumber) == 1 && size > m.uploadPartSize {
+        size = m.uploadPartSize
+    }
+
+    output := &s3.HeadObjectOutput{
+        ContentLength: aws.Int64(size),
+        ETag:          aws.String(m.etag()),
+    }
+    if m.sse != "" {
+        output.ServerSideEncryption = aws.String(m.sse)
+    }
+
+    return output, nil
+}
+
+func (m *mockS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+    m.mu.Lock()
+    m.gets++
+    fail := m.gets == m.failAt
+    corrupt := m.gets == m.corruptAt
+    m.mu.Unlock()
+
+    if fail {
+        return nil, errors.New("connection reset")
+    }
+
+    if aws.StringValue(input.IfMatch) != m.etag() {
+        return nil, errors.New("PreconditionFailed")
+    }
+
+    var start, end int64
+    _, err := fmt.Sscanf(aws.StringValue(input.Range), "bytes=%d-%d", &start, &end)
+    if err != nil {
+        return nil, err
+    }
+
+    part := append([]byte(nil), m.body[start:end+1]...)
+    if corrupt {
+        part[0]++
+    }
+
+    return &s3.GetObjectOutput{
+        Body: ioutil.NopCloser(bytes.NewReader(part)),
+    }, nil
+}
+
+func TestDownloadPartsMock(t *testing.T) {
+    dir, err := ioutil.TempDir("", "DownloadObject")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    body := make([]byte, 100)
+    for i := range body {
+        body[i] = byte(i)
+    }
+
+    svc := &mockS3Client{body: body, uploadPartSize: 30, failAt: 4}
+    filename := filepath.Join(dir, "dummy.bin")
+    bucket := "doc-example-bucket"
+    opts := DownloadOptions{PartSize: 16, Concurrency: 1, Client: svc}
+
+    // The fourth of seven parts fails
+    err = DownloadParts(context.Background(), &filename, &bucket, opts)
+    if err == nil {
+        t.Fatal("got no error from an interrupted download")
+    }
+
+    if _, err := os.Stat(filename + ".part.json"); err != nil {
+        t.Fatal("no checkpoint after an interrupted download")
+    }
+
+    // Resuming gets only the four remaining parts
+    svc.gets = 0
+    svc.failAt = 0
+    opts.Concurrency = 3
+    err = DownloadParts(context.Background(), &filename, &bucket, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if svc.gets != 4 {
+        t.Errorf("got %d GetObject calls when resuming, want 4", svc.gets)
+    }
+
+    got, err := ioutil.ReadFile(filename)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !bytes.Equal(got, body) {
+        t.Error("the downloaded file doesn't match the object")
+    }
+
+    if _, err := os.Stat(filename + ".part.json"); !os.IsNotExist(err) {
+        t.Error("the checkpoint is still there after the download")
+    }
+
+    // A download whose digest doesn't match isn't renamed
+    os.Remove(filename)
+    opts.MD5 = "00000000000000000000000000000000"
+    err = DownloadParts(context.Background(), &filename, &bucket, opts)
+    if err == nil {
+        t.Error("got no error for a mismatched digest")
+    }
+
+    if _, err := os.Stat(filename); !os.IsNotExist(err) {
+        t.Error("a download that failed verification was renamed")
+    }
+}
+
+func TestDownloadPartsCorrupt(t *testing.T) {
+    dir, err := ioutil.TempDir("", "DownloadObject")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    body := make([]byte, 100)
+    for i := range body {
+        body[i] = byte(i)
+    }
+
+    svc := &mockS3Client{body: body, uploadPartSize: 30, corruptAt: 2}
+    filename := filepath.Join(dir, "dummy.bin")
+    bucket := "doc-example-bucket"
+    opts := DownloadOptions{PartSize: 16, Concurrency: 1, Client: svc}
+
+    // The second part arrives corrupted, so the download fails verification
+    err = DownloadParts(context.Background(), &filename, &bucket, opts)
+    if err == nil {
+        t.Fatal("got no error for a corrupted part")
+    }
+
+    for _, name := range []string{filename + ".part", filename + ".part.json"} {
+        if _, err := os.Stat(name); !os.IsNotExist(err) {
+            t.Errorf("%s is still there after a download that failed verification", name)
+        }
+    }
+
+    // The retry gets every part again
+    svc.gets = 0
+    svc.corruptAt = 0
+    err = DownloadParts(context.Background(), &filename, &bucket, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if svc.gets != 7 {
+        t.Errorf("got %d GetObject calls when retrying, want 7", svc.gets)
+    }
+
+    got, err := ioutil.ReadFile(filename)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !bytes.Equal(got, body) {
+        t.Error("the downloaded file doesn't match the object")
+    }
+}
+
+func TestDownloadPartsEncrypted(t *testing.T) {
+    dir, err := ioutil.TempDir("", "DownloadObject")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    body := make([]byte, 100)
+    for i := range body {
+        body[i] = byte(i)
+    }
+
+    svc := &mockS3Client{body: body, uploadPartSize: 30, sse: s3.ServerSideEncryptionAwsKms}
+    filename := filepath.Join(dir, "dummy.bin")
+    bucket := "doc-example-bucket"
+    opts := DownloadOptions{PartSize: 16, Concurrency: 1, Client: svc}
+
+    // The ETag of an SSE-KMS object isn't its MD5 digest, so the download isn't checked against it
+    err = DownloadParts(context.Background(), &filename, &bucket, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := ioutil.ReadFile(filename)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !bytes.Equal(got, body) {
+        t.Error("the downloaded file doesn't match the object")
+    }
+
+    // A digest from the caller is still checked
+    os.Remove(filename)
+    opts.MD5 = "00000000000000000000000000000000"
+    err = DownloadParts(context.Background(), &filename, &bucket, opts)
+    if err == nil {
+        t.Error("got no error for a mismatched digest")
+    }
+}
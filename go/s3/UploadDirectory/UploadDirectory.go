@@ -17,14 +17,23 @@ package main
 
 // snippet-start:[s3.go.upload_directory.imports]
 import (
+    "crypto/md5"
+    "encoding/hex"
     "flag"
     "fmt"
+    "io"
     "os"
+    "path"
     "path/filepath"
+    "sort"
+    "strings"
 
     "github.com/aws/aws-sdk-go/aws"
     "github.com/aws/aws-sdk-go/aws/session"
+    "github.com/aws/aws-sdk-go/service/s3"
+    "github.com/aws/aws-sdk-go/service/s3/s3iface"
     "github.com/aws/aws-sdk-go/service/s3/s3manager"
+    "github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 )
 // snippet-end:[s3.go.upload_directory.imports]
 
@@ -113,10 +122,329 @@ func (di *DirectoryIterator) UploadObject() s3manager.BatchUploadObject {
     }
 }
 
+// SyncOptions configures SyncDirectory
+type SyncOptions struct {
+    // Prefix is prepended to the path of each file, relative to the directory, to make its key.
+    // A slash is added between them if Prefix doesn't end with one.
+    Prefix string
+    // If Include isn't empty, only files that match one of these patterns are synced
+    Include []string
+    // Files that match one of these patterns are never synced
+    Exclude []string
+    // Delete is whether to delete the objects under Prefix that have no local file.
+    // Objects excluded by Include or Exclude are left alone.
+    Delete bool
+}
+
+// SyncResult lists the keys that SyncDirectory uploaded, skipped because they were unchanged, and deleted
+type SyncResult struct {
+    Uploaded []string
+    Skipped  []string
+    Deleted  []string
+}
+
+// md5MetadataKey is the user-defined metadata that SyncDirectory stores with each object,
+// so that it can tell whether a file has changed when the ETag isn't its MD5 digest
+const md5MetadataKey = "md5"
+
+// localFile is a file that SyncDirectory might upload
+type localFile struct {
+    path string
+    size int64
+}
+
+// matchesAny returns whether a slash-separated relative path, or its base name, matches any of the patterns
+func matchesAny(rel string, patterns []string) bool {
+    for _, p := range patterns {
+        if ok, _ := path.Match(p, rel); ok {
+            return true
+        }
+
+        if ok, _ := path.Match(p, path.Base(rel)); ok {
+            return true
+        }
+    }
+
+    return false
+}
+
+// selected returns whether SyncDirectory syncs a relative path under the options
+func (o *SyncOptions) selected(rel string) bool {
+    if len(o.Include) > 0 && !matchesAny(rel, o.Include) {
+        return false
+    }
+
+    return !matchesAny(rel, o.Exclude)
+}
+
+// keyPrefix returns the prefix of every key SyncDirectory syncs
+func (o *SyncOptions) keyPrefix() string {
+    if o.Prefix == "" || strings.HasSuffix(o.Prefix, "/") {
+        return o.Prefix
+    }
+
+    return o.Prefix + "/"
+}
+
+// fileMD5 returns the hex-encoded MD5 digest of a file
+func fileMD5(name string) (string, error) {
+    f, err := os.Open(name)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+
+    h := md5.New()
+    _, err = io.Copy(h, f)
+    if err != nil {
+        return "", err
+    }
+
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// metadataValue looks up user-defined metadata,
+// whose keys the SDK returns in canonical header form, such as Md5
+func metadataValue(metadata map[string]*string, key string) string {
+    for k, v := range metadata {
+        if strings.EqualFold(k, key) {
+            return aws.StringValue(v)
+        }
+    }
+
+    return ""
+}
+
+// unchanged returns whether an object already holds a local file.
+// A size mismatch means the file changed.
+// Otherwise the file's digest is compared with the digest stored in the object's metadata.
+// Objects without a stored digest, such as ones uploaded by other tools, fall back to a single-part ETag,
+// which is the MD5 digest of the object unless it's encrypted with SSE-KMS or SSE-C.
+// It never writes to the bucket, so an unchanged object keeps its ACL, versions, and storage class.
+func unchanged(svc s3iface.S3API, bucket string, object *s3.Object, file localFile, digest func() (string, error)) (bool, error) {
+    if aws.Int64Value(object.Size) != file.size {
+        return false, nil
+    }
+
+    head, err := svc.HeadObject(&s3.HeadObjectInput{
+        Bucket: aws.String(bucket),
+        Key:    object.Key,
+    })
+    if err != nil {
+        return false, err
+    }
+
+    remote := metadataValue(head.Metadata, md5MetadataKey)
+    if etag := strings.Trim(aws.StringValue(object.ETag), "\""); remote == "" && !strings.Contains(etag, "-") {
+        remote = etag
+    }
+
+    if remote == "" {
+        return false, nil
+    }
+
+    sum, err := digest()
+    if err != nil {
+        return false, err
+    }
+
+    return sum == remote, nil
+}
+
+// SyncDirectory uploads only the files in a directory that are new or have changed since the last sync
+// Inputs:
+//     svc is the Amazon S3 service client used to list, check, and delete objects
+//     uploader uploads the files
+//     bucket is the name of the bucket
+//     dir is the path to the directory to sync
+//     opts says how to name the objects, which files to sync, and whether to delete objects with no local file
+// Output:
+//     If success, the keys uploaded, skipped, and deleted, and nil
+//     Otherwise, nil and an error from reading a file or from the call to ListObjectsV2, HeadObject, Upload, or DeleteObjects
+func SyncDirectory(svc s3iface.S3API, uploader s3manageriface.UploaderAPI, bucket *string, dir *string, opts SyncOptions) (*SyncResult, error) {
+    prefix := opts.keyPrefix()
+
+    local := map[string]localFile{}
+    err := filepath.Walk(*dir, func(p string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+
+        if info.IsDir() {
+            return nil
+        }
+
+        rel, err := filepath.Rel(*dir, p)
+        if err != nil {
+            return err
+        }
+
+        rel = filepath.ToSlash(rel)
+        if opts.selected(rel) {
+            local[prefix+rel] = localFile{
+                path: p,
+                size: info.Size(),
+            }
+        }
+
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    remote := map[string]*s3.Object{}
+    err = svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+        Bucket: bucket,
+        Prefix: aws.String(prefix),
+    }, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+        for _, o := range page.Contents {
+            remote[*o.Key] = o
+        }
+
+        return true
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    result := &SyncResult{}
+
+    keys := make([]string, 0, len(local))
+    for key := range local {
+        keys = append(keys, key)
+    }
+
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        file := local[key]
+
+        // Read the file at most once, and only if needed
+        var sum string
+        digest := func() (string, error) {
+            if sum == "" {
+                var err error
+                sum, err = fileMD5(file.path)
+                if err != nil {
+                    return "", err
+                }
+            }
+
+            return sum, nil
+        }
+
+        if object, ok := remote[key]; ok {
+            same, err := unchanged(svc, *bucket, object, file, digest)
+            if err != nil {
+                return nil, err
+            }
+
+            if same {
+                result.Skipped = append(result.Skipped, key)
+                continue
+            }
+        }
+
+        _, err := digest()
+        if err != nil {
+            return nil, err
+        }
+
+        err = uploadFile(uploader, *bucket, key, file, sum)
+        if err != nil {
+            return nil, err
+        }
+
+        result.Uploaded = append(result.Uploaded, key)
+    }
+
+    if !opts.Delete {
+        return result, nil
+    }
+
+    var stale []*s3.ObjectIdentifier
+    for key := range remote {
+        if _, ok := local[key]; ok || !opts.selected(strings.TrimPrefix(key, prefix)) {
+            continue
+        }
+
+        stale = append(stale, &s3.ObjectIdentifier{Key: aws.String(key)})
+    }
+
+    sort.Slice(stale, func(i, j int) bool { return *stale[i].Key < *stale[j].Key })
+
+    // DeleteObjects accepts at most 1000 keys
+    for len(stale) > 0 {
+        n := len(stale)
+        if n > 1000 {
+            n = 1000
+        }
+
+        output, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+            Bucket: bucket,
+            Delete: &s3.Delete{
+                Objects: stale[:n],
+                Quiet:   aws.Bool(true),
+            },
+        })
+        if err != nil {
+            return nil, err
+        }
+
+        if len(output.Errors) > 0 {
+            e := output.Errors[0]
+            return nil, fmt.Errorf("could not delete %s: %s: %s", aws.StringValue(e.Key), aws.StringValue(e.Code), aws.StringValue(e.Message))
+        }
+
+        for _, o := range stale[:n] {
+            result.Deleted = append(result.Deleted, *o.Key)
+        }
+
+        stale = stale[n:]
+    }
+
+    return result, nil
+}
+
+// uploadFile uploads a file, recording its MD5 digest as metadata
+func uploadFile(uploader s3manageriface.UploaderAPI, bucket, key string, file localFile, sum string) error {
+    f, err := os.Open(file.path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    _, err = uploader.Upload(&s3manager.UploadInput{
+        Bucket: aws.String(bucket),
+        Key:    aws.String(key),
+        Body:   f,
+        Metadata: map[string]*string{
+            md5MetadataKey: aws.String(sum),
+        },
+    })
+
+    return err
+}
+
+// splitPatterns splits a comma-separated list of glob patterns
+func splitPatterns(s string) []string {
+    if s == "" {
+        return nil
+    }
+
+    return strings.Split(s, ",")
+}
+
 func main() {
     // snippet-start:[s3.go.upload_directory.args]
     bucket := flag.String("b", "", "The name of the bucket")
     directory := flag.String("d", "", "The directory to upload")
+    sync := flag.Bool("sync", false, "Upload only new and changed files")
+    prefix := flag.String("p", "", "With -sync, the key prefix for the uploaded files")
+    include := flag.String("include", "", "With -sync, a comma-separated list of glob patterns of files to sync")
+    exclude := flag.String("exclude", "", "With -sync, a comma-separated list of glob patterns of files to skip")
+    del := flag.Bool("delete", false, "With -sync, delete objects under the prefix that have no local file")
     flag.Parse()
 
     if *bucket == "" || *directory == "" {
@@ -131,6 +459,33 @@ func main() {
     }))
     // snippet-end:[s3.go.upload_directory.session]
 
+    if *sync {
+        svc := s3.New(sess)
+        result, err := SyncDirectory(svc, s3manager.NewUploaderWithClient(svc), bucket, directory, SyncOptions{
+            Prefix:  *prefix,
+            Include: splitPatterns(*include),
+            Exclude: splitPatterns(*exclude),
+            Delete:  *del,
+        })
+        if err != nil {
+            fmt.Println("Got an error syncing directory " + *directory + " to bucket " + *bucket)
+            fmt.Println(err)
+            return
+        }
+
+        for _, key := range result.Uploaded {
+            fmt.Println("Uploaded " + key)
+        }
+
+        for _, key := range result.Deleted {
+            fmt.Println("Deleted " + key)
+        }
+
+        fmt.Printf("Synced directory %s to bucket %s: %d uploaded, %d unchanged, %d deleted\n",
+            *directory, *bucket, len(result.Uploaded), len(result.Skipped), len(result.Deleted))
+        return
+    }
+
     err := UploadDirectory(sess, bucket, directory)
     if err != nil {
         fmt.Println("Got an error uploading directory " + *directory + " to bucket " + *bucket)
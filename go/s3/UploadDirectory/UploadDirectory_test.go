@@ -14,16 +14,24 @@
 package main
 
 import (
+    "crypto/md5"
+    "encoding/hex"
     "encoding/json"
     "fmt"
     "io/ioutil"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
     "testing"
     "time"
 
     "github.com/aws/aws-sdk-go/aws"
     "github.com/aws/aws-sdk-go/aws/session"
     "github.com/aws/aws-sdk-go/service/s3"
+    "github.com/aws/aws-sdk-go/service/s3/s3iface"
     "github.com/aws/aws-sdk-go/service/s3/s3manager"
+    "github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 
     "github.com/google/uuid"
 )
@@ -155,3 +163,210 @@ func TestUploadDirectory(t *testing.T) {
         t.Log("Deleted bucket " + globalConfig.Bucket)
     }
 }
+
+// mockObject is an object stored by mockS3Client
+type mockObject struct {
+    etag     string
+    size     int64
+    metadata map[string]*string
+}
+
+// mockS3Client stores objects in memory.
+// It also implements s3manageriface.UploaderAPI, giving objects larger than multipartSize a multipart ETag.
+// Any other call, such as CopyObject, panics, as SyncDirectory must only write to the bucket by uploading or deleting.
+type mockS3Client struct {
+    s3iface.S3API
+    s3manageriface.UploaderAPI
+
+    objects       map[string]mockObject
+    multipartSize int64
+    heads         int
+    uploads       int
+}
+
+func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+    page := &s3.ListObjectsV2Output{}
+    for key, o := range m.objects {
+        if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+            page.Contents = append(page.Contents, &s3.Object{
+                Key:  aws.String(key),
+                ETag: aws.String(`"` + o.etag + `"`),
+                Size: aws.Int64(o.size),
+            })
+        }
+    }
+
+    fn(page, true)
+    return nil
+}
+
+func (m *mockS3Client) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+    m.heads++
+
+    // The SDK returns metadata keys in canonical header form
+    metadata := map[string]*string{}
+    for k, v := range m.objects[*input.Key].metadata {
+        metadata[strings.Title(k)] = v
+    }
+
+    return &s3.HeadObjectOutput{Metadata: metadata}, nil
+}
+
+func (m *mockS3Client) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+    for _, o := range input.Delete.Objects {
+        delete(m.objects, *o.Key)
+    }
+
+    return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (m *mockS3Client) Upload(input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+    m.uploads++
+
+    body, err := ioutil.ReadAll(input.Body)
+    if err != nil {
+        return nil, err
+    }
+
+    sum := md5.Sum(body)
+    etag := hex.EncodeToString(sum[:])
+    if int64(len(body)) > m.multipartSize {
+        etag = etag[:8] + "-2"
+    }
+
+    m.objects[*input.Key] = mockObject{etag: etag, size: int64(len(body)), metadata: input.Metadata}
+
+    return &s3manager.UploadOutput{}, nil
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+    p := filepath.Join(dir, filepath.FromSlash(name))
+
+    err := os.MkdirAll(filepath.Dir(p), 0755)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    err = ioutil.WriteFile(p, []byte(content), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestSyncDirectoryMock(t *testing.T) {
+    dir, err := ioutil.TempDir("", "UploadDirectory")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    writeFile(t, dir, "a.txt", "abc")
+    writeFile(t, dir, "b.log", "log")
+    writeFile(t, dir, "sub/c.txt", "def")
+    writeFile(t, dir, "big.bin", "a multipart object")
+
+    svc := &mockS3Client{
+        objects: map[string]mockObject{
+            "site/old.txt":  {etag: "stale", size: 5},
+            "site/keep.log": {etag: "stale", size: 5},
+            "other/x.txt":   {etag: "stale", size: 5},
+        },
+        multipartSize: 10,
+    }
+
+    bucket := "doc-example-bucket"
+    opts := SyncOptions{Prefix: "site", Exclude: []string{"*.log"}, Delete: true}
+
+    result, err := SyncDirectory(svc, svc, &bucket, &dir, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    want := &SyncResult{
+        Uploaded: []string{"site/a.txt", "site/big.bin", "site/sub/c.txt"},
+        Deleted:  []string{"site/old.txt"},
+    }
+    if !reflect.DeepEqual(result, want) {
+        t.Fatalf("got %+v, want %+v", result, want)
+    }
+
+    // Nothing changed, and the multipart object is known to be unchanged from its stored digest
+    svc.uploads = 0
+    result, err = SyncDirectory(svc, svc, &bucket, &dir, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(result.Uploaded) != 0 || len(result.Skipped) != 3 || svc.heads != 3 || svc.uploads != 0 {
+        t.Fatalf("got %+v, %d HeadObject calls, and %d uploads, want 3 skipped, 3 calls, and no uploads", result, svc.heads, svc.uploads)
+    }
+
+    // Same size, different content
+    writeFile(t, dir, "a.txt", "xyz")
+
+    // Touched, but the same content
+    later := time.Now().Add(time.Hour)
+    err = os.Chtimes(filepath.Join(dir, "big.bin"), later, later)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    result, err = SyncDirectory(svc, svc, &bucket, &dir, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The touched file is skipped without writing to the bucket
+    if !reflect.DeepEqual(result.Uploaded, []string{"site/a.txt"}) {
+        t.Errorf("got uploaded %v, want site/a.txt", result.Uploaded)
+    }
+
+    if !reflect.DeepEqual(result.Skipped, []string{"site/big.bin", "site/sub/c.txt"}) {
+        t.Errorf("got skipped %v, want site/big.bin and site/sub/c.txt", result.Skipped)
+    }
+
+    if _, ok := svc.objects["site/keep.log"]; !ok {
+        t.Error("deleted an excluded object")
+    }
+
+    if _, ok := svc.objects["other/x.txt"]; !ok {
+        t.Error("deleted an object outside the prefix")
+    }
+}
+
+func TestSyncDirectoryStoredDigest(t *testing.T) {
+    dir, err := ioutil.TempDir("", "UploadDirectory")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    writeFile(t, dir, "a.txt", "abc")
+    writeFile(t, dir, "b.txt", "def")
+
+    sum := md5.Sum([]byte("abc"))
+
+    // a.txt was uploaded with SSE-KMS, so its single-part ETag isn't its MD5 digest,
+    // and b.txt was uploaded by another tool, without metadata
+    other := md5.Sum([]byte("def"))
+    svc := &mockS3Client{
+        objects: map[string]mockObject{
+            "a.txt": {etag: "0123456789abcdef0123456789abcdef", size: 3, metadata: map[string]*string{
+                md5MetadataKey: aws.String(hex.EncodeToString(sum[:])),
+            }},
+            "b.txt": {etag: hex.EncodeToString(other[:]), size: 3},
+        },
+        multipartSize: 10,
+    }
+
+    bucket := "doc-example-bucket"
+
+    result, err := SyncDirectory(svc, svc, &bucket, &dir, SyncOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(result.Uploaded) != 0 || len(result.Skipped) != 2 || svc.uploads != 0 {
+        t.Errorf("got %+v and %d uploads, want both files skipped", result, svc.uploads)
+    }
+}
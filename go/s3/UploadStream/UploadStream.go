@@ -17,16 +17,90 @@ package main
 // snippet-start:[s3.go.upload_stream.imports]
 import (
     "compress/gzip"
+    "crypto/sha256"
+    "encoding/hex"
     "flag"
     "fmt"
     "io"
+    "io/ioutil"
+    "net/url"
     "os"
+    "strings"
 
+    "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/aws/request"
     "github.com/aws/aws-sdk-go/aws/session"
+    "github.com/aws/aws-sdk-go/service/s3"
+    "github.com/aws/aws-sdk-go/service/s3/s3iface"
     "github.com/aws/aws-sdk-go/service/s3/s3manager"
+    "github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+    "github.com/klauspost/compress/snappy"
+    "github.com/klauspost/compress/zstd"
 )
 // snippet-end:[s3.go.upload_stream.imports]
 
+// Codec compresses a stream as it's uploaded, and decompresses it as it's downloaded
+type Codec struct {
+    // ContentEncoding is the Content-Encoding of objects compressed with the codec, or empty if it doesn't compress
+    ContentEncoding string
+    NewWriter       func(w io.Writer) (io.WriteCloser, error)
+    NewReader       func(r io.Reader) (io.ReadCloser, error)
+}
+
+// nopWriteCloser adds a Close method that does nothing to a writer
+type nopWriteCloser struct {
+    io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+    return nil
+}
+
+// Codecs are the codecs that UploadStreamWithCodec accepts, by name
+var Codecs = map[string]Codec{
+    "none": {
+        NewWriter: func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil },
+        NewReader: func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(r), nil },
+    },
+    "gzip": {
+        ContentEncoding: "gzip",
+        NewWriter:       func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+        NewReader:       func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+    },
+    "zstd": {
+        ContentEncoding: "zstd",
+        NewWriter:       func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+        NewReader: func(r io.Reader) (io.ReadCloser, error) {
+            d, err := zstd.NewReader(r)
+            if err != nil {
+                return nil, err
+            }
+
+            return d.IOReadCloser(), nil
+        },
+    },
+    // Snappy has no registered content coding, so the framing format gets an x- name
+    "snappy": {
+        ContentEncoding: "x-snappy-framed",
+        NewWriter:       func(w io.Writer) (io.WriteCloser, error) { return snappy.NewBufferedWriter(w), nil },
+        NewReader:       func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(snappy.NewReader(r)), nil },
+    },
+}
+
+// codecForEncoding returns the codec for a Content-Encoding
+func codecForEncoding(encoding string) (Codec, error) {
+    for _, c := range Codecs {
+        if strings.EqualFold(c.ContentEncoding, encoding) {
+            return c, nil
+        }
+    }
+
+    return Codec{}, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+}
+
+// checksumMetadata is the metadata key of the SHA-256 digest of an object's uncompressed stream
+const checksumMetadata = "Sha256"
+
 // UploadStream uploads a stream for a file to a bucket
 // Inputs:
 //     sess is the current session, which provides configuration for the SDK's service clients
@@ -35,47 +109,214 @@ import (
 //     filename is the name of the file to stream to the bucket
 // Output:
 //     If success, nil
-//     Otherwise, an error from the call to Open or Upload 
+//     Otherwise, an error from the call to Open or Upload
 func UploadStream(sess *session.Session, bucket *string, key *string, filename *string) error {
     // snippet-start:[s3.go.upload_stream.call]
     file, err := os.Open(*filename)
     if err != nil {
         return err
     }
+    defer file.Close()
 
     reader, writer := io.Pipe()
 
+    // A failure to read or compress the file reaches the uploader through the pipe,
+    // so the upload fails instead of storing a truncated object
     go func() {
         gw := gzip.NewWriter(writer)
         _, err := io.Copy(gw, file)
         if err != nil {
+            writer.CloseWithError(err)
             return
         }
-        file.Close()
-        gw.Close()
-        writer.Close()
+
+        writer.CloseWithError(gw.Close())
     }()
 
     uploader := s3manager.NewUploader(sess)
 
     _, err = uploader.Upload(&s3manager.UploadInput{
+        Body:            reader,
+        Bucket:          bucket,
+        Key:             key,
+        ContentEncoding: aws.String("gzip"),
+    })
+
+    // If the upload stopped early, this unblocks the goroutine
+    reader.CloseWithError(err)
+    // snippet-end:[s3.go.upload_stream.call]
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// UploadStreamWithCodec uploads a file to a bucket, compressing it on the fly,
+// and stores the SHA-256 digest of the file in the object's metadata
+// Inputs:
+//     svc is the Amazon S3 service client used to store the digest
+//     uploader uploads the stream
+//     bucket is the name of the bucket
+//     key is the name of the object in the bucket
+//     filename is the name of the file to stream to the bucket
+//     codec is the name of the codec in Codecs to compress it with
+// Output:
+//     If success, the hex-encoded SHA-256 digest of the file and nil
+//     Otherwise, an empty string and an error from the call to Open, Upload, or CopyObject, or from reading or compressing the file
+func UploadStreamWithCodec(svc s3iface.S3API, uploader s3manageriface.UploaderAPI, bucket *string, key *string, filename *string, codec string) (string, error) {
+    file, err := os.Open(*filename)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+
+    return uploadReader(svc, uploader, bucket, key, file, codec)
+}
+
+// uploadReader does the work of UploadStreamWithCodec for any reader
+func uploadReader(svc s3iface.S3API, uploader s3manageriface.UploaderAPI, bucket *string, key *string, r io.Reader, codec string) (string, error) {
+    c, ok := Codecs[codec]
+    if !ok {
+        return "", fmt.Errorf("unknown codec %q", codec)
+    }
+
+    hash := sha256.New()
+    reader, writer := io.Pipe()
+
+    // A failure to read or compress the file reaches the uploader through the pipe,
+    // so the upload fails instead of storing a truncated object
+    go func() {
+        writer.CloseWithError(compress(writer, io.TeeReader(r, hash), c))
+    }()
+
+    input := &s3manager.UploadInput{
         Body:   reader,
         Bucket: bucket,
         Key:    key,
-    })
-    // snippet-end:[s3.go.upload_stream.call]
+    }
+    if c.ContentEncoding != "" {
+        input.ContentEncoding = aws.String(c.ContentEncoding)
+    }
+
+    _, err := uploader.Upload(input)
+
+    // If the upload stopped early, this unblocks the goroutine
+    reader.CloseWithError(err)
+    if err != nil {
+        return "", err
+    }
+
+    sum := hex.EncodeToString(hash.Sum(nil))
+
+    // The digest is known only at the end of the stream, after the upload has started,
+    // so a copy of the object onto itself adds it to the metadata.
+    // CopyObject copies objects of up to 5 GB.
+    copyInput := &s3.CopyObjectInput{
+        Bucket:            bucket,
+        Key:               key,
+        CopySource:        aws.String(url.PathEscape(*bucket + "/" + *key)),
+        MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+        Metadata:          map[string]*string{checksumMetadata: aws.String(sum)},
+    }
+    if c.ContentEncoding != "" {
+        copyInput.ContentEncoding = aws.String(c.ContentEncoding)
+    }
+
+    _, err = svc.CopyObject(copyInput)
+    if err != nil {
+        return "", fmt.Errorf("uploaded %s, but couldn't store its digest: %w", *key, err)
+    }
+
+    return sum, nil
+}
+
+// compress copies r to w through a codec, returning the first error
+func compress(w io.Writer, r io.Reader, c Codec) error {
+    cw, err := c.NewWriter(w)
+    if err != nil {
+        return err
+    }
+
+    _, err = io.Copy(cw, r)
+    if err != nil {
+        cw.Close()
+        return err
+    }
+
+    return cw.Close()
+}
+
+// DownloadStream downloads an object, decompresses it according to its Content-Encoding,
+// and checks it against the SHA-256 digest in its metadata
+// Inputs:
+//     svc is the Amazon S3 service client
+//     bucket is the name of the bucket
+//     key is the name of the object in the bucket
+//     w gets the decompressed object. If DownloadStream fails, discard what was written.
+// Output:
+//     If success, nil
+//     Otherwise, an error from the call to GetObject, from decompressing the object,
+//     or because it has no digest or doesn't match it
+func DownloadStream(svc s3iface.S3API, bucket *string, key *string, w io.Writer) error {
+    // Asking for the stored bytes stops the HTTP client from removing a gzip encoding itself
+    output, err := svc.GetObjectWithContext(aws.BackgroundContext(), &s3.GetObjectInput{
+        Bucket: bucket,
+        Key:    key,
+    }, request.WithSetRequestHeaders(map[string]string{"Accept-Encoding": "identity"}))
+    if err != nil {
+        return err
+    }
+    defer output.Body.Close()
+
+    c, err := codecForEncoding(aws.StringValue(output.ContentEncoding))
+    if err != nil {
+        return err
+    }
+
+    body, err := c.NewReader(output.Body)
+    if err != nil {
+        return err
+    }
+    defer body.Close()
+
+    hash := sha256.New()
+    _, err = io.Copy(io.MultiWriter(w, hash), body)
     if err != nil {
         return err
     }
 
+    want := checksum(output.Metadata)
+    if want == "" {
+        return fmt.Errorf("%s has no SHA-256 digest in its metadata, so it can't be verified", *key)
+    }
+
+    if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+        return fmt.Errorf("the SHA-256 digest of %s is %s, want %s", *key, got, want)
+    }
+
     return nil
 }
 
+// checksum returns the digest in an object's metadata, or an empty string if there isn't one.
+// The SDK returns metadata keys in canonical header form, but other clients might not.
+func checksum(metadata map[string]*string) string {
+    for k, v := range metadata {
+        if strings.EqualFold(k, checksumMetadata) {
+            return aws.StringValue(v)
+        }
+    }
+
+    return ""
+}
+
 func main() {
     // snippet-start:[s3.go.upload_stream.args]
     bucket := flag.String("b", "", "The bucket to which the stream is uploaded")
     filename := flag.String("f", "", "The file to upload to the bucket")
     key := flag.String("k", "", "The name of the object in the bucket")
+    codec := flag.String("c", "gzip", "How to compress the stream: none, gzip, zstd, or snappy")
+    verify := flag.Bool("v", false, "Download the object after uploading it, and check that it matches the file")
     flag.Parse()
 
     if *bucket == "" || *filename == "" || *key == "" {
@@ -91,11 +332,26 @@ func main() {
     }))
     // snippet-end:[s3.go.upload_stream.session]
 
-    err := UploadStream(sess, bucket, key, filename)
+    svc := s3.New(sess)
+
+    sum, err := UploadStreamWithCodec(svc, s3manager.NewUploaderWithClient(svc), bucket, key, filename, *codec)
     if err != nil {
         fmt.Println("Failed to upload " + *filename + " to bucket " + *bucket)
+        fmt.Println(err)
+        return
     }
 
-    fmt.Println("Successfully uploaded " + *filename + " to " + *bucket)
+    fmt.Println("Successfully uploaded " + *filename + " to " + *bucket + " with SHA-256 " + sum)
+
+    if *verify {
+        err := DownloadStream(svc, bucket, key, ioutil.Discard)
+        if err != nil {
+            fmt.Println("Failed to verify " + *key + ":")
+            fmt.Println(err)
+            return
+        }
+
+        fmt.Println("Verified " + *key)
+    }
 }
 // snippet-end:[s3.go.upload_stream]
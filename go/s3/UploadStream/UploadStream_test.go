@@ -14,15 +14,24 @@
 package main
 
 import (
+    "bytes"
     "encoding/json"
+    "errors"
+    "io"
     "io/ioutil"
+    "net/url"
+    "strings"
     "testing"
     "time"
 
     "github.com/aws/aws-sdk-go/aws"
+    "github.com/aws/aws-sdk-go/aws/awserr"
+    "github.com/aws/aws-sdk-go/aws/request"
     "github.com/aws/aws-sdk-go/aws/session"
     "github.com/aws/aws-sdk-go/service/s3"
+    "github.com/aws/aws-sdk-go/service/s3/s3iface"
     "github.com/aws/aws-sdk-go/service/s3/s3manager"
+    "github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
     "github.com/google/uuid"
 )
 
@@ -158,3 +167,151 @@ func TestUploadStream(t *testing.T) {
         t.Log("Deleted bucket " + globalConfig.Bucket)
     }
 }
+
+// mockObject is an object stored by mockS3Client
+type mockObject struct {
+    body            []byte
+    contentEncoding *string
+    metadata        map[string]*string
+}
+
+// mockS3Client stores objects in memory, and also implements s3manageriface.UploaderAPI
+type mockS3Client struct {
+    s3iface.S3API
+    s3manageriface.UploaderAPI
+
+    objects map[string]*mockObject
+}
+
+func (m *mockS3Client) Upload(input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+    body, err := ioutil.ReadAll(input.Body)
+    if err != nil {
+        return nil, err
+    }
+
+    m.objects[*input.Key] = &mockObject{body: body, contentEncoding: input.ContentEncoding, metadata: input.Metadata}
+
+    return &s3manager.UploadOutput{}, nil
+}
+
+// CopyObject copies an object within the mock, replacing its metadata, as with MetadataDirective REPLACE
+func (m *mockS3Client) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+    source, err := url.PathUnescape(aws.StringValue(input.CopySource))
+    if err != nil {
+        return nil, err
+    }
+
+    o, ok := m.objects[strings.TrimPrefix(source, *input.Bucket+"/")]
+    if !ok {
+        return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+    }
+
+    if aws.StringValue(input.MetadataDirective) != s3.MetadataDirectiveReplace {
+        return nil, errors.New("the mock only copies with MetadataDirective REPLACE")
+    }
+
+    m.objects[*input.Key] = &mockObject{body: o.body, contentEncoding: input.ContentEncoding, metadata: input.Metadata}
+
+    return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *mockS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+    o, ok := m.objects[*input.Key]
+    if !ok {
+        return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+    }
+
+    // The SDK returns metadata keys in canonical header form
+    metadata := map[string]*string{}
+    for k, v := range o.metadata {
+        metadata[strings.Title(k)] = v
+    }
+
+    return &s3.GetObjectOutput{
+        Body:            ioutil.NopCloser(bytes.NewReader(o.body)),
+        ContentEncoding: o.contentEncoding,
+        Metadata:        metadata,
+    }, nil
+}
+
+// failingReader returns some data and then an error
+type failingReader struct {
+    n int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+    if r.n == 0 {
+        return 0, errors.New("disk read error")
+    }
+
+    if len(p) > r.n {
+        p = p[:r.n]
+    }
+
+    r.n -= len(p)
+    return len(p), nil
+}
+
+func TestUploadStreamCodecsMock(t *testing.T) {
+    text := strings.Repeat("All work and no play makes Jack a dull boy. ", 1000)
+    bucket := "doc-example-bucket"
+
+    for name, codec := range Codecs {
+        svc := &mockS3Client{objects: map[string]*mockObject{}}
+        key := "dir/test " + name + ".txt"
+
+        sum, err := uploadReader(svc, svc, &bucket, &key, strings.NewReader(text), name)
+        if err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+
+        o := svc.objects[key]
+        if aws.StringValue(o.contentEncoding) != codec.ContentEncoding || aws.StringValue(o.metadata[checksumMetadata]) != sum {
+            t.Errorf("%s: got Content-Encoding %q and metadata %v, want SHA-256 %s", name, aws.StringValue(o.contentEncoding), o.metadata, sum)
+        }
+
+        if name != "none" && len(o.body) >= len(text) {
+            t.Errorf("%s: stored %d bytes for %d bytes of text", name, len(o.body), len(text))
+        }
+
+        var got bytes.Buffer
+        err = DownloadStream(svc, &bucket, &key, &got)
+        if err != nil {
+            t.Fatalf("%s: %v", name, err)
+        }
+
+        if got.String() != text {
+            t.Errorf("%s: the round trip changed the text", name)
+        }
+
+        // A corrupted digest is caught
+        o.metadata[checksumMetadata] = aws.String(strings.Repeat("0", 64))
+        err = DownloadStream(svc, &bucket, &key, ioutil.Discard)
+        if err == nil {
+            t.Errorf("%s: got no error for a mismatched digest", name)
+        }
+
+        // So is a missing one
+        delete(o.metadata, checksumMetadata)
+        err = DownloadStream(svc, &bucket, &key, ioutil.Discard)
+        if err == nil {
+            t.Errorf("%s: got no error for an object without a digest", name)
+        }
+    }
+}
+
+func TestUploadStreamReadErrorMock(t *testing.T) {
+    svc := &mockS3Client{objects: map[string]*mockObject{}}
+    bucket := "doc-example-bucket"
+    key := "test.txt"
+
+    var r io.Reader = &failingReader{n: 100}
+    _, err := uploadReader(svc, svc, &bucket, &key, r, "gzip")
+    if err == nil || !strings.Contains(err.Error(), "disk read error") {
+        t.Errorf("got %v, want the read error", err)
+    }
+
+    if _, ok := svc.objects[key]; ok {
+        t.Error("stored an object for a failed upload")
+    }
+}
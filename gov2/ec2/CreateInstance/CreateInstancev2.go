@@ -7,11 +7,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
 )
 
 // EC2CreateInstanceAPI defines the interface for the RunInstances and CreateTags functions.
@@ -53,6 +55,8 @@ func MakeTags(c context.Context, api EC2CreateInstanceAPI, input *ec2.CreateTags
 func main() {
 	name := flag.String("n", "", "The name of the tag to attach to the instance")
 	value := flag.String("v", "", "The value of the tag to attach to the instance")
+	wait := flag.Bool("w", false, "Wait until the instance is running")
+	timeout := flag.Duration("t", 10*time.Minute, "How long to wait for the instance")
 	flag.Parse()
 
 	if *name == "" || *value == "" {
@@ -81,6 +85,9 @@ func main() {
 		return
 	}
 
+	// Display and tag the instance before waiting, so that it can be found even if the wait fails
+	fmt.Println("Created instance with ID " + *result.Instances[0].InstanceId)
+
 	tagInput := &ec2.CreateTagsInput{
 		Resources: []string{*result.Instances[0].InstanceId},
 		Tags: []types.Tag{
@@ -98,7 +105,18 @@ func main() {
 		return
 	}
 
-	fmt.Println("Created tagged instance with ID " + *result.Instances[0].InstanceId)
+	fmt.Println("Tagged instance with ID " + *result.Instances[0].InstanceId)
+
+	if *wait {
+		err = ec2wait.WaitForRunning(context.TODO(), client, []string{*result.Instances[0].InstanceId}, ec2wait.Options{Timeout: *timeout})
+		if err != nil {
+			fmt.Println("Got an error waiting for the instance:")
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Println("The instance is running")
+	}
 }
 
 // snippet-end:[ec2.go-v2.CreateInstance]
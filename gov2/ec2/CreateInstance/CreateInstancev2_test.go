@@ -11,6 +11,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
 )
 
 type EC2CreateInstanceImpl struct{}
@@ -112,3 +114,63 @@ func TestCreateInstance(t *testing.T) {
 
 	t.Log("Created tagged instance with ID " + *result.Instances[0].InstanceId)
 }
+
+func TestMakeInstanceAndWait(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+
+	input := &ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-e7527ed7"),
+		InstanceType: types.InstanceTypeT2Micro,
+		MinCount:     1,
+		MaxCount:     3,
+	}
+
+	result, err := MakeInstance(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Instances) != 3 {
+		t.Fatalf("got %d instances, want 3", len(result.Instances))
+	}
+
+	ids := make([]string, len(result.Instances))
+	for i, instance := range result.Instances {
+		ids[i] = aws.ToString(instance.InstanceId)
+	}
+
+	opts := clock.Options(ec2wait.Options{MinDelay: 10 * time.Second})
+
+	err = ec2wait.WaitForRunning(context.Background(), api, ids, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The instances are pending for 30 seconds: 10 + 20 seconds covers it
+	if len(clock.Slept) != 2 {
+		t.Errorf("got delays %v", clock.Slept)
+	}
+
+	output, err := api.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{
+		InstanceIds: []string{ids[2]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state := output.Reservations[0].Instances[0].State.Name; state != types.InstanceStateNameRunning {
+		t.Errorf("got %s, want running", state)
+	}
+
+	// An instance that stops fails right away
+	_, err = api.StopInstances(context.Background(), &ec2.StopInstancesInput{InstanceIds: ids[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transitionErr *ec2wait.TransitionError
+	err = ec2wait.WaitForRunning(context.Background(), api, ids, opts)
+	if !errors.As(err, &transitionErr) || len(transitionErr.States) != 1 {
+		t.Errorf("got %v, want a TransitionError for %s", err, ids[0])
+	}
+}
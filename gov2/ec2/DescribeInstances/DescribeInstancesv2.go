@@ -5,10 +5,22 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
 // EC2DescribeInstancesAPI defines the interface for the DescribeInstances function.
@@ -20,18 +32,315 @@ type EC2DescribeInstancesAPI interface {
 }
 
 // GetInstances retrieves information about your Amazon Elastic Compute Cloud (Amazon EC2) instances.
+// It follows NextToken until it has every page.
 // Inputs:
 //     c is the context of the method call, which includes the AWS Region.
 //     api is the interface that defines the method call.
-//     input defines the input arguments to the service call.
+//     input defines the input arguments to the service call. It isn't modified.
 // Output:
-//     If success, a DescribeInstancesOutput object containing the result of the service call and nil.
+//     If success, a DescribeInstancesOutput object containing the reservations from every page and nil.
 //     Otherwise, nil and an error from the call to DescribeInstances.
 func GetInstances(c context.Context, api EC2DescribeInstancesAPI, input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
-	return api.DescribeInstances(c, input)
+	page := *input
+	result := &ec2.DescribeInstancesOutput{}
+
+	for {
+		output, err := api.DescribeInstances(c, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Reservations = append(result.Reservations, output.Reservations...)
+
+		if output.NextToken == nil {
+			return result, nil
+		}
+
+		page.NextToken = output.NextToken
+	}
+}
+
+// InstanceFilter selects instances. Zero values select every instance.
+type InstanceFilter struct {
+	// States are the instance states to select, such as running or stopped.
+	States []string
+
+	// Tags are the tags the instances must have. An empty value selects any value of the tag.
+	Tags map[string]string
+
+	// InstanceTypes are the instance types to select, such as t2.micro.
+	InstanceTypes []string
+
+	// VpcID is the ID of the VPC the instances must be in.
+	VpcID string
+
+	// LaunchedAfter and LaunchedBefore bound the launch times of the instances.
+	// Amazon EC2 can't filter on a range of times, so MatchLaunchTime checks them after the call.
+	LaunchedAfter  time.Time
+	LaunchedBefore time.Time
+}
+
+// Filters returns the DescribeInstances filters for everything but the launch time range.
+func (f InstanceFilter) Filters() []types.Filter {
+	var filters []types.Filter
+
+	if len(f.States) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("instance-state-name"), Values: f.States})
+	}
+
+	if len(f.InstanceTypes) > 0 {
+		filters = append(filters, types.Filter{Name: aws.String("instance-type"), Values: f.InstanceTypes})
+	}
+
+	if f.VpcID != "" {
+		filters = append(filters, types.Filter{Name: aws.String("vpc-id"), Values: []string{f.VpcID}})
+	}
+
+	// Sort the tags, so that the filters are always in the same order
+	keys := make([]string, 0, len(f.Tags))
+	for key := range f.Tags {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := f.Tags[key]
+		if value == "" {
+			filters = append(filters, types.Filter{Name: aws.String("tag-key"), Values: []string{key}})
+		} else {
+			filters = append(filters, types.Filter{Name: aws.String("tag:" + key), Values: []string{value}})
+		}
+	}
+
+	return filters
+}
+
+// MatchLaunchTime reports whether the instance was launched within the filter's time range.
+func (f InstanceFilter) MatchLaunchTime(instance types.Instance) bool {
+	launched := aws.ToTime(instance.LaunchTime)
+
+	if !f.LaunchedAfter.IsZero() && launched.Before(f.LaunchedAfter) {
+		return false
+	}
+
+	if !f.LaunchedBefore.IsZero() && !launched.Before(f.LaunchedBefore) {
+		return false
+	}
+
+	return true
+}
+
+// InstanceRow describes one instance.
+type InstanceRow struct {
+	InstanceID       string    `json:"instanceId"`
+	Name             string    `json:"name"`
+	State            string    `json:"state"`
+	InstanceType     string    `json:"instanceType"`
+	PrivateIP        string    `json:"privateIp"`
+	PublicIP         string    `json:"publicIp"`
+	AvailabilityZone string    `json:"availabilityZone"`
+	LaunchTime       time.Time `json:"launchTime"`
+}
+
+// InstanceReport lists instances, one row per instance.
+type InstanceReport struct {
+	Instances []InstanceRow `json:"instances"`
+}
+
+// ListInstances retrieves the instances that match the filter, one row per instance.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     filter selects the instances.
+// Output:
+//     If success, a report with a row for each instance, in the order that Amazon EC2 returns them, and nil.
+//     Otherwise, nil and an error from the call to DescribeInstances.
+func ListInstances(c context.Context, api EC2DescribeInstancesAPI, filter InstanceFilter) (*InstanceReport, error) {
+	output, err := GetInstances(c, api, &ec2.DescribeInstancesInput{Filters: filter.Filters()})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &InstanceReport{Instances: []InstanceRow{}}
+
+	for _, r := range output.Reservations {
+		for _, i := range r.Instances {
+			if !filter.MatchLaunchTime(i) {
+				continue
+			}
+
+			row := InstanceRow{
+				InstanceID:   aws.ToString(i.InstanceId),
+				InstanceType: string(i.InstanceType),
+				PrivateIP:    aws.ToString(i.PrivateIpAddress),
+				PublicIP:     aws.ToString(i.PublicIpAddress),
+				LaunchTime:   aws.ToTime(i.LaunchTime),
+			}
+
+			if i.State != nil {
+				row.State = string(i.State.Name)
+			}
+
+			if i.Placement != nil {
+				row.AvailabilityZone = aws.ToString(i.Placement.AvailabilityZone)
+			}
+
+			for _, tag := range i.Tags {
+				if aws.ToString(tag.Key) == "Name" {
+					row.Name = aws.ToString(tag.Value)
+				}
+			}
+
+			report.Instances = append(report.Instances, row)
+		}
+	}
+
+	return report, nil
+}
+
+// WriteJSON writes the report as an indented JSON document.
+func (r *InstanceReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// fields returns the columns of a row, as WriteCSV and WriteTable write them.
+func (row InstanceRow) fields() []string {
+	return []string{
+		row.InstanceID, row.Name, row.State, row.InstanceType,
+		row.PrivateIP, row.PublicIP, row.AvailabilityZone, row.LaunchTime.UTC().Format(time.RFC3339),
+	}
+}
+
+// WriteCSV writes the report as CSV, with a header row and one row for each instance.
+func (r *InstanceReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"instance_id", "name", "state", "instance_type", "private_ip", "public_ip", "availability_zone", "launch_time"})
+	if err != nil {
+		return err
+	}
+
+	for _, row := range r.Instances {
+		if err := cw.Write(row.fields()); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteTable writes the report as an aligned text table, with one line for each instance.
+// Empty columns are shown as -.
+func (r *InstanceReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "INSTANCE ID\tNAME\tSTATE\tTYPE\tPRIVATE IP\tPUBLIC IP\tZONE\tLAUNCHED")
+
+	for _, row := range r.Instances {
+		fields := row.fields()
+		for i, f := range fields {
+			if f == "" {
+				fields[i] = "-"
+			}
+		}
+
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// listFlags collects repeated flags, each of which can be a comma-separated list.
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlags) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+// tagFlags collects -t flags of the form KEY or KEY=VALUE.
+type tagFlags map[string]string
+
+func (t tagFlags) String() string {
+	var tags []string
+	for key, value := range t {
+		tags = append(tags, key+"="+value)
+	}
+
+	return strings.Join(tags, ",")
+}
+
+func (t tagFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if parts[0] == "" {
+		return errors.New("the tag key is empty")
+	}
+
+	t[parts[0]] = ""
+	if len(parts) == 2 {
+		t[parts[0]] = parts[1]
+	}
+
+	return nil
+}
+
+// timeFlag is a time given as a date, such as 2020-12-01, or in RFC 3339 format.
+type timeFlag struct {
+	time.Time
+}
+
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(value string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+
+	return errors.New("the time must be a date, such as 2020-12-01, or in RFC 3339 format, such as 2020-12-01T15:04:05Z")
 }
 
 func main() {
+	var states, instanceTypes listFlags
+	var after, before timeFlag
+	tags := tagFlags{}
+	flag.Var(&states, "s", "An instance state to select, such as running. Can be repeated")
+	flag.Var(tags, "t", "A tag the instances must have, as KEY or KEY=VALUE. Can be repeated")
+	flag.Var(&instanceTypes, "i", "An instance type to select, such as t2.micro. Can be repeated")
+	vpcID := flag.String("v", "", "The ID of the VPC the instances must be in")
+	flag.Var(&after, "after", "Select instances launched at or after this time")
+	flag.Var(&before, "before", "Select instances launched before this time")
+	format := flag.String("f", "text", "Print the instances as text, json, or csv")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" && *format != "csv" {
+		fmt.Println("The format must be text, json, or csv")
+		return
+	}
+
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		panic("configuration error, " + err.Error())
@@ -39,23 +348,32 @@ func main() {
 
 	client := ec2.NewFromConfig(cfg)
 
-	input := &ec2.DescribeInstancesInput{}
-
-	result, err := GetInstances(context.TODO(), client, input)
+	report, err := ListInstances(context.TODO(), client, InstanceFilter{
+		States:         states,
+		Tags:           tags,
+		InstanceTypes:  instanceTypes,
+		VpcID:          *vpcID,
+		LaunchedAfter:  after.Time,
+		LaunchedBefore: before.Time,
+	})
 	if err != nil {
 		fmt.Println("Got an error retrieving information about your Amazon EC2 instances:")
 		fmt.Println(err)
 		return
 	}
 
-	for _, r := range result.Reservations {
-		fmt.Println("Reservation ID: " + *r.ReservationId)
-		fmt.Println("Instance IDs:")
-		for _, i := range r.Instances {
-			fmt.Println("   " + *i.InstanceId)
-		}
+	switch *format {
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	case "csv":
+		err = report.WriteCSV(os.Stdout)
+	default:
+		err = report.WriteTable(os.Stdout)
+	}
 
-		fmt.Println("")
+	if err != nil {
+		fmt.Println("Got an error writing the instances:")
+		fmt.Println(err)
 	}
 }
 // snippet-end:[ec2.go-v2.DescribeInstances]
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
 )
 
 type EC2DescribeInstancesImpl struct{}
@@ -59,3 +64,144 @@ func TestDescribeInstances(t *testing.T) {
 		t.Log("")
 	}
 }
+
+func testInstances() *ec2fake.Service {
+	api := ec2fake.New()
+	launched := time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 12; i++ {
+		state := types.InstanceStateNameRunning
+		if i%3 == 0 {
+			state = types.InstanceStateNameStopped
+		}
+
+		api.AddInstance(api.Region, types.Instance{
+			State:            &types.InstanceState{Name: state},
+			InstanceType:     []types.InstanceType{types.InstanceTypeT2Micro, types.InstanceTypeM5Large}[i%2],
+			VpcId:            aws.String([]string{"vpc-1a2b3c4d", "vpc-5e6f7a8b"}[i/6]),
+			PrivateIpAddress: aws.String(fmt.Sprintf("10.0.0.%d", i+10)),
+			LaunchTime:       aws.Time(launched.Add(time.Duration(i) * 24 * time.Hour)),
+			Tags: []types.Tag{
+				{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("aws-docs-example-%d", i))},
+				{Key: aws.String("team"), Value: aws.String([]string{"web", "data"}[i%2])},
+			},
+		})
+	}
+
+	return api
+}
+
+// pagedAPI calls the fake with a small page size, and counts the calls.
+type pagedAPI struct {
+	*ec2fake.Service
+	calls int
+}
+
+func (p *pagedAPI) DescribeInstances(ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	p.calls++
+
+	input := *params
+	input.MaxResults = 5
+
+	return p.Service.DescribeInstances(ctx, &input, optFns...)
+}
+
+func TestGetInstancesPages(t *testing.T) {
+	api := &pagedAPI{Service: testInstances()}
+	input := &ec2.DescribeInstancesInput{}
+
+	result, err := GetInstances(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for _, r := range result.Reservations {
+		n += len(r.Instances)
+	}
+
+	if n != 12 || api.calls != 3 || input.NextToken != nil {
+		t.Errorf("got %d instances in %d calls, want 12 in 3", n, api.calls)
+	}
+}
+
+func TestListInstances(t *testing.T) {
+	api := &pagedAPI{Service: testInstances()}
+
+	report, err := ListInstances(context.Background(), api, InstanceFilter{
+		States:         []string{"running"},
+		Tags:           map[string]string{"team": "web", "Name": ""},
+		InstanceTypes:  []string{"t2.micro"},
+		VpcID:          "vpc-1a2b3c4d",
+		LaunchedAfter:  time.Date(2020, 12, 3, 0, 0, 0, 0, time.UTC),
+		LaunchedBefore: time.Date(2020, 12, 5, 9, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Instances 2 and 4 are running t2.micro web instances in the first VPC. Instance 4 was launched at LaunchedBefore.
+	if len(report.Instances) != 1 {
+		t.Fatalf("got %+v, want instance 2", report.Instances)
+	}
+
+	row := report.Instances[0]
+	if row.Name != "aws-docs-example-2" || row.State != "running" || row.PrivateIP != "10.0.0.12" || row.AvailabilityZone != "us-west-2a" {
+		t.Errorf("got %+v", row)
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "instance_id,name,state,instance_type,private_ip,public_ip,availability_zone,launch_time\n" +
+		row.InstanceID + ",aws-docs-example-2,running,t2.micro,10.0.0.12,,us-west-2a,2020-12-03T09:00:00Z\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := report.WriteTable(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "  -  ") {
+		t.Errorf("got\n%s\nwant a header and a row with - for the public IP", b.String())
+	}
+
+	b.Reset()
+	if err := report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded InstanceReport
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil || len(decoded.Instances) != 1 || decoded.Instances[0] != row {
+		t.Errorf("got %s, %v", b.String(), err)
+	}
+}
+
+func TestInstanceFlags(t *testing.T) {
+	tags := tagFlags{}
+	for _, value := range []string{"team=web", "Name"} {
+		if err := tags.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filters := InstanceFilter{Tags: tags}.Filters()
+	if len(filters) != 2 || aws.ToString(filters[0].Name) != "tag-key" || aws.ToString(filters[1].Name) != "tag:team" {
+		t.Errorf("got filters %+v", filters)
+	}
+
+	var launched timeFlag
+	if err := launched.Set("2020-12-01"); err != nil || !launched.Equal(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v, %v", launched, err)
+	}
+
+	if err := launched.Set("yesterday"); err == nil {
+		t.Error("expected an error for a time that isn't valid")
+	}
+}
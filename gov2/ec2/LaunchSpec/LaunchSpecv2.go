@@ -0,0 +1,514 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[ec2.go-v2.LaunchSpec]
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
+	"gopkg.in/yaml.v2"
+)
+
+// EC2RunInstancesAPI defines the interface for the RunInstances function.
+// We use this interface to test the function using a mocked service.
+type EC2RunInstancesAPI interface {
+	RunInstances(ctx context.Context,
+		params *ec2.RunInstancesInput,
+		optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error)
+}
+
+// LaunchSpec describes instances to launch. It's read from a JSON or YAML document,
+// with the keys in the json and yaml tags. Only imageId is required.
+type LaunchSpec struct {
+	// ImageID is the ID of the AMI, such as ami-e7527ed7.
+	ImageID string `json:"imageId" yaml:"imageId"`
+
+	// InstanceType is the instance type. The default is t2.micro.
+	InstanceType string `json:"instanceType" yaml:"instanceType"`
+
+	// SubnetID is the ID of the subnet to launch the instances in.
+	// Without it, they're launched in a default subnet of the default VPC.
+	SubnetID string `json:"subnetId" yaml:"subnetId"`
+
+	// SecurityGroupIDs are the IDs of the security groups of the instances.
+	SecurityGroupIDs []string `json:"securityGroupIds" yaml:"securityGroupIds"`
+
+	// KeyName is the name of the key pair to connect to the instances with.
+	KeyName string `json:"keyName" yaml:"keyName"`
+
+	// IamInstanceProfile is the name or the ARN of the IAM instance profile of the instances.
+	IamInstanceProfile string `json:"iamInstanceProfile" yaml:"iamInstanceProfile"`
+
+	// BlockDevices are the Amazon EBS volumes of the instances.
+	BlockDevices []BlockDevice `json:"blockDevices" yaml:"blockDevices"`
+
+	// UserDataFile is the file of user data, such as a script to run at launch.
+	// LoadLaunchSpec reads it into UserData. A relative path is relative to the directory of the spec.
+	UserDataFile string `json:"userDataFile" yaml:"userDataFile"`
+
+	// UserData is the user data, before it's base64-encoded.
+	UserData []byte `json:"-" yaml:"-"`
+
+	// Tags are the tags of the instances and their volumes.
+	Tags Tags `json:"tags" yaml:"tags"`
+
+	// Count is how many instances to launch. The default is 1.
+	Count int32 `json:"count" yaml:"count"`
+}
+
+// BlockDevice describes an Amazon EBS volume of an instance.
+type BlockDevice struct {
+	// DeviceName is the device name, such as /dev/xvda.
+	DeviceName string `json:"deviceName" yaml:"deviceName"`
+
+	// VolumeSize is the size of the volume, in GiB.
+	// Without it, the volume is the size of the snapshot or the AMI's volume.
+	VolumeSize int32 `json:"volumeSize" yaml:"volumeSize"`
+
+	// VolumeType is the volume type, such as gp2.
+	VolumeType string `json:"volumeType" yaml:"volumeType"`
+
+	// SnapshotID is the ID of the snapshot to create the volume from.
+	SnapshotID string `json:"snapshotId" yaml:"snapshotId"`
+
+	// Encrypted encrypts the volume.
+	Encrypted bool `json:"encrypted" yaml:"encrypted"`
+
+	// DeleteOnTermination deletes the volume when the instance is terminated.
+	// If it's false, the AMI's setting for the device applies.
+	DeleteOnTermination bool `json:"deleteOnTermination" yaml:"deleteOnTermination"`
+}
+
+// Tags are tags, by key. In a spec, a value can also be a number or a boolean,
+// such as 1234, which becomes a value of the same text.
+// YAML already reads such values as text, so only JSON needs UnmarshalJSON.
+type Tags map[string]string
+
+func (t *Tags) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+
+	*t = Tags{}
+
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			var v interface{}
+			_ = json.Unmarshal(value, &v)
+
+			switch v.(type) {
+			case float64, bool:
+				s = string(value)
+			default:
+				return fmt.Errorf("the value of the tag %s must be a string", key)
+			}
+		}
+
+		(*t)[key] = s
+	}
+
+	return nil
+}
+
+// Limits that Amazon EC2 puts on the values of a spec.
+const (
+	maxUserData  = 16 * 1024
+	maxTags      = 50
+	maxTagKey    = 128
+	maxTagValue  = 256
+	maxVolumeGiB = 16384
+)
+
+// SpecError lists the problems with a launch spec.
+type SpecError struct {
+	Problems []string
+}
+
+func (e *SpecError) Error() string {
+	return "invalid launch spec: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the spec for problems that Amazon EC2 would reject, without calling it.
+// It can't check that the AMI, subnet, security groups, key pair, or instance profile exist;
+// LaunchInstances with dryRun set checks those.
+// Output:
+//     If the spec is valid, nil.
+//     Otherwise, a SpecError with every problem.
+func (s *LaunchSpec) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !strings.HasPrefix(s.ImageID, "ami-") {
+		add("imageId must be the ID of an AMI, such as ami-e7527ed7")
+	}
+
+	if s.InstanceType != "" && !knownInstanceType(types.InstanceType(s.InstanceType)) {
+		add("instanceType %q isn't an instance type", s.InstanceType)
+	}
+
+	if s.SubnetID != "" && !strings.HasPrefix(s.SubnetID, "subnet-") {
+		add("subnetId %q isn't the ID of a subnet", s.SubnetID)
+	}
+
+	for _, id := range s.SecurityGroupIDs {
+		if !strings.HasPrefix(id, "sg-") {
+			add("securityGroupIds: %q isn't the ID of a security group", id)
+		}
+	}
+
+	devices := map[string]bool{}
+	for i, d := range s.BlockDevices {
+		switch {
+		case d.DeviceName == "":
+			add("blockDevices[%d] needs a deviceName", i)
+		case devices[d.DeviceName]:
+			add("blockDevices[%d] repeats the device %s", i, d.DeviceName)
+		}
+
+		devices[d.DeviceName] = true
+
+		if d.VolumeSize < 0 || d.VolumeSize > maxVolumeGiB {
+			add("blockDevices[%d] volumeSize must be from 1 to %d GiB", i, maxVolumeGiB)
+		}
+
+		if d.VolumeType != "" && !knownVolumeType(types.VolumeType(d.VolumeType)) {
+			add("blockDevices[%d] volumeType %q isn't a volume type", i, d.VolumeType)
+		}
+	}
+
+	if len(s.UserData) > maxUserData {
+		add("the user data is %d bytes, and can be at most %d", len(s.UserData), maxUserData)
+	}
+
+	if len(s.Tags) > maxTags {
+		add("there are %d tags, and there can be at most %d", len(s.Tags), maxTags)
+	}
+
+	for _, key := range s.Tags.keys() {
+		switch {
+		case key == "":
+			add("a tag key is empty")
+		case len(key) > maxTagKey:
+			add("the tag key %s is longer than %d characters", key, maxTagKey)
+		case strings.HasPrefix(strings.ToLower(key), "aws:"):
+			add("the tag key %s uses the reserved prefix aws:", key)
+		}
+
+		if len(s.Tags[key]) > maxTagValue {
+			add("the value of the tag %s is longer than %d characters", key, maxTagValue)
+		}
+	}
+
+	if s.Count < 0 {
+		add("count must be at least 1")
+	}
+
+	if len(problems) > 0 {
+		return &SpecError{Problems: problems}
+	}
+
+	return nil
+}
+
+func knownInstanceType(t types.InstanceType) bool {
+	for _, known := range t.Values() {
+		if t == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func knownVolumeType(t types.VolumeType) bool {
+	for _, known := range t.Values() {
+		if t == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keys returns the tag keys in order.
+func (t Tags) keys() []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Input validates the spec, and returns the input for RunInstances that launches Count instances,
+// with the user data base64-encoded, and the tags on the instances and their volumes.
+// Output:
+//     If success, the input and nil.
+//     Otherwise, nil and a SpecError.
+func (s *LaunchSpec) Input() (*ec2.RunInstancesInput, error) {
+	err := s.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	count := s.Count
+	if count == 0 {
+		count = 1
+	}
+
+	input := &ec2.RunInstancesInput{
+		ImageId:          aws.String(s.ImageID),
+		InstanceType:     types.InstanceTypeT2Micro,
+		SecurityGroupIds: s.SecurityGroupIDs,
+		MinCount:         count,
+		MaxCount:         count,
+	}
+
+	if s.InstanceType != "" {
+		input.InstanceType = types.InstanceType(s.InstanceType)
+	}
+
+	if s.SubnetID != "" {
+		input.SubnetId = aws.String(s.SubnetID)
+	}
+
+	if s.KeyName != "" {
+		input.KeyName = aws.String(s.KeyName)
+	}
+
+	if strings.HasPrefix(s.IamInstanceProfile, "arn:") {
+		input.IamInstanceProfile = &types.IamInstanceProfileSpecification{Arn: aws.String(s.IamInstanceProfile)}
+	} else if s.IamInstanceProfile != "" {
+		input.IamInstanceProfile = &types.IamInstanceProfileSpecification{Name: aws.String(s.IamInstanceProfile)}
+	}
+
+	for _, d := range s.BlockDevices {
+		ebs := &types.EbsBlockDevice{
+			VolumeSize:          d.VolumeSize,
+			VolumeType:          types.VolumeType(d.VolumeType),
+			Encrypted:           d.Encrypted,
+			DeleteOnTermination: d.DeleteOnTermination,
+		}
+
+		if d.SnapshotID != "" {
+			ebs.SnapshotId = aws.String(d.SnapshotID)
+		}
+
+		input.BlockDeviceMappings = append(input.BlockDeviceMappings, types.BlockDeviceMapping{
+			DeviceName: aws.String(d.DeviceName),
+			Ebs:        ebs,
+		})
+	}
+
+	if len(s.UserData) > 0 {
+		input.UserData = aws.String(base64.StdEncoding.EncodeToString(s.UserData))
+	}
+
+	if len(s.Tags) > 0 {
+		var tags []types.Tag
+		for _, key := range s.Tags.keys() {
+			tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(s.Tags[key])})
+		}
+
+		input.TagSpecifications = []types.TagSpecification{
+			{ResourceType: types.ResourceTypeInstance, Tags: tags},
+			{ResourceType: types.ResourceTypeVolume, Tags: tags},
+		}
+	}
+
+	return input, nil
+}
+
+// ReadLaunchSpec reads a launch spec, in JSON or YAML.
+// Unknown keys are errors, so that a misspelled key isn't ignored.
+// Inputs:
+//     r is where to read the spec from.
+//     format is json or yaml.
+// Output:
+//     If success, the spec and nil. UserData is empty, as the spec doesn't say where UserDataFile is relative to.
+//     Otherwise, nil and an error for an unknown format, a malformed spec, or from reading r.
+func ReadLaunchSpec(r io.Reader, format string) (*LaunchSpec, error) {
+	spec := &LaunchSpec{}
+
+	switch format {
+	case "json":
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(spec)
+		if err != nil {
+			return nil, err
+		}
+	case "yaml":
+		doc, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		// Strict decoding also rejects keys that appear more than once
+		err = yaml.UnmarshalStrict(doc, spec)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	return spec, nil
+}
+
+// LoadLaunchSpec reads a launch spec from a file, and the user data from its UserDataFile.
+// A file whose name ends in .yaml or .yml is YAML, and any other file is JSON.
+// Inputs:
+//     file is the name of the file.
+// Output:
+//     If success, the spec and nil.
+//     Otherwise, nil and an error from ReadLaunchSpec, or from reading either file.
+func LoadLaunchSpec(file string) (*LaunchSpec, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := "json"
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		format = "yaml"
+	}
+
+	spec, err := ReadLaunchSpec(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	if spec.UserDataFile != "" {
+		userDataFile := spec.UserDataFile
+		if !filepath.IsAbs(userDataFile) {
+			userDataFile = filepath.Join(filepath.Dir(file), userDataFile)
+		}
+
+		spec.UserData, err = ioutil.ReadFile(userDataFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return spec, nil
+}
+
+// LaunchInstances launches the Amazon Elastic Compute Cloud (Amazon EC2) instances that a spec describes.
+// It validates the spec before it calls RunInstances, so an invalid spec never reaches Amazon EC2.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     spec describes the instances.
+//     dryRun only checks, with the DryRun flag of RunInstances, that the launch would succeed.
+// Output:
+//     If success, a RunInstancesOutput object containing the result of the service call and nil.
+//     If dryRun is set and the launch would succeed, nil and nil.
+//     Otherwise, nil and a SpecError, or an error from the call to RunInstances.
+func LaunchInstances(c context.Context, api EC2RunInstancesAPI, spec *LaunchSpec, dryRun bool) (*ec2.RunInstancesOutput, error) {
+	input, err := spec.Input()
+	if err != nil {
+		return nil, err
+	}
+
+	input.DryRun = dryRun
+
+	result, err := api.RunInstances(c, input)
+
+	var apiErr smithy.APIError
+	if dryRun && errors.As(err, &apiErr) && apiErr.ErrorCode() == "DryRunOperation" {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func main() {
+	specFile := flag.String("s", "", "A JSON or YAML file that describes the instances to launch")
+	dryRun := flag.Bool("d", false, "Check the launch spec and your permissions without launching anything")
+	wait := flag.Bool("w", false, "Wait until the instances are running")
+	timeout := flag.Duration("t", 10*time.Minute, "How long to wait for the instances")
+	flag.Parse()
+
+	if *specFile == "" {
+		fmt.Println("You must supply a launch spec (-s FILE)")
+		return
+	}
+
+	spec, err := LoadLaunchSpec(*specFile)
+	if err != nil {
+		fmt.Println("Got an error reading the launch spec:")
+		fmt.Println(err)
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := ec2.NewFromConfig(cfg)
+
+	result, err := LaunchInstances(context.TODO(), client, spec, *dryRun)
+	if err != nil {
+		fmt.Println("Got an error creating the instances:")
+		fmt.Println(err)
+		return
+	}
+
+	if *dryRun {
+		fmt.Println("The launch spec is valid, and you have permission to launch the instances")
+		return
+	}
+
+	// Display the IDs before waiting, so that you can find the instances even if the wait fails
+	var ids []string
+	for _, i := range result.Instances {
+		ids = append(ids, aws.ToString(i.InstanceId))
+		fmt.Println("Created instance with ID " + aws.ToString(i.InstanceId))
+	}
+
+	if *wait {
+		err = ec2wait.WaitForRunning(context.TODO(), client, ids, ec2wait.Options{Timeout: *timeout})
+		if err != nil {
+			fmt.Println("Got an error waiting for the instances:")
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Println("The instances are running")
+	}
+}
+
+// snippet-end:[ec2.go-v2.LaunchSpec]
@@ -0,0 +1,201 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
+)
+
+func TestLoadLaunchSpec(t *testing.T) {
+	spec, err := LoadLaunchSpec("launch-spec.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(spec.UserData), "#!/bin/bash") {
+		t.Errorf("got user data %q, want the script in user-data.sh", spec.UserData)
+	}
+
+	// The same spec, in JSON
+	doc := `{
+		"imageId": "ami-e7527ed7",
+		"instanceType": "t2.micro",
+		"subnetId": "subnet-0123456789abcdef0",
+		"securityGroupIds": ["sg-0123456789abcdef0"],
+		"keyName": "aws-docs-example-key",
+		"iamInstanceProfile": "aws-docs-example-profile",
+		"blockDevices": [{"deviceName": "/dev/xvda", "volumeSize": 20, "volumeType": "gp2", "encrypted": true, "deleteOnTermination": true}],
+		"userDataFile": "user-data.sh",
+		"tags": {"Name": "aws-docs-example", "CostCenter": 1234},
+		"count": 2
+	}`
+
+	want, err := ReadLaunchSpec(strings.NewReader(doc), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec.UserData = nil
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", spec, want)
+	}
+}
+
+func TestReadLaunchSpecYAML(t *testing.T) {
+	spec, err := ReadLaunchSpec(strings.NewReader(`---
+"imageId": 'ami-e7527ed7'   # a quoted key and value
+securityGroupIds:
+- sg-0123456789abcdef0
+-   sg-0fedcba9876543210
+blockDevices:
+  -
+    deviceName: "/dev/sdf"
+    snapshotId: snap-0123456789abcdef0
+tags:
+  Name: 'it''s # not a comment'
+  Enabled: true
+count: 3
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &LaunchSpec{
+		ImageID:          "ami-e7527ed7",
+		SecurityGroupIDs: []string{"sg-0123456789abcdef0", "sg-0fedcba9876543210"},
+		BlockDevices:     []BlockDevice{{DeviceName: "/dev/sdf", SnapshotID: "snap-0123456789abcdef0"}},
+		Tags:             Tags{"Name": "it's # not a comment", "Enabled": "true"},
+		Count:            3,
+	}
+
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", spec, want)
+	}
+
+	for _, doc := range []string{
+		"image: ami-e7527ed7",
+		"imageId: ami-e7527ed7\n  count: 2",
+		"tags:\n\tName: example",
+		"imageId: ami-e7527ed7\nimageId: ami-e7527ed7",
+		"securityGroupIds: [sg-0123456789abcdef0",
+		"securityGroupIds: sg-0123456789abcdef0",
+		"count: two",
+	} {
+		if _, err := ReadLaunchSpec(strings.NewReader(doc), "yaml"); err == nil {
+			t.Errorf("expected an error for %q", doc)
+		}
+	}
+}
+
+func TestLaunchSpecValidate(t *testing.T) {
+	spec := &LaunchSpec{
+		ImageID:          "e7527ed7",
+		InstanceType:     "t2.huge",
+		SecurityGroupIDs: []string{"default"},
+		BlockDevices:     []BlockDevice{{DeviceName: "/dev/xvda", VolumeType: "gp9"}, {DeviceName: "/dev/xvda", VolumeSize: 20000}},
+		UserData:         make([]byte, 16*1024+1),
+		Tags:             Tags{"aws:createdBy": "me", "": "empty"},
+		Count:            -1,
+	}
+
+	err := spec.Validate()
+
+	var specErr *SpecError
+	if !errors.As(err, &specErr) {
+		t.Fatalf("got %v, want a SpecError", err)
+	}
+
+	if len(specErr.Problems) != 10 {
+		t.Errorf("got %d problems, want 10:\n%s", len(specErr.Problems), strings.Join(specErr.Problems, "\n"))
+	}
+
+	if err := (&LaunchSpec{ImageID: "ami-e7527ed7"}).Validate(); err != nil {
+		t.Errorf("got %v for a spec with only an AMI", err)
+	}
+}
+
+// recordingAPI is the fake, except that it keeps the input of each call to RunInstances.
+type recordingAPI struct {
+	*ec2fake.Service
+	inputs []*ec2.RunInstancesInput
+}
+
+func (r *recordingAPI) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	r.inputs = append(r.inputs, params)
+
+	return r.Service.RunInstances(ctx, params, optFns...)
+}
+
+func TestLaunchInstances(t *testing.T) {
+	api := &recordingAPI{Service: ec2fake.New()}
+
+	spec, err := LoadLaunchSpec("launch-spec.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key pair doesn't exist yet
+	_, err = LaunchInstances(context.Background(), api, spec, true)
+	if err == nil || !strings.Contains(err.Error(), "InvalidKeyPair.NotFound") {
+		t.Errorf("got %v, want InvalidKeyPair.NotFound", err)
+	}
+
+	api.AddKeyPair("us-west-2", "aws-docs-example-key")
+
+	result, err := LaunchInstances(context.Background(), api, spec, true)
+	if result != nil || err != nil {
+		t.Errorf("got %v, %v for a dry run, want nil and nil", result, err)
+	}
+
+	result, err = LaunchInstances(context.Background(), api, spec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := api.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Instances) != 2 || len(output.Reservations) != 1 {
+		t.Errorf("got %d instances in %d reservations, want the 2 instances of one launch", len(result.Instances), len(output.Reservations))
+	}
+
+	input := api.inputs[len(api.inputs)-1]
+
+	userData, err := base64.StdEncoding.DecodeString(aws.ToString(input.UserData))
+	if err != nil || string(userData) != string(spec.UserData) {
+		t.Errorf("got user data %q, %v", userData, err)
+	}
+
+	if aws.ToString(input.IamInstanceProfile.Name) != "aws-docs-example-profile" || input.BlockDeviceMappings[0].Ebs.VolumeSize != 20 {
+		t.Errorf("got %+v and %+v", input.IamInstanceProfile, input.BlockDeviceMappings)
+	}
+
+	if len(input.TagSpecifications) != 2 || len(input.TagSpecifications[0].Tags) != 2 ||
+		aws.ToString(input.TagSpecifications[0].Tags[0].Key) != "CostCenter" {
+		t.Errorf("got %+v", input.TagSpecifications)
+	}
+
+	// An invalid spec never reaches Amazon EC2
+	calls := len(api.inputs)
+	spec.Count = -1
+
+	_, err = LaunchInstances(context.Background(), api, spec, true)
+
+	var specErr *SpecError
+	if !errors.As(err, &specErr) || len(api.inputs) != calls {
+		t.Errorf("got %v after %d calls, want a SpecError and no call", err, len(api.inputs)-calls)
+	}
+}
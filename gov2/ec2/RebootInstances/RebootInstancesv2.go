@@ -8,10 +8,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
 )
 
 // EC2RebootInstancesAPI defines the interface for the RebootInstances function.
@@ -43,11 +47,121 @@ func RebootInstance(c context.Context, api EC2RebootInstancesAPI, input *ec2.Reb
 	return resp, err
 }
 
+// EC2DescribeInstanceStatusAPI defines the interface for the DescribeInstanceStatus function.
+// We use this interface to test the function using a mocked service.
+type EC2DescribeInstanceStatusAPI interface {
+	DescribeInstanceStatus(ctx context.Context,
+		params *ec2.DescribeInstanceStatusInput,
+		optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error)
+}
+
+// EC2RebootInstancesWaitAPI defines the interface for the RebootInstances and DescribeInstanceStatus functions.
+// We use this interface to test the functions using a mocked service.
+type EC2RebootInstancesWaitAPI interface {
+	EC2RebootInstancesAPI
+	EC2DescribeInstanceStatusAPI
+}
+
+// WaitForStatusOK waits for the status checks of Amazon Elastic Compute Cloud (Amazon EC2) instances to pass.
+// It checks the instances with DescribeInstanceStatus, waiting longer between each check, up to a limit.
+// Impaired checks can recover, such as while an instance boots, so it keeps waiting for them until the time is up.
+// Instances that are stopping, stopped, shutting down, or terminated fail right away.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     ids are the IDs of the instances.
+//     opts controls how long to wait, and how often to check.
+// Output:
+//     If the instance and system status checks of every instance are ok, nil.
+//     If some aren't, a TransitionError with their last states: the instance state if the instance isn't running,
+//     and otherwise the status, such as initializing or impaired.
+//     Otherwise, an error from the call to DescribeInstanceStatus.
+func WaitForStatusOK(c context.Context, api EC2DescribeInstanceStatusAPI, ids []string, opts ec2wait.Options) error {
+	failed := []string{
+		string(types.InstanceStateNameStopping),
+		string(types.InstanceStateNameStopped),
+		string(types.InstanceStateNameShuttingDown),
+		string(types.InstanceStateNameTerminated),
+	}
+
+	return ec2wait.Wait(c, ids, string(types.SummaryStatusOk), failed, opts, func(ids []string) (map[string]string, error) {
+		output, err := api.DescribeInstanceStatus(c, &ec2.DescribeInstanceStatusInput{
+			InstanceIds:         ids,
+			IncludeAllInstances: true,
+		})
+
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound" {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		states := map[string]string{}
+		for _, s := range output.InstanceStatuses {
+			id := aws.ToString(s.InstanceId)
+
+			switch {
+			case s.InstanceState != nil && s.InstanceState.Name != types.InstanceStateNameRunning:
+				states[id] = string(s.InstanceState.Name)
+			case s.InstanceStatus == nil || s.SystemStatus == nil:
+				states[id] = "unknown"
+			case s.InstanceStatus.Status != types.SummaryStatusOk:
+				states[id] = string(s.InstanceStatus.Status)
+			default:
+				states[id] = string(s.SystemStatus.Status)
+			}
+		}
+
+		return states, nil
+	})
+}
+
+// RebootInstancesAndWaitForStatusOK requests a reboot of Amazon Elastic Compute Cloud (Amazon EC2) instances,
+// and then waits for their status checks to pass.
+// It can't confirm that the instances rebooted: an instance stays running while it reboots,
+// and its status checks might pass before the reboot starts, or not change at all.
+// It waits for MinDelay before the first check, to give Amazon EC2 time to start the reboot.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method calls.
+//     input defines the input arguments to the service call.
+//     opts controls how long to wait, and how often to check.
+// Output:
+//     If success, a RebootInstancesOutput object containing the result of the service call and nil.
+//     If the checks of some instances didn't pass, the RebootInstancesOutput object and a TransitionError.
+//     Otherwise, nil and an error from the call to RebootInstances or DescribeInstanceStatus, or from the context.
+func RebootInstancesAndWaitForStatusOK(c context.Context, api EC2RebootInstancesWaitAPI, input *ec2.RebootInstancesInput, opts ec2wait.Options) (*ec2.RebootInstancesOutput, error) {
+	resp, err := RebootInstance(c, api, input)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = opts.WithDefaults()
+	if err := opts.Sleep(c, opts.MinDelay); err != nil {
+		return nil, err
+	}
+
+	err = WaitForStatusOK(c, api, input.InstanceIds, opts)
+
+	var transitionErr *ec2wait.TransitionError
+	if err != nil && !errors.As(err, &transitionErr) {
+		return nil, err
+	}
+
+	return resp, err
+}
+
 func main() {
-	instanceID := flag.String("i", "", "The ID of the instance to reboot")
+	var instanceIDs ec2wait.ListFlags
+	flag.Var(&instanceIDs, "i", "The ID of an instance to reboot. Can be repeated")
+	wait := flag.Bool("w", false, "After requesting the reboot, wait until the status checks of the instances pass")
+	timeout := flag.Duration("t", 10*time.Minute, "How long to wait for the instances")
 	flag.Parse()
 
-	if *instanceID == "" {
+	if len(instanceIDs) == 0 {
 		fmt.Println("You must supply an instance ID (-i INSTANCE-ID")
 		return
 	}
@@ -60,20 +174,29 @@ func main() {
 	client := ec2.NewFromConfig(cfg)
 
 	input := &ec2.RebootInstancesInput{
-		InstanceIds: []string{
-			*instanceID,
-		},
-		DryRun: true,
+		InstanceIds: instanceIDs,
+		DryRun:      true,
+	}
+
+	if *wait {
+		_, err = RebootInstancesAndWaitForStatusOK(context.TODO(), client, input, ec2wait.Options{Timeout: *timeout})
+	} else {
+		_, err = RebootInstance(context.TODO(), client, input)
 	}
 
-	_, err = RebootInstance(context.TODO(), client, input)
 	if err != nil {
 		fmt.Println("Got an error rebooting the instance")
 		fmt.Println(err)
 		return
 	}
 
-	fmt.Println("Rebooted instance with ID " + *instanceID)
+	for _, id := range instanceIDs {
+		fmt.Println("Rebooted instance with ID " + id)
+	}
+
+	if *wait {
+		fmt.Println("The status checks of the instances passed")
+	}
 }
 
 // snippet-end:[ec2.go-v2.RebootInstances]
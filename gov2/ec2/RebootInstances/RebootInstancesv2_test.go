@@ -5,11 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
 )
 
 type mockDryRunError struct {
@@ -92,3 +97,107 @@ func TestRebootInstances(t *testing.T) {
 
 	t.Log("Rebooted instance with ID " + globalConfig.InstanceID)
 }
+
+func TestRebootInstancesAndWaitForStatusOK(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+
+	var ids []string
+	for i := 0; i < 150; i++ {
+		ids = append(ids, api.AddInstance("us-west-2", types.Instance{}))
+	}
+
+	// The checks of the new instances pass after 2 minutes
+	clock.Current = clock.Current.Add(2 * time.Minute)
+
+	opts := clock.Options(ec2wait.Options{MinDelay: 30 * time.Second, MaxDelay: time.Minute})
+
+	_, err := RebootInstancesAndWaitForStatusOK(context.Background(), api, &ec2.RebootInstancesInput{InstanceIds: ids, DryRun: true}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reboot resets the checks for 2 minutes: 30 + 30 + 60 seconds covers it
+	want := []time.Duration{30 * time.Second, 30 * time.Second, time.Minute}
+	if len(clock.Slept) != 3 || clock.Slept[0] != want[0] || clock.Slept[1] != want[1] || clock.Slept[2] != want[2] {
+		t.Errorf("got delays %v, want %v", clock.Slept, want)
+	}
+}
+
+// impairedAPI reports impaired status checks for an instance until a time
+type impairedAPI struct {
+	*ec2fake.Service
+	id    string
+	until time.Time
+}
+
+func (i impairedAPI) DescribeInstanceStatus(ctx context.Context,
+	params *ec2.DescribeInstanceStatusInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+	output, err := i.Service.DescribeInstanceStatus(ctx, params, optFns...)
+	if err != nil || !i.Now().Before(i.until) {
+		return output, err
+	}
+
+	for _, s := range output.InstanceStatuses {
+		if aws.ToString(s.InstanceId) == i.id {
+			s.SystemStatus.Status = types.SummaryStatusImpaired
+		}
+	}
+
+	return output, nil
+}
+
+func TestWaitForStatusOKImpaired(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+	id := api.AddInstance("us-west-2", types.Instance{})
+	opts := clock.Options(ec2wait.Options{Timeout: 5 * time.Minute})
+
+	// Impaired checks that recover within the timeout pass
+	impaired := impairedAPI{Service: api, id: id, until: clock.Current.Add(2 * time.Minute)}
+
+	err := WaitForStatusOK(context.Background(), impaired, []string{id}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// and ones that don't fail at the timeout
+	start := clock.Current
+	impaired.until = clock.Current.Add(time.Hour)
+
+	err = WaitForStatusOK(context.Background(), impaired, []string{id}, opts)
+
+	var transitionErr *ec2wait.TransitionError
+	if !errors.As(err, &transitionErr) || transitionErr.States[id] != "impaired" {
+		t.Errorf("got %v, want a TransitionError with the impaired instance", err)
+	}
+
+	if waited := clock.Current.Sub(start); waited != 5*time.Minute {
+		t.Errorf("waited %s, want the 5 minute timeout", waited)
+	}
+}
+
+func TestWaitForStatusOK(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+
+	stuck := api.AddInstance("us-west-2", types.Instance{})
+	api.Hold(stuck)
+	stopped := api.AddInstance("us-west-2", types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameStopped}})
+	ok := api.AddInstance("us-west-2", types.Instance{})
+
+	opts := clock.Options(ec2wait.Options{Timeout: 5 * time.Minute})
+
+	err := WaitForStatusOK(context.Background(), api, []string{stuck, stopped, ok}, opts)
+
+	var transitionErr *ec2wait.TransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("got %v, want a TransitionError", err)
+	}
+
+	if len(transitionErr.States) != 2 || transitionErr.States[stuck] != "initializing" || transitionErr.States[stopped] != "stopped" {
+		t.Errorf("got %v", transitionErr.States)
+	}
+
+	if !strings.Contains(err.Error(), "2 instances didn't reach ok") {
+		t.Errorf("got %q", err)
+	}
+}
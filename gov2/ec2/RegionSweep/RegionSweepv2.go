@@ -0,0 +1,427 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[ec2.go-v2.RegionSweep]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// EC2SweepAPI defines the interface for the DescribeRegions, DescribeInstances, DescribeAddresses,
+// DescribeKeyPairs, and DescribeVpcEndpointConnections functions.
+// We use this interface to test the functions using a mocked service.
+type EC2SweepAPI interface {
+	DescribeRegions(ctx context.Context,
+		params *ec2.DescribeRegionsInput,
+		optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+
+	DescribeInstances(ctx context.Context,
+		params *ec2.DescribeInstancesInput,
+		optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+
+	DescribeAddresses(ctx context.Context,
+		params *ec2.DescribeAddressesInput,
+		optFns ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error)
+
+	DescribeKeyPairs(ctx context.Context,
+		params *ec2.DescribeKeyPairsInput,
+		optFns ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error)
+
+	DescribeVpcEndpointConnections(ctx context.Context,
+		params *ec2.DescribeVpcEndpointConnectionsInput,
+		optFns ...func(*ec2.Options)) (*ec2.DescribeVpcEndpointConnectionsOutput, error)
+}
+
+// GetRegions retrieves the names of the AWS Regions that are enabled for your account.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+// Output:
+//     If successful, the Region names, in alphabetical order, and nil.
+//     Otherwise, nil and an error from the call to DescribeRegions.
+func GetRegions(c context.Context, api EC2SweepAPI) ([]string, error) {
+	output, err := api.DescribeRegions(c, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, r := range output.Regions {
+		names = append(names, aws.ToString(r.RegionName))
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Resource is one resource that a sweep found.
+type Resource struct {
+	Region string `json:"region"`
+	// Type is the kind of resource, such as instance or key-pair.
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// Name is the value of the resource's Name tag, or the name of a key pair.
+	Name string `json:"name,omitempty"`
+	// State is the state of an instance or VPC endpoint connection, or the IP address of an Elastic IP address.
+	State string `json:"state,omitempty"`
+}
+
+// Describer lists the resources of one kind in a Region.
+// It must pass WithRegion(region) to each call.
+type Describer func(c context.Context, api EC2SweepAPI, region string) ([]Resource, error)
+
+// WithRegion returns an option that sends a call to the Region.
+func WithRegion(region string) func(*ec2.Options) {
+	return func(o *ec2.Options) {
+		o.Region = region
+	}
+}
+
+func nameTag(tags []types.Tag) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == "Name" {
+			return aws.ToString(tag.Value)
+		}
+	}
+
+	return ""
+}
+
+// Describers are the operations that a sweep can run, by name.
+var Describers = map[string]Describer{
+	"DescribeInstances": func(c context.Context, api EC2SweepAPI, region string) ([]Resource, error) {
+		var resources []Resource
+		input := &ec2.DescribeInstancesInput{}
+
+		for {
+			output, err := api.DescribeInstances(c, input, WithRegion(region))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, r := range output.Reservations {
+				for _, instance := range r.Instances {
+					resources = append(resources, Resource{
+						Region: region,
+						Type:   "instance",
+						ID:     aws.ToString(instance.InstanceId),
+						Name:   nameTag(instance.Tags),
+						State:  string(instance.State.Name),
+					})
+				}
+			}
+
+			if output.NextToken == nil {
+				return resources, nil
+			}
+
+			input.NextToken = output.NextToken
+		}
+	},
+
+	"DescribeAddresses": func(c context.Context, api EC2SweepAPI, region string) ([]Resource, error) {
+		output, err := api.DescribeAddresses(c, &ec2.DescribeAddressesInput{}, WithRegion(region))
+		if err != nil {
+			return nil, err
+		}
+
+		var resources []Resource
+		for _, address := range output.Addresses {
+			resources = append(resources, Resource{
+				Region: region,
+				Type:   "address",
+				ID:     aws.ToString(address.AllocationId),
+				Name:   nameTag(address.Tags),
+				State:  aws.ToString(address.PublicIp),
+			})
+		}
+
+		return resources, nil
+	},
+
+	"DescribeKeyPairs": func(c context.Context, api EC2SweepAPI, region string) ([]Resource, error) {
+		output, err := api.DescribeKeyPairs(c, &ec2.DescribeKeyPairsInput{}, WithRegion(region))
+		if err != nil {
+			return nil, err
+		}
+
+		var resources []Resource
+		for _, key := range output.KeyPairs {
+			resources = append(resources, Resource{
+				Region: region,
+				Type:   "key-pair",
+				ID:     aws.ToString(key.KeyPairId),
+				Name:   aws.ToString(key.KeyName),
+			})
+		}
+
+		return resources, nil
+	},
+
+	"DescribeVpcEndpointConnections": func(c context.Context, api EC2SweepAPI, region string) ([]Resource, error) {
+		var resources []Resource
+		input := &ec2.DescribeVpcEndpointConnectionsInput{}
+
+		for {
+			output, err := api.DescribeVpcEndpointConnections(c, input, WithRegion(region))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, connection := range output.VpcEndpointConnections {
+				resources = append(resources, Resource{
+					Region: region,
+					Type:   "vpc-endpoint-connection",
+					ID:     aws.ToString(connection.VpcEndpointId),
+					Name:   aws.ToString(connection.ServiceId),
+					State:  string(connection.VpcEndpointState),
+				})
+			}
+
+			if output.NextToken == nil {
+				return resources, nil
+			}
+
+			input.NextToken = output.NextToken
+		}
+	},
+}
+
+// DescriberNames returns the names of the Describers, in alphabetical order.
+func DescriberNames() []string {
+	var names []string
+	for name := range Describers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// SweepError is an error from one operation in one Region.
+type SweepError struct {
+	Region    string `json:"region"`
+	Operation string `json:"operation"`
+	Err       error  `json:"-"`
+}
+
+func (e *SweepError) Error() string {
+	return e.Region + ": " + e.Operation + ": " + e.Err.Error()
+}
+
+func (e *SweepError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON includes the message of the error.
+func (e *SweepError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"region":    e.Region,
+		"operation": e.Operation,
+		"error":     e.Err.Error(),
+	})
+}
+
+// SweepResult holds the resources that a sweep found in every Region, and the errors it got.
+type SweepResult struct {
+	Resources []Resource    `json:"resources"`
+	Errors    []*SweepError `json:"errors,omitempty"`
+}
+
+// SweepOptions configures Sweep. Zero values select the defaults.
+type SweepOptions struct {
+	// Regions are the Regions to sweep. The default is every enabled Region, from GetRegions.
+	Regions []string
+
+	// Operations are the names of the Describers to run in each Region. The default is all of them.
+	Operations []string
+
+	// Concurrency is the most calls in progress at once. The default is 10.
+	Concurrency int
+}
+
+// Sweep runs the describe operations in each Region concurrently, and merges what they find.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method calls.
+//     opts configures the sweep.
+// Output:
+//     If successful, the resources, sorted by Region, type, and ID,
+//     along with the errors from any Region where an operation failed, and nil.
+//     Otherwise, nil and an error, if an operation name isn't valid or the Regions couldn't be listed.
+func Sweep(c context.Context, api EC2SweepAPI, opts SweepOptions) (*SweepResult, error) {
+	if len(opts.Operations) == 0 {
+		opts.Operations = DescriberNames()
+	}
+
+	for _, name := range opts.Operations {
+		if Describers[name] == nil {
+			return nil, errors.New("there is no operation named " + name)
+		}
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 10
+	}
+
+	if len(opts.Regions) == 0 {
+		regions, err := GetRegions(c, api)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Regions = regions
+	}
+
+	result := &SweepResult{Resources: []Resource{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	// slots holds one token for each call that can be made now
+	slots := make(chan struct{}, opts.Concurrency)
+
+	for _, region := range opts.Regions {
+		for _, name := range opts.Operations {
+			wg.Add(1)
+
+			go func(region, name string) {
+				defer wg.Done()
+
+				slots <- struct{}{}
+				defer func() { <-slots }()
+
+				resources, err := Describers[name](c, api, region)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err != nil {
+					result.Errors = append(result.Errors, &SweepError{Region: region, Operation: name, Err: err})
+					return
+				}
+
+				result.Resources = append(result.Resources, resources...)
+			}(region, name)
+		}
+	}
+
+	wg.Wait()
+
+	sort.Slice(result.Resources, func(i, j int) bool {
+		a, b := result.Resources[i], result.Resources[j]
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+
+		return a.ID < b.ID
+	})
+
+	sort.Slice(result.Errors, func(i, j int) bool {
+		a, b := result.Errors[i], result.Errors[j]
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+
+		return a.Operation < b.Operation
+	})
+
+	return result, nil
+}
+
+// WriteTable writes the resources as a table, one row per resource.
+func WriteTable(w io.Writer, resources []Resource) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tTYPE\tID\tNAME\tSTATE")
+
+	for _, r := range resources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Region, r.Type, r.ID, r.Name, r.State)
+	}
+
+	return tw.Flush()
+}
+
+// listFlags collects repeated flags, each of which can be a comma-separated list.
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlags) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	var regions, operations listFlags
+	flag.Var(&regions, "r", "A Region to sweep. Can be repeated. The default is every enabled Region")
+	flag.Var(&operations, "o", "An operation to run in each Region: "+strings.Join(DescriberNames(), ", ")+". Can be repeated. The default is all of them")
+	format := flag.String("f", "table", "The output format: table or json")
+	concurrency := flag.Int("n", 10, "The most calls in progress at once")
+	flag.Parse()
+
+	if *format != "table" && *format != "json" {
+		fmt.Println("The output format must be table or json")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := ec2.NewFromConfig(cfg)
+
+	result, err := Sweep(context.TODO(), client, SweepOptions{
+		Regions:     regions,
+		Operations:  operations,
+		Concurrency: *concurrency,
+	})
+	if err != nil {
+		fmt.Println("Got an error sweeping the Regions:")
+		fmt.Println(err)
+		return
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return
+	}
+
+	WriteTable(os.Stdout, result.Resources)
+
+	for _, e := range result.Errors {
+		fmt.Fprintln(os.Stderr, "Got an error: "+e.Error())
+	}
+}
+
+// snippet-end:[ec2.go-v2.RegionSweep]
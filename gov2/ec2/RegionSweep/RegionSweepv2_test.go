@@ -0,0 +1,164 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
+)
+
+// failingKeyPairs is the fake, except that DescribeKeyPairs fails in one Region,
+// and it counts the calls in progress.
+type failingKeyPairs struct {
+	*ec2fake.Service
+	region            string
+	running, mostSeen int32
+}
+
+func (f *failingKeyPairs) DescribeKeyPairs(ctx context.Context,
+	params *ec2.DescribeKeyPairsInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error) {
+	n := atomic.AddInt32(&f.running, 1)
+	defer atomic.AddInt32(&f.running, -1)
+
+	for {
+		most := atomic.LoadInt32(&f.mostSeen)
+		if n <= most || atomic.CompareAndSwapInt32(&f.mostSeen, most, n) {
+			break
+		}
+	}
+
+	options := ec2.Options{}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+
+	if options.Region == f.region {
+		return nil, errors.New("throttled")
+	}
+
+	return f.Service.DescribeKeyPairs(ctx, params, optFns...)
+}
+
+func testService() *ec2fake.Service {
+	api := ec2fake.New()
+
+	for i := 0; i < 7; i++ {
+		api.AddInstance("us-east-1", types.Instance{})
+	}
+
+	api.AddInstance("eu-west-1", types.Instance{
+		Tags:  []types.Tag{{Key: aws.String("Name"), Value: aws.String("forgotten")}},
+		State: &types.InstanceState{Name: types.InstanceStateNameStopped},
+	})
+	api.AddAddress("ap-northeast-1", types.Address{PublicIp: aws.String("192.0.2.10")})
+	api.AddKeyPair("us-west-1", "aws-docs-example-key")
+	api.AddVpcEndpointConnection("us-east-2", types.VpcEndpointConnection{ServiceId: aws.String("vpce-svc-0123456789abcdef0")})
+
+	return api
+}
+
+func TestGetRegions(t *testing.T) {
+	regions, err := GetRegions(context.Background(), ec2fake.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(regions, ",") != "ap-northeast-1,eu-west-1,us-east-1,us-east-2,us-west-1,us-west-2" {
+		t.Errorf("got %v, want the enabled Regions", regions)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	api := &failingKeyPairs{Service: testService(), region: "us-east-1"}
+
+	result, err := Sweep(context.Background(), api, SweepOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Resources) != 11 {
+		t.Fatalf("got %d resources, want 11", len(result.Resources))
+	}
+
+	first, last := result.Resources[0], result.Resources[len(result.Resources)-1]
+	if first.Region != "ap-northeast-1" || first.Type != "address" || first.State != "192.0.2.10" ||
+		last.Region != "us-west-1" || last.Type != "key-pair" || last.Name != "aws-docs-example-key" {
+		t.Errorf("got first %+v and last %+v", first, last)
+	}
+
+	if r := result.Resources[1]; r.Region != "eu-west-1" || r.Name != "forgotten" || r.State != "stopped" {
+		t.Errorf("got %+v, want the forgotten instance", r)
+	}
+
+	if len(result.Errors) != 1 || result.Errors[0].Region != "us-east-1" || result.Errors[0].Operation != "DescribeKeyPairs" {
+		t.Errorf("got errors %v", result.Errors)
+	}
+
+	if api.mostSeen > 2 {
+		t.Errorf("got %d calls at once, want at most 2", api.mostSeen)
+	}
+
+	b, err := json.Marshal(result.Errors[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"error":"throttled","operation":"DescribeKeyPairs","region":"us-east-1"}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestSweepOptions(t *testing.T) {
+	api := testService()
+
+	// Regions that aren't opted in to fail with AuthFailure
+	result, err := Sweep(context.Background(), api, SweepOptions{
+		Regions:    []string{"us-east-1", "af-south-1"},
+		Operations: []string{"DescribeInstances"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Resources) != 7 || len(result.Errors) != 1 || result.Errors[0].Region != "af-south-1" {
+		t.Errorf("got %d resources and errors %v", len(result.Resources), result.Errors)
+	}
+
+	_, err = Sweep(context.Background(), api, SweepOptions{Operations: []string{"DescribeVolumes"}})
+	if err == nil {
+		t.Error("expected an error for an operation that doesn't exist")
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var b bytes.Buffer
+
+	err := WriteTable(&b, []Resource{
+		{Region: "eu-west-1", Type: "instance", ID: "i-0123456789abcdef0", Name: "forgotten", State: "stopped"},
+		{Region: "us-west-1", Type: "key-pair", ID: "key-0123456789abcdef0", Name: "aws-docs-example-key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `REGION     TYPE      ID                     NAME                  STATE
+eu-west-1  instance  i-0123456789abcdef0    forgotten             stopped
+us-west-1  key-pair  key-0123456789abcdef0  aws-docs-example-key
+`
+	// The columns are padded, so ignore trailing spaces
+	got := strings.Replace(b.String(), "  \n", "\n", -1)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
 )
 
 // EC2StartInstancesAPI defines the interface for the StartInstances function.
@@ -43,11 +45,47 @@ func StartInstance(c context.Context, api EC2StartInstancesAPI, input *ec2.Start
 	return resp, err
 }
 
+// EC2StartInstancesWaitAPI defines the interface for the StartInstances and DescribeInstances functions.
+// We use this interface to test the functions using a mocked service.
+type EC2StartInstancesWaitAPI interface {
+	EC2StartInstancesAPI
+	ec2wait.EC2DescribeInstancesAPI
+}
+
+// StartInstancesAndWait starts Amazon Elastic Compute Cloud (Amazon EC2) instances, and waits for them to be running.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method calls.
+//     input defines the input arguments to the service call.
+//     opts controls how long to wait, and how often to check.
+// Output:
+//     If success, a StartInstancesOutput object containing the result of the service call and nil.
+//     If some instances didn't start, the StartInstancesOutput object and a TransitionError.
+//     Otherwise, nil and an error from the call to StartInstances or DescribeInstances.
+func StartInstancesAndWait(c context.Context, api EC2StartInstancesWaitAPI, input *ec2.StartInstancesInput, opts ec2wait.Options) (*ec2.StartInstancesOutput, error) {
+	resp, err := StartInstance(c, api, input)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ec2wait.WaitForRunning(c, api, input.InstanceIds, opts)
+
+	var transitionErr *ec2wait.TransitionError
+	if err != nil && !errors.As(err, &transitionErr) {
+		return nil, err
+	}
+
+	return resp, err
+}
+
 func main() {
-	instanceID := flag.String("i", "", "The ID of the instance to start")
+	var instanceIDs ec2wait.ListFlags
+	flag.Var(&instanceIDs, "i", "The ID of an instance to start. Can be repeated")
+	wait := flag.Bool("w", false, "Wait until the instances are running")
+	timeout := flag.Duration("t", 10*time.Minute, "How long to wait for the instances")
 	flag.Parse()
 
-	if *instanceID == "" {
+	if len(instanceIDs) == 0 {
 		fmt.Println("You must supply an instance ID (-i INSTANCE-ID")
 		return
 	}
@@ -60,20 +98,25 @@ func main() {
 	client := ec2.NewFromConfig(cfg)
 
 	input := &ec2.StartInstancesInput{
-		InstanceIds: []string{
-			*instanceID,
-		},
-		DryRun: true,
+		InstanceIds: instanceIDs,
+		DryRun:      true,
+	}
+
+	if *wait {
+		_, err = StartInstancesAndWait(context.TODO(), client, input, ec2wait.Options{Timeout: *timeout})
+	} else {
+		_, err = StartInstance(context.TODO(), client, input)
 	}
 
-	_, err = StartInstance(context.TODO(), client, input)
 	if err != nil {
 		fmt.Println("Got an error starting the instance")
 		fmt.Println(err)
 		return
 	}
 
-	fmt.Println("Started instance with ID " + *instanceID)
+	for _, id := range instanceIDs {
+		fmt.Println("Started instance with ID " + id)
+	}
 }
 
 // snippet-end:[ec2.go-v2.StartInstances]
@@ -8,9 +8,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
 )
 
 type mockDryRunError struct {
@@ -102,3 +105,37 @@ func TestStartInstances(t *testing.T) {
 
 	t.Log("Instance with ID " + *resp.StartingInstances[0].InstanceId + " is: " + string(resp.StartingInstances[0].CurrentState.Name))
 }
+
+func TestStartInstancesAndWait(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+
+	var ids []string
+	for i := 0; i < 150; i++ {
+		ids = append(ids, api.AddInstance("us-west-2", types.Instance{
+			State: &types.InstanceState{Name: types.InstanceStateNameStopped},
+		}))
+	}
+
+	opts := clock.Options(ec2wait.Options{MinDelay: 10 * time.Second, MaxDelay: 15 * time.Second})
+
+	resp, err := StartInstancesAndWait(context.Background(), api, &ec2.StartInstancesInput{InstanceIds: ids, DryRun: true}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.StartingInstances) != 150 {
+		t.Errorf("got %d starting instances, want 150", len(resp.StartingInstances))
+	}
+
+	// The instances are pending for 30 seconds: 10 + 15 + 15 seconds covers it
+	if len(clock.Slept) != 3 || clock.Slept[2] != 15*time.Second {
+		t.Errorf("got delays %v", clock.Slept)
+	}
+
+	output, err := api.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{{Name: aws.String("instance-state-name"), Values: []string{"running"}}},
+	})
+	if err != nil || len(output.Reservations) != 150 {
+		t.Errorf("got %v, want 150 running instances", err)
+	}
+}
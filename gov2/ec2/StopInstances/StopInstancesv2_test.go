@@ -8,9 +8,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
 )
 
 type mockDryRunError struct {
@@ -105,3 +108,40 @@ func TestStopInstances(t *testing.T) {
 
 	t.Log("Instance with ID " + *resp.StoppingInstances[0].InstanceId + " is: " + string(resp.StoppingInstances[0].CurrentState.Name))
 }
+
+func TestStopInstancesAndWait(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+
+	var ids []string
+	for i := 0; i < 150; i++ {
+		ids = append(ids, api.AddInstance("us-west-2", types.Instance{}))
+	}
+
+	opts := clock.Options(ec2wait.Options{MinDelay: 10 * time.Second, MaxDelay: 15 * time.Second})
+
+	resp, err := StopInstancesAndWait(context.Background(), api, &ec2.StopInstancesInput{InstanceIds: ids, DryRun: true}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.StoppingInstances) != 150 {
+		t.Errorf("got %d stopping instances, want 150", len(resp.StoppingInstances))
+	}
+
+	if len(clock.Slept) != 3 {
+		t.Errorf("got delays %v", clock.Slept)
+	}
+
+	output, err := api.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{{Name: aws.String("instance-state-name"), Values: []string{"stopped"}}},
+	})
+	if err != nil || len(output.Reservations) != 150 {
+		t.Errorf("got %v, want 150 stopped instances", err)
+	}
+
+	var transitionErr *ec2wait.TransitionError
+	_, err = StopInstancesAndWait(context.Background(), api, &ec2.StopInstancesInput{InstanceIds: []string{"i-0123456789abcdef0"}}, opts)
+	if errors.As(err, &transitionErr) || err == nil {
+		t.Errorf("got %v, want the error from StopInstances", err)
+	}
+}
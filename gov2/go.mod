@@ -19,4 +19,5 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssm v0.31.0
 	github.com/aws/aws-sdk-go-v2/service/sts v0.31.0
 	github.com/aws/smithy-go v0.5.0
+	gopkg.in/yaml.v2 v2.2.8
 )
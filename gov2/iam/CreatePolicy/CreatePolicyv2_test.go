@@ -10,6 +10,7 @@ import (
 
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/service/iam"
+    "github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/iampolicy"
 )
 
 type IAMCreatePolicyImpl struct{}
@@ -85,3 +86,38 @@ func TestCreatePolicy(t *testing.T) {
 
     t.Log("Created policy " + globalConfig.PolicyName)
 }
+
+func TestCreatePolicyDocAllows(t *testing.T) {
+    thisTime := time.Now()
+    nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+    t.Log("Starting unit test at " + nowString)
+
+    b, err := CreatePolicyDoc()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    policy, err := iampolicy.Parse(b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        action   string
+        resource string
+        want     iampolicy.Decision
+    }{
+        {"logs:CreateLogGroup", "RESOURCE ARN FOR logs:*", iampolicy.Allowed},
+        {"dynamodb:GetItem", "RESOURCE ARN FOR dynamodb:*", iampolicy.Allowed},
+        {"dynamodb:Scan", "RESOURCE ARN FOR dynamodb:*", iampolicy.Allowed},
+        {"dynamodb:GetItem", "RESOURCE ARN FOR logs:*", iampolicy.ImplicitDeny},
+        {"dynamodb:DeleteTable", "RESOURCE ARN FOR dynamodb:*", iampolicy.ImplicitDeny},
+    }
+
+    for _, test := range tests {
+        result := policy.Evaluate(iampolicy.Request{Action: test.action, Resource: test.resource})
+        if result.Decision != test.want {
+            t.Errorf("%s on %s was %v instead of %v", test.action, test.resource, result.Decision, test.want)
+        }
+    }
+}
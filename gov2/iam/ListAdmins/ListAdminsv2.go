@@ -5,201 +5,465 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"strings"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/iampolicy"
 )
 
-func userPolicyHasAdmin(user types.UserDetail, admin string) bool {
-	for _, policy := range user.UserPolicyList {
-		if *policy.PolicyName == admin {
-			return true
-		}
-	}
+// IAMGetAccountAuthorizationDetailsAPI defines the interface for the GetAccountAuthorizationDetails function.
+// We use this interface to test the function using a mocked service.
+type IAMGetAccountAuthorizationDetailsAPI interface {
+	GetAccountAuthorizationDetails(ctx context.Context,
+		params *iam.GetAccountAuthorizationDetailsInput,
+		optFns ...func(*iam.Options)) (*iam.GetAccountAuthorizationDetailsOutput, error)
+}
+
+// The ways a user can get a policy
+const (
+	GrantInlineUserPolicy    = "inline user policy"
+	GrantAttachedUserPolicy  = "attached user policy"
+	GrantInlineGroupPolicy   = "inline group policy"
+	GrantAttachedGroupPolicy = "attached group policy"
+)
+
+// adminPolicyName is the name of the AWS managed policy that grants administrator access
+const adminPolicyName = "AdministratorAccess"
+
+// AdminGrant is one way a user gets administrator privileges.
+type AdminGrant struct {
+	// Kind is how the user gets the policy, such as GrantAttachedGroupPolicy.
+	Kind string `json:"kind"`
+	// Group is the group the policy comes through, for group policies.
+	Group string `json:"group,omitempty"`
+	// Policy is the name of the policy.
+	Policy string `json:"policy"`
+	// PolicyArn is the ARN of an attached managed policy.
+	PolicyArn string `json:"policyArn,omitempty"`
+	// Reason says what in the policy grants administrator privileges.
+	Reason string `json:"reason"`
+}
+
+// UserPrivileges describes the administrator privileges of one user.
+// A user with grants isn't an administrator if any of their policies also denies everything.
+type UserPrivileges struct {
+	UserName string       `json:"userName"`
+	Arn      string       `json:"arn"`
+	Admin    bool         `json:"admin"`
+	Grants   []AdminGrant `json:"grants,omitempty"`
+	// Denials are the policies that override the grants.
+	Denials []AdminGrant `json:"denials,omitempty"`
+}
 
-	return false
+// PrivilegeReport lists every user in an account, and how each administrator gets their privileges.
+type PrivilegeReport struct {
+	Users []UserPrivileges `json:"users"`
 }
 
-func attachedUserPolicyHasAdmin(user types.UserDetail, admin string) bool {
-	for _, policy := range user.AttachedManagedPolicies {
-		if *policy.PolicyName == admin {
-			return true
+// Admins returns the users with administrator privileges.
+func (r *PrivilegeReport) Admins() []UserPrivileges {
+	var admins []UserPrivileges
+	for _, u := range r.Users {
+		if u.Admin {
+			admins = append(admins, u)
 		}
 	}
 
-	return false
+	return admins
 }
 
-func groupPolicyHasAdmin(c context.Context, client *iam.Client, group types.Group, admin string) (bool, error) {
-	input := &iam.ListGroupPoliciesInput{
-		GroupName: group.GroupName,
-	}
+// WriteJSON writes the report as an indented JSON document.
+func (r *PrivilegeReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// rows returns the grants of a user followed by the denials.
+func (u UserPrivileges) rows() []AdminGrant {
+	return append(append([]AdminGrant{}, u.Grants...), u.Denials...)
+}
 
-	result, err := client.ListGroupPolicies(c, input)
+// WriteCSV writes the report as CSV, with a header row and one row for each grant or denial.
+// A user with neither gets a single row with empty grant columns.
+func (r *PrivilegeReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"user", "arn", "admin", "kind", "group", "policy", "policy_arn", "reason"})
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	// Wade through policies
-	for _, policyName := range result.PolicyNames {
-		if policyName == admin {
-			return true, nil
+	for _, u := range r.Users {
+		rows := u.rows()
+		if len(rows) == 0 {
+			err = cw.Write([]string{u.UserName, u.Arn, strconv.FormatBool(u.Admin), "", "", "", "", ""})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, g := range rows {
+			err = cw.Write([]string{u.UserName, u.Arn, strconv.FormatBool(u.Admin), g.Kind, g.Group, g.Policy, g.PolicyArn, g.Reason})
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	return false, nil
+	cw.Flush()
+
+	return cw.Error()
 }
 
-func attachedGroupPolicyHasAdmin(c context.Context, client *iam.Client, group types.Group, admin string) (bool, error) {
-	input := &iam.ListAttachedGroupPoliciesInput{
-		GroupName: group.GroupName,
+// WriteTable writes the report as an aligned text table, with one line for each grant or denial.
+func (r *PrivilegeReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "USER\tADMIN\tGRANTED BY\tGROUP\tPOLICY\tREASON")
+
+	for _, u := range r.Users {
+		rows := u.rows()
+		if len(rows) == 0 {
+			fmt.Fprintf(tw, "%s\t%t\t-\t-\t-\t-\n", u.UserName, u.Admin)
+		}
+
+		for _, g := range rows {
+			group := g.Group
+			if group == "" {
+				group = "-"
+			}
+
+			fmt.Fprintf(tw, "%s\t%t\t%s\t%s\t%s\t%s\n", u.UserName, u.Admin, g.Kind, group, g.Policy, g.Reason)
+		}
 	}
 
-	result, err := client.ListAttachedGroupPolicies(c, input)
+	return tw.Flush()
+}
+
+// everything stands for a request for every action on every resource:
+// only the * and *:* wildcards match its action, and only * matches its resource.
+var everything = iampolicy.Request{
+	Action:   "any-service:AnyAction",
+	Resource: "arn:aws:any-service:::any-resource",
+}
+
+// userPolicy is one policy that applies to a user, and how the user gets it.
+type userPolicy struct {
+	// source says where the policy comes from. Its Reason is empty.
+	source AdminGrant
+	// policy is nil if the document of an attached policy isn't known.
+	policy *iampolicy.Policy
+}
+
+// parsePolicy parses a policy document, which can be URL-encoded, as GetAccountAuthorizationDetails returns it.
+func parsePolicy(name string, document string) (*iampolicy.Policy, error) {
+	policy, err := iampolicy.Parse([]byte(document))
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("can't parse policy %s: %v", name, err)
 	}
 
-	for _, policy := range result.AttachedPolicies {
-		if *policy.PolicyName == admin {
-			return true, nil
+	return policy, nil
+}
+
+// statementID returns the Sid of a statement, or its index in the policy if it has none.
+func statementID(p *iampolicy.Policy, s *iampolicy.Statement) string {
+	if s.Sid != "" {
+		return s.Sid
+	}
+
+	for i, other := range p.Statements {
+		if other == s {
+			return strconv.Itoa(i)
 		}
 	}
 
-	return false, nil
+	return "?"
 }
 
-func usersGroupsHaveAdmin(c context.Context, client *iam.Client, user types.UserDetail, admin string) (bool, error) {
-	input := &iam.ListGroupsForUserInput{
-		UserName: user.UserName,
+// allowsEverything returns the first statement of a policy that allows every action on every resource
+// with Action and Resource, and without conditions, or nil if there's none.
+func allowsEverything(p *iampolicy.Policy) *iampolicy.Statement {
+	for _, s := range p.Statements {
+		if s.Effect != iampolicy.EffectAllow || s.Action == nil || s.Resource == nil || len(s.Conditions) > 0 {
+			continue
+		}
+
+		one := &iampolicy.Policy{Statements: []*iampolicy.Statement{s}}
+		if one.Evaluate(everything).Decision == iampolicy.Allowed {
+			return s
+		}
 	}
 
-	result, err := client.ListGroupsForUser(c, input)
-	if err != nil {
-		return false, err
+	return nil
+}
+
+// deniesEverything returns the first statement of a policy that denies every action on every resource
+// without conditions, with Action or NotAction and Resource or NotResource, or nil if there's none.
+func deniesEverything(p *iampolicy.Policy) *iampolicy.Statement {
+	for _, s := range p.Statements {
+		if s.Effect != iampolicy.EffectDeny || len(s.Conditions) > 0 {
+			continue
+		}
+
+		one := &iampolicy.Policy{Statements: []*iampolicy.Statement{s}}
+		if one.Evaluate(everything).Decision == iampolicy.ExplicitDeny {
+			return s
+		}
 	}
 
-	for _, group := range result.Groups {
-		groupPolicyHasAdmin, err := groupPolicyHasAdmin(c, client, group, admin)
-		if err != nil {
-			return false, err
+	return nil
+}
+
+// evaluate decides whether the policies of a user, taken together, grant administrator privileges.
+// A policy grants them if a statement without conditions allows Action "*" on Resource "*".
+// If its document isn't known, it's judged by its name.
+// A statement without conditions that denies every action on every resource,
+// such as Action "*" or a NotAction, in any of the user's policies, overrides every grant.
+// Output:
+//     Whether the user is an administrator, and the grants and denials, each with the reason from its policy.
+func evaluate(policies []userPolicy) (bool, []AdminGrant, []AdminGrant) {
+	var grants, denials []AdminGrant
+
+	for _, p := range policies {
+		if p.policy == nil {
+			if p.source.Policy == adminPolicyName {
+				g := p.source
+				g.Reason = "named " + adminPolicyName
+				grants = append(grants, g)
+			}
+
+			continue
 		}
 
-		if groupPolicyHasAdmin {
-			return true, nil
+		if s := allowsEverything(p.policy); s != nil {
+			g := p.source
+			g.Reason = fmt.Sprintf("statement %s allows Action * on Resource *", statementID(p.policy, s))
+			grants = append(grants, g)
 		}
 
-		attachedGroupPolicyHasAdmin, err := attachedGroupPolicyHasAdmin(c, client, group, admin)
-		if err != nil {
-			return false, err
+		if s := deniesEverything(p.policy); s != nil {
+			d := p.source
+			d.Reason = fmt.Sprintf("statement %s denies every action on every resource", statementID(p.policy, s))
+			denials = append(denials, d)
 		}
+	}
 
-		if attachedGroupPolicyHasAdmin {
-			return true, nil
+	return len(grants) > 0 && len(denials) == 0, grants, denials
+}
+
+// defaultDocument returns the document of the default version of a managed policy.
+func defaultDocument(policy types.ManagedPolicyDetail) *string {
+	for _, v := range policy.PolicyVersionList {
+		if v.IsDefaultVersion {
+			return v.Document
 		}
 	}
 
-	return false, nil
+	return nil
 }
 
-// GetNumUsersAndAdmins determines how many users have administrator privileges.
-// Inputs:
-//     client is the AWS Identity and Access Management (IAM) service client.
-//     c is the context of the method call, which includes the AWS Region.
-// Output:
-//     If success, the list of users and admins, and nil.
-//     Otherwise, "", "" and an error.
-func GetNumUsersAndAdmins(c context.Context, client *iam.Client) (string, string, error) {
-	users := ""
-	admins := ""
+// authorizationDetails holds everything GetAccountAuthorizationDetails returns, from every page.
+type authorizationDetails struct {
+	users    []types.UserDetail
+	groups   map[string]types.GroupDetail
+	policies map[string]types.ManagedPolicyDetail
+}
 
-	filters := make([]types.EntityType, 1)
-	filters[0] = types.EntityTypeUser
+func getAuthorizationDetails(c context.Context, api IAMGetAccountAuthorizationDetailsAPI) (*authorizationDetails, error) {
+	details := &authorizationDetails{
+		groups:   map[string]types.GroupDetail{},
+		policies: map[string]types.ManagedPolicyDetail{},
+	}
 
 	input := &iam.GetAccountAuthorizationDetailsInput{
-		Filter: filters,
+		Filter: []types.EntityType{
+			types.EntityTypeUser,
+			types.EntityTypeGroup,
+			types.EntityTypeLocalmanagedpolicy,
+			types.EntityTypeAwsmanagedpolicy,
+		},
 	}
 
-	resp, err := client.GetAccountAuthorizationDetails(c, input)
-	if err != nil {
-		return "", "", err
-	}
+	for {
+		resp, err := api.GetAccountAuthorizationDetails(c, input)
+		if err != nil {
+			return nil, err
+		}
 
-	// The policy name that indicates administrator access
-	adminName := "AdministratorAccess"
+		details.users = append(details.users, resp.UserDetailList...)
 
-	// Wade through resulting users
-	for _, user := range resp.UserDetailList {
-		isAdmin, err := isUserAdmin(c, client, user, adminName)
-		if err != nil {
-			return "", "", err
+		for _, g := range resp.GroupDetailList {
+			details.groups[*g.GroupName] = g
 		}
 
-		users += " " + *user.UserName
+		for _, p := range resp.Policies {
+			details.policies[*p.Arn] = p
+		}
+
+		if !resp.IsTruncated {
+			return details, nil
+		}
+
+		input.Marker = resp.Marker
+	}
+}
+
+// attachedPolicies returns the managed policies attached to a user or group.
+func (d *authorizationDetails) attachedPolicies(kind, group string, attached []types.AttachedPolicy) ([]userPolicy, error) {
+	var policies []userPolicy
+	for _, a := range attached {
+		p := userPolicy{source: AdminGrant{Kind: kind, Group: group, Policy: *a.PolicyName, PolicyArn: *a.PolicyArn}}
 
-		if isAdmin {
-			admins += " " + *user.UserName
+		if detail, ok := d.policies[*a.PolicyArn]; ok {
+			if document := defaultDocument(detail); document != nil {
+				policy, err := parsePolicy(*a.PolicyName, *document)
+				if err != nil {
+					return nil, err
+				}
+
+				p.policy = policy
+			}
 		}
+
+		policies = append(policies, p)
 	}
 
-	for resp.IsTruncated {
-		input := &iam.GetAccountAuthorizationDetailsInput{
-			Filter: filters,
-			Marker: resp.Marker,
+	return policies, nil
+}
+
+// inlinePolicies returns the inline policies of a user or group.
+func inlinePolicies(kind, group string, inline []types.PolicyDetail) ([]userPolicy, error) {
+	var policies []userPolicy
+	for _, p := range inline {
+		if p.PolicyDocument == nil {
+			continue
 		}
 
-		resp, err = client.GetAccountAuthorizationDetails(c, input)
+		policy, err := parsePolicy(*p.PolicyName, *p.PolicyDocument)
 		if err != nil {
-			return "", "", err
+			return nil, err
 		}
 
-		// Wade through resulting users
-		for _, user := range resp.UserDetailList {
-			isAdmin, err := isUserAdmin(c, client, user, adminName)
-			if err != nil {
-				return "", "", err
-			}
+		policies = append(policies, userPolicy{
+			source: AdminGrant{Kind: kind, Group: group, Policy: *p.PolicyName},
+			policy: policy,
+		})
+	}
 
-			users += " " + *user.UserName
+	return policies, nil
+}
 
-			if isAdmin {
-				admins += " " + *user.UserName
-			}
+// userPrivileges evaluates every policy of a user, whether it's the user's or comes through a group.
+func (d *authorizationDetails) userPrivileges(user types.UserDetail) (UserPrivileges, error) {
+	u := UserPrivileges{UserName: *user.UserName}
+	if user.Arn != nil {
+		u.Arn = *user.Arn
+	}
+
+	policies, err := inlinePolicies(GrantInlineUserPolicy, "", user.UserPolicyList)
+	if err != nil {
+		return u, err
+	}
+
+	attached, err := d.attachedPolicies(GrantAttachedUserPolicy, "", user.AttachedManagedPolicies)
+	if err != nil {
+		return u, err
+	}
+
+	policies = append(policies, attached...)
+
+	for _, name := range user.GroupList {
+		group, ok := d.groups[name]
+		if !ok {
+			continue
+		}
+
+		inline, err := inlinePolicies(GrantInlineGroupPolicy, name, group.GroupPolicyList)
+		if err != nil {
+			return u, err
 		}
+
+		attached, err := d.attachedPolicies(GrantAttachedGroupPolicy, name, group.AttachedManagedPolicies)
+		if err != nil {
+			return u, err
+		}
+
+		policies = append(policies, inline...)
+		policies = append(policies, attached...)
 	}
 
-	return users, admins, nil
+	u.Admin, u.Grants, u.Denials = evaluate(policies)
+
+	return u, nil
 }
 
-func isUserAdmin(c context.Context, client *iam.Client, user types.UserDetail, admin string) (bool, error) {
-	// Check policy, attached policy, and groups (policy and attached policy)
-	policyHasAdmin := userPolicyHasAdmin(user, admin)
-	if policyHasAdmin {
-		return true, nil
+// GetPrivilegeReport finds which users have administrator privileges, and through which policies.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+// Output:
+//     If success, a PrivilegeReport listing every user, and nil.
+//     Otherwise, nil and an error from the call to GetAccountAuthorizationDetails, or from parsing a policy.
+func GetPrivilegeReport(c context.Context, api IAMGetAccountAuthorizationDetailsAPI) (*PrivilegeReport, error) {
+	details, err := getAuthorizationDetails(c, api)
+	if err != nil {
+		return nil, err
 	}
 
-	attachedPolicyHasAdmin := attachedUserPolicyHasAdmin(user, admin)
-	if attachedPolicyHasAdmin {
-		return true, nil
+	report := &PrivilegeReport{}
+	for _, user := range details.users {
+		u, err := details.userPrivileges(user)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Users = append(report.Users, u)
 	}
 
-	userGroupsHaveAdmin, err := usersGroupsHaveAdmin(c, client, user, admin)
+	return report, nil
+}
+
+// GetNumUsersAndAdmins determines how many users have administrator privileges.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+// Output:
+//     If success, the list of users and admins, each name preceded by a space, and nil.
+//     Otherwise, "", "" and an error.
+func GetNumUsersAndAdmins(c context.Context, api IAMGetAccountAuthorizationDetailsAPI) (string, string, error) {
+	report, err := GetPrivilegeReport(c, api)
 	if err != nil {
-		return false, err
+		return "", "", err
 	}
-	if userGroupsHaveAdmin {
-		return true, nil
+
+	users := ""
+	admins := ""
+
+	for _, u := range report.Users {
+		users += " " + u.UserName
+
+		if u.Admin {
+			admins += " " + u.UserName
+		}
 	}
 
-	return false, nil
+	return users, admins, nil
 }
 
 func main() {
 	showDetails := flag.Bool("d", false, "Whether to print out names of users and admins")
+	format := flag.String("f", "", "Print the privilege report as a table, json, or csv")
 	flag.Parse()
 
 	cfg, err := config.LoadDefaultConfig(context.TODO())
@@ -209,30 +473,52 @@ func main() {
 
 	client := iam.NewFromConfig(cfg)
 
-	users, admins, err := GetNumUsersAndAdmins(context.TODO(), client)
+	report, err := GetPrivilegeReport(context.TODO(), client)
 	if err != nil {
 		fmt.Println("Got an error finding users who are admins:")
 		fmt.Println(err)
 		return
 	}
 
-	userList := strings.Split(users, " ")
-	adminList := strings.Split(admins, " ")
+	switch *format {
+	case "":
+	case "table":
+		err = report.WriteTable(os.Stdout)
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	case "csv":
+		err = report.WriteCSV(os.Stdout)
+	default:
+		fmt.Println("The format must be table, json, or csv")
+		return
+	}
+
+	if err != nil {
+		fmt.Println("Got an error writing the report:")
+		fmt.Println(err)
+		return
+	}
+
+	if *format != "" {
+		return
+	}
+
+	admins := report.Admins()
 
 	fmt.Println("")
-	fmt.Println("Found", len(adminList)-1, "admin(s) out of", len(userList)-1, "user(s)")
+	fmt.Println("Found", len(admins), "admin(s) out of", len(report.Users), "user(s)")
 
 	if *showDetails {
 		fmt.Println("")
 		fmt.Println("Users")
-		for _, u := range userList {
-			fmt.Println("  " + u)
+		for _, u := range report.Users {
+			fmt.Println("  " + u.UserName)
 		}
 
 		fmt.Println("")
 		fmt.Println("Admins")
-		for _, a := range adminList {
-			fmt.Println("  " + a)
+		for _, a := range admins {
+			fmt.Println("  " + a.UserName)
 		}
 	}
 }
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"io/ioutil"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 )
 
 type Config struct {
@@ -87,3 +93,244 @@ func TestListAdmins(t *testing.T) {
 		}
 	}
 }
+
+// IAMGetAccountAuthorizationDetailsImpl returns its pages one at a time, using the page number as the marker.
+type IAMGetAccountAuthorizationDetailsImpl struct {
+	pages []*iam.GetAccountAuthorizationDetailsOutput
+}
+
+func (dt IAMGetAccountAuthorizationDetailsImpl) GetAccountAuthorizationDetails(ctx context.Context,
+	params *iam.GetAccountAuthorizationDetailsInput,
+	optFns ...func(*iam.Options)) (*iam.GetAccountAuthorizationDetailsOutput, error) {
+
+	page := 0
+	if params.Marker != nil {
+		page = len(*params.Marker)
+	}
+
+	output := *dt.pages[page]
+	if page+1 < len(dt.pages) {
+		output.IsTruncated = true
+		output.Marker = aws.String(strings.Repeat("x", page+1))
+	}
+
+	return &output, nil
+}
+
+const allowAll = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`
+
+func inlinePolicy(name, document string) types.PolicyDetail {
+	return types.PolicyDetail{PolicyName: aws.String(name), PolicyDocument: aws.String(url.PathEscape(document))}
+}
+
+func attachedPolicy(name string) types.AttachedPolicy {
+	return types.AttachedPolicy{PolicyName: aws.String(name), PolicyArn: aws.String("arn:aws:iam::123456789012:policy/" + name)}
+}
+
+func managedPolicy(name, document string) types.ManagedPolicyDetail {
+	return types.ManagedPolicyDetail{
+		Arn:        aws.String("arn:aws:iam::123456789012:policy/" + name),
+		PolicyName: aws.String(name),
+		PolicyVersionList: []types.PolicyVersion{
+			{Document: aws.String(`{"Statement":{"Effect":"Allow","Action":"s3:*","Resource":"*"}}`), VersionId: aws.String("v1")},
+			{Document: aws.String(url.PathEscape(document)), VersionId: aws.String("v2"), IsDefaultVersion: true},
+		},
+	}
+}
+
+func user(name string, groups ...string) types.UserDetail {
+	return types.UserDetail{UserName: aws.String(name), Arn: aws.String("arn:aws:iam::123456789012:user/" + name), GroupList: groups}
+}
+
+func newMockDetails() IAMGetAccountAuthorizationDetailsImpl {
+	inline := user("inline-admin")
+	inline.UserPolicyList = []types.PolicyDetail{inlinePolicy("Everything", allowAll)}
+
+	attached := user("attached-admin")
+	attached.AttachedManagedPolicies = []types.AttachedPolicy{attachedPolicy("AllResources")}
+
+	denied := user("denied-user")
+	denied.UserPolicyList = []types.PolicyDetail{inlinePolicy("AllowThenDeny",
+		`{"Statement":[{"Effect":"Allow","Action":["*"],"Resource":["*"]},{"Effect":"Deny","Action":"*:*","Resource":"*"}]}`)}
+
+	conditional := user("conditional-user")
+	conditional.UserPolicyList = []types.PolicyDetail{inlinePolicy("FromOffice",
+		`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"IpAddress":{"aws:SourceIp":"203.0.113.0/24"}}}]}`)}
+
+	// A Deny in one policy overrides an Allow in another, whether it comes through a group or not
+	const denyAll = `{"Statement":{"Sid":"NoAccess","Effect":"Deny","Action":"*","Resource":"*"}}`
+
+	userDenied := user("user-denied")
+	userDenied.AttachedManagedPolicies = []types.AttachedPolicy{attachedPolicy("AdministratorAccess")}
+	userDenied.UserPolicyList = []types.PolicyDetail{inlinePolicy("Suspend", denyAll)}
+
+	return IAMGetAccountAuthorizationDetailsImpl{pages: []*iam.GetAccountAuthorizationDetailsOutput{
+		{
+			UserDetailList: []types.UserDetail{inline, attached, user("group-inline-admin", "InlineAdmins")},
+			Policies:       []types.ManagedPolicyDetail{managedPolicy("AllResources", allowAll)},
+		},
+		{
+			UserDetailList: []types.UserDetail{user("group-attached-admin", "Admins"), denied, conditional, user("plain-user", "Readers"),
+				user("group-denied", "InlineAdmins", "Suspended"), userDenied},
+			GroupDetailList: []types.GroupDetail{
+				{GroupName: aws.String("Suspended"), GroupPolicyList: []types.PolicyDetail{inlinePolicy("Suspend", denyAll)}},
+				{GroupName: aws.String("InlineAdmins"), GroupPolicyList: []types.PolicyDetail{inlinePolicy("Everything", allowAll)}},
+				{GroupName: aws.String("Admins"), AttachedManagedPolicies: []types.AttachedPolicy{attachedPolicy("AdministratorAccess")}},
+				{GroupName: aws.String("Readers"), AttachedManagedPolicies: []types.AttachedPolicy{attachedPolicy("ReadOnly")}},
+			},
+			Policies: []types.ManagedPolicyDetail{
+				managedPolicy("ReadOnly", `{"Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`),
+			},
+		},
+	}}
+}
+
+func TestGetPrivilegeReport(t *testing.T) {
+	report, err := GetPrivilegeReport(context.Background(), newMockDetails())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"inline-admin":         GrantInlineUserPolicy,
+		"attached-admin":       GrantAttachedUserPolicy,
+		"group-inline-admin":   GrantInlineGroupPolicy,
+		"group-attached-admin": GrantAttachedGroupPolicy,
+		"denied-user":          "",
+		"conditional-user":     "",
+		"plain-user":           "",
+		"group-denied":         "",
+		"user-denied":          "",
+	}
+
+	if len(report.Users) != len(want) {
+		t.Fatalf("got %d users, want %d", len(report.Users), len(want))
+	}
+
+	for _, u := range report.Users {
+		kind, ok := want[u.UserName]
+		if !ok {
+			t.Errorf("got unexpected user %s", u.UserName)
+			continue
+		}
+
+		if u.Admin != (kind != "") {
+			t.Errorf("%s: got admin %t", u.UserName, u.Admin)
+		}
+
+		if kind != "" && (len(u.Grants) != 1 || u.Grants[0].Kind != kind) {
+			t.Errorf("%s: got grants %+v, want one %s", u.UserName, u.Grants, kind)
+		}
+
+		if strings.HasSuffix(u.UserName, "-denied") && (len(u.Grants) != 1 || len(u.Denials) != 1 || u.Denials[0].Policy != "Suspend") {
+			t.Errorf("%s: got grants %+v and denials %+v, want one of each", u.UserName, u.Grants, u.Denials)
+		}
+	}
+
+	if len(report.Admins()) != 4 {
+		t.Errorf("got %d admins, want 4", len(report.Admins()))
+	}
+
+	users, admins, err := GetNumUsersAndAdmins(context.Background(), newMockDetails())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(strings.Fields(users)) != 9 || len(strings.Fields(admins)) != 4 {
+		t.Errorf("got users %q and admins %q", users, admins)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		documents []string
+		admin     bool
+	}{
+		{[]string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*"}}`}, true},
+		{[]string{`{"Statement":[{"Effect":"Allow","Action":["s3:*","*:*"],"Resource":["arn:aws:s3:::a","*"]}]}`}, true},
+		{[]string{`{"Statement":[{"Effect":"Allow","Action":"iam:*","Resource":"*"}]}`}, false},
+		{[]string{`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"arn:aws:s3:::a"}]}`}, false},
+		{[]string{`{"Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`}, false},
+		{[]string{`{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*"}]}`}, false},
+		// A Deny in another policy overrides the Allow
+		{[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"*:*","Resource":"*"}]}`}, false},
+		{[]string{allowAll, `{"Statement":[{"Effect":"Deny","NotAction":"iam:GetUser","Resource":"*"}]}`}, false},
+		{[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"*","NotResource":"arn:aws:s3:::a"}]}`}, false},
+		// A Deny of some actions doesn't, and neither does one with conditions
+		{[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"iam:*","Resource":"*"}]}`}, true},
+		{[]string{allowAll, `{"Statement":[{"Effect":"Deny","NotAction":"*","Resource":"*"}]}`}, true},
+		{[]string{allowAll, `{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}]}`}, true},
+	}
+
+	for _, test := range tests {
+		var policies []userPolicy
+		for i, document := range test.documents {
+			policy, err := parsePolicy("Test", document)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			policies = append(policies, userPolicy{source: AdminGrant{Policy: strconv.Itoa(i)}, policy: policy})
+		}
+
+		admin, grants, denials := evaluate(policies)
+		if admin != test.admin {
+			t.Errorf("%v: got admin %t with grants %+v and denials %+v, want %t", test.documents, admin, grants, denials, test.admin)
+		}
+	}
+
+	_, err := parsePolicy("Broken", "{")
+	if err == nil {
+		t.Error("got no error for a broken policy")
+	}
+}
+
+func TestPrivilegeReportFormats(t *testing.T) {
+	report, err := GetPrivilegeReport(context.Background(), newMockDetails())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+
+	err = report.WriteJSON(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded PrivilegeReport
+
+	err = json.Unmarshal(b.Bytes(), &decoded)
+	if err != nil || len(decoded.Users) != len(report.Users) {
+		t.Errorf("the JSON report doesn't round trip: %v", err)
+	}
+
+	b.Reset()
+
+	err = report.WriteCSV(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A header, plus one row for each of the 6 users with at most one grant or denial,
+	// and two rows for each of the 3 users with both
+	if len(rows) != 13 || rows[0][0] != "user" {
+		t.Errorf("got %d CSV rows: %v", len(rows), rows)
+	}
+
+	b.Reset()
+
+	err = report.WriteTable(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), GrantAttachedGroupPolicy) || strings.Count(b.String(), "\n") != 13 {
+		t.Errorf("got table:\n%s", b.String())
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package ec2fake provides an in-memory stand-in for the Amazon Elastic Compute Cloud (Amazon EC2) client.
+//
+// A Service implements the per-operation interfaces used by the gov2/ec2 examples,
+// such as EC2DescribeInstancesAPI, against a store of resources in several AWS Regions.
+// Each call works in the Region of its ec2.Options, so one Service can stand in for
+// a client that is pointed at different Regions with a per-call option.
+// Instances change state over time, as Now reports it: they stay pending, stopping, or shutting-down
+// for TransitionTime, and their status checks stay initializing for StatusCheckTime after they start running.
+// Regions that need to be opted in to are listed by DescribeRegions only when AllRegions is set,
+// and calls to them fail with AuthFailure, as in Amazon EC2.
+// Failures are returned as API errors with the same codes Amazon EC2 uses, such as InvalidInstanceID.NotFound.
+package ec2fake
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
+)
+
+// The opt-in statuses of a Region, as DescribeRegions reports them.
+const (
+	OptInNotRequired = "opt-in-not-required"
+	OptedIn          = "opted-in"
+	NotOptedIn       = "not-opted-in"
+)
+
+// Service is an in-memory Amazon EC2 service.
+// The zero value is not usable; call New to create one.
+// A Service is safe for concurrent use.
+type Service struct {
+	// Region is the Region of calls whose options don't set one.
+	Region string
+
+	// AccountID owns the reservations.
+	AccountID string
+
+	// Now returns the current time. Replace it to control launch times and state transitions in tests.
+	Now func() time.Time
+
+	// TransitionTime is how long an instance stays pending, stopping, or shutting-down.
+	TransitionTime time.Duration
+
+	// StatusCheckTime is how long the status checks of an instance that started running,
+	// or was rebooted, stay initializing before they're ok.
+	StatusCheckTime time.Duration
+
+	mu      sync.Mutex
+	regions map[string]*region
+	nextID  int
+}
+
+type region struct {
+	name        string
+	optInStatus string
+
+	reservations []*reservation
+	addresses    []types.Address
+	keyPairs     []types.KeyPairInfo
+	connections  []types.VpcEndpointConnection
+}
+
+type reservation struct {
+	id        string
+	instances []*instance
+}
+
+// New creates a Service with a few Regions that are enabled by default,
+// and af-south-1, which is not opted in to.
+func New() *Service {
+	s := &Service{
+		Region:    "us-west-2",
+		AccountID: "123456789012",
+		Now:       time.Now,
+		regions:   map[string]*region{},
+
+		TransitionTime:  30 * time.Second,
+		StatusCheckTime: 2 * time.Minute,
+	}
+
+	for _, name := range []string{"ap-northeast-1", "eu-west-1", "us-east-1", "us-east-2", "us-west-1", "us-west-2"} {
+		s.AddRegion(name, OptInNotRequired)
+	}
+
+	s.AddRegion("af-south-1", NotOptedIn)
+
+	return s
+}
+
+// NewWithClock creates a Service whose Now is a new ec2wait.FakeClock,
+// so that the instances change state as the waits that use the clock pass the time.
+func NewWithClock() (*Service, *ec2wait.FakeClock) {
+	clock := ec2wait.NewFakeClock()
+	s := New()
+	s.Now = clock.Now
+
+	return s, clock
+}
+
+// AddRegion adds a Region, or changes the opt-in status of one.
+func (s *Service) AddRegion(name, optInStatus string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.regions[name]; ok {
+		r.optInStatus = optInStatus
+		return
+	}
+
+	s.regions[name] = &region{name: name, optInStatus: optInStatus}
+}
+
+func apiError(code, message string) error {
+	return &smithy.GenericAPIError{Code: code, Message: message, Fault: smithy.FaultClient}
+}
+
+// dryRun returns the error that Amazon EC2 returns for a call with DryRun set, which it would otherwise allow.
+func dryRun() error {
+	return apiError("DryRunOperation", "Request would have succeeded, but DryRun flag is set.")
+}
+
+// id returns a new resource ID with the prefix, like the IDs that Amazon EC2 assigns. The caller must hold s.mu.
+func (s *Service) id(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%017x", prefix, s.nextID)
+}
+
+// enabled reports whether calls can be made to a Region with the opt-in status.
+func enabled(optInStatus string) bool {
+	return optInStatus == OptInNotRequired || optInStatus == OptedIn
+}
+
+// region returns the Region that a call with optFns works in. The caller must hold s.mu.
+func (s *Service) region(optFns []func(*ec2.Options)) (*region, error) {
+	options := ec2.Options{Region: s.Region}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+
+	r, ok := s.regions[options.Region]
+	if !ok {
+		return nil, fmt.Errorf("ec2fake: there is no Region named %q", options.Region)
+	}
+
+	if !enabled(r.optInStatus) {
+		return nil, apiError("AuthFailure", "AWS was not able to validate the provided access credentials")
+	}
+
+	return r, nil
+}
+
+// mustRegion returns the named Region, for the methods that add resources. The caller must hold s.mu.
+func (s *Service) mustRegion(name string) *region {
+	r, ok := s.regions[name]
+	if !ok {
+		panic("ec2fake: there is no Region named " + name)
+	}
+
+	return r
+}
+
+// page returns the bounds of the page of ids that starts after the ID that token names.
+// A maxResults of 0 returns the rest of the ids.
+func page(ids []string, maxResults int32, token *string) (int, int, *string, error) {
+	start := 0
+	if token != nil {
+		after, err := base64.RawURLEncoding.DecodeString(*token)
+		if err != nil {
+			return 0, 0, nil, apiError("InvalidNextToken", "The specified token isn't valid.")
+		}
+
+		start = -1
+		for i, id := range ids {
+			if id == string(after) {
+				start = i + 1
+				break
+			}
+		}
+
+		if start < 0 {
+			return 0, 0, nil, apiError("InvalidNextToken", "The specified token isn't valid.")
+		}
+	}
+
+	end := len(ids)
+	if maxResults > 0 && start+int(maxResults) < end {
+		end = start + int(maxResults)
+	}
+
+	var next *string
+	if end < len(ids) {
+		next = aws.String(base64.RawURLEncoding.EncodeToString([]byte(ids[end-1])))
+	}
+
+	return start, end, next, nil
+}
+
+// regionOutput returns the Region as DescribeRegions reports it.
+func regionOutput(r *region) types.Region {
+	return types.Region{
+		RegionName:  aws.String(r.name),
+		Endpoint:    aws.String("ec2." + r.name + ".amazonaws.com"),
+		OptInStatus: aws.String(r.optInStatus),
+	}
+}
+
+// filterValues returns a resource's values for a filter name, and whether the filter is supported.
+type filterValues func(name string) ([]string, bool)
+
+// tagValues returns the values of the tag:KEY and tag-key filters for tags.
+func tagValues(tags []types.Tag, name string) ([]string, bool) {
+	if name == "tag-key" {
+		var keys []string
+		for _, tag := range tags {
+			keys = append(keys, aws.ToString(tag.Key))
+		}
+
+		return keys, true
+	}
+
+	if strings.HasPrefix(name, "tag:") {
+		for _, tag := range tags {
+			if aws.ToString(tag.Key) == name[len("tag:"):] {
+				return []string{aws.ToString(tag.Value)}, true
+			}
+		}
+
+		return nil, true
+	}
+
+	return nil, false
+}
+
+// wildcard returns a regular expression for a filter value, in which * matches any characters and ? matches one.
+func wildcard(value string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(value)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+
+	return regexp.MustCompile("^" + pattern + "$")
+}
+
+// matchFilters reports whether a resource matches every filter,
+// which it does if any of its values for the filter's name matches any of the filter's values.
+func matchFilters(filters []types.Filter, values filterValues) (bool, error) {
+	for _, filter := range filters {
+		name := aws.ToString(filter.Name)
+
+		have, ok := values(name)
+		if !ok {
+			return false, apiError("InvalidParameterValue", "The filter '"+name+"' is invalid")
+		}
+
+		matched := false
+		for _, want := range filter.Values {
+			re := wildcard(want)
+			for _, v := range have {
+				if re.MatchString(v) {
+					matched = true
+				}
+			}
+		}
+
+		if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,387 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ec2fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+func inRegion(region string) func(*ec2.Options) {
+	return func(o *ec2.Options) {
+		o.Region = region
+	}
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	return ""
+}
+
+func TestDescribeRegions(t *testing.T) {
+	s := New()
+	s.AddRegion("ap-east-1", OptedIn)
+	ctx := context.Background()
+
+	output, err := s.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Regions) != 7 || aws.ToString(output.Regions[0].RegionName) != "ap-east-1" {
+		t.Errorf("got %d Regions, want the 7 enabled ones", len(output.Regions))
+	}
+
+	output, err = s.DescribeRegions(ctx, &ec2.DescribeRegionsInput{
+		AllRegions: true,
+		Filters:    []types.Filter{{Name: aws.String("opt-in-status"), Values: []string{NotOptedIn}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Regions) != 1 || aws.ToString(output.Regions[0].RegionName) != "af-south-1" {
+		t.Errorf("got %+v, want af-south-1", output.Regions)
+	}
+
+	_, err = s.DescribeInstances(ctx, &ec2.DescribeInstancesInput{}, inRegion("af-south-1"))
+	if errorCode(err) != "AuthFailure" {
+		t.Errorf("got %v, want AuthFailure", err)
+	}
+
+	_, err = s.DescribeRegions(ctx, &ec2.DescribeRegionsInput{Filters: []types.Filter{{Name: aws.String("state")}}})
+	if errorCode(err) != "InvalidParameterValue" {
+		t.Errorf("got %v, want InvalidParameterValue", err)
+	}
+}
+
+func TestDescribeInstances(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	var ids []string
+	for i := 0; i < 12; i++ {
+		ids = append(ids, s.AddInstance("us-east-1", types.Instance{
+			Tags: []types.Tag{{Key: aws.String("team"), Value: aws.String([]string{"web", "data"}[i%2])}},
+		}))
+	}
+
+	s.AddInstance("us-west-2", types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameStopped}})
+
+	// Page through the web instances in us-east-1
+	input := &ec2.DescribeInstancesInput{
+		MaxResults: 5,
+		Filters:    []types.Filter{{Name: aws.String("tag:team"), Values: []string{"w*"}}},
+	}
+
+	var got []string
+	for pages := 1; ; pages++ {
+		output, err := s.DescribeInstances(ctx, input, inRegion("us-east-1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range output.Reservations {
+			for _, instance := range r.Instances {
+				got = append(got, aws.ToString(instance.InstanceId))
+			}
+		}
+
+		if output.NextToken == nil {
+			if pages != 2 {
+				t.Errorf("got %d pages, want 2", pages)
+			}
+
+			break
+		}
+
+		input.NextToken = output.NextToken
+	}
+
+	if len(got) != 6 || got[0] != ids[0] || got[5] != ids[10] {
+		t.Errorf("got %v", got)
+	}
+
+	output, err := s.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("instance-type"), Values: []string{"t2.micro"}},
+			{Name: aws.String("availability-zone"), Values: []string{"us-east-1a"}},
+			{Name: aws.String("tag-key"), Values: []string{"team"}},
+			{Name: aws.String("vpc-id"), Values: []string{"vpc-*"}},
+		},
+	}, inRegion("us-east-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Reservations) != 0 {
+		t.Errorf("got %d reservations, want none, as the instances aren't in a VPC", len(output.Reservations))
+	}
+
+	// The default Region is us-west-2
+	output, err = s.DescribeInstances(ctx, &ec2.DescribeInstancesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Reservations) != 1 || output.Reservations[0].Instances[0].State.Code != 80 {
+		t.Errorf("got %+v, want the stopped instance", output.Reservations)
+	}
+
+	_, err = s.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{ids[0]}})
+	if errorCode(err) != "InvalidInstanceID.NotFound" {
+		t.Errorf("got %v, want InvalidInstanceID.NotFound", err)
+	}
+
+	_, err = s.DescribeInstances(ctx, &ec2.DescribeInstancesInput{DryRun: true})
+	if errorCode(err) != "DryRunOperation" {
+		t.Errorf("got %v, want DryRunOperation", err)
+	}
+}
+
+// state returns the state of an instance, as DescribeInstances reports it.
+func state(t *testing.T, s *Service, id string) types.InstanceStateName {
+	t.Helper()
+
+	output, err := s.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{InstanceIds: []string{id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output.Reservations[0].Instances[0].State.Name
+}
+
+// status returns the instance status check of an instance, or "" if it isn't reported.
+func status(t *testing.T, s *Service, id string) types.SummaryStatus {
+	t.Helper()
+
+	output, err := s.DescribeInstanceStatus(context.Background(), &ec2.DescribeInstanceStatusInput{InstanceIds: []string{id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.InstanceStatuses) == 0 {
+		return ""
+	}
+
+	return output.InstanceStatuses[0].InstanceStatus.Status
+}
+
+func TestInstanceStates(t *testing.T) {
+	now := time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+	s := New()
+	s.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.AddKeyPair("us-west-2", "aws-docs-example-key")
+
+	launched, err := s.RunInstances(ctx, &ec2.RunInstancesInput{
+		ImageId:  aws.String("ami-0123456789abcdef0"),
+		KeyName:  aws.String("aws-docs-example-key"),
+		MinCount: 1,
+		MaxCount: 2,
+		TagSpecifications: []types.TagSpecification{{
+			ResourceType: types.ResourceTypeInstance,
+			Tags:         []types.Tag{{Key: aws.String("Name"), Value: aws.String("example")}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(launched.Instances) != 2 || launched.Instances[0].State.Name != types.InstanceStateNamePending {
+		t.Fatalf("got %+v, want 2 pending instances", launched.Instances)
+	}
+
+	id := aws.ToString(launched.Instances[0].InstanceId)
+	other := aws.ToString(launched.Instances[1].InstanceId)
+
+	// The instances are running after TransitionTime, and their checks pass after StatusCheckTime
+	now = now.Add(29 * time.Second)
+	if got := state(t, s, id); got != types.InstanceStateNamePending {
+		t.Errorf("got %s, want pending", got)
+	}
+
+	now = now.Add(time.Second)
+	if got := state(t, s, id); got != types.InstanceStateNameRunning {
+		t.Errorf("got %s, want running", got)
+	}
+
+	if got := status(t, s, id); got != types.SummaryStatusInitializing {
+		t.Errorf("got %s, want initializing", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := status(t, s, id); got != types.SummaryStatusOk {
+		t.Errorf("got %s, want ok", got)
+	}
+
+	// A reboot resets the status checks
+	if _, err := s.RebootInstances(ctx, &ec2.RebootInstancesInput{InstanceIds: []string{id}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := status(t, s, id); got != types.SummaryStatusInitializing {
+		t.Errorf("got %s after the reboot, want initializing", got)
+	}
+
+	// A held instance stays stopping until it's released
+	s.Hold(other)
+
+	stopped, err := s.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{id, other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := stopped.StoppingInstances[0]; c.PreviousState.Name != types.InstanceStateNameRunning || c.CurrentState.Name != types.InstanceStateNameStopping {
+		t.Errorf("got %+v, want running to stopping", c)
+	}
+
+	now = now.Add(time.Minute)
+	if got := state(t, s, id); got != types.InstanceStateNameStopped {
+		t.Errorf("got %s, want stopped", got)
+	}
+
+	if got := state(t, s, other); got != types.InstanceStateNameStopping {
+		t.Errorf("got %s, want the held instance stopping", got)
+	}
+
+	if got := status(t, s, id); got != "" {
+		t.Errorf("got %s, want no status for a stopped instance", got)
+	}
+
+	s.Release(other)
+	now = now.Add(30 * time.Second)
+	if got := state(t, s, other); got != types.InstanceStateNameStopped {
+		t.Errorf("got %s, want the released instance stopped", got)
+	}
+
+	// Starting and stopping can't be mixed up
+	_, err = s.RebootInstances(ctx, &ec2.RebootInstancesInput{InstanceIds: []string{id}})
+	if errorCode(err) != "IncorrectInstanceState" {
+		t.Errorf("got %v, want IncorrectInstanceState", err)
+	}
+
+	if _, err := s.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{id}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := state(t, s, id); got != types.InstanceStateNamePending {
+		t.Errorf("got %s, want pending", got)
+	}
+
+	_, err = s.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{id}, DryRun: true})
+	if errorCode(err) != "DryRunOperation" {
+		t.Errorf("got %v, want DryRunOperation", err)
+	}
+}
+
+func TestRunInstances(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	_, err := s.RunInstances(ctx, &ec2.RunInstancesInput{ImageId: aws.String("ami-0123456789abcdef0"), MinCount: 2, MaxCount: 1})
+	if errorCode(err) != "InvalidParameterValue" {
+		t.Errorf("got %v, want InvalidParameterValue", err)
+	}
+
+	_, err = s.RunInstances(ctx, &ec2.RunInstancesInput{
+		ImageId:  aws.String("ami-0123456789abcdef0"),
+		KeyName:  aws.String("aws-docs-example-key"),
+		MinCount: 1,
+		MaxCount: 1,
+	})
+	if errorCode(err) != "InvalidKeyPair.NotFound" {
+		t.Errorf("got %v, want InvalidKeyPair.NotFound", err)
+	}
+
+	launched, err := s.RunInstances(ctx, &ec2.RunInstancesInput{ImageId: aws.String("ami-0123456789abcdef0"), MinCount: 1, MaxCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := aws.ToString(launched.Instances[0].InstanceId)
+	_, err = s.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{id},
+		Tags:      []types.Tag{{Key: aws.String("Name"), Value: aws.String("example")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := s.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{{Name: aws.String("tag:Name"), Values: []string{"example"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Reservations) != 1 || output.Reservations[0].Instances[0].InstanceType != types.InstanceTypeM1Small {
+		t.Errorf("got %+v, want the tagged m1.small instance", output.Reservations)
+	}
+
+	_, err = s.CreateTags(ctx, &ec2.CreateTagsInput{Resources: []string{"i-0123456789abcdef0"}})
+	if errorCode(err) != "InvalidInstanceID.NotFound" {
+		t.Errorf("got %v, want InvalidInstanceID.NotFound", err)
+	}
+}
+
+func TestDescribeResources(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	id := s.AddAddress("eu-west-1", types.Address{PublicIp: aws.String("192.0.2.10")})
+	s.AddKeyPair("eu-west-1", "aws-docs-example-key")
+	s.AddVpcEndpointConnection("eu-west-1", types.VpcEndpointConnection{ServiceId: aws.String("vpce-svc-0123456789abcdef0")})
+
+	addresses, err := s.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{PublicIps: []string{"192.0.2.10"}}, inRegion("eu-west-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(addresses.Addresses) != 1 || aws.ToString(addresses.Addresses[0].AllocationId) != id {
+		t.Errorf("got %+v", addresses.Addresses)
+	}
+
+	keys, err := s.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{}, inRegion("eu-west-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys.KeyPairs) != 1 || aws.ToString(keys.KeyPairs[0].KeyName) != "aws-docs-example-key" {
+		t.Errorf("got %+v", keys.KeyPairs)
+	}
+
+	connections, err := s.DescribeVpcEndpointConnections(ctx, &ec2.DescribeVpcEndpointConnectionsInput{
+		Filters: []types.Filter{{Name: aws.String("vpc-endpoint-state"), Values: []string{"PendingAcceptance"}}},
+	}, inRegion("eu-west-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(connections.VpcEndpointConnections) != 1 {
+		t.Errorf("got %+v", connections.VpcEndpointConnections)
+	}
+
+	// Other Regions have their own resources
+	keys, err = s.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{}, inRegion("us-east-1"))
+	if err != nil || len(keys.KeyPairs) != 0 {
+		t.Errorf("got %v, %v, want no key pairs", keys, err)
+	}
+
+	_, err = s.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{KeyNames: []string{"aws-docs-example-key"}})
+	if errorCode(err) != "InvalidKeyPair.NotFound" {
+		t.Errorf("got %v, want InvalidKeyPair.NotFound", err)
+	}
+}
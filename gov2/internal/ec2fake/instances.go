@@ -0,0 +1,617 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ec2fake
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// stateCodes are the codes that Amazon EC2 reports with each instance state.
+var stateCodes = map[types.InstanceStateName]int32{
+	types.InstanceStateNamePending:      0,
+	types.InstanceStateNameRunning:      16,
+	types.InstanceStateNameShuttingDown: 32,
+	types.InstanceStateNameTerminated:   48,
+	types.InstanceStateNameStopping:     64,
+	types.InstanceStateNameStopped:      80,
+}
+
+// settled are the states that each transitional state ends in.
+var settled = map[types.InstanceStateName]types.InstanceStateName{
+	types.InstanceStateNamePending:      types.InstanceStateNameRunning,
+	types.InstanceStateNameStopping:     types.InstanceStateNameStopped,
+	types.InstanceStateNameShuttingDown: types.InstanceStateNameTerminated,
+}
+
+type instance struct {
+	types.Instance
+
+	// changed is when the instance entered its current state,
+	// and held keeps it there, if the state is transitional
+	changed time.Time
+	held    bool
+
+	// statusOK is when the status checks of a running instance pass
+	statusOK time.Time
+}
+
+// setState moves the instance to a state at a time.
+func (s *Service) setState(i *instance, state types.InstanceStateName, at time.Time) {
+	i.State = &types.InstanceState{Name: state, Code: stateCodes[state]}
+	i.changed = at
+
+	if state == types.InstanceStateNameRunning {
+		i.statusOK = at.Add(s.StatusCheckTime)
+	}
+}
+
+// advance moves the instance on from a transitional state, if it has been in it for TransitionTime.
+// The caller must hold s.mu.
+func (s *Service) advance(i *instance) {
+	next, ok := settled[i.State.Name]
+	if !ok || i.held {
+		return
+	}
+
+	if at := i.changed.Add(s.TransitionTime); !s.Now().Before(at) {
+		s.setState(i, next, at)
+	}
+}
+
+// AddInstance adds an instance to a Region, in a reservation of its own, and returns its ID.
+// Unless the instance has them, it gets an instance ID, the running state, the t2.micro type,
+// the first Availability Zone of the Region, and the current time as its launch time.
+// It panics if the Region doesn't exist.
+func (s *Service) AddInstance(regionName string, i types.Instance) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRegion(regionName)
+
+	if i.InstanceId == nil {
+		i.InstanceId = aws.String(s.id("i"))
+	}
+
+	state := types.InstanceStateNameRunning
+	if i.State != nil {
+		state = i.State.Name
+	}
+
+	if i.InstanceType == "" {
+		i.InstanceType = types.InstanceTypeT2Micro
+	}
+
+	if i.Placement == nil {
+		i.Placement = &types.Placement{}
+	}
+
+	if i.Placement.AvailabilityZone == nil {
+		i.Placement.AvailabilityZone = aws.String(r.name + "a")
+	}
+
+	if i.LaunchTime == nil {
+		i.LaunchTime = aws.Time(s.Now())
+	}
+
+	added := &instance{Instance: i}
+	s.setState(added, state, s.Now())
+
+	r.reservations = append(r.reservations, &reservation{
+		id:        s.id("r"),
+		instances: []*instance{added},
+	})
+
+	return *i.InstanceId
+}
+
+// Hold keeps an instance in its current state, as if it were stuck, until Release is called.
+func (s *Service) Hold(instanceID string) {
+	s.setHeld(instanceID, true)
+}
+
+// Release lets an instance that Hold kept in a transitional state move on from it.
+// The instance moves on TransitionTime after Release is called.
+func (s *Service) Release(instanceID string) {
+	s.setHeld(instanceID, false)
+}
+
+func (s *Service) setHeld(instanceID string, held bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.regions {
+		if i := r.instance(instanceID); i != nil {
+			if !held {
+				i.changed = s.Now()
+			}
+
+			i.held = held
+		}
+	}
+}
+
+// instance returns the instance with the ID, or nil.
+func (r *region) instance(id string) *instance {
+	for _, res := range r.reservations {
+		for _, i := range res.instances {
+			if aws.ToString(i.InstanceId) == id {
+				return i
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupInstances returns the instances with the IDs, after advancing their states.
+// The caller must hold s.mu.
+func (s *Service) lookupInstances(r *region, ids []string) ([]*instance, error) {
+	if len(ids) == 0 {
+		return nil, apiError("MissingParameter", "The request must contain the parameter InstanceId")
+	}
+
+	var found []*instance
+	for _, id := range ids {
+		i := r.instance(id)
+		if i == nil {
+			return nil, apiError("InvalidInstanceID.NotFound", "The instance ID '"+id+"' does not exist")
+		}
+
+		s.advance(i)
+		found = append(found, i)
+	}
+
+	return found, nil
+}
+
+// output returns a copy of the instance, as DescribeInstances reports it.
+func (i *instance) output() types.Instance {
+	out := i.Instance
+	state := *out.State
+	out.State = &state
+	out.Tags = append([]types.Tag(nil), out.Tags...)
+
+	return out
+}
+
+// instanceFilter returns the values of an instance for a DescribeInstances filter.
+func instanceFilter(i *instance, filter string) ([]string, bool) {
+	switch filter {
+	case "instance-id":
+		return optional(i.InstanceId), true
+	case "instance-state-name":
+		return []string{string(i.State.Name)}, true
+	case "instance-type":
+		return []string{string(i.InstanceType)}, true
+	case "availability-zone":
+		return optional(i.Placement.AvailabilityZone), true
+	case "vpc-id":
+		return optional(i.VpcId), true
+	case "subnet-id":
+		return optional(i.SubnetId), true
+	case "private-ip-address":
+		return optional(i.PrivateIpAddress), true
+	case "ip-address":
+		return optional(i.PublicIpAddress), true
+	case "launch-time":
+		return []string{i.LaunchTime.UTC().Format("2006-01-02T15:04:05.000Z")}, true
+	}
+
+	return tagValues(i.Tags, filter)
+}
+
+// DescribeInstances lists the instances in the Region of the call, a page at a time,
+// grouped by reservation. It supports the instance-id, instance-state-name, instance-type, availability-zone,
+// vpc-id, subnet-id, private-ip-address, ip-address, launch-time, tag-key, and tag:KEY filters.
+// As in Amazon EC2, MaxResults can't be combined with InstanceIds.
+func (s *Service) DescribeInstances(ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	if params.MaxResults != 0 && (len(params.InstanceIds) > 0 || params.MaxResults < 5 || params.MaxResults > 1000) {
+		return nil, apiError("InvalidParameterCombination", "MaxResults must be between 5 and 1000, and can't be used with InstanceIds")
+	}
+
+	var all []*string
+	for _, res := range r.reservations {
+		for _, i := range res.instances {
+			s.advance(i)
+			all = append(all, i.InstanceId)
+		}
+	}
+
+	if id := missing(params.InstanceIds, all); id != "" {
+		return nil, apiError("InvalidInstanceID.NotFound", "The instance ID '"+id+"' does not exist")
+	}
+
+	// The matching instances, in launch order, with the reservation of each
+	var matches []*instance
+	var owners []*reservation
+	var ids []string
+
+	for _, res := range r.reservations {
+		for _, i := range res.instances {
+			if !contains(params.InstanceIds, i.InstanceId) {
+				continue
+			}
+
+			ok, err := matchFilters(params.Filters, func(filter string) ([]string, bool) {
+				return instanceFilter(i, filter)
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				matches = append(matches, i)
+				owners = append(owners, res)
+				ids = append(ids, *i.InstanceId)
+			}
+		}
+	}
+
+	start, end, next, err := page(ids, params.MaxResults, params.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeInstancesOutput{NextToken: next}
+	for i := start; i < end; i++ {
+		// Consecutive instances of a reservation share its entry in the output
+		if n := len(output.Reservations); n > 0 && i > start && owners[i] == owners[i-1] {
+			output.Reservations[n-1].Instances = append(output.Reservations[n-1].Instances, matches[i].output())
+			continue
+		}
+
+		output.Reservations = append(output.Reservations, types.Reservation{
+			ReservationId: aws.String(owners[i].id),
+			OwnerId:       aws.String(s.AccountID),
+			Instances:     []types.Instance{matches[i].output()},
+		})
+	}
+
+	return output, nil
+}
+
+// RunInstances launches MaxCount instances, in one reservation, in the pending state.
+// It uses ImageId, InstanceType, KeyName, SubnetId, SecurityGroupIds, and the instance TagSpecifications,
+// and checks that UserData is base64-encoded.
+// The default instance type is m1.small, as in Amazon EC2.
+func (s *Service) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.ImageId == nil {
+		return nil, apiError("MissingParameter", "The request must contain the parameter ImageId")
+	}
+
+	if params.MinCount < 1 || params.MaxCount < params.MinCount {
+		return nil, apiError("InvalidParameterValue", "MinCount must be at least 1, and MaxCount at least MinCount")
+	}
+
+	if params.KeyName != nil {
+		var names []*string
+		for _, key := range r.keyPairs {
+			names = append(names, key.KeyName)
+		}
+
+		if name := missing([]string{*params.KeyName}, names); name != "" {
+			return nil, apiError("InvalidKeyPair.NotFound", "The key pair '"+name+"' does not exist")
+		}
+	}
+
+	if params.UserData != nil {
+		if _, err := base64.StdEncoding.DecodeString(*params.UserData); err != nil {
+			return nil, apiError("InvalidParameterValue", "Invalid BASE64 encoding of user data")
+		}
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	instanceType := params.InstanceType
+	if instanceType == "" {
+		instanceType = types.InstanceTypeM1Small
+	}
+
+	var tags []types.Tag
+	for _, spec := range params.TagSpecifications {
+		if spec.ResourceType == types.ResourceTypeInstance {
+			tags = append(tags, spec.Tags...)
+		}
+	}
+
+	res := &reservation{id: s.id("r")}
+	output := &ec2.RunInstancesOutput{
+		ReservationId: aws.String(res.id),
+		OwnerId:       aws.String(s.AccountID),
+	}
+
+	now := s.Now()
+	for n := int32(0); n < params.MaxCount; n++ {
+		launched := &instance{Instance: types.Instance{
+			InstanceId:   aws.String(s.id("i")),
+			ImageId:      params.ImageId,
+			InstanceType: instanceType,
+			KeyName:      params.KeyName,
+			SubnetId:     params.SubnetId,
+			LaunchTime:   aws.Time(now),
+			Placement:    &types.Placement{AvailabilityZone: aws.String(r.name + "a")},
+			Tags:         append([]types.Tag(nil), tags...),
+		}}
+
+		for _, id := range params.SecurityGroupIds {
+			launched.SecurityGroups = append(launched.SecurityGroups, types.GroupIdentifier{GroupId: aws.String(id)})
+		}
+
+		s.setState(launched, types.InstanceStateNamePending, now)
+		res.instances = append(res.instances, launched)
+		output.Instances = append(output.Instances, launched.output())
+	}
+
+	r.reservations = append(r.reservations, res)
+
+	return output, nil
+}
+
+// CreateTags adds tags to instances, or replaces the values of tags they have.
+func (s *Service) CreateTags(ctx context.Context,
+	params *ec2.CreateTagsInput,
+	optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := s.lookupInstances(r, params.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	for _, i := range instances {
+	tags:
+		for _, tag := range params.Tags {
+			for n := range i.Tags {
+				if aws.ToString(i.Tags[n].Key) == aws.ToString(tag.Key) {
+					i.Tags[n].Value = tag.Value
+					continue tags
+				}
+			}
+
+			i.Tags = append(i.Tags, tag)
+		}
+	}
+
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+// changeStates moves the instances that are in one of the from states to the to state,
+// and reports each instance's change. Instances that are in to, or in the state it ends in, are left alone.
+// If an instance is in any other state, no instance changes, and the error names the action.
+// The caller must hold s.mu.
+func (s *Service) changeStates(instances []*instance, action string,
+	to types.InstanceStateName, from ...types.InstanceStateName) ([]types.InstanceStateChange, error) {
+	for _, i := range instances {
+		if i.State.Name == to || i.State.Name == settled[to] {
+			continue
+		}
+
+		allowed := false
+		for _, state := range from {
+			if i.State.Name == state {
+				allowed = true
+			}
+		}
+
+		if !allowed {
+			return nil, apiError("IncorrectInstanceState",
+				"The instance '"+aws.ToString(i.InstanceId)+"' is not in a state from which it can be "+action)
+		}
+	}
+
+	var changes []types.InstanceStateChange
+	for _, i := range instances {
+		previous := *i.State
+		if i.State.Name != to && i.State.Name != settled[to] {
+			s.setState(i, to, s.Now())
+		}
+
+		current := *i.State
+		changes = append(changes, types.InstanceStateChange{
+			InstanceId:    i.InstanceId,
+			PreviousState: &previous,
+			CurrentState:  &current,
+		})
+	}
+
+	return changes, nil
+}
+
+// StartInstances starts stopped instances, which are pending for TransitionTime.
+func (s *Service) StartInstances(ctx context.Context,
+	params *ec2.StartInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := s.lookupInstances(r, params.InstanceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	changes, err := s.changeStates(instances, "started", types.InstanceStateNamePending, types.InstanceStateNameStopped)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ec2.StartInstancesOutput{StartingInstances: changes}, nil
+}
+
+// StopInstances stops pending or running instances, which are stopping for TransitionTime.
+func (s *Service) StopInstances(ctx context.Context,
+	params *ec2.StopInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := s.lookupInstances(r, params.InstanceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	changes, err := s.changeStates(instances, "stopped", types.InstanceStateNameStopping,
+		types.InstanceStateNamePending, types.InstanceStateNameRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ec2.StopInstancesOutput{StoppingInstances: changes}, nil
+}
+
+// RebootInstances reboots running instances. They stay running,
+// and their status checks are initializing for StatusCheckTime.
+func (s *Service) RebootInstances(ctx context.Context,
+	params *ec2.RebootInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := s.lookupInstances(r, params.InstanceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	for _, i := range instances {
+		if i.State.Name != types.InstanceStateNameRunning {
+			return nil, apiError("IncorrectInstanceState", "The instance '"+aws.ToString(i.InstanceId)+"' is not running")
+		}
+	}
+
+	for _, i := range instances {
+		if !i.held {
+			i.statusOK = s.Now().Add(s.StatusCheckTime)
+		}
+	}
+
+	return &ec2.RebootInstancesOutput{}, nil
+}
+
+// DescribeInstanceStatus reports the status checks of instances.
+// Unless IncludeAllInstances is set, it reports only running instances.
+// The checks of an instance that Hold keeps are initializing until it's released.
+func (s *Service) DescribeInstanceStatus(ctx context.Context,
+	params *ec2.DescribeInstanceStatusInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	var instances []*instance
+	if len(params.InstanceIds) > 0 {
+		instances, err = s.lookupInstances(r, params.InstanceIds)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, res := range r.reservations {
+			for _, i := range res.instances {
+				s.advance(i)
+				instances = append(instances, i)
+			}
+		}
+	}
+
+	output := &ec2.DescribeInstanceStatusOutput{}
+	for _, i := range instances {
+		running := i.State.Name == types.InstanceStateNameRunning
+		if !running && !params.IncludeAllInstances {
+			continue
+		}
+
+		status := types.SummaryStatusNotApplicable
+		if running {
+			status = types.SummaryStatusOk
+			if i.held || s.Now().Before(i.statusOK) {
+				status = types.SummaryStatusInitializing
+			}
+		}
+
+		state := *i.State
+		output.InstanceStatuses = append(output.InstanceStatuses, types.InstanceStatus{
+			InstanceId:       i.InstanceId,
+			AvailabilityZone: i.Placement.AvailabilityZone,
+			InstanceState:    &state,
+			InstanceStatus:   &types.InstanceStatusSummary{Status: status},
+			SystemStatus:     &types.InstanceStatusSummary{Status: status},
+		})
+	}
+
+	return output, nil
+}
@@ -0,0 +1,375 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ec2fake
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// DescribeRegions lists the Regions, in name order.
+// Unless AllRegions is set, it lists only the Regions that are enabled.
+// It supports the region-name, endpoint, and opt-in-status filters.
+func (s *Service) DescribeRegions(ctx context.Context,
+	params *ec2.DescribeRegionsInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	names := params.RegionNames
+	if len(names) == 0 {
+		for name := range s.regions {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+	}
+
+	output := &ec2.DescribeRegionsOutput{}
+	for _, name := range names {
+		r, ok := s.regions[name]
+		if !ok {
+			return nil, apiError("InvalidParameterValue", "Invalid region: "+name)
+		}
+
+		if !params.AllRegions && !enabled(r.optInStatus) {
+			continue
+		}
+
+		out := regionOutput(r)
+
+		ok, err := matchFilters(params.Filters, func(filter string) ([]string, bool) {
+			switch filter {
+			case "region-name":
+				return []string{r.name}, true
+			case "endpoint":
+				return []string{aws.ToString(out.Endpoint)}, true
+			case "opt-in-status":
+				return []string{r.optInStatus}, true
+			}
+
+			return nil, false
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			output.Regions = append(output.Regions, out)
+		}
+	}
+
+	return output, nil
+}
+
+// AddAddress adds an Elastic IP address to a Region, and returns its allocation ID.
+// Unless the address has them, it gets an allocation ID and the vpc domain.
+// It panics if the Region doesn't exist.
+func (s *Service) AddAddress(regionName string, address types.Address) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRegion(regionName)
+
+	if address.AllocationId == nil {
+		address.AllocationId = aws.String(s.id("eipalloc"))
+	}
+
+	if address.Domain == "" {
+		address.Domain = types.DomainTypeVpc
+	}
+
+	r.addresses = append(r.addresses, address)
+
+	return *address.AllocationId
+}
+
+// DescribeAddresses lists the Elastic IP addresses in the Region of the call.
+// It supports the allocation-id, association-id, domain, instance-id, public-ip, tag-key, and tag:KEY filters.
+func (s *Service) DescribeAddresses(ctx context.Context,
+	params *ec2.DescribeAddressesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	var allocationIDs, publicIPs []*string
+	for _, address := range r.addresses {
+		allocationIDs = append(allocationIDs, address.AllocationId)
+		publicIPs = append(publicIPs, address.PublicIp)
+	}
+
+	if id := missing(params.AllocationIds, allocationIDs); id != "" {
+		return nil, apiError("InvalidAllocationID.NotFound", "The allocation ID '"+id+"' does not exist")
+	}
+
+	if ip := missing(params.PublicIps, publicIPs); ip != "" {
+		return nil, apiError("InvalidAddress.NotFound", "Address '"+ip+"' not found.")
+	}
+
+	output := &ec2.DescribeAddressesOutput{}
+	for _, address := range r.addresses {
+		if !contains(params.AllocationIds, address.AllocationId) || !contains(params.PublicIps, address.PublicIp) {
+			continue
+		}
+
+		ok, err := matchFilters(params.Filters, func(filter string) ([]string, bool) {
+			switch filter {
+			case "allocation-id":
+				return optional(address.AllocationId), true
+			case "association-id":
+				return optional(address.AssociationId), true
+			case "domain":
+				return []string{string(address.Domain)}, true
+			case "instance-id":
+				return optional(address.InstanceId), true
+			case "public-ip":
+				return optional(address.PublicIp), true
+			}
+
+			return tagValues(address.Tags, filter)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			output.Addresses = append(output.Addresses, address)
+		}
+	}
+
+	return output, nil
+}
+
+// AddKeyPair adds a key pair to a Region, and returns its ID.
+// It panics if the Region doesn't exist.
+func (s *Service) AddKeyPair(regionName, keyName string, tags ...types.Tag) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRegion(regionName)
+	id := s.id("key")
+
+	sum := md5.Sum([]byte(id))
+	fingerprint := make([]string, len(sum))
+	for i, b := range sum {
+		fingerprint[i] = fmt.Sprintf("%02x", b)
+	}
+
+	r.keyPairs = append(r.keyPairs, types.KeyPairInfo{
+		KeyName:        aws.String(keyName),
+		KeyPairId:      aws.String(id),
+		KeyFingerprint: aws.String(strings.Join(fingerprint, ":")),
+		Tags:           tags,
+	})
+
+	return id
+}
+
+// DescribeKeyPairs lists the key pairs in the Region of the call.
+// It supports the key-name, key-pair-id, fingerprint, tag-key, and tag:KEY filters.
+func (s *Service) DescribeKeyPairs(ctx context.Context,
+	params *ec2.DescribeKeyPairsInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	var names, ids []*string
+	for _, key := range r.keyPairs {
+		names = append(names, key.KeyName)
+		ids = append(ids, key.KeyPairId)
+	}
+
+	if name := missing(params.KeyNames, names); name != "" {
+		return nil, apiError("InvalidKeyPair.NotFound", "The key pair '"+name+"' does not exist")
+	}
+
+	if id := missing(params.KeyPairIds, ids); id != "" {
+		return nil, apiError("InvalidKeyPair.NotFound", "The key pair ID '"+id+"' does not exist")
+	}
+
+	output := &ec2.DescribeKeyPairsOutput{}
+	for _, key := range r.keyPairs {
+		if !contains(params.KeyNames, key.KeyName) || !contains(params.KeyPairIds, key.KeyPairId) {
+			continue
+		}
+
+		ok, err := matchFilters(params.Filters, func(filter string) ([]string, bool) {
+			switch filter {
+			case "key-name":
+				return optional(key.KeyName), true
+			case "key-pair-id":
+				return optional(key.KeyPairId), true
+			case "fingerprint":
+				return optional(key.KeyFingerprint), true
+			}
+
+			return tagValues(key.Tags, filter)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			output.KeyPairs = append(output.KeyPairs, key)
+		}
+	}
+
+	return output, nil
+}
+
+// AddVpcEndpointConnection adds a connection to one of your VPC endpoint services to a Region,
+// and returns the ID of the connecting endpoint.
+// Unless the connection has them, it gets an endpoint ID, the PendingAcceptance state, and a creation time.
+// It panics if the Region doesn't exist.
+func (s *Service) AddVpcEndpointConnection(regionName string, connection types.VpcEndpointConnection) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRegion(regionName)
+
+	if connection.VpcEndpointId == nil {
+		connection.VpcEndpointId = aws.String(s.id("vpce"))
+	}
+
+	if connection.VpcEndpointState == "" {
+		connection.VpcEndpointState = types.StatePendingacceptance
+	}
+
+	if connection.CreationTimestamp == nil {
+		connection.CreationTimestamp = aws.Time(s.Now())
+	}
+
+	r.connections = append(r.connections, connection)
+
+	return *connection.VpcEndpointId
+}
+
+// DescribeVpcEndpointConnections lists the connections to your VPC endpoint services in the Region of the call,
+// a page at a time. It supports the service-id, vpc-endpoint-id, vpc-endpoint-owner, and vpc-endpoint-state filters.
+func (s *Service) DescribeVpcEndpointConnections(ctx context.Context,
+	params *ec2.DescribeVpcEndpointConnectionsInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeVpcEndpointConnectionsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.region(optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DryRun {
+		return nil, dryRun()
+	}
+
+	if params.MaxResults != 0 && (params.MaxResults < 5 || params.MaxResults > 1000) {
+		return nil, apiError("InvalidParameterValue", "MaxResults must be between 5 and 1000")
+	}
+
+	var matches []types.VpcEndpointConnection
+	var ids []string
+	for _, connection := range r.connections {
+		ok, err := matchFilters(params.Filters, func(filter string) ([]string, bool) {
+			switch filter {
+			case "service-id":
+				return optional(connection.ServiceId), true
+			case "vpc-endpoint-id":
+				return optional(connection.VpcEndpointId), true
+			case "vpc-endpoint-owner":
+				return optional(connection.VpcEndpointOwner), true
+			case "vpc-endpoint-state":
+				return []string{string(connection.VpcEndpointState)}, true
+			}
+
+			return nil, false
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			matches = append(matches, connection)
+			ids = append(ids, aws.ToString(connection.VpcEndpointId))
+		}
+	}
+
+	start, end, next, err := page(ids, params.MaxResults, params.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ec2.DescribeVpcEndpointConnectionsOutput{
+		VpcEndpointConnections: matches[start:end],
+		NextToken:              next,
+	}, nil
+}
+
+// contains reports whether value is in list, or list is empty.
+func contains(list []string, value *string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, v := range list {
+		if v == aws.ToString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// optional returns the values of a filter on an optional field.
+func optional(value *string) []string {
+	if value == nil {
+		return nil
+	}
+
+	return []string{*value}
+}
+
+// missing returns the first of the requested IDs that isn't in have, or "" if they all are.
+func missing(requested []string, have []*string) string {
+	for _, id := range requested {
+		ok := false
+		for _, h := range have {
+			if aws.ToString(h) == id {
+				ok = true
+			}
+		}
+
+		if !ok {
+			return id
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,236 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package ec2wait waits for Amazon Elastic Compute Cloud (Amazon EC2) instances to reach a state,
+// for the gov2/ec2 examples that start, stop, reboot, and launch instances.
+//
+// Wait checks the instances, up to MaxIDs of them per call, until each one is in the target state
+// or in a state from which it can't reach the target, or the time is up.
+// The time between checks starts at Options.MinDelay and doubles after each check, up to Options.MaxDelay.
+// WaitForRunning and WaitForStopped check the instances with DescribeInstances,
+// and the examples supply other checks, such as a call to DescribeInstanceStatus.
+// Instances that didn't make it are reported with a TransitionError.
+package ec2wait
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options controls how long to wait for instances to change state, and how often to check them.
+type Options struct {
+	// MinDelay is the time between the first two checks. The default is 5 seconds.
+	MinDelay time.Duration
+
+	// MaxDelay is the longest time between checks, as the delay doubles after each one.
+	// The default is 1 minute.
+	MaxDelay time.Duration
+
+	// Timeout is how long to wait for every instance. The default is 10 minutes.
+	Timeout time.Duration
+
+	// Now and Sleep tell and pass the time. Replace them to test with a fake clock, such as FakeClock.
+	// Sleep must return the error of the context if the context is done first.
+	Now   func() time.Time
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// WithDefaults returns the options with the defaults in place of the unset fields.
+func (o Options) WithDefaults() Options {
+	if o.MinDelay <= 0 {
+		o.MinDelay = 5 * time.Second
+	}
+
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = time.Minute
+	}
+
+	if o.MaxDelay < o.MinDelay {
+		o.MaxDelay = o.MinDelay
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Minute
+	}
+
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+
+	if o.Sleep == nil {
+		o.Sleep = sleep
+	}
+
+	return o
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TransitionError reports the instances that didn't reach a state.
+type TransitionError struct {
+	// Target is the state the instances didn't reach.
+	Target string
+
+	// States are the last states of the instances, by instance ID.
+	// An instance that Amazon EC2 never reported has the state unknown.
+	States map[string]string
+
+	// Err is the error of the context, if the context ended the wait.
+	Err error
+}
+
+func (e *TransitionError) Error() string {
+	ids := make([]string, 0, len(e.States))
+	for id := range e.States {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	states := make([]string, len(ids))
+	for i, id := range ids {
+		states[i] = id + " is " + e.States[id]
+	}
+
+	msg := fmt.Sprintf("%d instances didn't reach %s: %s", len(ids), e.Target, strings.Join(states, ", "))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// MaxIDs is the most instance IDs to check in one call.
+const MaxIDs = 100
+
+// Wait checks the instances until each one is in the target state or one of the failed states,
+// or the time is up.
+// Inputs:
+//     c is the context of the wait.
+//     ids are the IDs of the instances.
+//     target is the state to wait for.
+//     failed are the states from which an instance can't reach target, so it fails right away.
+//     opts controls how long to wait, and how often to check.
+//     check returns the states of the instances it finds, out of up to MaxIDs instances.
+//     An instance that it doesn't find keeps its last state.
+// Output:
+//     If every instance reached target, nil.
+//     If some didn't, a TransitionError with their last states.
+//     Otherwise, the first error from check.
+func Wait(c context.Context, ids []string, target string, failed []string, opts Options,
+	check func(ids []string) (map[string]string, error)) error {
+	opts = opts.WithDefaults()
+	deadline := opts.Now().Add(opts.Timeout)
+	delay := opts.MinDelay
+
+	states := map[string]string{}
+	for _, id := range ids {
+		states[id] = "unknown"
+	}
+
+	pending := ids
+	failures := map[string]string{}
+	var ctxErr error
+
+	for {
+		for start := 0; start < len(pending); start += MaxIDs {
+			end := start + MaxIDs
+			if end > len(pending) {
+				end = len(pending)
+			}
+
+			found, err := check(pending[start:end])
+			if err != nil {
+				return err
+			}
+
+			for id, state := range found {
+				states[id] = state
+			}
+		}
+
+		var waiting []string
+
+	instances:
+		for _, id := range pending {
+			if states[id] == target {
+				continue
+			}
+
+			for _, state := range failed {
+				if states[id] == state {
+					failures[id] = state
+					continue instances
+				}
+			}
+
+			waiting = append(waiting, id)
+		}
+
+		pending = waiting
+
+		remaining := deadline.Sub(opts.Now())
+		if len(pending) == 0 || remaining <= 0 {
+			break
+		}
+
+		d := delay
+		if d > remaining {
+			d = remaining
+		}
+
+		if ctxErr = opts.Sleep(c, d); ctxErr != nil {
+			break
+		}
+
+		if delay *= 2; delay > opts.MaxDelay {
+			delay = opts.MaxDelay
+		}
+	}
+
+	for _, id := range pending {
+		failures[id] = states[id]
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return &TransitionError{Target: target, States: failures, Err: ctxErr}
+}
+
+// ListFlags collects repeated flags, each of which can be a comma-separated list,
+// such as the instance IDs that the examples take.
+type ListFlags []string
+
+func (l *ListFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set adds the values of one flag.
+func (l *ListFlags) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ec2wait
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	clock := NewFakeClock()
+	start := clock.Now()
+
+	var ids []string
+	for i := 0; i < 150; i++ {
+		ids = append(ids, fmt.Sprintf("i-%03d", i))
+	}
+
+	// Each instance is running 40 seconds after the wait starts, except for the last one,
+	// which is never found, and the first one, which stops
+	var batches []int
+	check := func(ids []string) (map[string]string, error) {
+		batches = append(batches, len(ids))
+
+		states := map[string]string{}
+		for _, id := range ids {
+			switch {
+			case id == "i-149":
+			case id == "i-000":
+				states[id] = "stopping"
+			case clock.Now().Sub(start) >= 40*time.Second:
+				states[id] = "running"
+			default:
+				states[id] = "pending"
+			}
+		}
+
+		return states, nil
+	}
+
+	opts := clock.Options(Options{MinDelay: 10 * time.Second, MaxDelay: 20 * time.Second, Timeout: 2 * time.Minute})
+
+	err := Wait(context.Background(), ids, "running", []string{"stopping"}, opts, check)
+
+	var transitionErr *TransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("got %v, want a TransitionError", err)
+	}
+
+	if len(transitionErr.States) != 2 || transitionErr.States["i-000"] != "stopping" || transitionErr.States["i-149"] != "unknown" {
+		t.Errorf("got %v", transitionErr.States)
+	}
+
+	if !strings.Contains(err.Error(), "2 instances didn't reach running: i-000 is stopping, i-149 is unknown") {
+		t.Errorf("got %q", err)
+	}
+
+	// 10 + 20 + 20 seconds covers the 40 seconds, and the unknown instance waits for the rest of the 2 minutes
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 20 * time.Second, 20 * time.Second, 20 * time.Second, 20 * time.Second, 10 * time.Second}
+	if fmt.Sprint(clock.Slept) != fmt.Sprint(want) {
+		t.Errorf("got delays %v, want %v", clock.Slept, want)
+	}
+
+	// The first check covers every instance in two calls, and the next ones only the 149 that are pending
+	if len(batches) < 4 || batches[0] != MaxIDs || batches[1] != 50 || batches[2] != MaxIDs || batches[3] != 49 {
+		t.Errorf("got batches %v", batches)
+	}
+}
+
+func TestWaitErrors(t *testing.T) {
+	clock := NewFakeClock()
+	opts := clock.Options(Options{})
+
+	pending := func(ids []string) (map[string]string, error) {
+		return map[string]string{ids[0]: "pending"}, nil
+	}
+
+	// A canceled context ends the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Wait(ctx, []string{"i-1"}, "running", nil, opts, pending)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+
+	// An error from the check ends the wait at once
+	clock.Slept = nil
+	failure := errors.New("throttled")
+
+	err = Wait(context.Background(), []string{"i-1"}, "running", nil, opts, func(ids []string) (map[string]string, error) {
+		return nil, failure
+	})
+	if err != failure || len(clock.Slept) != 0 {
+		t.Errorf("got %v after %d delays, want the error of the check at once", err, len(clock.Slept))
+	}
+
+	// The defaults wait 10 minutes
+	start := clock.Now()
+	err = Wait(context.Background(), []string{"i-1"}, "running", nil, opts, pending)
+	if err == nil || clock.Now().Sub(start) != 10*time.Minute {
+		t.Errorf("got %v after %s, want a TransitionError after 10 minutes", err, clock.Now().Sub(start))
+	}
+}
+
+func TestListFlags(t *testing.T) {
+	var ids ListFlags
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&ids, "i", "")
+
+	err := flags.Parse([]string{"-i", "i-1", "-i", "i-2, i-3,", "-i", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids.String() != "i-1,i-2,i-3" {
+		t.Errorf("got %s", ids.String())
+	}
+}
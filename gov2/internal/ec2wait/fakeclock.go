@@ -0,0 +1,44 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ec2wait
+
+import (
+	"context"
+	"time"
+)
+
+// FakeClock is a clock for tests, whose Sleep passes the time at once.
+// ec2fake.NewWithClock uses its Now for an ec2fake.Service too, so that the instances change state as the waits pass the time.
+type FakeClock struct {
+	// Current is the time that Now returns.
+	Current time.Time
+
+	// Slept are the delays that Sleep passed, in order.
+	Slept []time.Duration
+}
+
+// NewFakeClock returns a FakeClock that starts at a fixed time.
+func NewFakeClock() *FakeClock {
+	return &FakeClock{Current: time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+// Now returns the current time of the clock.
+func (f *FakeClock) Now() time.Time {
+	return f.Current
+}
+
+// Sleep moves the clock on by d, and returns the error of the context, if any.
+func (f *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	f.Current = f.Current.Add(d)
+	f.Slept = append(f.Slept, d)
+
+	return ctx.Err()
+}
+
+// Options returns opts with the clock's Now and Sleep.
+func (f *FakeClock) Options(opts Options) Options {
+	opts.Now = f.Now
+	opts.Sleep = f.Sleep
+
+	return opts
+}
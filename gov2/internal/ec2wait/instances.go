@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ec2wait
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// EC2DescribeInstancesAPI defines the interface for the DescribeInstances function.
+// We use this interface to test the function using a mocked service.
+type EC2DescribeInstancesAPI interface {
+	DescribeInstances(ctx context.Context,
+		params *ec2.DescribeInstancesInput,
+		optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+}
+
+// InstanceStates returns a check for Wait that gets the states of the instances with DescribeInstances.
+// Amazon EC2 might not know about instances that were just launched,
+// so if it doesn't find one of them, the instances keep their last states.
+func InstanceStates(c context.Context, api EC2DescribeInstancesAPI) func(ids []string) (map[string]string, error) {
+	return func(ids []string) (map[string]string, error) {
+		output, err := api.DescribeInstances(c, &ec2.DescribeInstancesInput{InstanceIds: ids})
+
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound" {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		states := map[string]string{}
+		for _, r := range output.Reservations {
+			for _, i := range r.Instances {
+				if i.State != nil {
+					states[aws.ToString(i.InstanceId)] = string(i.State.Name)
+				}
+			}
+		}
+
+		return states, nil
+	}
+}
+
+// WaitForRunning waits for Amazon Elastic Compute Cloud (Amazon EC2) instances to be running.
+// It checks the instances with DescribeInstances, waiting longer between each check, up to a limit.
+// Instances that are stopping, shutting down, or terminated can't reach the running state, so they fail right away.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     ids are the IDs of the instances.
+//     opts controls how long to wait, and how often to check.
+// Output:
+//     If every instance is running, nil.
+//     If some aren't, a TransitionError with their last states.
+//     Otherwise, an error from the call to DescribeInstances.
+func WaitForRunning(c context.Context, api EC2DescribeInstancesAPI, ids []string, opts Options) error {
+	failed := []string{
+		string(types.InstanceStateNameStopping),
+		string(types.InstanceStateNameShuttingDown),
+		string(types.InstanceStateNameTerminated),
+	}
+
+	return Wait(c, ids, string(types.InstanceStateNameRunning), failed, opts, InstanceStates(c, api))
+}
+
+// WaitForStopped waits for Amazon Elastic Compute Cloud (Amazon EC2) instances to be stopped.
+// It checks the instances with DescribeInstances, waiting longer between each check, up to a limit.
+// Instances that are pending, shutting down, or terminated can't reach the stopped state, so they fail right away.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     ids are the IDs of the instances.
+//     opts controls how long to wait, and how often to check.
+// Output:
+//     If every instance is stopped, nil.
+//     If some aren't, a TransitionError with their last states.
+//     Otherwise, an error from the call to DescribeInstances.
+func WaitForStopped(c context.Context, api EC2DescribeInstancesAPI, ids []string, opts Options) error {
+	failed := []string{
+		string(types.InstanceStateNamePending),
+		string(types.InstanceStateNameShuttingDown),
+		string(types.InstanceStateNameTerminated),
+	}
+
+	return Wait(c, ids, string(types.InstanceStateNameStopped), failed, opts, InstanceStates(c, api))
+}
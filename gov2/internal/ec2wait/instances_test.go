@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ec2wait_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2fake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ec2wait"
+)
+
+func TestWaitForRunning(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+
+	stuck := api.AddInstance("us-west-2", types.Instance{State: &types.InstanceState{Name: types.InstanceStateNamePending}})
+	api.Hold(stuck)
+	gone := api.AddInstance("us-west-2", types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameTerminated}})
+	running := api.AddInstance("us-west-2", types.Instance{})
+
+	opts := clock.Options(ec2wait.Options{Timeout: 2 * time.Minute})
+	start := clock.Current
+
+	err := ec2wait.WaitForRunning(context.Background(), api, []string{stuck, gone, running}, opts)
+
+	var transitionErr *ec2wait.TransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("got %v, want a TransitionError", err)
+	}
+
+	if len(transitionErr.States) != 2 || transitionErr.States[stuck] != "pending" || transitionErr.States[gone] != "terminated" {
+		t.Errorf("got %v", transitionErr.States)
+	}
+
+	if waited := clock.Current.Sub(start); waited != 2*time.Minute {
+		t.Errorf("waited %s, want the 2 minute timeout", waited)
+	}
+
+	if !strings.Contains(err.Error(), "2 instances didn't reach running") {
+		t.Errorf("got %q", err)
+	}
+
+	// A terminated instance fails without waiting
+	clock.Slept = nil
+	err = ec2wait.WaitForRunning(context.Background(), api, []string{gone}, opts)
+	if !errors.As(err, &transitionErr) || len(clock.Slept) != 0 {
+		t.Errorf("got %v after %d delays, want a TransitionError at once", err, len(clock.Slept))
+	}
+
+	// An instance that Amazon EC2 doesn't know about yet is unknown
+	err = ec2wait.WaitForRunning(context.Background(), api, []string{"i-0123456789abcdef0"}, opts)
+	if !errors.As(err, &transitionErr) || transitionErr.States["i-0123456789abcdef0"] != "unknown" {
+		t.Errorf("got %v, want a TransitionError with the state unknown", err)
+	}
+
+	// A canceled context ends the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = ec2wait.WaitForRunning(ctx, api, []string{stuck}, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestWaitForStopped(t *testing.T) {
+	api, clock := ec2fake.NewWithClock()
+
+	stuck := api.AddInstance("us-west-2", types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameStopping}})
+	api.Hold(stuck)
+	starting := api.AddInstance("us-west-2", types.Instance{State: &types.InstanceState{Name: types.InstanceStateNamePending}})
+	stopped := api.AddInstance("us-west-2", types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameStopped}})
+
+	opts := clock.Options(ec2wait.Options{Timeout: 2 * time.Minute})
+
+	err := ec2wait.WaitForStopped(context.Background(), api, []string{stuck, starting, stopped}, opts)
+
+	var transitionErr *ec2wait.TransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("got %v, want a TransitionError", err)
+	}
+
+	if len(transitionErr.States) != 2 || transitionErr.States[stuck] != "stopping" || transitionErr.States[starting] != "pending" {
+		t.Errorf("got %v", transitionErr.States)
+	}
+
+	if !strings.Contains(err.Error(), "2 instances didn't reach stopped") {
+		t.Errorf("got %q", err)
+	}
+}
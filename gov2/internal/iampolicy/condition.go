@@ -0,0 +1,315 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package iampolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operator is a condition operator, such as StringEquals.
+// Negated operators, such as StringNotEquals, are stored as the positive comparison with negated set.
+type operator struct {
+	negated bool
+	// variables is whether policy variables are replaced in the policy values.
+	variables bool
+	// wildcards is whether the policy values can contain * and ?.
+	wildcards bool
+	// parse checks a policy value when the policy is parsed.
+	parse func(string) error
+	// compare compares a policy value with a request value.
+	compare func(policy, request string) bool
+}
+
+var operators = map[string]*operator{}
+
+func init() {
+	add := func(name, negatedName string, op operator) {
+		positive := op
+		operators[name] = &positive
+
+		if negatedName != "" {
+			negated := op
+			negated.negated = true
+			operators[negatedName] = &negated
+		}
+	}
+
+	add("StringEquals", "StringNotEquals", operator{variables: true, compare: func(p, r string) bool { return p == r }})
+	add("StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase", operator{variables: true, compare: strings.EqualFold})
+	add("StringLike", "StringNotLike", operator{variables: true, wildcards: true, compare: Match})
+
+	numeric := func(cmp func(p, r float64) bool) operator {
+		return operator{
+			parse: func(s string) error {
+				_, err := strconv.ParseFloat(s, 64)
+				return err
+			},
+			compare: func(p, r string) bool {
+				pv, err1 := strconv.ParseFloat(p, 64)
+				rv, err2 := strconv.ParseFloat(r, 64)
+				return err1 == nil && err2 == nil && cmp(pv, rv)
+			},
+		}
+	}
+
+	add("NumericEquals", "NumericNotEquals", numeric(func(p, r float64) bool { return r == p }))
+	add("NumericLessThan", "", numeric(func(p, r float64) bool { return r < p }))
+	add("NumericLessThanEquals", "", numeric(func(p, r float64) bool { return r <= p }))
+	add("NumericGreaterThan", "", numeric(func(p, r float64) bool { return r > p }))
+	add("NumericGreaterThanEquals", "", numeric(func(p, r float64) bool { return r >= p }))
+
+	date := func(cmp func(p, r time.Time) bool) operator {
+		return operator{
+			parse: func(s string) error {
+				_, err := parseDate(s)
+				return err
+			},
+			compare: func(p, r string) bool {
+				pv, err1 := parseDate(p)
+				rv, err2 := parseDate(r)
+				return err1 == nil && err2 == nil && cmp(pv, rv)
+			},
+		}
+	}
+
+	add("DateEquals", "DateNotEquals", date(func(p, r time.Time) bool { return r.Equal(p) }))
+	add("DateLessThan", "", date(func(p, r time.Time) bool { return r.Before(p) }))
+	add("DateLessThanEquals", "", date(func(p, r time.Time) bool { return !r.After(p) }))
+	add("DateGreaterThan", "", date(func(p, r time.Time) bool { return r.After(p) }))
+	add("DateGreaterThanEquals", "", date(func(p, r time.Time) bool { return !r.Before(p) }))
+
+	add("Bool", "", operator{
+		parse: func(s string) error {
+			_, err := strconv.ParseBool(s)
+			return err
+		},
+		compare: strings.EqualFold,
+	})
+
+	add("BinaryEquals", "", operator{compare: func(p, r string) bool { return p == r }})
+
+	add("IpAddress", "NotIpAddress", operator{
+		parse: func(s string) error {
+			_, err := parseCIDR(s)
+			return err
+		},
+		compare: func(p, r string) bool {
+			network, err := parseCIDR(p)
+			ip := net.ParseIP(r)
+			return err == nil && ip != nil && network.Contains(ip)
+		},
+	})
+
+	// ArnEquals and ArnLike behave the same way in IAM: both compare each part of the ARN with wildcards
+	add("ArnEquals", "ArnNotEquals", operator{variables: true, wildcards: true, compare: arnMatch})
+	add("ArnLike", "ArnNotLike", operator{variables: true, wildcards: true, compare: arnMatch})
+}
+
+// parseDate parses an ISO 8601 date, or a number of seconds since the epoch.
+func parseDate(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a date", s)
+}
+
+// parseCIDR parses a CIDR block, or a single IP address.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address", s)
+		}
+
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(s)
+
+	return network, err
+}
+
+// arnMatch compares the six colon-separated parts of two ARNs, with wildcards in each part of the pattern.
+func arnMatch(pattern, arn string) bool {
+	p := strings.SplitN(pattern, ":", 6)
+	a := strings.SplitN(arn, ":", 6)
+
+	if len(p) != 6 || len(a) != 6 {
+		return false
+	}
+
+	for i := range p {
+		if !Match(p[i], a[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newCondition(name, key string, rawValues json.RawMessage) (Condition, error) {
+	c := Condition{Operator: name, Key: key}
+
+	base := name
+	if i := strings.Index(base, ":"); i >= 0 {
+		c.set = base[:i]
+		base = base[i+1:]
+
+		if c.set != "ForAllValues" && c.set != "ForAnyValue" {
+			return c, fmt.Errorf("unknown set operator %s", c.set)
+		}
+	}
+
+	if strings.HasSuffix(base, "IfExists") {
+		c.ifExists = true
+		base = strings.TrimSuffix(base, "IfExists")
+	}
+
+	values, err := stringList(rawValues)
+	if err != nil {
+		return c, fmt.Errorf("%s %s: %v", name, key, err)
+	}
+
+	c.Values = values
+
+	if base == "Null" {
+		if c.set != "" || c.ifExists {
+			return c, fmt.Errorf("%s can't be qualified", base)
+		}
+
+		for _, v := range values {
+			if _, err := strconv.ParseBool(v); err != nil {
+				return c, fmt.Errorf("Null %s: %q is not true or false", key, v)
+			}
+		}
+
+		return c, nil
+	}
+
+	op, ok := operators[base]
+	if !ok {
+		return c, fmt.Errorf("unknown operator %s", name)
+	}
+
+	c.op = op
+
+	if op.parse != nil {
+		for _, v := range values {
+			if err := op.parse(v); err != nil {
+				return c, fmt.Errorf("%s %s: %v", name, key, err)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// matches returns whether the condition holds for the request.
+func (c Condition) matches(ctx *requestContext) bool {
+	values, present := ctx.lookup(c.Key)
+
+	if c.op == nil {
+		// Null holds if the key's presence is what any of the values asks for
+		for _, v := range c.Values {
+			wantMissing, _ := strconv.ParseBool(v)
+			if wantMissing != present {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if !present {
+		switch {
+		case c.ifExists, c.set == "ForAllValues":
+			return true
+		case c.set == "ForAnyValue":
+			return false
+		}
+
+		return c.op.negated
+	}
+
+	switch c.set {
+	case "ForAllValues":
+		for _, v := range values {
+			if !c.matchesValue(ctx, v) {
+				return false
+			}
+		}
+
+		return true
+	case "ForAnyValue":
+		for _, v := range values {
+			if c.matchesValue(ctx, v) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// A negated operator holds when no request value matches a policy value
+	if c.op.negated {
+		for _, v := range values {
+			if !c.matchesValue(ctx, v) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for _, v := range values {
+		if c.matchesValue(ctx, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesValue returns whether one request value satisfies the operator,
+// that is, matches any policy value, or for a negated operator, matches none.
+func (c Condition) matchesValue(ctx *requestContext, value string) bool {
+	matched := false
+	for _, p := range c.Values {
+		if c.op.variables {
+			var ok bool
+			p, ok = ctx.substitute(p)
+			if !ok {
+				continue
+			}
+		}
+
+		if !c.op.wildcards {
+			p = strings.ReplaceAll(p, literalMarker, "")
+		}
+
+		if c.op.compare(p, value) {
+			matched = true
+			break
+		}
+	}
+
+	return matched != c.op.negated
+}
@@ -0,0 +1,575 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package iampolicy parses AWS Identity and Access Management (IAM) JSON policies
+// and evaluates requests against them offline, so examples can test their policies before applying them.
+//
+// Evaluation follows the IAM rules for a single account:
+// an explicit Deny in any matching statement wins, otherwise a matching Allow allows the request,
+// and otherwise the request is implicitly denied.
+// Action, NotAction, Resource, NotResource, Principal, and NotPrincipal support the * and ? wildcards,
+// and Condition supports the common String, Numeric, Date, Bool, IpAddress, Arn, and Null operators,
+// with the IfExists suffix and the ForAllValues and ForAnyValue set qualifiers.
+// Permissions boundaries, session policies, and SCPs are not modeled.
+package iampolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Policy is a parsed IAM policy document.
+type Policy struct {
+	Version    string
+	ID         string
+	Statements []*Statement
+}
+
+// Statement is one statement of a policy.
+// Fields that hold a list are nil when the element is absent from the document.
+type Statement struct {
+	Sid    string
+	Effect Effect
+
+	Action      []string
+	NotAction   []string
+	Resource    []string
+	NotResource []string
+
+	// Principal and NotPrincipal map a principal type, such as AWS or Service, to its values.
+	// "Principal": "*" is stored as {"*": ["*"]}.
+	Principal    map[string][]string
+	NotPrincipal map[string][]string
+
+	Conditions []Condition
+}
+
+// Effect is the effect of a statement.
+type Effect string
+
+// The effects a statement can have
+const (
+	EffectAllow Effect = "Allow"
+	EffectDeny  Effect = "Deny"
+)
+
+// Condition is one condition key test of a statement, such as StringEquals on s3:x-amz-acl.
+type Condition struct {
+	// Operator is the operator as written, such as ForAnyValue:StringLikeIfExists.
+	Operator string
+	Key      string
+	Values   []string
+
+	op       *operator
+	ifExists bool
+	set      string
+}
+
+// Parse parses a policy document.
+// The document can be URL-encoded, as IAM returns it from calls such as GetPolicyVersion.
+func Parse(document []byte) (*Policy, error) {
+	text := bytes.TrimSpace(document)
+	if len(text) > 0 && text[0] == '%' {
+		unescaped, err := url.QueryUnescape(string(text))
+		if err != nil {
+			return nil, err
+		}
+
+		text = []byte(unescaped)
+	}
+
+	var raw struct {
+		Version   string
+		ID        string `json:"Id"`
+		Statement json.RawMessage
+	}
+
+	err := json.Unmarshal(text, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw.Statement) == 0 {
+		return nil, errors.New("the policy has no Statement")
+	}
+
+	var rawStatements []json.RawMessage
+	if bytes.HasPrefix(bytes.TrimSpace(raw.Statement), []byte("[")) {
+		err = json.Unmarshal(raw.Statement, &rawStatements)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		rawStatements = []json.RawMessage{raw.Statement}
+	}
+
+	policy := &Policy{Version: raw.Version, ID: raw.ID}
+
+	for i, r := range rawStatements {
+		s, err := parseStatement(r)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %v", i, err)
+		}
+
+		policy.Statements = append(policy.Statements, s)
+	}
+
+	return policy, nil
+}
+
+// MustParse is like Parse but panics if the document can't be parsed.
+// It simplifies tests of fixed policies.
+func MustParse(document string) *Policy {
+	p, err := Parse([]byte(document))
+	if err != nil {
+		panic("iampolicy: " + err.Error())
+	}
+
+	return p
+}
+
+func parseStatement(data json.RawMessage) (*Statement, error) {
+	var raw struct {
+		Sid          string
+		Effect       string
+		Action       json.RawMessage
+		NotAction    json.RawMessage
+		Resource     json.RawMessage
+		NotResource  json.RawMessage
+		Principal    json.RawMessage
+		NotPrincipal json.RawMessage
+		Condition    map[string]map[string]json.RawMessage
+	}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Statement{Sid: raw.Sid, Effect: Effect(raw.Effect)}
+	if s.Effect != EffectAllow && s.Effect != EffectDeny {
+		return nil, fmt.Errorf("Effect must be Allow or Deny, not %q", raw.Effect)
+	}
+
+	lists := []struct {
+		name string
+		raw  json.RawMessage
+		dst  *[]string
+	}{
+		{"Action", raw.Action, &s.Action},
+		{"NotAction", raw.NotAction, &s.NotAction},
+		{"Resource", raw.Resource, &s.Resource},
+		{"NotResource", raw.NotResource, &s.NotResource},
+	}
+
+	for _, l := range lists {
+		if l.raw == nil {
+			continue
+		}
+
+		*l.dst, err = stringList(l.raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", l.name, err)
+		}
+	}
+
+	if (s.Action == nil) == (s.NotAction == nil) {
+		return nil, errors.New("exactly one of Action and NotAction is required")
+	}
+
+	if s.Resource != nil && s.NotResource != nil {
+		return nil, errors.New("only one of Resource and NotResource is allowed")
+	}
+
+	if raw.Principal != nil && raw.NotPrincipal != nil {
+		return nil, errors.New("only one of Principal and NotPrincipal is allowed")
+	}
+
+	s.Principal, err = principalMap(raw.Principal)
+	if err != nil {
+		return nil, fmt.Errorf("Principal: %v", err)
+	}
+
+	s.NotPrincipal, err = principalMap(raw.NotPrincipal)
+	if err != nil {
+		return nil, fmt.Errorf("NotPrincipal: %v", err)
+	}
+
+	// Sort the conditions so evaluation and errors don't depend on map order
+	operators := make([]string, 0, len(raw.Condition))
+	for name := range raw.Condition {
+		operators = append(operators, name)
+	}
+
+	sort.Strings(operators)
+
+	for _, name := range operators {
+		keys := make([]string, 0, len(raw.Condition[name]))
+		for key := range raw.Condition[name] {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			c, err := newCondition(name, key, raw.Condition[name][key])
+			if err != nil {
+				return nil, fmt.Errorf("Condition: %v", err)
+			}
+
+			s.Conditions = append(s.Conditions, c)
+		}
+	}
+
+	return s, nil
+}
+
+// stringList decodes an element that is a string or a list of strings.
+// Condition values can also be numbers or booleans, which are kept in their JSON form.
+func stringList(data json.RawMessage) ([]string, error) {
+	var many []json.RawMessage
+	if err := json.Unmarshal(data, &many); err != nil {
+		many = []json.RawMessage{data}
+	}
+
+	values := make([]string, 0, len(many))
+	for _, m := range many {
+		var v interface{}
+		err := json.Unmarshal(m, &v)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := v.(type) {
+		case string:
+			values = append(values, v)
+		case float64, bool:
+			values = append(values, string(bytes.TrimSpace(m)))
+		default:
+			return nil, fmt.Errorf("%s is not a string", m)
+		}
+	}
+
+	return values, nil
+}
+
+func principalMap(data json.RawMessage) (map[string][]string, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return nil, fmt.Errorf("a string principal must be \"*\", not %q", wildcard)
+		}
+
+		return map[string][]string{"*": {"*"}}, nil
+	}
+
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	principals := map[string][]string{}
+	for kind, values := range raw {
+		principals[kind], err = stringList(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return principals, nil
+}
+
+// Principal identifies who makes a request, for policies with a Principal element such as bucket policies.
+type Principal struct {
+	// Type is the principal type, such as AWS, Service, or Federated.
+	Type string
+	// ID is the principal, such as arn:aws:iam::123456789012:root or cloudtrail.amazonaws.com.
+	ID string
+}
+
+// Request is the request to evaluate.
+type Request struct {
+	// Principal makes the request. Leave it empty to evaluate identity-based policies,
+	// whose statements have no Principal element.
+	Principal Principal
+
+	// Action is the action, such as dynamodb:GetItem.
+	Action string
+
+	// Resource is the ARN of the resource.
+	Resource string
+
+	// Context holds the condition keys of the request, such as aws:SourceIp.
+	// Keys are case-insensitive. A key with no values is treated as present but empty.
+	Context map[string][]string
+}
+
+// Decision is the result of evaluating a request.
+type Decision int
+
+// The decisions
+const (
+	// ImplicitDeny means that no statement applies to the request.
+	ImplicitDeny Decision = iota
+	// Allowed means that an Allow statement applies to the request and no Deny statement does.
+	Allowed
+	// ExplicitDeny means that a Deny statement applies to the request.
+	ExplicitDeny
+)
+
+func (d Decision) String() string {
+	switch d {
+	case ImplicitDeny:
+		return "ImplicitDeny"
+	case Allowed:
+		return "Allowed"
+	case ExplicitDeny:
+		return "ExplicitDeny"
+	}
+
+	return fmt.Sprintf("Decision(%d)", int(d))
+}
+
+// Result is the decision for a request, with the statement that decided it.
+type Result struct {
+	Decision Decision
+	// Statement is the first Deny statement that applies for ExplicitDeny,
+	// the first Allow statement that applies for Allowed, and nil for ImplicitDeny.
+	Statement *Statement
+	// Policy contains Statement.
+	Policy *Policy
+}
+
+// Evaluate evaluates a request against a set of policies that apply to it together.
+func Evaluate(req Request, policies ...*Policy) Result {
+	ctx := newRequestContext(req)
+
+	var allow Result
+	for _, p := range policies {
+		for _, s := range p.Statements {
+			if !s.applies(ctx) {
+				continue
+			}
+
+			if s.Effect == EffectDeny {
+				return Result{Decision: ExplicitDeny, Statement: s, Policy: p}
+			}
+
+			if allow.Statement == nil {
+				allow = Result{Decision: Allowed, Statement: s, Policy: p}
+			}
+		}
+	}
+
+	return allow
+}
+
+// Evaluate evaluates a request against this policy alone.
+func (p *Policy) Evaluate(req Request) Result {
+	return Evaluate(req, p)
+}
+
+// requestContext is a request with its condition keys in lowercase.
+type requestContext struct {
+	Request
+	keys map[string][]string
+}
+
+func newRequestContext(req Request) *requestContext {
+	ctx := &requestContext{Request: req, keys: map[string][]string{}}
+	for k, v := range req.Context {
+		ctx.keys[strings.ToLower(k)] = v
+	}
+
+	return ctx
+}
+
+func (ctx *requestContext) lookup(key string) ([]string, bool) {
+	v, ok := ctx.keys[strings.ToLower(key)]
+	return v, ok
+}
+
+// applies returns whether the statement applies to the request.
+func (s *Statement) applies(ctx *requestContext) bool {
+	if s.Action != nil && !matchAny(s.Action, ctx.Action, true, nil) {
+		return false
+	}
+
+	if s.NotAction != nil && matchAny(s.NotAction, ctx.Action, true, nil) {
+		return false
+	}
+
+	if s.Resource != nil && !matchAny(s.Resource, ctx.Resource, false, ctx) {
+		return false
+	}
+
+	if s.NotResource != nil && matchAny(s.NotResource, ctx.Resource, false, ctx) {
+		return false
+	}
+
+	if s.Principal != nil && !principalMatches(s.Principal, ctx.Principal) {
+		return false
+	}
+
+	if s.NotPrincipal != nil && principalMatches(s.NotPrincipal, ctx.Principal) {
+		return false
+	}
+
+	for _, c := range s.Conditions {
+		if !c.matches(ctx) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func principalMatches(principals map[string][]string, p Principal) bool {
+	if p.ID == "" {
+		return false
+	}
+
+	if _, ok := principals["*"]; ok {
+		return true
+	}
+
+	for kind, ids := range principals {
+		if kind == p.Type && matchAny(ids, p.ID, false, nil) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAny returns whether value matches any of the patterns.
+// If ctx isn't nil, policy variables such as ${aws:username} in the patterns are replaced first.
+func matchAny(patterns []string, value string, foldCase bool, ctx *requestContext) bool {
+	for _, p := range patterns {
+		if ctx != nil {
+			var ok bool
+			p, ok = ctx.substitute(p)
+			if !ok {
+				continue
+			}
+		}
+
+		if foldCase {
+			p = strings.ToLower(p)
+			value = strings.ToLower(value)
+		}
+
+		if Match(p, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// substitute replaces the policy variables in a pattern with their values in the request.
+// It returns false if a variable is missing or has several values,
+// in which case the pattern can't match.
+// ${*}, ${?}, and ${$} stand for the literal characters, which Match treats as literals.
+func (ctx *requestContext) substitute(pattern string) (string, bool) {
+	if !strings.Contains(pattern, "${") {
+		return pattern, true
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(pattern, "${")
+		if start < 0 {
+			b.WriteString(pattern)
+			return b.String(), true
+		}
+
+		end := strings.Index(pattern[start:], "}")
+		if end < 0 {
+			b.WriteString(pattern)
+			return b.String(), true
+		}
+
+		b.WriteString(pattern[:start])
+
+		name := pattern[start+2 : start+end]
+		switch name {
+		case "*", "?", "$":
+			b.WriteString(literalMarker + name)
+		default:
+			values, ok := ctx.lookup(name)
+			if !ok || len(values) != 1 {
+				return "", false
+			}
+
+			b.WriteString(escapeWildcards(values[0]))
+		}
+
+		pattern = pattern[start+end+1:]
+	}
+}
+
+// literalMarker precedes a * or ? that Match must treat literally.
+const literalMarker = "\x00"
+
+func escapeWildcards(s string) string {
+	s = strings.ReplaceAll(s, "*", literalMarker+"*")
+	return strings.ReplaceAll(s, "?", literalMarker+"?")
+}
+
+// Match returns whether value matches pattern,
+// where * matches any sequence of characters and ? matches any one character.
+// The comparison is case-sensitive.
+func Match(pattern, value string) bool {
+	// Match a rune at a time, backtracking to the last * on a mismatch
+	p := []rune(pattern)
+	v := []rune(value)
+
+	pi, vi := 0, 0
+	starP, starV := -1, 0
+
+	for vi < len(v) {
+		switch {
+		case pi < len(p) && p[pi] == '*':
+			starP, starV = pi, vi
+			pi++
+			continue
+		case pi < len(p) && p[pi] == '?':
+			pi++
+			vi++
+			continue
+		case pi+1 < len(p) && string(p[pi]) == literalMarker && p[pi+1] == v[vi]:
+			pi += 2
+			vi++
+			continue
+		case pi < len(p) && string(p[pi]) != literalMarker && p[pi] == v[vi]:
+			pi++
+			vi++
+			continue
+		}
+
+		if starP < 0 {
+			return false
+		}
+
+		pi = starP + 1
+		starV++
+		vi = starV
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+
+	return pi == len(p)
+}
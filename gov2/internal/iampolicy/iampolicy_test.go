@@ -0,0 +1,283 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package iampolicy
+
+import (
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:Get*", "s3:PutObject", false},
+		{"s3:?etObject", "s3:GetObject", true},
+		{"arn:aws:s3:::bucket/*/logs", "arn:aws:s3:::bucket/a/b/logs", true},
+		{"arn:aws:s3:::bucket/*/logs", "arn:aws:s3:::bucket/a/b/logs/x", false},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"abc", "ab", false},
+		{"a" + literalMarker + "*", "a*", true},
+		{"a" + literalMarker + "*", "ab", false},
+	}
+
+	for _, test := range tests {
+		if got := Match(test.pattern, test.value); got != test.want {
+			t.Errorf("Match(%q, %q) returned %t instead of %t", test.pattern, test.value, got, test.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	p, err := Parse([]byte(url.QueryEscape(`{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"s3:*","Resource":["*"],"Condition":{"NumericLessThan":{"s3:max-keys":10}}}}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Statements) != 1 || p.Statements[0].Action[0] != "s3:*" || p.Statements[0].Conditions[0].Values[0] != "10" {
+		t.Errorf("Parsed the statement as %+v", p.Statements[0])
+	}
+
+	invalid := []string{
+		`{"Statement":[]}`,
+		`{"Statement":[{"Effect":"Maybe","Action":"*","Resource":"*"}]}`,
+		`{"Statement":[{"Effect":"Allow","Resource":"*"}]}`,
+		`{"Statement":[{"Effect":"Allow","Action":"*","NotAction":"s3:*","Resource":"*"}]}`,
+		`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringSortOf":{"k":"v"}}}]}`,
+		`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"NumericEquals":{"k":"ten"}}}]}`,
+		`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"IpAddress":{"aws:SourceIp":"300.0.0.0/8"}}}]}`,
+		`{"Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Principal":"someone"}]}`,
+	}
+
+	for _, doc := range invalid {
+		p, err := Parse([]byte(doc))
+		if err == nil && len(p.Statements) > 0 {
+			t.Errorf("Parsed the invalid policy %s", doc)
+		}
+	}
+}
+
+func TestEvaluatePrecedence(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	allow := MustParse(`{"Statement":[
+		{"Sid":"ReadAll","Effect":"Allow","Action":"s3:Get*","Resource":"*"},
+		{"Sid":"Write","Effect":"Allow","Action":["s3:PutObject","S3:DeleteObject"],"Resource":"arn:aws:s3:::doc-example-bucket/*"}
+	]}`)
+	deny := MustParse(`{"Statement":[
+		{"Sid":"NoSecrets","Effect":"Deny","Action":"s3:*","Resource":"arn:aws:s3:::doc-example-bucket/secret/*"},
+		{"Sid":"OnlyS3","Effect":"Deny","NotAction":"s3:*","Resource":"*"}
+	]}`)
+
+	tests := []struct {
+		action, resource string
+		want             Decision
+		sid              string
+	}{
+		{"s3:GetObject", "arn:aws:s3:::other-bucket/a", Allowed, "ReadAll"},
+		{"s3:deleteobject", "arn:aws:s3:::doc-example-bucket/a", Allowed, "Write"},
+		{"s3:PutObject", "arn:aws:s3:::other-bucket/a", ImplicitDeny, ""},
+		{"s3:GetObject", "arn:aws:s3:::doc-example-bucket/secret/key", ExplicitDeny, "NoSecrets"},
+		{"dynamodb:GetItem", "arn:aws:dynamodb:us-west-2:123456789012:table/t", ExplicitDeny, "OnlyS3"},
+	}
+
+	for _, test := range tests {
+		got := Evaluate(Request{Action: test.action, Resource: test.resource}, allow, deny)
+		sid := ""
+		if got.Statement != nil {
+			sid = got.Statement.Sid
+		}
+
+		if got.Decision != test.want || sid != test.sid {
+			t.Errorf("%s on %s was %v by %q instead of %v by %q", test.action, test.resource, got.Decision, sid, test.want, test.sid)
+		}
+	}
+
+	notResource := MustParse(`{"Statement":{"Effect":"Allow","Action":"s3:*","NotResource":"arn:aws:s3:::doc-example-bucket/*"}}`)
+	if notResource.Evaluate(Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::doc-example-bucket/a"}).Decision != ImplicitDeny {
+		t.Error("NotResource allowed an excluded resource")
+	}
+
+	if notResource.Evaluate(Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::other-bucket/a"}).Decision != Allowed {
+		t.Error("NotResource did not allow another resource")
+	}
+}
+
+func TestEvaluateConditions(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	tests := []struct {
+		condition string
+		context   map[string][]string
+		want      bool
+	}{
+		{`{"StringEquals":{"aws:username":"ana"}}`, map[string][]string{"AWS:UserName": {"ana"}}, true},
+		{`{"StringEquals":{"aws:username":["ana","bo"]}}`, map[string][]string{"aws:username": {"cy"}}, false},
+		{`{"StringEquals":{"aws:username":"ana"}}`, nil, false},
+		{`{"StringNotEquals":{"aws:username":"ana"}}`, nil, true},
+		{`{"StringNotEquals":{"aws:username":"ana"}}`, map[string][]string{"aws:username": {"ana"}}, false},
+		{`{"StringEqualsIgnoreCase":{"s3:prefix":"Home/"}}`, map[string][]string{"s3:prefix": {"home/"}}, true},
+		{`{"StringLike":{"s3:prefix":"home/${aws:username}/*"}}`, map[string][]string{"s3:prefix": {"home/ana/docs"}, "aws:username": {"ana"}}, true},
+		{`{"StringLike":{"s3:prefix":"home/${aws:username}/*"}}`, map[string][]string{"s3:prefix": {"home/bo/docs"}, "aws:username": {"ana"}}, false},
+		{`{"StringNotLike":{"s3:prefix":"tmp/*"}}`, map[string][]string{"s3:prefix": {"home/"}}, true},
+		{`{"StringEqualsIfExists":{"ec2:InstanceType":"t2.micro"}}`, nil, true},
+		{`{"StringEqualsIfExists":{"ec2:InstanceType":"t2.micro"}}`, map[string][]string{"ec2:InstanceType": {"m5.large"}}, false},
+		{`{"NumericLessThanEquals":{"s3:max-keys":"10"}}`, map[string][]string{"s3:max-keys": {"10"}}, true},
+		{`{"NumericGreaterThan":{"s3:max-keys":10}}`, map[string][]string{"s3:max-keys": {"10"}}, false},
+		{`{"DateLessThan":{"aws:CurrentTime":"2020-12-31T23:59:59Z"}}`, map[string][]string{"aws:CurrentTime": {"2020-06-01T00:00:00Z"}}, true},
+		{`{"DateGreaterThan":{"aws:EpochTime":"1600000000"}}`, map[string][]string{"aws:EpochTime": {"1500000000"}}, false},
+		{`{"Bool":{"aws:SecureTransport":"true"}}`, map[string][]string{"aws:SecureTransport": {"true"}}, true},
+		{`{"Bool":{"aws:SecureTransport":false}}`, map[string][]string{"aws:SecureTransport": {"true"}}, false},
+		{`{"IpAddress":{"aws:SourceIp":"203.0.113.0/24"}}`, map[string][]string{"aws:SourceIp": {"203.0.113.7"}}, true},
+		{`{"NotIpAddress":{"aws:SourceIp":["203.0.113.0/24","2001:db8::/32"]}}`, map[string][]string{"aws:SourceIp": {"2001:db8::1"}}, false},
+		{`{"ArnLike":{"aws:SourceArn":"arn:aws:sns:*:123456789012:*"}}`, map[string][]string{"aws:SourceArn": {"arn:aws:sns:us-west-2:123456789012:topic"}}, true},
+		{`{"ArnEquals":{"aws:SourceArn":"arn:aws:sns:*:123456789012:*"}}`, map[string][]string{"aws:SourceArn": {"arn:aws:sqs:us-west-2:123456789012:queue"}}, false},
+		{`{"Null":{"aws:TokenIssueTime":"true"}}`, nil, true},
+		{`{"Null":{"aws:TokenIssueTime":"false"}}`, nil, false},
+		{`{"ForAllValues:StringEquals":{"aws:TagKeys":["env","team"]}}`, map[string][]string{"aws:TagKeys": {"env"}}, true},
+		{`{"ForAllValues:StringEquals":{"aws:TagKeys":["env","team"]}}`, map[string][]string{"aws:TagKeys": {"env", "cost"}}, false},
+		{`{"ForAllValues:StringEquals":{"aws:TagKeys":["env"]}}`, nil, true},
+		{`{"ForAnyValue:StringEquals":{"aws:TagKeys":["env"]}}`, map[string][]string{"aws:TagKeys": {"cost", "env"}}, true},
+		{`{"ForAnyValue:StringEquals":{"aws:TagKeys":["env"]}}`, nil, false},
+		{`{"StringEquals":{"aws:username":"ana"},"Bool":{"aws:MultiFactorAuthPresent":"true"}}`, map[string][]string{"aws:username": {"ana"}}, false},
+	}
+
+	for _, test := range tests {
+		p, err := Parse([]byte(`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":` + test.condition + `}}`))
+		if err != nil {
+			t.Fatalf("%s: %v", test.condition, err)
+		}
+
+		got := p.Evaluate(Request{Action: "s3:ListBucket", Resource: "*", Context: test.context}).Decision == Allowed
+		if got != test.want {
+			t.Errorf("%s with %v allowed the request: %t instead of %t", test.condition, test.context, got, test.want)
+		}
+	}
+}
+
+func TestEvaluatePolicyVariables(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	p := MustParse(`{"Statement":{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::doc-example-bucket/${aws:username}/*"}}`)
+
+	req := Request{
+		Action:   "s3:GetObject",
+		Resource: "arn:aws:s3:::doc-example-bucket/ana/notes.txt",
+		Context:  map[string][]string{"aws:username": {"ana"}},
+	}
+
+	if p.Evaluate(req).Decision != Allowed {
+		t.Error("The user could not read their own folder")
+	}
+
+	req.Context["aws:username"] = []string{"*"}
+	if p.Evaluate(req).Decision != ImplicitDeny {
+		t.Error("A variable with a wildcard matched another user's folder")
+	}
+
+	req.Context = nil
+	if p.Evaluate(req).Decision != ImplicitDeny {
+		t.Error("A missing variable matched")
+	}
+}
+
+// The bucket policy that ConfigureBucket in go/cloudtrail sets, for doc-example-bucket in account 123456789012
+func TestCloudTrailBucketPolicy(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	document, err := ioutil.ReadFile("testdata/cloudtrail-bucket-policy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Parse(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloudTrail := Principal{Type: "Service", ID: "cloudtrail.amazonaws.com"}
+	acl := map[string][]string{"s3:x-amz-acl": {"bucket-owner-full-control"}}
+
+	tests := []struct {
+		req  Request
+		want Decision
+		sid  string
+	}{
+		{Request{Principal: cloudTrail, Action: "s3:GetBucketAcl", Resource: "arn:aws:s3:::doc-example-bucket"}, Allowed, "AWSCloudTrailAclCheck20150319"},
+		{Request{Principal: cloudTrail, Action: "s3:PutObject", Resource: "arn:aws:s3:::doc-example-bucket/AWSLogs/123456789012/CloudTrail/log.json.gz", Context: acl}, Allowed, "AWSCloudTrailWrite20150319"},
+		{Request{Principal: cloudTrail, Action: "s3:PutObject", Resource: "arn:aws:s3:::doc-example-bucket/AWSLogs/123456789012/CloudTrail/log.json.gz"}, ImplicitDeny, ""},
+		{Request{Principal: cloudTrail, Action: "s3:PutObject", Resource: "arn:aws:s3:::doc-example-bucket/AWSLogs/210987654321/log.json.gz", Context: acl}, ImplicitDeny, ""},
+		{Request{Principal: Principal{Type: "AWS", ID: "arn:aws:iam::210987654321:root"}, Action: "s3:GetBucketAcl", Resource: "arn:aws:s3:::doc-example-bucket"}, ImplicitDeny, ""},
+		{Request{Action: "s3:GetBucketAcl", Resource: "arn:aws:s3:::doc-example-bucket"}, ImplicitDeny, ""},
+	}
+
+	for i, test := range tests {
+		got := p.Evaluate(test.req)
+		if got.Decision != test.want || (got.Statement != nil && got.Statement.Sid != test.sid) {
+			t.Errorf("Request %d was %v by %+v instead of %v by %s", i, got.Decision, got.Statement, test.want, test.sid)
+		}
+	}
+}
+
+// A fixture test of an abridged copy of the AmazonDynamoDBFullAccess managed policy,
+// which AttachDynamoFullPolicy in gov2/iam/AttachUserPolicy attaches
+func TestDynamoDBFullAccessPolicy(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	document, err := ioutil.ReadFile("testdata/dynamodb-full-access-policy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Parse(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := "arn:aws:dynamodb:us-west-2:123456789012:table/doc-example-table"
+
+	tests := []struct {
+		req  Request
+		want Decision
+	}{
+		{Request{Action: "dynamodb:GetItem", Resource: table}, Allowed},
+		{Request{Action: "dynamodb:DeleteTable", Resource: table}, Allowed},
+		{Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::doc-example-bucket/key"}, ImplicitDeny},
+		{Request{Action: "iam:PassRole", Resource: "arn:aws:iam::123456789012:role/dax",
+			Context: map[string][]string{"iam:PassedToService": {"dax.amazonaws.com"}}}, Allowed},
+		{Request{Action: "iam:PassRole", Resource: "arn:aws:iam::123456789012:role/admin",
+			Context: map[string][]string{"iam:PassedToService": {"ec2.amazonaws.com"}}}, ImplicitDeny},
+	}
+
+	for i, test := range tests {
+		got := p.Evaluate(test.req)
+		if got.Decision != test.want {
+			t.Errorf("Request %d was %v instead of %v", i, got.Decision, test.want)
+		}
+	}
+}
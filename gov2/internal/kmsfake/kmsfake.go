@@ -0,0 +1,338 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package kmsfake provides an in-memory stand-in for the AWS Key Management Service (AWS KMS) client.
+//
+// A Service implements the per-operation interfaces used by the gov2/kms examples,
+// such as KMSEncryptAPI and KMSDecryptAPI, against a set of symmetric customer master keys (CMKs).
+// Ciphertexts really are encrypted, with AES-GCM under a random key per CMK,
+// and carry the ID of their CMK, so Decrypt doesn't need a KeyId, just as in AWS KMS.
+// Failures are returned as the same error types the SDK returns, such as *types.NotFoundException.
+package kmsfake
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+)
+
+// Service is an in-memory AWS KMS.
+// The zero value is not usable; call New to create one.
+// A Service is safe for concurrent use.
+type Service struct {
+	// Region and AccountID are used to build key ARNs.
+	Region    string
+	AccountID string
+
+	mu      sync.Mutex
+	keys    map[string]*key
+	aliases map[string]string
+	nextID  int
+}
+
+type key struct {
+	id          string
+	description string
+	material    []byte
+}
+
+// New creates a Service with no keys.
+func New() *Service {
+	return &Service{
+		Region:    "us-west-2",
+		AccountID: "123456789012",
+		keys:      map[string]*key{},
+		aliases:   map[string]string{},
+	}
+}
+
+func errValidation(message string) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: message, Fault: smithy.FaultClient}
+}
+
+func (s *Service) arn(id string) string {
+	return fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", s.Region, s.AccountID, id)
+}
+
+// lookup finds a key by key ID, key ARN, alias name, or alias ARN.
+// The caller must hold s.mu.
+func (s *Service) lookup(keyID *string) (*key, error) {
+	id := aws.ToString(keyID)
+	if id == "" {
+		return nil, errValidation("KeyId is required")
+	}
+
+	aliasPrefix := fmt.Sprintf("arn:aws:kms:%s:%s:", s.Region, s.AccountID)
+	if strings.HasPrefix(id, aliasPrefix+"alias/") {
+		id = strings.TrimPrefix(id, aliasPrefix)
+	}
+
+	if strings.HasPrefix(id, "alias/") {
+		target, ok := s.aliases[id]
+		if !ok {
+			return nil, &types.NotFoundException{Message: aws.String("Alias " + id + " is not found.")}
+		}
+
+		id = target
+	}
+
+	id = strings.TrimPrefix(id, aliasPrefix+"key/")
+
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, &types.NotFoundException{Message: aws.String("Key '" + s.arn(id) + "' does not exist")}
+	}
+
+	return k, nil
+}
+
+// CreateKey creates a symmetric CMK with random key material.
+func (s *Service) CreateKey(ctx context.Context,
+	params *kms.CreateKeyInput,
+	optFns ...func(*kms.Options)) (*kms.CreateKeyOutput, error) {
+
+	material := make([]byte, 32)
+	_, err := rand.Read(material)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	k := &key{
+		id:          fmt.Sprintf("1234abcd-12ab-34cd-56ef-%012d", s.nextID),
+		description: aws.ToString(params.Description),
+		material:    material,
+	}
+	s.keys[k.id] = k
+
+	return &kms.CreateKeyOutput{
+		KeyMetadata: &types.KeyMetadata{
+			KeyId:       aws.String(k.id),
+			Arn:         aws.String(s.arn(k.id)),
+			Description: aws.String(k.description),
+			Enabled:     true,
+			KeyState:    types.KeyStateEnabled,
+			KeyUsage:    types.KeyUsageTypeEncryptDecrypt,
+			KeyManager:  types.KeyManagerTypeCustomer,
+		},
+	}, nil
+}
+
+// CreateAlias gives a CMK an alias, such as alias/doc-example.
+func (s *Service) CreateAlias(ctx context.Context,
+	params *kms.CreateAliasInput,
+	optFns ...func(*kms.Options)) (*kms.CreateAliasOutput, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.AliasName)
+	if !strings.HasPrefix(name, "alias/") || strings.HasPrefix(name, "alias/aws/") {
+		return nil, &types.InvalidAliasNameException{Message: aws.String("Alias must start with the prefix \"alias/\" and not be reserved.")}
+	}
+
+	if _, ok := s.aliases[name]; ok {
+		return nil, &types.AlreadyExistsException{Message: aws.String("An alias with the name " + name + " already exists")}
+	}
+
+	k, err := s.lookup(params.TargetKeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	s.aliases[name] = k.id
+
+	return &kms.CreateAliasOutput{}, nil
+}
+
+// encryptionContextAAD returns the encryption context in a canonical form,
+// so that a ciphertext decrypts only with the same context.
+func encryptionContextAAD(ec map[string]string) []byte {
+	keys := make([]string, 0, len(ec))
+	for k := range ec {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%d:%s%d:%s", len(k), k, len(ec[k]), ec[k])
+	}
+
+	return b.Bytes()
+}
+
+// seal encrypts plaintext under k. The ciphertext is the key ID, a zero byte, the nonce, and the sealed data.
+func (k *key) seal(plaintext []byte, ec map[string]string) ([]byte, error) {
+	block, err := aes.NewCipher(k.material)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := append([]byte(k.id), 0)
+	blob = append(blob, nonce...)
+
+	return gcm.Seal(blob, nonce, plaintext, encryptionContextAAD(ec)), nil
+}
+
+// Encrypt encrypts up to 4096 bytes under a CMK.
+func (s *Service) Encrypt(ctx context.Context,
+	params *kms.EncryptInput,
+	optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+
+	if len(params.Plaintext) == 0 || len(params.Plaintext) > 4096 {
+		return nil, errValidation("Plaintext must be between 1 and 4096 bytes")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, err := s.lookup(params.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := k.seal(params.Plaintext, params.EncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.EncryptOutput{
+		CiphertextBlob:      blob,
+		KeyId:               aws.String(s.arn(k.id)),
+		EncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault,
+	}, nil
+}
+
+// GenerateDataKey returns a random data key, in plaintext and encrypted under a CMK.
+// Exactly one of KeySpec and NumberOfBytes must be set.
+func (s *Service) GenerateDataKey(ctx context.Context,
+	params *kms.GenerateDataKeyInput,
+	optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+
+	var n int32
+	switch {
+	case params.KeySpec != "" && params.NumberOfBytes != nil:
+		return nil, errValidation("Specify either KeySpec or NumberOfBytes, not both")
+	case params.KeySpec == types.DataKeySpecAes256:
+		n = 32
+	case params.KeySpec == types.DataKeySpecAes128:
+		n = 16
+	case params.KeySpec != "":
+		return nil, errValidation("KeySpec must be AES_256 or AES_128")
+	case params.NumberOfBytes != nil && *params.NumberOfBytes >= 1 && *params.NumberOfBytes <= 1024:
+		n = *params.NumberOfBytes
+	default:
+		return nil, errValidation("Specify KeySpec, or NumberOfBytes between 1 and 1024")
+	}
+
+	plaintext := make([]byte, n)
+	_, err := rand.Read(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, err := s.lookup(params.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := k.seal(plaintext, params.EncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.GenerateDataKeyOutput{
+		CiphertextBlob: blob,
+		KeyId:          aws.String(s.arn(k.id)),
+		Plaintext:      plaintext,
+	}, nil
+}
+
+// Decrypt decrypts a ciphertext from Encrypt or GenerateDataKey.
+// If KeyId is set, it must name the CMK that the ciphertext was encrypted under.
+func (s *Service) Decrypt(ctx context.Context,
+	params *kms.DecryptInput,
+	optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+
+	invalid := &types.InvalidCiphertextException{}
+
+	i := bytes.IndexByte(params.CiphertextBlob, 0)
+	if i < 0 {
+		return nil, invalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[string(params.CiphertextBlob[:i])]
+	if !ok {
+		return nil, invalid
+	}
+
+	if params.KeyId != nil {
+		want, err := s.lookup(params.KeyId)
+		if err != nil {
+			return nil, err
+		}
+
+		if want != k {
+			return nil, &types.IncorrectKeyException{Message: aws.String("The key ID in the request does not identify a CMK that can perform this operation.")}
+		}
+	}
+
+	block, err := aes.NewCipher(k.material)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := params.CiphertextBlob[i+1:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, invalid
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], encryptionContextAAD(params.EncryptionContext))
+	if err != nil {
+		return nil, invalid
+	}
+
+	return &kms.DecryptOutput{
+		KeyId:               aws.String(s.arn(k.id)),
+		Plaintext:           plaintext,
+		EncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault,
+	}, nil
+}
@@ -0,0 +1,111 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package kmsfake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+func createKey(t *testing.T, s *Service) string {
+	output, err := s.CreateKey(context.Background(), &kms.CreateKeyInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return *output.KeyMetadata.KeyId
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	keyID := createKey(t, s)
+	otherID := createKey(t, s)
+
+	_, err := s.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String("alias/doc-example"), TargetKeyId: aws.String(keyID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := s.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             aws.String("alias/doc-example"),
+		Plaintext:         []byte("Hello"),
+		EncryptionContext: map[string]string{"purpose": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(encrypted.CiphertextBlob, []byte("Hello")) {
+		t.Error("the ciphertext contains the plaintext")
+	}
+
+	decrypted, err := s.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    encrypted.CiphertextBlob,
+		EncryptionContext: map[string]string{"purpose": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(decrypted.Plaintext) != "Hello" || aws.ToString(decrypted.KeyId) != s.arn(keyID) {
+		t.Errorf("got %q from %v", decrypted.Plaintext, aws.ToString(decrypted.KeyId))
+	}
+
+	_, err = s.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: encrypted.CiphertextBlob})
+	var invalid *types.InvalidCiphertextException
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v without the encryption context, want InvalidCiphertextException", err)
+	}
+
+	_, err = s.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    encrypted.CiphertextBlob,
+		EncryptionContext: map[string]string{"purpose": "test"},
+		KeyId:             aws.String(otherID),
+	})
+	var incorrect *types.IncorrectKeyException
+	if !errors.As(err, &incorrect) {
+		t.Errorf("got %v for the wrong key, want IncorrectKeyException", err)
+	}
+
+	_, err = s.Encrypt(ctx, &kms.EncryptInput{KeyId: aws.String("alias/missing"), Plaintext: []byte("Hello")})
+	var notFound *types.NotFoundException
+	if !errors.As(err, &notFound) {
+		t.Errorf("got %v, want NotFoundException", err)
+	}
+}
+
+func TestGenerateDataKey(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	keyID := createKey(t, s)
+
+	dataKey, err := s.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{KeyId: aws.String(s.arn(keyID)), KeySpec: types.DataKeySpecAes256})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dataKey.Plaintext) != 32 {
+		t.Fatalf("got a %d-byte key, want 32", len(dataKey.Plaintext))
+	}
+
+	decrypted, err := s.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: dataKey.CiphertextBlob})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted.Plaintext, dataKey.Plaintext) {
+		t.Error("the decrypted data key doesn't match")
+	}
+
+	_, err = s.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{KeyId: aws.String(keyID)})
+	if err == nil {
+		t.Error("got no error without KeySpec or NumberOfBytes")
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package localaws
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+func TestS3(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	client := s3.NewFromConfig(server.Config())
+	ctx := context.Background()
+
+	_, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String("doc-example-bucket"),
+		Key:         aws.String("dir/hello.txt"),
+		Body:        strings.NewReader("Hello, world"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]string{"Author": "doc-example"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("dir/hello.txt"),
+		Range:  aws.String("bytes=7-"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(got.Body)
+	got.Body.Close()
+	if string(body) != "world" || aws.ToString(got.ContentType) != "text/plain" || got.Metadata["author"] != "doc-example" {
+		t.Errorf("got %q, %v, %v", body, aws.ToString(got.ContentType), got.Metadata)
+	}
+
+	list, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String("doc-example-bucket"),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.CommonPrefixes) != 1 || aws.ToString(list.CommonPrefixes[0].Prefix) != "dir/" {
+		t.Errorf("got common prefixes %v, want dir/", list.CommonPrefixes)
+	}
+
+	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("missing"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "NotFound") {
+		t.Errorf("got %v, want NotFound", err)
+	}
+
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("missing"),
+	})
+	var noSuchKey *s3types.NoSuchKey
+	if !errors.As(err, &noSuchKey) {
+		t.Errorf("got %v, want NoSuchKey", err)
+	}
+
+	buckets, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buckets.Buckets) != 1 || aws.ToString(buckets.Buckets[0].Name) != "doc-example-bucket" {
+		t.Errorf("got buckets %v", buckets.Buckets)
+	}
+}
+
+func TestSQS(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	client := sqs.NewFromConfig(server.Config())
+	ctx := context.Background()
+
+	created, err := client.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName:  aws.String("doc-example-queue"),
+		Attributes: map[string]string{"VisibilityTimeout": "60"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    created.QueueUrl,
+		MessageBody: aws.String("Hello"),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"Title": {DataType: aws.String("String"), StringValue: aws.String("The Whistler")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              created.QueueUrl,
+		MessageAttributeNames: []string{"All"},
+		AttributeNames:        []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.Messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(received.Messages))
+	}
+
+	m := received.Messages[0]
+	if aws.ToString(m.Body) != "Hello" || aws.ToString(m.MessageAttributes["Title"].StringValue) != "The Whistler" ||
+		m.Attributes["ApproximateReceiveCount"] != "1" {
+		t.Errorf("got %v, %v, %v", aws.ToString(m.Body), m.MessageAttributes, m.Attributes)
+	}
+
+	attributes, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       created.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{"VisibilityTimeout", "ApproximateNumberOfMessagesNotVisible"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attributes.Attributes["VisibilityTimeout"] != "60" || attributes.Attributes["ApproximateNumberOfMessagesNotVisible"] != "1" {
+		t.Errorf("got attributes %v", attributes.Attributes)
+	}
+
+	_, err = client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      created.QueueUrl,
+		ReceiptHandle: m.ReceiptHandle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: created.QueueUrl,
+		Entries: []sqstypes.SendMessageBatchRequestEntry{
+			{Id: aws.String("first"), MessageBody: aws.String("One")},
+			{Id: aws.String("second"), MessageBody: aws.String("Two"), DelaySeconds: 901},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batch.Successful) != 1 || aws.ToString(batch.Successful[0].Id) != "first" ||
+		len(batch.Failed) != 1 || aws.ToString(batch.Failed[0].Code) != "InvalidParameterValue" {
+		t.Errorf("got successful %+v and failed %+v", batch.Successful, batch.Failed)
+	}
+
+	dlq, err := client.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String("doc-example-dlq")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl: created.QueueUrl,
+		Attributes: map[string]string{
+			"RedrivePolicy": `{"deadLetterTargetArn":"` + server.SQS.QueueARN("doc-example-dlq") + `","maxReceiveCount":"5"}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := client.ListDeadLetterSourceQueues(ctx, &sqs.ListDeadLetterSourceQueuesInput{QueueUrl: dlq.QueueUrl})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sources.QueueUrls) != 1 || sources.QueueUrls[0] != aws.ToString(created.QueueUrl) {
+		t.Errorf("got source queues %v", sources.QueueUrls)
+	}
+
+	_, err = client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String("missing")})
+	var notExist *sqstypes.QueueDoesNotExist
+	if !errors.As(err, &notExist) {
+		t.Errorf("got %v, want QueueDoesNotExist", err)
+	}
+}
+
+func TestSNS(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	client := sns.NewFromConfig(server.Config())
+	ctx := context.Background()
+
+	topic, err := client.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("doc-example-topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:   topic.TopicArn,
+		Protocol:   aws.String("email"),
+		Endpoint:   aws.String("someone@example.com"),
+		Attributes: map[string]string{"FilterPolicy": `{"store":["example_corp"]}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := client.ListSubscriptionsByTopic(ctx, &sns.ListSubscriptionsByTopicInput{TopicArn: topic.TopicArn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subs.Subscriptions) != 1 || aws.ToString(subs.Subscriptions[0].Endpoint) != "someone@example.com" {
+		t.Fatalf("got subscriptions %v", subs.Subscriptions)
+	}
+
+	attributes, err := client.GetSubscriptionAttributes(ctx, &sns.GetSubscriptionAttributesInput{
+		SubscriptionArn: subs.Subscriptions[0].SubscriptionArn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attributes.Attributes["FilterPolicy"] != `{"store":["example_corp"]}` {
+		t.Errorf("got attributes %v", attributes.Attributes)
+	}
+
+	_, err = client.Publish(ctx, &sns.PublishInput{
+		TopicArn: topic.TopicArn,
+		Message:  aws.String("Hello"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if published := server.SNS.Published(); len(published) != 1 || published[0].Message != "Hello" {
+		t.Errorf("got published %v", published)
+	}
+}
+
+func TestSNSToSQS(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+
+	topic, err := server.SNS.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("doc-example-topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first queue lets the topic send to it
+	var queueURLs []string
+	for _, name := range []string{"doc-example-allowed", "doc-example-denied"} {
+		arn := server.SQS.QueueARN(name)
+		policy := `{"Statement":[{"Effect":"Allow","Principal":{"Service":"sns.amazonaws.com"},"Action":"sqs:SendMessage","Resource":"` + arn +
+			`","Condition":{"ArnEquals":{"aws:SourceArn":"` + server.SNS.TopicARN("doc-example-other-topic") + `"}}}]}`
+		if name == "doc-example-allowed" {
+			policy = strings.Replace(policy, "doc-example-other-topic", "doc-example-topic", 1)
+		}
+
+		queue, err := server.SQS.CreateQueue(ctx, &sqs.CreateQueueInput{
+			QueueName:  aws.String(name),
+			Attributes: map[string]string{"Policy": policy},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		queueURLs = append(queueURLs, *queue.QueueUrl)
+
+		_, err = server.SNS.Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn:   topic.TopicArn,
+			Protocol:   aws.String("sqs"),
+			Endpoint:   aws.String(arn),
+			Attributes: map[string]string{"RawMessageDelivery": "true"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := sns.NewFromConfig(server.Config())
+
+	_, err = client.Publish(ctx, &sns.PublishInput{
+		TopicArn: topic.TopicArn,
+		Message:  aws.String("Hello"),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"store": {DataType: aws.String("String"), StringValue: aws.String("example_corp")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, queueURL := range queueURLs {
+		received, err := server.SQS.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(queueURL),
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 1 {
+			if len(received.Messages) != 0 {
+				t.Errorf("the queue policy didn't stop the delivery to %s", queueURL)
+			}
+
+			continue
+		}
+
+		if len(received.Messages) != 1 || aws.ToString(received.Messages[0].Body) != "Hello" ||
+			aws.ToString(received.Messages[0].MessageAttributes["store"].StringValue) != "example_corp" {
+			t.Errorf("got messages %v", received.Messages)
+		}
+	}
+}
+
+func TestSSM(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), server.LoadOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := ssm.NewFromConfig(cfg)
+	ctx := context.Background()
+
+	_, err = client.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:  aws.String("/doc-example/port"),
+		Value: aws.String("5432"),
+		Type:  ssmtypes.ParameterTypeString,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String("/doc-example/port")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aws.ToString(got.Parameter.Value) != "5432" || got.Parameter.Version != 1 || got.Parameter.LastModifiedDate == nil {
+		t.Errorf("got %v", got.Parameter)
+	}
+
+	_, err = client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String("/doc-example/missing")})
+	var notFound *ssmtypes.ParameterNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("got %v, want ParameterNotFound", err)
+	}
+}
+
+func TestSTS(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	client := sts.NewFromConfig(server.Config())
+	ctx := context.Background()
+
+	output, err := client.AssumeRole(ctx, &sts.AssumeRoleInput{
+		RoleArn:         aws.String("arn:aws:iam::123456789012:role/doc-example-role"),
+		RoleSessionName: aws.String("doc-example-session"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output.Credentials.Expiration == nil || aws.ToString(output.AssumedRoleUser.Arn) !=
+		"arn:aws:sts::123456789012:assumed-role/doc-example-role/doc-example-session" {
+		t.Errorf("got %v, %v", output.Credentials, aws.ToString(output.AssumedRoleUser.Arn))
+	}
+
+	// Calls signed with the new credentials are made as the role
+	cfg := server.Config()
+	cfg.Credentials = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{
+			AccessKeyID:     aws.ToString(output.Credentials.AccessKeyId),
+			SecretAccessKey: aws.ToString(output.Credentials.SecretAccessKey),
+			SessionToken:    aws.ToString(output.Credentials.SessionToken),
+		}, nil
+	})
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aws.ToString(identity.Arn) != aws.ToString(output.AssumedRoleUser.Arn) {
+		t.Errorf("got caller %v, want %v", aws.ToString(identity.Arn), aws.ToString(output.AssumedRoleUser.Arn))
+	}
+}
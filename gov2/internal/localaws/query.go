@@ -0,0 +1,174 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package localaws
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// queryAction handles one query protocol action.
+// It writes the content of the action's <ActionResult> element to b.
+type queryAction func(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error
+
+// serveQuery handles a query protocol request: a form-encoded POST naming an Action,
+// answered by an XML <ActionResponse> or <ErrorResponse>.
+func (s *Server) serveQuery(w http.ResponseWriter, r *http.Request, rc *requestContext, namespace string, actions func(string) queryAction) {
+	err := r.ParseForm()
+	if err != nil {
+		writeQueryError(w, rc, "MalformedQueryString", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := r.PostForm.Get("Action")
+	action := actions(name)
+	if action == nil {
+		writeQueryError(w, rc, "InvalidAction", "The action "+name+" is not valid for this endpoint.", http.StatusBadRequest)
+		return
+	}
+
+	var b xmlBuilder
+	err = action(r.Context(), rc, r.PostForm, &b)
+	if err != nil {
+		code, message, status := apiError(err)
+		writeQueryError(w, rc, code, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte(`<` + name + `Response xmlns="` + namespace + `"><` + name + `Result>`))
+	w.Write([]byte(b.String()))
+	w.Write([]byte(`</` + name + `Result><ResponseMetadata><RequestId>` + rc.requestID + `</RequestId></ResponseMetadata></` + name + `Response>`))
+}
+
+func writeQueryError(w http.ResponseWriter, rc *requestContext, code, message string, status int) {
+	errorType := "Sender"
+	if status >= http.StatusInternalServerError {
+		errorType = "Receiver"
+	}
+
+	var b xmlBuilder
+	b.open("ErrorResponse")
+	b.open("Error")
+	b.elem("Type", errorType)
+	b.elem("Code", code)
+	b.elem("Message", message)
+	b.close("Error")
+	b.elem("RequestId", rc.requestID)
+	b.close("ErrorResponse")
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(b.String()))
+}
+
+// entries returns the prefixes of the members of a list or map parameter, in order.
+// Flattened members are named prefix.1, prefix.2, and so on;
+// wrapped list members are prefix.member.1, and wrapped map entries are prefix.entry.1.
+func entries(form url.Values, prefix string) []string {
+	has := func(p string) bool {
+		if _, ok := form[p]; ok {
+			return true
+		}
+
+		for key := range form {
+			if strings.HasPrefix(key, p+".") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, wrapper := range []string{"", ".member", ".entry"} {
+		var found []string
+		for i := 1; ; i++ {
+			p := prefix + wrapper + "." + strconv.Itoa(i)
+			if !has(p) {
+				break
+			}
+
+			found = append(found, p)
+		}
+
+		if len(found) > 0 {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// formList returns the values of a list parameter.
+func formList(form url.Values, prefix string) []string {
+	var values []string
+	for _, p := range entries(form, prefix) {
+		values = append(values, form.Get(p))
+	}
+
+	return values
+}
+
+// formMap returns the entries of a map parameter whose keys and values are strings.
+func formMap(form url.Values, prefix, keyName, valueName string) map[string]string {
+	list := entries(form, prefix)
+	if list == nil {
+		return nil
+	}
+
+	m := map[string]string{}
+	for _, p := range list {
+		m[form.Get(p+"."+keyName)] = form.Get(p + "." + valueName)
+	}
+
+	return m
+}
+
+// formString returns a string parameter, or nil if it's missing.
+func formString(form url.Values, name string) *string {
+	if _, ok := form[name]; !ok {
+		return nil
+	}
+
+	return aws.String(form.Get(name))
+}
+
+// formInt32 returns an integer parameter, or 0 if it's missing or not a number.
+func formInt32(form url.Values, name string) int32 {
+	n, _ := strconv.ParseInt(form.Get(name), 10, 32)
+	return int32(n)
+}
+
+// formInt32Ptr returns an integer parameter, or nil if it's missing.
+func formInt32Ptr(form url.Values, name string) *int32 {
+	if _, ok := form[name]; !ok {
+		return nil
+	}
+
+	return aws.Int32(formInt32(form, name))
+}
+
+// formBool returns a Boolean parameter.
+func formBool(form url.Values, name string) bool {
+	return form.Get(name) == "true"
+}
+
+// formBlob returns a base64-encoded blob parameter.
+func formBlob(form url.Values, name string) []byte {
+	if _, ok := form[name]; !ok {
+		return nil
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(form.Get(name))
+	if data == nil {
+		data = []byte{}
+	}
+
+	return data
+}
@@ -0,0 +1,530 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package localaws
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3Time formats a timestamp for an XML body.
+func s3Time(t *time.Time) string {
+	return aws.ToTime(t).UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// s3Status returns the HTTP status Amazon S3 uses for an error code.
+func s3Status(code string, status int) int {
+	switch code {
+	case "NoSuchBucket", "NoSuchKey", "NoSuchVersion", "NotFound":
+		return http.StatusNotFound
+	case "BucketAlreadyExists", "BucketAlreadyOwnedByYou", "BucketNotEmpty":
+		return http.StatusConflict
+	case "InvalidRange":
+		return http.StatusRequestedRangeNotSatisfiable
+	case "MethodNotAllowed":
+		return http.StatusMethodNotAllowed
+	case "NotImplemented":
+		return http.StatusNotImplemented
+	}
+
+	return status
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, rc *requestContext, err error) {
+	code, message, status := apiError(err)
+	status = s3Status(code, status)
+
+	w.WriteHeader(status)
+
+	// Like Amazon S3, don't send a body in reply to HEAD
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	var b xmlBuilder
+	b.open("Error")
+	b.elem("Code", code)
+	b.elem("Message", message)
+	b.elem("RequestId", rc.requestID)
+	b.close("Error")
+
+	w.Write([]byte(b.String()))
+}
+
+func writeS3XML(w http.ResponseWriter, b *xmlBuilder) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>`))
+	w.Write([]byte(b.String()))
+}
+
+func notImplemented(r *http.Request) error {
+	return &smithy.GenericAPIError{
+		Code:    "NotImplemented",
+		Message: "localaws does not implement this Amazon S3 request: " + r.Method + " " + r.URL.String(),
+	}
+}
+
+// stringHeader returns a header, or nil if it's missing.
+func stringHeader(h http.Header, name string) *string {
+	if _, ok := h[http.CanonicalHeaderKey(name)]; !ok {
+		return nil
+	}
+
+	return aws.String(h.Get(name))
+}
+
+// metadataHeaders returns the user-defined metadata in x-amz-meta-* headers.
+func metadataHeaders(h http.Header) map[string]string {
+	var metadata map[string]string
+	for name := range h {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-meta-") {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+
+			metadata[strings.TrimPrefix(lower, "x-amz-meta-")] = h.Get(name)
+		}
+	}
+
+	return metadata
+}
+
+// serveS3 handles a REST-XML request addressed path-style, as /bucket/key.
+func (s *Server) serveS3(w http.ResponseWriter, r *http.Request, rc *requestContext) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+
+	// The SDK names some operations in an x-id parameter; the rest of the query tells them apart
+	query := r.URL.Query()
+	xid := query.Get("x-id")
+	query.Del("x-id")
+
+	var err error
+	switch {
+	case xid != "" && xid != "GetObject" && xid != "PutObject" && xid != "CopyObject" && xid != "DeleteObject":
+		err = notImplemented(r)
+	case bucket == "" && r.Method == http.MethodGet:
+		err = s.s3ListBuckets(w, r)
+	case bucket == "":
+		err = notImplemented(r)
+	case key == "":
+		err = s.serveS3Bucket(w, r, bucket, query)
+	default:
+		err = s.serveS3Object(w, r, bucket, key, query)
+	}
+
+	if err != nil {
+		writeS3Error(w, r, rc, err)
+	}
+}
+
+func (s *Server) serveS3Bucket(w http.ResponseWriter, r *http.Request, bucket string, query url.Values) error {
+	_, versioning := query["versioning"]
+	_, deletes := query["delete"]
+
+	switch {
+	case versioning && r.Method == http.MethodGet:
+		return s.s3GetBucketVersioning(w, r, bucket)
+	case versioning && r.Method == http.MethodPut:
+		return s.s3PutBucketVersioning(w, r, bucket)
+	case deletes && r.Method == http.MethodPost:
+		return s.s3DeleteObjects(w, r, bucket)
+	case len(query) > 0 && (len(query["list-type"]) == 0 || r.Method != http.MethodGet):
+		return notImplemented(r)
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		_, err := s.S3.CreateBucket(r.Context(), &s3.CreateBucketInput{
+			Bucket: aws.String(bucket),
+			ACL:    types.BucketCannedACL(r.Header.Get("X-Amz-Acl")),
+		})
+		if err != nil {
+			return err
+		}
+
+		w.Header().Set("Location", "/"+bucket)
+	case http.MethodDelete:
+		_, err := s.S3.DeleteBucket(r.Context(), &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return err
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodHead:
+		_, err := s.S3.HeadBucket(r.Context(), &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return err
+		}
+	case http.MethodGet:
+		return s.s3ListObjectsV2(w, r, bucket)
+	default:
+		return notImplemented(r)
+	}
+
+	return nil
+}
+
+func (s *Server) serveS3Object(w http.ResponseWriter, r *http.Request, bucket, key string, query url.Values) error {
+	if len(query) > 0 && len(query["versionId"]) == 0 {
+		return notImplemented(r)
+	}
+
+	versionID := formString(query, "versionId")
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return s.s3CopyObject(w, r, bucket, key)
+		}
+
+		return s.s3PutObject(w, r, bucket, key)
+	case http.MethodGet, http.MethodHead:
+		return s.s3GetObject(w, r, bucket, key, versionID)
+	case http.MethodDelete:
+		output, err := s.S3.DeleteObject(r.Context(), &s3.DeleteObjectInput{
+			Bucket:    aws.String(bucket),
+			Key:       aws.String(key),
+			VersionId: versionID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if output.DeleteMarker {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+		}
+
+		if output.VersionId != nil {
+			w.Header().Set("X-Amz-Version-Id", *output.VersionId)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return nil
+	}
+
+	return notImplemented(r)
+}
+
+func (s *Server) s3ListBuckets(w http.ResponseWriter, r *http.Request) error {
+	output, err := s.S3.ListBuckets(r.Context(), &s3.ListBucketsInput{})
+	if err != nil {
+		return err
+	}
+
+	var b xmlBuilder
+	b.WriteString(`<ListAllMyBucketsResult xmlns="` + s3Namespace + `">`)
+	if output.Owner != nil {
+		b.open("Owner")
+		b.elemPtr("ID", output.Owner.ID)
+		b.elemPtr("DisplayName", output.Owner.DisplayName)
+		b.close("Owner")
+	}
+
+	b.open("Buckets")
+	for _, bucket := range output.Buckets {
+		b.open("Bucket")
+		b.elemPtr("Name", bucket.Name)
+		b.elem("CreationDate", s3Time(bucket.CreationDate))
+		b.close("Bucket")
+	}
+	b.close("Buckets")
+	b.close("ListAllMyBucketsResult")
+
+	writeS3XML(w, &b)
+
+	return nil
+}
+
+func (s *Server) s3ListObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	input := &s3.ListObjectsV2Input{
+		Bucket:            aws.String(bucket),
+		Prefix:            formString(query, "prefix"),
+		Delimiter:         formString(query, "delimiter"),
+		StartAfter:        formString(query, "start-after"),
+		ContinuationToken: formString(query, "continuation-token"),
+	}
+
+	if v := query.Get("max-keys"); v != "" {
+		n, _ := strconv.Atoi(v)
+		input.MaxKeys = int32(n)
+	}
+
+	output, err := s.S3.ListObjectsV2(r.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	var b xmlBuilder
+	b.WriteString(`<ListBucketResult xmlns="` + s3Namespace + `">`)
+	b.elemPtr("Name", output.Name)
+	b.elemPtr("Prefix", output.Prefix)
+	b.elemPtr("Delimiter", output.Delimiter)
+	b.elemPtr("StartAfter", output.StartAfter)
+	b.elemPtr("ContinuationToken", output.ContinuationToken)
+	b.elemPtr("NextContinuationToken", output.NextContinuationToken)
+	b.elem("KeyCount", strconv.Itoa(int(output.KeyCount)))
+	b.elem("MaxKeys", strconv.Itoa(int(output.MaxKeys)))
+	b.elem("IsTruncated", strconv.FormatBool(output.IsTruncated))
+
+	for _, obj := range output.Contents {
+		b.open("Contents")
+		b.elemPtr("Key", obj.Key)
+		b.elem("LastModified", s3Time(obj.LastModified))
+		b.elemPtr("ETag", obj.ETag)
+		b.elem("Size", strconv.FormatInt(obj.Size, 10))
+		b.elem("StorageClass", string(obj.StorageClass))
+		b.close("Contents")
+	}
+
+	for _, p := range output.CommonPrefixes {
+		b.open("CommonPrefixes")
+		b.elemPtr("Prefix", p.Prefix)
+		b.close("CommonPrefixes")
+	}
+
+	b.close("ListBucketResult")
+
+	writeS3XML(w, &b)
+
+	return nil
+}
+
+func (s *Server) s3GetBucketVersioning(w http.ResponseWriter, r *http.Request, bucket string) error {
+	output, err := s.S3.GetBucketVersioning(r.Context(), &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return err
+	}
+
+	var b xmlBuilder
+	b.WriteString(`<VersioningConfiguration xmlns="` + s3Namespace + `">`)
+	if output.Status != "" {
+		b.elem("Status", string(output.Status))
+	}
+	b.close("VersioningConfiguration")
+
+	writeS3XML(w, &b)
+
+	return nil
+}
+
+func (s *Server) s3PutBucketVersioning(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var config struct {
+		Status string
+	}
+
+	err := xml.NewDecoder(r.Body).Decode(&config)
+	if err != nil {
+		return &smithy.GenericAPIError{Code: "MalformedXML", Message: err.Error()}
+	}
+
+	_, err = s.S3.PutBucketVersioning(r.Context(), &s3.PutBucketVersioningInput{
+		Bucket: aws.String(bucket),
+		VersioningConfiguration: &types.VersioningConfiguration{
+			Status: types.BucketVersioningStatus(config.Status),
+		},
+	})
+
+	return err
+}
+
+func (s *Server) s3DeleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var request struct {
+		Quiet  bool
+		Object []struct {
+			Key       string
+			VersionId *string
+		}
+	}
+
+	err := xml.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return &smithy.GenericAPIError{Code: "MalformedXML", Message: err.Error()}
+	}
+
+	input := &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{Quiet: request.Quiet},
+	}
+
+	for _, obj := range request.Object {
+		input.Delete.Objects = append(input.Delete.Objects, types.ObjectIdentifier{
+			Key:       aws.String(obj.Key),
+			VersionId: obj.VersionId,
+		})
+	}
+
+	output, err := s.S3.DeleteObjects(r.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	var b xmlBuilder
+	b.WriteString(`<DeleteResult xmlns="` + s3Namespace + `">`)
+	for _, d := range output.Deleted {
+		b.open("Deleted")
+		b.elemPtr("Key", d.Key)
+		b.elemPtr("VersionId", d.VersionId)
+		if d.DeleteMarker {
+			b.elem("DeleteMarker", "true")
+		}
+		b.elemPtr("DeleteMarkerVersionId", d.DeleteMarkerVersionId)
+		b.close("Deleted")
+	}
+
+	for _, e := range output.Errors {
+		b.open("Error")
+		b.elemPtr("Key", e.Key)
+		b.elemPtr("VersionId", e.VersionId)
+		b.elemPtr("Code", e.Code)
+		b.elemPtr("Message", e.Message)
+		b.close("Error")
+	}
+	b.close("DeleteResult")
+
+	writeS3XML(w, &b)
+
+	return nil
+}
+
+func (s *Server) s3PutObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	output, err := s.S3.PutObject(r.Context(), &s3.PutObjectInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		Body:            bytes.NewReader(data),
+		ACL:             types.ObjectCannedACL(r.Header.Get("X-Amz-Acl")),
+		ContentType:     stringHeader(r.Header, "Content-Type"),
+		ContentEncoding: stringHeader(r.Header, "Content-Encoding"),
+		Metadata:        metadataHeaders(r.Header),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", aws.ToString(output.ETag))
+	if output.VersionId != nil {
+		w.Header().Set("X-Amz-Version-Id", *output.VersionId)
+	}
+
+	return nil
+}
+
+func (s *Server) s3CopyObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	output, err := s.S3.CopyObject(r.Context(), &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(r.Header.Get("X-Amz-Copy-Source")),
+		ACL:               types.ObjectCannedACL(r.Header.Get("X-Amz-Acl")),
+		MetadataDirective: types.MetadataDirective(r.Header.Get("X-Amz-Metadata-Directive")),
+		ContentType:       stringHeader(r.Header, "Content-Type"),
+		Metadata:          metadataHeaders(r.Header),
+	})
+	if err != nil {
+		return err
+	}
+
+	if output.VersionId != nil {
+		w.Header().Set("X-Amz-Version-Id", *output.VersionId)
+	}
+
+	if output.CopySourceVersionId != nil {
+		w.Header().Set("X-Amz-Copy-Source-Version-Id", *output.CopySourceVersionId)
+	}
+
+	var b xmlBuilder
+	b.WriteString(`<CopyObjectResult xmlns="` + s3Namespace + `">`)
+	b.elem("LastModified", s3Time(output.CopyObjectResult.LastModified))
+	b.elemPtr("ETag", output.CopyObjectResult.ETag)
+	b.close("CopyObjectResult")
+
+	writeS3XML(w, &b)
+
+	return nil
+}
+
+// s3GetObject handles both GetObject and HeadObject, which differ only in whether the body is sent.
+func (s *Server) s3GetObject(w http.ResponseWriter, r *http.Request, bucket, key string, versionID *string) error {
+	if r.Method == http.MethodHead {
+		// Check for the object the way HeadObject does, so a missing one is NotFound rather than NoSuchKey
+		_, err := s.S3.HeadObject(r.Context(), &s3.HeadObjectInput{
+			Bucket:    aws.String(bucket),
+			Key:       aws.String(key),
+			VersionId: versionID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	output, err := s.S3.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: versionID,
+		Range:     stringHeader(r.Header, "Range"),
+	})
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+
+	h := w.Header()
+	h.Set("Content-Length", strconv.FormatInt(output.ContentLength, 10))
+	h.Set("ETag", aws.ToString(output.ETag))
+	h.Set("Last-Modified", aws.ToTime(output.LastModified).UTC().Format(http.TimeFormat))
+	h.Set("Accept-Ranges", aws.ToString(output.AcceptRanges))
+
+	if output.ContentType != nil {
+		h.Set("Content-Type", *output.ContentType)
+	}
+
+	if output.ContentEncoding != nil {
+		h.Set("Content-Encoding", *output.ContentEncoding)
+	}
+
+	if output.VersionId != nil {
+		h.Set("X-Amz-Version-Id", *output.VersionId)
+	}
+
+	for k, v := range output.Metadata {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+
+	status := http.StatusOK
+	if output.ContentRange != nil {
+		h.Set("Content-Range", *output.ContentRange)
+		status = http.StatusPartialContent
+	}
+
+	w.WriteHeader(status)
+
+	if r.Method != http.MethodHead {
+		io.Copy(w, output.Body)
+	}
+
+	return nil
+}
@@ -0,0 +1,324 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package localaws
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/iampolicy"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/snsfake"
+)
+
+const snsNamespace = "http://sns.amazonaws.com/doc/2010-03-31/"
+
+func (s *Server) snsActions(action string) queryAction {
+	switch action {
+	case "CreateTopic":
+		return s.snsCreateTopic
+	case "DeleteTopic":
+		return s.snsDeleteTopic
+	case "ListTopics":
+		return s.snsListTopics
+	case "GetTopicAttributes":
+		return s.snsGetTopicAttributes
+	case "SetTopicAttributes":
+		return s.snsSetTopicAttributes
+	case "Subscribe":
+		return s.snsSubscribe
+	case "Unsubscribe":
+		return s.snsUnsubscribe
+	case "GetSubscriptionAttributes":
+		return s.snsGetSubscriptionAttributes
+	case "SetSubscriptionAttributes":
+		return s.snsSetSubscriptionAttributes
+	case "ListSubscriptions":
+		return s.snsListSubscriptions
+	case "ListSubscriptionsByTopic":
+		return s.snsListSubscriptionsByTopic
+	case "Publish":
+		return s.snsPublish
+	}
+
+	return nil
+}
+
+// writeAttributes writes a wrapped map of strings, in key order.
+func writeAttributes(b *xmlBuilder, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	b.open("Attributes")
+	for _, k := range keys {
+		b.open("entry")
+		b.elem("key", k)
+		b.elem("value", m[k])
+		b.close("entry")
+	}
+	b.close("Attributes")
+}
+
+func writeSubscriptions(b *xmlBuilder, subscriptions []types.Subscription, next *string) {
+	b.open("Subscriptions")
+	for _, sub := range subscriptions {
+		b.open("member")
+		b.elemPtr("SubscriptionArn", sub.SubscriptionArn)
+		b.elemPtr("Owner", sub.Owner)
+		b.elemPtr("Protocol", sub.Protocol)
+		b.elemPtr("Endpoint", sub.Endpoint)
+		b.elemPtr("TopicArn", sub.TopicArn)
+		b.close("member")
+	}
+	b.close("Subscriptions")
+	b.elemPtr("NextToken", next)
+}
+
+func (s *Server) snsCreateTopic(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SNS.CreateTopic(ctx, &sns.CreateTopicInput{
+		Name:       formString(form, "Name"),
+		Attributes: formMap(form, "Attributes", "key", "value"),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.elemPtr("TopicArn", output.TopicArn)
+
+	return nil
+}
+
+func (s *Server) snsDeleteTopic(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SNS.DeleteTopic(ctx, &sns.DeleteTopicInput{
+		TopicArn: formString(form, "TopicArn"),
+	})
+
+	return err
+}
+
+func (s *Server) snsListTopics(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SNS.ListTopics(ctx, &sns.ListTopicsInput{
+		NextToken: formString(form, "NextToken"),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.open("Topics")
+	for _, t := range output.Topics {
+		b.open("member")
+		b.elemPtr("TopicArn", t.TopicArn)
+		b.close("member")
+	}
+	b.close("Topics")
+	b.elemPtr("NextToken", output.NextToken)
+
+	return nil
+}
+
+func (s *Server) snsGetTopicAttributes(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SNS.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{
+		TopicArn: formString(form, "TopicArn"),
+	})
+	if err != nil {
+		return err
+	}
+
+	writeAttributes(b, output.Attributes)
+
+	return nil
+}
+
+func (s *Server) snsSetTopicAttributes(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SNS.SetTopicAttributes(ctx, &sns.SetTopicAttributesInput{
+		TopicArn:       formString(form, "TopicArn"),
+		AttributeName:  formString(form, "AttributeName"),
+		AttributeValue: formString(form, "AttributeValue"),
+	})
+
+	return err
+}
+
+func (s *Server) snsSubscribe(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SNS.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:              formString(form, "TopicArn"),
+		Protocol:              formString(form, "Protocol"),
+		Endpoint:              formString(form, "Endpoint"),
+		Attributes:            formMap(form, "Attributes", "key", "value"),
+		ReturnSubscriptionArn: formBool(form, "ReturnSubscriptionArn"),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.elemPtr("SubscriptionArn", output.SubscriptionArn)
+
+	return nil
+}
+
+func (s *Server) snsUnsubscribe(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SNS.Unsubscribe(ctx, &sns.UnsubscribeInput{
+		SubscriptionArn: formString(form, "SubscriptionArn"),
+	})
+
+	return err
+}
+
+func (s *Server) snsGetSubscriptionAttributes(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SNS.GetSubscriptionAttributes(ctx, &sns.GetSubscriptionAttributesInput{
+		SubscriptionArn: formString(form, "SubscriptionArn"),
+	})
+	if err != nil {
+		return err
+	}
+
+	writeAttributes(b, output.Attributes)
+
+	return nil
+}
+
+func (s *Server) snsSetSubscriptionAttributes(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SNS.SetSubscriptionAttributes(ctx, &sns.SetSubscriptionAttributesInput{
+		SubscriptionArn: formString(form, "SubscriptionArn"),
+		AttributeName:   formString(form, "AttributeName"),
+		AttributeValue:  formString(form, "AttributeValue"),
+	})
+
+	return err
+}
+
+func (s *Server) snsListSubscriptions(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SNS.ListSubscriptions(ctx, &sns.ListSubscriptionsInput{
+		NextToken: formString(form, "NextToken"),
+	})
+	if err != nil {
+		return err
+	}
+
+	writeSubscriptions(b, output.Subscriptions, output.NextToken)
+
+	return nil
+}
+
+func (s *Server) snsListSubscriptionsByTopic(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SNS.ListSubscriptionsByTopic(ctx, &sns.ListSubscriptionsByTopicInput{
+		TopicArn:  formString(form, "TopicArn"),
+		NextToken: formString(form, "NextToken"),
+	})
+	if err != nil {
+		return err
+	}
+
+	writeSubscriptions(b, output.Subscriptions, output.NextToken)
+
+	return nil
+}
+
+func (s *Server) snsPublish(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	var attributes map[string]types.MessageAttributeValue
+	if list := entries(form, "MessageAttributes"); list != nil {
+		attributes = map[string]types.MessageAttributeValue{}
+		for _, p := range list {
+			attributes[form.Get(p+".Name")] = types.MessageAttributeValue{
+				DataType:    formString(form, p+".Value.DataType"),
+				StringValue: formString(form, p+".Value.StringValue"),
+				BinaryValue: formBlob(form, p+".Value.BinaryValue"),
+			}
+		}
+	}
+
+	output, err := s.SNS.Publish(ctx, &sns.PublishInput{
+		TopicArn:               formString(form, "TopicArn"),
+		TargetArn:              formString(form, "TargetArn"),
+		PhoneNumber:            formString(form, "PhoneNumber"),
+		Subject:                formString(form, "Subject"),
+		Message:                formString(form, "Message"),
+		MessageStructure:       formString(form, "MessageStructure"),
+		MessageAttributes:      attributes,
+		MessageGroupId:         formString(form, "MessageGroupId"),
+		MessageDeduplicationId: formString(form, "MessageDeduplicationId"),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.elemPtr("MessageId", output.MessageId)
+	b.elemPtr("SequenceNumber", output.SequenceNumber)
+
+	return nil
+}
+
+// deliverSNS sends a message published to a topic on to a subscribed Amazon SQS queue.
+// Like Amazon SNS, it drops the message if the queue's policy doesn't let the topic send messages to the queue.
+func (s *Server) deliverSNS(d snsfake.Delivery) {
+	if d.Protocol != "sqs" {
+		return
+	}
+
+	name := d.Endpoint[strings.LastIndex(d.Endpoint, ":")+1:]
+	if s.SQS.QueueARN(name) != d.Endpoint {
+		return
+	}
+
+	queueURL := s.SQS.QueueURL(name)
+	ctx := context.Background()
+
+	attributes, err := s.SQS.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       &queueURL,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy},
+	})
+	if err != nil {
+		return
+	}
+
+	policy, err := iampolicy.Parse([]byte(attributes.Attributes["Policy"]))
+	if err != nil {
+		return
+	}
+
+	result := policy.Evaluate(iampolicy.Request{
+		Principal: iampolicy.Principal{Type: "Service", ID: "sns.amazonaws.com"},
+		Action:    "sqs:SendMessage",
+		Resource:  d.Endpoint,
+		Context:   map[string][]string{"aws:SourceArn": {d.TopicArn}},
+	})
+	if result.Decision != iampolicy.Allowed {
+		return
+	}
+
+	var messageAttributes map[string]sqstypes.MessageAttributeValue
+	for name, v := range d.MessageAttributes {
+		if messageAttributes == nil {
+			messageAttributes = map[string]sqstypes.MessageAttributeValue{}
+		}
+
+		messageAttributes[name] = sqstypes.MessageAttributeValue{
+			DataType:    v.DataType,
+			StringValue: v.StringValue,
+			BinaryValue: v.BinaryValue,
+		}
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          &queueURL,
+		MessageBody:       &d.Message,
+		MessageAttributes: messageAttributes,
+	}
+
+	if strings.HasSuffix(name, ".fifo") {
+		input.MessageGroupId = &d.MessageGroupID
+		input.MessageDeduplicationId = &d.DeduplicationID
+	}
+
+	s.SQS.SendMessage(ctx, input)
+}
@@ -0,0 +1,398 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package localaws
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const sqsNamespace = "http://queue.amazonaws.com/doc/2012-11-05/"
+
+func (s *Server) sqsActions(action string) queryAction {
+	switch action {
+	case "CreateQueue":
+		return s.sqsCreateQueue
+	case "GetQueueUrl":
+		return s.sqsGetQueueURL
+	case "ListQueues":
+		return s.sqsListQueues
+	case "ListDeadLetterSourceQueues":
+		return s.sqsListDeadLetterSourceQueues
+	case "DeleteQueue":
+		return s.sqsDeleteQueue
+	case "PurgeQueue":
+		return s.sqsPurgeQueue
+	case "GetQueueAttributes":
+		return s.sqsGetQueueAttributes
+	case "SetQueueAttributes":
+		return s.sqsSetQueueAttributes
+	case "SendMessage":
+		return s.sqsSendMessage
+	case "ReceiveMessage":
+		return s.sqsReceiveMessage
+	case "DeleteMessage":
+		return s.sqsDeleteMessage
+	case "ChangeMessageVisibility":
+		return s.sqsChangeMessageVisibility
+	case "SendMessageBatch":
+		return s.sqsSendMessageBatch
+	case "DeleteMessageBatch":
+		return s.sqsDeleteMessageBatch
+	case "ChangeMessageVisibilityBatch":
+		return s.sqsChangeMessageVisibilityBatch
+	}
+
+	return nil
+}
+
+// sqsMessageAttributes decodes the MessageAttribute.N.Name and MessageAttribute.N.Value.* parameters.
+func sqsMessageAttributes(form url.Values, prefix string) map[string]types.MessageAttributeValue {
+	list := entries(form, prefix)
+	if list == nil {
+		return nil
+	}
+
+	attributes := map[string]types.MessageAttributeValue{}
+	for _, p := range list {
+		attributes[form.Get(p+".Name")] = types.MessageAttributeValue{
+			DataType:    formString(form, p+".Value.DataType"),
+			StringValue: formString(form, p+".Value.StringValue"),
+			BinaryValue: formBlob(form, p+".Value.BinaryValue"),
+		}
+	}
+
+	return attributes
+}
+
+// writeNameValues writes a flattened map of strings, in key order.
+func writeNameValues(b *xmlBuilder, element string, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b.open(element)
+		b.elem("Name", k)
+		b.elem("Value", m[k])
+		b.close(element)
+	}
+}
+
+func (s *Server) sqsCreateQueue(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SQS.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName:  formString(form, "QueueName"),
+		Attributes: formMap(form, "Attribute", "Name", "Value"),
+		Tags:       formMap(form, "Tag", "Key", "Value"),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.elemPtr("QueueUrl", output.QueueUrl)
+
+	return nil
+}
+
+func (s *Server) sqsGetQueueURL(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SQS.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: formString(form, "QueueName"),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.elemPtr("QueueUrl", output.QueueUrl)
+
+	return nil
+}
+
+func (s *Server) sqsListQueues(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SQS.ListQueues(ctx, &sqs.ListQueuesInput{
+		QueueNamePrefix: formString(form, "QueueNamePrefix"),
+		MaxResults:      formInt32Ptr(form, "MaxResults"),
+		NextToken:       formString(form, "NextToken"),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, u := range output.QueueUrls {
+		b.elem("QueueUrl", u)
+	}
+
+	b.elemPtr("NextToken", output.NextToken)
+
+	return nil
+}
+
+func (s *Server) sqsListDeadLetterSourceQueues(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SQS.ListDeadLetterSourceQueues(ctx, &sqs.ListDeadLetterSourceQueuesInput{
+		QueueUrl:   formString(form, "QueueUrl"),
+		MaxResults: formInt32Ptr(form, "MaxResults"),
+		NextToken:  formString(form, "NextToken"),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, u := range output.QueueUrls {
+		b.elem("QueueUrl", u)
+	}
+
+	b.elemPtr("NextToken", output.NextToken)
+
+	return nil
+}
+
+func (s *Server) sqsDeleteQueue(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SQS.DeleteQueue(ctx, &sqs.DeleteQueueInput{
+		QueueUrl: formString(form, "QueueUrl"),
+	})
+
+	return err
+}
+
+func (s *Server) sqsPurgeQueue(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SQS.PurgeQueue(ctx, &sqs.PurgeQueueInput{
+		QueueUrl: formString(form, "QueueUrl"),
+	})
+
+	return err
+}
+
+func (s *Server) sqsGetQueueAttributes(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	var names []types.QueueAttributeName
+	for _, name := range formList(form, "AttributeName") {
+		names = append(names, types.QueueAttributeName(name))
+	}
+
+	output, err := s.SQS.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       formString(form, "QueueUrl"),
+		AttributeNames: names,
+	})
+	if err != nil {
+		return err
+	}
+
+	writeNameValues(b, "Attribute", output.Attributes)
+
+	return nil
+}
+
+func (s *Server) sqsSetQueueAttributes(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SQS.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   formString(form, "QueueUrl"),
+		Attributes: formMap(form, "Attribute", "Name", "Value"),
+	})
+
+	return err
+}
+
+func (s *Server) sqsSendMessage(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output, err := s.SQS.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               formString(form, "QueueUrl"),
+		MessageBody:            formString(form, "MessageBody"),
+		DelaySeconds:           formInt32(form, "DelaySeconds"),
+		MessageAttributes:      sqsMessageAttributes(form, "MessageAttribute"),
+		MessageDeduplicationId: formString(form, "MessageDeduplicationId"),
+		MessageGroupId:         formString(form, "MessageGroupId"),
+	})
+	if err != nil {
+		return err
+	}
+
+	b.elemPtr("MessageId", output.MessageId)
+	b.elemPtr("MD5OfMessageBody", output.MD5OfMessageBody)
+	b.elemPtr("MD5OfMessageAttributes", output.MD5OfMessageAttributes)
+	b.elemPtr("SequenceNumber", output.SequenceNumber)
+
+	return nil
+}
+
+func (s *Server) sqsReceiveMessage(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	var names []types.QueueAttributeName
+	for _, name := range formList(form, "AttributeName") {
+		names = append(names, types.QueueAttributeName(name))
+	}
+
+	output, err := s.SQS.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              formString(form, "QueueUrl"),
+		AttributeNames:        names,
+		MessageAttributeNames: formList(form, "MessageAttributeName"),
+		MaxNumberOfMessages:   formInt32(form, "MaxNumberOfMessages"),
+		VisibilityTimeout:     formInt32(form, "VisibilityTimeout"),
+		WaitTimeSeconds:       formInt32(form, "WaitTimeSeconds"),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range output.Messages {
+		b.open("Message")
+		b.elemPtr("MessageId", m.MessageId)
+		b.elemPtr("ReceiptHandle", m.ReceiptHandle)
+		b.elemPtr("MD5OfBody", m.MD5OfBody)
+		b.elemPtr("Body", m.Body)
+		b.elemPtr("MD5OfMessageAttributes", m.MD5OfMessageAttributes)
+		writeNameValues(b, "Attribute", m.Attributes)
+
+		names := make([]string, 0, len(m.MessageAttributes))
+		for name := range m.MessageAttributes {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			v := m.MessageAttributes[name]
+			b.open("MessageAttribute")
+			b.elem("Name", name)
+			b.open("Value")
+			b.elemPtr("StringValue", v.StringValue)
+			if v.BinaryValue != nil {
+				b.elem("BinaryValue", base64.StdEncoding.EncodeToString(v.BinaryValue))
+			}
+			b.elemPtr("DataType", v.DataType)
+			b.close("Value")
+			b.close("MessageAttribute")
+		}
+
+		b.close("Message")
+	}
+
+	return nil
+}
+
+func (s *Server) sqsDeleteMessage(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SQS.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      formString(form, "QueueUrl"),
+		ReceiptHandle: formString(form, "ReceiptHandle"),
+	})
+
+	return err
+}
+
+func (s *Server) sqsChangeMessageVisibility(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	_, err := s.SQS.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          formString(form, "QueueUrl"),
+		ReceiptHandle:     formString(form, "ReceiptHandle"),
+		VisibilityTimeout: formInt32(form, "VisibilityTimeout"),
+	})
+
+	return err
+}
+
+// writeBatchErrors writes the failed entries of a batch action.
+func writeBatchErrors(b *xmlBuilder, failed []types.BatchResultErrorEntry) {
+	for _, f := range failed {
+		b.open("BatchResultErrorEntry")
+		b.elemPtr("Id", f.Id)
+		b.elem("SenderFault", strconv.FormatBool(f.SenderFault))
+		b.elemPtr("Code", f.Code)
+		b.elemPtr("Message", f.Message)
+		b.close("BatchResultErrorEntry")
+	}
+}
+
+func (s *Server) sqsSendMessageBatch(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	var list []types.SendMessageBatchRequestEntry
+	for _, p := range entries(form, "SendMessageBatchRequestEntry") {
+		list = append(list, types.SendMessageBatchRequestEntry{
+			Id:                     formString(form, p+".Id"),
+			MessageBody:            formString(form, p+".MessageBody"),
+			DelaySeconds:           formInt32(form, p+".DelaySeconds"),
+			MessageAttributes:      sqsMessageAttributes(form, p+".MessageAttribute"),
+			MessageDeduplicationId: formString(form, p+".MessageDeduplicationId"),
+			MessageGroupId:         formString(form, p+".MessageGroupId"),
+		})
+	}
+
+	output, err := s.SQS.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: formString(form, "QueueUrl"),
+		Entries:  list,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range output.Successful {
+		b.open("SendMessageBatchResultEntry")
+		b.elemPtr("Id", e.Id)
+		b.elemPtr("MessageId", e.MessageId)
+		b.elemPtr("MD5OfMessageBody", e.MD5OfMessageBody)
+		b.elemPtr("MD5OfMessageAttributes", e.MD5OfMessageAttributes)
+		b.elemPtr("SequenceNumber", e.SequenceNumber)
+		b.close("SendMessageBatchResultEntry")
+	}
+
+	writeBatchErrors(b, output.Failed)
+
+	return nil
+}
+
+func (s *Server) sqsDeleteMessageBatch(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	var list []types.DeleteMessageBatchRequestEntry
+	for _, p := range entries(form, "DeleteMessageBatchRequestEntry") {
+		list = append(list, types.DeleteMessageBatchRequestEntry{
+			Id:            formString(form, p+".Id"),
+			ReceiptHandle: formString(form, p+".ReceiptHandle"),
+		})
+	}
+
+	output, err := s.SQS.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: formString(form, "QueueUrl"),
+		Entries:  list,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range output.Successful {
+		b.open("DeleteMessageBatchResultEntry")
+		b.elemPtr("Id", e.Id)
+		b.close("DeleteMessageBatchResultEntry")
+	}
+
+	writeBatchErrors(b, output.Failed)
+
+	return nil
+}
+
+func (s *Server) sqsChangeMessageVisibilityBatch(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	var list []types.ChangeMessageVisibilityBatchRequestEntry
+	for _, p := range entries(form, "ChangeMessageVisibilityBatchRequestEntry") {
+		list = append(list, types.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                formString(form, p+".Id"),
+			ReceiptHandle:     formString(form, p+".ReceiptHandle"),
+			VisibilityTimeout: formInt32(form, p+".VisibilityTimeout"),
+		})
+	}
+
+	output, err := s.SQS.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: formString(form, "QueueUrl"),
+		Entries:  list,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range output.Successful {
+		b.open("ChangeMessageVisibilityBatchResultEntry")
+		b.elemPtr("Id", e.Id)
+		b.close("ChangeMessageVisibilityBatchResultEntry")
+	}
+
+	writeBatchErrors(b, output.Failed)
+
+	return nil
+}
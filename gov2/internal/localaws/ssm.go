@@ -0,0 +1,210 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package localaws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+)
+
+// ssmAction handles one Systems Manager action.
+// It decodes its input from body and returns the value to encode as the JSON response.
+type ssmAction func(ctx context.Context, body []byte) (interface{}, error)
+
+func (s *Server) ssmActions(action string) ssmAction {
+	switch action {
+	case "GetParameter":
+		return s.ssmGetParameter
+	case "GetParameters":
+		return s.ssmGetParameters
+	case "GetParametersByPath":
+		return s.ssmGetParametersByPath
+	case "PutParameter":
+		return s.ssmPutParameter
+	case "DeleteParameter":
+		return s.ssmDeleteParameter
+	}
+
+	return nil
+}
+
+// serveSSM handles a JSON 1.1 protocol request: a POST whose X-Amz-Target header names the action,
+// answered by a JSON document or a JSON error with a __type.
+func (s *Server) serveSSM(w http.ResponseWriter, r *http.Request, rc *requestContext) {
+	target := r.Header.Get("X-Amz-Target")
+	action := s.ssmActions(strings.TrimPrefix(target, "AmazonSSM."))
+	if action == nil {
+		writeJSONError(w, "UnknownOperationException", "Unknown operation "+target, http.StatusBadRequest)
+		return
+	}
+
+	var body json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSONError(w, "SerializationException", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	output, err := action(r.Context(), body)
+	if err != nil {
+		code, message, status := apiError(err)
+		writeJSONError(w, code, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(output)
+}
+
+func writeJSONError(w http.ResponseWriter, code, message string, status int) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", code)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  code,
+		"message": message,
+	})
+}
+
+// decodeJSON decodes the input of an action, reporting a malformed body as a client error.
+func decodeJSON(body []byte, input interface{}) error {
+	err := json.Unmarshal(body, input)
+	if err != nil {
+		return &smithy.GenericAPIError{Code: "SerializationException", Message: err.Error(), Fault: smithy.FaultClient}
+	}
+
+	return nil
+}
+
+// ssmParameter returns the JSON form of a parameter. Timestamps are seconds since the epoch.
+func ssmParameter(p types.Parameter) map[string]interface{} {
+	m := map[string]interface{}{
+		"Name":     aws.ToString(p.Name),
+		"Type":     p.Type,
+		"Value":    aws.ToString(p.Value),
+		"Version":  p.Version,
+		"ARN":      aws.ToString(p.ARN),
+		"DataType": aws.ToString(p.DataType),
+	}
+
+	if p.Selector != nil {
+		m["Selector"] = *p.Selector
+	}
+
+	if p.LastModifiedDate != nil {
+		m["LastModifiedDate"] = float64(p.LastModifiedDate.UnixNano()) / 1e9
+	}
+
+	return m
+}
+
+func (s *Server) ssmGetParameter(ctx context.Context, body []byte) (interface{}, error) {
+	var input ssm.GetParameterInput
+	err := decodeJSON(body, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.SSM.GetParameter(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"Parameter": ssmParameter(*output.Parameter),
+	}, nil
+}
+
+func (s *Server) ssmGetParameters(ctx context.Context, body []byte) (interface{}, error) {
+	var input ssm.GetParametersInput
+	err := decodeJSON(body, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.SSM.GetParameters(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := []map[string]interface{}{}
+	for _, p := range output.Parameters {
+		parameters = append(parameters, ssmParameter(p))
+	}
+
+	invalid := []string{}
+	invalid = append(invalid, output.InvalidParameters...)
+
+	return map[string]interface{}{
+		"Parameters":        parameters,
+		"InvalidParameters": invalid,
+	}, nil
+}
+
+func (s *Server) ssmGetParametersByPath(ctx context.Context, body []byte) (interface{}, error) {
+	var input ssm.GetParametersByPathInput
+	err := decodeJSON(body, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.SSM.GetParametersByPath(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := []map[string]interface{}{}
+	for _, p := range output.Parameters {
+		parameters = append(parameters, ssmParameter(p))
+	}
+
+	result := map[string]interface{}{
+		"Parameters": parameters,
+	}
+
+	if output.NextToken != nil {
+		result["NextToken"] = *output.NextToken
+	}
+
+	return result, nil
+}
+
+func (s *Server) ssmPutParameter(ctx context.Context, body []byte) (interface{}, error) {
+	var input ssm.PutParameterInput
+	err := decodeJSON(body, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.SSM.PutParameter(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"Version": output.Version,
+		"Tier":    output.Tier,
+	}, nil
+}
+
+func (s *Server) ssmDeleteParameter(ctx context.Context, body []byte) (interface{}, error) {
+	var input ssm.DeleteParameterInput
+	err := decodeJSON(body, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.SSM.DeleteParameter(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{}, nil
+}
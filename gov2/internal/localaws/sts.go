@@ -0,0 +1,80 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package localaws
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+const stsNamespace = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+func (s *Server) stsActions(action string) queryAction {
+	switch action {
+	case "AssumeRole":
+		return s.stsAssumeRole
+	case "GetCallerIdentity":
+		return s.stsGetCallerIdentity
+	}
+
+	return nil
+}
+
+func (s *Server) stsAssumeRole(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	input := &sts.AssumeRoleInput{
+		RoleArn:           formString(form, "RoleArn"),
+		RoleSessionName:   formString(form, "RoleSessionName"),
+		DurationSeconds:   formInt32Ptr(form, "DurationSeconds"),
+		ExternalId:        formString(form, "ExternalId"),
+		Policy:            formString(form, "Policy"),
+		SerialNumber:      formString(form, "SerialNumber"),
+		TokenCode:         formString(form, "TokenCode"),
+		TransitiveTagKeys: formList(form, "TransitiveTagKeys"),
+	}
+
+	for _, p := range entries(form, "Tags") {
+		input.Tags = append(input.Tags, types.Tag{
+			Key:   formString(form, p+".Key"),
+			Value: formString(form, p+".Value"),
+		})
+	}
+
+	output, err := s.STS.AssumeRoleFrom(ctx, rc.accessKeyID, input)
+	if err != nil {
+		return err
+	}
+
+	b.open("Credentials")
+	b.elemPtr("AccessKeyId", output.Credentials.AccessKeyId)
+	b.elemPtr("SecretAccessKey", output.Credentials.SecretAccessKey)
+	b.elemPtr("SessionToken", output.Credentials.SessionToken)
+	b.elem("Expiration", aws.ToTime(output.Credentials.Expiration).UTC().Format(time.RFC3339))
+	b.close("Credentials")
+
+	b.open("AssumedRoleUser")
+	b.elemPtr("Arn", output.AssumedRoleUser.Arn)
+	b.elemPtr("AssumedRoleId", output.AssumedRoleUser.AssumedRoleId)
+	b.close("AssumedRoleUser")
+
+	if output.PackedPolicySize != nil {
+		b.elem("PackedPolicySize", strconv.Itoa(int(*output.PackedPolicySize)))
+	}
+
+	return nil
+}
+
+func (s *Server) stsGetCallerIdentity(ctx context.Context, rc *requestContext, form url.Values, b *xmlBuilder) error {
+	output := s.STS.CallerIdentity(rc.accessKeyID)
+
+	b.elemPtr("Arn", output.Arn)
+	b.elemPtr("UserId", output.UserId)
+	b.elemPtr("Account", output.Account)
+
+	return nil
+}
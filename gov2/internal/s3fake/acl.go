@@ -0,0 +1,95 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package s3fake
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// The URIs of the predefined Amazon S3 grantee groups.
+const (
+	AllUsersURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	AuthenticatedUsersURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// owner returns a copy of the service owner.
+func (s *Service) owner() *types.Owner {
+	o := s.Owner
+	return &o
+}
+
+func (s *Service) ownerGrant() types.Grant {
+	return types.Grant{
+		Grantee: &types.Grantee{
+			Type:        types.TypeCanonicaluser,
+			ID:          s.Owner.ID,
+			DisplayName: s.Owner.DisplayName,
+		},
+		Permission: types.PermissionFullControl,
+	}
+}
+
+func groupGrant(uri string, permission types.Permission) types.Grant {
+	return types.Grant{
+		Grantee: &types.Grantee{
+			Type: types.TypeGroup,
+			URI:  aws.String(uri),
+		},
+		Permission: permission,
+	}
+}
+
+// cannedGrants returns the grants for a canned ACL, such as public-read.
+// Because every bucket has the same owner, bucket-owner-read and bucket-owner-full-control
+// are the same as private.
+func (s *Service) cannedGrants(acl string) ([]types.Grant, error) {
+	grants := []types.Grant{s.ownerGrant()}
+
+	switch acl {
+	case "private", "bucket-owner-read", "bucket-owner-full-control", "aws-exec-read":
+	case "public-read":
+		grants = append(grants, groupGrant(AllUsersURI, types.PermissionRead))
+	case "public-read-write":
+		grants = append(grants,
+			groupGrant(AllUsersURI, types.PermissionRead),
+			groupGrant(AllUsersURI, types.PermissionWrite))
+	case "authenticated-read":
+		grants = append(grants, groupGrant(AuthenticatedUsersURI, types.PermissionRead))
+	default:
+		return nil, apiError("InvalidArgument", "Unknown canned ACL: "+acl)
+	}
+
+	return grants, nil
+}
+
+// aclGrants returns the grants set by a PutBucketAcl or PutObjectAcl call,
+// which must supply either a canned ACL or an access control policy.
+func (s *Service) aclGrants(acl string, policy *types.AccessControlPolicy) ([]types.Grant, error) {
+	if acl != "" && policy != nil {
+		return nil, apiError("UnexpectedContent", "Specify either a canned ACL or an access control policy, not both")
+	}
+
+	if policy != nil {
+		return copyGrants(policy.Grants), nil
+	}
+
+	if acl == "" {
+		return nil, apiError("MissingSecurityHeader", "Your request was missing a required header")
+	}
+
+	return s.cannedGrants(acl)
+}
+
+func copyGrants(grants []types.Grant) []types.Grant {
+	c := make([]types.Grant, len(grants))
+	for i, g := range grants {
+		c[i] = g
+		if g.Grantee != nil {
+			grantee := *g.Grantee
+			c[i].Grantee = &grantee
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,199 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package s3fake
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// CreateBucket creates an empty bucket.
+// It fails with *types.BucketAlreadyOwnedByYou if the bucket exists.
+func (s *Service) CreateBucket(ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.Bucket)
+	if len(name) < 3 || len(name) > 63 {
+		return nil, apiError("InvalidBucketName", "The specified bucket is not valid: "+name)
+	}
+
+	if _, ok := s.buckets[name]; ok {
+		return nil, &types.BucketAlreadyOwnedByYou{}
+	}
+
+	acl := string(params.ACL)
+	if acl == "" {
+		acl = string(types.BucketCannedACLPrivate)
+	}
+
+	grants, err := s.cannedGrants(acl)
+	if err != nil {
+		return nil, err
+	}
+
+	s.buckets[name] = &bucket{
+		name:    name,
+		created: s.Now(),
+		grants:  grants,
+		objects: map[string][]*version{},
+	}
+
+	return &s3.CreateBucketOutput{
+		Location: aws.String("/" + name),
+	}, nil
+}
+
+// DeleteBucket deletes a bucket.
+// Like Amazon S3, it fails with BucketNotEmpty while the bucket holds any object version or delete marker.
+func (s *Service) DeleteBucket(ctx context.Context,
+	params *s3.DeleteBucketInput,
+	optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, versions := range b.objects {
+		if len(versions) > 0 {
+			return nil, apiError("BucketNotEmpty", "The bucket you tried to delete is not empty")
+		}
+	}
+
+	delete(s.buckets, b.name)
+
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+// HeadBucket succeeds if the bucket exists.
+func (s *Service) HeadBucket(ctx context.Context,
+	params *s3.HeadBucketInput,
+	optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// ListBuckets lists every bucket, in name order.
+func (s *Service) ListBuckets(ctx context.Context,
+	params *s3.ListBucketsInput,
+	optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output := &s3.ListBucketsOutput{
+		Owner: s.owner(),
+	}
+
+	for _, b := range s.buckets {
+		output.Buckets = append(output.Buckets, types.Bucket{
+			Name:         aws.String(b.name),
+			CreationDate: aws.Time(b.created),
+		})
+	}
+
+	sort.Slice(output.Buckets, func(i, j int) bool {
+		return *output.Buckets[i].Name < *output.Buckets[j].Name
+	})
+
+	return output, nil
+}
+
+// GetBucketAcl returns the grants on a bucket.
+func (s *Service) GetBucketAcl(ctx context.Context,
+	params *s3.GetBucketAclInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketAclOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.GetBucketAclOutput{
+		Owner:  s.owner(),
+		Grants: copyGrants(b.grants),
+	}, nil
+}
+
+// PutBucketAcl replaces the grants on a bucket with a canned ACL or an AccessControlPolicy.
+func (s *Service) PutBucketAcl(ctx context.Context,
+	params *s3.PutBucketAclInput,
+	optFns ...func(*s3.Options)) (*s3.PutBucketAclOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := s.aclGrants(string(params.ACL), params.AccessControlPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	b.grants = grants
+
+	return &s3.PutBucketAclOutput{}, nil
+}
+
+// GetBucketVersioning returns the versioning state of a bucket.
+// The status is empty if versioning has never been enabled.
+func (s *Service) GetBucketVersioning(ctx context.Context,
+	params *s3.GetBucketVersioningInput,
+	optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.GetBucketVersioningOutput{
+		Status: b.versioning,
+	}, nil
+}
+
+// PutBucketVersioning enables or suspends versioning on a bucket.
+func (s *Service) PutBucketVersioning(ctx context.Context,
+	params *s3.PutBucketVersioningInput,
+	optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.VersioningConfiguration == nil {
+		return nil, apiError("MalformedXML", "The versioning configuration is missing")
+	}
+
+	switch status := params.VersioningConfiguration.Status; status {
+	case types.BucketVersioningStatusEnabled, types.BucketVersioningStatusSuspended:
+		b.versioning = status
+	default:
+		return nil, apiError("IllegalVersioningConfigurationException", "Invalid versioning status: "+string(status))
+	}
+
+	return &s3.PutBucketVersioningOutput{}, nil
+}
@@ -0,0 +1,713 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package s3fake
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// PutObject stores the body and metadata of an object.
+// If versioning is enabled on the bucket, it adds a new version.
+func (s *Service) PutObject(ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	var data []byte
+	if params.Body != nil {
+		var err error
+		data, err = ioutil.ReadAll(params.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.ToString(params.Key)
+	if key == "" {
+		return nil, apiError("InvalidArgument", "The key is missing")
+	}
+
+	acl := string(params.ACL)
+	if acl == "" {
+		acl = string(types.ObjectCannedACLPrivate)
+	}
+
+	grants, err := s.cannedGrants(acl)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &version{
+		data:         data,
+		etag:         etag(data),
+		lastModified: s.Now(),
+		metadata:     copyMetadata(params.Metadata),
+		contentType:  params.ContentType,
+		encoding:     params.ContentEncoding,
+		grants:       grants,
+	}
+
+	s.store(b, key, v)
+
+	return &s3.PutObjectOutput{
+		ETag:      aws.String(v.etag),
+		VersionId: versionID(v),
+	}, nil
+}
+
+// GetObject returns the body and metadata of an object.
+// It supports single byte ranges, such as bytes=0-99, bytes=100-, and bytes=-100.
+func (s *Service) GetObject(ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := b.find(params.Key, params.VersionId)
+	if err != nil {
+		return nil, err
+	}
+
+	data := v.data
+
+	output := &s3.GetObjectOutput{
+		AcceptRanges:    aws.String("bytes"),
+		ContentType:     v.contentType,
+		ContentEncoding: v.encoding,
+		ETag:            aws.String(v.etag),
+		LastModified:    aws.Time(v.lastModified),
+		Metadata:        copyMetadata(v.metadata),
+		VersionId:       versionID(v),
+	}
+
+	if params.Range != nil {
+		start, end, err := parseRange(*params.Range, int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+
+		data = data[start : end+1]
+		output.ContentRange = aws.String("bytes " + strconv.FormatInt(start, 10) + "-" +
+			strconv.FormatInt(end, 10) + "/" + strconv.Itoa(len(v.data)))
+	}
+
+	output.Body = ioutil.NopCloser(bytes.NewReader(data))
+	output.ContentLength = int64(len(data))
+
+	return output, nil
+}
+
+// parseRange returns the first and last byte offsets of a single HTTP byte range.
+func parseRange(r string, size int64) (int64, int64, error) {
+	invalid := apiError("InvalidRange", "The requested range is not satisfiable")
+
+	spec := strings.TrimPrefix(r, "bytes=")
+	if spec == r || strings.Contains(spec, ",") {
+		return 0, 0, invalid
+	}
+
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, 0, invalid
+	}
+
+	first, last := spec[:dash], spec[dash+1:]
+
+	var start, end int64
+	var err error
+
+	switch {
+	case first == "":
+		// The last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, invalid
+		}
+
+		if n > size {
+			n = size
+		}
+
+		start, end = size-n, size-1
+	case last == "":
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return 0, 0, invalid
+		}
+
+		end = size - 1
+	default:
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return 0, 0, invalid
+		}
+
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, invalid
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if start < 0 || start >= size {
+		return 0, 0, invalid
+	}
+
+	return start, end, nil
+}
+
+// HeadObject returns the metadata of an object.
+// Like Amazon S3, it fails with a NotFound error, not NoSuchKey, if the object does not exist.
+func (s *Service) HeadObject(ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := b.find(params.Key, params.VersionId)
+	if err != nil {
+		if _, ok := err.(*types.NoSuchKey); ok {
+			return nil, apiError("NotFound", "Not Found")
+		}
+
+		return nil, err
+	}
+
+	return &s3.HeadObjectOutput{
+		AcceptRanges:    aws.String("bytes"),
+		ContentLength:   int64(len(v.data)),
+		ContentType:     v.contentType,
+		ContentEncoding: v.encoding,
+		ETag:            aws.String(v.etag),
+		LastModified:    aws.Time(v.lastModified),
+		Metadata:        copyMetadata(v.metadata),
+		VersionId:       versionID(v),
+	}, nil
+}
+
+// versionID returns the ID to report for v; objects stored without versioning have none.
+func versionID(v *version) *string {
+	if v.id == nullVersion {
+		return nil
+	}
+
+	return aws.String(v.id)
+}
+
+// parseCopySource splits a CopySource value, such as source-bucket/path/to/key?versionId=ID,
+// into its bucket, key, and optional version ID.
+func parseCopySource(source string) (string, string, *string, error) {
+	source = strings.TrimPrefix(source, "/")
+
+	var versionID *string
+	if i := strings.Index(source, "?"); i >= 0 {
+		query, err := url.ParseQuery(source[i+1:])
+		if err != nil {
+			return "", "", nil, apiError("InvalidArgument", "Invalid copy source: "+source)
+		}
+
+		if id := query.Get("versionId"); id != "" {
+			versionID = aws.String(id)
+		}
+
+		source = source[:i]
+	}
+
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		return "", "", nil, apiError("InvalidArgument", "Invalid copy source: "+source)
+	}
+
+	slash := strings.Index(source, "/")
+	if slash <= 0 || slash == len(source)-1 {
+		return "", "", nil, apiError("InvalidArgument", "Copy source must be of the form bucket/key: "+source)
+	}
+
+	return source[:slash], source[slash+1:], versionID, nil
+}
+
+// CopyObject copies an object, which can be in another bucket.
+// Metadata is copied unless MetadataDirective is REPLACE.
+func (s *Service) CopyObject(ctx context.Context,
+	params *s3.CopyObjectInput,
+	optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	srcBucket, srcKey, srcVersion, err := parseCopySource(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := s.lookupBucket(aws.String(srcBucket))
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.ToString(params.Key)
+	if key == "" {
+		return nil, apiError("InvalidArgument", "The key is missing")
+	}
+
+	v, err := src.find(aws.String(srcKey), srcVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	acl := string(params.ACL)
+	if acl == "" {
+		acl = string(types.ObjectCannedACLPrivate)
+	}
+
+	grants, err := s.cannedGrants(acl)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &version{
+		data:         v.data,
+		etag:         v.etag,
+		lastModified: s.Now(),
+		metadata:     copyMetadata(v.metadata),
+		contentType:  v.contentType,
+		encoding:     v.encoding,
+		grants:       grants,
+	}
+
+	if params.MetadataDirective == types.MetadataDirectiveReplace {
+		c.metadata = copyMetadata(params.Metadata)
+		c.contentType = params.ContentType
+		c.encoding = params.ContentEncoding
+	} else if srcBucket == dst.name && srcKey == key && srcVersion == nil {
+		return nil, apiError("InvalidRequest", "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata")
+	}
+
+	s.store(dst, key, c)
+
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{
+			ETag:         aws.String(c.etag),
+			LastModified: aws.Time(c.lastModified),
+		},
+		CopySourceVersionId: versionID(v),
+		VersionId:           versionID(c),
+	}, nil
+}
+
+// deleteObject deletes an object or one of its versions. The caller must hold s.mu.
+// It returns whether the deleted or created version is a delete marker, and that version's ID.
+func (s *Service) deleteObject(b *bucket, key string, id *string) (bool, *string) {
+	versions := b.objects[key]
+
+	if id != nil {
+		// Permanently delete one version
+		for i, v := range versions {
+			if v.id == *id {
+				versions = append(versions[:i:i], versions[i+1:]...)
+				if len(versions) == 0 {
+					delete(b.objects, key)
+				} else {
+					b.objects[key] = versions
+				}
+
+				return v.deleteMarker, id
+			}
+		}
+
+		return false, id
+	}
+
+	if b.versioning == "" {
+		delete(b.objects, key)
+		return false, nil
+	}
+
+	marker := &version{
+		deleteMarker: true,
+		lastModified: s.Now(),
+	}
+
+	s.store(b, key, marker)
+
+	return true, aws.String(marker.id)
+}
+
+// DeleteObject deletes an object.
+// In a versioned bucket it adds a delete marker, unless VersionId names a version to delete permanently.
+// Like Amazon S3, it succeeds if the object does not exist.
+func (s *Service) DeleteObject(ctx context.Context,
+	params *s3.DeleteObjectInput,
+	optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.ToString(params.Key)
+	if key == "" {
+		return nil, apiError("InvalidArgument", "The key is missing")
+	}
+
+	deleteMarker, id := s.deleteObject(b, key, params.VersionId)
+
+	return &s3.DeleteObjectOutput{
+		DeleteMarker: deleteMarker,
+		VersionId:    id,
+	}, nil
+}
+
+// DeleteObjects deletes up to 1,000 objects or versions.
+func (s *Service) DeleteObjects(ctx context.Context,
+	params *s3.DeleteObjectsInput,
+	optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Delete == nil || len(params.Delete.Objects) == 0 || len(params.Delete.Objects) > 1000 {
+		return nil, apiError("MalformedXML", "The request must list between 1 and 1,000 objects")
+	}
+
+	output := &s3.DeleteObjectsOutput{}
+
+	for _, obj := range params.Delete.Objects {
+		key := aws.ToString(obj.Key)
+		if key == "" {
+			output.Errors = append(output.Errors, types.Error{
+				Code:    aws.String("InvalidArgument"),
+				Message: aws.String("The key is missing"),
+			})
+			continue
+		}
+
+		deleteMarker, id := s.deleteObject(b, key, obj.VersionId)
+		if params.Delete.Quiet {
+			continue
+		}
+
+		deleted := types.DeletedObject{
+			Key:          aws.String(key),
+			VersionId:    obj.VersionId,
+			DeleteMarker: deleteMarker,
+		}
+
+		if obj.VersionId == nil && deleteMarker {
+			deleted.DeleteMarkerVersionId = id
+		}
+
+		output.Deleted = append(output.Deleted, deleted)
+	}
+
+	return output, nil
+}
+
+// rollUp returns the common prefix of key, if delimiter occurs in key after prefix.
+func rollUp(key, prefix, delimiter string) (string, bool) {
+	if delimiter == "" {
+		return "", false
+	}
+
+	n := strings.Index(key[len(prefix):], delimiter)
+	if n < 0 {
+		return "", false
+	}
+
+	return key[:len(prefix)+n+len(delimiter)], true
+}
+
+// ListObjectsV2 lists the current objects in a bucket, one page at a time.
+// It supports Prefix, Delimiter, MaxKeys, StartAfter, and ContinuationToken.
+func (s *Service) ListObjectsV2(ctx context.Context,
+	params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := aws.ToString(params.Prefix)
+	delimiter := aws.ToString(params.Delimiter)
+
+	maxKeys := params.MaxKeys
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	// The continuation token is the last key or common prefix returned
+	marker := aws.ToString(params.StartAfter)
+	if params.ContinuationToken != nil {
+		marker = *params.ContinuationToken
+	}
+
+	output := &s3.ListObjectsV2Output{
+		Name:              params.Bucket,
+		Prefix:            params.Prefix,
+		Delimiter:         params.Delimiter,
+		MaxKeys:           maxKeys,
+		StartAfter:        params.StartAfter,
+		ContinuationToken: params.ContinuationToken,
+	}
+
+	last := ""
+
+	for _, key := range b.sortedKeys() {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+
+		commonPrefix, ok := rollUp(key, prefix, delimiter)
+		if ok && (commonPrefix == last || commonPrefix == marker) {
+			continue
+		}
+
+		if output.KeyCount == maxKeys {
+			output.IsTruncated = true
+			output.NextContinuationToken = aws.String(last)
+			break
+		}
+
+		if ok {
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+			last = commonPrefix
+		} else {
+			v := b.latest(key)
+			output.Contents = append(output.Contents, types.Object{
+				Key:          aws.String(key),
+				ETag:         aws.String(v.etag),
+				LastModified: aws.Time(v.lastModified),
+				Size:         int64(len(v.data)),
+				StorageClass: types.ObjectStorageClassStandard,
+				Owner:        s.owner(),
+			})
+			last = key
+		}
+
+		output.KeyCount++
+	}
+
+	return output, nil
+}
+
+// ListObjectVersions lists every version and delete marker in a bucket, one page at a time.
+// Versions of the same key are listed newest first.
+// It supports Prefix, Delimiter, MaxKeys, KeyMarker, and VersionIdMarker.
+func (s *Service) ListObjectVersions(ctx context.Context,
+	params *s3.ListObjectVersionsInput,
+	optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := aws.ToString(params.Prefix)
+	delimiter := aws.ToString(params.Delimiter)
+	keyMarker := aws.ToString(params.KeyMarker)
+
+	maxKeys := params.MaxKeys
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	output := &s3.ListObjectVersionsOutput{
+		Name:            params.Bucket,
+		Prefix:          params.Prefix,
+		Delimiter:       params.Delimiter,
+		MaxKeys:         maxKeys,
+		KeyMarker:       params.KeyMarker,
+		VersionIdMarker: params.VersionIdMarker,
+	}
+
+	var count int32
+	lastPrefix := ""
+
+	// The key and version ID of the last entry listed, for the next marker
+	lastKey, lastID := "", ""
+
+	truncate := func() {
+		output.IsTruncated = true
+		output.NextKeyMarker = aws.String(lastKey)
+		if lastID != "" {
+			output.NextVersionIdMarker = aws.String(lastID)
+		}
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key < keyMarker {
+			continue
+		}
+
+		// Without a version ID marker, KeyMarker itself has already been listed
+		if key == keyMarker && params.VersionIdMarker == nil {
+			continue
+		}
+
+		if commonPrefix, ok := rollUp(key, prefix, delimiter); ok {
+			if commonPrefix == lastPrefix || strings.HasPrefix(keyMarker, commonPrefix) {
+				continue
+			}
+
+			if count == maxKeys {
+				truncate()
+				return output, nil
+			}
+
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+			lastPrefix = commonPrefix
+			lastKey, lastID = commonPrefix, ""
+			count++
+			continue
+		}
+
+		versions := b.objects[key]
+
+		// Skip past the version ID marker
+		i := len(versions) - 1
+		if key == keyMarker {
+			for ; i >= 0; i-- {
+				if versions[i].id == *params.VersionIdMarker {
+					i--
+					break
+				}
+			}
+		}
+
+		for ; i >= 0; i-- {
+			v := versions[i]
+
+			if count == maxKeys {
+				truncate()
+				return output, nil
+			}
+
+			if v.deleteMarker {
+				output.DeleteMarkers = append(output.DeleteMarkers, types.DeleteMarkerEntry{
+					Key:          aws.String(key),
+					VersionId:    aws.String(v.id),
+					IsLatest:     i == len(versions)-1,
+					LastModified: aws.Time(v.lastModified),
+					Owner:        s.owner(),
+				})
+			} else {
+				output.Versions = append(output.Versions, types.ObjectVersion{
+					Key:          aws.String(key),
+					VersionId:    aws.String(v.id),
+					IsLatest:     i == len(versions)-1,
+					ETag:         aws.String(v.etag),
+					LastModified: aws.Time(v.lastModified),
+					Size:         int64(len(v.data)),
+					StorageClass: types.ObjectVersionStorageClassStandard,
+					Owner:        s.owner(),
+				})
+			}
+
+			lastKey, lastID = key, v.id
+			count++
+		}
+	}
+
+	return output, nil
+}
+
+// GetObjectAcl returns the grants on an object.
+func (s *Service) GetObjectAcl(ctx context.Context,
+	params *s3.GetObjectAclInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectAclOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := b.find(params.Key, params.VersionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.GetObjectAclOutput{
+		Owner:  s.owner(),
+		Grants: copyGrants(v.grants),
+	}, nil
+}
+
+// PutObjectAcl replaces the grants on an object with a canned ACL or an AccessControlPolicy.
+func (s *Service) PutObjectAcl(ctx context.Context,
+	params *s3.PutObjectAclInput,
+	optFns ...func(*s3.Options)) (*s3.PutObjectAclOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.lookupBucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := b.find(params.Key, params.VersionId)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := s.aclGrants(string(params.ACL), params.AccessControlPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	v.grants = grants
+
+	return &s3.PutObjectAclOutput{}, nil
+}
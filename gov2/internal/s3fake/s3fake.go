@@ -0,0 +1,213 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package s3fake provides an in-memory stand-in for the Amazon Simple Storage Service (Amazon S3) client.
+//
+// A Service implements the per-operation interfaces used by the gov2/s3 examples,
+// such as S3CopyObjectAPI and S3ListObjectsAPI, against a store of buckets, objects,
+// versions, metadata, and access control lists (ACLs).
+// Operations change that store, so a test can copy an object and then list it,
+// or delete an object and then check that HeadObject no longer finds it.
+// Failures are returned as the same error types the SDK returns,
+// such as *types.NoSuchBucket and *types.NoSuchKey.
+package s3fake
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// The operations the fake supports, checked against the SDK's paginator interfaces.
+var (
+	_ s3.ListObjectsV2APIClient = (*Service)(nil)
+)
+
+// Service is an in-memory Amazon S3 service.
+// The zero value is not usable; call New to create one.
+// A Service is safe for concurrent use.
+type Service struct {
+	// Owner is reported as the owner of every bucket and object.
+	Owner types.Owner
+
+	// Now returns the time used for creation and last-modified dates.
+	Now func() time.Time
+
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	nextVersion int
+}
+
+type bucket struct {
+	name       string
+	created    time.Time
+	versioning types.BucketVersioningStatus
+	grants     []types.Grant
+
+	// Every version of each key, oldest first
+	objects map[string][]*version
+}
+
+type version struct {
+	id           string
+	deleteMarker bool
+	data         []byte
+	etag         string
+	lastModified time.Time
+	metadata     map[string]string
+	contentType  *string
+	encoding     *string
+	grants       []types.Grant
+}
+
+// nullVersion is the version ID of objects stored while versioning is not enabled.
+const nullVersion = "null"
+
+// New creates an empty Service.
+func New() *Service {
+	return &Service{
+		Owner: types.Owner{
+			DisplayName: aws.String("doc-example-owner"),
+			ID:          aws.String("doc-example-owner-id"),
+		},
+		Now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Errors shaped like the ones Amazon S3 returns.
+
+func errNoSuchBucket(name string) error {
+	return &types.NoSuchBucket{Message: aws.String("The specified bucket does not exist: " + name)}
+}
+
+func errNoSuchKey(key string) error {
+	return &types.NoSuchKey{Message: aws.String("The specified key does not exist: " + key)}
+}
+
+func apiError(code, message string) error {
+	return &smithy.GenericAPIError{Code: code, Message: message, Fault: smithy.FaultClient}
+}
+
+// lookupBucket returns the named bucket. The caller must hold s.mu.
+func (s *Service) lookupBucket(name *string) (*bucket, error) {
+	if name == nil || *name == "" {
+		return nil, apiError("InvalidBucketName", "The bucket name is missing")
+	}
+
+	b, ok := s.buckets[*name]
+	if !ok {
+		return nil, errNoSuchBucket(*name)
+	}
+
+	return b, nil
+}
+
+// newVersionID returns the next version ID. The caller must hold s.mu.
+func (s *Service) newVersionID() string {
+	s.nextVersion++
+	return fmt.Sprintf("%032x", s.nextVersion)
+}
+
+// store adds v as the newest version of key.
+// Unless versioning is enabled, v replaces the null version. The caller must hold s.mu.
+func (s *Service) store(b *bucket, key string, v *version) {
+	versions := b.objects[key]
+
+	if b.versioning == types.BucketVersioningStatusEnabled {
+		v.id = s.newVersionID()
+	} else {
+		v.id = nullVersion
+
+		for i, old := range versions {
+			if old.id == nullVersion {
+				versions = append(versions[:i:i], versions[i+1:]...)
+				break
+			}
+		}
+	}
+
+	b.objects[key] = append(versions, v)
+}
+
+// latest returns the newest version of key, or nil if there isn't one.
+func (b *bucket) latest(key string) *version {
+	versions := b.objects[key]
+	if len(versions) == 0 {
+		return nil
+	}
+
+	return versions[len(versions)-1]
+}
+
+// find returns the version of key with the given ID, or the newest version if id is nil.
+// It returns an error if the object or version does not exist or is a delete marker.
+func (b *bucket) find(key *string, id *string) (*version, error) {
+	if key == nil || *key == "" {
+		return nil, apiError("InvalidArgument", "The key is missing")
+	}
+
+	if id == nil {
+		v := b.latest(*key)
+		if v == nil || v.deleteMarker {
+			return nil, errNoSuchKey(*key)
+		}
+
+		return v, nil
+	}
+
+	for _, v := range b.objects[*key] {
+		if v.id == *id {
+			if v.deleteMarker {
+				return nil, apiError("MethodNotAllowed", "The specified method is not allowed against this resource")
+			}
+
+			return v, nil
+		}
+	}
+
+	return nil, apiError("NoSuchVersion", "The specified version does not exist: "+*id)
+}
+
+// sortedKeys returns the keys in b whose newest version is not a delete marker, in order.
+func (b *bucket) sortedKeys() []string {
+	keys := make([]string, 0, len(b.objects))
+	for key, versions := range b.objects {
+		if len(versions) > 0 && !versions[len(versions)-1].deleteMarker {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// etag returns the quoted MD5 digest Amazon S3 uses as the ETag of a single-part upload.
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// copyMetadata copies user metadata, lowercasing the keys as the SDK does when it reads them back.
+func copyMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	c := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		c[strings.ToLower(k)] = v
+	}
+
+	return c
+}
@@ -0,0 +1,411 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package s3fake
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const testBucket = "doc-example-bucket"
+
+func newTestService(t *testing.T, buckets ...string) *Service {
+	s := New()
+
+	for _, name := range buckets {
+		_, err := s.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(name)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
+
+func put(t *testing.T, s *Service, bucket, key, body string) *s3.PutObjectOutput {
+	output, err := s.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	return ""
+}
+
+func TestBuckets(t *testing.T) {
+	s := newTestService(t, "doc-example-bucket2", testBucket)
+
+	_, err := s.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(testBucket)})
+	var owned *types.BucketAlreadyOwnedByYou
+	if !errors.As(err, &owned) {
+		t.Errorf("Expected BucketAlreadyOwnedByYou, got %v", err)
+	}
+
+	resp, err := s.ListBuckets(context.Background(), &s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Buckets) != 2 || *resp.Buckets[0].Name != testBucket {
+		t.Errorf("Expected two buckets starting with %s, got %d", testBucket, len(resp.Buckets))
+	}
+
+	put(t, s, testBucket, "item1", "hello")
+
+	_, err = s.DeleteBucket(context.Background(), &s3.DeleteBucketInput{Bucket: aws.String(testBucket)})
+	if errorCode(err) != "BucketNotEmpty" {
+		t.Errorf("Expected BucketNotEmpty, got %v", err)
+	}
+
+	_, err = s.DeleteBucket(context.Background(), &s3.DeleteBucketInput{Bucket: aws.String("doc-example-bucket2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String("doc-example-bucket2")})
+	var noBucket *types.NoSuchBucket
+	if !errors.As(err, &noBucket) {
+		t.Errorf("Expected NoSuchBucket, got %v", err)
+	}
+}
+
+func TestPutGetObject(t *testing.T) {
+	s := newTestService(t, testBucket)
+
+	_, err := s.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(testBucket),
+		Key:         aws.String("dir/item1"),
+		Body:        strings.NewReader("hello world"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]string{"Color": "blue"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("dir/item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "hello world" || resp.ContentLength != 11 {
+		t.Errorf("Expected hello world, got %q (%d bytes)", body, resp.ContentLength)
+	}
+
+	if resp.Metadata["color"] != "blue" || aws.ToString(resp.ContentType) != "text/plain" {
+		t.Errorf("Expected metadata color=blue and text/plain, got %v and %s", resp.Metadata, aws.ToString(resp.ContentType))
+	}
+
+	if *resp.ETag != `"5eb63bbbe01eeed093cb22bb8f5acdc3"` {
+		t.Errorf("Expected the MD5 digest as the ETag, got %s", *resp.ETag)
+	}
+
+	resp, err = s.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("dir/item1"),
+		Range:  aws.String("bytes=6-"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ = ioutil.ReadAll(resp.Body)
+	if string(body) != "world" || aws.ToString(resp.ContentRange) != "bytes 6-10/11" {
+		t.Errorf("Expected world (bytes 6-10/11), got %q (%s)", body, aws.ToString(resp.ContentRange))
+	}
+
+	_, err = s.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("missing"),
+	})
+	var noKey *types.NoSuchKey
+	if !errors.As(err, &noKey) {
+		t.Errorf("Expected NoSuchKey, got %v", err)
+	}
+
+	_, err = s.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("missing-bucket"),
+		Key:    aws.String("item1"),
+	})
+	var noBucket *types.NoSuchBucket
+	if !errors.As(err, &noBucket) {
+		t.Errorf("Expected NoSuchBucket, got %v", err)
+	}
+}
+
+func TestCopyThenList(t *testing.T) {
+	s := newTestService(t, "doc-example-source", testBucket)
+	put(t, s, "doc-example-source", "photos/cat.jpg", "meow")
+
+	_, err := s.CopyObject(context.Background(), &s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		CopySource: aws.String("doc-example-source/photos%2Fcat.jpg"),
+		Key:        aws.String("copy/cat.jpg"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Contents) != 1 || *resp.Contents[0].Key != "copy/cat.jpg" || resp.Contents[0].Size != 4 {
+		t.Errorf("Expected copy/cat.jpg (4 bytes), got %v", resp.Contents)
+	}
+
+	_, err = s.CopyObject(context.Background(), &s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		CopySource: aws.String("doc-example-source/missing"),
+		Key:        aws.String("copy/missing"),
+	})
+	var noKey *types.NoSuchKey
+	if !errors.As(err, &noKey) {
+		t.Errorf("Expected NoSuchKey, got %v", err)
+	}
+}
+
+func TestDeleteThenHead(t *testing.T) {
+	s := newTestService(t, testBucket)
+	put(t, s, testBucket, "item1", "hello")
+
+	_, err := s.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("item1"),
+	})
+	if errorCode(err) != "NotFound" {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	// The bucket is now empty, so it can be deleted
+	_, err = s.DeleteBucket(context.Background(), &s3.DeleteBucketInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	s := newTestService(t, testBucket)
+
+	_, err := s.PutBucketVersioning(context.Background(), &s3.PutBucketVersioningInput{
+		Bucket: aws.String(testBucket),
+		VersioningConfiguration: &types.VersioningConfiguration{
+			Status: types.BucketVersioningStatusEnabled,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1 := put(t, s, testBucket, "item1", "first")
+	put(t, s, testBucket, "item1", "second")
+	put(t, s, testBucket, "item2", "other")
+
+	del, err := s.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !del.DeleteMarker {
+		t.Error("Expected a delete marker")
+	}
+
+	// The old version is still readable by ID
+	resp, err := s.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket:    aws.String(testBucket),
+		Key:       aws.String("item1"),
+		VersionId: v1.VersionId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "first" {
+		t.Errorf("Expected first, got %q", body)
+	}
+
+	// Page through the versions two at a time
+	var versions, markers int
+	input := &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(testBucket),
+		MaxKeys: 2,
+	}
+
+	for {
+		page, err := s.ListObjectVersions(context.Background(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		versions += len(page.Versions)
+		markers += len(page.DeleteMarkers)
+
+		if !page.IsTruncated {
+			break
+		}
+
+		input.KeyMarker = page.NextKeyMarker
+		input.VersionIdMarker = page.NextVersionIdMarker
+	}
+
+	if versions != 3 || markers != 1 {
+		t.Errorf("Expected 3 versions and 1 delete marker, got %d and %d", versions, markers)
+	}
+
+	_, err = s.DeleteBucket(context.Background(), &s3.DeleteBucketInput{Bucket: aws.String(testBucket)})
+	if errorCode(err) != "BucketNotEmpty" {
+		t.Errorf("Expected BucketNotEmpty while versions remain, got %v", err)
+	}
+
+	// Removing the delete marker restores the object
+	_, err = s.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket:    aws.String(testBucket),
+		Key:       aws.String("item1"),
+		VersionId: del.VersionId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = s.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ = ioutil.ReadAll(resp.Body)
+	if string(body) != "second" {
+		t.Errorf("Expected second, got %q", body)
+	}
+}
+
+func TestListObjectsV2Pages(t *testing.T) {
+	s := newTestService(t, testBucket)
+
+	for _, key := range []string{"a/1", "a/2", "b/1", "c", "d", "e"} {
+		put(t, s, testBucket, key, key)
+	}
+
+	var keys, prefixes []string
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(testBucket),
+		Delimiter: aws.String("/"),
+		MaxKeys:   2,
+	}
+
+	for {
+		page, err := s.ListObjectsV2(context.Background(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, item := range page.Contents {
+			keys = append(keys, *item.Key)
+		}
+
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, *p.Prefix)
+		}
+
+		if !page.IsTruncated {
+			break
+		}
+
+		input.ContinuationToken = page.NextContinuationToken
+	}
+
+	if strings.Join(keys, ",") != "c,d,e" || strings.Join(prefixes, ",") != "a/,b/" {
+		t.Errorf("Expected keys c,d,e and prefixes a/,b/, got %v and %v", keys, prefixes)
+	}
+}
+
+func TestAcls(t *testing.T) {
+	s := newTestService(t)
+
+	_, err := s.CreateBucket(context.Background(), &s3.CreateBucketInput{
+		Bucket: aws.String(testBucket),
+		ACL:    types.BucketCannedACLPublicRead,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucketAcl, err := s.GetBucketAcl(context.Background(), &s3.GetBucketAclInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bucketAcl.Grants) != 2 || aws.ToString(bucketAcl.Grants[1].Grantee.URI) != AllUsersURI {
+		t.Errorf("Expected owner and AllUsers grants, got %d grants", len(bucketAcl.Grants))
+	}
+
+	put(t, s, testBucket, "item1", "hello")
+
+	_, err = s.PutObjectAcl(context.Background(), &s3.PutObjectAclInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("item1"),
+		ACL:    types.ObjectCannedACLAuthenticatedRead,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objectAcl, err := s.GetObjectAcl(context.Background(), &s3.GetObjectAclInput{
+		Bucket: aws.String(testBucket),
+		Key:    aws.String("item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objectAcl.Grants) != 2 || aws.ToString(objectAcl.Grants[1].Grantee.URI) != AuthenticatedUsersURI {
+		t.Errorf("Expected owner and AuthenticatedUsers grants, got %d grants", len(objectAcl.Grants))
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package snsfake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/snsfilter"
+)
+
+// Delivery is a message published to a topic, as sent to one subscription whose filter policy accepts it.
+type Delivery struct {
+	SubscriptionArn string
+	TopicArn        string
+	Protocol        string
+	Endpoint        string
+
+	// Message is what the endpoint receives: the published message for raw message delivery,
+	// and otherwise a JSON notification that wraps the message and its attributes.
+	// A message published with MessageStructure json is the one for the subscription's protocol, or the default.
+	Message string
+
+	// MessageAttributes are the published message attributes, for raw message delivery only.
+	MessageAttributes map[string]types.MessageAttributeValue
+
+	// For a FIFO topic, the message group ID and deduplication ID
+	MessageGroupID  string
+	DeduplicationID string
+}
+
+// parseFilterPolicy parses the FilterPolicy attribute of a subscription.
+// An empty policy accepts every message.
+func parseFilterPolicy(policy string) (*snsfilter.Policy, error) {
+	if policy == "" {
+		return nil, nil
+	}
+
+	p, err := snsfilter.Parse([]byte(policy))
+	if err != nil {
+		return nil, errInvalidParameter("FilterPolicy: " + err.Error())
+	}
+
+	return p, nil
+}
+
+// checkSubscriptionAttribute validates the value of a subscription attribute.
+func checkSubscriptionAttribute(name, value string) error {
+	switch name {
+	case "FilterPolicy":
+		_, err := parseFilterPolicy(value)
+		return err
+	case "RawMessageDelivery":
+		if value != "true" && value != "false" {
+			return errInvalidParameter("RawMessageDelivery: Invalid value [" + value + "]. Must be true or false.")
+		}
+	}
+
+	return nil
+}
+
+// notificationAttribute is a message attribute in a JSON notification.
+type notificationAttribute struct {
+	Type  string
+	Value string
+}
+
+// notification is the JSON document that a subscription without raw message delivery receives.
+type notification struct {
+	Type              string
+	MessageId         string
+	TopicArn          string
+	Subject           string `json:",omitempty"`
+	Message           string
+	Timestamp         string
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	UnsubscribeURL    string
+	MessageAttributes map[string]notificationAttribute `json:",omitempty"`
+}
+
+// deliver sends a published message to each subscription of t whose filter policy accepts it,
+// and returns the ARNs of those subscriptions. The caller must hold s.mu.
+func (s *Service) deliver(t *topic, p Published) []string {
+	var delivered []string
+
+	for _, sub := range t.subscriptions {
+		// The policy was checked when it was set
+		filter, _ := parseFilterPolicy(sub.attributes["FilterPolicy"])
+		if filter != nil && !filter.Match(p.MessageAttributes) {
+			continue
+		}
+
+		delivered = append(delivered, sub.arn)
+
+		if s.Deliver == nil {
+			continue
+		}
+
+		d := Delivery{
+			SubscriptionArn: sub.arn,
+			TopicArn:        t.arn,
+			Protocol:        sub.protocol,
+			Endpoint:        sub.endpoint,
+			MessageGroupID:  p.MessageGroupID,
+			DeduplicationID: p.DeduplicationID,
+		}
+
+		message := p.Message
+		if p.MessageStructure == "json" {
+			// The structure was checked when the message was published
+			bodies, _ := messageBodies(p.Message)
+
+			message = bodies["default"]
+			if body, ok := bodies[sub.protocol]; ok {
+				message = body
+			}
+		}
+
+		if sub.attributes["RawMessageDelivery"] == "true" {
+			d.Message = message
+			d.MessageAttributes = p.MessageAttributes
+		} else {
+			d.Message = s.notification(sub, p, message)
+		}
+
+		s.Deliver(d)
+	}
+
+	return delivered
+}
+
+// notification returns the JSON notification of a published message for a subscription.
+func (s *Service) notification(sub *subscription, p Published, message string) string {
+	n := notification{
+		Type:             "Notification",
+		MessageId:        p.MessageID,
+		TopicArn:         sub.topicArn,
+		Subject:          p.Subject,
+		Message:          message,
+		Timestamp:        p.Time.UTC().Format("2006-01-02T15:04:05.000Z"),
+		SignatureVersion: "1",
+		Signature:        "EXAMPLE",
+		SigningCertURL:   "https://sns." + s.Region + ".amazonaws.com/SimpleNotificationService-EXAMPLE.pem",
+		UnsubscribeURL:   "https://sns." + s.Region + ".amazonaws.com/?Action=Unsubscribe&SubscriptionArn=" + sub.arn,
+	}
+
+	for name, v := range p.MessageAttributes {
+		if n.MessageAttributes == nil {
+			n.MessageAttributes = map[string]notificationAttribute{}
+		}
+
+		value := aws.ToString(v.StringValue)
+		if v.BinaryValue != nil {
+			value = base64.StdEncoding.EncodeToString(v.BinaryValue)
+		}
+
+		n.MessageAttributes[name] = notificationAttribute{Type: aws.ToString(v.DataType), Value: value}
+	}
+
+	data, _ := json.Marshal(n)
+
+	return string(data)
+}
@@ -0,0 +1,179 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package snsfake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// fifoSuffix ends the name of every FIFO topic.
+const fifoSuffix = ".fifo"
+
+// dedupWindow is how long a FIFO topic remembers a deduplication ID.
+const dedupWindow = 5 * time.Minute
+
+// maxAttributes is the most message attributes a message can have.
+const maxAttributes = 10
+
+// fifo reports whether t is a FIFO topic.
+func (t *topic) fifo() bool {
+	return t.attributes["FifoTopic"] == "true"
+}
+
+// checkFifoAttributes checks that a new topic's name and attributes agree on whether it is a FIFO topic.
+func checkFifoAttributes(name string, attributes map[string]string) error {
+	for _, k := range []string{"FifoTopic", "ContentBasedDeduplication"} {
+		if v, ok := attributes[k]; ok && v != "true" && v != "false" {
+			return errInvalidParameter("Attributes Reason: " + k + ": Invalid value [" + v + "]. Must be true or false.")
+		}
+	}
+
+	fifo := attributes["FifoTopic"] == "true"
+
+	if fifo != strings.HasSuffix(name, fifoSuffix) {
+		return errInvalidParameter("Topic Name: Fifo Topic names must end with .fifo and Standard Topic cannot end with .fifo")
+	}
+
+	if attributes["ContentBasedDeduplication"] == "true" && !fifo {
+		return errInvalidParameter("Attributes Reason: Content-based deduplication can only be set for FIFO topics")
+	}
+
+	return nil
+}
+
+// fifoIDs validates the FIFO parameters of a message published to t.
+// For a FIFO topic it returns the message group ID and the deduplication ID,
+// which is the SHA-256 hash of the message if the topic has ContentBasedDeduplication
+// and the message has no MessageDeduplicationId.
+func fifoIDs(t *topic, message string, groupID, dedupID *string) (string, string, error) {
+	if !t.fifo() {
+		if groupID != nil {
+			return "", "", errInvalidParameter("MessageGroupId: The request includes MessageGroupId parameter that is not valid for this topic type")
+		}
+
+		if dedupID != nil {
+			return "", "", errInvalidParameter("MessageDeduplicationId: The request includes MessageDeduplicationId parameter that is not valid for this topic type")
+		}
+
+		return "", "", nil
+	}
+
+	if aws.ToString(groupID) == "" {
+		return "", "", errInvalidParameter("The MessageGroupId parameter is required for FIFO topics")
+	}
+
+	if dedupID == nil {
+		if t.attributes["ContentBasedDeduplication"] != "true" {
+			return "", "", errInvalidParameter("The topic should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+		}
+
+		sum := sha256.Sum256([]byte(message))
+
+		return *groupID, hex.EncodeToString(sum[:]), nil
+	}
+
+	if *dedupID == "" || len(*dedupID) > 128 {
+		return "", "", errInvalidParameter("MessageDeduplicationId Reason: must be 1 to 128 characters")
+	}
+
+	return *groupID, *dedupID, nil
+}
+
+// duplicate returns the message published to t with the same deduplication ID within the
+// deduplication window, if any. It forgets the IDs whose window has passed.
+func (t *topic) duplicate(dedupID string, now time.Time) (Published, bool) {
+	for id, p := range t.deduplication {
+		if !now.Before(p.Time.Add(dedupWindow)) {
+			delete(t.deduplication, id)
+		}
+	}
+
+	p, ok := t.deduplication[dedupID]
+
+	return p, ok
+}
+
+// nextSequenceNumber returns the sequence number for the next message published to t.
+func (t *topic) nextSequenceNumber() string {
+	t.sequence++
+	return fmt.Sprintf("%020d", t.sequence)
+}
+
+// checkMessageAttributes validates message attributes the way Amazon SNS does.
+func checkMessageAttributes(attributes map[string]types.MessageAttributeValue) error {
+	if len(attributes) > maxAttributes {
+		return errInvalidParameter("MessageAttributes: Number of message attributes [" + strconv.Itoa(len(attributes)) + "] exceeds the allowed maximum [10].")
+	}
+
+	for name, v := range attributes {
+		if name == "" || len(name) > 256 || strings.HasPrefix(strings.ToLower(name), "aws.") {
+			return errInvalidParameter("Message attribute name '" + name + "' is invalid")
+		}
+
+		dataType := aws.ToString(v.DataType)
+		base := dataType
+		if i := strings.Index(dataType, "."); i >= 0 && dataType != "String.Array" {
+			base = dataType[:i]
+		}
+
+		invalid := func(reason string) error {
+			return errInvalidParameter("The message attribute '" + name + "' " + reason)
+		}
+
+		switch base {
+		case "String":
+			if aws.ToString(v.StringValue) == "" {
+				return invalid("must contain non-empty message attribute value for message attribute type 'String'.")
+			}
+		case "Number":
+			if _, err := strconv.ParseFloat(aws.ToString(v.StringValue), 64); err != nil {
+				return invalid("with type 'Number' must use a numeric value.")
+			}
+		case "Binary":
+			if len(v.BinaryValue) == 0 {
+				return invalid("must contain non-empty message attribute value for message attribute type 'Binary'.")
+			}
+		case "String.Array":
+			var items []interface{}
+			if json.Unmarshal([]byte(aws.ToString(v.StringValue)), &items) != nil {
+				return invalid("has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.")
+			}
+
+			for _, item := range items {
+				switch item.(type) {
+				case string, float64, bool, nil:
+				default:
+					return invalid("with type 'String.Array' can only contain strings, numbers, true, false, and null.")
+				}
+			}
+		default:
+			return invalid("has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.")
+		}
+	}
+
+	return nil
+}
+
+// messageBodies parses a message published with MessageStructure json:
+// a JSON object with a message for each protocol, and a default message for the others.
+func messageBodies(message string) (map[string]string, error) {
+	var bodies map[string]string
+	if json.Unmarshal([]byte(message), &bodies) != nil {
+		return nil, errInvalidParameter("Message Structure - JSON message body failed to parse")
+	}
+
+	if _, ok := bodies["default"]; !ok {
+		return nil, errInvalidParameter("Message Structure - No default entry in JSON message body")
+	}
+
+	return bodies, nil
+}
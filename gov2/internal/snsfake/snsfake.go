@@ -0,0 +1,656 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package snsfake provides an in-memory stand-in for the Amazon Simple Notification Service (Amazon SNS) client.
+//
+// A Service implements the per-operation interfaces used by the gov2/sns examples,
+// such as SNSPublishAPI and SNSSubscribeAPI, against a store of topics and subscriptions.
+// Published messages are recorded so a test can check what was sent,
+// and a message published to a topic goes to each subscription whose filter policy accepts it.
+// Failures are returned as the same error types the SDK returns, such as *types.NotFoundException.
+package snsfake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// pageSize is the number of topics or subscriptions returned by each List call, as in Amazon SNS.
+const pageSize = 100
+
+// maxMessageSize is the most bytes a message and its attributes can have together.
+const maxMessageSize = 262144
+
+// Service is an in-memory Amazon SNS service.
+// The zero value is not usable; call New to create one.
+// A Service is safe for concurrent use.
+type Service struct {
+	// Region and AccountID are used to build topic and subscription ARNs.
+	Region    string
+	AccountID string
+
+	// Now returns the time recorded for each published message.
+	Now func() time.Time
+
+	// Deliver, if set, is called for each subscription that a message published to a topic goes to.
+	// It is called while the Service is locked, so it must not call the Service.
+	Deliver func(Delivery)
+
+	mu        sync.Mutex
+	topics    map[string]*topic
+	nextID    int
+	published []Published
+}
+
+type topic struct {
+	arn           string
+	name          string
+	attributes    map[string]string
+	subscriptions []*subscription
+
+	// For FIFO topics
+	sequence      int64
+	deduplication map[string]Published
+}
+
+type subscription struct {
+	arn        string
+	topicArn   string
+	protocol   string
+	endpoint   string
+	attributes map[string]string
+}
+
+// Published is a message recorded by Publish.
+type Published struct {
+	MessageID string
+	Time      time.Time
+
+	// The PublishInput fields, without pointers
+	TopicArn          string
+	TargetArn         string
+	PhoneNumber       string
+	Subject           string
+	Message           string
+	MessageStructure  string
+	MessageAttributes map[string]types.MessageAttributeValue
+	// For a FIFO topic, the message group ID, the deduplication ID, which is the SHA-256 hash
+	// of the message for a topic with ContentBasedDeduplication, and the sequence number
+	MessageGroupID  string
+	DeduplicationID string
+	SequenceNumber  string
+
+	// Delivered lists the ARNs of the subscriptions whose filter policies accepted the message.
+	Delivered []string
+}
+
+// New creates a Service with no topics.
+func New() *Service {
+	return &Service{
+		Region:    "us-west-2",
+		AccountID: "123456789012",
+		Now:       time.Now,
+		topics:    map[string]*topic{},
+	}
+}
+
+// Errors shaped like the ones Amazon SNS returns.
+
+func errNotFound(what string) error {
+	return &types.NotFoundException{Message: aws.String(what + " does not exist")}
+}
+
+func errInvalidParameter(message string) error {
+	return &types.InvalidParameterException{Message: aws.String("Invalid parameter: " + message)}
+}
+
+// newID returns a unique ID. The caller must hold s.mu.
+func (s *Service) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%08x-0000-4000-8000-%012x", s.nextID, s.nextID)
+}
+
+// TopicARN returns the ARN of the named topic, whether or not it exists.
+func (s *Service) TopicARN(name string) string {
+	return "arn:aws:sns:" + s.Region + ":" + s.AccountID + ":" + name
+}
+
+// lookupTopic returns the topic with the given ARN. The caller must hold s.mu.
+func (s *Service) lookupTopic(arn *string) (*topic, error) {
+	if arn == nil || *arn == "" {
+		return nil, errInvalidParameter("TopicArn")
+	}
+
+	t, ok := s.topics[*arn]
+	if !ok {
+		return nil, errNotFound("Topic")
+	}
+
+	return t, nil
+}
+
+// lookupSubscription returns the subscription with the given ARN. The caller must hold s.mu.
+func (s *Service) lookupSubscription(arn *string) (*topic, int, error) {
+	for _, t := range s.topics {
+		for i, sub := range t.subscriptions {
+			if sub.arn == aws.ToString(arn) {
+				return t, i, nil
+			}
+		}
+	}
+
+	return nil, 0, errNotFound("Subscription")
+}
+
+// page returns the slice of n items starting at the position given by token.
+func page(n int, token *string) (int, int, *string, error) {
+	start := 0
+	if token != nil {
+		var err error
+		start, err = strconv.Atoi(*token)
+		if err != nil || start < 0 || start > n {
+			return 0, 0, nil, errInvalidParameter("NextToken")
+		}
+	}
+
+	end := start + pageSize
+	if end >= n {
+		return start, n, nil, nil
+	}
+
+	return start, end, aws.String(strconv.Itoa(end)), nil
+}
+
+// CreateTopic creates a topic, or returns the ARN of the existing topic with the same name.
+func (s *Service) CreateTopic(ctx context.Context,
+	params *sns.CreateTopicInput,
+	optFns ...func(*sns.Options)) (*sns.CreateTopicOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.Name)
+	if name == "" || len(name) > 256 {
+		return nil, errInvalidParameter("Topic Name")
+	}
+
+	for _, c := range strings.TrimSuffix(name, fifoSuffix) {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return nil, errInvalidParameter("Topic Name")
+		}
+	}
+
+	err := checkFifoAttributes(name, params.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	arn := s.TopicARN(name)
+	if _, ok := s.topics[arn]; !ok {
+		t := &topic{
+			arn:        arn,
+			name:       name,
+			attributes: map[string]string{},
+		}
+
+		for k, v := range params.Attributes {
+			t.attributes[k] = v
+		}
+
+		if t.fifo() {
+			t.deduplication = map[string]Published{}
+		}
+
+		s.topics[arn] = t
+	}
+
+	return &sns.CreateTopicOutput{TopicArn: aws.String(arn)}, nil
+}
+
+// DeleteTopic deletes a topic and its subscriptions.
+// Like Amazon SNS, it succeeds if the topic does not exist.
+func (s *Service) DeleteTopic(ctx context.Context,
+	params *sns.DeleteTopicInput,
+	optFns ...func(*sns.Options)) (*sns.DeleteTopicOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.topics, aws.ToString(params.TopicArn))
+
+	return &sns.DeleteTopicOutput{}, nil
+}
+
+// ListTopics lists the ARNs of the topics, 100 at a time.
+func (s *Service) ListTopics(ctx context.Context,
+	params *sns.ListTopicsInput,
+	optFns ...func(*sns.Options)) (*sns.ListTopicsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	arns := make([]string, 0, len(s.topics))
+	for arn := range s.topics {
+		arns = append(arns, arn)
+	}
+
+	sort.Strings(arns)
+
+	start, end, next, err := page(len(arns), params.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &sns.ListTopicsOutput{
+		NextToken: next,
+	}
+
+	for _, arn := range arns[start:end] {
+		output.Topics = append(output.Topics, types.Topic{TopicArn: aws.String(arn)})
+	}
+
+	return output, nil
+}
+
+// GetTopicAttributes returns the attributes of a topic.
+func (s *Service) GetTopicAttributes(ctx context.Context,
+	params *sns.GetTopicAttributesInput,
+	optFns ...func(*sns.Options)) (*sns.GetTopicAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookupTopic(params.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]string{
+		"TopicArn":                t.arn,
+		"Owner":                   s.AccountID,
+		"SubscriptionsConfirmed":  strconv.Itoa(len(t.subscriptions)),
+		"SubscriptionsPending":    "0",
+		"SubscriptionsDeleted":    "0",
+		"DisplayName":             "",
+		"EffectiveDeliveryPolicy": "",
+	}
+
+	for k, v := range t.attributes {
+		attributes[k] = v
+	}
+
+	return &sns.GetTopicAttributesOutput{Attributes: attributes}, nil
+}
+
+// SetTopicAttributes sets one attribute of a topic.
+func (s *Service) SetTopicAttributes(ctx context.Context,
+	params *sns.SetTopicAttributesInput,
+	optFns ...func(*sns.Options)) (*sns.SetTopicAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookupTopic(params.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch aws.ToString(params.AttributeName) {
+	case "":
+		return nil, errInvalidParameter("AttributeName")
+	case "FifoTopic":
+		// Whether a topic is a FIFO topic is fixed when it is created
+		return nil, errInvalidParameter("AttributeName: FifoTopic can't be changed")
+	case "ContentBasedDeduplication":
+		if !t.fifo() {
+			return nil, errInvalidParameter("Attributes Reason: Content-based deduplication can only be set for FIFO topics")
+		}
+	}
+
+	t.attributes[*params.AttributeName] = aws.ToString(params.AttributeValue)
+
+	return &sns.SetTopicAttributesOutput{}, nil
+}
+
+// Subscribe subscribes an endpoint to a topic.
+// Subscriptions are confirmed right away, so the subscription ARN is always returned.
+func (s *Service) Subscribe(ctx context.Context,
+	params *sns.SubscribeInput,
+	optFns ...func(*sns.Options)) (*sns.SubscribeOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookupTopic(params.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := aws.ToString(params.Protocol)
+	switch protocol {
+	case "http", "https", "email", "email-json", "sms", "sqs", "application", "lambda", "firehose":
+	default:
+		return nil, errInvalidParameter("Invalid protocol type: " + protocol)
+	}
+
+	endpoint := aws.ToString(params.Endpoint)
+	if endpoint == "" {
+		return nil, errInvalidParameter("Endpoint")
+	}
+
+	// Subscribing the same endpoint twice returns the existing subscription
+	for _, sub := range t.subscriptions {
+		if sub.protocol == protocol && sub.endpoint == endpoint {
+			return &sns.SubscribeOutput{SubscriptionArn: aws.String(sub.arn)}, nil
+		}
+	}
+
+	sub := &subscription{
+		arn:        t.arn + ":" + s.newID(),
+		topicArn:   t.arn,
+		protocol:   protocol,
+		endpoint:   endpoint,
+		attributes: map[string]string{},
+	}
+
+	for k, v := range params.Attributes {
+		err := checkSubscriptionAttribute(k, v)
+		if err != nil {
+			return nil, err
+		}
+
+		sub.attributes[k] = v
+	}
+
+	t.subscriptions = append(t.subscriptions, sub)
+
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String(sub.arn)}, nil
+}
+
+// Unsubscribe deletes a subscription.
+func (s *Service) Unsubscribe(ctx context.Context,
+	params *sns.UnsubscribeInput,
+	optFns ...func(*sns.Options)) (*sns.UnsubscribeOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, i, err := s.lookupSubscription(params.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+
+	t.subscriptions = append(t.subscriptions[:i:i], t.subscriptions[i+1:]...)
+
+	return &sns.UnsubscribeOutput{}, nil
+}
+
+// GetSubscriptionAttributes returns the attributes of a subscription.
+func (s *Service) GetSubscriptionAttributes(ctx context.Context,
+	params *sns.GetSubscriptionAttributesInput,
+	optFns ...func(*sns.Options)) (*sns.GetSubscriptionAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, i, err := s.lookupSubscription(params.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := t.subscriptions[i]
+
+	attributes := map[string]string{
+		"SubscriptionArn":              sub.arn,
+		"TopicArn":                     sub.topicArn,
+		"Protocol":                     sub.protocol,
+		"Endpoint":                     sub.endpoint,
+		"Owner":                        s.AccountID,
+		"ConfirmationWasAuthenticated": "true",
+		"PendingConfirmation":          "false",
+	}
+
+	for k, v := range sub.attributes {
+		attributes[k] = v
+	}
+
+	return &sns.GetSubscriptionAttributesOutput{Attributes: attributes}, nil
+}
+
+// SetSubscriptionAttributes sets one attribute of a subscription, such as FilterPolicy or RawMessageDelivery.
+func (s *Service) SetSubscriptionAttributes(ctx context.Context,
+	params *sns.SetSubscriptionAttributesInput,
+	optFns ...func(*sns.Options)) (*sns.SetSubscriptionAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, i, err := s.lookupSubscription(params.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.ToString(params.AttributeName)
+	switch name {
+	case "DeliveryPolicy", "FilterPolicy", "RawMessageDelivery", "RedrivePolicy":
+	default:
+		return nil, errInvalidParameter("AttributeName")
+	}
+
+	value := aws.ToString(params.AttributeValue)
+
+	err = checkSubscriptionAttribute(name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	t.subscriptions[i].attributes[name] = value
+
+	return &sns.SetSubscriptionAttributesOutput{}, nil
+}
+
+// ListSubscriptions lists every subscription, 100 at a time.
+func (s *Service) ListSubscriptions(ctx context.Context,
+	params *sns.ListSubscriptionsInput,
+	optFns ...func(*sns.Options)) (*sns.ListSubscriptionsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := s.subscriptions("")
+
+	start, end, next, err := page(len(subs), params.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sns.ListSubscriptionsOutput{
+		Subscriptions: subs[start:end],
+		NextToken:     next,
+	}, nil
+}
+
+// ListSubscriptionsByTopic lists the subscriptions to a topic, 100 at a time.
+func (s *Service) ListSubscriptionsByTopic(ctx context.Context,
+	params *sns.ListSubscriptionsByTopicInput,
+	optFns ...func(*sns.Options)) (*sns.ListSubscriptionsByTopicOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookupTopic(params.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := s.subscriptions(t.arn)
+
+	start, end, next, err := page(len(subs), params.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sns.ListSubscriptionsByTopicOutput{
+		Subscriptions: subs[start:end],
+		NextToken:     next,
+	}, nil
+}
+
+// subscriptions returns the subscriptions to the topic, or to every topic if topicArn is empty,
+// in ARN order. The caller must hold s.mu.
+func (s *Service) subscriptions(topicArn string) []types.Subscription {
+	var subs []types.Subscription
+
+	for _, t := range s.topics {
+		if topicArn != "" && t.arn != topicArn {
+			continue
+		}
+
+		for _, sub := range t.subscriptions {
+			subs = append(subs, types.Subscription{
+				SubscriptionArn: aws.String(sub.arn),
+				TopicArn:        aws.String(sub.topicArn),
+				Protocol:        aws.String(sub.protocol),
+				Endpoint:        aws.String(sub.endpoint),
+				Owner:           aws.String(s.AccountID),
+			})
+		}
+	}
+
+	sort.Slice(subs, func(i, j int) bool {
+		return *subs[i].SubscriptionArn < *subs[j].SubscriptionArn
+	})
+
+	return subs
+}
+
+// Publish records a message sent to a topic, a target ARN, or a phone number.
+// Like Amazon SNS, it rejects a message whose body and attributes add up to more than 256 KiB.
+func (s *Service) Publish(ctx context.Context,
+	params *sns.PublishInput,
+	optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	targets := 0
+	for _, target := range []*string{params.TopicArn, params.TargetArn, params.PhoneNumber} {
+		if aws.ToString(target) != "" {
+			targets++
+		}
+	}
+
+	if targets != 1 {
+		return nil, errInvalidParameter("Specify exactly one of TopicArn, TargetArn, or PhoneNumber")
+	}
+
+	if aws.ToString(params.Message) == "" {
+		return nil, errInvalidParameter("Empty message")
+	}
+
+	size := len(*params.Message)
+	for name, v := range params.MessageAttributes {
+		size += len(name) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	if size > maxMessageSize {
+		return nil, errInvalidParameter("Message too long")
+	}
+
+	err := checkMessageAttributes(params.MessageAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.MessageStructure != nil {
+		if *params.MessageStructure != "json" {
+			return nil, errInvalidParameter("MessageStructure: Invalid value [" + *params.MessageStructure + "]. Must be json.")
+		}
+
+		_, err := messageBodies(*params.Message)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if params.PhoneNumber != nil && !validPhoneNumber(*params.PhoneNumber) {
+		return nil, errInvalidParameter("PhoneNumber Reason: " + *params.PhoneNumber + " is not valid to publish to")
+	}
+
+	// A target ARN is either a topic or a mobile platform endpoint
+	var t *topic
+	switch {
+	case params.TopicArn != nil:
+		t, err = s.lookupTopic(params.TopicArn)
+	case strings.HasPrefix(aws.ToString(params.TargetArn), "arn:aws:sns:") && !strings.Contains(*params.TargetArn, ":endpoint/"):
+		t, err = s.lookupTopic(params.TargetArn)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var groupID, dedupID string
+	if t != nil {
+		groupID, dedupID, err = fifoIDs(t, *params.Message, params.MessageGroupId, params.MessageDeduplicationId)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.fifo() {
+			if p, ok := t.duplicate(dedupID, s.Now()); ok {
+				return &sns.PublishOutput{MessageId: aws.String(p.MessageID), SequenceNumber: aws.String(p.SequenceNumber)}, nil
+			}
+		}
+	}
+
+	p := Published{
+		MessageID:         s.newID(),
+		Time:              s.Now(),
+		TopicArn:          aws.ToString(params.TopicArn),
+		TargetArn:         aws.ToString(params.TargetArn),
+		PhoneNumber:       aws.ToString(params.PhoneNumber),
+		Subject:           aws.ToString(params.Subject),
+		Message:           *params.Message,
+		MessageStructure:  aws.ToString(params.MessageStructure),
+		MessageAttributes: params.MessageAttributes,
+		MessageGroupID:    groupID,
+		DeduplicationID:   dedupID,
+	}
+
+	output := &sns.PublishOutput{MessageId: aws.String(p.MessageID)}
+
+	if t != nil {
+		if t.fifo() {
+			p.SequenceNumber = t.nextSequenceNumber()
+			output.SequenceNumber = aws.String(p.SequenceNumber)
+			t.deduplication[dedupID] = p
+		}
+
+		p.Delivered = s.deliver(t, p)
+	}
+
+	s.published = append(s.published, p)
+
+	return output, nil
+}
+
+// validPhoneNumber reports whether number is in E.164 format, such as +15555550100.
+func validPhoneNumber(number string) bool {
+	if len(number) < 2 || len(number) > 16 || number[0] != '+' {
+		return false
+	}
+
+	for _, c := range number[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Published returns the messages published so far, oldest first.
+func (s *Service) Published() []Published {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Published(nil), s.published...)
+}
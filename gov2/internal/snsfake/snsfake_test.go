@@ -0,0 +1,381 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package snsfake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+func TestTopicsAndSubscriptions(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	topic, err := s.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("doc-example-topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := s.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("doc-example-topic")})
+	if err != nil || *again.TopicArn != *topic.TopicArn {
+		t.Errorf("got %v, %v, want the same topic", aws.ToString(again.TopicArn), err)
+	}
+
+	sub, err := s.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn: topic.TopicArn,
+		Protocol: aws.String("sqs"),
+		Endpoint: aws.String("arn:aws:sqs:us-west-2:123456789012:doc-example-queue"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := s.ListSubscriptions(ctx, &sns.ListSubscriptionsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subs.Subscriptions) != 1 || *subs.Subscriptions[0].SubscriptionArn != *sub.SubscriptionArn {
+		t.Errorf("got %v, want the new subscription", subs.Subscriptions)
+	}
+
+	_, err = s.DeleteTopic(ctx, &sns.DeleteTopicInput{TopicArn: topic.TopicArn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Unsubscribe(ctx, &sns.UnsubscribeInput{SubscriptionArn: sub.SubscriptionArn})
+	var notFound *types.NotFoundException
+	if !errors.As(err, &notFound) {
+		t.Errorf("got %v, want NotFoundException after deleting the topic", err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	_, err := s.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(s.TopicARN("missing")),
+		Message:  aws.String("Hello"),
+	})
+	var notFound *types.NotFoundException
+	if !errors.As(err, &notFound) {
+		t.Errorf("got %v, want NotFoundException", err)
+	}
+
+	_, err = s.Publish(ctx, &sns.PublishInput{
+		PhoneNumber: aws.String("+15555550100"),
+		Message:     aws.String("Hello"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := s.Published()
+	if len(published) != 1 || published[0].PhoneNumber != "+15555550100" {
+		t.Errorf("got %v, want one SMS message", published)
+	}
+
+	_, err = s.Publish(ctx, &sns.PublishInput{
+		PhoneNumber: aws.String("+15555550100"),
+		Message:     aws.String(strings.Repeat("x", maxMessageSize+1)),
+	})
+	var invalid *types.InvalidParameterException
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException for a message over 256 KiB", err)
+	}
+}
+
+func TestFilterPolicy(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	var deliveries []Delivery
+	s.Deliver = func(d Delivery) { deliveries = append(deliveries, d) }
+
+	topic, err := s.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("orders")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:   topic.TopicArn,
+		Protocol:   aws.String("sqs"),
+		Endpoint:   aws.String("arn:aws:sqs:us-west-2:123456789012:invalid"),
+		Attributes: map[string]string{"FilterPolicy": `{"store":"example_corp"}`},
+	})
+	var invalid *types.InvalidParameterException
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException for a filter policy that isn't an array", err)
+	}
+
+	placed, err := s.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn: topic.TopicArn,
+		Protocol: aws.String("sqs"),
+		Endpoint: aws.String("arn:aws:sqs:us-west-2:123456789012:placed"),
+		Attributes: map[string]string{
+			"FilterPolicy":       `{"event":["order_placed"]}`,
+			"RawMessageDelivery": "true",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn: topic.TopicArn,
+		Protocol: aws.String("sqs"),
+		Endpoint: aws.String("arn:aws:sqs:us-west-2:123456789012:all"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.SetSubscriptionAttributes(ctx, &sns.SetSubscriptionAttributesInput{
+		SubscriptionArn: all.SubscriptionArn,
+		AttributeName:   aws.String("FilterPolicy"),
+		AttributeValue:  aws.String(`{"event":[{"prefix":""}]}`),
+	})
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException for an empty prefix", err)
+	}
+
+	for _, event := range []string{"order_placed", "order_cancelled"} {
+		_, err = s.Publish(ctx, &sns.PublishInput{
+			TopicArn: topic.TopicArn,
+			Message:  aws.String(event),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"event": {DataType: aws.String("String"), StringValue: aws.String(event)},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	published := s.Published()
+	if len(published[0].Delivered) != 2 || len(published[1].Delivered) != 1 || published[1].Delivered[0] != *all.SubscriptionArn {
+		t.Errorf("got deliveries %v and %v", published[0].Delivered, published[1].Delivered)
+	}
+
+	if len(deliveries) != 3 {
+		t.Fatalf("got %d deliveries, want 3", len(deliveries))
+	}
+
+	for _, d := range deliveries {
+		if d.SubscriptionArn == *placed.SubscriptionArn {
+			if d.Message != "order_placed" || aws.ToString(d.MessageAttributes["event"].StringValue) != "order_placed" {
+				t.Errorf("got raw delivery %+v", d)
+			}
+
+			continue
+		}
+
+		if !strings.Contains(d.Message, `"Type":"Notification"`) || d.MessageAttributes != nil {
+			t.Errorf("got notification %+v", d)
+		}
+	}
+}
+
+func TestPublishValidation(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	topic, err := s.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("alerts")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []*sns.PublishInput{
+		{TopicArn: topic.TopicArn, Message: aws.String("Hello"), MessageAttributes: map[string]types.MessageAttributeValue{
+			"count": {DataType: aws.String("Number"), StringValue: aws.String("three")},
+		}},
+		{TopicArn: topic.TopicArn, Message: aws.String("Hello"), MessageAttributes: map[string]types.MessageAttributeValue{
+			"tags": {DataType: aws.String("String.Array"), StringValue: aws.String(`"critical"`)},
+		}},
+		{TopicArn: topic.TopicArn, Message: aws.String("Hello"), MessageAttributes: map[string]types.MessageAttributeValue{
+			"blob": {DataType: aws.String("Blob"), BinaryValue: []byte{1}},
+		}},
+		{TopicArn: topic.TopicArn, Message: aws.String(`{"email":"Hello"}`), MessageStructure: aws.String("json")},
+		{TopicArn: topic.TopicArn, Message: aws.String("Hello"), MessageStructure: aws.String("json")},
+		{TopicArn: topic.TopicArn, Message: aws.String("Hello"), MessageGroupId: aws.String("alerts")},
+		{PhoneNumber: aws.String("555-0100"), Message: aws.String("Hello")},
+	}
+
+	for _, input := range invalid {
+		_, err := s.Publish(ctx, input)
+		var e *types.InvalidParameterException
+		if !errors.As(err, &e) {
+			t.Errorf("got %v, want InvalidParameterException for %+v", err, input)
+		}
+	}
+
+	_, err = s.Publish(ctx, &sns.PublishInput{
+		TargetArn: aws.String("arn:aws:sns:us-west-2:123456789012:endpoint/GCM/doc-example-app/0b5f3e9d-1c2a-4e8b-9d7f-6a5c4b3e2d1f"),
+		Message:   aws.String("Hello"),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"severity": {DataType: aws.String("String"), StringValue: aws.String("critical")},
+			"count":    {DataType: aws.String("Number"), StringValue: aws.String("3")},
+			"tags":     {DataType: aws.String("String.Array"), StringValue: aws.String(`["paging", 2, true, null]`)},
+			"blob":     {DataType: aws.String("Binary.gzip"), BinaryValue: []byte{1}},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageStructure(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	var deliveries []Delivery
+	s.Deliver = func(d Delivery) { deliveries = append(deliveries, d) }
+
+	topic, err := s.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("alerts")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range []struct{ protocol, endpoint string }{
+		{"sqs", "arn:aws:sqs:us-west-2:123456789012:alerts"},
+		{"email", "someone@example.com"},
+		{"lambda", "arn:aws:lambda:us-west-2:123456789012:function:alerts"},
+	} {
+		_, err := s.Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn:   topic.TopicArn,
+			Protocol:   aws.String(sub.protocol),
+			Endpoint:   aws.String(sub.endpoint),
+			Attributes: map[string]string{"RawMessageDelivery": strconv.FormatBool(sub.protocol == "sqs")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = s.Publish(ctx, &sns.PublishInput{
+		TopicArn:         topic.TopicArn,
+		Message:          aws.String(`{"default":"Disk full","sqs":"{\"disk\":\"full\"}","email":"The disk is full."}`),
+		MessageStructure: aws.String("json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"sqs": `{"disk":"full"}`, "email": "The disk is full.", "lambda": "Disk full"}
+	for _, d := range deliveries {
+		message := d.Message
+		if d.Protocol != "sqs" {
+			var n struct{ Message string }
+			if err := json.Unmarshal([]byte(d.Message), &n); err != nil {
+				t.Fatal(err)
+			}
+
+			message = n.Message
+		}
+
+		if message != want[d.Protocol] {
+			t.Errorf("%s: got %q, want %q", d.Protocol, message, want[d.Protocol])
+		}
+	}
+}
+
+func TestFifoTopic(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	now := time.Date(2020, 12, 1, 9, 15, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+
+	var invalid *types.InvalidParameterException
+
+	_, err := s.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("alerts.fifo")})
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException for a .fifo name without FifoTopic", err)
+	}
+
+	_, err = s.CreateTopic(ctx, &sns.CreateTopicInput{
+		Name:       aws.String("alerts"),
+		Attributes: map[string]string{"FifoTopic": "true"},
+	})
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException for a FIFO topic without .fifo", err)
+	}
+
+	topic, err := s.CreateTopic(ctx, &sns.CreateTopicInput{
+		Name:       aws.String("alerts.fifo"),
+		Attributes: map[string]string{"FifoTopic": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Publish(ctx, &sns.PublishInput{TopicArn: topic.TopicArn, Message: aws.String("Hello")})
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException without a message group ID", err)
+	}
+
+	_, err = s.Publish(ctx, &sns.PublishInput{TopicArn: topic.TopicArn, Message: aws.String("Hello"), MessageGroupId: aws.String("disk")})
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException without a deduplication ID", err)
+	}
+
+	publish := func(dedupID string) *sns.PublishOutput {
+		output, err := s.Publish(ctx, &sns.PublishInput{
+			TopicArn:               topic.TopicArn,
+			Message:                aws.String("Hello"),
+			MessageGroupId:         aws.String("disk"),
+			MessageDeduplicationId: aws.String(dedupID),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return output
+	}
+
+	first := publish("1")
+	second := publish("2")
+	duplicate := publish("1")
+
+	if *first.SequenceNumber >= *second.SequenceNumber || *duplicate.MessageId != *first.MessageId {
+		t.Errorf("got %v, %v, and %v", *first.SequenceNumber, *second.SequenceNumber, *duplicate.MessageId)
+	}
+
+	now = now.Add(dedupWindow)
+	if later := publish("1"); *later.MessageId == *first.MessageId {
+		t.Error("the deduplication ID was remembered after five minutes")
+	}
+
+	if n := len(s.Published()); n != 3 {
+		t.Errorf("got %d published messages, want 3", n)
+	}
+
+	_, err = s.SetTopicAttributes(ctx, &sns.SetTopicAttributesInput{
+		TopicArn:       topic.TopicArn,
+		AttributeName:  aws.String("ContentBasedDeduplication"),
+		AttributeValue: aws.String("true"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Publish(ctx, &sns.PublishInput{TopicArn: topic.TopicArn, Message: aws.String("Hello"), MessageGroupId: aws.String("disk")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := s.Published(); p[3].DeduplicationID == "" || p[3].MessageGroupID != "disk" {
+		t.Errorf("got %+v, want the hash of the message as its deduplication ID", p[3])
+	}
+}
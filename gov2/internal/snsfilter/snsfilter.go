@@ -0,0 +1,417 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package snsfilter parses Amazon Simple Notification Service (Amazon SNS) subscription filter policies
+// and evaluates them against message attributes offline, so examples can test their routing rules.
+//
+// A message matches a policy if every key in the policy matches the message attribute of the same name,
+// and a key matches if any of its values does. A value can be a string or number to match exactly,
+// or an object with one of the operators prefix, suffix, equals-ignore-case, anything-but, numeric, or exists.
+// String attributes match strings, Number attributes match numbers,
+// and String.Array attributes match if any of their elements does. Binary attributes only match exists.
+// Policies that apply to the message body, with the FilterPolicyScope attribute, are not modeled.
+package snsfilter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// The limits that Amazon SNS places on a filter policy
+const (
+	maxKeys         = 5
+	maxCombinations = 150
+)
+
+// Policy is a parsed filter policy.
+type Policy struct {
+	keys map[string][]matcher
+}
+
+// matcher tests one value of a policy key against an attribute.
+// The attribute is nil when the message doesn't have it.
+type matcher func(a *attribute) bool
+
+// attribute is a message attribute, split into the values a policy can match.
+type attribute struct {
+	strings []string
+	numbers []float64
+}
+
+// Parse parses a filter policy.
+func Parse(document []byte) (*Policy, error) {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(document, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("filter policy: %w", err)
+	}
+
+	if len(raw) == 0 {
+		return nil, errors.New("filter policy: no keys")
+	}
+
+	if len(raw) > maxKeys {
+		return nil, fmt.Errorf("filter policy: %d keys, more than the limit of %d", len(raw), maxKeys)
+	}
+
+	p := &Policy{keys: map[string][]matcher{}}
+	combinations := 1
+
+	for key, data := range raw {
+		var values []json.RawMessage
+		if json.Unmarshal(data, &values) != nil {
+			return nil, fmt.Errorf("filter policy: %s: value must be an array", key)
+		}
+
+		if len(values) == 0 {
+			return nil, fmt.Errorf("filter policy: %s: empty array", key)
+		}
+
+		for _, v := range values {
+			m, err := parseValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("filter policy: %s: %w", key, err)
+			}
+
+			p.keys[key] = append(p.keys[key], m)
+		}
+
+		combinations *= len(values)
+	}
+
+	if combinations > maxCombinations {
+		return nil, fmt.Errorf("filter policy: %d combinations of values, more than the limit of %d", combinations, maxCombinations)
+	}
+
+	return p, nil
+}
+
+// MustParse is like Parse but panics if the policy can't be parsed.
+// It simplifies tests of fixed policies.
+func MustParse(document string) *Policy {
+	p, err := Parse([]byte(document))
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// decode decodes one JSON value, keeping numbers as json.Number.
+func decode(data json.RawMessage) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+	err := d.Decode(&v)
+
+	return v, err
+}
+
+// parseValue parses one value of a policy key.
+func parseValue(data json.RawMessage) (matcher, error) {
+	v, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case string:
+		return func(a *attribute) bool { return a != nil && a.hasString(func(s string) bool { return s == v }) }, nil
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(a *attribute) bool { return a != nil && a.hasNumber(func(f float64) bool { return f == n }) }, nil
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return nil, errors.New("an operator object must have exactly one operator")
+		}
+
+		for op, operand := range v {
+			return parseOperator(op, operand)
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported value %s", data)
+}
+
+// parseOperator parses an operator object, such as {"prefix": "order-"}.
+func parseOperator(op string, operand interface{}) (matcher, error) {
+	switch op {
+	case "exists":
+		want, ok := operand.(bool)
+		if !ok {
+			return nil, errors.New("exists must be true or false")
+		}
+
+		return func(a *attribute) bool { return (a != nil) == want }, nil
+	case "prefix", "suffix", "equals-ignore-case":
+		s, ok := operand.(string)
+		if !ok || s == "" && op != "equals-ignore-case" {
+			return nil, fmt.Errorf("%s must be a non-empty string", op)
+		}
+
+		test := stringTest(op, s)
+		return func(a *attribute) bool { return a != nil && a.hasString(test) }, nil
+	case "anything-but":
+		return parseAnythingBut(operand)
+	case "numeric":
+		list, ok := operand.([]interface{})
+		if !ok {
+			return nil, errors.New("numeric must be an array")
+		}
+
+		test, err := numericTest(list)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(a *attribute) bool { return a != nil && a.hasNumber(test) }, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized operator %s", op)
+}
+
+// stringTest returns the comparison for a prefix, suffix, or equals-ignore-case operator.
+func stringTest(op, operand string) func(string) bool {
+	switch op {
+	case "prefix":
+		return func(s string) bool { return strings.HasPrefix(s, operand) }
+	case "suffix":
+		return func(s string) bool { return strings.HasSuffix(s, operand) }
+	}
+
+	return func(s string) bool { return strings.EqualFold(s, operand) }
+}
+
+// parseAnythingBut parses the operand of anything-but: a string, a number, a list of either,
+// or a prefix object. The attribute must be present, and none of its values can match.
+func parseAnythingBut(operand interface{}) (matcher, error) {
+	var excluded func(a *attribute) bool
+
+	switch v := operand.(type) {
+	case string, json.Number:
+		return parseAnythingBut([]interface{}{v})
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, errors.New("anything-but must not be empty")
+		}
+
+		var strs []string
+		var nums []float64
+
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				strs = append(strs, item)
+			case json.Number:
+				n, err := item.Float64()
+				if err != nil {
+					return nil, err
+				}
+
+				nums = append(nums, n)
+			default:
+				return nil, errors.New("anything-but can only list strings and numbers")
+			}
+		}
+
+		excluded = func(a *attribute) bool {
+			return a.hasString(func(s string) bool { return containsString(strs, s) }) ||
+				a.hasNumber(func(f float64) bool { return containsNumber(nums, f) })
+		}
+	case map[string]interface{}:
+		prefix, ok := v["prefix"].(string)
+		if len(v) != 1 || !ok || prefix == "" {
+			return nil, errors.New("anything-but only supports a prefix object")
+		}
+
+		excluded = func(a *attribute) bool {
+			return a.hasString(func(s string) bool { return strings.HasPrefix(s, prefix) })
+		}
+	default:
+		return nil, errors.New("unsupported anything-but operand")
+	}
+
+	return func(a *attribute) bool { return a != nil && len(a.strings)+len(a.numbers) > 0 && !excluded(a) }, nil
+}
+
+// numericTest parses the operand of numeric, such as [">", 0, "<=", 5] or ["=", 3].
+func numericTest(list []interface{}) (func(float64) bool, error) {
+	if len(list) != 2 && len(list) != 4 {
+		return nil, errors.New("numeric must have one or two comparisons")
+	}
+
+	var tests []func(float64) bool
+	var lower, upper bool
+
+	for i := 0; i < len(list); i += 2 {
+		op, ok := list[i].(string)
+		num, isNum := list[i+1].(json.Number)
+		if !ok || !isNum {
+			return nil, errors.New("numeric comparisons must be an operator followed by a number")
+		}
+
+		n, err := num.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "=":
+			if len(list) != 2 {
+				return nil, errors.New("numeric = can't be combined with another comparison")
+			}
+
+			tests = append(tests, func(f float64) bool { return f == n })
+		case ">", ">=":
+			if lower {
+				return nil, errors.New("numeric range has two lower bounds")
+			}
+
+			lower = true
+
+			if op == ">" {
+				tests = append(tests, func(f float64) bool { return f > n })
+			} else {
+				tests = append(tests, func(f float64) bool { return f >= n })
+			}
+		case "<", "<=":
+			if upper {
+				return nil, errors.New("numeric range has two upper bounds")
+			}
+
+			upper = true
+
+			if op == "<" {
+				tests = append(tests, func(f float64) bool { return f < n })
+			} else {
+				tests = append(tests, func(f float64) bool { return f <= n })
+			}
+		default:
+			return nil, fmt.Errorf("unrecognized numeric operator %s", op)
+		}
+	}
+
+	return func(f float64) bool {
+		for _, test := range tests {
+			if !test(f) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsNumber(list []float64, f float64) bool {
+	for _, item := range list {
+		if item == f {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *attribute) hasString(test func(string) bool) bool {
+	for _, s := range a.strings {
+		if test(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *attribute) hasNumber(test func(float64) bool) bool {
+	for _, f := range a.numbers {
+		if test(f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newAttribute splits a message attribute into the values a policy can match.
+// A String.Array that isn't a JSON array is treated as a String, as Amazon SNS does.
+func newAttribute(v types.MessageAttributeValue) *attribute {
+	a := &attribute{}
+	value := aws.ToString(v.StringValue)
+
+	switch dataType := aws.ToString(v.DataType); {
+	case strings.HasPrefix(dataType, "Number"):
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			a.numbers = append(a.numbers, f)
+		}
+	case dataType == "String.Array":
+		var items []interface{}
+		d := json.NewDecoder(strings.NewReader(value))
+		d.UseNumber()
+
+		if d.Decode(&items) != nil {
+			a.strings = append(a.strings, value)
+			break
+		}
+
+		for _, item := range items {
+			switch item := item.(type) {
+			case string:
+				a.strings = append(a.strings, item)
+			case json.Number:
+				if f, err := item.Float64(); err == nil {
+					a.numbers = append(a.numbers, f)
+				}
+			}
+		}
+	case strings.HasPrefix(dataType, "String"):
+		a.strings = append(a.strings, value)
+	}
+
+	return a
+}
+
+// Match reports whether a message with the given attributes matches the policy.
+func (p *Policy) Match(attributes map[string]types.MessageAttributeValue) bool {
+	for key, matchers := range p.keys {
+		var a *attribute
+		if v, ok := attributes[key]; ok {
+			a = newAttribute(v)
+		}
+
+		matched := false
+		for _, m := range matchers {
+			if m(a) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,141 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package snsfilter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+func str(v string) types.MessageAttributeValue {
+	return types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+}
+
+func num(v string) types.MessageAttributeValue {
+	return types.MessageAttributeValue{DataType: aws.String("Number"), StringValue: aws.String(v)}
+}
+
+func array(v string) types.MessageAttributeValue {
+	return types.MessageAttributeValue{DataType: aws.String("String.Array"), StringValue: aws.String(v)}
+}
+
+func TestParse(t *testing.T) {
+	tooManyValues := make([]string, 151)
+	for i := range tooManyValues {
+		tooManyValues[i] = fmt.Sprintf(`"v%d"`, i)
+	}
+
+	invalid := []string{
+		``,
+		`[]`,
+		`{}`,
+		`{"store":"example_corp"}`,
+		`{"store":[]}`,
+		`{"store":[true]}`,
+		`{"store":[{"prefix":""}]}`,
+		`{"store":[{"prefix":"a","suffix":"b"}]}`,
+		`{"store":[{"wildcard":"a*"}]}`,
+		`{"price":[{"numeric":[">",0,">",5]}]}`,
+		`{"price":[{"numeric":["=",0,"<",5]}]}`,
+		`{"price":[{"numeric":["~",0]}]}`,
+		`{"price":[{"numeric":[0]}]}`,
+		`{"event":[{"anything-but":[]}]}`,
+		`{"event":[{"anything-but":{"suffix":"x"}}]}`,
+		`{"event":[{"exists":"yes"}]}`,
+		`{"a":["1"],"b":["1"],"c":["1"],"d":["1"],"e":["1"],"f":["1"]}`,
+		`{"a":[` + strings.Join(tooManyValues, ",") + `]}`,
+	}
+
+	for _, doc := range invalid {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", doc)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		policy     string
+		attributes map[string]types.MessageAttributeValue
+		want       bool
+	}{
+		// Exact values, and OR within a key
+		{`{"store":["example_corp"]}`, map[string]types.MessageAttributeValue{"store": str("example_corp")}, true},
+		{`{"store":["example_corp","other_corp"]}`, map[string]types.MessageAttributeValue{"store": str("other_corp")}, true},
+		{`{"store":["example_corp"]}`, map[string]types.MessageAttributeValue{"store": str("Example_Corp")}, false},
+		{`{"store":["example_corp"]}`, map[string]types.MessageAttributeValue{}, false},
+
+		// AND across keys
+		{`{"store":["example_corp"],"event":["order_placed"]}`, map[string]types.MessageAttributeValue{"store": str("example_corp"), "event": str("order_placed")}, true},
+		{`{"store":["example_corp"],"event":["order_placed"]}`, map[string]types.MessageAttributeValue{"store": str("example_corp")}, false},
+
+		// Numbers match Number attributes, strings match String attributes
+		{`{"price":[100]}`, map[string]types.MessageAttributeValue{"price": num("100.0")}, true},
+		{`{"price":[100]}`, map[string]types.MessageAttributeValue{"price": str("100")}, false},
+		{`{"price":["100"]}`, map[string]types.MessageAttributeValue{"price": num("100")}, false},
+
+		// String.Array matches if any element does
+		{`{"customer_interests":["rugby"]}`, map[string]types.MessageAttributeValue{"customer_interests": array(`["soccer","rugby"]`)}, true},
+		{`{"customer_interests":["rugby"]}`, map[string]types.MessageAttributeValue{"customer_interests": array(`["soccer"]`)}, false},
+		{`{"sizes":[{"numeric":[">",10]}]}`, map[string]types.MessageAttributeValue{"sizes": array(`[5, 12]`)}, true},
+
+		// String operators
+		{`{"event":[{"prefix":"order-"}]}`, map[string]types.MessageAttributeValue{"event": str("order-placed")}, true},
+		{`{"event":[{"prefix":"order-"}]}`, map[string]types.MessageAttributeValue{"event": str("refund-issued")}, false},
+		{`{"file":[{"suffix":".png"}]}`, map[string]types.MessageAttributeValue{"file": str("image.png")}, true},
+		{`{"store":[{"equals-ignore-case":"example_corp"}]}`, map[string]types.MessageAttributeValue{"store": str("Example_Corp")}, true},
+
+		// anything-but needs the attribute to be present
+		{`{"event":[{"anything-but":"order_cancelled"}]}`, map[string]types.MessageAttributeValue{"event": str("order_placed")}, true},
+		{`{"event":[{"anything-but":["order_cancelled","order_refunded"]}]}`, map[string]types.MessageAttributeValue{"event": str("order_refunded")}, false},
+		{`{"event":[{"anything-but":"order_cancelled"}]}`, map[string]types.MessageAttributeValue{}, false},
+		{`{"price":[{"anything-but":[100, 500]}]}`, map[string]types.MessageAttributeValue{"price": num("300")}, true},
+		{`{"event":[{"anything-but":{"prefix":"order-"}}]}`, map[string]types.MessageAttributeValue{"event": str("order-placed")}, false},
+
+		// Numeric ranges
+		{`{"price":[{"numeric":[">",0,"<=",150]}]}`, map[string]types.MessageAttributeValue{"price": num("150")}, true},
+		{`{"price":[{"numeric":[">",0,"<=",150]}]}`, map[string]types.MessageAttributeValue{"price": num("0")}, false},
+		{`{"price":[{"numeric":["=",3.5]}]}`, map[string]types.MessageAttributeValue{"price": num("3.50")}, true},
+		{`{"price":[{"numeric":["<",10]}]}`, map[string]types.MessageAttributeValue{"price": str("5")}, false},
+
+		// exists
+		{`{"store":[{"exists":true}]}`, map[string]types.MessageAttributeValue{"store": str("")}, true},
+		{`{"store":[{"exists":false}]}`, map[string]types.MessageAttributeValue{"store": str("example_corp")}, false},
+		{`{"store":[{"exists":false}]}`, map[string]types.MessageAttributeValue{}, true},
+		{`{"store":[{"exists":false},"example_corp"]}`, map[string]types.MessageAttributeValue{"store": str("example_corp")}, true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse([]byte(test.policy))
+		if err != nil {
+			t.Errorf("Parse(%s): %v", test.policy, err)
+			continue
+		}
+
+		if got := p.Match(test.attributes); got != test.want {
+			t.Errorf("%s with %v: got %t, want %t", test.policy, test.attributes, got, test.want)
+		}
+	}
+}
+
+func TestBinaryAttribute(t *testing.T) {
+	attributes := map[string]types.MessageAttributeValue{
+		"data": {DataType: aws.String("Binary"), BinaryValue: []byte("example_corp")},
+	}
+
+	if MustParse(`{"data":["example_corp"]}`).Match(attributes) {
+		t.Error("A Binary attribute matched a string")
+	}
+
+	if MustParse(`{"data":[{"anything-but":"x"}]}`).Match(attributes) {
+		t.Error("A Binary attribute matched anything-but")
+	}
+
+	if !MustParse(`{"data":[{"exists":true}]}`).Match(attributes) {
+		t.Error("A Binary attribute didn't match exists")
+	}
+}
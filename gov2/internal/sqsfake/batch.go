@@ -0,0 +1,219 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package sqsfake
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// maxBatchEntries is the most entries a batch request can have.
+const maxBatchEntries = 10
+
+// maxBatchSize is the most bytes the messages of a SendMessageBatch request can have together.
+const maxBatchSize = 262144
+
+var validBatchEntryID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,80}$`)
+
+// checkBatchIDs validates the number and IDs of the entries of a batch request.
+func checkBatchIDs(ids []*string) error {
+	if len(ids) == 0 {
+		return &types.EmptyBatchRequest{Message: aws.String("There should be at least one entry in the request.")}
+	}
+
+	if len(ids) > maxBatchEntries {
+		return &types.TooManyEntriesInBatchRequest{Message: aws.String("Maximum number of entries per request are " + strconv.Itoa(maxBatchEntries) + ". You have sent " + strconv.Itoa(len(ids)) + ".")}
+	}
+
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if id == nil || !validBatchEntryID.MatchString(*id) {
+			return &types.InvalidBatchEntryId{Message: aws.String("A batch entry id can only contain alphanumeric characters, hyphens and underscores. It can be at most 80 letters long.")}
+		}
+
+		if seen[*id] {
+			return &types.BatchEntryIdsNotDistinct{Message: aws.String("Id " + *id + " repeated.")}
+		}
+
+		seen[*id] = true
+	}
+
+	return nil
+}
+
+// failedEntry reports an error from a single entry of a batch request.
+func failedEntry(id *string, err error) types.BatchResultErrorEntry {
+	entry := types.BatchResultErrorEntry{Id: id, Code: aws.String("InternalError"), Message: aws.String(err.Error())}
+
+	if apiErr, ok := err.(smithy.APIError); ok {
+		entry.Code = aws.String(apiErr.ErrorCode())
+		entry.Message = aws.String(apiErr.ErrorMessage())
+		entry.SenderFault = apiErr.ErrorFault() == smithy.FaultClient
+	}
+
+	return entry
+}
+
+// SendMessageBatch adds up to 10 messages to a queue.
+// The request fails if the messages add up to more than 256 KiB;
+// otherwise each entry succeeds or fails on its own.
+func (s *Service) SendMessageBatch(ctx context.Context,
+	params *sqs.SendMessageBatchInput,
+	optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(params.Entries))
+	size := 0
+
+	for i, e := range params.Entries {
+		ids[i] = e.Id
+		size += len(aws.ToString(e.MessageBody)) + attributesSize(e.MessageAttributes)
+	}
+
+	err = checkBatchIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > maxBatchSize {
+		return nil, &types.BatchRequestTooLong{Message: aws.String("Batch requests cannot be longer than " + strconv.Itoa(maxBatchSize) + " bytes. You have sent " + strconv.Itoa(size) + " bytes.")}
+	}
+
+	output := &sqs.SendMessageBatchOutput{}
+
+	for _, e := range params.Entries {
+		if e.MessageBody == nil || *e.MessageBody == "" {
+			output.Failed = append(output.Failed, failedEntry(e.Id, errMissingParameter("MessageBody")))
+			continue
+		}
+
+		m, err := s.enqueue(q, *e.MessageBody, e.MessageAttributes, e.DelaySeconds, e.MessageGroupId, e.MessageDeduplicationId)
+		if err != nil {
+			output.Failed = append(output.Failed, failedEntry(e.Id, err))
+			continue
+		}
+
+		result := types.SendMessageBatchResultEntry{
+			Id:               e.Id,
+			MessageId:        aws.String(m.id),
+			MD5OfMessageBody: aws.String(m.md5OfBody),
+		}
+
+		if m.md5OfAttribute != "" {
+			result.MD5OfMessageAttributes = aws.String(m.md5OfAttribute)
+		}
+
+		if m.sequenceNumber != "" {
+			result.SequenceNumber = aws.String(m.sequenceNumber)
+		}
+
+		output.Successful = append(output.Successful, result)
+	}
+
+	return output, nil
+}
+
+// DeleteMessageBatch deletes up to 10 received messages.
+func (s *Service) DeleteMessageBatch(ctx context.Context,
+	params *sqs.DeleteMessageBatchInput,
+	optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(params.Entries))
+	for i, e := range params.Entries {
+		ids[i] = e.Id
+	}
+
+	err = checkBatchIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &sqs.DeleteMessageBatchOutput{}
+
+	for _, e := range params.Entries {
+		i, m, err := q.findInFlight(e.ReceiptHandle)
+		if err != nil {
+			output.Failed = append(output.Failed, failedEntry(e.Id, err))
+			continue
+		}
+
+		if m != nil {
+			q.messages = append(q.messages[:i:i], q.messages[i+1:]...)
+		}
+
+		output.Successful = append(output.Successful, types.DeleteMessageBatchResultEntry{Id: e.Id})
+	}
+
+	return output, nil
+}
+
+// ChangeMessageVisibilityBatch changes the visibility timeout of up to 10 received messages.
+func (s *Service) ChangeMessageVisibilityBatch(ctx context.Context,
+	params *sqs.ChangeMessageVisibilityBatchInput,
+	optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(params.Entries))
+	for i, e := range params.Entries {
+		ids[i] = e.Id
+	}
+
+	err = checkBatchIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &sqs.ChangeMessageVisibilityBatchOutput{}
+	now := s.Now()
+
+	for _, e := range params.Entries {
+		if e.VisibilityTimeout < 0 || e.VisibilityTimeout > 43200 {
+			output.Failed = append(output.Failed, failedEntry(e.Id, errInvalidParameter("Value "+strconv.Itoa(int(e.VisibilityTimeout))+" for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.")))
+			continue
+		}
+
+		_, m, err := q.findInFlight(e.ReceiptHandle)
+		if err != nil {
+			output.Failed = append(output.Failed, failedEntry(e.Id, err))
+			continue
+		}
+
+		if m == nil || m.receiptHandle != *e.ReceiptHandle || !now.Before(m.visibleAt) {
+			output.Failed = append(output.Failed, failedEntry(e.Id, &types.MessageNotInflight{}))
+			continue
+		}
+
+		m.visibleAt = now.Add(time.Duration(e.VisibilityTimeout) * time.Second)
+		output.Successful = append(output.Successful, types.ChangeMessageVisibilityBatchResultEntry{Id: e.Id})
+	}
+
+	s.notify()
+
+	return output, nil
+}
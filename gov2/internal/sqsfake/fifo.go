@@ -0,0 +1,125 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package sqsfake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fifoSuffix ends the name of every FIFO queue.
+const fifoSuffix = ".fifo"
+
+// dedupWindow is how long a FIFO queue remembers a deduplication ID.
+const dedupWindow = 5 * time.Minute
+
+// fifo reports whether q is a FIFO queue.
+func (q *queue) fifo() bool {
+	return q.attributes["FifoQueue"] == "true"
+}
+
+// errNotForQueueType is the error for a parameter that only the other kind of queue accepts.
+func errNotForQueueType(name, value string) error {
+	return errInvalidParameter("Value " + value + " for parameter " + name + " is invalid. Reason: The request include parameter that is not valid for this queue type.")
+}
+
+// validFifoID reports whether id is 1-128 printable ASCII characters, other than a space.
+func validFifoID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fifoIDs validates the FIFO parameters of a message sent to q.
+// For a FIFO queue it returns the message group ID and the deduplication ID,
+// which is the SHA-256 hash of the body if the queue has ContentBasedDeduplication
+// and the message has no MessageDeduplicationId.
+func fifoIDs(q *queue, body string, delaySeconds int32, groupID, dedupID *string) (string, string, error) {
+	if !q.fifo() {
+		if groupID != nil {
+			return "", "", errNotForQueueType("MessageGroupId", *groupID)
+		}
+
+		if dedupID != nil {
+			return "", "", errNotForQueueType("MessageDeduplicationId", *dedupID)
+		}
+
+		return "", "", nil
+	}
+
+	if delaySeconds != 0 {
+		return "", "", errNotForQueueType("DelaySeconds", strconv.Itoa(int(delaySeconds)))
+	}
+
+	if groupID == nil || *groupID == "" {
+		return "", "", errMissingParameter("MessageGroupId")
+	}
+
+	if !validFifoID(*groupID) {
+		return "", "", errInvalidParameter("Value " + *groupID + " for parameter MessageGroupId is invalid. Reason: MessageGroupId can only include alphanumeric and punctuation characters. 1 to 128 in length.")
+	}
+
+	if dedupID == nil {
+		if q.attributes["ContentBasedDeduplication"] != "true" {
+			return "", "", errInvalidParameter("The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+		}
+
+		sum := sha256.Sum256([]byte(body))
+
+		return *groupID, hex.EncodeToString(sum[:]), nil
+	}
+
+	if !validFifoID(*dedupID) {
+		return "", "", errInvalidParameter("Value " + *dedupID + " for parameter MessageDeduplicationId is invalid. Reason: MessageDeduplicationId can only include alphanumeric and punctuation characters. 1 to 128 in length.")
+	}
+
+	return *groupID, *dedupID, nil
+}
+
+// duplicate returns the message sent to q with the same deduplication ID within the
+// deduplication window, or nil. It forgets the IDs whose window has passed.
+func (q *queue) duplicate(dedupID string, now time.Time) *message {
+	for id, m := range q.deduplication {
+		if !now.Before(m.sent.Add(dedupWindow)) {
+			delete(q.deduplication, id)
+		}
+	}
+
+	return q.deduplication[dedupID]
+}
+
+// nextSequenceNumber returns the sequence number for the next message sent to q.
+func (q *queue) nextSequenceNumber() string {
+	q.sequence++
+	return fmt.Sprintf("%020d", q.sequence)
+}
+
+// checkFifoAttributes checks that a new queue's name and attributes agree on whether it is a FIFO queue.
+func checkFifoAttributes(name string, attributes map[string]string) error {
+	fifo := attributes["FifoQueue"] == "true"
+
+	if fifo != strings.HasSuffix(name, fifoSuffix) {
+		return errInvalidParameter("The name of a FIFO queue can only include alphanumeric characters, hyphens, or underscores, must end with .fifo suffix and be 1 to 80 in length.")
+	}
+
+	if _, ok := attributes["ContentBasedDeduplication"]; ok && !fifo {
+		return &types.InvalidAttributeName{Message: aws.String("Unknown Attribute ContentBasedDeduplication.")}
+	}
+
+	return nil
+}
@@ -0,0 +1,419 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package sqsfake
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// pollInterval is how often a long-polling receiver checks for messages whose visibility timeout has expired.
+const pollInterval = 20 * time.Millisecond
+
+// SendMessage adds a message to a queue.
+// The message is hidden for DelaySeconds, or the queue's DelaySeconds attribute if that is 0.
+// A FIFO queue accepts, but doesn't store, a message with the deduplication ID of a message sent in the last five minutes.
+func (s *Service) SendMessage(ctx context.Context,
+	params *sqs.SendMessageInput,
+	optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.MessageBody == nil || *params.MessageBody == "" {
+		return nil, errMissingParameter("MessageBody")
+	}
+
+	m, err := s.enqueue(q, *params.MessageBody, params.MessageAttributes, params.DelaySeconds, params.MessageGroupId, params.MessageDeduplicationId)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &sqs.SendMessageOutput{
+		MessageId:        aws.String(m.id),
+		MD5OfMessageBody: aws.String(m.md5OfBody),
+	}
+
+	if m.sequenceNumber != "" {
+		output.SequenceNumber = aws.String(m.sequenceNumber)
+	}
+
+	if m.md5OfAttribute != "" {
+		output.MD5OfMessageAttributes = aws.String(m.md5OfAttribute)
+	}
+
+	return output, nil
+}
+
+// enqueue validates and stores a new message. The caller must hold s.mu.
+// For a duplicate message in a FIFO queue, it returns the original message instead.
+func (s *Service) enqueue(q *queue, body string, attributes map[string]types.MessageAttributeValue, delaySeconds int32, groupID, dedupID *string) (*message, error) {
+	maxSize, _ := strconv.Atoi(q.attributes["MaximumMessageSize"])
+	if size := len(body) + attributesSize(attributes); size > maxSize {
+		return nil, errInvalidParameter("One or more parameters are invalid. Reason: Message must be shorter than " + strconv.Itoa(maxSize) + " bytes.")
+	}
+
+	for name, v := range attributes {
+		dataType := aws.ToString(v.DataType)
+		if !strings.HasPrefix(dataType, "String") && !strings.HasPrefix(dataType, "Number") && !strings.HasPrefix(dataType, "Binary") {
+			return nil, errInvalidParameter("The type of message (user) attribute '" + name + "' is invalid.")
+		}
+	}
+
+	if delaySeconds < 0 || delaySeconds > 900 {
+		return nil, errInvalidParameter("Value " + strconv.Itoa(int(delaySeconds)) + " for parameter DelaySeconds is invalid. Reason: must be between 0 and 900.")
+	}
+
+	group, dedup, err := fifoIDs(q, body, delaySeconds, groupID, dedupID)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := time.Duration(delaySeconds) * time.Second
+	if delaySeconds == 0 {
+		delay = q.seconds("DelaySeconds")
+	}
+
+	now := s.Now()
+
+	if q.fifo() {
+		if original := q.duplicate(dedup, now); original != nil {
+			return original, nil
+		}
+	}
+
+	m := &message{
+		id:             s.newID(),
+		body:           body,
+		attributes:     copyAttributes(attributes),
+		sent:           now,
+		visibleAt:      now.Add(delay),
+		md5OfBody:      md5Hex([]byte(body)),
+		md5OfAttribute: md5OfAttributes(attributes),
+	}
+
+	if q.fifo() {
+		m.groupID = group
+		m.dedupID = dedup
+		m.sequenceNumber = q.nextSequenceNumber()
+		q.deduplication[dedup] = m
+	}
+
+	q.messages = append(q.messages, m)
+	s.notify()
+
+	return m, nil
+}
+
+func copyAttributes(attributes map[string]types.MessageAttributeValue) map[string]types.MessageAttributeValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	c := make(map[string]types.MessageAttributeValue, len(attributes))
+	for k, v := range attributes {
+		c[k] = v
+	}
+
+	return c
+}
+
+// ReceiveMessage returns up to MaxNumberOfMessages visible messages and hides them
+// for the visibility timeout.
+// If no message is available it waits up to WaitTimeSeconds, or the queue's
+// ReceiveMessageWaitTimeSeconds attribute, for one to arrive.
+func (s *Service) ReceiveMessage(ctx context.Context,
+	params *sqs.ReceiveMessageInput,
+	optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	max := int(params.MaxNumberOfMessages)
+	if max == 0 {
+		max = 1
+	}
+
+	if max < 1 || max > 10 {
+		return nil, errInvalidParameter("Value " + strconv.Itoa(max) + " for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and 10, if provided.")
+	}
+
+	if params.WaitTimeSeconds < 0 || params.WaitTimeSeconds > 20 {
+		return nil, errInvalidParameter("Value " + strconv.Itoa(int(params.WaitTimeSeconds)) + " for parameter WaitTimeSeconds is invalid. Reason: Must be >= 0 and <= 20, if provided.")
+	}
+
+	var timeout <-chan time.Time
+
+	for {
+		s.mu.Lock()
+
+		q, err := s.lookupQueue(params.QueueUrl)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+
+		messages := s.receive(q, params, max)
+
+		if timeout == nil {
+			wait := time.Duration(params.WaitTimeSeconds) * time.Second
+			if params.WaitTimeSeconds == 0 {
+				wait = q.seconds("ReceiveMessageWaitTimeSeconds")
+			}
+
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(messages) > 0 {
+			return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return &sqs.ReceiveMessageOutput{}, nil
+		case <-changed:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// receive hides and returns up to max visible messages. The caller must hold s.mu.
+// Messages received more often than the queue's RedrivePolicy allows are moved
+// to the dead-letter queue instead.
+// In a FIFO queue, a message group is blocked from the first message that can't be returned,
+// such as one that is in flight, so that the group's messages are received in order.
+func (s *Service) receive(q *queue, params *sqs.ReceiveMessageInput, max int) []types.Message {
+	now := s.Now()
+
+	visibility := time.Duration(params.VisibilityTimeout) * time.Second
+	if params.VisibilityTimeout == 0 {
+		visibility = q.seconds("VisibilityTimeout")
+	}
+
+	dlq, maxReceiveCount := s.redriveTarget(q)
+
+	var messages []types.Message
+	kept := q.messages[:0]
+	blocked := map[string]bool{}
+
+	for _, m := range q.messages {
+		if q.fifo() && blocked[m.groupID] {
+			kept = append(kept, m)
+			continue
+		}
+
+		if len(messages) == max || now.Before(m.visibleAt) {
+			blocked[m.groupID] = true
+			kept = append(kept, m)
+			continue
+		}
+
+		if dlq != nil && m.receiveCount >= maxReceiveCount {
+			m.visibleAt = now
+			m.receiptHandle = ""
+			dlq.messages = append(dlq.messages, m)
+			continue
+		}
+
+		m.receiveCount++
+		if m.firstReceived.IsZero() {
+			m.firstReceived = now
+		}
+
+		m.visibleAt = now.Add(visibility)
+		m.receiptHandle = m.id + "#" + s.newID()
+
+		messages = append(messages, m.output(params.AttributeNames, params.MessageAttributeNames))
+		kept = append(kept, m)
+	}
+
+	q.messages = kept
+
+	return messages
+}
+
+// redriveTarget returns the dead-letter queue and maximum receive count from the
+// queue's RedrivePolicy, or nil if it has none. The caller must hold s.mu.
+func (s *Service) redriveTarget(q *queue) (*queue, int) {
+	if q.attributes["RedrivePolicy"] == "" {
+		return nil, 0
+	}
+
+	var policy struct {
+		DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+		MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+	}
+
+	if err := json.Unmarshal([]byte(q.attributes["RedrivePolicy"]), &policy); err != nil {
+		return nil, 0
+	}
+
+	count, err := policy.MaxReceiveCount.Int64()
+	if err != nil || count < 1 {
+		return nil, 0
+	}
+
+	dlq := s.queueByARN(policy.DeadLetterTargetArn)
+	if dlq == nil || dlq == q {
+		return nil, 0
+	}
+
+	return dlq, int(count)
+}
+
+// output returns the message as ReceiveMessage reports it,
+// with only the requested system and message attributes.
+func (m *message) output(attributeNames []types.QueueAttributeName, messageAttributeNames []string) types.Message {
+	msg := types.Message{
+		MessageId:     aws.String(m.id),
+		ReceiptHandle: aws.String(m.receiptHandle),
+		Body:          aws.String(m.body),
+		MD5OfBody:     aws.String(m.md5OfBody),
+	}
+
+	system := map[string]string{
+		"SenderId":                         "AIDAEXAMPLE",
+		"SentTimestamp":                    strconv.FormatInt(m.sent.UnixNano()/int64(time.Millisecond), 10),
+		"ApproximateReceiveCount":          strconv.Itoa(m.receiveCount),
+		"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.firstReceived.UnixNano()/int64(time.Millisecond), 10),
+	}
+
+	if m.sequenceNumber != "" {
+		system["MessageGroupId"] = m.groupID
+		system["MessageDeduplicationId"] = m.dedupID
+		system["SequenceNumber"] = m.sequenceNumber
+	}
+
+	for _, name := range attributeNames {
+		if name == types.QueueAttributeNameAll {
+			msg.Attributes = system
+			break
+		}
+
+		if v, ok := system[string(name)]; ok {
+			if msg.Attributes == nil {
+				msg.Attributes = map[string]string{}
+			}
+
+			msg.Attributes[string(name)] = v
+		}
+	}
+
+	for _, name := range messageAttributeNames {
+		for k, v := range m.attributes {
+			if name == "All" || name == ".*" || name == k || strings.HasSuffix(name, ".*") && strings.HasPrefix(k, strings.TrimSuffix(name, "*")) {
+				if msg.MessageAttributes == nil {
+					msg.MessageAttributes = map[string]types.MessageAttributeValue{}
+				}
+
+				msg.MessageAttributes[k] = v
+			}
+		}
+	}
+
+	if msg.MessageAttributes != nil {
+		msg.MD5OfMessageAttributes = aws.String(md5OfAttributes(msg.MessageAttributes))
+	}
+
+	return msg
+}
+
+// findInFlight returns the message with the given receipt handle. The caller must hold s.mu.
+func (q *queue) findInFlight(receiptHandle *string) (int, *message, error) {
+	if receiptHandle == nil || *receiptHandle == "" {
+		return 0, nil, errMissingParameter("ReceiptHandle")
+	}
+
+	for i, m := range q.messages {
+		if m.receiptHandle == *receiptHandle {
+			return i, m, nil
+		}
+	}
+
+	// A handle for a message that is gone or was received again is not an error for DeleteMessage
+	id := *receiptHandle
+	if n := strings.Index(id, "#"); n > 0 {
+		id = id[:n]
+	} else {
+		return 0, nil, &types.ReceiptHandleIsInvalid{Message: aws.String("The input receipt handle \"" + *receiptHandle + "\" is not a valid receipt handle.")}
+	}
+
+	for i, m := range q.messages {
+		if m.id == id {
+			return i, m, nil
+		}
+	}
+
+	return -1, nil, nil
+}
+
+// DeleteMessage deletes a received message.
+func (s *Service) DeleteMessage(ctx context.Context,
+	params *sqs.DeleteMessageInput,
+	optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	i, m, err := q.findInFlight(params.ReceiptHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	if m != nil {
+		q.messages = append(q.messages[:i:i], q.messages[i+1:]...)
+	}
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// ChangeMessageVisibility hides a received message for VisibilityTimeout more seconds,
+// or makes it visible again right away if VisibilityTimeout is 0.
+func (s *Service) ChangeMessageVisibility(ctx context.Context,
+	params *sqs.ChangeMessageVisibilityInput,
+	optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.VisibilityTimeout < 0 || params.VisibilityTimeout > 43200 {
+		return nil, errInvalidParameter("Value " + strconv.Itoa(int(params.VisibilityTimeout)) + " for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.")
+	}
+
+	_, m, err := q.findInFlight(params.ReceiptHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.Now()
+	if m == nil || m.receiptHandle != *params.ReceiptHandle || !now.Before(m.visibleAt) {
+		return nil, &types.MessageNotInflight{}
+	}
+
+	m.visibleAt = now.Add(time.Duration(params.VisibilityTimeout) * time.Second)
+	s.notify()
+
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
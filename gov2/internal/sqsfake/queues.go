@@ -0,0 +1,353 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package sqsfake
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// validQueueName reports whether name is 1-80 alphanumeric characters, hyphens, or underscores,
+// with an optional .fifo suffix.
+func validQueueName(name string) bool {
+	if name == "" || len(name) > 80 {
+		return false
+	}
+
+	for _, c := range strings.TrimSuffix(name, fifoSuffix) {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setAttributes validates and applies settable queue attributes. The caller must hold s.mu.
+func (s *Service) setAttributes(q *queue, attributes map[string]string) error {
+	for name, value := range attributes {
+		switch name {
+		case "DelaySeconds", "MaximumMessageSize", "MessageRetentionPeriod",
+			"ReceiveMessageWaitTimeSeconds", "VisibilityTimeout":
+			if _, err := strconv.Atoi(value); err != nil {
+				return errInvalidParameter("Invalid value for the parameter " + name + ".")
+			}
+		case "FifoQueue", "ContentBasedDeduplication":
+			if value != "true" && value != "false" {
+				return errInvalidParameter("Invalid value for the parameter " + name + ".")
+			}
+		case "RedrivePolicy":
+			if value != "" {
+				var policy struct {
+					DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+					MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+				}
+
+				if err := json.Unmarshal([]byte(value), &policy); err != nil || policy.DeadLetterTargetArn == "" {
+					return errInvalidParameter("Invalid value for the parameter RedrivePolicy.")
+				}
+
+				dlq := s.queueByARN(policy.DeadLetterTargetArn)
+				if dlq == nil {
+					return errInvalidParameter("Value " + policy.DeadLetterTargetArn + " for parameter RedrivePolicy is invalid. Reason: Dead letter target does not exist.")
+				}
+
+				if dlq.fifo() != (q.fifo() || attributes["FifoQueue"] == "true") {
+					return errInvalidParameter("Value " + policy.DeadLetterTargetArn + " for parameter RedrivePolicy is invalid. Reason: Dead-letter queue must be same type of queue as the source.")
+				}
+			}
+		case "Policy", "KmsMasterKeyId", "KmsDataKeyReusePeriodSeconds":
+		default:
+			return &types.InvalidAttributeName{Message: aws.String("Unknown Attribute " + name + ".")}
+		}
+	}
+
+	for name, value := range attributes {
+		q.attributes[name] = value
+	}
+
+	q.modified = s.Now()
+
+	return nil
+}
+
+// CreateQueue creates a queue.
+// Like Amazon SQS, it returns the existing queue's URL if the queue exists with the same attributes,
+// and fails with *types.QueueNameExists if the attributes differ.
+func (s *Service) CreateQueue(ctx context.Context,
+	params *sqs.CreateQueueInput,
+	optFns ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.QueueName)
+	if !validQueueName(name) {
+		return nil, errInvalidParameter("Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length")
+	}
+
+	err := checkFifoAttributes(name, params.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if q, ok := s.queues[name]; ok {
+		for k, v := range params.Attributes {
+			if q.attributes[k] != v {
+				return nil, &types.QueueNameExists{Message: aws.String("A queue already exists with the same name and a different value for attribute " + k)}
+			}
+		}
+
+		return &sqs.CreateQueueOutput{QueueUrl: aws.String(q.url)}, nil
+	}
+
+	q := &queue{
+		name:       name,
+		url:        s.QueueURL(name),
+		arn:        s.QueueARN(name),
+		attributes: map[string]string{},
+		tags:       map[string]string{},
+		created:    s.Now(),
+	}
+
+	for k, v := range defaultAttributes {
+		q.attributes[k] = v
+	}
+
+	for k, v := range params.Tags {
+		q.tags[k] = v
+	}
+
+	err = s.setAttributes(q, params.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.fifo() {
+		q.deduplication = map[string]*message{}
+	}
+
+	s.queues[name] = q
+
+	return &sqs.CreateQueueOutput{QueueUrl: aws.String(q.url)}, nil
+}
+
+// GetQueueUrl returns the URL of a queue.
+func (s *Service) GetQueueUrl(ctx context.Context,
+	params *sqs.GetQueueUrlInput,
+	optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[aws.ToString(params.QueueName)]
+	if !ok {
+		return nil, errQueueDoesNotExist()
+	}
+
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String(q.url)}, nil
+}
+
+// ListQueues lists the URLs of the queues whose names start with QueueNamePrefix.
+// If MaxResults is set, it returns that many URLs at a time.
+func (s *Service) ListQueues(ctx context.Context,
+	params *sqs.ListQueuesInput,
+	optFns ...func(*sqs.Options)) (*sqs.ListQueuesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var urls []string
+	for name, q := range s.queues {
+		if strings.HasPrefix(name, aws.ToString(params.QueueNamePrefix)) {
+			urls = append(urls, q.url)
+		}
+	}
+
+	sort.Strings(urls)
+
+	// The token is the index of the next URL
+	start := 0
+	if params.NextToken != nil {
+		var err error
+		start, err = strconv.Atoi(*params.NextToken)
+		if err != nil || start < 0 || start > len(urls) {
+			return nil, errInvalidParameter("Invalid NextToken value.")
+		}
+	}
+
+	output := &sqs.ListQueuesOutput{
+		QueueUrls: urls[start:],
+	}
+
+	if params.MaxResults != nil {
+		max := int(*params.MaxResults)
+		if max < 1 || max > 1000 {
+			return nil, errInvalidParameter("Value for parameter MaxResults is invalid. Reason: MaxResults must be between 1 and 1000.")
+		}
+
+		if len(output.QueueUrls) > max {
+			output.QueueUrls = output.QueueUrls[:max]
+			output.NextToken = aws.String(strconv.Itoa(start + max))
+		}
+	}
+
+	return output, nil
+}
+
+// ListDeadLetterSourceQueues lists the URLs of the queues whose RedrivePolicy
+// sends messages to the given queue.
+func (s *Service) ListDeadLetterSourceQueues(ctx context.Context,
+	params *sqs.ListDeadLetterSourceQueuesInput,
+	optFns ...func(*sqs.Options)) (*sqs.ListDeadLetterSourceQueuesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dlq, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &sqs.ListDeadLetterSourceQueuesOutput{}
+	for _, q := range s.queues {
+		if target, _ := s.redriveTarget(q); target == dlq {
+			output.QueueUrls = append(output.QueueUrls, q.url)
+		}
+	}
+
+	sort.Strings(output.QueueUrls)
+
+	return output, nil
+}
+
+// DeleteQueue deletes a queue and any messages in it.
+func (s *Service) DeleteQueue(ctx context.Context,
+	params *sqs.DeleteQueueInput,
+	optFns ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.queues, q.name)
+	s.notify()
+
+	return &sqs.DeleteQueueOutput{}, nil
+}
+
+// PurgeQueue deletes every message in a queue.
+func (s *Service) PurgeQueue(ctx context.Context,
+	params *sqs.PurgeQueueInput,
+	optFns ...func(*sqs.Options)) (*sqs.PurgeQueueOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	q.messages = nil
+
+	return &sqs.PurgeQueueOutput{}, nil
+}
+
+// GetQueueAttributes returns the requested attributes of a queue, or all of them for All.
+// It also computes the read-only attributes, such as QueueArn and ApproximateNumberOfMessages.
+func (s *Service) GetQueueAttributes(ctx context.Context,
+	params *sqs.GetQueueAttributesInput,
+	optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.Now()
+	visible, inFlight, delayed := 0, 0, 0
+
+	for _, m := range q.messages {
+		switch {
+		case !now.Before(m.visibleAt):
+			visible++
+		case m.receiveCount > 0:
+			inFlight++
+		default:
+			delayed++
+		}
+	}
+
+	all := map[string]string{
+		"QueueArn":                              q.arn,
+		"ApproximateNumberOfMessages":           strconv.Itoa(visible),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(inFlight),
+		"ApproximateNumberOfMessagesDelayed":    strconv.Itoa(delayed),
+		"CreatedTimestamp":                      strconv.FormatInt(q.created.Unix(), 10),
+		"LastModifiedTimestamp":                 strconv.FormatInt(q.modified.Unix(), 10),
+	}
+
+	for k, v := range q.attributes {
+		if v != "" {
+			all[k] = v
+		}
+	}
+
+	output := &sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{},
+	}
+
+	for _, name := range params.AttributeNames {
+		if name == types.QueueAttributeNameAll {
+			output.Attributes = all
+			break
+		}
+
+		if v, ok := all[string(name)]; ok {
+			output.Attributes[string(name)] = v
+		}
+	}
+
+	return output, nil
+}
+
+// SetQueueAttributes changes the settable attributes of a queue, such as VisibilityTimeout and RedrivePolicy.
+func (s *Service) SetQueueAttributes(ctx context.Context,
+	params *sqs.SetQueueAttributesInput,
+	optFns ...func(*sqs.Options)) (*sqs.SetQueueAttributesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.lookupQueue(params.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params.Attributes) == 0 {
+		return nil, errMissingParameter("Attribute.Name")
+	}
+
+	// Whether a queue is a FIFO queue is fixed when it is created
+	if _, ok := params.Attributes["FifoQueue"]; ok {
+		return nil, &types.InvalidAttributeName{Message: aws.String("Unknown Attribute FifoQueue.")}
+	}
+
+	if _, ok := params.Attributes["ContentBasedDeduplication"]; ok && !q.fifo() {
+		return nil, &types.InvalidAttributeName{Message: aws.String("Unknown Attribute ContentBasedDeduplication.")}
+	}
+
+	err = s.setAttributes(q, params.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.SetQueueAttributesOutput{}, nil
+}
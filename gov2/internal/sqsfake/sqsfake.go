@@ -0,0 +1,232 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package sqsfake provides an in-memory stand-in for the Amazon Simple Queue Service (Amazon SQS) client.
+//
+// A Service implements the per-operation interfaces used by the gov2/sqs examples,
+// such as SQSSendMessageAPI and SQSGetLPMsgAPI, against a store of queues and messages.
+// Received messages stay hidden until their visibility timeout expires or they are deleted,
+// ReceiveMessage long-polls when asked to, and a queue's RedrivePolicy moves messages
+// to its dead-letter queue once they have been received too many times.
+// FIFO queues deliver the messages of each message group in order, one batch at a time,
+// and drop messages whose deduplication ID was sent within the last five minutes.
+// Failures are returned as the same error types the SDK returns, such as *types.QueueDoesNotExist.
+package sqsfake
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// Service is an in-memory Amazon SQS service.
+// The zero value is not usable; call New to create one.
+// A Service is safe for concurrent use.
+type Service struct {
+	// Region and AccountID are used to build queue URLs and ARNs.
+	Region    string
+	AccountID string
+
+	// Now returns the current time. Replace it to control visibility timeouts and delays in tests.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	queues map[string]*queue
+	nextID int
+
+	// changed is closed, and replaced, whenever a message might have become available.
+	changed chan struct{}
+}
+
+type queue struct {
+	name       string
+	url        string
+	arn        string
+	attributes map[string]string
+	tags       map[string]string
+	created    time.Time
+	modified   time.Time
+
+	// Messages in the order they were sent
+	messages []*message
+
+	// For FIFO queues, the last sequence number, and the messages sent in the deduplication window by deduplication ID
+	sequence      int64
+	deduplication map[string]*message
+}
+
+type message struct {
+	id             string
+	body           string
+	attributes     map[string]types.MessageAttributeValue
+	sent           time.Time
+	visibleAt      time.Time
+	receiveCount   int
+	firstReceived  time.Time
+	receiptHandle  string
+	md5OfBody      string
+	md5OfAttribute string
+
+	// Set for messages in FIFO queues
+	groupID        string
+	dedupID        string
+	sequenceNumber string
+}
+
+// Default values of the settable queue attributes.
+var defaultAttributes = map[string]string{
+	"DelaySeconds":                  "0",
+	"MaximumMessageSize":            "262144",
+	"MessageRetentionPeriod":        "345600",
+	"ReceiveMessageWaitTimeSeconds": "0",
+	"VisibilityTimeout":             "30",
+}
+
+// New creates a Service with no queues.
+func New() *Service {
+	return &Service{
+		Region:    "us-west-2",
+		AccountID: "123456789012",
+		Now:       time.Now,
+		queues:    map[string]*queue{},
+		changed:   make(chan struct{}),
+	}
+}
+
+// Errors shaped like the ones Amazon SQS returns.
+
+func errQueueDoesNotExist() error {
+	return &types.QueueDoesNotExist{Message: aws.String("The specified queue does not exist for this wsdl version.")}
+}
+
+func errInvalidParameter(message string) error {
+	return &smithy.GenericAPIError{Code: "InvalidParameterValue", Message: message, Fault: smithy.FaultClient}
+}
+
+func errMissingParameter(name string) error {
+	return &smithy.GenericAPIError{Code: "MissingParameter", Message: "The request must contain the parameter " + name + ".", Fault: smithy.FaultClient}
+}
+
+// notify wakes up any long-polling receivers. The caller must hold s.mu.
+func (s *Service) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// newID returns a unique ID. The caller must hold s.mu.
+func (s *Service) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%08x-0000-4000-8000-%012x", s.nextID, s.nextID)
+}
+
+// QueueURL returns the URL of the named queue, whether or not it exists.
+func (s *Service) QueueURL(name string) string {
+	return "https://sqs." + s.Region + ".amazonaws.com/" + s.AccountID + "/" + name
+}
+
+// QueueARN returns the ARN of the named queue, whether or not it exists.
+func (s *Service) QueueARN(name string) string {
+	return "arn:aws:sqs:" + s.Region + ":" + s.AccountID + ":" + name
+}
+
+// lookupQueue returns the queue with the given URL. The caller must hold s.mu.
+func (s *Service) lookupQueue(url *string) (*queue, error) {
+	if url == nil || *url == "" {
+		return nil, errMissingParameter("QueueUrl")
+	}
+
+	name := *url
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	q, ok := s.queues[name]
+	if !ok {
+		return nil, errQueueDoesNotExist()
+	}
+
+	return q, nil
+}
+
+// queueByARN returns the queue with the given ARN, or nil. The caller must hold s.mu.
+func (s *Service) queueByARN(arn string) *queue {
+	for _, q := range s.queues {
+		if q.arn == arn {
+			return q
+		}
+	}
+
+	return nil
+}
+
+// seconds returns the value of a numeric queue attribute as a duration.
+func (q *queue) seconds(name string) time.Duration {
+	var n int
+	fmt.Sscan(q.attributes[name], &n)
+
+	return time.Duration(n) * time.Second
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfAttributes computes the MD5OfMessageAttributes value the way Amazon SQS does:
+// over each attribute, in name order, as its length-prefixed name, data type,
+// a transport byte, and its length-prefixed value.
+func md5OfAttributes(attributes map[string]types.MessageAttributeValue) string {
+	if len(attributes) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var buf []byte
+	appendBytes := func(b []byte) {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+		buf = append(buf, n[:]...)
+		buf = append(buf, b...)
+	}
+
+	for _, name := range names {
+		v := attributes[name]
+		appendBytes([]byte(name))
+		appendBytes([]byte(aws.ToString(v.DataType)))
+
+		if v.StringValue != nil {
+			buf = append(buf, 1)
+			appendBytes([]byte(*v.StringValue))
+		} else {
+			buf = append(buf, 2)
+			appendBytes(v.BinaryValue)
+		}
+	}
+
+	return md5Hex(buf)
+}
+
+// attributesSize returns the number of bytes message attributes count toward the maximum message size.
+func attributesSize(attributes map[string]types.MessageAttributeValue) int {
+	size := 0
+	for name, v := range attributes {
+		size += len(name) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	return size
+}
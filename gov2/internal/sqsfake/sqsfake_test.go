@@ -0,0 +1,498 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package sqsfake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// clock is a fake time source that only moves when told to.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func newTestService(t *testing.T) (*Service, *clock) {
+	c := &clock{now: time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)}
+	s := New()
+	s.Now = c.Now
+
+	return s, c
+}
+
+func createQueue(t *testing.T, s *Service, name string, attributes map[string]string) string {
+	output, err := s.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: attributes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return *output.QueueUrl
+}
+
+func send(t *testing.T, s *Service, url, body string) {
+	_, err := s.SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(url),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, s *Service, url string) []types.Message {
+	output, err := s.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(url),
+		MaxNumberOfMessages: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output.Messages
+}
+
+func TestCreateQueue(t *testing.T) {
+	s, _ := newTestService(t)
+	url := createQueue(t, s, "doc-example-queue", map[string]string{"DelaySeconds": "60"})
+
+	if again := createQueue(t, s, "doc-example-queue", map[string]string{"DelaySeconds": "60"}); again != url {
+		t.Errorf("got %v, want %v", again, url)
+	}
+
+	_, err := s.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String("doc-example-queue"),
+		Attributes: map[string]string{"DelaySeconds": "30"},
+	})
+	var exists *types.QueueNameExists
+	if !errors.As(err, &exists) {
+		t.Errorf("got %v, want QueueNameExists", err)
+	}
+
+	_, err = s.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String("doc-example-queue2"),
+		Attributes: map[string]string{"Color": "blue"},
+	})
+	var badName *types.InvalidAttributeName
+	if !errors.As(err, &badName) {
+		t.Errorf("got %v, want InvalidAttributeName", err)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	s, c := newTestService(t)
+	url := createQueue(t, s, "doc-example-queue", map[string]string{"VisibilityTimeout": "30"})
+	send(t, s, url, "Hello")
+
+	msgs := receive(t, s, url)
+	if len(msgs) != 1 || aws.ToString(msgs[0].Body) != "Hello" {
+		t.Fatalf("got %v, want one message", msgs)
+	}
+
+	if msgs := receive(t, s, url); len(msgs) != 0 {
+		t.Errorf("got %d messages while the first was in flight, want 0", len(msgs))
+	}
+
+	c.Advance(31 * time.Second)
+
+	again := receive(t, s, url)
+	if len(again) != 1 {
+		t.Fatalf("got %d messages after the timeout, want 1", len(again))
+	}
+
+	_, err := s.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(url),
+		ReceiptHandle: aws.String("not-a-receipt-handle"),
+	})
+	var invalid *types.ReceiptHandleIsInvalid
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want ReceiptHandleIsInvalid", err)
+	}
+
+	_, err = s.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(url),
+		ReceiptHandle: again[0].ReceiptHandle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Advance(time.Minute)
+
+	if msgs := receive(t, s, url); len(msgs) != 0 {
+		t.Errorf("got %d messages after delete, want 0", len(msgs))
+	}
+}
+
+func TestLongPoll(t *testing.T) {
+	s, _ := newTestService(t)
+	url := createQueue(t, s, "doc-example-queue", nil)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		send(t, s, url, "Hello")
+	}()
+
+	output, err := s.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:        aws.String(url),
+		WaitTimeSeconds: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Messages) != 1 {
+		t.Errorf("got %d messages, want 1", len(output.Messages))
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	s, c := newTestService(t)
+	dlq := createQueue(t, s, "doc-example-dlq", nil)
+	url := createQueue(t, s, "doc-example-queue", map[string]string{
+		"VisibilityTimeout": "1",
+		"RedrivePolicy":     `{"deadLetterTargetArn":"` + s.QueueARN("doc-example-dlq") + `","maxReceiveCount":"2"}`,
+	})
+	send(t, s, url, "poison")
+
+	for i := 0; i < 2; i++ {
+		if msgs := receive(t, s, url); len(msgs) != 1 {
+			t.Fatalf("receive %d: got %d messages, want 1", i+1, len(msgs))
+		}
+
+		c.Advance(2 * time.Second)
+	}
+
+	if msgs := receive(t, s, url); len(msgs) != 0 {
+		t.Errorf("got %d messages after maxReceiveCount, want 0", len(msgs))
+	}
+
+	if msgs := receive(t, s, dlq); len(msgs) != 1 || aws.ToString(msgs[0].Body) != "poison" {
+		t.Errorf("got %v in the dead-letter queue, want the poison message", msgs)
+	}
+
+	sources, err := s.ListDeadLetterSourceQueues(context.Background(), &sqs.ListDeadLetterSourceQueuesInput{QueueUrl: aws.String(dlq)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sources.QueueUrls) != 1 || sources.QueueUrls[0] != url {
+		t.Errorf("got source queues %v, want %s", sources.QueueUrls, url)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s, _ := newTestService(t)
+	url := createQueue(t, s, "doc-example-queue", map[string]string{"MaximumMessageSize": "1024"})
+
+	sent, err := s.SendMessageBatch(context.Background(), &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: aws.String("a"), MessageBody: aws.String("Hello")},
+			{Id: aws.String("b"), MessageBody: aws.String(strings.Repeat("x", 2000))},
+			{Id: aws.String("c"), MessageBody: aws.String("World")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent.Successful) != 2 || len(sent.Failed) != 1 || aws.ToString(sent.Failed[0].Id) != "b" || !sent.Failed[0].SenderFault {
+		t.Errorf("got %d successful and failed %+v, want b to fail", len(sent.Successful), sent.Failed)
+	}
+
+	_, err = s.SendMessageBatch(context.Background(), &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: aws.String("a"), MessageBody: aws.String("Hello")},
+			{Id: aws.String("a"), MessageBody: aws.String("World")},
+		},
+	})
+	var notDistinct *types.BatchEntryIdsNotDistinct
+	if !errors.As(err, &notDistinct) {
+		t.Errorf("got %v, want BatchEntryIdsNotDistinct", err)
+	}
+
+	_, err = s.SendMessageBatch(context.Background(), &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: aws.String("a"), MessageBody: aws.String(strings.Repeat("x", 200000))},
+			{Id: aws.String("b"), MessageBody: aws.String(strings.Repeat("x", 200000))},
+		},
+	})
+	var tooLong *types.BatchRequestTooLong
+	if !errors.As(err, &tooLong) {
+		t.Errorf("got %v, want BatchRequestTooLong", err)
+	}
+
+	msgs := receive(t, s, url)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+
+	changed, err := s.ChangeMessageVisibilityBatch(context.Background(), &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []types.ChangeMessageVisibilityBatchRequestEntry{
+			{Id: aws.String("a"), ReceiptHandle: msgs[0].ReceiptHandle, VisibilityTimeout: 0},
+			{Id: aws.String("b"), ReceiptHandle: aws.String("not-a-receipt-handle")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changed.Successful) != 1 || len(changed.Failed) != 1 || aws.ToString(changed.Failed[0].Code) != "ReceiptHandleIsInvalid" {
+		t.Errorf("got %d successful and failed %+v", len(changed.Successful), changed.Failed)
+	}
+
+	again := receive(t, s, url)
+	if len(again) != 1 {
+		t.Fatalf("got %d messages after making one visible, want 1", len(again))
+	}
+
+	deleted, err := s.DeleteMessageBatch(context.Background(), &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []types.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("a"), ReceiptHandle: again[0].ReceiptHandle},
+			{Id: aws.String("b"), ReceiptHandle: msgs[1].ReceiptHandle},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted.Successful) != 2 {
+		t.Errorf("got failed %+v, want both deleted", deleted.Failed)
+	}
+
+	_, err = s.DeleteMessageBatch(context.Background(), &sqs.DeleteMessageBatchInput{QueueUrl: aws.String(url)})
+	var empty *types.EmptyBatchRequest
+	if !errors.As(err, &empty) {
+		t.Errorf("got %v, want EmptyBatchRequest", err)
+	}
+}
+
+func sendToGroup(t *testing.T, s *Service, url, group, dedupID, body string) *sqs.SendMessageOutput {
+	input := &sqs.SendMessageInput{
+		QueueUrl:       aws.String(url),
+		MessageBody:    aws.String(body),
+		MessageGroupId: aws.String(group),
+	}
+
+	if dedupID != "" {
+		input.MessageDeduplicationId = aws.String(dedupID)
+	}
+
+	output, err := s.SendMessage(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output
+}
+
+func bodies(msgs []types.Message) string {
+	var b []string
+	for _, m := range msgs {
+		b = append(b, aws.ToString(m.Body))
+	}
+
+	return strings.Join(b, ",")
+}
+
+func TestFifoQueueAttributes(t *testing.T) {
+	s, _ := newTestService(t)
+
+	invalid := []struct {
+		name       string
+		attributes map[string]string
+	}{
+		{"doc-example-queue.fifo", nil},
+		{"doc-example-queue", map[string]string{"FifoQueue": "true"}},
+		{"doc-example-queue", map[string]string{"ContentBasedDeduplication": "true"}},
+		{"doc-example-queue.fifo", map[string]string{"FifoQueue": "yes"}},
+	}
+
+	for _, test := range invalid {
+		_, err := s.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String(test.name), Attributes: test.attributes})
+		if err == nil {
+			t.Errorf("got no error creating %s with %v", test.name, test.attributes)
+		}
+	}
+
+	standard := createQueue(t, s, "doc-example-queue", nil)
+	fifo := createQueue(t, s, "doc-example-queue.fifo", map[string]string{"FifoQueue": "true"})
+
+	_, err := s.SetQueueAttributes(context.Background(), &sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(fifo),
+		Attributes: map[string]string{"FifoQueue": "false"},
+	})
+	var badName *types.InvalidAttributeName
+	if !errors.As(err, &badName) {
+		t.Errorf("got %v changing FifoQueue, want InvalidAttributeName", err)
+	}
+
+	_, err = s.SetQueueAttributes(context.Background(), &sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(fifo),
+		Attributes: map[string]string{"RedrivePolicy": `{"deadLetterTargetArn":"` + s.QueueARN("doc-example-queue") + `","maxReceiveCount":"2"}`},
+	})
+	if err == nil {
+		t.Error("got no error using a standard dead-letter queue for a FIFO queue")
+	}
+
+	sends := []struct {
+		url   string
+		input sqs.SendMessageInput
+		code  string
+	}{
+		{standard, sqs.SendMessageInput{MessageGroupId: aws.String("g")}, "InvalidParameterValue"},
+		{fifo, sqs.SendMessageInput{MessageDeduplicationId: aws.String("d")}, "MissingParameter"},
+		{fifo, sqs.SendMessageInput{MessageGroupId: aws.String("g")}, "InvalidParameterValue"},
+		{fifo, sqs.SendMessageInput{MessageGroupId: aws.String("g"), MessageDeduplicationId: aws.String("d"), DelaySeconds: 5}, "InvalidParameterValue"},
+		{fifo, sqs.SendMessageInput{MessageGroupId: aws.String("a group"), MessageDeduplicationId: aws.String("d")}, "InvalidParameterValue"},
+	}
+
+	for i, test := range sends {
+		test.input.QueueUrl = aws.String(test.url)
+		test.input.MessageBody = aws.String("Hello")
+
+		_, err := s.SendMessage(context.Background(), &test.input)
+
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != test.code {
+			t.Errorf("send %d: got %v, want %s", i, err, test.code)
+		}
+	}
+}
+
+func TestFifoOrdering(t *testing.T) {
+	s, _ := newTestService(t)
+	url := createQueue(t, s, "doc-example-queue.fifo", map[string]string{"FifoQueue": "true"})
+
+	first := sendToGroup(t, s, url, "a", "1", "a1")
+	second := sendToGroup(t, s, url, "a", "2", "a2")
+	sendToGroup(t, s, url, "b", "3", "b1")
+	sendToGroup(t, s, url, "a", "4", "a3")
+
+	if aws.ToString(first.SequenceNumber) >= aws.ToString(second.SequenceNumber) {
+		t.Errorf("got sequence numbers %s and %s, want them to increase", aws.ToString(first.SequenceNumber), aws.ToString(second.SequenceNumber))
+	}
+
+	output, err := s.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(url),
+		MaxNumberOfMessages: 2,
+		AttributeNames:      []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bodies(output.Messages); got != "a1,a2" {
+		t.Fatalf("got %s, want a1,a2", got)
+	}
+
+	if m := output.Messages[0]; m.Attributes["MessageGroupId"] != "a" || m.Attributes["MessageDeduplicationId"] != "1" || m.Attributes["SequenceNumber"] != *first.SequenceNumber {
+		t.Errorf("got attributes %v", m.Attributes)
+	}
+
+	// Group a is in flight, so a3 has to wait
+	if got := bodies(receive(t, s, url)); got != "b1" {
+		t.Errorf("got %s while group a was in flight, want b1", got)
+	}
+
+	for _, m := range output.Messages {
+		_, err := s.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: m.ReceiptHandle})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := bodies(receive(t, s, url)); got != "a3" {
+		t.Errorf("got %s after deleting a1 and a2, want a3", got)
+	}
+}
+
+func TestFifoDeduplication(t *testing.T) {
+	s, c := newTestService(t)
+	url := createQueue(t, s, "doc-example-queue.fifo", map[string]string{"FifoQueue": "true", "ContentBasedDeduplication": "true"})
+
+	original := sendToGroup(t, s, url, "a", "order-1", "first")
+	duplicate := sendToGroup(t, s, url, "a", "order-1", "second")
+
+	if *duplicate.MessageId != *original.MessageId || *duplicate.SequenceNumber != *original.SequenceNumber {
+		t.Errorf("got message %s for the duplicate, want %s", *duplicate.MessageId, *original.MessageId)
+	}
+
+	// With content-based deduplication, the same body is a duplicate
+	sendToGroup(t, s, url, "b", "", "Hello")
+	sendToGroup(t, s, url, "b", "", "Hello")
+
+	msgs := receive(t, s, url)
+	if got := bodies(msgs); got != "first,Hello" {
+		t.Fatalf("got %s, want first,Hello", got)
+	}
+
+	// Deleting a message doesn't end its deduplication window
+	for _, m := range msgs {
+		_, err := s.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: m.ReceiptHandle})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Advance(4 * time.Minute)
+	sendToGroup(t, s, url, "a", "order-1", "third")
+
+	if msgs := receive(t, s, url); len(msgs) != 0 {
+		t.Errorf("got %s within the deduplication window, want nothing", bodies(msgs))
+	}
+
+	c.Advance(time.Minute)
+	sendToGroup(t, s, url, "a", "order-1", "fourth")
+
+	if got := bodies(receive(t, s, url)); got != "fourth" {
+		t.Errorf("got %s after the deduplication window, want fourth", got)
+	}
+}
+
+func TestMD5OfAttributes(t *testing.T) {
+	got := md5OfAttributes(map[string]types.MessageAttributeValue{
+		"Title": {DataType: aws.String("String"), StringValue: aws.String("The Whistler")},
+	})
+
+	if len(got) != 32 {
+		t.Fatalf("got %q, want a hex MD5 digest", got)
+	}
+
+	if got == md5OfAttributes(map[string]types.MessageAttributeValue{
+		"Title": {DataType: aws.String("String"), StringValue: aws.String("The Whistler 2")},
+	}) {
+		t.Error("different attributes have the same digest")
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package ssmfake provides an in-memory stand-in for the AWS Systems Manager (SSM) client.
+//
+// A Service implements the per-operation interfaces used by the gov2/ssm examples,
+// such as SSMGetParameterAPI and SSMPutParameterAPI, against a store of Parameter Store parameters.
+// Each PutParameter with Overwrite adds a version, as in Parameter Store.
+// GetParametersByPath returns the parameters of a hierarchy in name order, a page at a time.
+// Failures are returned as the same error types the SDK returns, such as *types.ParameterNotFound.
+package ssmfake
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+)
+
+// Service is an in-memory Parameter Store.
+// The zero value is not usable; call New to create one.
+// A Service is safe for concurrent use.
+type Service struct {
+	// Region and AccountID are used to build parameter ARNs.
+	Region    string
+	AccountID string
+
+	// Now returns the time recorded as each parameter's LastModifiedDate.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	parameters map[string]*parameter
+}
+
+type parameter struct {
+	name        string
+	value       string
+	kind        types.ParameterType
+	keyID       string
+	dataType    string
+	description string
+	version     int64
+	modified    time.Time
+}
+
+// New creates an empty Service.
+func New() *Service {
+	return &Service{
+		Region:     "us-west-2",
+		AccountID:  "123456789012",
+		Now:        time.Now,
+		parameters: map[string]*parameter{},
+	}
+}
+
+func errValidation(message string) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: message, Fault: smithy.FaultClient}
+}
+
+// validName reports whether name is a valid parameter name:
+// either a simple name or a path of up to 15 levels that starts with /.
+func validName(name string) bool {
+	if name == "" || len(name) > 2048 || strings.HasSuffix(name, "/") {
+		return false
+	}
+
+	lower := strings.ToLower(strings.TrimPrefix(name, "/"))
+	if strings.HasPrefix(lower, "aws") || strings.HasPrefix(lower, "ssm") {
+		return false
+	}
+
+	if strings.Contains(name, "/") && (!strings.HasPrefix(name, "/") || strings.Count(name, "/") > 15 || strings.Contains(name, "//")) {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_.-/", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookup returns the named parameter. The caller must hold s.mu.
+func (s *Service) lookup(name *string) (*parameter, error) {
+	p, ok := s.parameters[aws.ToString(name)]
+	if !ok {
+		return nil, &types.ParameterNotFound{}
+	}
+
+	return p, nil
+}
+
+// output returns the parameter as GetParameter reports it.
+// Unless withDecryption is true, a SecureString value is replaced by an opaque stand-in for its ciphertext.
+func (s *Service) output(p *parameter, withDecryption bool) types.Parameter {
+	arnName := p.name
+	if !strings.HasPrefix(arnName, "/") {
+		arnName = "/" + arnName
+	}
+
+	value := p.value
+	if p.kind == types.ParameterTypeSecureString && !withDecryption {
+		value = "encrypted:" + base64.StdEncoding.EncodeToString([]byte(p.keyID+":"+p.value))
+	}
+
+	return types.Parameter{
+		ARN:              aws.String("arn:aws:ssm:" + s.Region + ":" + s.AccountID + ":parameter" + arnName),
+		Name:             aws.String(p.name),
+		Type:             p.kind,
+		Value:            aws.String(value),
+		Version:          p.version,
+		DataType:         aws.String(p.dataType),
+		LastModifiedDate: aws.Time(p.modified),
+	}
+}
+
+// GetParameter returns a parameter.
+func (s *Service) GetParameter(ctx context.Context,
+	params *ssm.GetParameterInput,
+	optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.lookup(params.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	output := s.output(p, params.WithDecryption)
+
+	return &ssm.GetParameterOutput{Parameter: &output}, nil
+}
+
+// PutParameter creates a parameter, or adds a version to an existing one if Overwrite is true.
+// It fails with *types.ParameterAlreadyExists if the parameter exists and Overwrite is false.
+func (s *Service) PutParameter(ctx context.Context,
+	params *ssm.PutParameterInput,
+	optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.Name)
+	if !validName(name) {
+		return nil, errValidation("Parameter name: can't be prefixed with \"aws\" or \"ssm\" (case-insensitive), and must be a simple name or a fully qualified path.")
+	}
+
+	if params.Value == nil || *params.Value == "" || len(*params.Value) > 4096 {
+		return nil, errValidation("Parameter value must be between 1 and 4096 characters.")
+	}
+
+	p, exists := s.parameters[name]
+	if exists && !params.Overwrite {
+		return nil, &types.ParameterAlreadyExists{Message: aws.String("The parameter already exists. To overwrite this value, set the overwrite option in the request to true.")}
+	}
+
+	kind := params.Type
+	if kind == "" {
+		if !exists {
+			return nil, errValidation("A parameter type is required when you create a parameter.")
+		}
+
+		kind = p.kind
+	}
+
+	switch kind {
+	case types.ParameterTypeString, types.ParameterTypeStringList, types.ParameterTypeSecureString:
+	default:
+		return nil, &types.UnsupportedParameterType{Message: aws.String(string(kind))}
+	}
+
+	if exists && kind != p.kind {
+		return nil, &types.HierarchyTypeMismatchException{Message: aws.String("Parameter type can't be changed.")}
+	}
+
+	if !exists {
+		p = &parameter{name: name, dataType: "text"}
+		s.parameters[name] = p
+	}
+
+	p.value = *params.Value
+	p.kind = kind
+	p.version++
+	p.modified = s.Now()
+
+	if params.Description != nil {
+		p.description = *params.Description
+	}
+
+	if params.DataType != nil {
+		p.dataType = *params.DataType
+	}
+
+	if kind == types.ParameterTypeSecureString {
+		p.keyID = aws.ToString(params.KeyId)
+		if p.keyID == "" {
+			p.keyID = "alias/aws/ssm"
+		}
+	}
+
+	return &ssm.PutParameterOutput{
+		Version: p.version,
+		Tier:    types.ParameterTierStandard,
+	}, nil
+}
+
+// maxNames is the most parameters that GetParameters returns at a time.
+const maxNames = 10
+
+// GetParameters returns up to 10 parameters by name, in the order they were requested.
+// The names of the parameters that don't exist are returned in InvalidParameters.
+func (s *Service) GetParameters(ctx context.Context,
+	params *ssm.GetParametersInput,
+	optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(params.Names) == 0 || len(params.Names) > maxNames {
+		return nil, errValidation("1 validation error detected: Value at 'names' failed to satisfy constraint: Member must have length less than or equal to 10 and greater than or equal to 1")
+	}
+
+	output := &ssm.GetParametersOutput{}
+	seen := map[string]bool{}
+
+	for _, name := range params.Names {
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		p, ok := s.parameters[name]
+		if !ok {
+			output.InvalidParameters = append(output.InvalidParameters, name)
+			continue
+		}
+
+		output.Parameters = append(output.Parameters, s.output(p, params.WithDecryption))
+	}
+
+	return output, nil
+}
+
+// DeleteParameter deletes a parameter.
+func (s *Service) DeleteParameter(ctx context.Context,
+	params *ssm.DeleteParameterInput,
+	optFns ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.lookup(params.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.parameters, p.name)
+
+	return &ssm.DeleteParameterOutput{}, nil
+}
+
+// maxPathResults is the most parameters that GetParametersByPath returns at a time.
+const maxPathResults = 10
+
+// GetParametersByPath returns the parameters whose names start with a path, in name order.
+// Unless Recursive is true, it returns only the parameters directly under the path.
+// The only parameter filter it supports is Type with the Equals option.
+func (s *Service) GetParametersByPath(ctx context.Context,
+	params *ssm.GetParametersByPathInput,
+	optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := aws.ToString(params.Path)
+	if !strings.HasPrefix(path, "/") || len(path) > 2048 {
+		return nil, errValidation("The parameter doesn't meet the parameter name requirements. The parameter name must begin with a forward slash \"/\".")
+	}
+
+	limit := int(params.MaxResults)
+	if limit == 0 {
+		limit = maxPathResults
+	}
+
+	if limit < 1 || limit > maxPathResults {
+		return nil, errValidation("1 validation error detected: Value at 'maxResults' failed to satisfy constraint: Member must have value less than or equal to 10")
+	}
+
+	kinds, err := typeFilter(params.ParameterFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(path, "/") + "/"
+
+	var names []string
+	for name, p := range s.parameters {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if !params.Recursive && strings.Contains(name[len(prefix):], "/") {
+			continue
+		}
+
+		if kinds != nil && !kinds[p.kind] {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	// The token is the name of the last parameter of the previous page
+	start := 0
+	if params.NextToken != nil {
+		after, err := base64.RawURLEncoding.DecodeString(*params.NextToken)
+		if err != nil || *params.NextToken == "" {
+			return nil, &types.InvalidNextToken{Message: aws.String("The specified token isn't valid.")}
+		}
+
+		start = sort.SearchStrings(names, string(after))
+		if start < len(names) && names[start] == string(after) {
+			start++
+		}
+	}
+
+	output := &ssm.GetParametersByPathOutput{}
+
+	end := start + limit
+	if end < len(names) {
+		output.NextToken = aws.String(base64.RawURLEncoding.EncodeToString([]byte(names[end-1])))
+	} else {
+		end = len(names)
+	}
+
+	for _, name := range names[start:end] {
+		output.Parameters = append(output.Parameters, s.output(s.parameters[name], params.WithDecryption))
+	}
+
+	return output, nil
+}
+
+// typeFilter returns the parameter types that a Type filter selects, or nil if there is no filter.
+func typeFilter(filters []types.ParameterStringFilter) (map[types.ParameterType]bool, error) {
+	var selected map[types.ParameterType]bool
+
+	for _, f := range filters {
+		if aws.ToString(f.Key) != "Type" {
+			return nil, &types.InvalidFilterKey{Message: aws.String("The filter key " + aws.ToString(f.Key) + " isn't supported.")}
+		}
+
+		if option := aws.ToString(f.Option); option != "" && option != "Equals" {
+			return nil, errValidation("The filter option " + option + " isn't valid for the Type filter key.")
+		}
+
+		if selected == nil {
+			selected = map[types.ParameterType]bool{}
+		}
+
+		for _, v := range f.Values {
+			selected[types.ParameterType(v)] = true
+		}
+	}
+
+	return selected, nil
+}
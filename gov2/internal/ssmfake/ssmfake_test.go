@@ -0,0 +1,219 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package ssmfake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestPutGetParameter(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	input := &ssm.PutParameterInput{
+		Name:  aws.String("/doc-example/password"),
+		Value: aws.String("hunter2"),
+		Type:  types.ParameterTypeSecureString,
+	}
+
+	_, err := s.PutParameter(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.PutParameter(ctx, input)
+	var exists *types.ParameterAlreadyExists
+	if !errors.As(err, &exists) {
+		t.Errorf("got %v, want ParameterAlreadyExists", err)
+	}
+
+	input.Overwrite = true
+	input.Value = aws.String("correct-horse")
+
+	output, err := s.PutParameter(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output.Version != 2 {
+		t.Errorf("got version %d, want 2", output.Version)
+	}
+
+	got, err := s.GetParameter(ctx, &ssm.GetParameterInput{Name: input.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aws.ToString(got.Parameter.Value) == "correct-horse" {
+		t.Error("got the plaintext of a SecureString without WithDecryption")
+	}
+
+	got, err = s.GetParameter(ctx, &ssm.GetParameterInput{Name: input.Name, WithDecryption: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aws.ToString(got.Parameter.Value) != "correct-horse" {
+		t.Errorf("got %q, want correct-horse", aws.ToString(got.Parameter.Value))
+	}
+
+	_, err = s.DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: input.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.GetParameter(ctx, &ssm.GetParameterInput{Name: input.Name})
+	var notFound *types.ParameterNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("got %v, want ParameterNotFound", err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"port":              true,
+		"/app/db/port":      true,
+		"app/db/port":       false,
+		"/app/db/":          false,
+		"/aws/reserved":     false,
+		"SSM-parameter":     false,
+		"/app/db port":      false,
+		"/app/db-1.2_three": true,
+	} {
+		if got := validName(name); got != want {
+			t.Errorf("validName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestGetParametersByPath(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	names := []string{"/app/dev/db/host", "/app/dev/db/port", "/app/dev/region", "/app/prod/region", "/app/development/region"}
+	for i := 0; i < 12; i++ {
+		names = append(names, fmt.Sprintf("/app/dev/feature/%02d", i))
+	}
+
+	for _, name := range names {
+		_, err := s.PutParameter(ctx, &ssm.PutParameterInput{Name: aws.String(name), Value: aws.String("value"), Type: types.ParameterTypeString})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := s.PutParameter(ctx, &ssm.PutParameterInput{Name: aws.String("/app/dev/db/password"), Value: aws.String("hunter2"), Type: types.ParameterTypeSecureString})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(input *ssm.GetParametersByPathInput) []string {
+		var got []string
+		for {
+			output, err := s.GetParametersByPath(ctx, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(output.Parameters) > maxPathResults {
+				t.Errorf("got a page of %d parameters", len(output.Parameters))
+			}
+
+			for _, p := range output.Parameters {
+				got = append(got, aws.ToString(p.Name))
+			}
+
+			if output.NextToken == nil {
+				return got
+			}
+
+			input.NextToken = output.NextToken
+		}
+	}
+
+	if got := list(&ssm.GetParametersByPathInput{Path: aws.String("/app/dev")}); len(got) != 1 || got[0] != "/app/dev/region" {
+		t.Errorf("got %v, want only /app/dev/region", got)
+	}
+
+	got := list(&ssm.GetParametersByPathInput{Path: aws.String("/app/dev/"), Recursive: true, MaxResults: 5})
+	if len(got) != 16 || got[0] != "/app/dev/db/host" || got[15] != "/app/dev/region" {
+		t.Errorf("got %v", got)
+	}
+
+	got = list(&ssm.GetParametersByPathInput{
+		Path:             aws.String("/app"),
+		Recursive:        true,
+		ParameterFilters: []types.ParameterStringFilter{{Key: aws.String("Type"), Values: []string{"SecureString"}}},
+	})
+	if len(got) != 1 || got[0] != "/app/dev/db/password" {
+		t.Errorf("got %v, want only /app/dev/db/password", got)
+	}
+
+	output, err := s.GetParametersByPath(ctx, &ssm.GetParametersByPathInput{Path: aws.String("/app/dev/db"), WithDecryption: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range output.Parameters {
+		if aws.ToString(p.Name) == "/app/dev/db/password" && aws.ToString(p.Value) != "hunter2" {
+			t.Errorf("got %q, want the decrypted value", aws.ToString(p.Value))
+		}
+	}
+
+	_, err = s.GetParametersByPath(ctx, &ssm.GetParametersByPathInput{Path: aws.String("/app"), NextToken: aws.String("!")})
+	var invalidToken *types.InvalidNextToken
+	if !errors.As(err, &invalidToken) {
+		t.Errorf("got %v, want InvalidNextToken", err)
+	}
+
+	for _, input := range []*ssm.GetParametersByPathInput{
+		{Path: aws.String("app")},
+		{Path: aws.String("/app"), MaxResults: 11},
+	} {
+		_, err = s.GetParametersByPath(ctx, input)
+		if err == nil {
+			t.Errorf("expected an error for %+v", input)
+		}
+	}
+}
+
+func TestGetParameters(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	for _, name := range []string{"/app/db/host", "/app/db/password"} {
+		_, err := s.PutParameter(ctx, &ssm.PutParameterInput{Name: aws.String(name), Value: aws.String("secret"), Type: types.ParameterTypeSecureString})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, err := s.GetParameters(ctx, &ssm.GetParametersInput{
+		Names:          []string{"/app/db/password", "/app/db/port", "/app/db/host", "/app/db/password"},
+		WithDecryption: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Parameters) != 2 || aws.ToString(output.Parameters[0].Name) != "/app/db/password" ||
+		aws.ToString(output.Parameters[0].Value) != "secret" {
+		t.Errorf("got %v", output.Parameters)
+	}
+
+	if len(output.InvalidParameters) != 1 || output.InvalidParameters[0] != "/app/db/port" {
+		t.Errorf("got invalid parameters %v, want /app/db/port", output.InvalidParameters)
+	}
+
+	_, err = s.GetParameters(ctx, &ssm.GetParametersInput{Names: make([]string, 11)})
+	if err == nil {
+		t.Error("expected an error for 11 names")
+	}
+}
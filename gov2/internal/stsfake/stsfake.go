@@ -0,0 +1,277 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+
+// Package stsfake provides an in-memory stand-in for the AWS Security Token Service (AWS STS) client.
+//
+// A Service implements the per-operation interfaces used by the gov2/sts examples,
+// such as STSAssumeRoleAPI, and issues temporary credentials that expire
+// after the requested duration, measured by the Service's clock.
+// Any well-formed role ARN can be assumed unless the role was registered with AddRole,
+// in which case its external ID and MFA requirements are enforced.
+// Failures are returned as the same error types the SDK returns.
+package stsfake
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go"
+)
+
+// DefaultDuration is how long credentials last when AssumeRole doesn't set DurationSeconds.
+const DefaultDuration = time.Hour
+
+// Role holds the trust requirements of a role registered with AddRole.
+type Role struct {
+	// ExternalID, if set, must match the ExternalId of each AssumeRole call.
+	ExternalID string
+
+	// MFASerial, if set, must match the SerialNumber of each AssumeRole call,
+	// and TokenCode must equal MFACode.
+	MFASerial string
+	MFACode   string
+
+	// MaxSessionDuration caps DurationSeconds. It defaults to one hour.
+	MaxSessionDuration time.Duration
+}
+
+// Session records a successful AssumeRole call.
+type Session struct {
+	RoleArn         string
+	RoleSessionName string
+	ExternalID      string
+	Tags            map[string]string
+	AccessKeyID     string
+	Expiration      time.Time
+
+	// CallerAccessKeyID is the access key that signed the request, if known.
+	// It is set only for calls made through the localaws emulator, and is how role chaining shows up.
+	CallerAccessKeyID string
+}
+
+// Service is an in-memory AWS STS service.
+// The zero value is not usable; call New to create one.
+// A Service is safe for concurrent use.
+type Service struct {
+	// AccountID is the account of the caller that uses long-term credentials.
+	AccountID string
+
+	// Now returns the current time. Replace it to control credential expiration in tests.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	roles    map[string]Role
+	sessions []Session
+	nextID   int
+}
+
+// New creates a Service with no registered roles.
+func New() *Service {
+	return &Service{
+		AccountID: "123456789012",
+		Now:       time.Now,
+		roles:     map[string]Role{},
+	}
+}
+
+var roleARN = regexp.MustCompile(`^arn:aws[a-z-]*:iam::(\d{12}):role/(?:[\w+=,.@-]+/)*([\w+=,.@-]{1,64})$`)
+
+var sessionName = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// roleID returns a stable unique ID for a role, like the AROA... IDs that IAM assigns.
+func roleID(arn string) string {
+	sum := md5.Sum([]byte(arn))
+	return "AROA" + strings.ToUpper(hex.EncodeToString(sum[:])[:17])
+}
+
+func errAccessDenied(roleArn string) error {
+	return &smithy.GenericAPIError{
+		Code:    "AccessDenied",
+		Message: "User is not authorized to perform: sts:AssumeRole on resource: " + roleArn,
+		Fault:   smithy.FaultClient,
+	}
+}
+
+func errValidation(message string) error {
+	return &smithy.GenericAPIError{Code: "ValidationError", Message: message, Fault: smithy.FaultClient}
+}
+
+// AddRole registers the trust requirements of a role.
+func (s *Service) AddRole(arn string, role Role) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roles[arn] = role
+}
+
+// Sessions returns the sessions created so far, oldest first.
+func (s *Service) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Session(nil), s.sessions...)
+}
+
+// LookupAccessKey returns the session that issued the access key,
+// and whether the key was issued by this Service and has not expired.
+func (s *Service) LookupAccessKey(accessKeyID string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.AccessKeyID == accessKeyID {
+			return session, s.Now().Before(session.Expiration)
+		}
+	}
+
+	return Session{}, false
+}
+
+// AssumeRoleFrom is AssumeRole on behalf of the caller that signed with callerAccessKeyID.
+// A caller using credentials from an earlier AssumeRole is limited to one-hour sessions, as in AWS STS.
+func (s *Service) AssumeRoleFrom(ctx context.Context, callerAccessKeyID string, params *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return s.assumeRole(callerAccessKeyID, params)
+}
+
+// AssumeRole returns temporary credentials for a role.
+func (s *Service) AssumeRole(ctx context.Context,
+	params *sts.AssumeRoleInput,
+	optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	return s.assumeRole("", params)
+}
+
+func (s *Service) assumeRole(caller string, params *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	arn := aws.ToString(params.RoleArn)
+	match := roleARN.FindStringSubmatch(arn)
+	if match == nil {
+		return nil, errValidation("1 validation error detected: Value '" + arn + "' at 'roleArn' failed to satisfy constraint")
+	}
+
+	name := aws.ToString(params.RoleSessionName)
+	if !sessionName.MatchString(name) {
+		return nil, errValidation("1 validation error detected: Value '" + name + "' at 'roleSessionName' failed to satisfy constraint")
+	}
+
+	role := s.roles[arn]
+	if role.MaxSessionDuration == 0 {
+		role.MaxSessionDuration = time.Hour
+	}
+
+	chained := false
+	for _, session := range s.sessions {
+		if caller != "" && session.AccessKeyID == caller {
+			chained = true
+		}
+	}
+
+	if chained && role.MaxSessionDuration > time.Hour {
+		role.MaxSessionDuration = time.Hour
+	}
+
+	duration := DefaultDuration
+	if params.DurationSeconds != nil {
+		duration = time.Duration(*params.DurationSeconds) * time.Second
+		if duration < 15*time.Minute || duration > 12*time.Hour {
+			return nil, errValidation("1 validation error detected: Value '" + fmt.Sprint(*params.DurationSeconds) + "' at 'durationSeconds' failed to satisfy constraint: Member must have value between 900 and 43200")
+		}
+
+		if duration > role.MaxSessionDuration {
+			return nil, errValidation("The requested DurationSeconds exceeds the MaxSessionDuration set for this role.")
+		}
+	}
+
+	if role.ExternalID != "" && aws.ToString(params.ExternalId) != role.ExternalID {
+		return nil, errAccessDenied(arn)
+	}
+
+	if role.MFASerial != "" {
+		if aws.ToString(params.SerialNumber) != role.MFASerial || aws.ToString(params.TokenCode) != role.MFACode {
+			return nil, errAccessDenied(arn)
+		}
+	}
+
+	if len(params.Tags) > 50 {
+		return nil, errValidation("1 validation error detected: Value at 'tags' failed to satisfy constraint: Member must have length less than or equal to 50")
+	}
+
+	tags := map[string]string{}
+	for _, tag := range params.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	for _, key := range params.TransitiveTagKeys {
+		if _, ok := tags[key]; !ok {
+			return nil, errValidation("The transitive tag key " + key + " is not one of the session tags.")
+		}
+	}
+
+	s.nextID++
+	id := fmt.Sprintf("%016X", s.nextID)
+	expiration := s.Now().Add(duration).UTC().Truncate(time.Second)
+
+	s.sessions = append(s.sessions, Session{
+		RoleArn:           arn,
+		RoleSessionName:   name,
+		ExternalID:        aws.ToString(params.ExternalId),
+		Tags:              tags,
+		AccessKeyID:       "ASIA" + id,
+		Expiration:        expiration,
+		CallerAccessKeyID: caller,
+	})
+
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser: &types.AssumedRoleUser{
+			Arn:           aws.String("arn:aws:sts::" + match[1] + ":assumed-role/" + match[2] + "/" + name),
+			AssumedRoleId: aws.String(roleID(arn) + ":" + name),
+		},
+		Credentials: &types.Credentials{
+			AccessKeyId:     aws.String("ASIA" + id),
+			SecretAccessKey: aws.String("secret-" + id),
+			SessionToken:    aws.String("token-" + id),
+			Expiration:      aws.Time(expiration),
+		},
+	}, nil
+}
+
+// GetCallerIdentity returns the identity of a caller that uses long-term credentials.
+func (s *Service) GetCallerIdentity(ctx context.Context,
+	params *sts.GetCallerIdentityInput,
+	optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return s.CallerIdentity(""), nil
+}
+
+// CallerIdentity returns the identity of the caller that signed with accessKeyID.
+// Keys issued by AssumeRole map to their assumed-role ARN; any other key is the account's user.
+func (s *Service) CallerIdentity(accessKeyID string) *sts.GetCallerIdentityOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.AccessKeyID == accessKeyID {
+			match := roleARN.FindStringSubmatch(session.RoleArn)
+			return &sts.GetCallerIdentityOutput{
+				Account: aws.String(match[1]),
+				Arn:     aws.String("arn:aws:sts::" + match[1] + ":assumed-role/" + match[2] + "/" + session.RoleSessionName),
+				UserId:  aws.String(roleID(session.RoleArn) + ":" + session.RoleSessionName),
+			}
+		}
+	}
+
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(s.AccountID),
+		Arn:     aws.String("arn:aws:iam::" + s.AccountID + ":user/local"),
+		UserId:  aws.String("AIDALOCALUSER"),
+	}
+}
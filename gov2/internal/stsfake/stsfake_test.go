@@ -0,0 +1,82 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package stsfake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const testRole = "arn:aws:iam::111122223333:role/doc-example-role"
+
+func TestAssumeRole(t *testing.T) {
+	now := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	s := New()
+	s.Now = func() time.Time { return now }
+
+	output, err := s.AssumeRole(context.Background(), &sts.AssumeRoleInput{
+		RoleArn:         aws.String(testRole),
+		RoleSessionName: aws.String("doc-example-session"),
+		DurationSeconds: aws.Int32(900),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := now.Add(15 * time.Minute); !aws.ToTime(output.Credentials.Expiration).Equal(want) {
+		t.Errorf("got expiration %v, want %v", aws.ToTime(output.Credentials.Expiration), want)
+	}
+
+	identity := s.CallerIdentity(aws.ToString(output.Credentials.AccessKeyId))
+	if aws.ToString(identity.Account) != "111122223333" {
+		t.Errorf("got account %v, want 111122223333", aws.ToString(identity.Account))
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := s.LookupAccessKey(aws.ToString(output.Credentials.AccessKeyId)); ok {
+		t.Error("credentials are still valid after they expired")
+	}
+}
+
+func TestAssumeRoleTrust(t *testing.T) {
+	s := New()
+	s.AddRole(testRole, Role{ExternalID: "doc-example-id", MFASerial: "arn:aws:iam::123456789012:mfa/user", MFACode: "123456"})
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(testRole),
+		RoleSessionName: aws.String("doc-example-session"),
+		ExternalId:      aws.String("doc-example-id"),
+	}
+
+	_, err := s.AssumeRole(context.Background(), input)
+	if err == nil {
+		t.Error("assumed a role that requires MFA without a token")
+	}
+
+	input.SerialNumber = aws.String("arn:aws:iam::123456789012:mfa/user")
+	input.TokenCode = aws.String("123456")
+
+	_, err = s.AssumeRole(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input.ExternalId = aws.String("wrong")
+
+	_, err = s.AssumeRole(context.Background(), input)
+	if err == nil {
+		t.Error("assumed a role with the wrong external ID")
+	}
+
+	input.ExternalId = aws.String("doc-example-id")
+	input.DurationSeconds = aws.Int32(7200)
+
+	_, err = s.AssumeRole(context.Background(), input)
+	if err == nil {
+		t.Error("assumed a role for longer than its MaxSessionDuration")
+	}
+}
@@ -8,12 +8,14 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3CopyObjectImpl struct{}
@@ -95,3 +97,54 @@ func TestCopyObject(t *testing.T) {
 
 	t.Log("Copied " + globalConfig.ObjectKey + " from " + globalConfig.SourceBucket + " to " + globalConfig.DestinationBucket)
 }
+
+func TestCopyObjectThenList(t *testing.T) {
+	api := s3fake.New()
+
+	for _, bucket := range []string{"doc-example-source", "doc-example-destination"} {
+		_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := api.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("doc-example-source"),
+		Key:    aws.String("item1"),
+		Body:   strings.NewReader("hello"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String("doc-example-destination"),
+		CopySource: aws.String(url.PathEscape("doc-example-source/item1")),
+		Key:        aws.String("item1"),
+	}
+
+	_, err = CopyItem(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := api.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: aws.String("doc-example-destination"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Contents) != 1 || *resp.Contents[0].Key != "item1" {
+		t.Errorf("Expected item1 in the destination bucket, got %d items", len(resp.Contents))
+	}
+
+	// Copying an object that doesn't exist fails
+	input.CopySource = aws.String("doc-example-source/missing")
+
+	_, err = CopyItem(context.Background(), api, input)
+	var noKey *types.NoSuchKey
+	if !errors.As(err, &noKey) {
+		t.Errorf("Expected NoSuchKey, got %v", err)
+	}
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3CreateBucketImpl struct{}
@@ -81,3 +83,31 @@ func TestCreateBucket(t *testing.T) {
 
 	t.Log("Created bucket " + globalConfig.BucketName + " in " + *resp.Location)
 }
+
+func TestCreateBucketTwice(t *testing.T) {
+	api := s3fake.New()
+
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String("doc-example-bucket"),
+	}
+
+	_, err := MakeBucket(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := api.ListBuckets(context.Background(), &s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Buckets) != 1 || *resp.Buckets[0].Name != "doc-example-bucket" {
+		t.Errorf("Expected one bucket named doc-example-bucket, got %d buckets", len(resp.Buckets))
+	}
+
+	_, err = MakeBucket(context.Background(), api, input)
+	var owned *types.BucketAlreadyOwnedByYou
+	if !errors.As(err, &owned) {
+		t.Errorf("Expected BucketAlreadyOwnedByYou, got %v", err)
+	}
+}
@@ -8,7 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3DeleteBucketImpl struct{}
@@ -79,3 +82,32 @@ func TestDeleteBucket(t *testing.T) {
 
 	t.Log("Deleted bucket " + globalConfig.BucketName)
 }
+
+func TestDeleteBucketThenHead(t *testing.T) {
+	api := s3fake.New()
+
+	input := &s3.DeleteBucketInput{
+		Bucket: aws.String("doc-example-bucket"),
+	}
+
+	_, err := RemoveBucket(context.Background(), api, input)
+	var noBucket *types.NoSuchBucket
+	if !errors.As(err, &noBucket) {
+		t.Errorf("Expected NoSuchBucket, got %v", err)
+	}
+
+	_, err = api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: input.Bucket})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = RemoveBucket(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: input.Bucket})
+	if !errors.As(err, &noBucket) {
+		t.Errorf("Expected NoSuchBucket after deleting the bucket, got %v", err)
+	}
+}
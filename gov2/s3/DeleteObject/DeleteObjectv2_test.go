@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3DeleteObjectImpl struct{}
@@ -79,3 +83,40 @@ func TestDeleteObject(t *testing.T) {
 
 	t.Log("Deleted " + globalConfig.ObjectName + " from bucket " + globalConfig.BucketName)
 }
+
+func TestDeleteObjectThenHead(t *testing.T) {
+	api := s3fake.New()
+
+	_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("item1"),
+		Body:   strings.NewReader("hello"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("item1"),
+	}
+
+	_, err = DeleteItem(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("item1"),
+	})
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NotFound" {
+		t.Errorf("Expected NotFound after deleting the object, got %v", err)
+	}
+}
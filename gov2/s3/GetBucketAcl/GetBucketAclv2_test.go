@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3GetBucketAclImpl struct{}
@@ -87,3 +88,33 @@ func TestGetBucketAcl(t *testing.T) {
 
 	t.Log("Grantee for bucket " + globalConfig.BucketName + ": " + *resp.Grants[0].Grantee.DisplayName)
 }
+
+func TestFindBucketAclPublicRead(t *testing.T) {
+	api := s3fake.New()
+
+	_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{
+		Bucket: aws.String("doc-example-bucket"),
+		ACL:    types.BucketCannedACLPublicRead,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := FindBucketAcl(context.Background(), api, &s3.GetBucketAclInput{
+		Bucket: aws.String("doc-example-bucket"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public := false
+	for _, g := range resp.Grants {
+		if aws.ToString(g.Grantee.URI) == s3fake.AllUsersURI && g.Permission == types.PermissionRead {
+			public = true
+		}
+	}
+
+	if !public {
+		t.Error("Expected a READ grant for all users")
+	}
+}
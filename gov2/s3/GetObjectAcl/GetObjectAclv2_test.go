@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3GetObjectAclImpl struct{}
@@ -85,3 +86,42 @@ func TestGetObjectAcl(t *testing.T) {
 
 	t.Log("Grantee for object " + globalConfig.ObjectName + ": " + *resp.Grants[0].Grantee.DisplayName)
 }
+
+func TestFindObjectAclMissingKey(t *testing.T) {
+	api := s3fake.New()
+
+	_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("item1"),
+		ACL:    types.ObjectCannedACLPrivate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := FindObjectAcl(context.Background(), api, &s3.GetObjectAclInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Grants) != 1 || resp.Grants[0].Permission != types.PermissionFullControl {
+		t.Errorf("Expected only the owner's FULL_CONTROL grant, got %d grants", len(resp.Grants))
+	}
+
+	_, err = FindObjectAcl(context.Background(), api, &s3.GetObjectAclInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("missing"),
+	})
+	var noKey *types.NoSuchKey
+	if !errors.As(err, &noKey) {
+		t.Errorf("Expected NoSuchKey, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3ListBucketsImpl struct{}
@@ -51,3 +52,23 @@ func TestListBuckets(t *testing.T) {
 		t.Log("  " + *b.Name)
 	}
 }
+
+func TestGetAllBucketsAfterCreate(t *testing.T) {
+	api := s3fake.New()
+
+	for _, bucket := range []string{"doc-example-bucket2", "doc-example-bucket1"} {
+		_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := GetAllBuckets(context.Background(), api, &s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Buckets) != 2 || *resp.Buckets[0].Name != "doc-example-bucket1" {
+		t.Errorf("Expected doc-example-bucket1 and doc-example-bucket2, got %d buckets", len(resp.Buckets))
+	}
+}
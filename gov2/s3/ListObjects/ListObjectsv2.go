@@ -10,6 +10,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3ListObjectsAPI defines the interface for the ListObjectsV2 function.
@@ -32,8 +33,83 @@ func GetObjects(c context.Context, api S3ListObjectsAPI, input *s3.ListObjectsV2
 	return api.ListObjectsV2(c, input)
 }
 
+// ObjectsSummary describes the objects visited by GetAllObjects.
+type ObjectsSummary struct {
+	// The number of objects passed to the callback
+	Count int
+	// The total size, in bytes, of those objects
+	Size int64
+	// The "directories" rolled up by the delimiter, if any
+	CommonPrefixes []string
+}
+
+// GetAllObjects retrieves all of the objects in an Amazon S3 bucket, one page at a time.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region
+//     api is the interface that defines the method call
+//     input defines the input arguments to the service call.
+//         Set Prefix and Delimiter to list the contents of a single "directory".
+//     maxItems is the maximum number of objects to visit, or 0 to visit them all
+//     fn is called for each object, in the order S3 returns them.
+//         If fn returns an error, GetAllObjects stops and returns that error.
+// Output:
+//     If success, an ObjectsSummary object containing the number and total size of the objects and nil
+//     Otherwise, an ObjectsSummary of the objects visited so far and an error from the call to ListObjectsV2 or fn
+func GetAllObjects(c context.Context, api S3ListObjectsAPI, input *s3.ListObjectsV2Input, maxItems int, fn func(types.Object) error) (*ObjectsSummary, error) {
+	summary := &ObjectsSummary{}
+
+	// Copy the input so we don't change the caller's ContinuationToken
+	params := *input
+
+	for {
+		// Don't ask for more keys than we still need
+		if maxItems > 0 {
+			remaining := int32(maxItems - summary.Count)
+			if params.MaxKeys == 0 || remaining < params.MaxKeys {
+				params.MaxKeys = remaining
+			}
+		}
+
+		resp, err := GetObjects(c, api, &params)
+		if err != nil {
+			return summary, err
+		}
+
+		for _, prefix := range resp.CommonPrefixes {
+			summary.CommonPrefixes = append(summary.CommonPrefixes, *prefix.Prefix)
+		}
+
+		for _, item := range resp.Contents {
+			if maxItems > 0 && summary.Count >= maxItems {
+				return summary, nil
+			}
+
+			err = fn(item)
+			if err != nil {
+				return summary, err
+			}
+
+			summary.Count++
+			summary.Size += item.Size
+		}
+
+		if maxItems > 0 && summary.Count >= maxItems {
+			return summary, nil
+		}
+
+		if !resp.IsTruncated || resp.NextContinuationToken == nil {
+			return summary, nil
+		}
+
+		params.ContinuationToken = resp.NextContinuationToken
+	}
+}
+
 func main() {
 	bucket := flag.String("b", "", "The name of the bucket")
+	prefix := flag.String("p", "", "Only list objects whose keys start with this prefix")
+	delimiter := flag.String("d", "", "Roll up keys containing this delimiter (for example, /) into directories")
+	maxItems := flag.Int("m", 0, "The maximum number of objects to list (0 lists all of them)")
 	flag.Parse()
 
 	if *bucket == "" {
@@ -52,24 +128,42 @@ func main() {
 		Bucket: bucket,
 	}
 
-	resp, err := GetObjects(context.TODO(), client, input)
-	if err != nil {
-		fmt.Println("Got error retrieving list of objects:")
-		fmt.Println(err)
-		return
+	if *prefix != "" {
+		input.Prefix = prefix
+	}
+
+	if *delimiter != "" {
+		input.Delimiter = delimiter
 	}
 
 	fmt.Println("Objects in " + *bucket + ":")
 
-	for _, item := range resp.Contents {
+	summary, err := GetAllObjects(context.TODO(), client, input, *maxItems, func(item types.Object) error {
 		fmt.Println("Name:          ", *item.Key)
 		fmt.Println("Last modified: ", *item.LastModified)
 		fmt.Println("Size:          ", item.Size)
 		fmt.Println("Storage class: ", item.StorageClass)
 		fmt.Println("")
+
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Got error retrieving list of objects:")
+		fmt.Println(err)
+		return
+	}
+
+	if len(summary.CommonPrefixes) > 0 {
+		fmt.Println("Directories:")
+
+		for _, p := range summary.CommonPrefixes {
+			fmt.Println("  " + p)
+		}
+
+		fmt.Println("")
 	}
 
-	fmt.Println("Found", len(resp.Contents), "items in bucket", *bucket)
+	fmt.Println("Found", summary.Count, "items totaling", summary.Size, "bytes in bucket", *bucket)
 	fmt.Println("")
 }
 
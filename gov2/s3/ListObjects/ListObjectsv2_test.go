@@ -4,29 +4,98 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
-type S3ListObjectsImpl struct{}
+// S3ListObjectsImpl serves Keys, which must be sorted, PageSize keys at a time.
+// If Keys is empty, it serves two dummy objects.
+type S3ListObjectsImpl struct {
+	Keys     []string
+	PageSize int
+}
 
 func (dt S3ListObjectsImpl) ListObjectsV2(ctx context.Context,
 	params *s3.ListObjectsV2Input,
 	optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
 
-	// Create a dummy list of two objects
-	objects := []types.Object{
-		{Key: aws.String("item1")},
-		{Key: aws.String("item2")},
+	keys := dt.Keys
+	if len(keys) == 0 {
+		// Create a dummy list of two objects
+		keys = []string{"item1", "item2"}
+	}
+
+	pageSize := dt.PageSize
+	if pageSize == 0 {
+		pageSize = 1000
+	}
+
+	if params.MaxKeys > 0 && int(params.MaxKeys) < pageSize {
+		pageSize = int(params.MaxKeys)
+	}
+
+	// The continuation token is the index of the next key to return
+	start := 0
+	if params.ContinuationToken != nil {
+		var err error
+		start, err = strconv.Atoi(*params.ContinuationToken)
+		if err != nil {
+			return nil, errors.New("invalid continuation token " + *params.ContinuationToken)
+		}
 	}
 
+	prefix := aws.ToString(params.Prefix)
+	delimiter := aws.ToString(params.Delimiter)
+
 	output := &s3.ListObjectsV2Output{
-		Contents: objects,
+		Name:   params.Bucket,
+		Prefix: params.Prefix,
+	}
+
+	i := start
+	for i < len(keys) && int(output.KeyCount) < pageSize {
+		key := keys[i]
+		i++
+
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if delimiter != "" {
+			n := strings.Index(key[len(prefix):], delimiter)
+			if n >= 0 {
+				// Roll up every key in this "directory" into one common prefix
+				commonPrefix := key[:len(prefix)+n+len(delimiter)]
+				for i < len(keys) && strings.HasPrefix(keys[i], commonPrefix) {
+					i++
+				}
+
+				output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+				output.KeyCount++
+				continue
+			}
+		}
+
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			LastModified: aws.Time(time.Now()),
+			Size:         int64(len(key)),
+		})
+		output.KeyCount++
+	}
+
+	if i < len(keys) {
+		output.IsTruncated = true
+		output.NextContinuationToken = aws.String(strconv.Itoa(i))
 	}
 
 	return output, nil
@@ -91,3 +160,175 @@ func TestListObjects(t *testing.T) {
 		t.Log("  " + *i.Key)
 	}
 }
+
+func TestGetAllObjects(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	// Create more keys than fit in one page
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("item%04d", i)
+	}
+
+	api := &S3ListObjectsImpl{
+		Keys: keys,
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String("doc-example-bucket"),
+	}
+
+	var got []string
+
+	summary, err := GetAllObjects(context.Background(), *api, input, 0, func(item types.Object) error {
+		got = append(got, *item.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Count != len(keys) || len(got) != len(keys) {
+		t.Fatalf("Expected %d items, got %d (callback saw %d)", len(keys), summary.Count, len(got))
+	}
+
+	if summary.Size != int64(len(keys)*len(keys[0])) {
+		t.Errorf("Expected %d bytes, got %d", len(keys)*len(keys[0]), summary.Size)
+	}
+
+	if got[len(got)-1] != keys[len(keys)-1] {
+		t.Errorf("Expected last item %s, got %s", keys[len(keys)-1], got[len(got)-1])
+	}
+
+	if input.ContinuationToken != nil {
+		t.Error("GetAllObjects changed the caller's input")
+	}
+}
+
+func TestGetAllObjectsMaxItems(t *testing.T) {
+	keys := make([]string, 25)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("item%02d", i)
+	}
+
+	api := &S3ListObjectsImpl{
+		Keys:     keys,
+		PageSize: 10,
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String("doc-example-bucket"),
+	}
+
+	summary, err := GetAllObjects(context.Background(), *api, input, 15, func(item types.Object) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Count != 15 {
+		t.Errorf("Expected 15 items, got %d", summary.Count)
+	}
+
+	// An error from the callback stops the listing
+	stop := errors.New("stop")
+
+	summary, err = GetAllObjects(context.Background(), *api, input, 0, func(item types.Object) error {
+		if *item.Key == "item12" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("Expected callback error, got %v", err)
+	}
+
+	if summary.Count != 12 {
+		t.Errorf("Expected 12 items before the error, got %d", summary.Count)
+	}
+}
+
+func TestGetAllObjectsDirectory(t *testing.T) {
+	api := &S3ListObjectsImpl{
+		Keys: []string{
+			"logs/2020/a.txt",
+			"logs/2020/b.txt",
+			"logs/2021/a.txt",
+			"logs/readme.txt",
+			"photos/cat.jpg",
+		},
+		PageSize: 2,
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String("doc-example-bucket"),
+		Prefix:    aws.String("logs/"),
+		Delimiter: aws.String("/"),
+	}
+
+	var got []string
+
+	summary, err := GetAllObjects(context.Background(), *api, input, 0, func(item types.Object) error {
+		got = append(got, *item.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || got[0] != "logs/readme.txt" {
+		t.Errorf("Expected only logs/readme.txt, got %v", got)
+	}
+
+	if strings.Join(summary.CommonPrefixes, ",") != "logs/2020/,logs/2021/" {
+		t.Errorf("Expected directories logs/2020/ and logs/2021/, got %v", summary.CommonPrefixes)
+	}
+}
+
+func TestGetAllObjectsAfterPut(t *testing.T) {
+	api := s3fake.New()
+
+	_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1500; i++ {
+		_, err = api.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String("doc-example-bucket"),
+			Key:    aws.String(fmt.Sprintf("item%04d", i)),
+			Body:   strings.NewReader("hello"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String("doc-example-bucket"),
+	}
+
+	summary, err := GetAllObjects(context.Background(), api, input, 0, func(item types.Object) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Count != 1500 || summary.Size != 1500*5 {
+		t.Errorf("Expected 1500 items totaling 7500 bytes, got %d items totaling %d bytes", summary.Count, summary.Size)
+	}
+
+	input.Bucket = aws.String("missing-bucket")
+
+	_, err = GetAllObjects(context.Background(), api, input, 0, func(item types.Object) error {
+		return nil
+	})
+	var noBucket *types.NoSuchBucket
+	if !errors.As(err, &noBucket) {
+		t.Errorf("Expected NoSuchBucket, got %v", err)
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[s3.go-v2.PutEncryptedObject]
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// KMSDataKeyAPI defines the interface for the GenerateDataKey and Decrypt functions.
+// We use this interface to test the functions using a fake key service.
+type KMSDataKeyAPI interface {
+	GenerateDataKey(ctx context.Context,
+		params *kms.GenerateDataKeyInput,
+		optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+
+	Decrypt(ctx context.Context,
+		params *kms.DecryptInput,
+		optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// S3ObjectAPI defines the interface for the PutObject and GetObject functions.
+// We use this interface to test the functions using a mocked service.
+type S3ObjectAPI interface {
+	PutObject(ctx context.Context,
+		params *s3.PutObjectInput,
+		optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+
+	GetObject(ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// The object metadata that holds what's needed to decrypt an object.
+// The data key is encrypted under an AWS KMS customer master key (CMK),
+// so only someone allowed to call kms:Decrypt with that CMK can read the object.
+const (
+	metadataAlgorithm = "envelope-alg"
+	metadataKey       = "envelope-key"
+	metadataIV        = "envelope-iv"
+
+	algorithm = "AES256-GCM-CHUNKED-64K"
+)
+
+// The body is encrypted in chunks of chunkSize bytes, each followed by its tagSize-byte authentication tag,
+// so neither encryption nor decryption has to hold the whole object in memory.
+// A chunk's nonce is the IV with the chunk number added to its last 8 bytes,
+// and its additional data marks whether it's the final chunk, so chunks can't be reordered, dropped, or truncated.
+const (
+	chunkSize = 64 * 1024
+	tagSize   = 16
+)
+
+func newGCM(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for chunk n
+func chunkNonce(iv []byte, n int64) []byte {
+	nonce := make([]byte, len(iv))
+	copy(nonce, iv)
+
+	counter := binary.BigEndian.Uint64(nonce[len(nonce)-8:])
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter^uint64(n))
+
+	return nonce
+}
+
+func chunkAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+
+	return []byte{0}
+}
+
+// encryptedSize returns the size of the encrypted form of size bytes.
+// Even an empty body has one chunk, so that it can't be truncated unnoticed.
+func encryptedSize(size int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	return size + chunks*tagSize
+}
+
+// decryptedSize is the inverse of encryptedSize
+func decryptedSize(size int64) int64 {
+	chunks := (size + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	return size - chunks*tagSize
+}
+
+// encryptingReader encrypts a plaintext stream as it's read
+type encryptingReader struct {
+	gcm cipher.AEAD
+	iv  []byte
+
+	src   io.Reader
+	plain *bufio.Reader
+	chunk int64
+	out   []byte
+	done  bool
+
+	// For Seek, the offset of the plaintext in src, its size, and the position in the ciphertext
+	start int64
+	size  int64
+	pos   int64
+}
+
+// next encrypts the next chunk into r.out
+func (r *encryptingReader) next() error {
+	buf := make([]byte, chunkSize)
+	n, err := io.ReadFull(r.plain, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	final := n < chunkSize
+	if !final {
+		_, err := r.plain.Peek(1)
+		if err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out = r.gcm.Seal(nil, chunkNonce(r.iv, r.chunk), buf[:n], chunkAAD(final))
+	r.chunk++
+	r.done = final
+
+	return nil
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	if len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		err := r.next()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	r.pos += int64(n)
+
+	return n, nil
+}
+
+// Seek moves to an offset in the ciphertext, by reencrypting the chunk that holds it.
+// The SDK seeks to compute the length and checksum of a request body.
+func (r *encryptingReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.src.(io.Seeker)
+	if !ok {
+		return 0, errors.New("the plaintext doesn't support Seek")
+	}
+
+	total := encryptedSize(r.size)
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += total
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	r.pos = offset
+	r.out = nil
+
+	if offset >= total {
+		r.done = true
+		return offset, nil
+	}
+
+	r.chunk = offset / (chunkSize + tagSize)
+	r.done = false
+
+	_, err := seeker.Seek(r.start+r.chunk*chunkSize, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	r.plain.Reset(r.src)
+
+	err = r.next()
+	if err != nil {
+		return 0, err
+	}
+
+	r.out = r.out[offset%(chunkSize+tagSize):]
+
+	return offset, nil
+}
+
+// readerOnly hides any Seek method of a reader
+type readerOnly struct {
+	io.Reader
+}
+
+// newEncryptingReader returns a reader of the encrypted form of src.
+// If src is an io.ReadSeeker, such as an *os.File, so is the reader, and the size of the ciphertext is returned too.
+// Otherwise the size is -1.
+func newEncryptingReader(src io.Reader, dataKey, iv []byte) (io.Reader, int64, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := &encryptingReader{
+		gcm:   gcm,
+		iv:    iv,
+		src:   src,
+		plain: bufio.NewReaderSize(src, chunkSize),
+	}
+
+	seeker, ok := src.(io.Seeker)
+	if !ok {
+		return readerOnly{r}, -1, nil
+	}
+
+	r.start, err = seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, err = seeker.Seek(r.start, io.SeekStart)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r.size = end - r.start
+
+	return r, encryptedSize(r.size), nil
+}
+
+// decryptingReader decrypts and authenticates a ciphertext stream as it's read
+type decryptingReader struct {
+	gcm   cipher.AEAD
+	iv    []byte
+	body  io.ReadCloser
+	in    *bufio.Reader
+	chunk int64
+	out   []byte
+	done  bool
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		buf := make([]byte, chunkSize+tagSize)
+		n, err := io.ReadFull(r.in, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		final := n < len(buf)
+		if !final {
+			_, err := r.in.Peek(1)
+			if err == io.EOF {
+				final = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+
+		r.out, err = r.gcm.Open(nil, chunkNonce(r.iv, r.chunk), buf[:n], chunkAAD(final))
+		if err != nil {
+			return 0, fmt.Errorf("chunk %d of the object is corrupt or truncated", r.chunk+1)
+		}
+
+		r.chunk++
+		r.done = final
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+
+	return n, nil
+}
+
+func (r *decryptingReader) Close() error {
+	return r.body.Close()
+}
+
+// PutEncryptedFile encrypts an object body with a new data key from AWS KMS and uploads it to an Amazon S3 bucket.
+// The data key, encrypted under the CMK, and the IV are stored as object metadata.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region
+//     kmsAPI is the interface that defines the AWS KMS method calls
+//     s3API is the interface that defines the Amazon S3 method calls
+//     keyID is the ID, ARN, or alias of the CMK that encrypts the data key
+//     input defines the input arguments to the PutObject call. If its Body is an io.ReadSeeker, such as an *os.File,
+//         so is the encrypted body, which the SDK needs to sign the request if the endpoint doesn't use HTTPS.
+// Output:
+//     If success, a PutObjectOutput object containing the result of the service call and nil
+//     Otherwise, nil and an error from the call to GenerateDataKey or PutObject
+func PutEncryptedFile(c context.Context, kmsAPI KMSDataKeyAPI, s3API S3ObjectAPI, keyID *string, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	dataKey, err := kmsAPI.GenerateDataKey(c, &kms.GenerateDataKeyInput{
+		KeyId:   keyID,
+		KeySpec: kmstypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, 12)
+	_, err = rand.Read(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader = strings.NewReader("")
+	if input.Body != nil {
+		body = input.Body
+	}
+
+	encrypted, size, err := newEncryptingReader(body, dataKey.Plaintext, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the input, so the caller's is left alone
+	params := *input
+	params.Body = encrypted
+	params.ContentMD5 = nil
+	params.ContentLength = 0
+	if size >= 0 {
+		params.ContentLength = size
+	}
+
+	params.Metadata = map[string]string{}
+	for k, v := range input.Metadata {
+		params.Metadata[k] = v
+	}
+
+	params.Metadata[metadataAlgorithm] = algorithm
+	params.Metadata[metadataKey] = base64.StdEncoding.EncodeToString(dataKey.CiphertextBlob)
+	params.Metadata[metadataIV] = base64.StdEncoding.EncodeToString(iv)
+
+	return s3API.PutObject(c, &params)
+}
+
+// metadataValue looks up metadata without regard to case
+func metadataValue(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// GetDecryptedObject gets an object that PutEncryptedFile uploaded, and decrypts its body as it's read.
+// Reading the body returns an error if any part of the object was changed.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region
+//     kmsAPI is the interface that defines the AWS KMS method calls
+//     s3API is the interface that defines the Amazon S3 method calls
+//     input defines the input arguments to the GetObject call. Range isn't supported.
+// Output:
+//     If success, a GetObjectOutput object with the decrypted body and its length, and nil
+//     Otherwise, nil and an error from the call to GetObject or Decrypt, or because the object isn't encrypted
+func GetDecryptedObject(c context.Context, kmsAPI KMSDataKeyAPI, s3API S3ObjectAPI, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	if input.Range != nil {
+		return nil, errors.New("a range of an encrypted object can't be decrypted")
+	}
+
+	output, err := s3API.GetObject(c, input)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, iv, err := decryptDataKey(c, kmsAPI, output.Metadata)
+	if err != nil {
+		output.Body.Close()
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		output.Body.Close()
+		return nil, err
+	}
+
+	output.Body = &decryptingReader{
+		gcm:  gcm,
+		iv:   iv,
+		body: output.Body,
+		in:   bufio.NewReaderSize(output.Body, chunkSize+tagSize),
+	}
+	output.ContentLength = decryptedSize(output.ContentLength)
+
+	return output, nil
+}
+
+// decryptDataKey gets the data key and IV of an object from its metadata
+func decryptDataKey(c context.Context, kmsAPI KMSDataKeyAPI, metadata map[string]string) ([]byte, []byte, error) {
+	if alg := metadataValue(metadata, metadataAlgorithm); alg != algorithm {
+		return nil, nil, fmt.Errorf("the object isn't encrypted with %s: %s is %q", algorithm, metadataAlgorithm, alg)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(metadataValue(metadata, metadataKey))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iv, err := base64.StdEncoding.DecodeString(metadataValue(metadata, metadataIV))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(iv) != 12 {
+		return nil, nil, fmt.Errorf("the IV has %d bytes, want 12", len(iv))
+	}
+
+	output, err := kmsAPI.Decrypt(c, &kms.DecryptInput{
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output.Plaintext, iv, nil
+}
+
+func main() {
+	bucket := flag.String("b", "", "The bucket to upload the file to")
+	filename := flag.String("f", "", "The file to upload")
+	keyID := flag.String("k", "", "The ID, ARN, or alias of the AWS KMS key that encrypts the data key")
+	output := flag.String("o", "", "If set, the file to download the object to and decrypt, to check it")
+	flag.Parse()
+
+	if *bucket == "" || *filename == "" || *keyID == "" {
+		fmt.Println("You must supply a bucket name (-b BUCKET), file name (-f FILE), and KMS key (-k KEY-ID)")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	kmsClient := kms.NewFromConfig(cfg)
+	s3Client := s3.NewFromConfig(cfg)
+
+	file, err := os.Open(*filename)
+	if err != nil {
+		fmt.Println("Unable to open file " + *filename)
+		return
+	}
+
+	defer file.Close()
+
+	input := &s3.PutObjectInput{
+		Bucket: bucket,
+		Key:    filename,
+		Body:   file,
+	}
+
+	_, err = PutEncryptedFile(context.TODO(), kmsClient, s3Client, keyID, input)
+	if err != nil {
+		fmt.Println("Got error uploading file:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("Uploaded " + *filename + " encrypted under " + *keyID)
+
+	if *output == "" {
+		return
+	}
+
+	resp, err := GetDecryptedObject(context.TODO(), kmsClient, s3Client, &s3.GetObjectInput{
+		Bucket: bucket,
+		Key:    filename,
+	})
+	if err != nil {
+		fmt.Println("Got error downloading file:")
+		fmt.Println(err)
+		return
+	}
+
+	defer resp.Body.Close()
+
+	out, err := os.Create(*output)
+	if err != nil {
+		fmt.Println("Unable to create file " + *output)
+		return
+	}
+
+	defer out.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	if err != nil {
+		fmt.Println("Got error decrypting file:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("Downloaded and decrypted " + *filename + " to " + *output)
+}
+
+// snippet-end:[s3.go-v2.PutEncryptedObject]
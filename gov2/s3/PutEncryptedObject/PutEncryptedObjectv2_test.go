@@ -0,0 +1,260 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/kmsfake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
+)
+
+func newKeyService(t *testing.T) (*kmsfake.Service, *string) {
+	keys := kmsfake.New()
+
+	output, err := keys.CreateKey(context.Background(), &kms.CreateKeyInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys, output.KeyMetadata.KeyId
+}
+
+func newBucket(t *testing.T) *s3fake.Service {
+	api := s3fake.New()
+
+	_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// getDecrypted gets and decrypts an object, returning its body or the error from reading it
+func getDecrypted(t *testing.T, keys KMSDataKeyAPI, api S3ObjectAPI, key string) ([]byte, error) {
+	resp, err := GetDecryptedObject(context.Background(), keys, api, &s3.GetObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil && int64(len(body)) != resp.ContentLength {
+		t.Errorf("got %d bytes, but ContentLength %d", len(body), resp.ContentLength)
+	}
+
+	return body, err
+}
+
+func TestPutEncryptedFileRoundTrip(t *testing.T) {
+	keys, keyID := newKeyService(t)
+	api := newBucket(t)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 100} {
+		plaintext := randomBytes(t, size)
+
+		_, err := PutEncryptedFile(context.Background(), keys, api, keyID, &s3.PutObjectInput{
+			Bucket:   aws.String("doc-example-bucket"),
+			Key:      aws.String("secret"),
+			Body:     bytes.NewReader(plaintext),
+			Metadata: map[string]string{"owner": "doc-example"},
+		})
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		stored, err := api.GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("doc-example-bucket"),
+			Key:    aws.String("secret"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ciphertext, _ := ioutil.ReadAll(stored.Body)
+		if int64(len(ciphertext)) != encryptedSize(int64(size)) || stored.Metadata["owner"] != "doc-example" {
+			t.Errorf("%d bytes: stored %d bytes with metadata %v", size, len(ciphertext), stored.Metadata)
+		}
+
+		if size > 0 && bytes.Contains(ciphertext, plaintext) {
+			t.Errorf("%d bytes: the object contains the plaintext", size)
+		}
+
+		got, err := getDecrypted(t, keys, api, "secret")
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes: the round trip changed the body", size)
+		}
+	}
+}
+
+func TestGetDecryptedObjectTampered(t *testing.T) {
+	keys, keyID := newKeyService(t)
+	api := newBucket(t)
+
+	_, err := PutEncryptedFile(context.Background(), keys, api, keyID, &s3.PutObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("secret"),
+		Body:   bytes.NewReader(randomBytes(t, 2*chunkSize+10)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := api.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("secret"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, _ := ioutil.ReadAll(stored.Body)
+
+	flipped := append([]byte{}, ciphertext...)
+	flipped[chunkSize+tagSize+5] ^= 1
+
+	tests := map[string][]byte{
+		"flipped bit":     flipped,
+		"dropped chunk":   ciphertext[:2*(chunkSize+tagSize)],
+		"truncated chunk": ciphertext[:len(ciphertext)-1],
+		"reordered":       append(append(append([]byte{}, ciphertext[chunkSize+tagSize:2*(chunkSize+tagSize)]...), ciphertext[:chunkSize+tagSize]...), ciphertext[2*(chunkSize+tagSize):]...),
+	}
+
+	for name, body := range tests {
+		_, err := api.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:   aws.String("doc-example-bucket"),
+			Key:      aws.String(name),
+			Body:     bytes.NewReader(body),
+			Metadata: stored.Metadata,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = getDecrypted(t, keys, api, name)
+		if err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestEncryptingReaderSeek(t *testing.T) {
+	plaintext := randomBytes(t, 2*chunkSize+10)
+	dataKey := randomBytes(t, 32)
+	iv := randomBytes(t, 12)
+
+	r, size, err := newEncryptingReader(bytes.NewReader(plaintext), dataKey, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(len(all)) != size {
+		t.Fatalf("read %d bytes, want %d", len(all), size)
+	}
+
+	seeker := r.(io.Seeker)
+	for _, offset := range []int64{0, 7, chunkSize + tagSize, chunkSize + tagSize + 3, size - 1, size} {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rest, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(rest, all[offset:]) {
+			t.Errorf("reading from offset %d doesn't match", offset)
+		}
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil || end != size {
+		t.Errorf("got end %d, %v, want %d", end, err, size)
+	}
+}
+
+func TestPutEncryptedFileLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	_, err := server.S3.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, keyID := newKeyService(t)
+	plaintext := randomBytes(t, chunkSize+1000)
+
+	file, err := ioutil.TempFile("", "PutEncryptedObjectv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := s3.NewFromConfig(server.Config())
+
+	_, err = PutEncryptedFile(context.Background(), keys, client, keyID, &s3.PutObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("secret"),
+		Body:   file,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := getDecrypted(t, keys, client, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, plaintext) {
+		t.Error("the round trip through the SDK changed the body")
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
 )
 
 type S3PutObjectImpl struct{}
@@ -82,3 +86,97 @@ func TestPubObject(t *testing.T) {
 
 	t.Log("Uploaded version " + *resp.VersionId + " of " + globalConfig.FileName + " to bucket " + globalConfig.BucketName)
 }
+
+func TestPutFileThenGet(t *testing.T) {
+	api := s3fake.New()
+
+	_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("item1"),
+		Body:   strings.NewReader("hello"),
+	}
+
+	_, err = PutFile(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := api.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("item1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "hello" {
+		t.Errorf("Expected hello, got %q", body)
+	}
+}
+
+func TestPutFileLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	_, err := server.S3.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("doc-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ioutil.TempFile("", "PutObjectv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.WriteString("hello from a file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := s3.NewFromConfig(server.Config())
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("myfile"),
+		Body:   file,
+	}
+
+	_, err = PutFile(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := server.S3.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("doc-example-bucket"),
+		Key:    aws.String("myfile"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "hello from a file" {
+		t.Errorf("Expected hello from a file, got %q", body)
+	}
+}
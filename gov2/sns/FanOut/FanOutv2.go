@@ -0,0 +1,468 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[sns.go-v2.FanOut]
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SNSFanOutAPI defines the interface for the ListTopics, CreateTopic, ListSubscriptionsByTopic, Subscribe, Unsubscribe, and DeleteTopic functions.
+// We use this interface to test the functions using a mocked service.
+type SNSFanOutAPI interface {
+	ListTopics(ctx context.Context,
+		params *sns.ListTopicsInput,
+		optFns ...func(*sns.Options)) (*sns.ListTopicsOutput, error)
+
+	CreateTopic(ctx context.Context,
+		params *sns.CreateTopicInput,
+		optFns ...func(*sns.Options)) (*sns.CreateTopicOutput, error)
+
+	ListSubscriptionsByTopic(ctx context.Context,
+		params *sns.ListSubscriptionsByTopicInput,
+		optFns ...func(*sns.Options)) (*sns.ListSubscriptionsByTopicOutput, error)
+
+	Subscribe(ctx context.Context,
+		params *sns.SubscribeInput,
+		optFns ...func(*sns.Options)) (*sns.SubscribeOutput, error)
+
+	Unsubscribe(ctx context.Context,
+		params *sns.UnsubscribeInput,
+		optFns ...func(*sns.Options)) (*sns.UnsubscribeOutput, error)
+
+	DeleteTopic(ctx context.Context,
+		params *sns.DeleteTopicInput,
+		optFns ...func(*sns.Options)) (*sns.DeleteTopicOutput, error)
+}
+
+// SQSFanOutAPI defines the interface for the GetQueueUrl, CreateQueue, GetQueueAttributes, SetQueueAttributes, and DeleteQueue functions.
+// We use this interface to test the functions using a mocked service.
+type SQSFanOutAPI interface {
+	GetQueueUrl(ctx context.Context,
+		params *sqs.GetQueueUrlInput,
+		optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+
+	CreateQueue(ctx context.Context,
+		params *sqs.CreateQueueInput,
+		optFns ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error)
+
+	GetQueueAttributes(ctx context.Context,
+		params *sqs.GetQueueAttributesInput,
+		optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+
+	SetQueueAttributes(ctx context.Context,
+		params *sqs.SetQueueAttributesInput,
+		optFns ...func(*sqs.Options)) (*sqs.SetQueueAttributesOutput, error)
+
+	DeleteQueue(ctx context.Context,
+		params *sqs.DeleteQueueInput,
+		optFns ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error)
+}
+
+// QueueSpec describes one queue of a fan-out.
+type QueueSpec struct {
+	// Name is the name of the queue
+	Name string
+
+	// FilterPolicy is the subscription filter policy that selects the messages the queue gets.
+	// If it's empty, the queue gets every message published to the topic.
+	FilterPolicy string
+}
+
+// FanOutQueue is a queue used by CreateFanOut, with its subscription to the topic.
+type FanOutQueue struct {
+	Name            string
+	QueueURL        string
+	QueueARN        string
+	SubscriptionARN string
+
+	// Created is true if CreateFanOut created the queue, and false if it already existed
+	Created bool
+
+	// PolicySet is true if CreateFanOut gave an existing queue its policy
+	PolicySet bool
+
+	// Subscribed is true if CreateFanOut subscribed the queue to the topic, and false if the subscription already existed
+	Subscribed bool
+}
+
+// FanOut is the topic and queues used by CreateFanOut.
+// Teardown deletes only what CreateFanOut created, as recorded here.
+type FanOut struct {
+	TopicARN string
+
+	// Created is true if CreateFanOut created the topic, and false if it already existed
+	Created bool
+
+	Queues []FanOutQueue
+}
+
+// ErrQueuePolicyExists is returned by CreateFanOut for an existing queue that has a different policy,
+// which CreateFanOut won't replace.
+var ErrQueuePolicyExists = errors.New("the queue already has a policy")
+
+// QueuePolicy returns a queue policy that lets an Amazon Simple Notification Service (Amazon SNS) topic
+// send messages to an Amazon Simple Queue Service (Amazon SQS) queue, and nothing else.
+// Inputs:
+//     queueARN is the ARN of the queue.
+//     topicARN is the ARN of the topic.
+// Output:
+//     The policy document.
+func QueuePolicy(queueARN, topicARN string) string {
+	policy := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Sid":       "AllowTopicToSendMessages",
+				"Effect":    "Allow",
+				"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+				"Action":    "sqs:SendMessage",
+				"Resource":  queueARN,
+				"Condition": map[string]interface{}{
+					"ArnEquals": map[string]string{"aws:SourceArn": topicARN},
+				},
+			},
+		},
+	}
+
+	data, _ := json.Marshal(policy)
+
+	return string(data)
+}
+
+// CreateFanOut creates an Amazon SNS topic and an Amazon SQS queue for each spec,
+// lets the topic send messages to each queue, and subscribes each queue to the topic
+// with its filter policy and raw message delivery.
+// A topic or queue that already exists is used as it is, and an existing queue policy isn't replaced.
+// If a step fails, CreateFanOut undoes what it did before returning the error.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     snsAPI and sqsAPI are the interfaces that define the method calls.
+//     topicName is the name of the topic.
+//     specs describe the queues.
+// Output:
+//     If success, a FanOut object describing the topic and queues, and nil.
+//     Otherwise, nil and an error from a call to Amazon SNS or Amazon SQS.
+func CreateFanOut(c context.Context, snsAPI SNSFanOutAPI, sqsAPI SQSFanOutAPI, topicName string, specs []QueueSpec) (*FanOut, error) {
+	topicARN, err := findTopic(c, snsAPI, topicName)
+	if err != nil {
+		return nil, fmt.Errorf("find topic %s: %w", topicName, err)
+	}
+
+	f := &FanOut{TopicARN: topicARN}
+
+	if topicARN == "" {
+		topic, err := snsAPI.CreateTopic(c, &sns.CreateTopicInput{Name: aws.String(topicName)})
+		if err != nil {
+			return nil, fmt.Errorf("create topic %s: %w", topicName, err)
+		}
+
+		f.TopicARN = *topic.TopicArn
+		f.Created = true
+	}
+
+	for _, spec := range specs {
+		q, err := addQueue(c, snsAPI, sqsAPI, f.TopicARN, spec)
+		if q.QueueURL != "" {
+			f.Queues = append(f.Queues, q)
+		}
+
+		if err != nil {
+			Teardown(context.Background(), snsAPI, sqsAPI, f)
+			return nil, fmt.Errorf("queue %s: %w", spec.Name, err)
+		}
+	}
+
+	return f, nil
+}
+
+// findTopic returns the ARN of the topic with a name, or "" if there's none.
+func findTopic(c context.Context, api SNSFanOutAPI, name string) (string, error) {
+	input := &sns.ListTopicsInput{}
+
+	for {
+		output, err := api.ListTopics(c, input)
+		if err != nil {
+			return "", err
+		}
+
+		for _, t := range output.Topics {
+			if strings.HasSuffix(aws.ToString(t.TopicArn), ":"+name) {
+				return *t.TopicArn, nil
+			}
+		}
+
+		if output.NextToken == nil {
+			return "", nil
+		}
+
+		input.NextToken = output.NextToken
+	}
+}
+
+// findSubscription returns the ARN of the subscription of a queue to a topic, or "" if there's none.
+func findSubscription(c context.Context, api SNSFanOutAPI, topicARN, queueARN string) (string, error) {
+	input := &sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(topicARN)}
+
+	for {
+		output, err := api.ListSubscriptionsByTopic(c, input)
+		if err != nil {
+			return "", err
+		}
+
+		for _, sub := range output.Subscriptions {
+			if aws.ToString(sub.Protocol) == "sqs" && aws.ToString(sub.Endpoint) == queueARN {
+				return *sub.SubscriptionArn, nil
+			}
+		}
+
+		if output.NextToken == nil {
+			return "", nil
+		}
+
+		input.NextToken = output.NextToken
+	}
+}
+
+// samePolicy returns whether two policy documents are the same, apart from formatting.
+func samePolicy(a, b string) bool {
+	var da, db interface{}
+	if json.Unmarshal([]byte(a), &da) != nil || json.Unmarshal([]byte(b), &db) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(da, db)
+}
+
+// addQueue creates one queue, unless it exists, and subscribes it to the topic, unless it is subscribed.
+// If a step fails, it returns as much of the queue as it set up, so that Teardown can undo it.
+func addQueue(c context.Context, snsAPI SNSFanOutAPI, sqsAPI SQSFanOutAPI, topicARN string, spec QueueSpec) (FanOutQueue, error) {
+	q := FanOutQueue{Name: spec.Name}
+
+	existing, err := sqsAPI.GetQueueUrl(c, &sqs.GetQueueUrlInput{QueueName: aws.String(spec.Name)})
+
+	var notExist *types.QueueDoesNotExist
+	switch {
+	case err == nil:
+		q.QueueURL = *existing.QueueUrl
+	case errors.As(err, &notExist):
+		created, err := sqsAPI.CreateQueue(c, &sqs.CreateQueueInput{QueueName: aws.String(spec.Name)})
+		if err != nil {
+			return q, err
+		}
+
+		q.QueueURL = *created.QueueUrl
+		q.Created = true
+	default:
+		return q, err
+	}
+
+	attributes, err := sqsAPI.GetQueueAttributes(c, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(q.QueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueuearn, types.QueueAttributeNamePolicy},
+	})
+	if err != nil {
+		return q, err
+	}
+
+	q.QueueARN = attributes.Attributes[string(types.QueueAttributeNameQueuearn)]
+	policy := QueuePolicy(q.QueueARN, topicARN)
+
+	// Replacing a policy that isn't ours could take away someone else's access to the queue
+	current := attributes.Attributes[string(types.QueueAttributeNamePolicy)]
+	switch {
+	case current == "":
+		_, err = sqsAPI.SetQueueAttributes(c, &sqs.SetQueueAttributesInput{
+			QueueUrl:   aws.String(q.QueueURL),
+			Attributes: map[string]string{string(types.QueueAttributeNamePolicy): policy},
+		})
+		if err != nil {
+			return q, err
+		}
+
+		q.PolicySet = !q.Created
+	case !samePolicy(current, policy):
+		return q, ErrQueuePolicyExists
+	}
+
+	// Subscribe returns the ARN of an existing subscription too, which Teardown must keep
+	existingARN, err := findSubscription(c, snsAPI, topicARN, q.QueueARN)
+	if err != nil {
+		return q, err
+	}
+
+	if existingARN != "" {
+		q.SubscriptionARN = existingARN
+		return q, nil
+	}
+
+	subAttributes := map[string]string{"RawMessageDelivery": "true"}
+	if spec.FilterPolicy != "" {
+		subAttributes["FilterPolicy"] = spec.FilterPolicy
+	}
+
+	sub, err := snsAPI.Subscribe(c, &sns.SubscribeInput{
+		TopicArn:              aws.String(topicARN),
+		Protocol:              aws.String("sqs"),
+		Endpoint:              aws.String(q.QueueARN),
+		Attributes:            subAttributes,
+		ReturnSubscriptionArn: true,
+	})
+	if err != nil {
+		return q, err
+	}
+
+	q.SubscriptionARN = *sub.SubscriptionArn
+	q.Subscribed = true
+
+	return q, nil
+}
+
+// Teardown deletes the subscriptions, queues, and topic that CreateFanOut created.
+// Subscriptions, queues, and a topic that already existed are kept,
+// and the policy that CreateFanOut gave an existing queue is removed.
+// It keeps going after an error, so that it undoes as much as it can.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     snsAPI and sqsAPI are the interfaces that define the method calls.
+//     f is the fan-out to delete.
+// Output:
+//     If success, nil.
+//     Otherwise, the first error from a call to Amazon SNS or Amazon SQS.
+func Teardown(c context.Context, snsAPI SNSFanOutAPI, sqsAPI SQSFanOutAPI, f *FanOut) error {
+	var first error
+	record := func(err error, what string) {
+		if err != nil && first == nil {
+			first = fmt.Errorf("%s: %w", what, err)
+		}
+	}
+
+	for _, q := range f.Queues {
+		if q.Subscribed {
+			_, err := snsAPI.Unsubscribe(c, &sns.UnsubscribeInput{SubscriptionArn: aws.String(q.SubscriptionARN)})
+			record(err, "unsubscribe queue "+q.Name)
+		}
+
+		if q.Created {
+			_, err := sqsAPI.DeleteQueue(c, &sqs.DeleteQueueInput{QueueUrl: aws.String(q.QueueURL)})
+			record(err, "delete queue "+q.Name)
+		} else if q.PolicySet {
+			_, err := sqsAPI.SetQueueAttributes(c, &sqs.SetQueueAttributesInput{
+				QueueUrl:   aws.String(q.QueueURL),
+				Attributes: map[string]string{string(types.QueueAttributeNamePolicy): ""},
+			})
+			record(err, "remove the policy of queue "+q.Name)
+		}
+	}
+
+	if f.Created {
+		_, err := snsAPI.DeleteTopic(c, &sns.DeleteTopicInput{TopicArn: aws.String(f.TopicARN)})
+		record(err, "delete topic")
+	}
+
+	return first
+}
+
+// queueFlags collects -q flags of the form NAME or NAME=FILTER-POLICY.
+type queueFlags []QueueSpec
+
+func (q *queueFlags) String() string {
+	names := make([]string, len(*q))
+	for i, spec := range *q {
+		names[i] = spec.Name
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (q *queueFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if parts[0] == "" {
+		return errors.New("the queue name is empty")
+	}
+
+	spec := QueueSpec{Name: parts[0]}
+	if len(parts) == 2 {
+		spec.FilterPolicy = parts[1]
+	}
+
+	*q = append(*q, spec)
+
+	return nil
+}
+
+// existed returns a note for a topic, queue, or subscription that CreateFanOut didn't create.
+func existed(created bool) string {
+	if created {
+		return ""
+	}
+
+	return " (already existed)"
+}
+
+func main() {
+	var queues queueFlags
+	topicName := flag.String("t", "", "The name of the topic")
+	flag.Var(&queues, "q", "A queue to create, as NAME or NAME=FILTER-POLICY (can be repeated)")
+	keep := flag.Bool("k", false, "Whether to keep the topic and queues instead of deleting them")
+	flag.Parse()
+
+	if *topicName == "" || len(queues) == 0 {
+		fmt.Println("You must supply a topic name and at least one queue")
+		fmt.Println("-t TOPIC -q QUEUE[=FILTER-POLICY] [-q QUEUE[=FILTER-POLICY] ...] [-k]")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	snsClient := sns.NewFromConfig(cfg)
+	sqsClient := sqs.NewFromConfig(cfg)
+
+	f, err := CreateFanOut(context.TODO(), snsClient, sqsClient, *topicName, queues)
+	if err != nil {
+		fmt.Println("Got an error creating the fan-out:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("Topic: " + f.TopicARN + existed(f.Created))
+	for _, q := range f.Queues {
+		fmt.Println("Queue: " + q.QueueURL + existed(q.Created))
+		fmt.Println("    Subscription: " + q.SubscriptionARN + existed(q.Subscribed))
+	}
+
+	if *keep {
+		return
+	}
+
+	fmt.Println("Press Enter to delete the subscriptions, topic, and queues that were created")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+
+	err = Teardown(context.TODO(), snsClient, sqsClient, f)
+	if err != nil {
+		fmt.Println("Got an error deleting the fan-out:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("Deleted the fan-out")
+}
+
+// snippet-end:[sns.go-v2.FanOut]
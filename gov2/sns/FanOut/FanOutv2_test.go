@@ -0,0 +1,444 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/iampolicy"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/snsfake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/snsfilter"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/sqsfake"
+)
+
+// The routing rules of the tests: placed orders, large orders, and everything
+var testSpecs = []QueueSpec{
+	{Name: "aws-docs-example-placed", FilterPolicy: `{"event":["order_placed"]}`},
+	{Name: "aws-docs-example-large", FilterPolicy: `{"event":[{"prefix":"order_"}],"total":[{"numeric":[">=",1000]}]}`},
+	{Name: "aws-docs-example-audit"},
+}
+
+func attributes(event string, total string) map[string]snstypes.MessageAttributeValue {
+	return map[string]snstypes.MessageAttributeValue{
+		"event": {DataType: aws.String("String"), StringValue: aws.String(event)},
+		"total": {DataType: aws.String("Number"), StringValue: aws.String(total)},
+	}
+}
+
+// The messages of the tests, with the queues each one should reach
+var testMessages = []struct {
+	event, total string
+	queues       []string
+}{
+	{"order_placed", "25", []string{"aws-docs-example-placed", "aws-docs-example-audit"}},
+	{"order_placed", "1500", []string{"aws-docs-example-placed", "aws-docs-example-large", "aws-docs-example-audit"}},
+	{"order_cancelled", "1000", []string{"aws-docs-example-large", "aws-docs-example-audit"}},
+	{"refund_issued", "2000", []string{"aws-docs-example-audit"}},
+}
+
+func TestRoutingRules(t *testing.T) {
+	for _, m := range testMessages {
+		var got []string
+		for _, spec := range testSpecs {
+			if spec.FilterPolicy == "" || snsfilter.MustParse(spec.FilterPolicy).Match(attributes(m.event, m.total)) {
+				got = append(got, spec.Name)
+			}
+		}
+
+		if !equal(got, m.queues) {
+			t.Errorf("%s of %s: got queues %v, want %v", m.event, m.total, got, m.queues)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestQueuePolicy(t *testing.T) {
+	queueARN := "arn:aws:sqs:us-west-2:123456789012:aws-docs-example-queue"
+	topicARN := "arn:aws:sns:us-west-2:123456789012:aws-docs-example-topic"
+
+	policy, err := iampolicy.Parse([]byte(QueuePolicy(queueARN, topicARN)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topicService := iampolicy.Principal{Type: "Service", ID: "sns.amazonaws.com"}
+
+	tests := []struct {
+		req  iampolicy.Request
+		want iampolicy.Decision
+	}{
+		{iampolicy.Request{Principal: topicService, Action: "sqs:SendMessage", Resource: queueARN,
+			Context: map[string][]string{"aws:SourceArn": {topicARN}}}, iampolicy.Allowed},
+		{iampolicy.Request{Principal: topicService, Action: "sqs:SendMessage", Resource: queueARN,
+			Context: map[string][]string{"aws:SourceArn": {topicARN + "-other"}}}, iampolicy.ImplicitDeny},
+		{iampolicy.Request{Principal: topicService, Action: "sqs:DeleteMessage", Resource: queueARN,
+			Context: map[string][]string{"aws:SourceArn": {topicARN}}}, iampolicy.ImplicitDeny},
+		{iampolicy.Request{Principal: iampolicy.Principal{Type: "AWS", ID: "arn:aws:iam::111122223333:root"}, Action: "sqs:SendMessage", Resource: queueARN,
+			Context: map[string][]string{"aws:SourceArn": {topicARN}}}, iampolicy.ImplicitDeny},
+	}
+
+	for _, test := range tests {
+		if got := policy.Evaluate(test.req).Decision; got != test.want {
+			t.Errorf("%s by %v from %v: got %v, want %v", test.req.Action, test.req.Principal, test.req.Context, got, test.want)
+		}
+	}
+}
+
+func TestCreateFanOut(t *testing.T) {
+	snsAPI := snsfake.New()
+	sqsAPI := sqsfake.New()
+
+	f, err := CreateFanOut(context.Background(), snsAPI, sqsAPI, "aws-docs-example-topic", testSpecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.TopicARN != snsAPI.TopicARN("aws-docs-example-topic") || len(f.Queues) != len(testSpecs) {
+		t.Fatalf("Got %+v", f)
+	}
+
+	for i, q := range f.Queues {
+		if q.QueueARN != sqsAPI.QueueARN(testSpecs[i].Name) {
+			t.Errorf("Expected queue %s, got %+v", testSpecs[i].Name, q)
+		}
+
+		sub, err := snsAPI.GetSubscriptionAttributes(context.Background(), &sns.GetSubscriptionAttributesInput{
+			SubscriptionArn: aws.String(q.SubscriptionARN),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sub.Attributes["Endpoint"] != q.QueueARN || sub.Attributes["RawMessageDelivery"] != "true" ||
+			sub.Attributes["FilterPolicy"] != testSpecs[i].FilterPolicy {
+			t.Errorf("Got subscription attributes %v", sub.Attributes)
+		}
+
+		queue, err := sqsAPI.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(q.QueueURL),
+			AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if queue.Attributes["Policy"] != QueuePolicy(q.QueueARN, f.TopicARN) {
+			t.Errorf("Got queue policy %s", queue.Attributes["Policy"])
+		}
+	}
+
+	// Publishing to the fake records which subscriptions each message reached
+	for _, m := range testMessages {
+		_, err := snsAPI.Publish(context.Background(), &sns.PublishInput{
+			TopicArn:          aws.String(f.TopicARN),
+			Message:           aws.String(m.event),
+			MessageAttributes: attributes(m.event, m.total),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, p := range snsAPI.Published() {
+		if len(p.Delivered) != len(testMessages[i].queues) {
+			t.Errorf("%s: got %d subscriptions, want %d", p.Message, len(p.Delivered), len(testMessages[i].queues))
+		}
+	}
+
+	err = Teardown(context.Background(), snsAPI, sqsAPI, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkEmpty(t, snsAPI, sqsAPI)
+}
+
+// checkEmpty checks that no topics or queues are left.
+func checkEmpty(t *testing.T, snsAPI *snsfake.Service, sqsAPI *sqsfake.Service) {
+	topics, err := snsAPI.ListTopics(context.Background(), &sns.ListTopicsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queues, err := sqsAPI.ListQueues(context.Background(), &sqs.ListQueuesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(topics.Topics) != 0 || len(queues.QueueUrls) != 0 {
+		t.Errorf("Expected everything to be deleted, got topics %v and queues %v", topics.Topics, queues.QueueUrls)
+	}
+}
+
+// failingQueues is an sqsfake.Service that can't set the policy of one queue
+type failingQueues struct {
+	*sqsfake.Service
+	failURL string
+}
+
+var errSetAttributes = errors.New("can't set attributes")
+
+func (f *failingQueues) SetQueueAttributes(ctx context.Context,
+	params *sqs.SetQueueAttributesInput,
+	optFns ...func(*sqs.Options)) (*sqs.SetQueueAttributesOutput, error) {
+	if *params.QueueUrl == f.failURL {
+		return nil, errSetAttributes
+	}
+
+	return f.Service.SetQueueAttributes(ctx, params, optFns...)
+}
+
+func TestCreateFanOutFailure(t *testing.T) {
+	snsAPI := snsfake.New()
+	sqsAPI := &failingQueues{Service: sqsfake.New()}
+	sqsAPI.failURL = sqsAPI.QueueURL(testSpecs[1].Name)
+
+	_, err := CreateFanOut(context.Background(), snsAPI, sqsAPI, "aws-docs-example-topic", testSpecs)
+	if !errors.Is(err, errSetAttributes) {
+		t.Errorf("Expected the SetQueueAttributes error, got %v", err)
+	}
+
+	checkEmpty(t, snsAPI, sqsAPI.Service)
+
+	// An invalid filter policy fails the subscription
+	specs := []QueueSpec{{Name: "aws-docs-example-queue", FilterPolicy: `{"event":"order_placed"}`}}
+
+	_, err = CreateFanOut(context.Background(), snsAPI, sqsfake.New(), "aws-docs-example-topic", specs)
+	var invalid *snstypes.InvalidParameterException
+	if !errors.As(err, &invalid) {
+		t.Errorf("Expected InvalidParameterException, got %v", err)
+	}
+}
+
+// queuePolicy returns the policy of a queue.
+func queuePolicy(t *testing.T, api *sqsfake.Service, name string) string {
+	output, err := api.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(api.QueueURL(name)),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output.Attributes[string(sqstypes.QueueAttributeNamePolicy)]
+}
+
+// checkExisting checks that the topic and queues that existed before CreateFanOut are still there, without subscriptions,
+// and that the queue it would have created isn't.
+func checkExisting(t *testing.T, snsAPI *snsfake.Service, sqsAPI *sqsfake.Service, otherPolicy string) {
+	topicARN := snsAPI.TopicARN("aws-docs-example-topic")
+
+	subs, err := snsAPI.ListSubscriptionsByTopic(context.Background(), &sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(topicARN)})
+	if err != nil {
+		t.Fatalf("Expected the topic to be kept: %v", err)
+	}
+
+	if len(subs.Subscriptions) != 0 {
+		t.Errorf("Expected no subscriptions, got %v", subs.Subscriptions)
+	}
+
+	if policy := queuePolicy(t, sqsAPI, testSpecs[0].Name); policy != "" {
+		t.Errorf("Expected the policy that was added to %s to be removed, got %s", testSpecs[0].Name, policy)
+	}
+
+	if policy := queuePolicy(t, sqsAPI, testSpecs[1].Name); policy != otherPolicy {
+		t.Errorf("Expected the policy of %s to be kept, got %s", testSpecs[1].Name, policy)
+	}
+
+	_, err = sqsAPI.GetQueueUrl(context.Background(), &sqs.GetQueueUrlInput{QueueName: aws.String(testSpecs[2].Name)})
+	var notExist *sqstypes.QueueDoesNotExist
+	if !errors.As(err, &notExist) {
+		t.Errorf("Expected %s to be deleted, got %v", testSpecs[2].Name, err)
+	}
+}
+
+func TestCreateFanOutExisting(t *testing.T) {
+	snsAPI := snsfake.New()
+	sqsAPI := sqsfake.New()
+
+	_, err := snsAPI.CreateTopic(context.Background(), &sns.CreateTopicInput{Name: aws.String("aws-docs-example-topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second queue already lets another account send messages
+	otherPolicy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"111122223333"},"Action":"sqs:SendMessage","Resource":"*"}]}`
+
+	for i, spec := range testSpecs[:2] {
+		input := &sqs.CreateQueueInput{QueueName: aws.String(spec.Name)}
+		if i == 1 {
+			input.Attributes = map[string]string{string(sqstypes.QueueAttributeNamePolicy): otherPolicy}
+		}
+
+		_, err := sqsAPI.CreateQueue(context.Background(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = CreateFanOut(context.Background(), snsAPI, sqsAPI, "aws-docs-example-topic", testSpecs)
+	if !errors.Is(err, ErrQueuePolicyExists) {
+		t.Fatalf("Expected ErrQueuePolicyExists, got %v", err)
+	}
+
+	checkExisting(t, snsAPI, sqsAPI, otherPolicy)
+
+	// Without the other policy, the fan-out uses the existing topic and queues, and Teardown keeps them
+	_, err = sqsAPI.SetQueueAttributes(context.Background(), &sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(sqsAPI.QueueURL(testSpecs[1].Name)),
+		Attributes: map[string]string{string(sqstypes.QueueAttributeNamePolicy): ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := CreateFanOut(context.Background(), snsAPI, sqsAPI, "aws-docs-example-topic", testSpecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Created || f.Queues[0].Created || f.Queues[1].Created || !f.Queues[2].Created {
+		t.Errorf("Expected only the last queue to be created, got %+v", f)
+	}
+
+	err = Teardown(context.Background(), snsAPI, sqsAPI, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExisting(t, snsAPI, sqsAPI, "")
+}
+
+func TestCreateFanOutExistingSubscription(t *testing.T) {
+	snsAPI := snsfake.New()
+	sqsAPI := sqsfake.New()
+
+	topic, err := snsAPI.CreateTopic(context.Background(), &sns.CreateTopicInput{Name: aws.String("aws-docs-example-topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sqsAPI.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String(testSpecs[0].Name)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first queue is already subscribed to the topic
+	sub, err := snsAPI.Subscribe(context.Background(), &sns.SubscribeInput{
+		TopicArn: topic.TopicArn,
+		Protocol: aws.String("sqs"),
+		Endpoint: aws.String(sqsAPI.QueueARN(testSpecs[0].Name)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := CreateFanOut(context.Background(), snsAPI, sqsAPI, "aws-docs-example-topic", testSpecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Queues[0].SubscriptionARN != *sub.SubscriptionArn || f.Queues[0].Subscribed || !f.Queues[1].Subscribed {
+		t.Errorf("Expected the existing subscription of the first queue to be used, got %+v", f.Queues)
+	}
+
+	err = Teardown(context.Background(), snsAPI, sqsAPI, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := snsAPI.ListSubscriptionsByTopic(context.Background(), &sns.ListSubscriptionsByTopicInput{TopicArn: topic.TopicArn})
+	if err != nil {
+		t.Fatalf("Expected the topic to be kept: %v", err)
+	}
+
+	if len(subs.Subscriptions) != 1 || *subs.Subscriptions[0].SubscriptionArn != *sub.SubscriptionArn {
+		t.Errorf("Expected only the existing subscription to be kept, got %v", subs.Subscriptions)
+	}
+}
+
+func TestFanOutLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	snsClient := sns.NewFromConfig(server.Config())
+	sqsClient := sqs.NewFromConfig(server.Config())
+
+	f, err := CreateFanOut(context.Background(), snsClient, sqsClient, "doc-example-topic", testSpecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range testMessages {
+		_, err := snsClient.Publish(context.Background(), &sns.PublishInput{
+			TopicArn:          aws.String(f.TopicARN),
+			Message:           aws.String(m.event + " " + m.total),
+			MessageAttributes: attributes(m.event, m.total),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each queue gets the messages its filter policy accepts, as raw messages with their attributes
+	for _, q := range f.Queues {
+		var want []string
+		for _, m := range testMessages {
+			for _, name := range m.queues {
+				if name == q.Name {
+					want = append(want, m.event+" "+m.total)
+				}
+			}
+		}
+
+		received, err := sqsClient.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(q.QueueURL),
+			MaxNumberOfMessages:   10,
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, msg := range received.Messages {
+			got = append(got, *msg.Body)
+
+			if msg.MessageAttributes["event"].StringValue == nil {
+				t.Errorf("%s: message %s has no event attribute", q.Name, *msg.Body)
+			}
+		}
+
+		if !equal(got, want) {
+			t.Errorf("%s: got %v, want %v", q.Name, got, want)
+		}
+	}
+
+	err = Teardown(context.Background(), snsClient, sqsClient, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkEmpty(t, server.SNS, server.SQS)
+}
@@ -5,11 +5,19 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
 )
 
 // SNSPublishAPI defines the interface for the Publish function.
@@ -32,18 +40,245 @@ func PublishMessage(c context.Context, api SNSPublishAPI, input *sns.PublishInpu
 	return api.Publish(c, input)
 }
 
+// StringAttribute returns a message attribute of type String.
+func StringAttribute(value string) types.MessageAttributeValue {
+	return types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+// NumberAttribute returns a message attribute of type Number.
+func NumberAttribute(value float64) types.MessageAttributeValue {
+	return types.MessageAttributeValue{
+		DataType:    aws.String("Number"),
+		StringValue: aws.String(strconv.FormatFloat(value, 'f', -1, 64)),
+	}
+}
+
+// BinaryAttribute returns a message attribute of type Binary.
+func BinaryAttribute(value []byte) types.MessageAttributeValue {
+	return types.MessageAttributeValue{
+		DataType:    aws.String("Binary"),
+		BinaryValue: value,
+	}
+}
+
+// StringArrayAttribute returns a message attribute of type String.Array,
+// which subscription filter policies match against each of its values.
+// Inputs:
+//     values are the values of the array: strings, numbers, booleans, or nil.
+// Output:
+//     If success, the message attribute and nil.
+//     Otherwise, an empty message attribute and an error for the first value of another type.
+func StringArrayAttribute(values ...interface{}) (types.MessageAttributeValue, error) {
+	for i, v := range values {
+		switch v.(type) {
+		case string, bool, nil,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64,
+			float32, float64:
+		default:
+			return types.MessageAttributeValue{}, fmt.Errorf("value %d: a String.Array can't contain a %T", i, v)
+		}
+	}
+
+	if values == nil {
+		values = []interface{}{}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return types.MessageAttributeValue{}, err
+	}
+
+	return types.MessageAttributeValue{
+		DataType:    aws.String("String.Array"),
+		StringValue: aws.String(string(data)),
+	}, nil
+}
+
+// MessageStructure returns the message to publish with MessageStructure json,
+// so that subscriptions get a different message for each protocol.
+// Inputs:
+//     bodies are the messages by protocol, such as email, sqs, or lambda.
+//     The default message goes to the protocols without their own.
+// Output:
+//     If success, the JSON message and nil.
+//     Otherwise, an empty string and an error if bodies has no default message.
+func MessageStructure(bodies map[string]string) (string, error) {
+	if _, ok := bodies["default"]; !ok {
+		return "", errors.New("the message structure needs a default message")
+	}
+
+	data, err := json.Marshal(bodies)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// attributeFlags collects -a flags of the form NAME=TYPE:VALUE.
+// A Binary value is base64-encoded, and a String.Array value is a JSON array.
+type attributeFlags map[string]types.MessageAttributeValue
+
+func (a attributeFlags) String() string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ",")
+}
+
+func (a attributeFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("an attribute must be NAME=TYPE:VALUE")
+	}
+
+	typed := strings.SplitN(parts[1], ":", 2)
+	if len(typed) != 2 {
+		return errors.New("an attribute must be NAME=TYPE:VALUE")
+	}
+
+	var attr types.MessageAttributeValue
+
+	switch typed[0] {
+	case "String":
+		attr = StringAttribute(typed[1])
+	case "Number":
+		n, err := strconv.ParseFloat(typed[1], 64)
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", parts[0], err)
+		}
+
+		attr = NumberAttribute(n)
+	case "Binary":
+		data, err := base64.StdEncoding.DecodeString(typed[1])
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", parts[0], err)
+		}
+
+		attr = BinaryAttribute(data)
+	case "String.Array":
+		var values []interface{}
+		if err := json.Unmarshal([]byte(typed[1]), &values); err != nil {
+			return fmt.Errorf("attribute %s: %w", parts[0], err)
+		}
+
+		var err error
+		if attr, err = StringArrayAttribute(values...); err != nil {
+			return fmt.Errorf("attribute %s: %w", parts[0], err)
+		}
+	default:
+		return fmt.Errorf("attribute %s: the type must be String, Number, Binary, or String.Array", parts[0])
+	}
+
+	a[parts[0]] = attr
+
+	return nil
+}
+
+// bodyFlags collects -s flags of the form PROTOCOL=MESSAGE.
+type bodyFlags map[string]string
+
+func (b bodyFlags) String() string {
+	protocols := make([]string, 0, len(b))
+	for protocol := range b {
+		protocols = append(protocols, protocol)
+	}
+
+	sort.Strings(protocols)
+
+	return strings.Join(protocols, ",")
+}
+
+func (b bodyFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("a message must be PROTOCOL=MESSAGE")
+	}
+
+	// -m sets the default message, and setting it twice would lose one of them
+	if parts[0] == "default" {
+		return errors.New("the default message comes from -m, not -s")
+	}
+
+	b[parts[0]] = parts[1]
+
+	return nil
+}
+
 func main() {
+	attributes := attributeFlags{}
+	bodies := bodyFlags{}
 	msg := flag.String("m", "", "The message to send to the subscribed users of the topic")
 	topicARN := flag.String("t", "", "The ARN of the topic to which the user subscribes")
+	targetARN := flag.String("e", "", "The ARN of a mobile endpoint to publish to instead of a topic")
+	phoneNumber := flag.String("p", "", "The phone number, in E.164 format, to send an SMS message to instead of a topic")
+	groupID := flag.String("g", "", "The message group ID, for a FIFO topic")
+	dedupID := flag.String("d", "", "The message deduplication ID, for a FIFO topic without content-based deduplication")
+	flag.Var(attributes, "a", "A message attribute, as NAME=TYPE:VALUE (can be repeated)")
+	flag.Var(bodies, "s", "The message for one protocol, as PROTOCOL=MESSAGE (can be repeated)")
 
 	flag.Parse()
 
-	if *msg == "" || *topicARN == "" {
-		fmt.Println("You must supply a message and topic ARN")
-		fmt.Println("-m MESSAGE -t TOPIC-ARN")
+	targets := 0
+	for _, target := range []string{*topicARN, *targetARN, *phoneNumber} {
+		if target != "" {
+			targets++
+		}
+	}
+
+	if *msg == "" || targets != 1 {
+		fmt.Println("You must supply a message and exactly one of a topic ARN, target ARN, or phone number")
+		fmt.Println("-m MESSAGE (-t TOPIC-ARN | -e TARGET-ARN | -p PHONE-NUMBER) [-a NAME=TYPE:VALUE ...] [-s PROTOCOL=MESSAGE ...] [-g GROUP-ID] [-d DEDUP-ID]")
 		return
 	}
 
+	input := &sns.PublishInput{
+		Message: msg,
+	}
+
+	switch {
+	case *topicARN != "":
+		input.TopicArn = topicARN
+	case *targetARN != "":
+		input.TargetArn = targetARN
+	default:
+		input.PhoneNumber = phoneNumber
+	}
+
+	if len(attributes) > 0 {
+		input.MessageAttributes = attributes
+	}
+
+	if len(bodies) > 0 {
+		// The -m message goes to the protocols without their own
+		bodies["default"] = *msg
+
+		structured, err := MessageStructure(bodies)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		input.Message = aws.String(structured)
+		input.MessageStructure = aws.String("json")
+	}
+
+	if *groupID != "" {
+		input.MessageGroupId = groupID
+	}
+
+	if *dedupID != "" {
+		input.MessageDeduplicationId = dedupID
+	}
+
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		panic("configuration error, " + err.Error())
@@ -51,11 +286,6 @@ func main() {
 
 	client := sns.NewFromConfig(cfg)
 
-	input := &sns.PublishInput{
-		Message:  msg,
-		TopicArn: topicARN,
-	}
-
 	result, err := PublishMessage(context.TODO(), client, input)
 	if err != nil {
 		fmt.Println("Got an error publishing the message:")
@@ -64,6 +294,10 @@ func main() {
 	}
 
 	fmt.Println("Message ID: " + *result.MessageId)
+
+	if result.SequenceNumber != nil {
+		fmt.Println("Sequence number: " + *result.SequenceNumber)
+	}
 }
 
 // snippet-end:[sns.go-v2.Publish]
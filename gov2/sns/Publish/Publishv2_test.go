@@ -10,6 +10,11 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/snsfake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/snsfilter"
 )
 
 type SNSPublishImpl struct{}
@@ -82,3 +87,313 @@ func TestPublish(t *testing.T) {
 
 	t.Log("Message ID: " + *resp.MessageId)
 }
+
+func TestAttributes(t *testing.T) {
+	tags, err := StringArrayAttribute("paging", 2, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		attr          types.MessageAttributeValue
+		dataType, str string
+	}{
+		{StringAttribute("critical"), "String", "critical"},
+		{NumberAttribute(3), "Number", "3"},
+		{NumberAttribute(99.5), "Number", "99.5"},
+		{tags, "String.Array", `["paging",2,true,null]`},
+	}
+
+	for _, test := range tests {
+		if *test.attr.DataType != test.dataType || *test.attr.StringValue != test.str {
+			t.Errorf("got %s %s, want %s %s", *test.attr.DataType, *test.attr.StringValue, test.dataType, test.str)
+		}
+	}
+
+	if attr := BinaryAttribute([]byte{1, 2}); *attr.DataType != "Binary" || len(attr.BinaryValue) != 2 {
+		t.Errorf("got %+v", attr)
+	}
+
+	if _, err := StringArrayAttribute("paging", []string{"nested"}); err == nil {
+		t.Error("expected an error for a nested array")
+	}
+
+	// Filter policies match each value of a String.Array
+	policy := snsfilter.MustParse(`{"tags":["paging"]}`)
+	if !policy.Match(map[string]types.MessageAttributeValue{"tags": tags}) {
+		t.Error("the filter policy didn't match the String.Array attribute")
+	}
+}
+
+func TestAttributeFlags(t *testing.T) {
+	a := attributeFlags{}
+	for _, value := range []string{"severity=String:critical", "count=Number:3", "blob=Binary:AQI=", `tags=String.Array:["paging",2]`} {
+		if err := a.Set(value); err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+	}
+
+	if a.String() != "blob,count,severity,tags" || *a["tags"].StringValue != `["paging",2]` || len(a["blob"].BinaryValue) != 2 {
+		t.Errorf("got %v", a)
+	}
+
+	for _, value := range []string{"severity", "severity=critical", "count=Number:three", "blob=Binary:!", "tags=String.Array:paging", "severity=Text:critical"} {
+		if err := a.Set(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestBodyFlags(t *testing.T) {
+	b := bodyFlags{}
+	for _, value := range []string{"email=The disk is full.", "sqs={\"disk\":\"full\"}"} {
+		if err := b.Set(value); err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+	}
+
+	if b.String() != "email,sqs" {
+		t.Errorf("got %v", b)
+	}
+
+	for _, value := range []string{"email", "=Disk full", "default=Disk full"} {
+		if err := b.Set(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestMessageStructure(t *testing.T) {
+	_, err := MessageStructure(map[string]string{"email": "The disk is full."})
+	if err == nil {
+		t.Error("expected an error without a default message")
+	}
+
+	message, err := MessageStructure(map[string]string{"default": "Disk full", "email": "The disk is full."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message != `{"default":"Disk full","email":"The disk is full."}` {
+		t.Errorf("got %s", message)
+	}
+}
+
+func TestPublishFake(t *testing.T) {
+	api := snsfake.New()
+	ctx := context.Background()
+
+	var deliveries []snsfake.Delivery
+	api.Deliver = func(d snsfake.Delivery) { deliveries = append(deliveries, d) }
+
+	topic, err := api.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("aws-docs-example-alerts")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Email gets only critical alerts, and the queue gets everything
+	for _, sub := range []struct{ protocol, endpoint, policy string }{
+		{"email", "oncall@example.com", `{"severity":["critical"]}`},
+		{"sqs", "arn:aws:sqs:us-west-2:123456789012:aws-docs-example-alerts", ""},
+	} {
+		attributes := map[string]string{}
+		if sub.policy != "" {
+			attributes["FilterPolicy"] = sub.policy
+		}
+
+		_, err := api.Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn:   topic.TopicArn,
+			Protocol:   aws.String(sub.protocol),
+			Endpoint:   aws.String(sub.endpoint),
+			Attributes: attributes,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	message, err := MessageStructure(map[string]string{"default": "Disk full", "email": "The disk on web-1 is full."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, severity := range []string{"critical", "warning"} {
+		_, err := PublishMessage(ctx, api, &sns.PublishInput{
+			TopicArn:          topic.TopicArn,
+			Message:           aws.String(message),
+			MessageStructure:  aws.String("json"),
+			MessageAttributes: map[string]types.MessageAttributeValue{"severity": StringAttribute(severity)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []struct{ protocol, message string }{
+		{"email", "The disk on web-1 is full."},
+		{"sqs", "Disk full"},
+		{"sqs", "Disk full"},
+	}
+
+	if len(deliveries) != len(want) {
+		t.Fatalf("got %d deliveries, want %d", len(deliveries), len(want))
+	}
+
+	for i, d := range deliveries {
+		var n struct{ Message string }
+		if err := json.Unmarshal([]byte(d.Message), &n); err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Protocol != want[i].protocol || n.Message != want[i].message {
+			t.Errorf("got %s %q, want %s %q", d.Protocol, n.Message, want[i].protocol, want[i].message)
+		}
+	}
+
+	// Publishing directly to a phone number or a mobile endpoint
+	_, err = PublishMessage(ctx, api, &sns.PublishInput{PhoneNumber: aws.String("+12065550100"), Message: aws.String("Disk full")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = PublishMessage(ctx, api, &sns.PublishInput{
+		TargetArn: aws.String("arn:aws:sns:us-west-2:123456789012:endpoint/GCM/aws-docs-example-app/0b5f3e9d-1c2a-4e8b-9d7f-6a5c4b3e2d1f"),
+		Message:   aws.String("Disk full"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := api.Published()
+	if len(published) != 4 || published[2].PhoneNumber != "+12065550100" || published[3].TargetArn == "" {
+		t.Errorf("got %+v", published)
+	}
+}
+
+func TestPublishFifo(t *testing.T) {
+	api := snsfake.New()
+	ctx := context.Background()
+
+	topic, err := api.CreateTopic(ctx, &sns.CreateTopicInput{
+		Name:       aws.String("aws-docs-example-alerts.fifo"),
+		Attributes: map[string]string{"FifoTopic": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish := func(dedupID string) *sns.PublishOutput {
+		output, err := PublishMessage(ctx, api, &sns.PublishInput{
+			TopicArn:               topic.TopicArn,
+			Message:                aws.String("Disk full"),
+			MessageGroupId:         aws.String("web-1"),
+			MessageDeduplicationId: aws.String(dedupID),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return output
+	}
+
+	first := publish("alert-1")
+	second := publish("alert-2")
+	retry := publish("alert-1")
+
+	if *retry.MessageId != *first.MessageId || *retry.SequenceNumber != *first.SequenceNumber {
+		t.Errorf("the retry got message %s, want %s", *retry.MessageId, *first.MessageId)
+	}
+
+	if *second.SequenceNumber <= *first.SequenceNumber {
+		t.Errorf("got sequence numbers %s and %s", *first.SequenceNumber, *second.SequenceNumber)
+	}
+
+	_, err = PublishMessage(ctx, api, &sns.PublishInput{TopicArn: topic.TopicArn, Message: aws.String("Disk full")})
+	var invalid *types.InvalidParameterException
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want InvalidParameterException without a message group ID", err)
+	}
+}
+
+func TestPublishLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	snsClient := sns.NewFromConfig(server.Config())
+	sqsClient := sqs.NewFromConfig(server.Config())
+	ctx := context.Background()
+
+	topic, err := snsClient.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String("aws-docs-example-alerts")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := sqsClient.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String("aws-docs-example-alerts")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queueARN := server.SQS.QueueARN("aws-docs-example-alerts")
+
+	policy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"sns.amazonaws.com"},` +
+		`"Action":"sqs:SendMessage","Resource":"` + queueARN + `","Condition":{"ArnEquals":{"aws:SourceArn":"` + *topic.TopicArn + `"}}}]}`
+
+	_, err = sqsClient.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   queue.QueueUrl,
+		Attributes: map[string]string{"Policy": policy},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = snsClient.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn: topic.TopicArn,
+		Protocol: aws.String("sqs"),
+		Endpoint: aws.String(queueARN),
+		Attributes: map[string]string{
+			"RawMessageDelivery": "true",
+			"FilterPolicy":       `{"count":[{"numeric":[">",2]}]}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := StringArrayAttribute("paging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, count := range []float64{1, 3} {
+		_, err := PublishMessage(ctx, snsClient, &sns.PublishInput{
+			TopicArn: topic.TopicArn,
+			Message:  aws.String("Disk full"),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"count": NumberAttribute(count),
+				"tags":  tags,
+				"host":  BinaryAttribute([]byte("web-1")),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              queue.QueueUrl,
+		MaxNumberOfMessages:   10,
+		MessageAttributeNames: []string{"All"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.Messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(received.Messages))
+	}
+
+	attributes := received.Messages[0].MessageAttributes
+	if aws.ToString(attributes["count"].StringValue) != "3" || string(attributes["host"].BinaryValue) != "web-1" {
+		t.Errorf("got attributes %+v", attributes)
+	}
+}
@@ -0,0 +1,440 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[sqs.go-v2.BatchMessages]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQSSendMessageBatchAPI defines the interface for the SendMessageBatch function.
+// We use this interface to test the function using a mocked service.
+type SQSSendMessageBatchAPI interface {
+	SendMessageBatch(ctx context.Context,
+		params *sqs.SendMessageBatchInput,
+		optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// SQSDeleteMessageBatchAPI defines the interface for the DeleteMessageBatch function.
+// We use this interface to test the function using a mocked service.
+type SQSDeleteMessageBatchAPI interface {
+	DeleteMessageBatch(ctx context.Context,
+		params *sqs.DeleteMessageBatchInput,
+		optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+}
+
+// SQSChangeMessageVisibilityBatchAPI defines the interface for the ChangeMessageVisibilityBatch function.
+// We use this interface to test the function using a mocked service.
+type SQSChangeMessageVisibilityBatchAPI interface {
+	ChangeMessageVisibilityBatch(ctx context.Context,
+		params *sqs.ChangeMessageVisibilityBatchInput,
+		optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error)
+}
+
+// The limits of an Amazon SQS batch request
+const (
+	maxBatchEntries = 10
+	maxBatchSize    = 262144
+)
+
+// BatchOptions configures how failed entries are retried. Zero values select the defaults.
+type BatchOptions struct {
+	// MaxAttempts is how many times an entry is tried before its failure is reported. The default is 3.
+	MaxAttempts int
+	// Backoff is how long to wait before the first retry. It doubles for each retry after that. The default is 100 milliseconds.
+	Backoff time.Duration
+}
+
+// BatchResult is the outcome for one message of a batch operation.
+type BatchResult struct {
+	// Index is the position of the message in the caller's list.
+	Index int
+	// MessageID is the ID Amazon SQS gave a sent message.
+	MessageID string
+	// Attempts is how many requests included the message.
+	Attempts int
+	// Err is nil if the operation succeeded for the message.
+	// Otherwise it is an *EntryError, an error from the request as a whole, or an error from the context.
+	Err error
+}
+
+// EntryError is the failure that Amazon SQS reported for one entry of a batch request.
+type EntryError struct {
+	Code    string
+	Message string
+	// SenderFault is whether the request was at fault. Such failures are not retried.
+	SenderFault bool
+}
+
+func (e *EntryError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// ErrMessageTooLarge is the error for a message that can't fit into a batch request by itself.
+var ErrMessageTooLarge = errors.New("the message is larger than the 256 KiB batch limit")
+
+// Failed returns the results for the messages that failed.
+func Failed(results []BatchResult) []BatchResult {
+	var failed []BatchResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+
+	return failed
+}
+
+// messageSize returns the size of a message as Amazon SQS counts it against the payload limit.
+func messageSize(e types.SendMessageBatchRequestEntry) int {
+	size := len(aws.ToString(e.MessageBody))
+	for name, v := range e.MessageAttributes {
+		size += len(name) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	return size
+}
+
+// chunk splits the indices 0 to n-1 into runs of at most 10 whose sizes add up to at most 256 KiB.
+// Indices whose size alone is over the limit are left out.
+func chunk(n int, size func(int) int) [][]int {
+	var chunks [][]int
+	var current []int
+	total := 0
+
+	for i := 0; i < n; i++ {
+		s := size(i)
+		if s > maxBatchSize {
+			continue
+		}
+
+		if len(current) == maxBatchEntries || total+s > maxBatchSize {
+			chunks = append(chunks, current)
+			current = nil
+			total = 0
+		}
+
+		current = append(current, i)
+		total += s
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+// batchCall sends one batch request for the given indices,
+// and returns the message IDs of the successful entries and the failed entries, keyed by index.
+type batchCall func(c context.Context, indices []int) (map[int]string, map[int]types.BatchResultErrorEntry, error)
+
+// entryID returns the batch entry ID for the message at an index. It is unique within every request.
+func entryID(index int) *string {
+	return aws.String(strconv.Itoa(index))
+}
+
+// indexOf returns the index of the message with the given batch entry ID, or -1.
+func indexOf(id *string) int {
+	i, err := strconv.Atoi(aws.ToString(id))
+	if err != nil {
+		return -1
+	}
+
+	return i
+}
+
+// runBatches calls call for each chunk, retrying entries that fail through no fault of the request.
+func runBatches(c context.Context, results []BatchResult, chunks [][]int, opts BatchOptions, call batchCall) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+
+	for _, pending := range chunks {
+		backoff := opts.Backoff
+
+		for attempt := 1; len(pending) > 0; attempt++ {
+			for _, i := range pending {
+				results[i].Attempts = attempt
+			}
+
+			successful, failed, err := call(c, pending)
+			if err != nil {
+				for _, i := range pending {
+					results[i].Err = err
+				}
+
+				break
+			}
+
+			var retry []int
+			for _, i := range pending {
+				if id, ok := successful[i]; ok {
+					results[i].MessageID = id
+					results[i].Err = nil
+					continue
+				}
+
+				f, ok := failed[i]
+				if !ok {
+					// Amazon SQS always reports every entry; treat a missing one as a transient failure
+					f = types.BatchResultErrorEntry{Code: aws.String("MissingResult"), Message: aws.String("the entry is missing from the response")}
+				}
+
+				results[i].Err = &EntryError{Code: aws.ToString(f.Code), Message: aws.ToString(f.Message), SenderFault: f.SenderFault}
+				if !f.SenderFault && attempt < opts.MaxAttempts {
+					retry = append(retry, i)
+				}
+			}
+
+			if len(retry) == 0 {
+				break
+			}
+
+			select {
+			case <-c.Done():
+				for _, i := range retry {
+					results[i].Err = c.Err()
+				}
+
+				retry = nil
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			pending = retry
+		}
+	}
+}
+
+func newResults(n int) []BatchResult {
+	results := make([]BatchResult, n)
+	for i := range results {
+		results[i].Index = i
+	}
+
+	return results
+}
+
+// SendMessages sends any number of messages to an Amazon SQS queue, with as few SendMessageBatch calls as the limits allow.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     queueURL is the URL of the queue.
+//     entries are the messages to send. Their Id fields are replaced.
+//     opts configures retries.
+// Output:
+//     A BatchResult for each message, in the order of entries.
+func SendMessages(c context.Context, api SQSSendMessageBatchAPI, queueURL *string, entries []types.SendMessageBatchRequestEntry, opts BatchOptions) []BatchResult {
+	results := newResults(len(entries))
+
+	for i, e := range entries {
+		if messageSize(e) > maxBatchSize {
+			results[i].Err = ErrMessageTooLarge
+		}
+	}
+
+	chunks := chunk(len(entries), func(i int) int { return messageSize(entries[i]) })
+
+	runBatches(c, results, chunks, opts, func(c context.Context, indices []int) (map[int]string, map[int]types.BatchResultErrorEntry, error) {
+		input := &sqs.SendMessageBatchInput{QueueUrl: queueURL}
+		for _, i := range indices {
+			e := entries[i]
+			e.Id = entryID(i)
+			input.Entries = append(input.Entries, e)
+		}
+
+		output, err := api.SendMessageBatch(c, input)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		successful := map[int]string{}
+		for _, s := range output.Successful {
+			successful[indexOf(s.Id)] = aws.ToString(s.MessageId)
+		}
+
+		failed := map[int]types.BatchResultErrorEntry{}
+		for _, f := range output.Failed {
+			failed[indexOf(f.Id)] = f
+		}
+
+		return successful, failed, nil
+	})
+
+	return results
+}
+
+// DeleteMessages deletes any number of received messages from an Amazon SQS queue, 10 at a time.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     queueURL is the URL of the queue.
+//     receiptHandles are the receipt handles of the messages.
+//     opts configures retries.
+// Output:
+//     A BatchResult for each message, in the order of receiptHandles.
+func DeleteMessages(c context.Context, api SQSDeleteMessageBatchAPI, queueURL *string, receiptHandles []string, opts BatchOptions) []BatchResult {
+	results := newResults(len(receiptHandles))
+	chunks := chunk(len(receiptHandles), func(int) int { return 0 })
+
+	runBatches(c, results, chunks, opts, func(c context.Context, indices []int) (map[int]string, map[int]types.BatchResultErrorEntry, error) {
+		input := &sqs.DeleteMessageBatchInput{QueueUrl: queueURL}
+		for _, i := range indices {
+			input.Entries = append(input.Entries, types.DeleteMessageBatchRequestEntry{
+				Id:            entryID(i),
+				ReceiptHandle: aws.String(receiptHandles[i]),
+			})
+		}
+
+		output, err := api.DeleteMessageBatch(c, input)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		successful := map[int]string{}
+		for _, s := range output.Successful {
+			successful[indexOf(s.Id)] = ""
+		}
+
+		failed := map[int]types.BatchResultErrorEntry{}
+		for _, f := range output.Failed {
+			failed[indexOf(f.Id)] = f
+		}
+
+		return successful, failed, nil
+	})
+
+	return results
+}
+
+// ChangeVisibility sets the visibility timeout of any number of received messages, 10 at a time.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     queueURL is the URL of the queue.
+//     receiptHandles are the receipt handles of the messages.
+//     timeout is the new visibility timeout, in seconds from now. 0 makes the messages visible right away.
+//     opts configures retries.
+// Output:
+//     A BatchResult for each message, in the order of receiptHandles.
+func ChangeVisibility(c context.Context, api SQSChangeMessageVisibilityBatchAPI, queueURL *string, receiptHandles []string, timeout int32, opts BatchOptions) []BatchResult {
+	results := newResults(len(receiptHandles))
+	chunks := chunk(len(receiptHandles), func(int) int { return 0 })
+
+	runBatches(c, results, chunks, opts, func(c context.Context, indices []int) (map[int]string, map[int]types.BatchResultErrorEntry, error) {
+		input := &sqs.ChangeMessageVisibilityBatchInput{QueueUrl: queueURL}
+		for _, i := range indices {
+			input.Entries = append(input.Entries, types.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                entryID(i),
+				ReceiptHandle:     aws.String(receiptHandles[i]),
+				VisibilityTimeout: timeout,
+			})
+		}
+
+		output, err := api.ChangeMessageVisibilityBatch(c, input)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		successful := map[int]string{}
+		for _, s := range output.Successful {
+			successful[indexOf(s.Id)] = ""
+		}
+
+		failed := map[int]types.BatchResultErrorEntry{}
+		for _, f := range output.Failed {
+			failed[indexOf(f.Id)] = f
+		}
+
+		return successful, failed, nil
+	})
+
+	return results
+}
+
+func main() {
+	queue := flag.String("q", "", "The name of the queue")
+	count := flag.Int("n", 25, "How many messages to send")
+	flag.Parse()
+
+	if *queue == "" {
+		fmt.Println("You must supply a queue name (-q QUEUE)")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := sqs.NewFromConfig(cfg)
+
+	result, err := client.GetQueueUrl(context.TODO(), &sqs.GetQueueUrlInput{
+		QueueName: queue,
+	})
+	if err != nil {
+		fmt.Println("Got an error getting the queue URL:")
+		fmt.Println(err)
+		return
+	}
+
+	queueURL := result.QueueUrl
+
+	entries := make([]types.SendMessageBatchRequestEntry, *count)
+	for i := range entries {
+		entries[i].MessageBody = aws.String("Message " + strconv.Itoa(i+1))
+	}
+
+	sent := SendMessages(context.TODO(), client, queueURL, entries, BatchOptions{})
+
+	for _, r := range Failed(sent) {
+		fmt.Println("Message", r.Index+1, "failed:", r.Err)
+	}
+
+	fmt.Println("Sent", len(sent)-len(Failed(sent)), "of", len(sent), "messages")
+
+	// Receive the messages back, and delete them in batches
+	var handles []string
+
+	for len(handles) < *count {
+		resp, err := client.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
+			QueueUrl:            queueURL,
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     1,
+		})
+		if err != nil {
+			fmt.Println("Got an error receiving messages:")
+			fmt.Println(err)
+			return
+		}
+
+		if len(resp.Messages) == 0 {
+			break
+		}
+
+		for _, m := range resp.Messages {
+			handles = append(handles, *m.ReceiptHandle)
+		}
+	}
+
+	deleted := DeleteMessages(context.TODO(), client, queueURL, handles, BatchOptions{})
+
+	fmt.Println("Deleted", len(deleted)-len(Failed(deleted)), "of", len(deleted), "received messages")
+}
+
+// snippet-end:[sqs.go-v2.BatchMessages]
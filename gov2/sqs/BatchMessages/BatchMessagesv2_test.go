@@ -0,0 +1,284 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/sqsfake"
+)
+
+// SQSBatchImpl records the size of each SendMessageBatch request,
+// and fails the entries for the bodies in flaky the first time they are sent.
+type SQSBatchImpl struct {
+	*sqsfake.Service
+	requests []int
+	flaky    map[string]bool
+}
+
+func (dt *SQSBatchImpl) SendMessageBatch(ctx context.Context,
+	params *sqs.SendMessageBatchInput,
+	optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+
+	dt.requests = append(dt.requests, len(params.Entries))
+
+	var failed []types.BatchResultErrorEntry
+	var entries []types.SendMessageBatchRequestEntry
+
+	for _, e := range params.Entries {
+		if dt.flaky[*e.MessageBody] {
+			dt.flaky[*e.MessageBody] = false
+			failed = append(failed, types.BatchResultErrorEntry{Id: e.Id, Code: aws.String("InternalError"), Message: aws.String("Try again")})
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	output := &sqs.SendMessageBatchOutput{}
+	if len(entries) > 0 {
+		var err error
+		output, err = dt.Service.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{QueueUrl: params.QueueUrl, Entries: entries})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	output.Failed = append(output.Failed, failed...)
+
+	return output, nil
+}
+
+func newQueue(t *testing.T) (*sqsfake.Service, *string) {
+	api := sqsfake.New()
+
+	output, err := api.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String("aws-docs-example-queue")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api, output.QueueUrl
+}
+
+// receiveAll receives every visible message in the queue
+func receiveAll(t *testing.T, api SQSBatchAPI, queueURL *string) []types.Message {
+	var messages []types.Message
+	for {
+		output, err := api.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{QueueUrl: queueURL, MaxNumberOfMessages: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(output.Messages) == 0 {
+			return messages
+		}
+
+		messages = append(messages, output.Messages...)
+	}
+}
+
+// SQSBatchAPI is everything the tests call
+type SQSBatchAPI interface {
+	SQSSendMessageBatchAPI
+	SQSDeleteMessageBatchAPI
+	SQSChangeMessageVisibilityBatchAPI
+
+	ReceiveMessage(ctx context.Context,
+		params *sqs.ReceiveMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+}
+
+func TestSendMessages(t *testing.T) {
+	fake, queueURL := newQueue(t)
+	api := &SQSBatchImpl{Service: fake, flaky: map[string]bool{"3": true, "17": true}}
+
+	var entries []types.SendMessageBatchRequestEntry
+	for i := 0; i < 25; i++ {
+		entries = append(entries, types.SendMessageBatchRequestEntry{MessageBody: aws.String(strconv.Itoa(i))})
+	}
+
+	// Two large messages that can't share a request, one that is too large to send, and one with an invalid delay
+	entries = append(entries,
+		types.SendMessageBatchRequestEntry{MessageBody: aws.String(strings.Repeat("a", 200000))},
+		types.SendMessageBatchRequestEntry{MessageBody: aws.String(strings.Repeat("b", 200000))},
+		types.SendMessageBatchRequestEntry{MessageBody: aws.String(strings.Repeat("c", maxBatchSize+1))},
+		types.SendMessageBatchRequestEntry{MessageBody: aws.String("late"), DelaySeconds: 901},
+	)
+
+	results := SendMessages(context.Background(), api, queueURL, entries, BatchOptions{Backoff: time.Millisecond})
+
+	if len(results) != len(entries) {
+		t.Fatalf("got %d results, want %d", len(results), len(entries))
+	}
+
+	for _, size := range api.requests {
+		if size > maxBatchEntries {
+			t.Errorf("sent a batch of %d messages", size)
+		}
+	}
+
+	for i, r := range results[:27] {
+		if r.Index != i || r.Err != nil || r.MessageID == "" {
+			t.Errorf("message %d: got %+v", i, r)
+		}
+	}
+
+	if results[3].Attempts != 2 || results[17].Attempts != 2 || results[4].Attempts != 1 {
+		t.Errorf("got attempts %d, %d, %d, want 2, 2, 1", results[3].Attempts, results[17].Attempts, results[4].Attempts)
+	}
+
+	if !errors.Is(results[27].Err, ErrMessageTooLarge) || results[27].Attempts != 0 {
+		t.Errorf("got %+v for the oversized message", results[27])
+	}
+
+	var entryErr *EntryError
+	if !errors.As(results[28].Err, &entryErr) || !entryErr.SenderFault || results[28].Attempts != 1 {
+		t.Errorf("got %+v for the invalid message, want a sender fault that isn't retried", results[28])
+	}
+
+	if n := len(Failed(results)); n != 2 {
+		t.Errorf("got %d failures, want 2", n)
+	}
+
+	if n := len(receiveAll(t, api, queueURL)); n != 27 {
+		t.Errorf("got %d messages in the queue, want 27", n)
+	}
+}
+
+func TestSendMessagesRetriesRunOut(t *testing.T) {
+	fake, queueURL := newQueue(t)
+
+	// Fail the same message every time
+	api := &SQSBatchImpl{Service: fake, flaky: map[string]bool{}}
+	always := &alwaysFlaky{SQSBatchImpl: api, body: "stuck"}
+
+	entries := []types.SendMessageBatchRequestEntry{
+		{MessageBody: aws.String("ok")},
+		{MessageBody: aws.String("stuck")},
+	}
+
+	results := SendMessages(context.Background(), always, queueURL, entries, BatchOptions{MaxAttempts: 4, Backoff: time.Millisecond})
+
+	var entryErr *EntryError
+	if results[0].Err != nil || !errors.As(results[1].Err, &entryErr) || results[1].Attempts != 4 {
+		t.Errorf("got %+v and %+v", results[0], results[1])
+	}
+}
+
+// alwaysFlaky fails every entry with a given body
+type alwaysFlaky struct {
+	*SQSBatchImpl
+	body string
+}
+
+func (dt *alwaysFlaky) SendMessageBatch(ctx context.Context,
+	params *sqs.SendMessageBatchInput,
+	optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+
+	dt.flaky[dt.body] = true
+
+	return dt.SQSBatchImpl.SendMessageBatch(ctx, params, optFns...)
+}
+
+func TestDeleteAndChangeVisibility(t *testing.T) {
+	api, queueURL := newQueue(t)
+
+	var entries []types.SendMessageBatchRequestEntry
+	for i := 0; i < 23; i++ {
+		entries = append(entries, types.SendMessageBatchRequestEntry{MessageBody: aws.String(strconv.Itoa(i))})
+	}
+
+	if failed := Failed(SendMessages(context.Background(), api, queueURL, entries, BatchOptions{})); len(failed) != 0 {
+		t.Fatalf("got failures %+v", failed)
+	}
+
+	var handles []string
+	for _, m := range receiveAll(t, api, queueURL) {
+		handles = append(handles, *m.ReceiptHandle)
+	}
+
+	if len(handles) != 23 {
+		t.Fatalf("received %d messages, want 23", len(handles))
+	}
+
+	// Make the first 12 visible again, with one bad handle among them
+	visible := append(append([]string{}, handles[:12]...), "not-a-receipt-handle")
+
+	results := ChangeVisibility(context.Background(), api, queueURL, visible, 0, BatchOptions{})
+
+	var entryErr *EntryError
+	if failed := Failed(results); len(failed) != 1 || failed[0].Index != 12 || !errors.As(failed[0].Err, &entryErr) || entryErr.Code != "ReceiptHandleIsInvalid" {
+		t.Errorf("got failures %+v, want the bad handle", failed)
+	}
+
+	handles = handles[12:]
+	for _, m := range receiveAll(t, api, queueURL) {
+		handles = append(handles, *m.ReceiptHandle)
+	}
+
+	if len(handles) != 23 {
+		t.Fatalf("have %d receipt handles after receiving again, want 23", len(handles))
+	}
+
+	results = DeleteMessages(context.Background(), api, queueURL, handles, BatchOptions{})
+	if failed := Failed(results); len(failed) != 0 {
+		t.Errorf("got failures %+v", failed)
+	}
+
+	attributes, err := api.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       queueURL,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attributes.Attributes["ApproximateNumberOfMessages"] != "0" || attributes.Attributes["ApproximateNumberOfMessagesNotVisible"] != "0" {
+		t.Errorf("got attributes %v, want an empty queue", attributes.Attributes)
+	}
+}
+
+func TestBatchMessagesLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	created, err := server.SQS.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String("doc-example-queue")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := sqs.NewFromConfig(server.Config())
+
+	entries := make([]types.SendMessageBatchRequestEntry, 15)
+	for i := range entries {
+		entries[i].MessageBody = aws.String("Message " + strconv.Itoa(i))
+	}
+
+	results := SendMessages(context.Background(), client, created.QueueUrl, entries, BatchOptions{})
+	if failed := Failed(results); len(failed) != 0 {
+		t.Fatalf("got failures %+v", failed)
+	}
+
+	var handles []string
+	for _, m := range receiveAll(t, client, created.QueueUrl) {
+		handles = append(handles, *m.ReceiptHandle)
+	}
+
+	if len(handles) != 15 {
+		t.Fatalf("received %d messages, want 15", len(handles))
+	}
+
+	results = DeleteMessages(context.Background(), client, created.QueueUrl, handles, BatchOptions{})
+	if failed := Failed(results); len(failed) != 0 {
+		t.Errorf("got failures %+v", failed)
+	}
+}
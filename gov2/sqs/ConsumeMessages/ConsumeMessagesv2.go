@@ -0,0 +1,377 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[sqs.go-v2.ConsumeMessages]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQSConsumeAPI defines the interface for the ReceiveMessage, DeleteMessage, and ChangeMessageVisibility functions.
+// We use this interface to test the functions using a mocked service.
+type SQSConsumeAPI interface {
+	ReceiveMessage(ctx context.Context,
+		params *sqs.ReceiveMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+
+	DeleteMessage(ctx context.Context,
+		params *sqs.DeleteMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+
+	ChangeMessageVisibility(ctx context.Context,
+		params *sqs.ChangeMessageVisibilityInput,
+		optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Handler processes one message.
+// If it returns nil, the consumer deletes the message.
+// Otherwise the message stays in the queue, and is received again once its visibility timeout expires.
+type Handler func(ctx context.Context, msg types.Message) error
+
+// ConsumerOptions configures a consumer. Zero values select the defaults.
+type ConsumerOptions struct {
+	// Pollers is the number of concurrent ReceiveMessage loops. The default is 1.
+	Pollers int
+
+	// MaxInFlight is the most messages being handled at once. The default is 10.
+	MaxInFlight int
+
+	// WaitTimeSeconds is how long each ReceiveMessage call long-polls, from 0 to 20.
+	// 0 selects short polling. If it's nil, the default is 20.
+	WaitTimeSeconds *int32
+
+	// VisibilityTimeout is how many seconds a received message stays hidden,
+	// and how many more seconds each extension hides it for. The default is 30.
+	VisibilityTimeout int32
+
+	// Heartbeat is how often the visibility of a message is extended while its handler runs.
+	// The default is half of VisibilityTimeout.
+	Heartbeat time.Duration
+
+	// OnError, if not nil, is called with each error from the service or from a handler.
+	// The consumer keeps going after these errors.
+	OnError func(error)
+}
+
+// ReceiveError is an error from a call to ReceiveMessage.
+type ReceiveError struct {
+	Err error
+}
+
+func (e *ReceiveError) Error() string {
+	return "receiving messages: " + e.Err.Error()
+}
+
+func (e *ReceiveError) Unwrap() error {
+	return e.Err
+}
+
+// MessageError is an error from handling, deleting, or extending the visibility of a message.
+type MessageError struct {
+	MessageID string
+	// Op is "handle", "delete", or "extend".
+	Op  string
+	Err error
+}
+
+func (e *MessageError) Error() string {
+	return e.Op + " message " + e.MessageID + ": " + e.Err.Error()
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// receiveBackoff is how long a poller waits after ReceiveMessage fails.
+var receiveBackoff = time.Second
+
+type consumer struct {
+	api      SQSConsumeAPI
+	queueURL *string
+	handler  Handler
+	opts     ConsumerOptions
+
+	// slots holds one token for each message that can be handled now
+	slots    chan struct{}
+	handlers sync.WaitGroup
+}
+
+// Consume long-polls an Amazon SQS queue and passes each message to handler, until c is canceled.
+// Inputs:
+//     c is the context of the method call. Canceling it stops the consumer.
+//     api is the interface that defines the method calls.
+//     queueURL is the URL of the queue.
+//     handler processes each message.
+//     opts configures the consumer.
+// Output:
+//     Consume returns nil once c is canceled and every handler that was running has finished,
+//     and its message has been deleted or left in the queue.
+//     It returns an error only if the options are invalid.
+func Consume(c context.Context, api SQSConsumeAPI, queueURL *string, handler Handler, opts ConsumerOptions) error {
+	if opts.Pollers == 0 {
+		opts.Pollers = 1
+	}
+
+	if opts.MaxInFlight == 0 {
+		opts.MaxInFlight = 10
+	}
+
+	if opts.WaitTimeSeconds == nil {
+		opts.WaitTimeSeconds = aws.Int32(20)
+	}
+
+	if opts.VisibilityTimeout == 0 {
+		opts.VisibilityTimeout = 30
+	}
+
+	if opts.Heartbeat == 0 {
+		opts.Heartbeat = time.Duration(opts.VisibilityTimeout) * time.Second / 2
+	}
+
+	if opts.Pollers < 0 || opts.MaxInFlight < 0 || *opts.WaitTimeSeconds < 0 || *opts.WaitTimeSeconds > 20 || opts.VisibilityTimeout < 0 || opts.Heartbeat < 0 {
+		return errors.New("the consumer options must not be negative, and WaitTimeSeconds must be at most 20")
+	}
+
+	if opts.Heartbeat >= time.Duration(opts.VisibilityTimeout)*time.Second {
+		return errors.New("the heartbeat must be shorter than the visibility timeout")
+	}
+
+	cons := &consumer{
+		api:      api,
+		queueURL: queueURL,
+		handler:  handler,
+		opts:     opts,
+		slots:    make(chan struct{}, opts.MaxInFlight),
+	}
+
+	for i := 0; i < opts.MaxInFlight; i++ {
+		cons.slots <- struct{}{}
+	}
+
+	var pollers sync.WaitGroup
+	for i := 0; i < opts.Pollers; i++ {
+		pollers.Add(1)
+
+		go func() {
+			defer pollers.Done()
+			cons.poll(c)
+		}()
+	}
+
+	pollers.Wait()
+	cons.handlers.Wait()
+
+	return nil
+}
+
+func (cons *consumer) reportError(err error) {
+	if cons.opts.OnError != nil {
+		cons.opts.OnError(err)
+	}
+}
+
+// poll receives messages until c is canceled, taking a slot for each one first.
+func (cons *consumer) poll(c context.Context) {
+	for {
+		// Wait for at least one free slot, then take up to 10
+		select {
+		case <-c.Done():
+			return
+		case <-cons.slots:
+		}
+
+		taken := 1
+
+	fill:
+		for taken < 10 {
+			select {
+			case <-cons.slots:
+				taken++
+			default:
+				break fill
+			}
+		}
+
+		resp, err := cons.api.ReceiveMessage(c, &sqs.ReceiveMessageInput{
+			QueueUrl:              cons.queueURL,
+			MaxNumberOfMessages:   int32(taken),
+			WaitTimeSeconds:       *cons.opts.WaitTimeSeconds,
+			VisibilityTimeout:     cons.opts.VisibilityTimeout,
+			AttributeNames:        []types.QueueAttributeName{types.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+		})
+
+		var messages []types.Message
+		if err == nil {
+			messages = resp.Messages
+		}
+
+		// Give back the slots that no message needs
+		for i := len(messages); i < taken; i++ {
+			cons.slots <- struct{}{}
+		}
+
+		if err != nil {
+			if c.Err() != nil {
+				return
+			}
+
+			cons.reportError(&ReceiveError{Err: err})
+
+			select {
+			case <-c.Done():
+				return
+			case <-time.After(receiveBackoff):
+			}
+
+			continue
+		}
+
+		for _, msg := range messages {
+			cons.handlers.Add(1)
+
+			go func(msg types.Message) {
+				defer cons.handlers.Done()
+				defer func() { cons.slots <- struct{}{} }()
+
+				cons.handle(msg)
+			}(msg)
+		}
+	}
+}
+
+// handle runs the handler on a message, extending its visibility until the handler returns,
+// and deletes it if the handler succeeds.
+// It doesn't use the consumer's context, so that stopping the consumer lets running handlers finish.
+func (cons *consumer) handle(msg types.Message) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	id := ""
+	if msg.MessageId != nil {
+		id = *msg.MessageId
+	}
+
+	done := make(chan struct{})
+	heartbeat := make(chan struct{})
+
+	go func() {
+		defer close(heartbeat)
+
+		ticker := time.NewTicker(cons.opts.Heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			_, err := cons.api.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          cons.queueURL,
+				ReceiptHandle:     msg.ReceiptHandle,
+				VisibilityTimeout: cons.opts.VisibilityTimeout,
+			})
+			if err != nil {
+				cons.reportError(&MessageError{MessageID: id, Op: "extend", Err: err})
+			}
+		}
+	}()
+
+	err := cons.handler(ctx, msg)
+
+	close(done)
+	<-heartbeat
+
+	if err != nil {
+		cons.reportError(&MessageError{MessageID: id, Op: "handle", Err: err})
+		return
+	}
+
+	_, err = cons.api.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      cons.queueURL,
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		cons.reportError(&MessageError{MessageID: id, Op: "delete", Err: err})
+	}
+}
+
+func main() {
+	queue := flag.String("q", "", "The name of the queue")
+	pollers := flag.Int("p", 1, "How many pollers receive messages at once")
+	maxInFlight := flag.Int("m", 10, "How many messages can be handled at once")
+	waitTime := flag.Int("w", 20, "How long each poll waits for messages, from 0 (short polling) to 20 seconds")
+	flag.Parse()
+
+	if *queue == "" {
+		fmt.Println("You must supply a queue name (-q QUEUE)")
+		return
+	}
+
+	if *pollers < 1 || *maxInFlight < 1 || *waitTime < 0 || *waitTime > 20 {
+		fmt.Println("The pollers (-p) and in-flight limit (-m) must be at least 1, and the wait time (-w) from 0 to 20")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := sqs.NewFromConfig(cfg)
+
+	result, err := client.GetQueueUrl(context.TODO(), &sqs.GetQueueUrlInput{
+		QueueName: queue,
+	})
+	if err != nil {
+		fmt.Println("Got an error getting the queue URL:")
+		fmt.Println(err)
+		return
+	}
+
+	// Stop on Ctrl-C, after the messages being handled are done
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go func() {
+		<-interrupt
+		fmt.Println("Stopping")
+		cancel()
+	}()
+
+	opts := ConsumerOptions{
+		Pollers:         *pollers,
+		MaxInFlight:     *maxInFlight,
+		WaitTimeSeconds: aws.Int32(int32(*waitTime)),
+		OnError: func(err error) {
+			fmt.Println(err)
+		},
+	}
+
+	err = Consume(ctx, client, result.QueueUrl, func(ctx context.Context, msg types.Message) error {
+		fmt.Println("Message " + *msg.MessageId + ": " + *msg.Body)
+		return nil
+	}, opts)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// snippet-end:[sqs.go-v2.ConsumeMessages]
@@ -0,0 +1,318 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/sqsfake"
+)
+
+func newQueue(t *testing.T, messages int) (*sqsfake.Service, *string) {
+	api := sqsfake.New()
+
+	output, err := api.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String("aws-docs-example-queue")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < messages; i++ {
+		_, err = api.SendMessage(context.Background(), &sqs.SendMessageInput{
+			QueueUrl:    output.QueueUrl,
+			MessageBody: aws.String(strconv.Itoa(i)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return api, output.QueueUrl
+}
+
+// queueLength returns how many messages are left in the queue, visible or not
+func queueLength(t *testing.T, api *sqsfake.Service, queueURL *string) int {
+	output, err := api.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       queueURL,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	visible, _ := strconv.Atoi(output.Attributes["ApproximateNumberOfMessages"])
+	hidden, _ := strconv.Atoi(output.Attributes["ApproximateNumberOfMessagesNotVisible"])
+
+	return visible + hidden
+}
+
+func TestConsume(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	api, queueURL := newQueue(t, 40)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	seen := map[string]int{}
+
+	var inFlight, maxInFlight int32
+
+	handler := func(ctx context.Context, msg types.Message) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen[*msg.Body]++
+		if len(seen) == 40 {
+			cancel()
+		}
+
+		return nil
+	}
+
+	err := Consume(ctx, api, queueURL, handler, ConsumerOptions{Pollers: 3, MaxInFlight: 4, WaitTimeSeconds: aws.Int32(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for body, n := range seen {
+		if n != 1 {
+			t.Errorf("Message %s was handled %d times instead of once", body, n)
+		}
+	}
+
+	if len(seen) != 40 {
+		t.Errorf("Handled %d messages instead of 40", len(seen))
+	}
+
+	if maxInFlight > 4 {
+		t.Errorf("Handled %d messages at once instead of at most 4", maxInFlight)
+	}
+
+	if n := queueLength(t, api, queueURL); n != 0 {
+		t.Errorf("%d messages were not deleted", n)
+	}
+}
+
+func TestConsumeExtendsVisibility(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	api, queueURL := newQueue(t, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled int32
+
+	handler := func(ctx context.Context, msg types.Message) error {
+		// Outlast the 1-second visibility timeout, so another poller would get the message without extensions
+		if atomic.AddInt32(&handled, 1) == 1 {
+			time.Sleep(1500 * time.Millisecond)
+		}
+
+		cancel()
+
+		return nil
+	}
+
+	var errs []error
+	var mu sync.Mutex
+
+	opts := ConsumerOptions{
+		Pollers:           2,
+		WaitTimeSeconds:   aws.Int32(1),
+		VisibilityTimeout: 1,
+		Heartbeat:         200 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			errs = append(errs, err)
+		},
+	}
+
+	err := Consume(ctx, api, queueURL, handler, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if handled != 1 || len(errs) != 0 {
+		t.Errorf("Handled the message %d times instead of once, with errors %v", handled, errs)
+	}
+
+	if n := queueLength(t, api, queueURL); n != 0 {
+		t.Errorf("%d messages were not deleted", n)
+	}
+}
+
+func TestConsumeHandlerError(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	api, queueURL := newQueue(t, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failure := errors.New("can't handle the message")
+
+	var reported error
+
+	opts := ConsumerOptions{
+		WaitTimeSeconds: aws.Int32(1),
+		OnError: func(err error) {
+			reported = err
+			cancel()
+		},
+	}
+
+	err := Consume(ctx, api, queueURL, func(ctx context.Context, msg types.Message) error {
+		return failure
+	}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msgErr *MessageError
+	if !errors.As(reported, &msgErr) || msgErr.Op != "handle" || !errors.Is(reported, failure) {
+		t.Errorf("Got the error %v instead of the handler's error", reported)
+	}
+
+	if n := queueLength(t, api, queueURL); n != 1 {
+		t.Errorf("%d messages are left instead of the failed message", n)
+	}
+}
+
+func TestConsumeStopsGracefully(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	api, queueURL := newQueue(t, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var finished int32
+
+	handler := func(handlerCtx context.Context, msg types.Message) error {
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+
+		if handlerCtx.Err() != nil {
+			return handlerCtx.Err()
+		}
+
+		atomic.StoreInt32(&finished, 1)
+
+		return nil
+	}
+
+	err := Consume(ctx, api, queueURL, handler, ConsumerOptions{WaitTimeSeconds: aws.Int32(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Error("Consume returned before the handler finished")
+	}
+
+	if n := queueLength(t, api, queueURL); n != 0 {
+		t.Errorf("%d messages were not deleted", n)
+	}
+}
+
+func TestConsumeOptions(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	api, queueURL := newQueue(t, 0)
+
+	invalid := []ConsumerOptions{
+		{WaitTimeSeconds: aws.Int32(21)},
+		{WaitTimeSeconds: aws.Int32(-1)},
+		{MaxInFlight: -1},
+		{VisibilityTimeout: 2, Heartbeat: 2 * time.Second},
+	}
+
+	for _, opts := range invalid {
+		err := Consume(context.Background(), api, queueURL, nil, opts)
+		if err == nil {
+			t.Errorf("Got no error for the invalid options %+v", opts)
+		}
+	}
+}
+
+// waitRecorder records the WaitTimeSeconds of each ReceiveMessage call, and stops the consumer after the first
+type waitRecorder struct {
+	SQSConsumeAPI
+	cancel func()
+	waits  chan int32
+}
+
+func (r *waitRecorder) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	select {
+	case r.waits <- params.WaitTimeSeconds:
+		r.cancel()
+	default:
+	}
+
+	return r.SQSConsumeAPI.ReceiveMessage(ctx, params, optFns...)
+}
+
+func TestConsumeWaitTime(t *testing.T) {
+	thisTime := time.Now()
+	nowString := thisTime.Format("2006-01-02 15:04:05 Monday")
+	t.Log("Starting unit test at " + nowString)
+
+	api, queueURL := newQueue(t, 0)
+
+	tests := []struct {
+		wait *int32
+		want int32
+	}{
+		{nil, 20},
+		{aws.Int32(0), 0},
+		{aws.Int32(5), 5},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &waitRecorder{SQSConsumeAPI: api, cancel: cancel, waits: make(chan int32, 1)}
+
+		err := Consume(ctx, r, queueURL, nil, ConsumerOptions{WaitTimeSeconds: test.wait})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := <-r.waits; got != test.want {
+			t.Errorf("Received messages with WaitTimeSeconds %d instead of %d", got, test.want)
+		}
+	}
+}
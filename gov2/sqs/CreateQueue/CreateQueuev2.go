@@ -7,6 +7,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -32,8 +33,44 @@ func CreateQueue(c context.Context, api SQSCreateQueueAPI, input *sqs.CreateQueu
 	return api.CreateQueue(c, input)
 }
 
+// QueueInput builds the input to create a queue that delays messages for 60 seconds and keeps them for a day.
+// A FIFO queue delivers the messages of each message group in order, and drops duplicate messages.
+// Inputs:
+//     name is the name of the queue. For a FIFO queue, the .fifo suffix is added if it is missing.
+//     fifo is whether to create a FIFO queue.
+//     contentDedup is whether a FIFO queue uses a SHA-256 hash of each message body
+//     as the deduplication ID of messages sent without one.
+// Output:
+//     The input for CreateQueue.
+func QueueInput(name string, fifo, contentDedup bool) *sqs.CreateQueueInput {
+	input := &sqs.CreateQueueInput{
+		Attributes: map[string]string{
+			"DelaySeconds":           "60",
+			"MessageRetentionPeriod": "86400",
+		},
+	}
+
+	if fifo {
+		if !strings.HasSuffix(name, ".fifo") {
+			name += ".fifo"
+		}
+
+		input.Attributes["FifoQueue"] = "true"
+
+		if contentDedup {
+			input.Attributes["ContentBasedDeduplication"] = "true"
+		}
+	}
+
+	input.QueueName = &name
+
+	return input
+}
+
 func main() {
 	queue := flag.String("q", "", "The name of the queue")
+	fifo := flag.Bool("f", false, "Whether to create a FIFO queue")
+	contentDedup := flag.Bool("c", false, "Whether a FIFO queue deduplicates messages by the hash of their body")
 	flag.Parse()
 
 	if *queue == "" {
@@ -41,6 +78,11 @@ func main() {
 		return
 	}
 
+	if *contentDedup && !*fifo {
+		fmt.Println("Only FIFO queues (-f) support content-based deduplication (-c)")
+		return
+	}
+
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		panic("configuration error, " + err.Error())
@@ -48,13 +90,7 @@ func main() {
 
 	client := sqs.NewFromConfig(cfg)
 
-	input := &sqs.CreateQueueInput{
-		QueueName: queue,
-		Attributes: map[string]string{
-			"DelaySeconds":           "60",
-			"MessageRetentionPeriod": "86400",
-		},
-	}
+	input := QueueInput(*queue, *fifo, *contentDedup)
 
 	result, err := CreateQueue(context.TODO(), client, input)
 	if err != nil {
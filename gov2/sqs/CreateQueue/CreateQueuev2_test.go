@@ -13,6 +13,8 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
 )
 
 type SQSCreateQueueImpl struct{}
@@ -86,3 +88,83 @@ func TestCreateQueue(t *testing.T) {
 
 	t.Log("URL: " + *result.QueueUrl)
 }
+
+func TestCreateQueueLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	client := sqs.NewFromConfig(server.Config())
+
+	input := &sqs.CreateQueueInput{
+		QueueName: aws.String("doc-example-queue"),
+		Attributes: map[string]string{
+			"DelaySeconds":           "60",
+			"MessageRetentionPeriod": "86400",
+		},
+	}
+
+	result, err := CreateQueue(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes, err := server.SQS.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       result.QueueUrl,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attributes.Attributes["DelaySeconds"] != "60" || attributes.Attributes["MessageRetentionPeriod"] != "86400" {
+		t.Errorf("Expected the queue attributes to be set, got %v", attributes.Attributes)
+	}
+
+	// Creating the same queue again returns the same URL
+	again, err := CreateQueue(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *again.QueueUrl != *result.QueueUrl {
+		t.Errorf("Expected %v, got %v", *result.QueueUrl, *again.QueueUrl)
+	}
+}
+
+func TestCreateFifoQueueLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	client := sqs.NewFromConfig(server.Config())
+
+	input := QueueInput("doc-example-queue", true, true)
+	if *input.QueueName != "doc-example-queue.fifo" {
+		t.Errorf("Expected the .fifo suffix, got %v", *input.QueueName)
+	}
+
+	result, err := CreateQueue(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes, err := server.SQS.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       result.QueueUrl,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attributes.Attributes["FifoQueue"] != "true" || attributes.Attributes["ContentBasedDeduplication"] != "true" {
+		t.Errorf("Expected a FIFO queue with content-based deduplication, got %v", attributes.Attributes)
+	}
+
+	// A FIFO queue needs the .fifo suffix
+	_, err = CreateQueue(context.Background(), client, &sqs.CreateQueueInput{
+		QueueName:  aws.String("doc-example-queue"),
+		Attributes: map[string]string{"FifoQueue": "true"},
+	})
+	if err == nil {
+		t.Error("Expected an error creating a FIFO queue without the .fifo suffix")
+	}
+}
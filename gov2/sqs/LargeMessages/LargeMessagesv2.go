@@ -0,0 +1,621 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[sqs.go-v2.LargeMessages]
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// S3PutObjectAPI defines the interface for the PutObject function.
+// We use this interface to test the function using a mocked service.
+type S3PutObjectAPI interface {
+	PutObject(ctx context.Context,
+		params *s3.PutObjectInput,
+		optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3GetObjectAPI defines the interface for the GetObject function.
+// We use this interface to test the function using a mocked service.
+type S3GetObjectAPI interface {
+	GetObject(ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// S3DeleteObjectAPI defines the interface for the DeleteObject function.
+// We use this interface to test the function using a mocked service.
+type S3DeleteObjectAPI interface {
+	DeleteObject(ctx context.Context,
+		params *s3.DeleteObjectInput,
+		optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// S3PayloadAPI defines the interface for the Amazon S3 functions that store message payloads.
+// We use this interface to test the functions using a mocked service.
+type S3PayloadAPI interface {
+	S3PutObjectAPI
+	S3GetObjectAPI
+	S3DeleteObjectAPI
+}
+
+// SQSSendMessageAPI defines the interface for the SendMessage function.
+// We use this interface to test the function using a mocked service.
+type SQSSendMessageAPI interface {
+	SendMessage(ctx context.Context,
+		params *sqs.SendMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// SQSReceiveMessageAPI defines the interface for the ReceiveMessage function.
+// We use this interface to test the function using a mocked service.
+type SQSReceiveMessageAPI interface {
+	ReceiveMessage(ctx context.Context,
+		params *sqs.ReceiveMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+}
+
+// SQSDeleteMessageAPI defines the interface for the DeleteMessage function.
+// We use this interface to test the function using a mocked service.
+type SQSDeleteMessageAPI interface {
+	DeleteMessage(ctx context.Context,
+		params *sqs.DeleteMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// SNSPublishAPI defines the interface for the Publish function.
+// We use this interface to test the function using a mocked service.
+type SNSPublishAPI interface {
+	Publish(ctx context.Context,
+		params *sns.PublishInput,
+		optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// The names and formats below are the ones that the Amazon SQS Extended Client Library for Java
+// and the Payload Offloading Java Common Library for AWS use,
+// so that messages can be exchanged with applications that use those libraries.
+const (
+	// MaxMessageSize is the most bytes that a message body and its attributes can have in Amazon SQS and Amazon SNS.
+	MaxMessageSize = 262144
+
+	// MaxMessageAttributes is the most message attributes that a message can have in Amazon SQS and Amazon SNS.
+	MaxMessageAttributes = 10
+
+	// PayloadSizeAttribute is the message attribute that holds the size of an offloaded body.
+	PayloadSizeAttribute = "ExtendedPayloadSize"
+
+	pointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	bucketMarker = "-..s3BucketName..-"
+	keyMarker    = "-..s3Key..-"
+)
+
+// ErrTooManyAttributes is returned by Offloader.SendMessage and Offloader.Publish for a message to offload
+// that already has MaxMessageAttributes message attributes, which leaves no room for PayloadSizeAttribute.
+var ErrTooManyAttributes = fmt.Errorf("a message to offload can have at most %d message attributes", MaxMessageAttributes-1)
+
+// ErrJSONMessageStructure is returned by Offloader.Publish for a message to offload whose MessageStructure is json,
+// since its body must be a JSON object with a message for each protocol, which a pointer isn't.
+var ErrJSONMessageStructure = errors.New("a message with the json message structure can't be offloaded")
+
+// ErrNotPointer is returned by ParsePointer for a body that isn't a pointer to an offloaded payload.
+var ErrNotPointer = errors.New("message body isn't a pointer to an Amazon S3 object")
+
+// Pointer is the location of an offloaded message body in Amazon S3.
+type Pointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// String returns the message body that stands in for the offloaded body.
+func (p Pointer) String() string {
+	data, _ := json.Marshal([]interface{}{pointerClass, p})
+	return string(data)
+}
+
+// ParsePointer parses a message body created by Pointer.String.
+// Inputs:
+//     body is the message body.
+// Output:
+//     If body is a pointer, the Pointer and nil.
+//     Otherwise, an empty Pointer and ErrNotPointer.
+func ParsePointer(body string) (Pointer, error) {
+	var parts []json.RawMessage
+	if !strings.HasPrefix(body, "[") || json.Unmarshal([]byte(body), &parts) != nil || len(parts) != 2 {
+		return Pointer{}, ErrNotPointer
+	}
+
+	var class string
+	var p Pointer
+	if json.Unmarshal(parts[0], &class) != nil || class != pointerClass ||
+		json.Unmarshal(parts[1], &p) != nil || p.Bucket == "" || p.Key == "" {
+		return Pointer{}, ErrNotPointer
+	}
+
+	return p, nil
+}
+
+// OriginalReceiptHandle returns the Amazon SQS receipt handle within one returned by Offloader.ReceiveMessage,
+// for calls such as ChangeMessageVisibility that don't go through an Offloader.
+// Other receipt handles are returned unchanged.
+func OriginalReceiptHandle(receiptHandle string) string {
+	_, handle, ok := splitReceiptHandle(receiptHandle)
+	if !ok {
+		return receiptHandle
+	}
+
+	return handle
+}
+
+// splitReceiptHandle parses a receipt handle that has the location of the message's payload embedded in it.
+func splitReceiptHandle(receiptHandle string) (Pointer, string, bool) {
+	if !strings.HasPrefix(receiptHandle, bucketMarker) {
+		return Pointer{}, "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(receiptHandle, bucketMarker), bucketMarker, 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], keyMarker) {
+		return Pointer{}, "", false
+	}
+
+	rest := strings.SplitN(strings.TrimPrefix(parts[1], keyMarker), keyMarker, 2)
+	if len(rest) != 2 {
+		return Pointer{}, "", false
+	}
+
+	return Pointer{Bucket: parts[0], Key: rest[0]}, rest[1], true
+}
+
+// Offloader stores message bodies that are too big for Amazon SQS or Amazon SNS in an Amazon S3 bucket,
+// and sends a pointer to the object in their place.
+type Offloader struct {
+	// S3 stores the offloaded bodies
+	S3 S3PayloadAPI
+
+	// Bucket is the name of the bucket in which the bodies are stored
+	Bucket string
+
+	// Threshold is the size, in bytes, of the body and message attributes above which the body is offloaded.
+	// The default is MaxMessageSize.
+	Threshold int
+
+	// RetainPayloads keeps DeleteMessage from deleting a message's payload.
+	// Set it when several queues receive the same payload, such as from an Amazon SNS topic,
+	// and remove the objects with an S3 Lifecycle rule instead.
+	RetainPayloads bool
+}
+
+func (o *Offloader) threshold() int {
+	if o.Threshold <= 0 {
+		return MaxMessageSize
+	}
+
+	return o.Threshold
+}
+
+// newKey returns a random object key, formatted like a UUID.
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// store uploads body to a new object.
+func (o *Offloader) store(c context.Context, body string) (Pointer, error) {
+	key, err := newKey()
+	if err != nil {
+		return Pointer{}, err
+	}
+
+	p := Pointer{Bucket: o.Bucket, Key: key}
+
+	_, err = o.S3.PutObject(c, &s3.PutObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.Key),
+		Body:   strings.NewReader(body),
+	})
+	if err != nil {
+		return Pointer{}, fmt.Errorf("store message body in %s: %w", p.Bucket, err)
+	}
+
+	return p, nil
+}
+
+// discard deletes an object stored for a message that wasn't sent.
+// The send error matters more than any error deleting it.
+func (o *Offloader) discard(p Pointer) {
+	o.S3.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.Key),
+	})
+}
+
+// SendMessage sends a message to an Amazon SQS queue,
+// storing its body in Amazon S3 if the body and message attributes are bigger than the threshold.
+// An offloaded message sent to a FIFO queue without a deduplication ID
+// uses the SHA-256 hash of its body, since the pointer is different every time.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a SendMessageOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to PutObject or SendMessage,
+//     or ErrTooManyAttributes for a message that can't be offloaded.
+func (o *Offloader) SendMessage(c context.Context, api SQSSendMessageAPI, input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	body := aws.ToString(input.MessageBody)
+
+	size := len(body)
+	for name, v := range input.MessageAttributes {
+		size += len(name) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	if size <= o.threshold() {
+		return api.SendMessage(c, input)
+	}
+
+	if len(input.MessageAttributes) >= MaxMessageAttributes {
+		return nil, ErrTooManyAttributes
+	}
+
+	p, err := o.store(c, body)
+	if err != nil {
+		return nil, err
+	}
+
+	offloaded := *input
+	offloaded.MessageBody = aws.String(p.String())
+	offloaded.MessageAttributes = map[string]types.MessageAttributeValue{
+		PayloadSizeAttribute: {
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.Itoa(len(body))),
+		},
+	}
+
+	for name, v := range input.MessageAttributes {
+		offloaded.MessageAttributes[name] = v
+	}
+
+	if input.MessageGroupId != nil && input.MessageDeduplicationId == nil {
+		sum := sha256.Sum256([]byte(body))
+		offloaded.MessageDeduplicationId = aws.String(hex.EncodeToString(sum[:]))
+	}
+
+	output, err := api.SendMessage(c, &offloaded)
+	if err != nil {
+		o.discard(p)
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// Publish publishes a message to an Amazon SNS topic,
+// storing its body in Amazon S3 if the body and message attributes are bigger than the threshold.
+// Amazon SQS queues that receive the message should use raw message delivery,
+// so that Offloader.ReceiveMessage gets the pointer and its message attributes.
+// An offloaded message published to a FIFO topic without a deduplication ID
+// uses the SHA-256 hash of its body, since the pointer is different every time.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a PublishOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to PutObject or Publish,
+//     or ErrJSONMessageStructure or ErrTooManyAttributes for a message that can't be offloaded.
+func (o *Offloader) Publish(c context.Context, api SNSPublishAPI, input *sns.PublishInput) (*sns.PublishOutput, error) {
+	body := aws.ToString(input.Message)
+
+	size := len(body)
+	for name, v := range input.MessageAttributes {
+		size += len(name) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+
+	if size <= o.threshold() {
+		return api.Publish(c, input)
+	}
+
+	if aws.ToString(input.MessageStructure) == "json" {
+		return nil, ErrJSONMessageStructure
+	}
+
+	if len(input.MessageAttributes) >= MaxMessageAttributes {
+		return nil, ErrTooManyAttributes
+	}
+
+	p, err := o.store(c, body)
+	if err != nil {
+		return nil, err
+	}
+
+	offloaded := *input
+	offloaded.Message = aws.String(p.String())
+	offloaded.MessageAttributes = map[string]snstypes.MessageAttributeValue{
+		PayloadSizeAttribute: {
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.Itoa(len(body))),
+		},
+	}
+
+	for name, v := range input.MessageAttributes {
+		offloaded.MessageAttributes[name] = v
+	}
+
+	if input.MessageGroupId != nil && input.MessageDeduplicationId == nil {
+		sum := sha256.Sum256([]byte(body))
+		offloaded.MessageDeduplicationId = aws.String(hex.EncodeToString(sum[:]))
+	}
+
+	output, err := api.Publish(c, &offloaded)
+	if err != nil {
+		o.discard(p)
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// PayloadError is returned by Offloader.ReceiveMessage, along with the messages it did resolve,
+// when it can't get the bodies of some offloaded messages.
+// Those messages stay in the queue, and are received again once their visibility timeout ends.
+type PayloadError struct {
+	// Messages are the messages whose bodies couldn't be retrieved, as Amazon SQS returned them.
+	Messages []types.Message
+
+	// Errors are the reasons, in the same order as Messages.
+	Errors []error
+}
+
+func (e *PayloadError) Error() string {
+	reasons := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		reasons[i] = err.Error()
+	}
+
+	return fmt.Sprintf("can't get the bodies of %d message(s): %s", len(e.Errors), strings.Join(reasons, "; "))
+}
+
+// MessageIDs returns the IDs of the messages whose bodies couldn't be retrieved.
+func (e *PayloadError) MessageIDs() []string {
+	ids := make([]string, len(e.Messages))
+	for i, msg := range e.Messages {
+		ids[i] = aws.ToString(msg.MessageId)
+	}
+
+	return ids
+}
+
+// resolve replaces the body of an offloaded message with the body stored in Amazon S3.
+func (o *Offloader) resolve(c context.Context, msg *types.Message) error {
+	p, err := ParsePointer(aws.ToString(msg.Body))
+	if err != nil {
+		return fmt.Errorf("message %s: %w", aws.ToString(msg.MessageId), err)
+	}
+
+	object, err := o.S3.GetObject(c, &s3.GetObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("message %s: get body from %s/%s: %w", aws.ToString(msg.MessageId), p.Bucket, p.Key, err)
+	}
+
+	body, err := ioutil.ReadAll(object.Body)
+	object.Body.Close()
+	if err != nil {
+		return fmt.Errorf("message %s: read body from %s/%s: %w", aws.ToString(msg.MessageId), p.Bucket, p.Key, err)
+	}
+
+	msg.Body = aws.String(string(body))
+	msg.ReceiptHandle = aws.String(bucketMarker + p.Bucket + bucketMarker + keyMarker + p.Key + keyMarker + aws.ToString(msg.ReceiptHandle))
+	delete(msg.MessageAttributes, PayloadSizeAttribute)
+
+	return nil
+}
+
+// ReceiveMessage gets messages from an Amazon SQS queue, and replaces the body of each offloaded message
+// with the body stored in Amazon S3.
+// The receipt handle of an offloaded message includes the location of its body,
+// so that Offloader.DeleteMessage can delete both.
+// A message whose body can't be retrieved doesn't stop the others.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ReceiveMessageOutput object containing the result of the service call and nil.
+//     If the bodies of some messages can't be retrieved, a ReceiveMessageOutput object without them,
+//     and a *PayloadError that lists them.
+//     Otherwise, nil and an error from the call to ReceiveMessage.
+func (o *Offloader) ReceiveMessage(c context.Context, api SQSReceiveMessageAPI, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	// The size attribute is what marks an offloaded message
+	params := *input
+	params.MessageAttributeNames = append([]string{PayloadSizeAttribute}, input.MessageAttributeNames...)
+
+	output, err := api.ReceiveMessage(c, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed PayloadError
+
+	resolved := output.Messages[:0]
+	for _, msg := range output.Messages {
+		if _, ok := msg.MessageAttributes[PayloadSizeAttribute]; ok {
+			// resolve changes msg only if it succeeds
+			err := o.resolve(c, &msg)
+			if err != nil {
+				failed.Messages = append(failed.Messages, msg)
+				failed.Errors = append(failed.Errors, err)
+				continue
+			}
+		}
+
+		resolved = append(resolved, msg)
+	}
+
+	output.Messages = resolved
+
+	if len(failed.Errors) > 0 {
+		return output, &failed
+	}
+
+	return output, nil
+}
+
+// DeleteMessage deletes a message from an Amazon SQS queue, and then its body from Amazon S3,
+// unless RetainPayloads is set.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a DeleteMessageOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to DeleteMessage or DeleteObject.
+func (o *Offloader) DeleteMessage(c context.Context, api SQSDeleteMessageAPI, input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	p, handle, ok := splitReceiptHandle(aws.ToString(input.ReceiptHandle))
+	if !ok {
+		return api.DeleteMessage(c, input)
+	}
+
+	params := *input
+	params.ReceiptHandle = aws.String(handle)
+
+	output, err := api.DeleteMessage(c, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.RetainPayloads {
+		return output, nil
+	}
+
+	_, err = o.S3.DeleteObject(c, &s3.DeleteObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("delete body from %s/%s: %w", p.Bucket, p.Key, err)
+	}
+
+	return output, nil
+}
+
+func main() {
+	queue := flag.String("q", "", "The name of the queue")
+	topic := flag.String("t", "", "The ARN of a topic to publish the message to instead")
+	bucket := flag.String("b", "", "The bucket to store large messages in")
+	size := flag.Int("s", 300, "The size of the message, in KiB")
+	flag.Parse()
+
+	if (*queue == "") == (*topic == "") || *bucket == "" {
+		fmt.Println("You must supply a bucket name (-b BUCKET) and either a queue name (-q QUEUE) or a topic ARN (-t TOPIC)")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	offloader := &Offloader{
+		S3:     s3.NewFromConfig(cfg),
+		Bucket: *bucket,
+	}
+
+	body := strings.Repeat("0123456789abcdef", *size*64)
+
+	if *topic != "" {
+		resp, err := offloader.Publish(context.TODO(), sns.NewFromConfig(cfg), &sns.PublishInput{
+			Message:  aws.String(body),
+			TopicArn: topic,
+		})
+		if err != nil {
+			fmt.Println("Got an error publishing the message:")
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Println("Published message with ID: " + *resp.MessageId)
+		return
+	}
+
+	client := sqs.NewFromConfig(cfg)
+
+	urlResult, err := client.GetQueueUrl(context.TODO(), &sqs.GetQueueUrlInput{QueueName: queue})
+	if err != nil {
+		fmt.Println("Got an error getting the queue URL:")
+		fmt.Println(err)
+		return
+	}
+
+	queueURL := urlResult.QueueUrl
+
+	sent, err := offloader.SendMessage(context.TODO(), client, &sqs.SendMessageInput{
+		MessageBody: aws.String(body),
+		QueueUrl:    queueURL,
+	})
+	if err != nil {
+		fmt.Println("Got an error sending the message:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("Sent message with ID: " + *sent.MessageId)
+
+	received, err := offloader.ReceiveMessage(context.TODO(), client, &sqs.ReceiveMessageInput{
+		QueueUrl:        queueURL,
+		WaitTimeSeconds: 10,
+	})
+
+	// Messages whose bodies couldn't be retrieved are left in the queue, and the others are handled
+	var payloadErr *PayloadError
+	if errors.As(err, &payloadErr) {
+		fmt.Println("Got an error getting the bodies of messages " + strings.Join(payloadErr.MessageIDs(), ", ") + ":")
+		fmt.Println(err)
+	} else if err != nil {
+		fmt.Println("Got an error receiving the message:")
+		fmt.Println(err)
+		return
+	}
+
+	for _, msg := range received.Messages {
+		fmt.Println("Received message " + *msg.MessageId + " with a body of " + strconv.Itoa(len(*msg.Body)) + " bytes")
+
+		_, err := offloader.DeleteMessage(context.TODO(), client, &sqs.DeleteMessageInput{
+			QueueUrl:      queueURL,
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+		if err != nil {
+			fmt.Println("Got an error deleting the message:")
+			fmt.Println(err)
+			return
+		}
+	}
+}
+
+// snippet-end:[sqs.go-v2.LargeMessages]
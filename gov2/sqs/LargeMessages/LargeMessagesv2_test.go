@@ -0,0 +1,520 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/s3fake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/snsfake"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/sqsfake"
+)
+
+const testBucket = "aws-docs-example-bucket"
+
+// newTestStore creates the bucket that holds offloaded bodies.
+func newTestStore(t *testing.T, api *s3fake.Service) {
+	_, err := api.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// objectCount returns the number of objects in the test bucket.
+func objectCount(t *testing.T, api *s3fake.Service) int {
+	output, err := api.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(output.Contents)
+}
+
+func newTestQueue(t *testing.T, api *sqsfake.Service, name string, attributes map[string]string) *string {
+	output, err := api.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: attributes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output.QueueUrl
+}
+
+func TestSendAndReceive(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	api := sqsfake.New()
+	queueURL := newTestQueue(t, api, "aws-docs-example-queue", nil)
+
+	offloader := &Offloader{S3: store, Bucket: testBucket}
+
+	small := "Information about the NY Times fiction bestseller for the week of 12/11/2016."
+	large := strings.Repeat("0123456789abcdef", 20000)
+
+	// The queue refuses the large body on its own
+	_, err := api.SendMessage(context.Background(), &sqs.SendMessageInput{QueueUrl: queueURL, MessageBody: aws.String(large)})
+	if err == nil {
+		t.Fatal("Expected an error sending a 320,000-byte message directly")
+	}
+
+	for _, body := range []string{small, large} {
+		_, err := offloader.SendMessage(context.Background(), api, &sqs.SendMessageInput{
+			QueueUrl:    queueURL,
+			MessageBody: aws.String(body),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"Title": {DataType: aws.String("String"), StringValue: aws.String("The Whistler")},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := objectCount(t, store); n != 1 {
+		t.Fatalf("Expected only the large body in Amazon S3, got %d objects", n)
+	}
+
+	received, err := offloader.ReceiveMessage(context.Background(), api, &sqs.ReceiveMessageInput{
+		QueueUrl:              queueURL,
+		MaxNumberOfMessages:   10,
+		MessageAttributeNames: []string{"Title"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.Messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(received.Messages))
+	}
+
+	for _, msg := range received.Messages {
+		if *msg.Body != small && *msg.Body != large {
+			t.Errorf("Got an unexpected body of %d bytes", len(*msg.Body))
+		}
+
+		if len(msg.MessageAttributes) != 1 || *msg.MessageAttributes["Title"].StringValue != "The Whistler" {
+			t.Errorf("Expected only the Title attribute, got %v", msg.MessageAttributes)
+		}
+
+		_, err := offloader.DeleteMessage(context.Background(), api, &sqs.DeleteMessageInput{
+			QueueUrl:      queueURL,
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := objectCount(t, store); n != 0 {
+		t.Errorf("Expected deleting the messages to delete their bodies, got %d objects", n)
+	}
+
+	attributes, err := api.GetQueueAttributes(context.Background(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       queueURL,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attributes.Attributes["ApproximateNumberOfMessages"] != "0" || attributes.Attributes["ApproximateNumberOfMessagesNotVisible"] != "0" {
+		t.Errorf("Expected an empty queue, got %v", attributes.Attributes)
+	}
+}
+
+func TestRetainPayloads(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	api := sqsfake.New()
+	queueURL := newTestQueue(t, api, "aws-docs-example-queue", nil)
+
+	offloader := &Offloader{S3: store, Bucket: testBucket, Threshold: 10, RetainPayloads: true}
+
+	_, err := offloader.SendMessage(context.Background(), api, &sqs.SendMessageInput{
+		QueueUrl:    queueURL,
+		MessageBody: aws.String("More than ten bytes"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := offloader.ReceiveMessage(context.Background(), api, &sqs.ReceiveMessageInput{QueueUrl: queueURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.Messages) != 1 || *received.Messages[0].Body != "More than ten bytes" {
+		t.Fatalf("Expected the offloaded message, got %v", received.Messages)
+	}
+
+	handle := *received.Messages[0].ReceiptHandle
+	if OriginalReceiptHandle(handle) == handle {
+		t.Errorf("Expected the receipt handle %s to include the location of the body", handle)
+	}
+
+	_, err = offloader.DeleteMessage(context.Background(), api, &sqs.DeleteMessageInput{
+		QueueUrl:      queueURL,
+		ReceiptHandle: aws.String(handle),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := objectCount(t, store); n != 1 {
+		t.Errorf("Expected the body to be kept, got %d objects", n)
+	}
+}
+
+func TestReceivePayloadErrors(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	api := sqsfake.New()
+	queueURL := newTestQueue(t, api, "aws-docs-example-queue", nil)
+
+	offloader := &Offloader{S3: store, Bucket: testBucket, Threshold: 10}
+
+	var lost string
+	for _, body := range []string{"Small", "More than ten bytes", "Also more than ten bytes"} {
+		sent, err := offloader.SendMessage(context.Background(), api, &sqs.SendMessageInput{
+			QueueUrl:    queueURL,
+			MessageBody: aws.String(body),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.HasPrefix(body, "Also") {
+			lost = *sent.MessageId
+		}
+	}
+
+	// The body of one message is gone, and another claims to be offloaded but isn't
+	listed, err := store.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String(testBucket)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, object := range listed.Contents {
+		got, err := store.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String(testBucket), Key: object.Key})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(got.Body)
+		if string(body) == "Also more than ten bytes" {
+			store.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: object.Key})
+		}
+	}
+
+	bogus, err := api.SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    queueURL,
+		MessageBody: aws.String("Not a pointer"),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			PayloadSizeAttribute: {DataType: aws.String("Number"), StringValue: aws.String("13")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := offloader.ReceiveMessage(context.Background(), api, &sqs.ReceiveMessageInput{
+		QueueUrl:            queueURL,
+		MaxNumberOfMessages: 10,
+	})
+
+	var payloadErr *PayloadError
+	if !errors.As(err, &payloadErr) {
+		t.Fatalf("Expected a PayloadError, got %v", err)
+	}
+
+	if received == nil || len(received.Messages) != 2 {
+		t.Fatalf("Expected the 2 messages with bodies, got %v", received)
+	}
+
+	for _, msg := range received.Messages {
+		if *msg.Body != "Small" && *msg.Body != "More than ten bytes" {
+			t.Errorf("Got an unexpected body %q", *msg.Body)
+		}
+	}
+
+	ids := payloadErr.MessageIDs()
+	if len(ids) != 2 || ids[0] == ids[1] || (ids[0] != lost && ids[0] != *bogus.MessageId) || (ids[1] != lost && ids[1] != *bogus.MessageId) {
+		t.Errorf("Expected messages %s and %s to fail, got %v", lost, *bogus.MessageId, ids)
+	}
+
+	for i, msg := range payloadErr.Messages {
+		if *msg.MessageId == *bogus.MessageId && !errors.Is(payloadErr.Errors[i], ErrNotPointer) {
+			t.Errorf("Expected ErrNotPointer for message %s, got %v", *msg.MessageId, payloadErr.Errors[i])
+		}
+
+		// The failed messages are returned as Amazon SQS returned them
+		if handle := *msg.ReceiptHandle; OriginalReceiptHandle(handle) != handle {
+			t.Errorf("Expected the original receipt handle for message %s, got %s", *msg.MessageId, handle)
+		}
+	}
+}
+
+// failingSender is a queue that refuses every message
+type failingSender struct{}
+
+var errSend = errors.New("can't send")
+
+func (failingSender) SendMessage(ctx context.Context,
+	params *sqs.SendMessageInput,
+	optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	return nil, errSend
+}
+
+func TestSendFailureDiscardsPayload(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	offloader := &Offloader{S3: store, Bucket: testBucket, Threshold: 10}
+
+	_, err := offloader.SendMessage(context.Background(), failingSender{}, &sqs.SendMessageInput{
+		QueueUrl:    aws.String("https://sqs.REGION.amazonaws.com/ACCOUNT#/aws-docs-example-queue"),
+		MessageBody: aws.String("More than ten bytes"),
+	})
+	if !errors.Is(err, errSend) {
+		t.Errorf("Expected the send error, got %v", err)
+	}
+
+	if n := objectCount(t, store); n != 0 {
+		t.Errorf("Expected the body of the unsent message to be deleted, got %d objects", n)
+	}
+}
+
+func TestSendFifo(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	api := sqsfake.New()
+	queueURL := newTestQueue(t, api, "aws-docs-example-queue.fifo", map[string]string{"FifoQueue": "true"})
+
+	offloader := &Offloader{S3: store, Bucket: testBucket, Threshold: 10}
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		output, err := offloader.SendMessage(context.Background(), api, &sqs.SendMessageInput{
+			QueueUrl:       queueURL,
+			MessageBody:    aws.String("More than ten bytes"),
+			MessageGroupId: aws.String("reports"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, *output.MessageId)
+	}
+
+	if ids[0] != ids[1] {
+		t.Errorf("Expected the same body to be deduplicated, got messages %v", ids)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	api := snsfake.New()
+	topic, err := api.CreateTopic(context.Background(), &sns.CreateTopicInput{Name: aws.String("aws-docs-example-topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := strings.Repeat("0123456789abcdef", 20000)
+
+	_, err = api.Publish(context.Background(), &sns.PublishInput{TopicArn: topic.TopicArn, Message: aws.String(large)})
+	if err == nil {
+		t.Fatal("Expected an error publishing a 320,000-byte message directly")
+	}
+
+	offloader := &Offloader{S3: store, Bucket: testBucket}
+
+	_, err = offloader.Publish(context.Background(), api, &sns.PublishInput{TopicArn: topic.TopicArn, Message: aws.String(large)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := api.Published()
+	if len(published) != 1 {
+		t.Fatalf("Expected 1 published message, got %d", len(published))
+	}
+
+	p, err := ParsePointer(published[0].Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Bucket != testBucket || *published[0].MessageAttributes[PayloadSizeAttribute].StringValue != "320000" {
+		t.Errorf("Got pointer %v and attributes %v", p, published[0].MessageAttributes)
+	}
+
+	object, err := store.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String(p.Bucket), Key: aws.String(p.Key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if object.ContentLength != int64(len(large)) {
+		t.Errorf("Expected a %d-byte object, got %d bytes", len(large), object.ContentLength)
+	}
+}
+
+func TestPublishFifo(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	api := snsfake.New()
+	topic, err := api.CreateTopic(context.Background(), &sns.CreateTopicInput{
+		Name:       aws.String("aws-docs-example-topic.fifo"),
+		Attributes: map[string]string{"FifoTopic": "true", "ContentBasedDeduplication": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offloader := &Offloader{S3: store, Bucket: testBucket, Threshold: 10}
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		output, err := offloader.Publish(context.Background(), api, &sns.PublishInput{
+			TopicArn:       topic.TopicArn,
+			Message:        aws.String("More than ten bytes"),
+			MessageGroupId: aws.String("reports"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, *output.MessageId)
+	}
+
+	if ids[0] != ids[1] {
+		t.Errorf("Expected the same body to be deduplicated, got messages %v", ids)
+	}
+}
+
+func TestPublishNotOffloaded(t *testing.T) {
+	store := s3fake.New()
+	newTestStore(t, store)
+
+	api := snsfake.New()
+	topic, err := api.CreateTopic(context.Background(), &sns.CreateTopicInput{Name: aws.String("aws-docs-example-topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offloader := &Offloader{S3: store, Bucket: testBucket, Threshold: 10}
+
+	// A json message structure needs a message for each protocol, which a pointer isn't
+	_, err = offloader.Publish(context.Background(), api, &sns.PublishInput{
+		TopicArn:         topic.TopicArn,
+		Message:          aws.String(`{"default":"More than ten bytes"}`),
+		MessageStructure: aws.String("json"),
+	})
+	if !errors.Is(err, ErrJSONMessageStructure) {
+		t.Errorf("Expected ErrJSONMessageStructure, got %v", err)
+	}
+
+	// Ten message attributes leave no room for the size of the payload
+	attributes := map[string]snstypes.MessageAttributeValue{}
+	for i := 0; i < MaxMessageAttributes; i++ {
+		attributes[fmt.Sprintf("attribute%d", i)] = snstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String("value")}
+	}
+
+	_, err = offloader.Publish(context.Background(), api, &sns.PublishInput{
+		TopicArn:          topic.TopicArn,
+		Message:           aws.String("More than ten bytes"),
+		MessageAttributes: attributes,
+	})
+	if !errors.Is(err, ErrTooManyAttributes) {
+		t.Errorf("Expected ErrTooManyAttributes, got %v", err)
+	}
+
+	if n := objectCount(t, store); n != 0 || len(api.Published()) != 0 {
+		t.Errorf("Expected nothing to be stored or published, got %d objects and %d messages", n, len(api.Published()))
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	// A body sent by the Amazon SQS Extended Client Library for Java
+	body := `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"aws-docs-example-bucket","s3Key":"1d3c9e5a-6f0b-4c8e-9a57-2b1d8f3e4c6a"}]`
+
+	p, err := ParsePointer(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Bucket != "aws-docs-example-bucket" || p.Key != "1d3c9e5a-6f0b-4c8e-9a57-2b1d8f3e4c6a" {
+		t.Errorf("Got %v", p)
+	}
+
+	if p.String() != body {
+		t.Errorf("Expected %s, got %s", body, p.String())
+	}
+
+	for _, body := range []string{"", "Hello", `["Hello", "World"]`, `["software.amazon.payloadoffloading.PayloadS3Pointer",{}]`} {
+		if _, err := ParsePointer(body); !errors.Is(err, ErrNotPointer) {
+			t.Errorf("Expected ErrNotPointer for %q, got %v", body, err)
+		}
+	}
+}
+
+func TestLargeMessageLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	newTestStore(t, server.S3)
+	queueURL := newTestQueue(t, server.SQS, "doc-example-queue", nil)
+
+	client := sqs.NewFromConfig(server.Config())
+	offloader := &Offloader{S3: s3.NewFromConfig(server.Config()), Bucket: testBucket}
+
+	large := strings.Repeat("0123456789abcdef", 20000)
+
+	_, err := offloader.SendMessage(context.Background(), client, &sqs.SendMessageInput{
+		QueueUrl:    queueURL,
+		MessageBody: aws.String(large),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := offloader.ReceiveMessage(context.Background(), client, &sqs.ReceiveMessageInput{QueueUrl: queueURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.Messages) != 1 || *received.Messages[0].Body != large {
+		t.Fatalf("Expected the large message, got %d messages", len(received.Messages))
+	}
+
+	_, err = offloader.DeleteMessage(context.Background(), client, &sqs.DeleteMessageInput{
+		QueueUrl:      queueURL,
+		ReceiptHandle: received.Messages[0].ReceiptHandle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := objectCount(t, server.S3); n != 0 {
+		t.Errorf("Expected deleting the message to delete its body, got %d objects", n)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -49,9 +50,97 @@ func GetMessages(c context.Context, api SQSReceiveMessageAPI, input *sqs.Receive
 	return api.ReceiveMessage(c, input)
 }
 
+// SQSProcessGroupsAPI defines the interface for the ReceiveMessage and DeleteMessage functions.
+// We use this interface to test the function using a mocked service.
+type SQSProcessGroupsAPI interface {
+	ReceiveMessage(ctx context.Context,
+		params *sqs.ReceiveMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+
+	DeleteMessage(ctx context.Context,
+		params *sqs.DeleteMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// ProcessGroups receives messages from an Amazon SQS FIFO queue and handles them in order within each message group.
+// The groups are handled at the same time, and the messages of a group one at a time.
+// Each message is deleted once it has been handled.
+// If a message can't be handled, the rest of its group is skipped. Amazon SQS keeps the group's later messages
+// from other receivers until the failed message is received again after its visibility timeout, so the order holds.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method calls.
+//     input defines the input arguments to the ReceiveMessage call. The MessageGroupId attribute is always requested.
+//     handle is called for each message.
+// Output:
+//     The number of messages handled and deleted, and nil.
+//     Otherwise, also the first error from ReceiveMessage, DeleteMessage, or handle.
+func ProcessGroups(c context.Context, api SQSProcessGroupsAPI, input *sqs.ReceiveMessageInput, handle func(context.Context, types.Message) error) (int, error) {
+	params := *input
+	params.AttributeNames = append([]types.QueueAttributeName{"MessageGroupId"}, input.AttributeNames...)
+
+	output, err := api.ReceiveMessage(c, &params)
+	if err != nil {
+		return 0, err
+	}
+
+	// The messages of each group, in the order they were received
+	var order []string
+	groups := map[string][]types.Message{}
+
+	for _, msg := range output.Messages {
+		id := msg.Attributes["MessageGroupId"]
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+		}
+
+		groups[id] = append(groups[id], msg)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var first error
+	handled := 0
+
+	for _, id := range order {
+		wg.Add(1)
+
+		go func(id string, msgs []types.Message) {
+			defer wg.Done()
+
+			for _, msg := range msgs {
+				err := handle(c, msg)
+				if err == nil {
+					_, err = api.DeleteMessage(c, &sqs.DeleteMessageInput{
+						QueueUrl:      input.QueueUrl,
+						ReceiptHandle: msg.ReceiptHandle,
+					})
+				}
+
+				mu.Lock()
+				if err == nil {
+					handled++
+				} else if first == nil {
+					first = fmt.Errorf("message group %s: %w", id, err)
+				}
+				mu.Unlock()
+
+				if err != nil {
+					return
+				}
+			}
+		}(id, groups[id])
+	}
+
+	wg.Wait()
+
+	return handled, first
+}
+
 func main() {
 	queue := flag.String("q", "", "The name of the queue")
 	timeout := flag.Int("t", 5, "How long, in seconds, that the message is hidden from others")
+	fifo := flag.Bool("f", false, "Whether to receive up to 10 messages from a FIFO queue and print them in order by message group")
 	flag.Parse()
 
 	if *queue == "" {
@@ -88,6 +177,32 @@ func main() {
 
 	queueURL := urlResult.QueueUrl
 
+	if *fifo {
+		gMInput := &sqs.ReceiveMessageInput{
+			QueueUrl:            queueURL,
+			MaxNumberOfMessages: 10,
+			VisibilityTimeout:   int32(*timeout),
+		}
+
+		var mu sync.Mutex
+
+		n, err := ProcessGroups(context.TODO(), client, gMInput, func(c context.Context, msg types.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			fmt.Println("Group " + msg.Attributes["MessageGroupId"] + ": " + *msg.Body)
+
+			return nil
+		})
+		if err != nil {
+			fmt.Println("Got an error processing messages:")
+			fmt.Println(err)
+		}
+
+		fmt.Println("Processed", n, "messages")
+		return
+	}
+
 	gMInput := &sqs.ReceiveMessageInput{
 		MessageAttributeNames: []string{
 			string(types.QueueAttributeNameAll),
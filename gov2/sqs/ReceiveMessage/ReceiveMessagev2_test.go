@@ -8,12 +8,15 @@ import (
 	"errors"
 	"io/ioutil"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/sqsfake"
 )
 
 type SQSReceiveMessageImpl struct{}
@@ -132,3 +135,81 @@ func TestReceiveMessage(t *testing.T) {
 	t.Log("Message ID:     " + *msgResult.Messages[0].MessageId)
 	t.Log("Message Handle: " + *msgResult.Messages[0].ReceiptHandle)
 }
+
+func TestProcessGroups(t *testing.T) {
+	api := sqsfake.New()
+
+	now := time.Now()
+	api.Now = func() time.Time { return now }
+
+	created, err := api.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String("aws-docs-example-queue.fifo"),
+		Attributes: map[string]string{"FifoQueue": "true", "ContentBasedDeduplication": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"a1", "a2", "b1", "b2", "a3"} {
+		_, err := api.SendMessage(context.Background(), &sqs.SendMessageInput{
+			QueueUrl:       created.QueueUrl,
+			MessageBody:    aws.String(body),
+			MessageGroupId: aws.String(body[:1]),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	handled := map[string][]string{}
+	failure := errors.New("can't handle b1")
+	failed := false
+
+	handle := func(c context.Context, msg types.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		group := msg.Attributes["MessageGroupId"]
+		handled[group] = append(handled[group], *msg.Body)
+
+		if *msg.Body == "b1" && !failed {
+			failed = true
+			return failure
+		}
+
+		return nil
+	}
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:            created.QueueUrl,
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   30,
+	}
+
+	n, err := ProcessGroups(context.Background(), api, input, handle)
+	if n != 3 || !errors.Is(err, failure) {
+		t.Errorf("Expected 3 messages and the handler's error, got %d and %v", n, err)
+	}
+
+	// b2 is still waiting for b1
+	n, err = ProcessGroups(context.Background(), api, input, handle)
+	if n != 0 || err != nil {
+		t.Errorf("Expected no messages while b1 was in flight, got %d and %v", n, err)
+	}
+
+	now = now.Add(time.Minute)
+
+	n, err = ProcessGroups(context.Background(), api, input, handle)
+	if n != 2 || err != nil {
+		t.Errorf("Expected 2 messages after the visibility timeout, got %d and %v", n, err)
+	}
+
+	if got := strings.Join(handled["a"], ","); got != "a1,a2,a3" {
+		t.Errorf("Expected group a in order, got %v", got)
+	}
+
+	if got := strings.Join(handled["b"], ","); got != "b1,b1,b2" {
+		t.Errorf("Expected group b in order with b1 retried, got %v", got)
+	}
+}
@@ -0,0 +1,558 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[sqs.go-v2.RedriveDeadLetters]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQSRedriveAPI defines the interface for the ReceiveMessage, SendMessage, DeleteMessage, and ChangeMessageVisibility functions.
+// We use this interface to test the functions using a mocked service.
+type SQSRedriveAPI interface {
+	ReceiveMessage(ctx context.Context,
+		params *sqs.ReceiveMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+
+	SendMessage(ctx context.Context,
+		params *sqs.SendMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+
+	DeleteMessage(ctx context.Context,
+		params *sqs.DeleteMessageInput,
+		optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+
+	ChangeMessageVisibility(ctx context.Context,
+		params *sqs.ChangeMessageVisibilityInput,
+		optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// SQSListDeadLetterSourceQueuesAPI defines the interface for the ListDeadLetterSourceQueues function.
+// We use this interface to test the function using a mocked service.
+type SQSListDeadLetterSourceQueuesAPI interface {
+	ListDeadLetterSourceQueues(ctx context.Context,
+		params *sqs.ListDeadLetterSourceQueuesInput,
+		optFns ...func(*sqs.Options)) (*sqs.ListDeadLetterSourceQueuesOutput, error)
+}
+
+// DeadLetter is a message received from a dead-letter queue.
+type DeadLetter struct {
+	Message types.Message
+	// ReceiveCount is the ApproximateReceiveCount of the message, including the receive that scanned it.
+	ReceiveCount int
+	// FirstSeen is when the message was first received, from its ApproximateFirstReceiveTimestamp.
+	FirstSeen time.Time
+	// Sent is when the message was first sent, to the source queue.
+	Sent time.Time
+}
+
+// newDeadLetter reads the system attributes of a received message.
+func newDeadLetter(msg types.Message) DeadLetter {
+	letter := DeadLetter{Message: msg}
+	letter.ReceiveCount, _ = strconv.Atoi(msg.Attributes["ApproximateReceiveCount"])
+	letter.FirstSeen = millisecondsToTime(msg.Attributes["ApproximateFirstReceiveTimestamp"])
+	letter.Sent = millisecondsToTime(msg.Attributes["SentTimestamp"])
+
+	return letter
+}
+
+// millisecondsToTime converts a timestamp attribute, in milliseconds since the epoch, to a time.
+func millisecondsToTime(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Filter selects the dead letters to redrive. The zero Filter selects every message.
+type Filter struct {
+	// Attributes maps attribute names to the value a message must have.
+	// A name can be a message attribute with a string or number value,
+	// or a system attribute such as SenderId.
+	Attributes map[string]string
+	// Body, if not nil, must match the message body.
+	Body *regexp.Regexp
+}
+
+// Match reports whether the message passes the filter.
+func (f Filter) Match(msg types.Message) bool {
+	for name, want := range f.Attributes {
+		if v, ok := msg.MessageAttributes[name]; ok {
+			if aws.ToString(v.StringValue) != want {
+				return false
+			}
+
+			continue
+		}
+
+		if v, ok := msg.Attributes[name]; !ok || v != want {
+			return false
+		}
+	}
+
+	return f.Body == nil || f.Body.MatchString(aws.ToString(msg.Body))
+}
+
+// ScanOptions configures Scan. Zero values select the defaults.
+type ScanOptions struct {
+	// VisibilityTimeout is how long, in seconds, the matching messages stay hidden
+	// so that they can be redriven. The default is 300.
+	VisibilityTimeout int32
+	// WaitTimeSeconds is how long each receive waits for messages. Scan stops when a receive
+	// returns none. The default is 1.
+	WaitTimeSeconds int32
+	// MaxMessages is the most matching messages to return. The default is no limit.
+	MaxMessages int
+}
+
+// Scan receives the messages in a dead-letter queue and returns the ones that match the filter.
+// Each receive increases the ApproximateReceiveCount of a message.
+// Messages that don't match are made visible again before Scan returns.
+// The matching messages stay hidden until they are redriven, released, or their visibility timeout expires.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method calls.
+//     dlqURL is the URL of the dead-letter queue.
+//     filter selects the messages.
+//     opts configures the scan.
+// Output:
+//     If success, the matching messages and nil.
+//     Otherwise, nil and an error from a call to ReceiveMessage. Every received message is released.
+func Scan(c context.Context, api SQSRedriveAPI, dlqURL *string, filter Filter, opts ScanOptions) ([]DeadLetter, error) {
+	if opts.VisibilityTimeout == 0 {
+		opts.VisibilityTimeout = 300
+	}
+
+	if opts.WaitTimeSeconds == 0 {
+		opts.WaitTimeSeconds = 1
+	}
+
+	var matched, others []DeadLetter
+
+	// Where each message ID is in matched or others, in case its visibility timeout expires during the scan
+	seen := map[string]*DeadLetter{}
+
+	for opts.MaxMessages == 0 || len(matched) < opts.MaxMessages {
+		output, err := api.ReceiveMessage(c, &sqs.ReceiveMessageInput{
+			QueueUrl:              dlqURL,
+			AttributeNames:        []types.QueueAttributeName{types.QueueAttributeNameAll},
+			MessageAttributeNames: []string{"All"},
+			MaxNumberOfMessages:   10,
+			VisibilityTimeout:     opts.VisibilityTimeout,
+			WaitTimeSeconds:       opts.WaitTimeSeconds,
+		})
+		if err != nil {
+			Release(c, api, dlqURL, append(matched, others...))
+			return nil, err
+		}
+
+		if len(output.Messages) == 0 {
+			break
+		}
+
+		for _, msg := range output.Messages {
+			if letter, ok := seen[aws.ToString(msg.MessageId)]; ok {
+				*letter = newDeadLetter(msg)
+				continue
+			}
+
+			if filter.Match(msg) && (opts.MaxMessages == 0 || len(matched) < opts.MaxMessages) {
+				matched = append(matched, newDeadLetter(msg))
+			} else {
+				others = append(others, newDeadLetter(msg))
+			}
+		}
+
+		// The slices may have moved, so index them again
+		for i := range matched {
+			seen[aws.ToString(matched[i].Message.MessageId)] = &matched[i]
+		}
+
+		for i := range others {
+			seen[aws.ToString(others[i].Message.MessageId)] = &others[i]
+		}
+	}
+
+	Release(c, api, dlqURL, others)
+
+	return matched, nil
+}
+
+// Release makes dead letters visible again in the dead-letter queue.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     dlqURL is the URL of the dead-letter queue.
+//     letters are the messages to release.
+// Output:
+//     If success, nil.
+//     Otherwise, the first error from a call to ChangeMessageVisibility. The other messages are still released.
+func Release(c context.Context, api SQSRedriveAPI, dlqURL *string, letters []DeadLetter) error {
+	var first error
+	for _, l := range letters {
+		_, err := api.ChangeMessageVisibility(c, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          dlqURL,
+			ReceiptHandle:     l.Message.ReceiptHandle,
+			VisibilityTimeout: 0,
+		})
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// SummaryGroup counts the dead letters with the same receive count that were first seen in the same period.
+type SummaryGroup struct {
+	ReceiveCount int
+	// FirstSeen is the start of the period.
+	FirstSeen time.Time
+	Count     int
+}
+
+// Summarize groups dead letters by receive count and by the period, of length bucket, in which they were first seen.
+// The groups are sorted by period, then by receive count.
+func Summarize(letters []DeadLetter, bucket time.Duration) []SummaryGroup {
+	type key struct {
+		receiveCount int
+		firstSeen    time.Time
+	}
+
+	counts := map[key]int{}
+	for _, l := range letters {
+		counts[key{l.ReceiveCount, l.FirstSeen.Truncate(bucket)}]++
+	}
+
+	groups := make([]SummaryGroup, 0, len(counts))
+	for k, n := range counts {
+		groups = append(groups, SummaryGroup{ReceiveCount: k.receiveCount, FirstSeen: k.firstSeen, Count: n})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].FirstSeen.Equal(groups[j].FirstSeen) {
+			return groups[i].FirstSeen.Before(groups[j].FirstSeen)
+		}
+
+		return groups[i].ReceiveCount < groups[j].ReceiveCount
+	})
+
+	return groups
+}
+
+// WriteSummary writes the groups as a table.
+func WriteSummary(w io.Writer, groups []SummaryGroup) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIRST SEEN\tRECEIVE COUNT\tMESSAGES")
+
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", g.FirstSeen.UTC().Format(time.RFC3339), g.ReceiveCount, g.Count)
+	}
+
+	return tw.Flush()
+}
+
+// WriteListing writes one line for each dead letter, with the start of its body.
+func WriteListing(w io.Writer, letters []DeadLetter) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MESSAGE ID\tRECEIVE COUNT\tFIRST SEEN\tSENT\tBODY")
+
+	for _, l := range letters {
+		body := strings.Join(strings.Fields(aws.ToString(l.Message.Body)), " ")
+		if len(body) > 60 {
+			body = body[:57] + "..."
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", aws.ToString(l.Message.MessageId), l.ReceiveCount,
+			l.FirstSeen.UTC().Format(time.RFC3339), l.Sent.UTC().Format(time.RFC3339), body)
+	}
+
+	return tw.Flush()
+}
+
+// RedriveOptions configures Redrive.
+type RedriveOptions struct {
+	// Rate is the most messages to send each second. Zero means no limit.
+	Rate float64
+}
+
+// RedriveResult is the outcome of redriving one dead letter.
+type RedriveResult struct {
+	// MessageID is the ID of the message in the dead-letter queue.
+	MessageID string
+	// NewMessageID is the ID of the message sent to the target queue, if it was sent.
+	NewMessageID string
+	// Err is nil if the message was sent and deleted from the dead-letter queue.
+	Err error
+}
+
+// ErrNotDeleted wraps the error for a message that was sent to the target queue
+// but could not be deleted from the dead-letter queue, so it is now in both.
+var ErrNotDeleted = errors.New("sent, but not deleted from the dead-letter queue")
+
+// Redrive sends dead letters, with their message attributes, to a target queue,
+// and deletes each one from the dead-letter queue once it has been sent.
+// A message that can't be sent is released back into the dead-letter queue.
+// If the context is canceled, the remaining messages stay hidden until their visibility timeout expires.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method calls.
+//     dlqURL is the URL of the dead-letter queue.
+//     targetURL is the URL of the queue to send the messages to, usually the source queue.
+//     letters are the messages returned by Scan.
+//     opts configures the rate limit.
+// Output:
+//     A RedriveResult for each message, in the order of letters.
+func Redrive(c context.Context, api SQSRedriveAPI, dlqURL, targetURL *string, letters []DeadLetter, opts RedriveOptions) []RedriveResult {
+	results := make([]RedriveResult, len(letters))
+
+	var tick <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for i, l := range letters {
+		results[i].MessageID = aws.ToString(l.Message.MessageId)
+
+		if c.Err() != nil {
+			results[i].Err = c.Err()
+			continue
+		}
+
+		if tick != nil && i > 0 {
+			select {
+			case <-c.Done():
+				results[i].Err = c.Err()
+				continue
+			case <-tick:
+			}
+		}
+
+		input := &sqs.SendMessageInput{
+			QueueUrl:          targetURL,
+			MessageBody:       l.Message.Body,
+			MessageAttributes: l.Message.MessageAttributes,
+		}
+
+		// Keep a FIFO message in its group. Its ID in the dead-letter queue is a deduplication ID
+		// that stops a second redrive from sending it again, but not a message with the same body.
+		if group := l.Message.Attributes["MessageGroupId"]; group != "" {
+			input.MessageGroupId = aws.String(group)
+			input.MessageDeduplicationId = l.Message.MessageId
+		}
+
+		sent, err := api.SendMessage(c, input)
+		if err != nil {
+			results[i].Err = err
+			Release(c, api, dlqURL, letters[i:i+1])
+			continue
+		}
+
+		results[i].NewMessageID = aws.ToString(sent.MessageId)
+
+		_, err = api.DeleteMessage(c, &sqs.DeleteMessageInput{
+			QueueUrl:      dlqURL,
+			ReceiptHandle: l.Message.ReceiptHandle,
+		})
+		if err != nil {
+			results[i].Err = fmt.Errorf("%w: %v", ErrNotDeleted, err)
+		}
+	}
+
+	return results
+}
+
+// FindSourceQueue returns the URL of the queue whose RedrivePolicy sends messages to a dead-letter queue.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     dlqURL is the URL of the dead-letter queue.
+// Output:
+//     If success, the URL of the source queue and nil.
+//     Otherwise, nil and an error from the call to ListDeadLetterSourceQueues,
+//     or an error if there is not exactly one source queue.
+func FindSourceQueue(c context.Context, api SQSListDeadLetterSourceQueuesAPI, dlqURL *string) (*string, error) {
+	var urls []string
+
+	input := &sqs.ListDeadLetterSourceQueuesInput{QueueUrl: dlqURL}
+	for {
+		output, err := api.ListDeadLetterSourceQueues(c, input)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, output.QueueUrls...)
+
+		if output.NextToken == nil {
+			break
+		}
+
+		input.NextToken = output.NextToken
+	}
+
+	switch len(urls) {
+	case 0:
+		return nil, errors.New("no queue uses " + *dlqURL + " as its dead-letter queue")
+	case 1:
+		return &urls[0], nil
+	}
+
+	return nil, errors.New("more than one queue uses " + *dlqURL + " as its dead-letter queue: " + strings.Join(urls, ", "))
+}
+
+// attributeFlags collects -a NAME=VALUE flags.
+type attributeFlags map[string]string
+
+func (a attributeFlags) String() string {
+	var pairs []string
+	for k, v := range a {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (a attributeFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("attribute filters look like NAME=VALUE")
+	}
+
+	a[parts[0]] = parts[1]
+
+	return nil
+}
+
+func main() {
+	attributes := attributeFlags{}
+
+	dlQueue := flag.String("d", "", "The name of the dead-letter queue")
+	target := flag.String("t", "", "The name of the queue to redrive messages to. The default is the dead-letter queue's source queue")
+	flag.Var(attributes, "a", "Only redrive messages with the attribute NAME=VALUE. Can be repeated")
+	body := flag.String("b", "", "Only redrive messages whose body matches this regular expression")
+	max := flag.Int("m", 0, "The most messages to redrive. The default is all of them")
+	rate := flag.Float64("r", 10, "The most messages to send each second")
+	bucket := flag.Duration("g", time.Hour, "The period by which to group messages in the summary")
+	dryRun := flag.Bool("dry-run", false, "List the matching messages without moving them")
+	flag.Parse()
+
+	if *dlQueue == "" {
+		fmt.Println("You must supply the name of the dead-letter queue (-d DLQUEUE)")
+		return
+	}
+
+	filter := Filter{Attributes: attributes}
+	if *body != "" {
+		re, err := regexp.Compile(*body)
+		if err != nil {
+			fmt.Println("Got an error parsing the body expression:")
+			fmt.Println(err)
+			return
+		}
+
+		filter.Body = re
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := sqs.NewFromConfig(cfg)
+
+	result, err := client.GetQueueUrl(context.TODO(), &sqs.GetQueueUrlInput{
+		QueueName: dlQueue,
+	})
+	if err != nil {
+		fmt.Println("Got an error getting the dead-letter queue URL:")
+		fmt.Println(err)
+		return
+	}
+
+	dlqURL := result.QueueUrl
+
+	// Find the target before hiding any messages
+	var targetURL *string
+	if !*dryRun {
+		if *target != "" {
+			result, err := client.GetQueueUrl(context.TODO(), &sqs.GetQueueUrlInput{
+				QueueName: target,
+			})
+			if err != nil {
+				fmt.Println("Got an error getting the target queue URL:")
+				fmt.Println(err)
+				return
+			}
+
+			targetURL = result.QueueUrl
+		} else {
+			targetURL, err = FindSourceQueue(context.TODO(), client, dlqURL)
+			if err != nil {
+				fmt.Println("Got an error finding the source queue:")
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+
+	letters, err := Scan(context.TODO(), client, dlqURL, filter, ScanOptions{MaxMessages: *max})
+	if err != nil {
+		fmt.Println("Got an error reading the dead-letter queue:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(len(letters), "matching messages")
+	WriteSummary(os.Stdout, Summarize(letters, *bucket))
+
+	if *dryRun {
+		fmt.Println()
+		WriteListing(os.Stdout, letters)
+
+		err = Release(context.TODO(), client, dlqURL, letters)
+		if err != nil {
+			fmt.Println("Got an error releasing the messages:")
+			fmt.Println(err)
+		}
+
+		return
+	}
+
+	results := Redrive(context.TODO(), client, dlqURL, targetURL, letters, RedriveOptions{Rate: *rate})
+
+	moved := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Println("Message", r.MessageID, "failed:", r.Err)
+			continue
+		}
+
+		moved++
+	}
+
+	fmt.Println("Moved", moved, "of", len(results), "messages to", *targetURL)
+}
+
+// snippet-end:[sqs.go-v2.RedriveDeadLetters]
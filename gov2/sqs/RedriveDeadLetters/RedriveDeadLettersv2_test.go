@@ -0,0 +1,417 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/sqsfake"
+)
+
+// clock is a time source for the fake that only moves when told to
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+type testQueues struct {
+	api    *sqsfake.Service
+	clock  *clock
+	source *string
+	dlq    *string
+}
+
+// newTestQueues creates a source queue that moves messages to its dead-letter queue after one receive.
+func newTestQueues(t *testing.T) *testQueues {
+	tq := &testQueues{
+		api:   sqsfake.New(),
+		clock: &clock{now: time.Date(2020, 12, 1, 9, 15, 0, 0, time.UTC)},
+	}
+	tq.api.Now = tq.clock.Now
+
+	dlq, err := tq.api.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String("aws-docs-example-dlq")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := tq.api.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName: aws.String("aws-docs-example-queue"),
+		Attributes: map[string]string{
+			"VisibilityTimeout": "1",
+			"RedrivePolicy":     `{"deadLetterTargetArn":"` + tq.api.QueueARN("aws-docs-example-dlq") + `","maxReceiveCount":"1"}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tq.source = source.QueueUrl
+	tq.dlq = dlq.QueueUrl
+
+	return tq
+}
+
+// fail sends messages with the given kind attribute, and receives them once so that they end up in the dead-letter queue
+func (tq *testQueues) fail(t *testing.T, kind string, bodies ...string) {
+	for _, body := range bodies {
+		_, err := tq.api.SendMessage(context.Background(), &sqs.SendMessageInput{
+			QueueUrl:    tq.source,
+			MessageBody: aws.String(body),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"Kind": {DataType: aws.String("String"), StringValue: aws.String(kind)},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tq.receiveAll(t, tq.source)
+	tq.clock.Advance(2 * time.Second)
+
+	if n := len(tq.receiveAll(t, tq.source)); n != 0 {
+		t.Fatalf("%d messages stayed in the source queue", n)
+	}
+}
+
+func (tq *testQueues) receiveAll(t *testing.T, queueURL *string) []types.Message {
+	var messages []types.Message
+	for {
+		output, err := tq.api.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:              queueURL,
+			MaxNumberOfMessages:   10,
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(output.Messages) == 0 {
+			return messages
+		}
+
+		messages = append(messages, output.Messages...)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	msg := types.Message{
+		Body:       aws.String(`{"orderId": 1234, "error": "timeout"}`),
+		Attributes: map[string]string{"SenderId": "AIDAEXAMPLE"},
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"Kind": {DataType: aws.String("String"), StringValue: aws.String("order")},
+		},
+	}
+
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{Attributes: map[string]string{"Kind": "order"}}, true},
+		{Filter{Attributes: map[string]string{"Kind": "refund"}}, false},
+		{Filter{Attributes: map[string]string{"SenderId": "AIDAEXAMPLE"}}, true},
+		{Filter{Attributes: map[string]string{"Tenant": "a"}}, false},
+		{Filter{Body: regexp.MustCompile(`"error": "timeout"`)}, true},
+		{Filter{Attributes: map[string]string{"Kind": "order"}, Body: regexp.MustCompile(`throttl`)}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Match(msg); got != test.want {
+			t.Errorf("%+v: got %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tq := newTestQueues(t)
+
+	tq.fail(t, "order", "order 1", "order 2", "order 3")
+	tq.clock.Advance(2 * time.Hour)
+	tq.fail(t, "order", "order 4")
+	tq.fail(t, "refund", "refund 1", "refund 2")
+
+	letters, err := Scan(context.Background(), tq.api, tq.dlq, Filter{Attributes: map[string]string{"Kind": "order"}}, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(letters) != 4 {
+		t.Fatalf("got %d dead letters, want 4", len(letters))
+	}
+
+	for _, l := range letters {
+		if !strings.HasPrefix(*l.Message.Body, "order") || l.ReceiveCount != 2 || l.Sent.IsZero() {
+			t.Errorf("got %+v, want an order received twice", l)
+		}
+	}
+
+	groups := Summarize(letters, time.Hour)
+	want := []SummaryGroup{
+		{ReceiveCount: 2, FirstSeen: time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC), Count: 3},
+		{ReceiveCount: 2, FirstSeen: time.Date(2020, 12, 1, 11, 0, 0, 0, time.UTC), Count: 1},
+	}
+
+	if len(groups) != len(want) {
+		t.Fatalf("got groups %+v, want %+v", groups, want)
+	}
+
+	for i := range want {
+		if groups[i].ReceiveCount != want[i].ReceiveCount || !groups[i].FirstSeen.Equal(want[i].FirstSeen) || groups[i].Count != want[i].Count {
+			t.Errorf("group %d: got %+v, want %+v", i, groups[i], want[i])
+		}
+	}
+
+	var b bytes.Buffer
+	if err := WriteSummary(&b, groups); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), "2020-12-01T09:00:00Z  2              3") {
+		t.Errorf("got summary\n%s", b.String())
+	}
+
+	// The refunds were released, and the orders are still hidden
+	if n := len(tq.receiveAll(t, tq.dlq)); n != 2 {
+		t.Errorf("got %d visible dead letters, want the 2 refunds", n)
+	}
+
+	if err := Release(context.Background(), tq.api, tq.dlq, letters); err != nil {
+		t.Fatal(err)
+	}
+
+	tq.clock.Advance(time.Hour)
+
+	if n := len(tq.receiveAll(t, tq.dlq)); n != 6 {
+		t.Errorf("got %d dead letters after releasing them, want 6", n)
+	}
+}
+
+func TestScanMaxMessages(t *testing.T) {
+	tq := newTestQueues(t)
+	tq.fail(t, "order", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12")
+
+	letters, err := Scan(context.Background(), tq.api, tq.dlq, Filter{}, ScanOptions{MaxMessages: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(letters) != 5 {
+		t.Errorf("got %d dead letters, want 5", len(letters))
+	}
+
+	if n := len(tq.receiveAll(t, tq.dlq)); n != 7 {
+		t.Errorf("got %d visible dead letters, want 7", n)
+	}
+}
+
+// SQSRedriveImpl fails to send the messages with a given body
+type SQSRedriveImpl struct {
+	*sqsfake.Service
+	failBody string
+}
+
+func (dt *SQSRedriveImpl) SendMessage(ctx context.Context,
+	params *sqs.SendMessageInput,
+	optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+
+	if *params.MessageBody == dt.failBody {
+		return nil, errors.New("can't send the message")
+	}
+
+	return dt.Service.SendMessage(ctx, params, optFns...)
+}
+
+func TestRedrive(t *testing.T) {
+	tq := newTestQueues(t)
+	tq.fail(t, "order", "order 1", "order 2", "order 3", "order 4", "order 5")
+
+	api := &SQSRedriveImpl{Service: tq.api, failBody: "order 3"}
+
+	letters, err := Scan(context.Background(), api, tq.dlq, Filter{}, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	results := Redrive(context.Background(), api, tq.dlq, tq.source, letters, RedriveOptions{Rate: 20})
+
+	// Five messages at 20 a second are four intervals of 50 milliseconds apart
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("redrove 5 messages in %v, want at least 200ms", elapsed)
+	}
+
+	failed := 0
+	for i, r := range results {
+		if r.MessageID != *letters[i].Message.MessageId {
+			t.Errorf("result %d is for message %s, want %s", i, r.MessageID, *letters[i].Message.MessageId)
+		}
+
+		if r.Err != nil {
+			failed++
+			continue
+		}
+
+		if r.NewMessageID == "" {
+			t.Errorf("result %d has no new message ID", i)
+		}
+	}
+
+	if failed != 1 {
+		t.Errorf("got %d failures, want 1", failed)
+	}
+
+	redriven := tq.receiveAll(t, tq.source)
+	if len(redriven) != 4 {
+		t.Fatalf("got %d messages in the source queue, want 4", len(redriven))
+	}
+
+	for _, msg := range redriven {
+		if v := msg.MessageAttributes["Kind"]; aws.ToString(v.StringValue) != "order" {
+			t.Errorf("got attributes %v, want the original Kind", msg.MessageAttributes)
+		}
+	}
+
+	// Only the message that couldn't be sent is left, and it was released
+	left := tq.receiveAll(t, tq.dlq)
+	if len(left) != 1 || *left[0].Body != "order 3" {
+		t.Errorf("got %v in the dead-letter queue, want order 3", left)
+	}
+}
+
+func TestRedriveCanceled(t *testing.T) {
+	tq := newTestQueues(t)
+	tq.fail(t, "order", "order 1", "order 2")
+
+	letters, err := Scan(context.Background(), tq.api, tq.dlq, Filter{}, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, r := range Redrive(ctx, tq.api, tq.dlq, tq.source, letters, RedriveOptions{}) {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", r.Err)
+		}
+	}
+
+	if n := len(tq.receiveAll(t, tq.source)); n != 0 {
+		t.Errorf("got %d messages in the source queue, want 0", n)
+	}
+}
+
+func TestFindSourceQueue(t *testing.T) {
+	tq := newTestQueues(t)
+
+	source, err := FindSourceQueue(context.Background(), tq.api, tq.dlq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *source != *tq.source {
+		t.Errorf("got %s, want %s", *source, *tq.source)
+	}
+
+	_, err = FindSourceQueue(context.Background(), tq.api, tq.source)
+	if err == nil {
+		t.Error("got no error for a queue that isn't a dead-letter queue")
+	}
+}
+
+func TestRedriveFifo(t *testing.T) {
+	api := sqsfake.New()
+
+	dlq, err := api.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String("aws-docs-example-dlq.fifo"),
+		Attributes: map[string]string{"FifoQueue": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := api.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName: aws.String("aws-docs-example-queue.fifo"),
+		Attributes: map[string]string{
+			"FifoQueue":         "true",
+			"VisibilityTimeout": "0",
+			"RedrivePolicy":     `{"deadLetterTargetArn":"` + api.QueueARN("aws-docs-example-dlq.fifo") + `","maxReceiveCount":"1"}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"first", "second"} {
+		_, err := api.SendMessage(context.Background(), &sqs.SendMessageInput{
+			QueueUrl:               source.QueueUrl,
+			MessageBody:            aws.String(body),
+			MessageGroupId:         aws.String("orders"),
+			MessageDeduplicationId: aws.String(body),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Receive each message once, so the next receive moves them to the dead-letter queue
+	for i := 0; i < 3; i++ {
+		_, err := api.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{QueueUrl: source.QueueUrl, MaxNumberOfMessages: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	letters, err := Scan(context.Background(), api, dlq.QueueUrl, Filter{}, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(letters) != 2 {
+		t.Fatalf("got %d dead letters, want 2", len(letters))
+	}
+
+	for _, r := range Redrive(context.Background(), api, dlq.QueueUrl, source.QueueUrl, letters, RedriveOptions{}) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+
+	output, err := api.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:            source.QueueUrl,
+		MaxNumberOfMessages: 10,
+		AttributeNames:      []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Messages) != 2 || *output.Messages[0].Body != "first" || output.Messages[1].Attributes["MessageGroupId"] != "orders" {
+		t.Errorf("got %v, want both messages back in order", output.Messages)
+	}
+}
@@ -5,6 +5,8 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
 
@@ -50,8 +52,24 @@ func SendMsg(c context.Context, api SQSSendMessageAPI, input *sqs.SendMessageInp
 	return api.SendMessage(c, input)
 }
 
+// ContentDeduplicationID returns a message deduplication ID for a FIFO queue: the SHA-256 hash of the message body.
+// Amazon SQS drops a message whose deduplication ID matches one sent in the last five minutes,
+// so resending the same body within that interval has no effect.
+// Unlike the ContentBasedDeduplication queue attribute, this works for any FIFO queue.
+// Inputs:
+//     body is the message body.
+// Output:
+//     The hex-encoded hash, which is 64 characters long.
+func ContentDeduplicationID(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
 func main() {
 	queue := flag.String("q", "", "The name of the queue")
+	group := flag.String("g", "", "The message group ID, for a FIFO queue")
+	dedupID := flag.String("d", "", "The message deduplication ID, for a FIFO queue")
+	hashBody := flag.Bool("dedup", false, "Whether to use the hash of the body as the message deduplication ID, for a FIFO queue")
 	flag.Parse()
 
 	if *queue == "" {
@@ -59,6 +77,16 @@ func main() {
 		return
 	}
 
+	if *dedupID != "" && *hashBody {
+		fmt.Println("You can supply a message deduplication ID (-d DEDUP-ID) or hash the body (-dedup), but not both")
+		return
+	}
+
+	if (*dedupID != "" || *hashBody) && *group == "" {
+		fmt.Println("You must supply a message group ID (-g GROUP) to deduplicate messages")
+		return
+	}
+
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		panic("configuration error, " + err.Error())
@@ -100,6 +128,18 @@ func main() {
 		QueueUrl:    queueURL,
 	}
 
+	// FIFO queues need a message group ID, and only support delays for the whole queue
+	if *group != "" {
+		sMInput.DelaySeconds = 0
+		sMInput.MessageGroupId = group
+
+		if *dedupID != "" {
+			sMInput.MessageDeduplicationId = dedupID
+		} else if *hashBody {
+			sMInput.MessageDeduplicationId = aws.String(ContentDeduplicationID(*sMInput.MessageBody))
+		}
+	}
+
 	resp, err := SendMsg(context.TODO(), client, sMInput)
 	if err != nil {
 		fmt.Println("Got an error sending the message:")
@@ -108,6 +148,10 @@ func main() {
 	}
 
 	fmt.Println("Sent message with ID: " + *resp.MessageId)
+
+	if resp.SequenceNumber != nil {
+		fmt.Println("Sequence number:      " + *resp.SequenceNumber)
+	}
 }
 
 // snippet-end:[sqs.go-v2.SendMessage]
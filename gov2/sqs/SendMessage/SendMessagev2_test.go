@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
 )
 
 type SQSSendMessageImpl struct{}
@@ -128,3 +129,128 @@ func TestSendMessage(t *testing.T) {
 
 	t.Log("Sent message with ID: " + *resp.MessageId)
 }
+
+func TestSendMsgLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	_, err := server.SQS.CreateQueue(context.Background(), &sqs.CreateQueueInput{QueueName: aws.String("doc-example-queue")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := sqs.NewFromConfig(server.Config())
+
+	result, err := GetQueueURL(context.Background(), client, &sqs.GetQueueUrlInput{QueueName: aws.String("doc-example-queue")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &sqs.SendMessageInput{
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"Title": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("The Whistler"),
+			},
+			"WeeksOn": {
+				DataType:    aws.String("Number"),
+				StringValue: aws.String("6"),
+			},
+		},
+		MessageBody: aws.String("Information about the NY Times fiction bestseller for the week of 12/11/2016."),
+		QueueUrl:    result.QueueUrl,
+	}
+
+	resp, err := SendMsg(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := server.SQS.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:              result.QueueUrl,
+		MessageAttributeNames: []string{"All"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.Messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(received.Messages))
+	}
+
+	msg := received.Messages[0]
+	if *msg.MessageId != *resp.MessageId || *msg.Body != *input.MessageBody {
+		t.Errorf("Expected message %v, got %v", *resp.MessageId, *msg.MessageId)
+	}
+
+	if *msg.MessageAttributes["WeeksOn"].StringValue != "6" {
+		t.Errorf("Expected WeeksOn 6, got %v", msg.MessageAttributes)
+	}
+}
+
+func TestSendFifoMsgLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	created, err := server.SQS.CreateQueue(context.Background(), &sqs.CreateQueueInput{
+		QueueName:  aws.String("doc-example-queue.fifo"),
+		Attributes: map[string]string{"FifoQueue": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := sqs.NewFromConfig(server.Config())
+
+	body := "Information about the NY Times fiction bestseller for the week of 12/11/2016."
+
+	input := &sqs.SendMessageInput{
+		MessageBody:            aws.String(body),
+		MessageGroupId:         aws.String("bestsellers"),
+		MessageDeduplicationId: aws.String(ContentDeduplicationID(body)),
+		QueueUrl:               created.QueueUrl,
+	}
+
+	first, err := SendMsg(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.SequenceNumber == nil {
+		t.Error("Expected a sequence number for a FIFO queue message")
+	}
+
+	// Sending the same body again is a duplicate
+	second, err := SendMsg(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *second.MessageId != *first.MessageId {
+		t.Errorf("Expected the duplicate to have ID %v, got %v", *first.MessageId, *second.MessageId)
+	}
+
+	received, err := server.SQS.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:            created.QueueUrl,
+		MaxNumberOfMessages: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received.Messages) != 1 {
+		t.Errorf("Expected 1 message, got %d", len(received.Messages))
+	}
+
+	// Without a message group ID, the message is rejected
+	input.MessageGroupId = nil
+
+	_, err = SendMsg(context.Background(), client, input)
+	if err == nil {
+		t.Error("Expected an error sending to a FIFO queue without a message group ID")
+	}
+
+	if id := ContentDeduplicationID(body); len(id) != 64 || id == ContentDeduplicationID(body+" ") {
+		t.Errorf("Expected a 64-character hash of the body, got %v", id)
+	}
+}
@@ -36,11 +36,12 @@ func FindParameter(c context.Context, api SSMGetParameterAPI, input *ssm.GetPara
 
 func main() {
 	parameterName := flag.String("n", "", "The name of the parameter")
+	decrypt := flag.Bool("d", false, "Whether to decrypt the value of a SecureString parameter")
 	flag.Parse()
 
 	if *parameterName == "" {
 		fmt.Println("You must supply the name of the parameter")
-		fmt.Println("-n NAME")
+		fmt.Println("-n NAME [-d]")
 		return
 	}
 
@@ -52,7 +53,8 @@ func main() {
 	client := ssm.NewFromConfig(cfg)
 
 	input := &ssm.GetParameterInput{
-		Name: parameterName,
+		Name:           parameterName,
+		WithDecryption: *decrypt,
 	}
 
 	results, err := FindParameter(context.TODO(), client, input)
@@ -0,0 +1,95 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[ssm.go-v2.GetParametersByPath]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// SSMGetParametersByPathAPI defines the interface for the GetParametersByPath function.
+// We use this interface to test the function using a mocked service.
+type SSMGetParametersByPathAPI interface {
+	GetParametersByPath(ctx context.Context,
+		params *ssm.GetParametersByPathInput,
+		optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+}
+
+// FindParametersByPath retrieves the AWS Systems Manager parameters in a hierarchy,
+// calling GetParametersByPath until there are no more pages.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+//     Set Recursive to include the parameters of every level below the path,
+//     and WithDecryption to get the values of SecureString parameters.
+// Output:
+//     If success, the parameters and nil.
+//     Otherwise, nil and an error from a call to GetParametersByPath.
+func FindParametersByPath(c context.Context, api SSMGetParametersByPathAPI, input *ssm.GetParametersByPathInput) ([]types.Parameter, error) {
+	var parameters []types.Parameter
+
+	// Don't change the caller's input
+	page := *input
+	for {
+		output, err := api.GetParametersByPath(c, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		parameters = append(parameters, output.Parameters...)
+
+		if output.NextToken == nil {
+			break
+		}
+
+		page.NextToken = output.NextToken
+	}
+
+	return parameters, nil
+}
+
+func main() {
+	path := flag.String("p", "", "The path of the parameters, such as /app/dev")
+	recursive := flag.Bool("r", false, "Whether to include the parameters of every level below the path")
+	decrypt := flag.Bool("d", false, "Whether to display the values of SecureString parameters")
+	flag.Parse()
+
+	if *path == "" {
+		fmt.Println("You must supply the path of the parameters")
+		fmt.Println("-p PATH [-r] [-d]")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := ssm.NewFromConfig(cfg)
+
+	input := &ssm.GetParametersByPathInput{
+		Path:           path,
+		Recursive:      *recursive,
+		WithDecryption: *decrypt,
+	}
+
+	results, err := FindParametersByPath(context.TODO(), client, input)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	for _, p := range results {
+		fmt.Printf("%s (%s): %s\n", aws.ToString(p.Name), p.Type, aws.ToString(p.Value))
+	}
+}
+
+// snippet-end:[ssm.go-v2.GetParametersByPath]
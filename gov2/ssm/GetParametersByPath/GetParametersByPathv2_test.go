@@ -0,0 +1,100 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ssmfake"
+)
+
+type SSMPutParameterAPI interface {
+	PutParameter(ctx context.Context,
+		params *ssm.PutParameterInput,
+		optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// putTree creates a String parameter for each of 25 features, and a SecureString and a StringList parameter
+func putTree(t *testing.T, api SSMPutParameterAPI) {
+	inputs := []*ssm.PutParameterInput{
+		{Name: aws.String("/doc-example/dev/db/password"), Value: aws.String("hunter2"), Type: types.ParameterTypeSecureString},
+		{Name: aws.String("/doc-example/dev/hosts"), Value: aws.String("web-1,web-2"), Type: types.ParameterTypeStringList},
+	}
+
+	for i := 0; i < 25; i++ {
+		inputs = append(inputs, &ssm.PutParameterInput{
+			Name:  aws.String(fmt.Sprintf("/doc-example/dev/features/feature-%02d", i)),
+			Value: aws.String("on"),
+			Type:  types.ParameterTypeString,
+		})
+	}
+
+	for _, input := range inputs {
+		_, err := api.PutParameter(context.Background(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkTree(t *testing.T, api SSMGetParametersByPathAPI) {
+	input := &ssm.GetParametersByPathInput{Path: aws.String("/doc-example/dev")}
+
+	parameters, err := FindParametersByPath(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parameters) != 1 || aws.ToString(parameters[0].Value) != "web-1,web-2" {
+		t.Errorf("got %v, want only the hosts parameter", parameters)
+	}
+
+	input.Recursive = true
+
+	parameters, err = FindParametersByPath(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parameters) != 27 || input.NextToken != nil {
+		t.Fatalf("got %d parameters, want 27", len(parameters))
+	}
+
+	if aws.ToString(parameters[0].Value) == "hunter2" {
+		t.Error("got the plaintext of a SecureString without WithDecryption")
+	}
+
+	input.WithDecryption = true
+
+	parameters, err = FindParametersByPath(context.Background(), api, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aws.ToString(parameters[0].Name) != "/doc-example/dev/db/password" || aws.ToString(parameters[0].Value) != "hunter2" {
+		t.Errorf("got %s = %s, want the decrypted password", aws.ToString(parameters[0].Name), aws.ToString(parameters[0].Value))
+	}
+}
+
+func TestFindParametersByPath(t *testing.T) {
+	api := ssmfake.New()
+
+	putTree(t, api)
+	checkTree(t, api)
+}
+
+func TestFindParametersByPathLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	client := ssm.NewFromConfig(server.Config())
+
+	putTree(t, client)
+	checkTree(t, client)
+}
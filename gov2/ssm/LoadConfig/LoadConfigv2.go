@@ -0,0 +1,517 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[ssm.go-v2.LoadConfig]
+package main
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// SSMGetParametersAPI defines the interface for the GetParameters function.
+// We use this interface to test the function using a mocked service.
+type SSMGetParametersAPI interface {
+	GetParameters(ctx context.Context,
+		params *ssm.GetParametersInput,
+		optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+}
+
+// maxNames is the most parameters that one call to GetParameters returns.
+const maxNames = 10
+
+// LoadOptions configures LoadConfig and WatchConfig.
+type LoadOptions struct {
+	// Prefix is the path of the parameters whose names in ssm tags don't start with /,
+	// such as /app/dev for a tag of db/port.
+	Prefix string
+
+	// Interval is how often WatchConfig loads the parameters again. The default is one minute.
+	Interval time.Duration
+
+	// OnError, if set, is called with each error from WatchConfig loading the parameters again.
+	OnError func(error)
+}
+
+// FieldError is a parameter whose value can't be converted to the type of its field.
+type FieldError struct {
+	Field     string
+	Parameter string
+	Err       error
+}
+
+func (e *FieldError) Error() string {
+	return e.Parameter + " (" + e.Field + "): " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError reports every parameter that LoadConfig couldn't use.
+type LoadError struct {
+	// Missing are the names of the required parameters that don't exist
+	Missing []string
+
+	// Invalid are the parameters whose values can't be converted to the types of their fields
+	Invalid []*FieldError
+}
+
+func (e *LoadError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing parameters "+strings.Join(e.Missing, ", "))
+	}
+
+	for _, f := range e.Invalid {
+		problems = append(problems, f.Error())
+	}
+
+	return strings.Join(problems, "; ")
+}
+
+// field is a struct field with an ssm tag.
+type field struct {
+	name      string
+	parameter string
+	optional  bool
+	index     []int
+}
+
+// fields returns the fields of a struct type that have ssm tags,
+// including the ones of nested structs without ssm tags.
+func fields(t reflect.Type, prefix string, index []int, parent string) ([]field, error) {
+	var result []field
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fieldIndex := append(append([]int(nil), index...), i)
+		fieldName := parent + f.Name
+
+		tag, ok := f.Tag.Lookup("ssm")
+		if !ok {
+			if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) {
+				nested, err := fields(f.Type, prefix, fieldIndex, fieldName+".")
+				if err != nil {
+					return nil, err
+				}
+
+				result = append(result, nested...)
+			}
+
+			continue
+		}
+
+		if tag == "-" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		name := options[0]
+		if name == "" {
+			return nil, errors.New(fieldName + ": the ssm tag has no parameter name")
+		}
+
+		if !strings.HasPrefix(name, "/") {
+			if prefix == "" {
+				return nil, errors.New(fieldName + ": the parameter name " + name + " is relative, and there is no prefix")
+			}
+
+			name = strings.TrimSuffix(prefix, "/") + "/" + name
+		}
+
+		fl := field{name: fieldName, parameter: name, index: fieldIndex}
+		for _, option := range options[1:] {
+			if option != "optional" {
+				return nil, errors.New(fieldName + ": unknown ssm tag option " + option)
+			}
+
+			fl.optional = true
+		}
+
+		if !convertible(f.Type) {
+			return nil, errors.New(fieldName + ": can't load a parameter into a " + f.Type.String())
+		}
+
+		result = append(result, fl)
+	}
+
+	return result, nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// convertible reports whether setValue can convert a parameter value to type t.
+func convertible(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && convertible(t.Elem())
+	}
+
+	return false
+}
+
+// setValue converts a parameter value to the type of v and stores it in v.
+// A slice gets an element for each item of a comma-separated list, such as the value of a StringList parameter.
+func setValue(v reflect.Value, value string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	case reflect.Slice:
+		items := strings.Split(value, ",")
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			err := setValue(slice.Index(i), strings.TrimSpace(item))
+			if err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+
+		v.Set(slice)
+	}
+
+	return nil
+}
+
+// getParameters retrieves the values of parameters by name, 10 at a time, with SecureString values decrypted.
+// The parameters that don't exist are left out.
+func getParameters(c context.Context, api SSMGetParametersAPI, names []string) (map[string]string, error) {
+	values := map[string]string{}
+
+	for start := 0; start < len(names); start += maxNames {
+		end := start + maxNames
+		if end > len(names) {
+			end = len(names)
+		}
+
+		output, err := api.GetParameters(c, &ssm.GetParametersInput{
+			Names:          names[start:end],
+			WithDecryption: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range output.Parameters {
+			values[aws.ToString(p.Name)] = aws.ToString(p.Value)
+		}
+	}
+
+	return values, nil
+}
+
+// load fills in the struct that cfg points to, and returns the values of its parameters.
+// It doesn't change the struct unless every required parameter exists and every value can be converted.
+func load(c context.Context, api SSMGetParametersAPI, cfg interface{}, opts LoadOptions) (map[string]string, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("the configuration must be a pointer to a struct")
+	}
+
+	fs, err := fields(v.Elem().Type(), opts.Prefix, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, f := range fs {
+		if !seen[f.parameter] {
+			seen[f.parameter] = true
+			names = append(names, f.parameter)
+		}
+	}
+
+	values, err := getParameters(c, api, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fill in a copy, so that the struct keeps its values if there is an error
+	loaded := reflect.New(v.Elem().Type()).Elem()
+	loaded.Set(v.Elem())
+
+	loadErr := &LoadError{}
+	for _, f := range fs {
+		value, ok := values[f.parameter]
+		if !ok {
+			if !f.optional && !contains(loadErr.Missing, f.parameter) {
+				loadErr.Missing = append(loadErr.Missing, f.parameter)
+			}
+
+			continue
+		}
+
+		err := setValue(loaded.FieldByIndex(f.index), value)
+		if err != nil {
+			loadErr.Invalid = append(loadErr.Invalid, &FieldError{Field: f.name, Parameter: f.parameter, Err: err})
+		}
+	}
+
+	if len(loadErr.Missing) > 0 || len(loadErr.Invalid) > 0 {
+		sort.Strings(loadErr.Missing)
+		return nil, loadErr
+	}
+
+	v.Elem().Set(loaded)
+
+	return values, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoadConfig fills in a struct from AWS Systems Manager parameters.
+// Each field to fill in has an ssm tag with the name of its parameter, such as `ssm:"/app/db/port"`,
+// optionally followed by ,optional for a parameter that might not exist.
+// A field whose optional parameter doesn't exist keeps its value, which can be a default.
+// LoadConfig converts values to strings, booleans, integers, floating-point numbers, time.Duration,
+// types that implement encoding.TextUnmarshaler, and slices of these from comma-separated lists
+// such as StringList parameters. SecureString values are decrypted.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     cfg is a pointer to the struct to fill in.
+//     opts sets the prefix of relative parameter names.
+// Output:
+//     If success, nil.
+//     Otherwise, an error from a call to GetParameters, an error for an invalid struct,
+//     or a *LoadError listing every missing required parameter and every value that can't be converted.
+//     If there is an error, the struct is unchanged.
+func LoadConfig(c context.Context, api SSMGetParametersAPI, cfg interface{}, opts LoadOptions) error {
+	_, err := load(c, api, cfg, opts)
+	return err
+}
+
+// WatchConfig loads a struct with LoadConfig, and then loads the parameters again every opts.Interval
+// until c is done. Each time any of the parameter values change, it calls onChange with a new struct
+// of the same type as the one that cfg points to, and the names of the changed parameters.
+// The struct that cfg points to isn't changed after the first load, so that other goroutines can read it.
+// Inputs:
+//     c is the context of the method calls, which includes the AWS Region. Cancel it to stop watching.
+//     api is the interface that defines the method call.
+//     cfg is a pointer to the struct to fill in. Its values are the defaults of optional parameters.
+//     opts sets the prefix of relative parameter names, the interval, and the function to call with errors.
+//     onChange is called with a pointer to the new struct and the names of the changed parameters.
+// Output:
+//     If the first load fails, its error.
+//     Otherwise, the error from c when it is done.
+func WatchConfig(c context.Context, api SSMGetParametersAPI, cfg interface{}, opts LoadOptions, onChange func(cfg interface{}, changed []string)) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("the configuration must be a pointer to a struct")
+	}
+
+	defaults := reflect.New(v.Elem().Type())
+	defaults.Elem().Set(v.Elem())
+
+	values, err := load(c, api, cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return c.Err()
+		case <-ticker.C:
+		}
+
+		next := reflect.New(v.Elem().Type())
+		next.Elem().Set(defaults.Elem())
+
+		latest, err := load(c, api, next.Interface(), opts)
+		if err != nil {
+			if opts.OnError != nil && c.Err() == nil {
+				opts.OnError(err)
+			}
+
+			continue
+		}
+
+		changed := changedNames(values, latest)
+		if len(changed) == 0 {
+			continue
+		}
+
+		values = latest
+		onChange(next.Interface(), changed)
+	}
+}
+
+// changedNames returns the names of the parameters whose values differ, or which exist in only one of the maps.
+func changedNames(old, latest map[string]string) []string {
+	var changed []string
+
+	for name, value := range latest {
+		if previous, ok := old[name]; !ok || previous != value {
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range old {
+		if _, ok := latest[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed
+}
+
+// AppConfig is the configuration of an example application, under a prefix such as /app/dev.
+type AppConfig struct {
+	DB struct {
+		Host     string `ssm:"db/host"`
+		Port     int    `ssm:"db/port"`
+		Password string `ssm:"db/password"`
+	}
+
+	Debug   bool          `ssm:"debug,optional"`
+	Timeout time.Duration `ssm:"timeout,optional"`
+	Hosts   []string      `ssm:"hosts,optional"`
+}
+
+func (a *AppConfig) String() string {
+	return fmt.Sprintf("db=%s:%d (password %d characters) debug=%v timeout=%v hosts=%v",
+		a.DB.Host, a.DB.Port, len(a.DB.Password), a.Debug, a.Timeout, a.Hosts)
+}
+
+func main() {
+	prefix := flag.String("p", "", "The path of the application's parameters, such as /app/dev")
+	watch := flag.Duration("w", 0, "If set, how often to check the parameters for changes, such as 30s")
+	flag.Parse()
+
+	if *prefix == "" {
+		fmt.Println("You must supply the path of the parameters")
+		fmt.Println("-p PREFIX [-w INTERVAL]")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := ssm.NewFromConfig(cfg)
+
+	// The defaults of the optional parameters
+	defaults := AppConfig{Timeout: 30 * time.Second}
+
+	app := defaults
+	opts := LoadOptions{
+		Prefix:   *prefix,
+		Interval: *watch,
+		OnError:  func(err error) { fmt.Println("Got an error reloading the configuration:", err) },
+	}
+
+	err = LoadConfig(context.TODO(), client, &app, opts)
+	if err != nil {
+		fmt.Println("Got an error loading the configuration:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(&app)
+
+	if *watch == 0 {
+		return
+	}
+
+	watched := defaults
+	err = WatchConfig(context.TODO(), client, &watched, opts, func(cfg interface{}, changed []string) {
+		fmt.Println("Changed:", strings.Join(changed, ", "))
+		fmt.Println(cfg)
+	})
+	if err != nil {
+		fmt.Println("Got an error loading the configuration:")
+		fmt.Println(err)
+	}
+}
+
+// snippet-end:[ssm.go-v2.LoadConfig]
@@ -0,0 +1,304 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ssmfake"
+)
+
+type SSMPutParameterAPI interface {
+	PutParameter(ctx context.Context,
+		params *ssm.PutParameterInput,
+		optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// testConfig has a field of each type that LoadConfig converts, and more than 10 parameters
+type testConfig struct {
+	DB struct {
+		Host     string `ssm:"db/host"`
+		Port     uint16 `ssm:"db/port"`
+		Password string `ssm:"db/password"`
+	}
+
+	Debug     bool          `ssm:"debug"`
+	Workers   int           `ssm:"workers"`
+	Offset    int8          `ssm:"offset"`
+	Ratio     float64       `ssm:"ratio"`
+	Timeout   time.Duration `ssm:"timeout"`
+	Hosts     []string      `ssm:"hosts"`
+	Ports     []int         `ssm:"ports"`
+	Address   net.IP        `ssm:"address"`
+	Started   time.Time     `ssm:"started"`
+	Region    string        `ssm:"/doc-example/shared/region"`
+	Retries   int           `ssm:"retries,optional"`
+	Ignored   string        `ssm:"-"`
+	unexposed string
+}
+
+var testParameters = map[string]string{
+	"/doc-example/dev/db/host":     "db.dev.example.com",
+	"/doc-example/dev/db/port":     "5432",
+	"/doc-example/dev/db/password": "hunter2",
+	"/doc-example/dev/debug":       "true",
+	"/doc-example/dev/workers":     "8",
+	"/doc-example/dev/offset":      "-3",
+	"/doc-example/dev/ratio":       "0.75",
+	"/doc-example/dev/timeout":     "1m30s",
+	"/doc-example/dev/hosts":       "web-1,web-2",
+	"/doc-example/dev/ports":       "80, 443",
+	"/doc-example/dev/address":     "192.0.2.1",
+	"/doc-example/dev/started":     "2020-12-01T09:15:00Z",
+	"/doc-example/shared/region":   "us-west-2",
+}
+
+func putParameters(t *testing.T, api SSMPutParameterAPI, parameters map[string]string) {
+	for name, value := range parameters {
+		kind := types.ParameterTypeString
+		switch name {
+		case "/doc-example/dev/db/password":
+			kind = types.ParameterTypeSecureString
+		case "/doc-example/dev/hosts":
+			kind = types.ParameterTypeStringList
+		}
+
+		_, err := api.PutParameter(context.Background(), &ssm.PutParameterInput{
+			Name:      aws.String(name),
+			Value:     aws.String(value),
+			Type:      kind,
+			Overwrite: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkConfig(t *testing.T, cfg *testConfig) {
+	started := time.Date(2020, 12, 1, 9, 15, 0, 0, time.UTC)
+
+	if cfg.DB.Host != "db.dev.example.com" || cfg.DB.Port != 5432 || cfg.DB.Password != "hunter2" ||
+		!cfg.Debug || cfg.Workers != 8 || cfg.Offset != -3 || cfg.Ratio != 0.75 || cfg.Timeout != 90*time.Second ||
+		fmt.Sprint(cfg.Hosts) != "[web-1 web-2]" || fmt.Sprint(cfg.Ports) != "[80 443]" ||
+		cfg.Address.String() != "192.0.2.1" || !cfg.Started.Equal(started) || cfg.Region != "us-west-2" ||
+		cfg.Retries != 3 || cfg.Ignored != "" {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+// countingParameters counts the calls to GetParameters
+type countingParameters struct {
+	*ssmfake.Service
+	calls int
+}
+
+func (c *countingParameters) GetParameters(ctx context.Context,
+	params *ssm.GetParametersInput,
+	optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	c.calls++
+	return c.Service.GetParameters(ctx, params, optFns...)
+}
+
+func TestLoadConfig(t *testing.T) {
+	api := &countingParameters{Service: ssmfake.New()}
+	putParameters(t, api, testParameters)
+
+	cfg := testConfig{Retries: 3}
+
+	err := LoadConfig(context.Background(), api, &cfg, LoadOptions{Prefix: "/doc-example/dev/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkConfig(t, &cfg)
+
+	if api.calls != 2 {
+		t.Errorf("got %d calls to GetParameters, want 2 for 14 parameters", api.calls)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	api := ssmfake.New()
+
+	parameters := map[string]string{}
+	for name, value := range testParameters {
+		parameters[name] = value
+	}
+
+	delete(parameters, "/doc-example/dev/db/host")
+	delete(parameters, "/doc-example/shared/region")
+	parameters["/doc-example/dev/db/port"] = "70000"
+	parameters["/doc-example/dev/ports"] = "80,https"
+
+	putParameters(t, api, parameters)
+
+	cfg := testConfig{Retries: 3}
+
+	err := LoadConfig(context.Background(), api, &cfg, LoadOptions{Prefix: "/doc-example/dev"})
+
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("got %v, want a LoadError", err)
+	}
+
+	if fmt.Sprint(loadErr.Missing) != "[/doc-example/dev/db/host /doc-example/shared/region]" {
+		t.Errorf("got missing parameters %v", loadErr.Missing)
+	}
+
+	if len(loadErr.Invalid) != 2 || loadErr.Invalid[0].Field != "DB.Port" || loadErr.Invalid[1].Field != "Ports" {
+		t.Errorf("got invalid parameters %v", loadErr.Invalid)
+	}
+
+	var numErr *strconv.NumError
+	if !errors.As(loadErr.Invalid[0], &numErr) {
+		t.Errorf("got %v, want a strconv.NumError", loadErr.Invalid[0].Err)
+	}
+
+	if cfg.Workers != 0 || cfg.Retries != 3 {
+		t.Errorf("the struct changed after an error: %+v", cfg)
+	}
+
+	invalid := []struct {
+		cfg    interface{}
+		prefix string
+	}{
+		{testConfig{}, "/doc-example/dev"},
+		{&testConfig{}, ""},
+		{&struct {
+			Port int `ssm:"/doc-example/dev/db/port,required"`
+		}{}, ""},
+		{&struct {
+			Hosts map[string]string `ssm:"/doc-example/dev/hosts"`
+		}{}, ""},
+		{&struct {
+			Port int `ssm:",optional"`
+		}{}, ""},
+	}
+
+	for _, test := range invalid {
+		err := LoadConfig(context.Background(), api, test.cfg, LoadOptions{Prefix: test.prefix})
+		if err == nil || errors.As(err, &loadErr) {
+			t.Errorf("%T: got %v, want an error for the struct", test.cfg, err)
+		}
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	api := ssmfake.New()
+	putParameters(t, api, testParameters)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type change struct {
+		cfg     *testConfig
+		changed []string
+	}
+
+	changes := make(chan change, 10)
+	errs := make(chan error, 10)
+	done := make(chan error)
+
+	cfg := testConfig{Retries: 3}
+	opts := LoadOptions{
+		Prefix:   "/doc-example/dev",
+		Interval: 10 * time.Millisecond,
+		OnError:  func(err error) { errs <- err },
+	}
+
+	go func() {
+		done <- WatchConfig(ctx, api, &cfg, opts, func(cfg interface{}, changed []string) {
+			changes <- change{cfg.(*testConfig), changed}
+		})
+	}()
+
+	// Nothing changes until a parameter does
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case c := <-changes:
+		t.Fatalf("got a change of %v", c.changed)
+	default:
+	}
+
+	putParameters(t, api, map[string]string{"/doc-example/dev/workers": "16", "/doc-example/dev/retries": "5"})
+
+	select {
+	case c := <-changes:
+		if fmt.Sprint(c.changed) != "[/doc-example/dev/retries /doc-example/dev/workers]" || c.cfg.Workers != 16 || c.cfg.Retries != 5 {
+			t.Errorf("got %v and %+v", c.changed, c.cfg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WatchConfig didn't report the change")
+	}
+
+	// The first load happened before the change was reported
+	checkConfig(t, &cfg)
+
+	// Deleting an optional parameter restores its default
+	_, err := api.DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: aws.String("/doc-example/dev/retries")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-changes:
+		if fmt.Sprint(c.changed) != "[/doc-example/dev/retries]" || c.cfg.Retries != 3 {
+			t.Errorf("got %v and %+v", c.changed, c.cfg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WatchConfig didn't report the deletion")
+	}
+
+	// A reload that fails is reported, and doesn't call onChange
+	putParameters(t, api, map[string]string{"/doc-example/dev/workers": "many"})
+
+	select {
+	case err := <-errs:
+		var loadErr *LoadError
+		if !errors.As(err, &loadErr) {
+			t.Errorf("got %v, want a LoadError", err)
+		}
+	case c := <-changes:
+		t.Errorf("got a change of %v", c.changed)
+	case <-time.After(time.Second):
+		t.Fatal("WatchConfig didn't report the error")
+	}
+
+	if cfg.Workers != 8 {
+		t.Errorf("WatchConfig changed the first struct: %+v", cfg)
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestLoadConfigLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	client := ssm.NewFromConfig(server.Config())
+	putParameters(t, client, testParameters)
+
+	cfg := testConfig{Retries: 3}
+
+	err := LoadConfig(context.Background(), client, &cfg, LoadOptions{Prefix: "/doc-example/dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkConfig(t, &cfg)
+}
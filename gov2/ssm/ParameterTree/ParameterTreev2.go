@@ -0,0 +1,665 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[ssm.go-v2.ParameterTree]
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"gopkg.in/yaml.v2"
+)
+
+// SSMGetParametersByPathAPI defines the interface for the GetParametersByPath function.
+// We use this interface to test the function using a mocked service.
+type SSMGetParametersByPathAPI interface {
+	GetParametersByPath(ctx context.Context,
+		params *ssm.GetParametersByPathInput,
+		optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+}
+
+// SSMParameterTreeAPI defines the interface for the GetParametersByPath, PutParameter, and DeleteParameter functions.
+// We use this interface to test the functions using a mocked service.
+type SSMParameterTreeAPI interface {
+	SSMGetParametersByPathAPI
+
+	PutParameter(ctx context.Context,
+		params *ssm.PutParameterInput,
+		optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+
+	DeleteParameter(ctx context.Context,
+		params *ssm.DeleteParameterInput,
+		optFns ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error)
+}
+
+// Entry is a parameter of a tree, named relative to the tree's path,
+// so that a tree exported from one path can be imported under another.
+type Entry struct {
+	Name  string
+	Type  types.ParameterType
+	Value string
+}
+
+// The formats that Encode and Decode support
+const (
+	FormatJSON   = "json"
+	FormatYAML   = "yaml"
+	FormatDotenv = "env"
+)
+
+// ReadTree retrieves every parameter under an AWS Systems Manager path, with the values of SecureString parameters decrypted.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method call.
+//     path is the path of the tree, such as /app/dev.
+// Output:
+//     If success, the parameters in name order, named relative to path, and nil.
+//     Otherwise, nil and an error from a call to GetParametersByPath.
+func ReadTree(c context.Context, api SSMGetParametersByPathAPI, path string) ([]Entry, error) {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+
+	input := &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      true,
+		WithDecryption: true,
+	}
+
+	var entries []Entry
+	for {
+		output, err := api.GetParametersByPath(c, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range output.Parameters {
+			entries = append(entries, Entry{
+				Name:  strings.TrimPrefix(aws.ToString(p.Name), prefix),
+				Type:  p.Type,
+				Value: aws.ToString(p.Value),
+			})
+		}
+
+		if output.NextToken == nil {
+			break
+		}
+
+		input.NextToken = output.NextToken
+	}
+
+	sortEntries(entries)
+
+	return entries, nil
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+}
+
+// checkEntries checks that each entry has a relative name, used only once, and a parameter type.
+func checkEntries(entries []Entry) error {
+	seen := map[string]bool{}
+
+	for _, e := range entries {
+		if e.Name == "" || strings.HasPrefix(e.Name, "/") || strings.HasSuffix(e.Name, "/") || strings.Contains(e.Name, "//") {
+			return fmt.Errorf("%q isn't a relative parameter name", e.Name)
+		}
+
+		if seen[e.Name] {
+			return fmt.Errorf("%s appears more than once", e.Name)
+		}
+
+		seen[e.Name] = true
+
+		switch e.Type {
+		case types.ParameterTypeString, types.ParameterTypeStringList, types.ParameterTypeSecureString:
+		default:
+			return fmt.Errorf("%s: %q isn't a parameter type", e.Name, e.Type)
+		}
+	}
+
+	return nil
+}
+
+// jsonEntry is the value of a parameter in the JSON format.
+type jsonEntry struct {
+	Type  types.ParameterType
+	Value string
+}
+
+// yamlEntry is the value of a parameter in the YAML format.
+type yamlEntry struct {
+	Type  types.ParameterType `yaml:"type"`
+	Value string              `yaml:"value"`
+}
+
+// Encode writes a tree in a format:
+//     json is an object whose keys are the parameter names, with a Type and Value for each.
+//     yaml is the same structure as YAML, with lowercase type and value keys.
+//     env is a dotenv file. Each variable is preceded by a comment with the parameter name and type,
+//     which Decode uses to restore them.
+// Inputs:
+//     w is where to write the tree.
+//     format is json, yaml, or env.
+//     entries are the parameters of the tree.
+// Output:
+//     If success, nil.
+//     Otherwise, an error for an unknown format, for two parameters with the same dotenv variable name,
+//     or from writing to w.
+func Encode(w io.Writer, format string, entries []Entry) error {
+	err := checkEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	sorted := append([]Entry(nil), entries...)
+	sortEntries(sorted)
+
+	var buf bytes.Buffer
+
+	switch format {
+	case FormatJSON:
+		tree := map[string]jsonEntry{}
+		for _, e := range sorted {
+			tree[e.Name] = jsonEntry{Type: e.Type, Value: e.Value}
+		}
+
+		data, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		buf.Write(data)
+		buf.WriteString("\n")
+	case FormatYAML:
+		tree := map[string]yamlEntry{}
+		for _, e := range sorted {
+			tree[e.Name] = yamlEntry{Type: e.Type, Value: e.Value}
+		}
+
+		data, err := yaml.Marshal(tree)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(data)
+	case FormatDotenv:
+		variables := map[string]string{}
+		for _, e := range sorted {
+			variable := dotenvName(e.Name)
+			if other, ok := variables[variable]; ok {
+				return fmt.Errorf("%s and %s both have the dotenv name %s", other, e.Name, variable)
+			}
+
+			variables[variable] = e.Name
+
+			fmt.Fprintf(&buf, "# %s %s\n%s=%s\n", e.Name, e.Type, variable, strconv.Quote(e.Value))
+		}
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	_, err = w.Write(buf.Bytes())
+
+	return err
+}
+
+// dotenvName returns the dotenv variable name of a parameter: its name in uppercase,
+// with each character other than a letter or digit replaced by an underscore.
+func dotenvName(name string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z':
+			return c - 'a' + 'A'
+		case c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			return c
+		}
+
+		return '_'
+	}, name)
+}
+
+// Decode reads a tree written by Encode.
+// It also reads hand-written YAML, and dotenv files without the comments that Encode writes.
+// A dotenv variable without a comment becomes a String parameter named after the variable in lowercase.
+// Inputs:
+//     r is where to read the tree from.
+//     format is json, yaml, or env.
+// Output:
+//     If success, the parameters of the tree in name order, and nil.
+//     Otherwise, nil and an error for an unknown format, a malformed tree, or from reading r.
+func Decode(r io.Reader, format string) ([]Entry, error) {
+	var entries []Entry
+	var err error
+
+	switch format {
+	case FormatJSON:
+		var tree map[string]jsonEntry
+		err = json.NewDecoder(r).Decode(&tree)
+		for name, e := range tree {
+			entries = append(entries, Entry{Name: name, Type: e.Type, Value: e.Value})
+		}
+	case FormatYAML:
+		// Strict decoding rejects unknown keys and parameters that appear more than once
+		var tree map[string]yamlEntry
+		decoder := yaml.NewDecoder(r)
+		decoder.SetStrict(true)
+		err = decoder.Decode(&tree)
+		if err == io.EOF {
+			err = nil
+		}
+
+		for name, e := range tree {
+			entries = append(entries, Entry{Name: name, Type: e.Type, Value: e.Value})
+		}
+	case FormatDotenv:
+		entries, err = decodeDotenv(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	sortEntries(entries)
+
+	return entries, nil
+}
+
+// decodeDotenv reads KEY=VALUE lines, using the comment that Encode writes before each one
+// for the parameter's name and type.
+func decodeDotenv(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var pending *Entry
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(text, "#") {
+			pending = nil
+
+			fields := strings.Fields(strings.TrimPrefix(text, "#"))
+			if len(fields) == 2 {
+				pending = &Entry{Name: fields[0], Type: types.ParameterType(fields[1])}
+			}
+
+			continue
+		}
+
+		if text == "" {
+			pending = nil
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(text, "export "), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+
+		variable := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid double-quoted value", line)
+			}
+
+			value = unquoted
+		case strings.HasPrefix(value, "'"):
+			if len(value) < 2 || !strings.HasSuffix(value, "'") {
+				return nil, fmt.Errorf("line %d: invalid single-quoted value", line)
+			}
+
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+
+		e := Entry{Name: strings.ToLower(variable), Type: types.ParameterTypeString}
+		if pending != nil && dotenvName(pending.Name) == variable {
+			e.Name = pending.Name
+			e.Type = pending.Type
+		}
+
+		e.Value = value
+		entries = append(entries, e)
+		pending = nil
+	}
+
+	return entries, scanner.Err()
+}
+
+// ChangeKind is what Apply does to one parameter.
+type ChangeKind string
+
+// The kinds of change
+const (
+	ChangeAdd    ChangeKind = "add"
+	ChangeUpdate ChangeKind = "update"
+	ChangeDelete ChangeKind = "delete"
+)
+
+// Change is the difference between a parameter of two trees.
+// Old is nil for an added parameter, and New is nil for a deleted one.
+type Change struct {
+	Kind ChangeKind
+	Name string
+	Old  *Entry
+	New  *Entry
+}
+
+// String describes the change without revealing the value of a SecureString parameter.
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdd:
+		return fmt.Sprintf("+ %s (%s) = %s", c.Name, c.New.Type, displayValue(*c.New))
+	case ChangeDelete:
+		return fmt.Sprintf("- %s (%s)", c.Name, c.Old.Type)
+	}
+
+	kind := string(c.New.Type)
+	if c.Old.Type != c.New.Type {
+		kind = string(c.Old.Type) + " -> " + kind
+	}
+
+	return fmt.Sprintf("~ %s (%s) = %s -> %s", c.Name, kind, displayValue(*c.Old), displayValue(*c.New))
+}
+
+func displayValue(e Entry) string {
+	if e.Type == types.ParameterTypeSecureString {
+		return "(secret)"
+	}
+
+	return strconv.Quote(e.Value)
+}
+
+// Diff compares the parameters of a tree with the ones it should have.
+// Inputs:
+//     current are the parameters of the tree, such as from ReadTree.
+//     desired are the parameters it should have, such as from Decode.
+//     prune is whether to delete the current parameters that aren't desired.
+// Output:
+//     The changes that make current match desired, in name order. Unchanged parameters are left out.
+func Diff(current, desired []Entry, prune bool) []Change {
+	have := map[string]Entry{}
+	for _, e := range current {
+		have[e.Name] = e
+	}
+
+	want := map[string]Entry{}
+	for _, e := range desired {
+		want[e.Name] = e
+	}
+
+	var changes []Change
+
+	for _, e := range desired {
+		e := e
+
+		old, ok := have[e.Name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeAdd, Name: e.Name, New: &e})
+		case old.Type != e.Type || old.Value != e.Value:
+			changes = append(changes, Change{Kind: ChangeUpdate, Name: e.Name, Old: &old, New: &e})
+		}
+	}
+
+	if prune {
+		for _, e := range current {
+			e := e
+
+			if _, ok := want[e.Name]; !ok {
+				changes = append(changes, Change{Kind: ChangeDelete, Name: e.Name, Old: &e})
+			}
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+
+	return changes
+}
+
+// Apply makes the changes from Diff to the parameters under an AWS Systems Manager path.
+// It overwrites a parameter whose type changes. If Parameter Store rejects the new type,
+// it deletes and re-creates the parameter, and puts back the old value if it can't re-create it.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     api is the interface that defines the method calls.
+//     path is the path of the tree, such as /app/prod.
+//     changes are the changes to make.
+//     keyID is the ID of the AWS KMS key to encrypt SecureString parameters with, or empty for the AWS managed key.
+// Output:
+//     If success, nil.
+//     Otherwise, an error from the first call to PutParameter or DeleteParameter that failed.
+//     The changes before it were made.
+func Apply(c context.Context, api SSMParameterTreeAPI, path string, changes []Change, keyID string) error {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+
+	for _, change := range changes {
+		name := aws.String(prefix + change.Name)
+
+		if change.Kind == ChangeDelete {
+			_, err := api.DeleteParameter(c, &ssm.DeleteParameterInput{Name: name})
+			if err != nil {
+				return fmt.Errorf("delete %s: %w", change.Name, err)
+			}
+
+			continue
+		}
+
+		err := putEntry(c, api, name, *change.New, change.Kind == ChangeUpdate, keyID)
+
+		var mismatch *types.HierarchyTypeMismatchException
+		if err != nil && change.Kind == ChangeUpdate && errors.As(err, &mismatch) {
+			err = replaceEntry(c, api, name, *change.Old, *change.New, keyID)
+		}
+
+		if err != nil {
+			return fmt.Errorf("put %s: %w", change.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// putEntry creates or overwrites a parameter.
+func putEntry(c context.Context, api SSMParameterTreeAPI, name *string, e Entry, overwrite bool, keyID string) error {
+	input := &ssm.PutParameterInput{
+		Name:      name,
+		Type:      e.Type,
+		Value:     aws.String(e.Value),
+		Overwrite: overwrite,
+	}
+
+	if e.Type == types.ParameterTypeSecureString && keyID != "" {
+		input.KeyId = aws.String(keyID)
+	}
+
+	_, err := api.PutParameter(c, input)
+
+	return err
+}
+
+// replaceEntry deletes a parameter and re-creates it with another type.
+// If it can't re-create the parameter, it puts back the old one, so that the parameter isn't lost.
+func replaceEntry(c context.Context, api SSMParameterTreeAPI, name *string, old, e Entry, keyID string) error {
+	_, err := api.DeleteParameter(c, &ssm.DeleteParameterInput{Name: name})
+	if err != nil {
+		return fmt.Errorf("delete to change the type: %w", err)
+	}
+
+	err = putEntry(c, api, name, e, false, keyID)
+	if err == nil {
+		return nil
+	}
+
+	// The old parameter used its own key, which we don't know, so a restored SecureString uses keyID
+	restoreErr := putEntry(c, api, name, old, false, keyID)
+	if restoreErr != nil {
+		return fmt.Errorf("%w, and the old value couldn't be restored: %v", err, restoreErr)
+	}
+
+	return fmt.Errorf("%w (the old value was restored)", err)
+}
+
+// formatOf returns the format named by a file's extension, or the default format.
+func formatOf(file, format string) string {
+	if format != "" {
+		return format
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".env":
+		return FormatDotenv
+	}
+
+	return FormatJSON
+}
+
+func main() {
+	path := flag.String("p", "", "The path of the tree to export or import, such as /app/dev")
+	export := flag.Bool("export", false, "Export the tree")
+	importFile := flag.String("import", "", "Import the tree from this file, or - for standard input")
+	from := flag.String("from", "", "Copy the tree from this path, such as /app/dev")
+	output := flag.String("o", "-", "The file to export the tree to, or - for standard output")
+	secrets := flag.Bool("secrets", false, "Export the decrypted values of SecureString parameters")
+	format := flag.String("f", "", "The format of the file: json, yaml, or env. The default comes from the file extension, or is json")
+	prune := flag.Bool("prune", false, "Delete the parameters under the path that aren't in the imported tree")
+	keyID := flag.String("k", "", "The ID of the AWS KMS key to encrypt imported SecureString parameters with. The default is the AWS managed key")
+	dryRun := flag.Bool("dry-run", false, "Show the changes an import would make without making them")
+	flag.Parse()
+
+	modes := 0
+	for _, set := range []bool{*export, *importFile != "", *from != ""} {
+		if set {
+			modes++
+		}
+	}
+
+	if *path == "" || modes != 1 {
+		fmt.Println("You must supply a path and exactly one of -export, -import, or -from")
+		fmt.Println("-p PATH -export [-o FILE] [-f FORMAT] [-secrets]")
+		fmt.Println("-p PATH -import FILE [-f FORMAT] [-prune] [-k KEY-ID] [-dry-run]")
+		fmt.Println("-p PATH -from SOURCE-PATH [-prune] [-k KEY-ID] [-dry-run]")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := ssm.NewFromConfig(cfg)
+
+	current, err := ReadTree(context.TODO(), client, *path)
+	if err != nil {
+		fmt.Println("Got an error reading " + *path + ":")
+		fmt.Println(err)
+		return
+	}
+
+	if *export {
+		if !*secrets {
+			for _, e := range current {
+				if e.Type == types.ParameterTypeSecureString {
+					fmt.Println(e.Name + " is a SecureString parameter. Use -secrets to export the decrypted values of SecureString parameters")
+					return
+				}
+			}
+		}
+
+		w := os.Stdout
+		if *output != "-" {
+			// Only the owner can read the file, which can contain secrets
+			w, err = os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			defer w.Close()
+		}
+
+		err = Encode(w, formatOf(*output, *format), current)
+		if err != nil {
+			fmt.Println("Got an error exporting the tree:")
+			fmt.Println(err)
+		}
+
+		return
+	}
+
+	var desired []Entry
+	if *from != "" {
+		desired, err = ReadTree(context.TODO(), client, *from)
+	} else {
+		r := os.Stdin
+		if *importFile != "-" {
+			r, err = os.Open(*importFile)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			defer r.Close()
+		}
+
+		desired, err = Decode(r, formatOf(*importFile, *format))
+	}
+
+	if err != nil {
+		fmt.Println("Got an error reading the tree to import:")
+		fmt.Println(err)
+		return
+	}
+
+	changes := Diff(current, desired, *prune)
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	fmt.Println(len(changes), "changes")
+
+	if *dryRun || len(changes) == 0 {
+		return
+	}
+
+	err = Apply(context.TODO(), client, *path, changes, *keyID)
+	if err != nil {
+		fmt.Println("Got an error importing the tree:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("Imported the tree to " + *path)
+}
+
+// snippet-end:[ssm.go-v2.ParameterTree]
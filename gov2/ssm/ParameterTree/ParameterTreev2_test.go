@@ -0,0 +1,323 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/ssmfake"
+)
+
+// The dev tree of the tests, with values that need quoting in each format
+var testTree = []Entry{
+	{Name: "db/host", Type: types.ParameterTypeString, Value: "db.dev.example.com"},
+	{Name: "db/password", Type: types.ParameterTypeSecureString, Value: `p@ss: "word" # not a comment`},
+	{Name: "db/port", Type: types.ParameterTypeString, Value: "5432"},
+	{Name: "greeting", Type: types.ParameterTypeString, Value: "Hello,\n'world'\t\\ ü"},
+	{Name: "hosts", Type: types.ParameterTypeStringList, Value: "web-1,web-2"},
+}
+
+func putEntries(t *testing.T, api SSMParameterTreeAPI, path string, entries []Entry) {
+	err := Apply(context.Background(), api, path, Diff(nil, entries, false), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equal(a, b []Entry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestReadTree(t *testing.T) {
+	api := ssmfake.New()
+
+	entries := append([]Entry(nil), testTree...)
+	for i := 0; i < 15; i++ {
+		entries = append(entries, Entry{Name: fmt.Sprintf("features/feature-%02d", i), Type: types.ParameterTypeString, Value: "on"})
+	}
+
+	putEntries(t, api, "/doc-example/dev", entries)
+	putEntries(t, api, "/doc-example/development", testTree[:1])
+
+	got, err := ReadTree(context.Background(), api, "/doc-example/dev/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sortEntries(entries)
+	if !equal(got, entries) {
+		t.Errorf("got %v, want %v", got, entries)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatYAML, FormatDotenv} {
+		var buf bytes.Buffer
+
+		err := Encode(&buf, format, testTree)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := Decode(strings.NewReader(buf.String()), format)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", format, err, buf.String())
+		}
+
+		if !equal(got, testTree) {
+			t.Errorf("%s: got %v, want %v\n%s", format, got, testTree, buf.String())
+		}
+	}
+
+	err := Encode(&bytes.Buffer{}, FormatDotenv, []Entry{
+		{Name: "db/port", Type: types.ParameterTypeString, Value: "5432"},
+		{Name: "db-port", Type: types.ParameterTypeString, Value: "5433"},
+	})
+	if err == nil {
+		t.Error("expected an error for two parameters with the same dotenv name")
+	}
+
+	if err := Encode(&bytes.Buffer{}, "toml", testTree); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestDecodeHandWritten(t *testing.T) {
+	tests := []struct {
+		format, text string
+		want         []Entry
+	}{
+		{FormatYAML, "# dev settings\n---\ndb/port:\n  type: String\n  value: 5432 # the default\nhosts:\n  type: StringList\n  value: 'web-1,web-''2'''\n",
+			[]Entry{
+				{Name: "db/port", Type: types.ParameterTypeString, Value: "5432"},
+				{Name: "hosts", Type: types.ParameterTypeStringList, Value: "web-1,web-'2'"},
+			}},
+		{FormatDotenv, "# Settings for dev\n\nexport DB_PORT=5432 # the default\nREGION='us-west-2'\n# db/user SecureString\nDB_USER=\"admin\"\n",
+			[]Entry{
+				{Name: "db/user", Type: types.ParameterTypeSecureString, Value: "admin"},
+				{Name: "db_port", Type: types.ParameterTypeString, Value: "5432"},
+				{Name: "region", Type: types.ParameterTypeString, Value: "us-west-2"},
+			}},
+	}
+
+	for _, test := range tests {
+		got, err := Decode(strings.NewReader(test.text), test.format)
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+
+		if !equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.format, got, test.want)
+		}
+	}
+
+	invalid := []struct{ format, text string }{
+		{FormatJSON, `{"/db/port":{"Type":"String","Value":"5432"}}`},
+		{FormatJSON, `{"db/port":{"Type":"Integer","Value":"5432"}}`},
+		{FormatJSON, `[]`},
+		{FormatYAML, "  type: String\n"},
+		{FormatYAML, "db/port:\n  kind: String\n"},
+		{FormatYAML, "db/port:\n  value: \"5432\n"},
+		{FormatYAML, "db/port:\n  type: String\n  value: 5432\ndb/port:\n  type: String\n  value: 5433\n"},
+		{FormatDotenv, "DB_PORT\n"},
+		{FormatDotenv, "DB_PORT=\"5432\n"},
+	}
+
+	for _, test := range invalid {
+		_, err := Decode(strings.NewReader(test.text), test.format)
+		if err == nil {
+			t.Errorf("%s: expected an error for %q", test.format, test.text)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	current := []Entry{
+		{Name: "db/host", Type: types.ParameterTypeString, Value: "db.prod.example.com"},
+		{Name: "db/password", Type: types.ParameterTypeString, Value: "hunter2"},
+		{Name: "db/port", Type: types.ParameterTypeString, Value: "5432"},
+		{Name: "legacy", Type: types.ParameterTypeString, Value: "true"},
+	}
+
+	changes := Diff(current, testTree, false)
+
+	want := []string{
+		`~ db/host (String) = "db.prod.example.com" -> "db.dev.example.com"`,
+		"~ db/password (String -> SecureString) = \"hunter2\" -> (secret)",
+		`+ greeting (String) = "Hello,\n'world'\t\\ ü"`,
+		`+ hosts (StringList) = "web-1,web-2"`,
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("got %v, want %v", changes, want)
+	}
+
+	for i, change := range changes {
+		if change.String() != want[i] {
+			t.Errorf("got %s, want %s", change, want[i])
+		}
+	}
+
+	changes = Diff(current, testTree, true)
+	if last := changes[len(changes)-1]; len(changes) != 5 || last.Kind != ChangeDelete || last.Name != "legacy" || last.String() != "- legacy (String)" {
+		t.Errorf("got %v", changes)
+	}
+
+	if changes := Diff(testTree, testTree, true); len(changes) != 0 {
+		t.Errorf("got %v, want no changes", changes)
+	}
+}
+
+func TestApply(t *testing.T) {
+	api := ssmfake.New()
+	ctx := context.Background()
+
+	putEntries(t, api, "/doc-example/dev", testTree)
+	putEntries(t, api, "/doc-example/prod", []Entry{
+		{Name: "db/host", Type: types.ParameterTypeString, Value: "db.prod.example.com"},
+		{Name: "hosts", Type: types.ParameterTypeString, Value: "web-1"},
+		{Name: "legacy", Type: types.ParameterTypeString, Value: "true"},
+	})
+
+	dev, err := ReadTree(ctx, api, "/doc-example/dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err := ReadTree(ctx, api, "/doc-example/prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy dev to prod, changing the type of hosts and deleting legacy
+	changes := Diff(prod, dev, true)
+	if len(changes) != 6 {
+		t.Fatalf("got %v", changes)
+	}
+
+	err = Apply(ctx, api, "/doc-example/prod", changes, "alias/doc-example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err = ReadTree(ctx, api, "/doc-example/prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equal(prod, dev) {
+		t.Errorf("got %v, want %v", prod, dev)
+	}
+
+	got, err := api.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String("/doc-example/prod/db/host")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Parameter.Version != 2 {
+		t.Errorf("got version %d, want 2 after overwriting the host", got.Parameter.Version)
+	}
+}
+
+// rejectSecureString is Parameter Store with a KMS key that can't be used
+type rejectSecureString struct {
+	*ssmfake.Service
+}
+
+func (r rejectSecureString) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	if params.Type == types.ParameterTypeSecureString {
+		return nil, &types.InvalidKeyId{Message: aws.String("the key can't be used")}
+	}
+
+	return r.Service.PutParameter(ctx, params, optFns...)
+}
+
+func TestApplyTypeChange(t *testing.T) {
+	api := ssmfake.New()
+	ctx := context.Background()
+
+	old := []Entry{{Name: "db/password", Type: types.ParameterTypeString, Value: "hunter2"}}
+	putEntries(t, api, "/doc-example/prod", old)
+
+	// The type change is rejected, so the parameter is re-created, which fails too
+	changes := Diff(old, testTree[1:2], false)
+
+	err := Apply(ctx, rejectSecureString{api}, "/doc-example/prod", changes, "")
+	if err == nil {
+		t.Fatal("expected an error for a parameter that can't be re-created")
+	}
+
+	var invalid *types.InvalidKeyId
+	if !errors.As(err, &invalid) {
+		t.Errorf("got %v, want the error from re-creating the parameter", err)
+	}
+
+	// The old value is back
+	prod, err := ReadTree(ctx, api, "/doc-example/prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equal(prod, old) {
+		t.Errorf("got %v, want the old value", prod)
+	}
+}
+
+func TestParameterTreeLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	client := ssm.NewFromConfig(server.Config())
+	ctx := context.Background()
+
+	putEntries(t, client, "/doc-example/dev", testTree)
+
+	dev, err := ReadTree(ctx, client, "/doc-example/dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = Encode(&buf, FormatYAML, dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := Decode(&buf, FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Apply(ctx, client, "/doc-example/staging", Diff(nil, imported, false), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staging, err := ReadTree(ctx, client, "/doc-example/staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equal(staging, testTree) {
+		t.Errorf("got %v, want %v", staging, testTree)
+	}
+}
@@ -36,6 +36,8 @@ func AddStringParameter(c context.Context, api SSMPutParameterAPI, input *ssm.Pu
 func main() {
 	parameterName := flag.String("n", "", "The name of the parameter")
 	parameterValue := flag.String("v", "", "The value of the parameter")
+	parameterType := flag.String("t", "String", "The type of the parameter: String, StringList, or SecureString")
+	keyID := flag.String("k", "", "The ID of the AWS KMS key that encrypts a SecureString parameter. The default is the AWS managed key")
 	flag.Parse()
 
 	if *parameterName == "" {
@@ -50,6 +52,15 @@ func main() {
 		return
 	}
 
+	kind := types.ParameterType(*parameterType)
+	switch kind {
+	case types.ParameterTypeString, types.ParameterTypeStringList, types.ParameterTypeSecureString:
+	default:
+		fmt.Println("The type must be String, StringList, or SecureString")
+		fmt.Println("-t TYPE")
+		return
+	}
+
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		panic("configuration error, " + err.Error())
@@ -60,7 +71,11 @@ func main() {
 	input := &ssm.PutParameterInput{
 		Name:  parameterName,
 		Value: parameterValue,
-		Type:  types.ParameterTypeString,
+		Type:  kind,
+	}
+
+	if kind == types.ParameterTypeSecureString && *keyID != "" {
+		input.KeyId = keyID
 	}
 
 	results, err := AddStringParameter(context.TODO(), client, input)
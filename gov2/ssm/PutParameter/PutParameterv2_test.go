@@ -8,8 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
 )
 
 type SSMPutParameterImpl struct{}
@@ -82,3 +84,41 @@ func TestPutParameter(t *testing.T) {
 
 	t.Log("Parameter version:", resp.Version)
 }
+
+func TestAddStringParameterLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	client := ssm.NewFromConfig(server.Config())
+
+	input := &ssm.PutParameterInput{
+		Name:  aws.String("doc-example-parameter"),
+		Value: aws.String("doc-example-value"),
+		Type:  types.ParameterTypeString,
+	}
+
+	results, err := AddStringParameter(context.Background(), client, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results.Version != 1 {
+		t.Errorf("Expected version 1, got %d", results.Version)
+	}
+
+	// Adding it again without Overwrite fails
+	_, err = AddStringParameter(context.Background(), client, input)
+	var exists *types.ParameterAlreadyExists
+	if !errors.As(err, &exists) {
+		t.Errorf("Expected ParameterAlreadyExists, got %v", err)
+	}
+
+	got, err := server.SSM.GetParameter(context.Background(), &ssm.GetParameterInput{Name: input.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *got.Parameter.Value != "doc-example-value" {
+		t.Errorf("Expected doc-example-value, got %v", *got.Parameter.Value)
+	}
+}
@@ -4,12 +4,20 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
 )
 
 // STSAssumeRoleAPI defines the interface for the AssumeRole function.
@@ -32,13 +40,271 @@ func TakeRole(c context.Context, api STSAssumeRoleAPI, input *sts.AssumeRoleInpu
 	return api.AssumeRole(c, input)
 }
 
+// DefaultExpiryWindow is how long before the credentials expire that a RoleProvider gets new ones.
+const DefaultExpiryWindow = 5 * time.Minute
+
+// Role is one role that a RoleProvider assumes.
+type Role struct {
+	// ARN is the Amazon Resource Name (ARN) of the role.
+	ARN string
+
+	// ExternalID, if set, is the external ID that the role's trust policy requires.
+	ExternalID string
+}
+
+// RoleOptions configures a RoleProvider.
+type RoleOptions struct {
+	// Roles are the roles to assume, in order. Each role after the first is assumed
+	// with the credentials of the one before it, which is called role chaining.
+	Roles []Role
+
+	// SessionName is the name of each role session.
+	SessionName string
+
+	// Duration is how long the credentials of the last role last. The default is one hour.
+	// AWS STS limits the sessions of a chain of roles to one hour.
+	Duration time.Duration
+
+	// MFASerial, if set, is the serial number or ARN of the MFA device
+	// to authenticate with when assuming the first role.
+	MFASerial string
+
+	// TokenProvider returns the current code of the MFA device.
+	// It's called each time the first role is assumed, so each refresh needs a new code.
+	TokenProvider func() (string, error)
+
+	// Tags are the session tags of the first role session.
+	// The keys in TransitiveTagKeys are passed on to the sessions of the roles after it.
+	Tags              map[string]string
+	TransitiveTagKeys []string
+
+	// ExpiryWindow is how long before the credentials expire that the provider gets new ones.
+	// The default is DefaultExpiryWindow.
+	ExpiryWindow time.Duration
+}
+
+// RoleProvider is an aws.CredentialsProvider that assumes a role, or a chain of roles,
+// and caches the credentials until shortly before they expire.
+// It's safe for concurrent use.
+type RoleProvider struct {
+	// Now returns the current time. Replace it to control the refreshes in tests.
+	Now func() time.Time
+
+	opts      RoleOptions
+	newClient func(credentials aws.CredentialsProvider) STSAssumeRoleAPI
+
+	mu          sync.Mutex
+	credentials *aws.Credentials
+}
+
+// NewRoleProvider creates a provider of the credentials of the roles in opts.
+// It assumes the first role with the credentials in cfg,
+// so any client that uses the provider's credentials runs as the last role.
+// Inputs:
+//     cfg is the configuration of the AWS STS clients, which includes the AWS Region and the credentials to start with.
+//     opts describes the roles, and how to assume them.
+// Output:
+//     The provider. It doesn't assume a role until its Retrieve method is called.
+func NewRoleProvider(cfg aws.Config, opts RoleOptions) *RoleProvider {
+	return newRoleProvider(opts, func(credentials aws.CredentialsProvider) STSAssumeRoleAPI {
+		hop := cfg.Copy()
+		if credentials != nil {
+			hop.Credentials = credentials
+		}
+
+		return sts.NewFromConfig(hop)
+	})
+}
+
+// newRoleProvider creates a provider that gets its AWS STS clients from newClient.
+// newClient is called with nil for the client of the first role.
+func newRoleProvider(opts RoleOptions, newClient func(credentials aws.CredentialsProvider) STSAssumeRoleAPI) *RoleProvider {
+	if opts.ExpiryWindow <= 0 {
+		opts.ExpiryWindow = DefaultExpiryWindow
+	}
+
+	return &RoleProvider{
+		Now:       time.Now,
+		opts:      opts,
+		newClient: newClient,
+	}
+}
+
+// Retrieve returns the credentials of the last role, assuming the roles again
+// if the cached credentials are within the expiry window of expiring.
+// The credentials' Expires time is the start of the expiry window,
+// so that an aws.CredentialsCache wrapped around the provider also refreshes them early.
+func (p *RoleProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.credentials != nil && p.Now().Before(p.credentials.Expires) {
+		return *p.credentials, nil
+	}
+
+	credentials, err := p.assumeRoles(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	p.credentials = &credentials
+
+	return credentials, nil
+}
+
+// Invalidate discards the cached credentials, so that the next call to Retrieve assumes the roles again.
+func (p *RoleProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.credentials = nil
+}
+
+// assumeRoles assumes each role in turn, with the credentials of the one before it.
+func (p *RoleProvider) assumeRoles(ctx context.Context) (aws.Credentials, error) {
+	if len(p.opts.Roles) == 0 {
+		return aws.Credentials{}, errors.New("there are no roles to assume")
+	}
+
+	var credentials aws.CredentialsProvider
+	var result aws.Credentials
+
+	for i, role := range p.opts.Roles {
+		input, err := p.input(i, role)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+
+		output, err := TakeRole(ctx, p.newClient(credentials), input)
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("assume role %s: %w", role.ARN, err)
+		}
+
+		result = aws.Credentials{
+			AccessKeyID:     aws.ToString(output.Credentials.AccessKeyId),
+			SecretAccessKey: aws.ToString(output.Credentials.SecretAccessKey),
+			SessionToken:    aws.ToString(output.Credentials.SessionToken),
+			Source:          "RoleProvider",
+			CanExpire:       true,
+			Expires:         aws.ToTime(output.Credentials.Expiration).Add(-p.opts.ExpiryWindow),
+		}
+
+		hop := result
+		credentials = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return hop, nil
+		})
+	}
+
+	return result, nil
+}
+
+// input returns the AssumeRole input for role i of the chain.
+func (p *RoleProvider) input(i int, role Role) (*sts.AssumeRoleInput, error) {
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(role.ARN),
+		RoleSessionName: aws.String(p.opts.SessionName),
+	}
+
+	if role.ExternalID != "" {
+		input.ExternalId = aws.String(role.ExternalID)
+	}
+
+	if i == len(p.opts.Roles)-1 && p.opts.Duration > 0 {
+		input.DurationSeconds = aws.Int32(int32(p.opts.Duration / time.Second))
+	}
+
+	if i > 0 {
+		return input, nil
+	}
+
+	if p.opts.MFASerial != "" {
+		if p.opts.TokenProvider == nil {
+			return nil, errors.New("the role needs an MFA code, and there is no token provider")
+		}
+
+		code, err := p.opts.TokenProvider()
+		if err != nil {
+			return nil, fmt.Errorf("get MFA code: %w", err)
+		}
+
+		input.SerialNumber = aws.String(p.opts.MFASerial)
+		input.TokenCode = aws.String(code)
+	}
+
+	for key, value := range p.opts.Tags {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	input.TransitiveTagKeys = p.opts.TransitiveTagKeys
+
+	return input, nil
+}
+
+// roleFlags collects -r flags of the form ROLE-ARN or ROLE-ARN=EXTERNAL-ID.
+type roleFlags []Role
+
+func (r *roleFlags) String() string {
+	arns := make([]string, len(*r))
+	for i, role := range *r {
+		arns[i] = role.ARN
+	}
+
+	return strings.Join(arns, ",")
+}
+
+func (r *roleFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if parts[0] == "" {
+		return errors.New("the role ARN is empty")
+	}
+
+	role := Role{ARN: parts[0]}
+	if len(parts) == 2 {
+		role.ExternalID = parts[1]
+	}
+
+	*r = append(*r, role)
+
+	return nil
+}
+
+// tagFlags collects -t flags of the form KEY=VALUE.
+type tagFlags map[string]string
+
+func (t tagFlags) String() string {
+	var tags []string
+	for key, value := range t {
+		tags = append(tags, key+"="+value)
+	}
+
+	return strings.Join(tags, ",")
+}
+
+func (t tagFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("a tag must be KEY=VALUE")
+	}
+
+	t[parts[0]] = parts[1]
+
+	return nil
+}
+
 func main() {
-	roleARN := flag.String("r", "", "The Amazon Resource Name (ARN) of the role to assume")
+	var roles roleFlags
+	tags := tagFlags{}
+	flag.Var(&roles, "r", "The Amazon Resource Name (ARN) of the role to assume, as ROLE-ARN or ROLE-ARN=EXTERNAL-ID. Repeat it to chain roles")
 	sessionName := flag.String("s", "", "The name of the session")
+	duration := flag.Duration("d", 0, "How long the credentials last, such as 1h. The default is one hour")
+	mfaSerial := flag.String("m", "", "The serial number or ARN of your MFA device, if the first role requires MFA")
+	flag.Var(tags, "t", "A session tag, as KEY=VALUE. Can be repeated")
+	transitive := flag.Bool("transitive", false, "Whether to pass the session tags on to the roles of a chain")
+	flag.Parse()
 
-	if *roleARN == "" || *sessionName == "" {
+	if len(roles) == 0 || *sessionName == "" {
 		fmt.Println("You must supply a role ARN and session name")
-		fmt.Println("-r ROLE-ARN -s SESSION-NAME")
+		fmt.Println("-r ROLE-ARN[=EXTERNAL-ID] [-r ROLE-ARN[=EXTERNAL-ID] ...] -s SESSION-NAME [-d DURATION] [-m MFA-SERIAL] [-t KEY=VALUE ...] [-transitive]")
 		return
 	}
 
@@ -47,21 +313,41 @@ func main() {
 		panic("configuration error, " + err.Error())
 	}
 
-	client := sts.NewFromConfig(cfg)
+	opts := RoleOptions{
+		Roles:       roles,
+		SessionName: *sessionName,
+		Duration:    *duration,
+		MFASerial:   *mfaSerial,
+		Tags:        tags,
+		TokenProvider: func() (string, error) {
+			fmt.Print("MFA code: ")
+			code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			return strings.TrimSpace(code), err
+		},
+	}
 
-	input := &sts.AssumeRoleInput{
-		RoleArn:         roleARN,
-		RoleSessionName: sessionName,
+	if *transitive {
+		for key := range tags {
+			opts.TransitiveTagKeys = append(opts.TransitiveTagKeys, key)
+		}
 	}
 
-	result, err := TakeRole(context.TODO(), client, input)
+	// Any client created from this configuration runs as the last role
+	roleCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithCredentialsProvider(NewRoleProvider(cfg, opts)))
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	client := sts.NewFromConfig(roleCfg)
+
+	identity, err := client.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
 	if err != nil {
 		fmt.Println("Got an error assuming the role:")
 		fmt.Println(err)
 		return
 	}
 
-	fmt.Println(result.AssumedRoleUser)
+	fmt.Println("Running as " + aws.ToString(identity.Arn))
 }
 
 // snippet-end:[sts.go-v2.AssumeRole]
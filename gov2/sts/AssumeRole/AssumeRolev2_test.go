@@ -6,12 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/stsfake"
 )
 
 type STSAssumeRoleImpl struct{}
@@ -89,3 +92,243 @@ func TestAssumeRole(t *testing.T) {
 	t.Log("User ARN:      " + *resp.AssumedRoleUser.Arn)
 	t.Log("User role ID:  " + *resp.AssumedRoleUser.AssumedRoleId)
 }
+
+const (
+	testRole      = "arn:aws:iam::111122223333:role/aws-docs-example-role"
+	testChainRole = "arn:aws:iam::444455556666:role/aws-docs-example-partner"
+	testMFASerial = "arn:aws:iam::123456789012:mfa/aws-docs-example-user"
+)
+
+// fakeProvider returns a provider whose AWS STS clients are all the fake,
+// and records the credentials that each client would use
+func fakeProvider(api *stsfake.Service, opts RoleOptions, used *[]aws.CredentialsProvider) *RoleProvider {
+	p := newRoleProvider(opts, func(credentials aws.CredentialsProvider) STSAssumeRoleAPI {
+		if used != nil {
+			*used = append(*used, credentials)
+		}
+
+		return api
+	})
+	p.Now = api.Now
+
+	return p
+}
+
+func TestRoleProviderRefresh(t *testing.T) {
+	now := time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+	api := stsfake.New()
+	api.Now = func() time.Time { return now }
+
+	p := fakeProvider(api, RoleOptions{
+		Roles:       []Role{{ARN: testRole}},
+		SessionName: "aws-docs-example-session",
+		Duration:    30 * time.Minute,
+	}, nil)
+
+	first, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !first.CanExpire || !first.Expires.Equal(now.Add(25*time.Minute)) || first.SessionToken == "" {
+		t.Errorf("got %+v, want credentials that expire in 25 minutes", first)
+	}
+
+	// The credentials are cached until the expiry window starts
+	now = now.Add(24 * time.Minute)
+
+	cached, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cached != first || len(api.Sessions()) != 1 {
+		t.Errorf("got %d sessions, want the cached credentials", len(api.Sessions()))
+	}
+
+	now = now.Add(time.Minute)
+
+	refreshed, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshed.AccessKeyID == first.AccessKeyID || len(api.Sessions()) != 2 {
+		t.Errorf("got %d sessions, want new credentials", len(api.Sessions()))
+	}
+
+	p.Invalidate()
+
+	_, err = p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.Sessions()) != 3 {
+		t.Errorf("got %d sessions, want new credentials after Invalidate", len(api.Sessions()))
+	}
+}
+
+func TestRoleProviderConcurrent(t *testing.T) {
+	api := stsfake.New()
+	p := fakeProvider(api, RoleOptions{Roles: []Role{{ARN: testRole}}, SessionName: "aws-docs-example-session"}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := p.Retrieve(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := len(api.Sessions()); n != 1 {
+		t.Errorf("got %d sessions, want 1", n)
+	}
+}
+
+func TestRoleProviderChain(t *testing.T) {
+	api := stsfake.New()
+	api.AddRole(testRole, stsfake.Role{MFASerial: testMFASerial, MFACode: "123456"})
+	api.AddRole(testChainRole, stsfake.Role{ExternalID: "aws-docs-example-id"})
+
+	codes := 0
+	var used []aws.CredentialsProvider
+
+	p := fakeProvider(api, RoleOptions{
+		Roles:       []Role{{ARN: testRole}, {ARN: testChainRole, ExternalID: "aws-docs-example-id"}},
+		SessionName: "aws-docs-example-session",
+		Duration:    15 * time.Minute,
+		MFASerial:   testMFASerial,
+		TokenProvider: func() (string, error) {
+			codes++
+			return "123456", nil
+		},
+		Tags:              map[string]string{"project": "docs", "team": "sdk"},
+		TransitiveTagKeys: []string{"project"},
+	}, &used)
+
+	credentials, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := api.Sessions()
+	if len(sessions) != 2 || sessions[0].RoleArn != testRole || sessions[1].RoleArn != testChainRole {
+		t.Fatalf("got sessions %+v", sessions)
+	}
+
+	if sessions[0].Tags["team"] != "sdk" || len(sessions[1].Tags) != 0 || sessions[1].ExternalID != "aws-docs-example-id" {
+		t.Errorf("got sessions %+v", sessions)
+	}
+
+	if credentials.AccessKeyID != sessions[1].AccessKeyID || codes != 1 {
+		t.Errorf("got %s after %d MFA codes, want the credentials of the last role", credentials.AccessKeyID, codes)
+	}
+
+	// The first role uses the base credentials, and the second one the credentials of the first
+	if len(used) != 2 || used[0] != nil {
+		t.Fatalf("got %d clients", len(used))
+	}
+
+	hop, err := used[1].Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hop.AccessKeyID != sessions[0].AccessKeyID {
+		t.Errorf("the second role was assumed with %s, want %s", hop.AccessKeyID, sessions[0].AccessKeyID)
+	}
+
+	// Only the last role gets the requested duration
+	if d := sessions[1].Expiration.Sub(sessions[0].Expiration); d > -44*time.Minute {
+		t.Errorf("got expirations %v and %v", sessions[0].Expiration, sessions[1].Expiration)
+	}
+}
+
+func TestRoleProviderErrors(t *testing.T) {
+	api := stsfake.New()
+	api.AddRole(testChainRole, stsfake.Role{ExternalID: "aws-docs-example-id"})
+
+	errNoCode := errors.New("no code")
+
+	tests := []RoleOptions{
+		{SessionName: "aws-docs-example-session"},
+		{Roles: []Role{{ARN: testChainRole}}, SessionName: "aws-docs-example-session"},
+		{Roles: []Role{{ARN: testRole}}, SessionName: "aws-docs-example-session", MFASerial: testMFASerial},
+		{Roles: []Role{{ARN: testRole}}, SessionName: "aws-docs-example-session", MFASerial: testMFASerial,
+			TokenProvider: func() (string, error) { return "", errNoCode }},
+	}
+
+	for i, opts := range tests {
+		_, err := fakeProvider(api, opts, nil).Retrieve(context.Background())
+		if err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+
+		if i == 3 && !errors.Is(err, errNoCode) {
+			t.Errorf("got %v, want the token provider's error", err)
+		}
+	}
+}
+
+func TestRoleProviderLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	p := NewRoleProvider(server.Config(), RoleOptions{
+		Roles:       []Role{{ARN: testRole}, {ARN: testChainRole}},
+		SessionName: "aws-docs-example-session",
+	})
+
+	cfg := server.Config()
+	cfg.Credentials = aws.NewCredentialsCache(p)
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "arn:aws:sts::444455556666:assumed-role/aws-docs-example-partner/aws-docs-example-session"; aws.ToString(identity.Arn) != want {
+		t.Errorf("got %s, want %s", aws.ToString(identity.Arn), want)
+	}
+
+	sessions := server.STS.Sessions()
+	if len(sessions) != 2 || sessions[0].CallerAccessKeyID != localaws.AccessKeyID ||
+		sessions[1].CallerAccessKeyID != sessions[0].AccessKeyID {
+		t.Errorf("got sessions %+v", sessions)
+	}
+}
+
+func TestRoleFlags(t *testing.T) {
+	var roles roleFlags
+	for _, value := range []string{testRole, testChainRole + "=aws-docs-example-id"} {
+		if err := roles.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(roles) != 2 || roles[0] != (Role{ARN: testRole}) ||
+		roles[1] != (Role{ARN: testChainRole, ExternalID: "aws-docs-example-id"}) {
+		t.Errorf("got %+v", roles)
+	}
+
+	if err := roles.Set("=aws-docs-example-id"); err == nil {
+		t.Error("expected an error for an empty role ARN")
+	}
+
+	tags := tagFlags{}
+	if err := tags.Set("project=docs=v2"); err != nil || tags["project"] != "docs=v2" {
+		t.Errorf("got %v, %v", tags, err)
+	}
+
+	if err := tags.Set("project"); err == nil {
+		t.Error("expected an error for a tag without a value")
+	}
+}
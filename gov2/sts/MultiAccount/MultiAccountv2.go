@@ -0,0 +1,375 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+// snippet-start:[sts.go-v2.MultiAccount]
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// STSAssumeRoleAPI defines the interface for the AssumeRole function.
+// We use this interface to test the function using a mocked service.
+type STSAssumeRoleAPI interface {
+	AssumeRole(ctx context.Context,
+		params *sts.AssumeRoleInput,
+		optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+}
+
+// Account is one account to run a check in, and the role to assume there.
+type Account struct {
+	// ID is the 12-digit account ID, taken from the role ARN.
+	ID string `json:"account"`
+
+	// RoleARN is the Amazon Resource Name (ARN) of the role to assume.
+	RoleARN string `json:"roleArn"`
+
+	// ExternalID, if set, is the external ID that the role's trust policy requires.
+	ExternalID string `json:"-"`
+}
+
+// ParseAccount parses an account from ROLE-ARN or ROLE-ARN=EXTERNAL-ID.
+func ParseAccount(value string) (Account, error) {
+	parts := strings.SplitN(value, "=", 2)
+
+	// arn:PARTITION:iam::ACCOUNT:role/NAME
+	fields := strings.SplitN(parts[0], ":", 6)
+	if len(fields) != 6 || fields[0] != "arn" || fields[2] != "iam" || len(fields[4]) != 12 || !strings.HasPrefix(fields[5], "role/") {
+		return Account{}, fmt.Errorf("%q is not a role ARN", parts[0])
+	}
+
+	account := Account{ID: fields[4], RoleARN: parts[0]}
+	if len(parts) == 2 {
+		account.ExternalID = parts[1]
+	}
+
+	return account, nil
+}
+
+// ReadAccounts reads an accounts file, which has one ROLE-ARN or ROLE-ARN=EXTERNAL-ID per line.
+// Blank lines, and lines that start with #, are skipped.
+// Inputs:
+//     r is the file to read.
+// Output:
+//     If successful, the accounts, in file order, and nil.
+//     Otherwise, nil and an error that names the line that isn't valid.
+func ReadAccounts(r io.Reader) ([]Account, error) {
+	var accounts []Account
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		account, err := ParseAccount(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		if seen[account.RoleARN] {
+			return nil, fmt.Errorf("line %d: %s is listed twice", n, account.RoleARN)
+		}
+
+		seen[account.RoleARN] = true
+		accounts = append(accounts, account)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// AccountFunc runs a check in one account.
+// cfg has the credentials of the account's role, and the AWS Region of the base configuration.
+// The result must be encodable as JSON.
+type AccountFunc func(ctx context.Context, account Account, cfg aws.Config) (interface{}, error)
+
+// RunOptions configures RunAccounts. Zero values select the defaults.
+type RunOptions struct {
+	// SessionName is the name of each role session. The default is "multi-account".
+	SessionName string
+
+	// Concurrency is the most accounts checked at once. The default is 5.
+	Concurrency int
+}
+
+// AccountResult is the outcome of a check in one account.
+// Exactly one of Result and Error is set.
+type AccountResult struct {
+	Account string      `json:"account"`
+	RoleARN string      `json:"roleArn"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// Report merges the outcomes of a check in every account.
+type Report struct {
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Accounts  []AccountResult `json:"accounts"`
+}
+
+// RunAccounts assumes the role in each account and runs fn with its credentials.
+// Inputs:
+//     c is the context of the method call, which includes the AWS Region.
+//     cfg is the configuration that the per-account configurations are copied from.
+//     api is the interface that defines the method call. Its credentials must be allowed to assume each role.
+//     accounts are the accounts to run fn in.
+//     opts configures the run.
+//     fn is the check to run.
+// Output:
+//     The report, with one result per account in the order of accounts.
+//     A failure to assume a role, or an error from fn, is recorded as that account's error,
+//     and doesn't stop the other accounts.
+func RunAccounts(c context.Context, cfg aws.Config, api STSAssumeRoleAPI, accounts []Account, opts RunOptions, fn AccountFunc) *Report {
+	if opts.SessionName == "" {
+		opts.SessionName = "multi-account"
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 5
+	}
+
+	report := &Report{Accounts: make([]AccountResult, len(accounts))}
+
+	// slots holds one token for each account that can be checked now
+	slots := make(chan struct{}, opts.Concurrency)
+
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		wg.Add(1)
+
+		go func(i int, account Account) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			result := AccountResult{Account: account.ID, RoleARN: account.RoleARN}
+
+			value, err := runAccount(c, cfg, api, account, opts, fn)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Result = value
+			}
+
+			report.Accounts[i] = result
+		}(i, account)
+	}
+
+	wg.Wait()
+
+	for _, result := range report.Accounts {
+		if result.Error != "" {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+
+	return report
+}
+
+// runAccount assumes the account's role and runs fn with its credentials.
+func runAccount(c context.Context, cfg aws.Config, api STSAssumeRoleAPI, account Account, opts RunOptions, fn AccountFunc) (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(account.RoleARN),
+		RoleSessionName: aws.String(opts.SessionName),
+	}
+
+	if account.ExternalID != "" {
+		input.ExternalId = aws.String(account.ExternalID)
+	}
+
+	output, err := api.AssumeRole(c, input)
+	if err != nil {
+		return nil, fmt.Errorf("assume role: %w", err)
+	}
+
+	credentials := aws.Credentials{
+		AccessKeyID:     aws.ToString(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(output.Credentials.SessionToken),
+		Source:          "RunAccounts",
+		CanExpire:       true,
+		Expires:         aws.ToTime(output.Credentials.Expiration),
+	}
+
+	accountCfg := cfg.Copy()
+	accountCfg.Credentials = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return credentials, nil
+	})
+
+	return fn(c, account, accountCfg)
+}
+
+// checks are the read-only checks that the example can run. Each returns a list of names or IDs.
+var checks = map[string]AccountFunc{
+	"ListUsers": func(ctx context.Context, account Account, cfg aws.Config) (interface{}, error) {
+		client := iam.NewFromConfig(cfg)
+		input := &iam.ListUsersInput{}
+		names := []string{}
+
+		for {
+			output, err := client.ListUsers(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, user := range output.Users {
+				names = append(names, aws.ToString(user.UserName))
+			}
+
+			if !output.IsTruncated {
+				return names, nil
+			}
+
+			input.Marker = output.Marker
+		}
+	},
+
+	"ListBuckets": func(ctx context.Context, account Account, cfg aws.Config) (interface{}, error) {
+		output, err := s3.NewFromConfig(cfg).ListBuckets(ctx, &s3.ListBucketsInput{})
+		if err != nil {
+			return nil, err
+		}
+
+		names := []string{}
+		for _, bucket := range output.Buckets {
+			names = append(names, aws.ToString(bucket.Name))
+		}
+
+		return names, nil
+	},
+
+	"DescribeInstances": func(ctx context.Context, account Account, cfg aws.Config) (interface{}, error) {
+		client := ec2.NewFromConfig(cfg)
+		input := &ec2.DescribeInstancesInput{}
+		ids := []string{}
+
+		for {
+			output, err := client.DescribeInstances(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, reservation := range output.Reservations {
+				for _, instance := range reservation.Instances {
+					ids = append(ids, aws.ToString(instance.InstanceId))
+				}
+			}
+
+			if output.NextToken == nil {
+				sort.Strings(ids)
+				return ids, nil
+			}
+
+			input.NextToken = output.NextToken
+		}
+	},
+}
+
+func checkNames() string {
+	var names []string
+	for name := range checks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+func main() {
+	accountsFile := flag.String("f", "", "The accounts file, with one ROLE-ARN or ROLE-ARN=EXTERNAL-ID per line")
+	check := flag.String("c", "", "The check to run in each account: "+checkNames())
+	concurrency := flag.Int("n", 5, "The most accounts to check at once")
+	sessionName := flag.String("s", "multi-account", "The name of each role session")
+	outFile := flag.String("o", "", "The file to write the report to. The default is standard output")
+	flag.Parse()
+
+	fn, ok := checks[*check]
+	if *accountsFile == "" || !ok {
+		fmt.Println("You must supply an accounts file and one of these checks: " + checkNames())
+		fmt.Println("-f ACCOUNTS-FILE -c CHECK [-n CONCURRENCY] [-s SESSION-NAME] [-o REPORT-FILE]")
+		return
+	}
+
+	f, err := os.Open(*accountsFile)
+	if err != nil {
+		fmt.Println("Got an error opening the accounts file:")
+		fmt.Println(err)
+		return
+	}
+
+	accounts, err := ReadAccounts(f)
+	f.Close()
+	if err != nil {
+		fmt.Println("Got an error reading the accounts file:")
+		fmt.Println(err)
+		return
+	}
+
+	if len(accounts) == 0 {
+		fmt.Println("The accounts file lists no roles")
+		return
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		panic("configuration error, " + err.Error())
+	}
+
+	report := RunAccounts(context.TODO(), cfg, sts.NewFromConfig(cfg), accounts, RunOptions{
+		SessionName: *sessionName,
+		Concurrency: *concurrency,
+	}, fn)
+
+	out := os.Stdout
+	if *outFile != "" {
+		out, err = os.Create(*outFile)
+		if err != nil {
+			fmt.Println("Got an error creating the report file:")
+			fmt.Println(err)
+			return
+		}
+		defer out.Close()
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fmt.Println("Got an error writing the report:")
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked %d accounts: %d succeeded, %d failed\n", len(accounts), report.Succeeded, report.Failed)
+}
+
+// snippet-end:[sts.go-v2.MultiAccount]
@@ -0,0 +1,195 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX - License - Identifier: Apache - 2.0
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/localaws"
+	"github.com/awsdocs/aws-doc-sdk-examples/gov2/internal/stsfake"
+)
+
+func testAccounts(n int) []Account {
+	accounts := make([]Account, n)
+	for i := range accounts {
+		id := fmt.Sprintf("%012d", 100000000000+i)
+		accounts[i] = Account{ID: id, RoleARN: "arn:aws:iam::" + id + ":role/aws-docs-example-audit"}
+	}
+
+	return accounts
+}
+
+func TestReadAccounts(t *testing.T) {
+	accounts, err := ReadAccounts(strings.NewReader(`
+# Production
+arn:aws:iam::111122223333:role/aws-docs-example-audit
+arn:aws:iam::444455556666:role/path/aws-docs-example-audit=aws-docs-example-id
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Account{
+		{ID: "111122223333", RoleARN: "arn:aws:iam::111122223333:role/aws-docs-example-audit"},
+		{ID: "444455556666", RoleARN: "arn:aws:iam::444455556666:role/path/aws-docs-example-audit", ExternalID: "aws-docs-example-id"},
+	}
+
+	if len(accounts) != len(want) || accounts[0] != want[0] || accounts[1] != want[1] {
+		t.Errorf("got %+v, want %+v", accounts, want)
+	}
+
+	for _, file := range []string{
+		"arn:aws:iam::111122223333:user/aws-docs-example-user",
+		"arn:aws:iam::1111:role/aws-docs-example-audit",
+		"arn:aws:iam::111122223333:role/a\narn:aws:iam::111122223333:role/a",
+	} {
+		if _, err := ReadAccounts(strings.NewReader(file)); err == nil {
+			t.Errorf("expected an error for %q", file)
+		}
+	}
+}
+
+func TestRunAccounts(t *testing.T) {
+	api := stsfake.New()
+	accounts := testAccounts(12)
+
+	// The last account requires an external ID that the accounts file doesn't have
+	api.AddRole(accounts[11].RoleARN, stsfake.Role{ExternalID: "aws-docs-example-id"})
+
+	var mu sync.Mutex
+	running, most := 0, 0
+	errCheck := errors.New("check failed")
+
+	report := RunAccounts(context.Background(), aws.Config{Region: "us-west-2"}, api, accounts, RunOptions{Concurrency: 3},
+		func(ctx context.Context, account Account, cfg aws.Config) (interface{}, error) {
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			if account.ID == accounts[10].ID {
+				return nil, errCheck
+			}
+
+			credentials, err := cfg.Credentials.Retrieve(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			session, _ := api.LookupAccessKey(credentials.AccessKeyID)
+
+			return session.RoleArn, nil
+		})
+
+	if most != 3 {
+		t.Errorf("got %d accounts checked at once, want 3", most)
+	}
+
+	if report.Succeeded != 10 || report.Failed != 2 || len(report.Accounts) != 12 {
+		t.Fatalf("got %d succeeded and %d failed", report.Succeeded, report.Failed)
+	}
+
+	for i, result := range report.Accounts[:10] {
+		if result.Account != accounts[i].ID || result.Result != accounts[i].RoleARN || result.Error != "" {
+			t.Errorf("got %+v for account %s", result, accounts[i].ID)
+		}
+	}
+
+	if report.Accounts[10].Error != errCheck.Error() || !strings.Contains(report.Accounts[11].Error, "AccessDenied") {
+		t.Errorf("got errors %q and %q", report.Accounts[10].Error, report.Accounts[11].Error)
+	}
+
+	for _, session := range api.Sessions() {
+		if session.RoleSessionName != "multi-account" {
+			t.Errorf("got session name %s", session.RoleSessionName)
+		}
+	}
+
+	b, err := json.Marshal(report.Accounts[10])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"account":"100000000010","roleArn":"arn:aws:iam::100000000010:role/aws-docs-example-audit","error":"check failed"}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestRunAccountsCanceled(t *testing.T) {
+	api := stsfake.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := RunAccounts(ctx, aws.Config{}, api, testAccounts(3), RunOptions{},
+		func(ctx context.Context, account Account, cfg aws.Config) (interface{}, error) {
+			return nil, nil
+		})
+
+	if report.Failed != 3 || len(api.Sessions()) != 0 {
+		t.Errorf("got %d failed after %d sessions, want 3 and 0", report.Failed, len(api.Sessions()))
+	}
+}
+
+func TestRunAccountsLocal(t *testing.T) {
+	server := localaws.NewServer()
+	defer server.Close()
+
+	_, err := server.S3.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("aws-docs-example-bucket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := server.Config()
+	accounts := testAccounts(2)
+
+	// Record who each check runs as, then run the ListBuckets check
+	identities := make([]string, len(accounts))
+	report := RunAccounts(context.Background(), cfg, sts.NewFromConfig(cfg), accounts, RunOptions{SessionName: "aws-docs-example-audit"},
+		func(ctx context.Context, account Account, cfg aws.Config) (interface{}, error) {
+			identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+			if err != nil {
+				return nil, err
+			}
+
+			for i := range accounts {
+				if accounts[i].ID == account.ID {
+					identities[i] = aws.ToString(identity.Arn)
+				}
+			}
+
+			return checks["ListBuckets"](ctx, account, cfg)
+		})
+
+	if report.Succeeded != 2 {
+		t.Fatalf("got %+v", report)
+	}
+
+	for i, account := range accounts {
+		if want := "arn:aws:sts::" + account.ID + ":assumed-role/aws-docs-example-audit/aws-docs-example-audit"; identities[i] != want {
+			t.Errorf("got %s, want %s", identities[i], want)
+		}
+
+		names, ok := report.Accounts[i].Result.([]string)
+		if !ok || len(names) != 1 || names[0] != "aws-docs-example-bucket" {
+			t.Errorf("got %v", report.Accounts[i].Result)
+		}
+	}
+}